@@ -23,15 +23,23 @@ import (
 	"github.com/spf13/viper"
 )
 
+type CompressionConfig struct {
+	ExperimentalRules []string `yaml:"experimental-rules"`
+}
+
 type Config struct {
 	AppName string `yaml:"app-name"`
 
 	CacheDir ResolvedPath `yaml:"cache-dir"`
 
+	Compression CompressionConfig `yaml:"compression"`
+
 	Debug DebugConfig `yaml:"debug"`
 
 	EnableHns bool `yaml:"enable-hns"`
 
+	Encryption EncryptionConfig `yaml:"encryption"`
+
 	FileCache FileCacheConfig `yaml:"file-cache"`
 
 	FileSystem FileSystemConfig `yaml:"file-system"`
@@ -58,6 +66,10 @@ type Config struct {
 
 	OnlyDir string `yaml:"only-dir"`
 
+	Quota QuotaConfig `yaml:"quota"`
+
+	Read ReadConfig `yaml:"read"`
+
 	Write WriteConfig `yaml:"write"`
 }
 
@@ -71,6 +83,16 @@ type DebugConfig struct {
 	LogMutex bool `yaml:"log-mutex"`
 }
 
+type EncryptionConfig struct {
+	CustomerKeys []string `yaml:"customer-keys"`
+
+	ExperimentalKmsKeyName string `yaml:"experimental-kms-key-name"`
+
+	ExperimentalMasterKeyFile ResolvedPath `yaml:"experimental-master-key-file"`
+
+	KmsKeyNames []string `yaml:"kms-key-names"`
+}
+
 type FileCacheConfig struct {
 	CacheFileForRangeRead bool `yaml:"cache-file-for-range-read"`
 
@@ -82,12 +104,20 @@ type FileCacheConfig struct {
 
 	EnableParallelDownloads bool `yaml:"enable-parallel-downloads"`
 
+	ExperimentalEnableSparseFile bool `yaml:"experimental-enable-sparse-file"`
+
+	ExperimentalEnableWarmRestart bool `yaml:"experimental-enable-warm-restart"`
+
 	MaxParallelDownloads int64 `yaml:"max-parallel-downloads"`
 
 	MaxSizeMb int64 `yaml:"max-size-mb"`
 
 	ParallelDownloadsPerFile int64 `yaml:"parallel-downloads-per-file"`
 
+	SparseChunkSizeMb int64 `yaml:"sparse-chunk-size-mb"`
+
+	SparseNeighborChunks int64 `yaml:"sparse-neighbor-chunks"`
+
 	WriteBufferSize int64 `yaml:"write-buffer-size"`
 }
 
@@ -96,6 +126,8 @@ type FileSystemConfig struct {
 
 	DisableParallelDirops bool `yaml:"disable-parallel-dirops"`
 
+	ExperimentalPersistPosixAttributes bool `yaml:"experimental-persist-posix-attributes"`
+
 	FileMode Octal `yaml:"file-mode"`
 
 	FuseOptions []string `yaml:"fuse-options"`
@@ -164,6 +196,14 @@ type GcsRetriesConfig struct {
 }
 
 type ListConfig struct {
+	BucketAllow []string `yaml:"bucket-allow"`
+
+	BucketDeny []string `yaml:"bucket-deny"`
+
+	BucketsProject string `yaml:"buckets-project"`
+
+	BucketsTtl time.Duration `yaml:"buckets-ttl"`
+
 	EnableEmptyManagedFolders bool `yaml:"enable-empty-managed-folders"`
 }
 
@@ -221,6 +261,32 @@ type MonitoringConfig struct {
 	ExperimentalTracingSamplingRatio float64 `yaml:"experimental-tracing-sampling-ratio"`
 }
 
+type QuotaConfig struct {
+	ExceededError string `yaml:"exceeded-error"`
+
+	LimitBytes int64 `yaml:"limit-bytes"`
+
+	LimitObjects int64 `yaml:"limit-objects"`
+
+	UsageScanInterval time.Duration `yaml:"usage-scan-interval"`
+}
+
+type ReadConfig struct {
+	ExperimentalEnableReadahead bool `yaml:"experimental-enable-readahead"`
+
+	MemoryCacheBlockSizeMb int64 `yaml:"memory-cache-block-size-mb"`
+
+	MemoryCacheMaxSizeMb int64 `yaml:"memory-cache-max-size-mb"`
+
+	ReadaheadBlockSizeMb int64 `yaml:"readahead-block-size-mb"`
+
+	ReadaheadGlobalMaxBlocks int64 `yaml:"readahead-global-max-blocks"`
+
+	ReadaheadMaxBlocks int64 `yaml:"readahead-max-blocks"`
+
+	ReadaheadStreams int64 `yaml:"readahead-streams"`
+}
+
 type ReadStallGcsRetriesConfig struct {
 	Enable bool `yaml:"enable"`
 
@@ -240,11 +306,31 @@ type WriteConfig struct {
 
 	CreateEmptyFile bool `yaml:"create-empty-file"`
 
+	ExperimentalBackgroundSyncAge time.Duration `yaml:"experimental-background-sync-age"`
+
+	ExperimentalBackgroundSyncDirtyBytes int64 `yaml:"experimental-background-sync-dirty-bytes"`
+
+	ExperimentalConflictPolicy string `yaml:"experimental-conflict-policy"`
+
 	ExperimentalEnableStreamingWrites bool `yaml:"experimental-enable-streaming-writes"`
 
+	ExperimentalParallelCompositeUploads bool `yaml:"experimental-parallel-composite-uploads"`
+
+	ExperimentalSpillToDisk bool `yaml:"experimental-spill-to-disk"`
+
+	ExperimentalWriteBack bool `yaml:"experimental-write-back"`
+
 	GlobalMaxBlocks int64 `yaml:"global-max-blocks"`
 
 	MaxBlocksPerFile int64 `yaml:"max-blocks-per-file"`
+
+	MimeTypes []string `yaml:"mime-types"`
+
+	ObjectDefaults []ObjectDefaults `yaml:"object-defaults"`
+
+	ReorderWindowBlocks int64 `yaml:"reorder-window-blocks"`
+
+	SniffContentType bool `yaml:"sniff-content-type"`
 }
 
 func BuildFlagSet(flagSet *pflag.FlagSet) error {
@@ -339,24 +425,88 @@ func BuildFlagSet(flagSet *pflag.FlagSet) error {
 		return err
 	}
 
+	flagSet.StringSliceP("encryption-customer-keys", "", []string{}, "Customer-supplied AES-256 keys that objects are read and written with, as <bucket>=<source> entries where the source is file:<path>, env:<variable> or secretmanager:projects/<project>/secrets/<secret>/versions/<version>, holding 32 raw or base64 encoded bytes. A bucket of * stands for all buckets not listed.")
+
+	flagSet.StringSliceP("encryption-kms-key-names", "", []string{}, "Cloud KMS keys that new objects are encrypted with, as <bucket>=<key> entries where the key is of the form projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>. A bucket of * stands for all buckets not listed.")
+
+	flagSet.DurationP("experimental-background-sync-age", "", 0*time.Nanosecond, "Uploads files that are kept open in the background once they have been dirty for this long, so that less is lost if the machine goes away. The default value 0 disables it.")
+
+	if err := flagSet.MarkHidden("experimental-background-sync-age"); err != nil {
+		return err
+	}
+
+	flagSet.IntP("experimental-background-sync-dirty-bytes", "", 0, "Uploads files that are kept open in the background once this many bytes of them have been written since the last upload. The default value 0 disables it.")
+
+	if err := flagSet.MarkHidden("experimental-background-sync-dirty-bytes"); err != nil {
+		return err
+	}
+
+	flagSet.StringSliceP("experimental-bucket-allow", "", []string{}, "Glob patterns of the buckets shown in the root directory of a mount of all buckets. If set, only matching buckets are listed and can be entered.")
+
+	if err := flagSet.MarkHidden("experimental-bucket-allow"); err != nil {
+		return err
+	}
+
+	flagSet.StringSliceP("experimental-bucket-deny", "", []string{}, "Glob patterns of buckets hidden from the root directory of a mount of all buckets. Takes precedence over experimental-bucket-allow.")
+
+	if err := flagSet.MarkHidden("experimental-bucket-deny"); err != nil {
+		return err
+	}
+
+	flagSet.StringSliceP("experimental-compression-rules", "", []string{}, "Compresses new objects whose names match a glob, as <glob>=<codec> entries where the codec is gzip or zstd, and decompresses them on read along with objects stored with Content-Encoding gzip. A glob without a / is matched against the last component of the name. The first matching entry wins.")
+
+	if err := flagSet.MarkHidden("experimental-compression-rules"); err != nil {
+		return err
+	}
+
 	flagSet.BoolP("experimental-enable-json-read", "", false, "By default, GCSFuse uses the GCS XML API to get and read objects. When this flag is specified, GCSFuse uses the GCS JSON API instead.\"")
 
 	if err := flagSet.MarkDeprecated("experimental-enable-json-read", "Experimental flag: could be dropped even in a minor release."); err != nil {
 		return err
 	}
 
+	flagSet.BoolP("experimental-enable-readahead", "", false, "Once a file handle reads sequentially, fetches the blocks ahead of it from GCS over several concurrent streams instead of reading a single stream. Doesn't apply to reads served by the file cache.")
+
+	if err := flagSet.MarkHidden("experimental-enable-readahead"); err != nil {
+		return err
+	}
+
 	flagSet.BoolP("experimental-enable-streaming-writes", "", false, "Enables streaming uploads during write file operation.")
 
 	if err := flagSet.MarkHidden("experimental-enable-streaming-writes"); err != nil {
 		return err
 	}
 
+	flagSet.StringP("experimental-encryption-kms-key-name", "", "", "Encrypts the contents of objects on the client with data keys wrapped by this Cloud KMS key, of the form projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>.")
+
+	if err := flagSet.MarkHidden("experimental-encryption-kms-key-name"); err != nil {
+		return err
+	}
+
+	flagSet.StringP("experimental-encryption-master-key-file", "", "", "Encrypts the contents of objects on the client with data keys wrapped by the AES-256 key in this file, as 32 raw or base64 encoded bytes.")
+
+	if err := flagSet.MarkHidden("experimental-encryption-master-key-file"); err != nil {
+		return err
+	}
+
 	flagSet.IntP("experimental-grpc-conn-pool-size", "", 1, "The number of gRPC channel in grpc client.")
 
 	if err := flagSet.MarkDeprecated("experimental-grpc-conn-pool-size", "Experimental flag: can be removed in a minor release."); err != nil {
 		return err
 	}
 
+	flagSet.StringP("experimental-list-buckets-project", "", "", "The project whose buckets are listed in the root directory of a mount of all buckets. Listing the root directory is not supported if unset.")
+
+	if err := flagSet.MarkHidden("experimental-list-buckets-project"); err != nil {
+		return err
+	}
+
+	flagSet.DurationP("experimental-list-buckets-ttl", "", 60000000000*time.Nanosecond, "How long the list of buckets in the root directory of a mount of all buckets is cached.")
+
+	if err := flagSet.MarkHidden("experimental-list-buckets-ttl"); err != nil {
+		return err
+	}
+
 	flagSet.StringP("experimental-metadata-prefetch-on-mount", "", "disabled", "Experimental: This indicates whether or not to prefetch the metadata (prefilling of metadata caches and creation of inodes) of the mounted bucket at the time of mounting the bucket. Supported values: \"disabled\", \"sync\" and \"async\". Any other values will return error on mounting. This is applicable only to static mounting, and not to dynamic mounting.")
 
 	if err := flagSet.MarkDeprecated("experimental-metadata-prefetch-on-mount", "Experimental flag: could be removed even in a minor release."); err != nil {
@@ -369,6 +519,42 @@ func BuildFlagSet(flagSet *pflag.FlagSet) error {
 		return err
 	}
 
+	flagSet.BoolP("experimental-parallel-composite-uploads", "", false, "With streaming writes, uploads full blocks in parallel as temporary objects and composes them into the object when the file is closed.")
+
+	if err := flagSet.MarkHidden("experimental-parallel-composite-uploads"); err != nil {
+		return err
+	}
+
+	flagSet.BoolP("experimental-persist-posix-attributes", "", false, "Persist the mode, uid, gid and atime of files and explicit directories in object metadata. chmod and chown then update the backing object's metadata instead of being ignored, and persisted values take precedence over --file-mode, --dir-mode, --uid and --gid.")
+
+	if err := flagSet.MarkHidden("experimental-persist-posix-attributes"); err != nil {
+		return err
+	}
+
+	flagSet.StringP("experimental-quota-exceeded-error", "", "enospc", "Error returned by writes, creates and mkdirs that would exceed a configured quota: \"enospc\" or \"edquot\".")
+
+	if err := flagSet.MarkHidden("experimental-quota-exceeded-error"); err != nil {
+		return err
+	}
+
+	flagSet.IntP("experimental-quota-limit-bytes", "", 0, "Size in bytes reported by statfs for the mount (the bucket, or only-dir if set), whose free space is computed from the size of the objects in it. Writes that would exceed it fail. 0 means no limit.")
+
+	if err := flagSet.MarkHidden("experimental-quota-limit-bytes"); err != nil {
+		return err
+	}
+
+	flagSet.IntP("experimental-quota-limit-objects", "", 0, "Number of inodes reported by statfs for the mount, whose free inodes are computed from the number of objects in it. Creates that would exceed it fail. 0 means no limit.")
+
+	if err := flagSet.MarkHidden("experimental-quota-limit-objects"); err != nil {
+		return err
+	}
+
+	flagSet.DurationP("experimental-quota-usage-scan-interval", "", 300000000000*time.Nanosecond, "How often the objects of the mount are listed to recompute its usage when a quota is configured. Local changes are accounted for in between.")
+
+	if err := flagSet.MarkHidden("experimental-quota-usage-scan-interval"); err != nil {
+		return err
+	}
+
 	flagSet.StringP("experimental-tracing-mode", "", "", "Experimental: specify tracing mode")
 
 	if err := flagSet.MarkHidden("experimental-tracing-mode"); err != nil {
@@ -381,6 +567,24 @@ func BuildFlagSet(flagSet *pflag.FlagSet) error {
 		return err
 	}
 
+	flagSet.BoolP("experimental-write-back", "", false, "Returns from close once the contents of a file have been journaled in the temp directory, and uploads them in the background. Uploads that haven't finished are resumed on the next mount. Can't be used with streaming writes.")
+
+	if err := flagSet.MarkHidden("experimental-write-back"); err != nil {
+		return err
+	}
+
+	flagSet.StringP("experimental-write-conflict-policy", "", "fail", "What to do with the content of a file whose object has been changed by someone else since it was read: \"fail\" the sync, overwrite the object (\"last-writer-wins\"), or upload the content next to it as <name>.conflict-<hostname>-<generation> (\"conflict-copy\").")
+
+	if err := flagSet.MarkHidden("experimental-write-conflict-policy"); err != nil {
+		return err
+	}
+
+	flagSet.BoolP("experimental-write-spill-to-disk", "", false, "With streaming writes, creates blocks as files in the temp directory once write-global-max-blocks blocks are in memory, instead of waiting for memory to be freed.")
+
+	if err := flagSet.MarkHidden("experimental-write-spill-to-disk"); err != nil {
+		return err
+	}
+
 	flagSet.BoolP("file-cache-cache-file-for-range-read", "", false, "Whether to cache file for range reads.")
 
 	flagSet.IntP("file-cache-download-chunk-size-mb", "", 50, "Size of chunks in MiB that each concurrent request downloads.")
@@ -399,12 +603,36 @@ func BuildFlagSet(flagSet *pflag.FlagSet) error {
 
 	flagSet.BoolP("file-cache-enable-parallel-downloads", "", false, "Enable parallel downloads.")
 
+	flagSet.BoolP("file-cache-experimental-enable-sparse-file", "", false, "Experimental: Download into the file cache only the chunks of objects that are read, rather than whole objects, so that random reads are cached regardless of cache-file-for-range-read. CRC checks don't apply to sparse files.")
+
+	if err := flagSet.MarkHidden("file-cache-experimental-enable-sparse-file"); err != nil {
+		return err
+	}
+
+	flagSet.BoolP("file-cache-experimental-enable-warm-restart", "", false, "Experimental: Keep an index of the file cache in cache-dir at unmount, so that the next mount reuses the files in cache, validating them against the generations of objects as they are read and resuming partial downloads.")
+
+	if err := flagSet.MarkHidden("file-cache-experimental-enable-warm-restart"); err != nil {
+		return err
+	}
+
 	flagSet.IntP("file-cache-max-parallel-downloads", "", DefaultMaxParallelDownloads(), "Sets an uber limit of number of concurrent file download requests that are made across all files.")
 
 	flagSet.IntP("file-cache-max-size-mb", "", -1, "Maximum size of the file-cache in MiBs")
 
 	flagSet.IntP("file-cache-parallel-downloads-per-file", "", 16, "Number of concurrent download requests per file.")
 
+	flagSet.IntP("file-cache-sparse-chunk-size-mb", "", 1, "Size in MiB of the chunks in which sparse files are downloaded and evicted.")
+
+	if err := flagSet.MarkHidden("file-cache-sparse-chunk-size-mb"); err != nil {
+		return err
+	}
+
+	flagSet.IntP("file-cache-sparse-neighbor-chunks", "", 0, "Number of chunks following those read that are also downloaded into sparse files.")
+
+	if err := flagSet.MarkHidden("file-cache-sparse-neighbor-chunks"); err != nil {
+		return err
+	}
+
 	flagSet.IntP("file-cache-write-buffer-size", "", 4194304, "Size of in-memory buffer that is used per goroutine in parallel downloads while writing to file-cache.")
 
 	if err := flagSet.MarkHidden("file-cache-write-buffer-size"); err != nil {
@@ -463,6 +691,18 @@ func BuildFlagSet(flagSet *pflag.FlagSet) error {
 
 	flagSet.DurationP("max-retry-sleep", "", 30000000000*time.Nanosecond, "The maximum duration allowed to sleep in a retry loop with exponential backoff for failed requests to GCS backend. Once the backoff duration exceeds this limit, the retry continues with this specified maximum value.")
 
+	flagSet.IntP("memory-cache-block-size-mb", "", 1, "The size of the ranges of objects that the memory cache holds and fetches from GCS, in MiB.")
+
+	if err := flagSet.MarkHidden("memory-cache-block-size-mb"); err != nil {
+		return err
+	}
+
+	flagSet.IntP("memory-cache-max-size-mb", "", 0, "The memory that the cache of object contents shared by all the files of the mount may use, in MiB. Random reads that the file cache doesn't serve are served from it, fetching the ranges it lacks from GCS, while sequential ones bypass it. 0 disables it.")
+
+	if err := flagSet.MarkHidden("memory-cache-max-size-mb"); err != nil {
+		return err
+	}
+
 	flagSet.IntP("metadata-cache-ttl-secs", "", 60, "The ttl value in seconds to be used for expiring items in metadata-cache. It can be set to -1 for no-ttl, 0 for no cache and > 0 for ttl-controlled metadata-cache. Any value set below -1 will throw an error.")
 
 	flagSet.StringSliceP("o", "", []string{}, "Additional system-specific mount options. Multiple options can be passed as comma separated. For readonly, use --o ro")
@@ -511,6 +751,30 @@ func BuildFlagSet(flagSet *pflag.FlagSet) error {
 		return err
 	}
 
+	flagSet.IntP("readahead-block-size-mb", "", 8, "The size of each block fetched by readahead, in MiB.")
+
+	if err := flagSet.MarkHidden("readahead-block-size-mb"); err != nil {
+		return err
+	}
+
+	flagSet.IntP("readahead-global-max-blocks", "", 64, "The maximum number of blocks the readahead of all file handles may hold at once, which bounds the memory it uses across the mount. Reads that find none free are served without readahead. -1 means no limit.")
+
+	if err := flagSet.MarkHidden("readahead-global-max-blocks"); err != nil {
+		return err
+	}
+
+	flagSet.IntP("readahead-max-blocks", "", 16, "The maximum number of blocks a file handle fetches or holds ahead of its reads, which bounds its readahead memory. The window starts at one block and doubles as the blocks are read.")
+
+	if err := flagSet.MarkHidden("readahead-max-blocks"); err != nil {
+		return err
+	}
+
+	flagSet.IntP("readahead-streams", "", 4, "The maximum number of concurrent GCS reads of a file handle's readahead.")
+
+	if err := flagSet.MarkHidden("readahead-streams"); err != nil {
+		return err
+	}
+
 	flagSet.IntP("rename-dir-limit", "", 0, "Allow rename a directory containing fewer descendants than this limit.")
 
 	flagSet.Float64P("retry-multiplier", "", 2, "Param for exponential backoff algorithm, which is used to increase waiting time b/w two consecutive retries.")
@@ -571,6 +835,30 @@ func BuildFlagSet(flagSet *pflag.FlagSet) error {
 		return err
 	}
 
+	flagSet.StringSliceP("write-mime-types", "", []string{}, "Content types of new objects by the extension of their names, given as <extension>=<type>, e.g. .parquet=application/vnd.apache.parquet. These take precedence over the types known to the system.")
+
+	if err := flagSet.MarkHidden("write-mime-types"); err != nil {
+		return err
+	}
+
+	flagSet.StringSliceP("write-object-defaults", "", []string{}, "Attributes of new objects by their names. In a config file, a list of rules with a glob, where ** matches any number of directories, and any of storage-class, cache-control, content-disposition, content-language, content-type and metadata. As a flag, each rule is given as glob=<glob>;<attribute>=<value>;..., with metadata as metadata.<key>=<value>. The first rule whose glob matches the name of an object applies, and only to the attributes that aren't otherwise set.")
+
+	if err := flagSet.MarkHidden("write-object-defaults"); err != nil {
+		return err
+	}
+
+	flagSet.IntP("write-reorder-window-blocks", "", 4, "Specifies how many blocks ahead of the data written so far a streaming write may land. Such writes are held in memory until the gap before them is filled; writes beyond the window fall back to a local temp file. The value should be >= 0.")
+
+	if err := flagSet.MarkHidden("write-reorder-window-blocks"); err != nil {
+		return err
+	}
+
+	flagSet.BoolP("write-sniff-content-type", "", false, "Guesses the content type of new objects whose extension doesn't tell it from the first bytes of their contents.")
+
+	if err := flagSet.MarkHidden("write-sniff-content-type"); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -656,18 +944,66 @@ func BindFlags(v *viper.Viper, flagSet *pflag.FlagSet) error {
 		return err
 	}
 
+	if err := v.BindPFlag("encryption.customer-keys", flagSet.Lookup("encryption-customer-keys")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("encryption.kms-key-names", flagSet.Lookup("encryption-kms-key-names")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("write.experimental-background-sync-age", flagSet.Lookup("experimental-background-sync-age")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("write.experimental-background-sync-dirty-bytes", flagSet.Lookup("experimental-background-sync-dirty-bytes")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("list.bucket-allow", flagSet.Lookup("experimental-bucket-allow")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("list.bucket-deny", flagSet.Lookup("experimental-bucket-deny")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("compression.experimental-rules", flagSet.Lookup("experimental-compression-rules")); err != nil {
+		return err
+	}
+
 	if err := v.BindPFlag("gcs-connection.experimental-enable-json-read", flagSet.Lookup("experimental-enable-json-read")); err != nil {
 		return err
 	}
 
+	if err := v.BindPFlag("read.experimental-enable-readahead", flagSet.Lookup("experimental-enable-readahead")); err != nil {
+		return err
+	}
+
 	if err := v.BindPFlag("write.experimental-enable-streaming-writes", flagSet.Lookup("experimental-enable-streaming-writes")); err != nil {
 		return err
 	}
 
+	if err := v.BindPFlag("encryption.experimental-kms-key-name", flagSet.Lookup("experimental-encryption-kms-key-name")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("encryption.experimental-master-key-file", flagSet.Lookup("experimental-encryption-master-key-file")); err != nil {
+		return err
+	}
+
 	if err := v.BindPFlag("gcs-connection.grpc-conn-pool-size", flagSet.Lookup("experimental-grpc-conn-pool-size")); err != nil {
 		return err
 	}
 
+	if err := v.BindPFlag("list.buckets-project", flagSet.Lookup("experimental-list-buckets-project")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("list.buckets-ttl", flagSet.Lookup("experimental-list-buckets-ttl")); err != nil {
+		return err
+	}
+
 	if err := v.BindPFlag("metadata-cache.experimental-metadata-prefetch-on-mount", flagSet.Lookup("experimental-metadata-prefetch-on-mount")); err != nil {
 		return err
 	}
@@ -676,6 +1012,30 @@ func BindFlags(v *viper.Viper, flagSet *pflag.FlagSet) error {
 		return err
 	}
 
+	if err := v.BindPFlag("write.experimental-parallel-composite-uploads", flagSet.Lookup("experimental-parallel-composite-uploads")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("file-system.experimental-persist-posix-attributes", flagSet.Lookup("experimental-persist-posix-attributes")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("quota.exceeded-error", flagSet.Lookup("experimental-quota-exceeded-error")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("quota.limit-bytes", flagSet.Lookup("experimental-quota-limit-bytes")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("quota.limit-objects", flagSet.Lookup("experimental-quota-limit-objects")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("quota.usage-scan-interval", flagSet.Lookup("experimental-quota-usage-scan-interval")); err != nil {
+		return err
+	}
+
 	if err := v.BindPFlag("monitoring.experimental-tracing-mode", flagSet.Lookup("experimental-tracing-mode")); err != nil {
 		return err
 	}
@@ -684,6 +1044,18 @@ func BindFlags(v *viper.Viper, flagSet *pflag.FlagSet) error {
 		return err
 	}
 
+	if err := v.BindPFlag("write.experimental-write-back", flagSet.Lookup("experimental-write-back")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("write.experimental-conflict-policy", flagSet.Lookup("experimental-write-conflict-policy")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("write.experimental-spill-to-disk", flagSet.Lookup("experimental-write-spill-to-disk")); err != nil {
+		return err
+	}
+
 	if err := v.BindPFlag("file-cache.cache-file-for-range-read", flagSet.Lookup("file-cache-cache-file-for-range-read")); err != nil {
 		return err
 	}
@@ -704,6 +1076,14 @@ func BindFlags(v *viper.Viper, flagSet *pflag.FlagSet) error {
 		return err
 	}
 
+	if err := v.BindPFlag("file-cache.experimental-enable-sparse-file", flagSet.Lookup("file-cache-experimental-enable-sparse-file")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("file-cache.experimental-enable-warm-restart", flagSet.Lookup("file-cache-experimental-enable-warm-restart")); err != nil {
+		return err
+	}
+
 	if err := v.BindPFlag("file-cache.max-parallel-downloads", flagSet.Lookup("file-cache-max-parallel-downloads")); err != nil {
 		return err
 	}
@@ -716,6 +1096,14 @@ func BindFlags(v *viper.Viper, flagSet *pflag.FlagSet) error {
 		return err
 	}
 
+	if err := v.BindPFlag("file-cache.sparse-chunk-size-mb", flagSet.Lookup("file-cache-sparse-chunk-size-mb")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("file-cache.sparse-neighbor-chunks", flagSet.Lookup("file-cache-sparse-neighbor-chunks")); err != nil {
+		return err
+	}
+
 	if err := v.BindPFlag("file-cache.write-buffer-size", flagSet.Lookup("file-cache-write-buffer-size")); err != nil {
 		return err
 	}
@@ -804,6 +1192,14 @@ func BindFlags(v *viper.Viper, flagSet *pflag.FlagSet) error {
 		return err
 	}
 
+	if err := v.BindPFlag("read.memory-cache-block-size-mb", flagSet.Lookup("memory-cache-block-size-mb")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("read.memory-cache-max-size-mb", flagSet.Lookup("memory-cache-max-size-mb")); err != nil {
+		return err
+	}
+
 	if err := v.BindPFlag("metadata-cache.ttl-secs", flagSet.Lookup("metadata-cache-ttl-secs")); err != nil {
 		return err
 	}
@@ -844,6 +1240,22 @@ func BindFlags(v *viper.Viper, flagSet *pflag.FlagSet) error {
 		return err
 	}
 
+	if err := v.BindPFlag("read.readahead-block-size-mb", flagSet.Lookup("readahead-block-size-mb")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("read.readahead-global-max-blocks", flagSet.Lookup("readahead-global-max-blocks")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("read.readahead-max-blocks", flagSet.Lookup("readahead-max-blocks")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("read.readahead-streams", flagSet.Lookup("readahead-streams")); err != nil {
+		return err
+	}
+
 	if err := v.BindPFlag("file-system.rename-dir-limit", flagSet.Lookup("rename-dir-limit")); err != nil {
 		return err
 	}
@@ -908,5 +1320,21 @@ func BindFlags(v *viper.Viper, flagSet *pflag.FlagSet) error {
 		return err
 	}
 
+	if err := v.BindPFlag("write.mime-types", flagSet.Lookup("write-mime-types")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("write.object-defaults", flagSet.Lookup("write-object-defaults")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("write.reorder-window-blocks", flagSet.Lookup("write-reorder-window-blocks")); err != nil {
+		return err
+	}
+
+	if err := v.BindPFlag("write.sniff-content-type", flagSet.Lookup("write-sniff-content-type")); err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -16,7 +16,10 @@ package cfg
 
 import (
 	"fmt"
+	"mime"
+	"path"
 	"runtime"
+	"strings"
 	"time"
 )
 
@@ -28,6 +31,12 @@ func IsFileCacheEnabled(mountConfig *Config) bool {
 	return mountConfig.FileCache.MaxSizeMb != 0 && string(mountConfig.CacheDir) != ""
 }
 
+// IsMemoryCacheEnabled returns true if the memory cache of object contents is
+// given some memory.
+func IsMemoryCacheEnabled(rc *ReadConfig) bool {
+	return rc.MemoryCacheMaxSizeMb > 0
+}
+
 func IsParallelDownloadsEnabled(mountConfig *Config) bool {
 	return IsFileCacheEnabled(mountConfig) && mountConfig.FileCache.EnableParallelDownloads
 }
@@ -55,3 +64,148 @@ func ListCacheTTLSecsToDuration(secs int64) time.Duration {
 func IsMetricsEnabled(c *MetricsConfig) bool {
 	return c.CloudMetricsExportIntervalSecs > 0 || c.PrometheusPort > 0
 }
+
+// IsQuotaEnabled returns true if a byte or object quota is configured, in
+// which case statfs reports the usage of the mount.
+func IsQuotaEnabled(c *QuotaConfig) bool {
+	return c.LimitBytes > 0 || c.LimitObjects > 0
+}
+
+// AllBuckets stands for the buckets not listed in per-bucket settings such as
+// encryption.customer-keys.
+const AllBuckets = "*"
+
+// ParseBucketValues parses per-bucket settings given as <bucket>=<value>
+// entries into a map from bucket names, which may be AllBuckets, to values.
+func ParseBucketValues(entries []string) (map[string]string, error) {
+	values := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		bucket, value, ok := strings.Cut(entry, "=")
+		if !ok || bucket == "" || value == "" {
+			return nil, fmt.Errorf("%q isn't of the form <bucket>=<value>", entry)
+		}
+		if _, ok := values[bucket]; ok {
+			return nil, fmt.Errorf("bucket %q is listed more than once", bucket)
+		}
+		values[bucket] = value
+	}
+	return values, nil
+}
+
+// BucketValue returns the value for the bucket in a map returned by
+// ParseBucketValues, falling back to that for AllBuckets.
+func BucketValue[V any](values map[string]V, bucket string) (v V, ok bool) {
+	if v, ok = values[bucket]; ok {
+		return
+	}
+	v, ok = values[AllBuckets]
+	return
+}
+
+// CompressionRule has new objects whose names match Pattern compressed with
+// Codec.
+type CompressionRule struct {
+	Pattern string
+	Codec   string
+}
+
+// Matches tells whether the rule applies to the named object. Patterns
+// without a / are matched against the last component of the name.
+func (r CompressionRule) Matches(objectName string) bool {
+	if !strings.Contains(r.Pattern, "/") {
+		objectName = path.Base(objectName)
+	}
+	matched, _ := path.Match(r.Pattern, objectName)
+	return matched
+}
+
+// ParseCompressionRules parses compression rules given as <glob>=<codec>
+// entries, keeping their order.
+func ParseCompressionRules(entries []string) ([]CompressionRule, error) {
+	rules := make([]CompressionRule, 0, len(entries))
+	for _, entry := range entries {
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%q isn't of the form <glob>=<codec>", entry)
+		}
+
+		rule := CompressionRule{Pattern: entry[:i], Codec: entry[i+1:]}
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", rule.Pattern, err)
+		}
+		switch rule.Codec {
+		case CompressionCodecGzip, CompressionCodecZstd:
+		default:
+			return nil, fmt.Errorf("unsupported codec %q for %q; supported values: gzip, zstd", rule.Codec, rule.Pattern)
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Matches tells whether the defaults apply to the named object. A ** component
+// of Glob matches any number of components of the name, other components
+// match one as with path.Match.
+func (d *ObjectDefaults) Matches(objectName string) bool {
+	return matchGlobComponents(strings.Split(d.Glob, "/"), strings.Split(objectName, "/"))
+}
+
+func matchGlobComponents(pattern []string, name []string) bool {
+	for ; len(pattern) > 0; pattern, name = pattern[1:], name[1:] {
+		if pattern[0] == "**" {
+			for i := range len(name) + 1 {
+				if matchGlobComponents(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], name[0]); !matched {
+			return false
+		}
+	}
+
+	return len(name) == 0
+}
+
+// ObjectDefaultsFor returns the first of the defaults that apply to the named
+// object, or nil if none do.
+func ObjectDefaultsFor(defaults []ObjectDefaults, objectName string) *ObjectDefaults {
+	for i := range defaults {
+		if defaults[i].Matches(objectName) {
+			return &defaults[i]
+		}
+	}
+	return nil
+}
+
+// ParseMimeTypes parses content types given as <extension>=<type> entries into
+// a map keyed by the lower case extension, including its leading dot.
+func ParseMimeTypes(entries []string) (map[string]string, error) {
+	types := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		ext, contentType, ok := strings.Cut(entry, "=")
+		if !ok || ext == "" || contentType == "" {
+			return nil, fmt.Errorf("%q isn't of the form <extension>=<type>", entry)
+		}
+
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return nil, fmt.Errorf("invalid content type %q: %w", contentType, err)
+		}
+
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if _, ok := types[ext]; ok {
+			return nil, fmt.Errorf("duplicate entry for extension %q", ext)
+		}
+		types[ext] = contentType
+	}
+	return types, nil
+}
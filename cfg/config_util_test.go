@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_DefaultMaxParallelDownloads(t *testing.T) {
@@ -203,3 +204,224 @@ func TestIsMetricsEnabled(t *testing.T) {
 		})
 	}
 }
+
+func TestIsQuotaEnabled(t *testing.T) {
+	t.Parallel()
+	var testCases = []struct {
+		testName string
+		q        *QuotaConfig
+		enabled  bool
+	}{
+		{"limit_bytes_set", &QuotaConfig{LimitBytes: 1 << 30}, true},
+		{"limit_objects_set", &QuotaConfig{LimitObjects: 1000}, true},
+		{"none_set", &QuotaConfig{}, false},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.testName, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.enabled, IsQuotaEnabled(tc.q))
+		})
+	}
+}
+
+func TestIsMemoryCacheEnabled(t *testing.T) {
+	t.Parallel()
+	var testCases = []struct {
+		testName string
+		rc       *ReadConfig
+		enabled  bool
+	}{
+		{"max_size_set", &ReadConfig{MemoryCacheMaxSizeMb: 1024, MemoryCacheBlockSizeMb: 1}, true},
+		{"max_size_unset", &ReadConfig{MemoryCacheBlockSizeMb: 1}, false},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.testName, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.enabled, IsMemoryCacheEnabled(tc.rc))
+		})
+	}
+}
+
+func TestParseBucketValues(t *testing.T) {
+	t.Parallel()
+
+	values, err := ParseBucketValues([]string{"a=file:/tmp/a=b.key", "*=env:KEY"})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "file:/tmp/a=b.key", "*": "env:KEY"}, values)
+	v, ok := BucketValue(values, "a")
+	assert.True(t, ok)
+	assert.Equal(t, "file:/tmp/a=b.key", v)
+	v, ok = BucketValue(values, "b")
+	assert.True(t, ok)
+	assert.Equal(t, "env:KEY", v)
+}
+
+func TestParseBucketValues_Invalid(t *testing.T) {
+	t.Parallel()
+	var testCases = []struct {
+		testName string
+		entries  []string
+	}{
+		{"no_separator", []string{"a"}},
+		{"no_bucket", []string{"=env:KEY"}},
+		{"no_value", []string{"a="}},
+		{"duplicate_bucket", []string{"a=env:KEY", "a=env:OTHER_KEY"}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.testName, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ParseBucketValues(tc.entries)
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestBucketValue_NotListed(t *testing.T) {
+	t.Parallel()
+
+	_, ok := BucketValue(map[string]string{"a": "env:KEY"}, "b")
+
+	assert.False(t, ok)
+}
+
+func TestParseCompressionRules(t *testing.T) {
+	t.Parallel()
+
+	rules, err := ParseCompressionRules([]string{"*.json=zstd", "logs/*=gzip"})
+
+	require.NoError(t, err)
+	assert.Equal(t, []CompressionRule{{"*.json", "zstd"}, {"logs/*", "gzip"}}, rules)
+}
+
+func TestParseCompressionRules_Invalid(t *testing.T) {
+	t.Parallel()
+	var testCases = []struct {
+		testName string
+		entries  []string
+	}{
+		{"no_separator", []string{"*.json"}},
+		{"no_glob", []string{"=gzip"}},
+		{"bad_glob", []string{"[.json=gzip"}},
+		{"unknown_codec", []string{"*.json=brotli"}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.testName, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ParseCompressionRules(tc.entries)
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCompressionRuleMatches(t *testing.T) {
+	t.Parallel()
+	var testCases = []struct {
+		testName   string
+		pattern    string
+		objectName string
+		matches    bool
+	}{
+		{"base_name", "*.csv", "data/2024/a.csv", true},
+		{"base_name_mismatch", "*.csv", "data/a.json", false},
+		{"full_name", "logs/*.log", "logs/app.log", true},
+		{"full_name_other_dir", "logs/*.log", "other/logs/app.log", false},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.testName, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.matches, CompressionRule{Pattern: tc.pattern, Codec: CompressionCodecGzip}.Matches(tc.objectName))
+		})
+	}
+}
+
+func TestObjectDefaultsMatches(t *testing.T) {
+	t.Parallel()
+	var testCases = []struct {
+		testName   string
+		glob       string
+		objectName string
+		matches    bool
+	}{
+		{"double_star", "logs/**", "logs/2024/01/app.log", true},
+		{"double_star_direct_child", "logs/**", "logs/app.log", true},
+		{"double_star_other_dir", "logs/**", "other/logs/app.log", false},
+		{"double_star_in_middle", "data/**/*.csv", "data/a/b/c.csv", true},
+		{"double_star_in_middle_no_dirs", "data/**/*.csv", "data/c.csv", true},
+		{"double_star_in_middle_mismatch", "data/**/*.csv", "data/a/c.json", false},
+		{"single_star_one_component", "logs/*", "logs/a/b.log", false},
+		{"exact", "index.html", "index.html", true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.testName, func(t *testing.T) {
+			t.Parallel()
+			d := ObjectDefaults{Glob: tc.glob}
+
+			assert.Equal(t, tc.matches, d.Matches(tc.objectName))
+		})
+	}
+}
+
+func TestObjectDefaultsFor(t *testing.T) {
+	defaults := []ObjectDefaults{
+		{Glob: "logs/**", StorageClass: "NEARLINE"},
+		{Glob: "**", CacheControl: "no-store"},
+	}
+
+	assert.Equal(t, &defaults[0], ObjectDefaultsFor(defaults, "logs/app.log"))
+	assert.Equal(t, &defaults[1], ObjectDefaultsFor(defaults, "data/a.csv"))
+	assert.Nil(t, ObjectDefaultsFor(defaults[:1], "data/a.csv"))
+}
+
+func TestParseMimeTypes(t *testing.T) {
+	types, err := ParseMimeTypes([]string{".parquet=application/vnd.apache.parquet", "MD=text/markdown; charset=utf-8"})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		".parquet": "application/vnd.apache.parquet",
+		".md":      "text/markdown; charset=utf-8",
+	}, types)
+}
+
+func TestParseMimeTypes_Invalid(t *testing.T) {
+	t.Parallel()
+	var testCases = []struct {
+		testName string
+		entries  []string
+	}{
+		{"missing_type", []string{".parquet"}},
+		{"empty_extension", []string{"=text/plain"}},
+		{"bad_type", []string{".x=text/"}},
+		{"duplicate", []string{".md=text/markdown", "md=text/plain"}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.testName, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ParseMimeTypes(tc.entries)
+
+			assert.Error(t, err)
+		})
+	}
+}
@@ -41,6 +41,32 @@ const (
 	ExperimentalMetadataPrefetchOnMountAsynchronous = "async"
 )
 
+const (
+	// QuotaExceededErrorENOSPC makes operations that would exceed a quota fail with ENOSPC.
+	QuotaExceededErrorENOSPC = "enospc"
+	// QuotaExceededErrorEDQUOT makes operations that would exceed a quota fail with EDQUOT.
+	QuotaExceededErrorEDQUOT = "edquot"
+)
+
+const (
+	// WriteConflictPolicyFail fails syncs of files whose object has been changed
+	// by someone else.
+	WriteConflictPolicyFail = "fail"
+	// WriteConflictPolicyLastWriterWins overwrites the object with the content
+	// of the file.
+	WriteConflictPolicyLastWriterWins = "last-writer-wins"
+	// WriteConflictPolicyConflictCopy uploads the content of the file as a new
+	// object next to the one that has been changed.
+	WriteConflictPolicyConflictCopy = "conflict-copy"
+)
+
+const (
+	// CompressionCodecGzip compresses objects with gzip.
+	CompressionCodecGzip = "gzip"
+	// CompressionCodecZstd compresses objects with Zstandard.
+	CompressionCodecZstd = "zstd"
+)
+
 const (
 	// maxSequentialReadSizeMb is the max value supported by sequential-read-size-mb flag.
 	maxSequentialReadSizeMB = 1024
@@ -17,9 +17,11 @@ package cfg
 import (
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/mitchellh/mapstructure"
 	flag "github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
@@ -46,6 +48,7 @@ func TestParsingSuccess(t *testing.T) {
 		LogSeverityParam LogSeverity
 		ProtocolParam    Protocol
 		PathParam        ResolvedPath
+		DefaultsParam    []ObjectDefaults
 	}
 	declareFlags := func() *flag.FlagSet {
 		fs := flag.NewFlagSet("test", flag.ExitOnError)
@@ -60,6 +63,7 @@ func TestParsingSuccess(t *testing.T) {
 		fs.String("logSeverityParam", "INFO", "")
 		fs.String("protocolParam", "http1", "")
 		fs.String("pathParam", "", "")
+		fs.StringSlice("defaultsParam", []string{}, "")
 		return fs
 	}
 
@@ -77,6 +81,7 @@ func TestParsingSuccess(t *testing.T) {
 		bindFlag(t, v, "LogSeverityParam", fs.Lookup("logSeverityParam"))
 		bindFlag(t, v, "ProtocolParam", fs.Lookup("protocolParam"))
 		bindFlag(t, v, "PathParam", fs.Lookup("pathParam"))
+		bindFlag(t, v, "DefaultsParam", fs.Lookup("defaultsParam"))
 		return v
 	}
 	tests := []struct {
@@ -212,6 +217,16 @@ func TestParsingSuccess(t *testing.T) {
 				assert.Equal(t, "/a/test.txt", string(c.PathParam))
 			},
 		},
+		{
+			name: "ObjectDefaults",
+			args: []string{"--defaultsParam=glob=logs/**;storage-class=NEARLINE;metadata.team=infra", "--defaultsParam=glob=*.html;cache-control=no-store"},
+			testFn: func(t *testing.T, c TestConfig) {
+				assert.Equal(t, []ObjectDefaults{
+					{Glob: "logs/**", StorageClass: "NEARLINE", Metadata: map[string]string{"team": "infra"}},
+					{Glob: "*.html", CacheControl: "no-store"},
+				}, c.DefaultsParam)
+			},
+		},
 	}
 
 	for _, tc := range tests {
@@ -244,12 +259,14 @@ func TestParsingError(t *testing.T) {
 		OctalParam       Octal
 		LogSeverityParam LogSeverity
 		ProtocolParam    Protocol
+		DefaultsParam    []ObjectDefaults
 	}
 	declareFlags := func() *flag.FlagSet {
 		fs := flag.NewFlagSet("test", flag.ExitOnError)
 		fs.String("octalParam", "0", "")
 		fs.String("logSeverityParam", "INFO", "")
 		fs.String("protocolParam", "http1", "")
+		fs.StringSlice("defaultsParam", []string{}, "")
 		return fs
 	}
 	bindFlags := func(fs *flag.FlagSet) *viper.Viper {
@@ -258,6 +275,7 @@ func TestParsingError(t *testing.T) {
 		bindFlag(t, v, "OctalParam", fs.Lookup("octalParam"))
 		bindFlag(t, v, "LogSeverityParam", fs.Lookup("logSeverityParam"))
 		bindFlag(t, v, "ProtocolParam", fs.Lookup("protocolParam"))
+		bindFlag(t, v, "DefaultsParam", fs.Lookup("defaultsParam"))
 		return v
 	}
 	tests := []struct {
@@ -280,6 +298,11 @@ func TestParsingError(t *testing.T) {
 			args:   []string{"--protocolParam=pqr"},
 			errMsg: "invalid protocol value: pqr. It can only accept values in the list: [http1 http2 grpc]",
 		},
+		{
+			name:   "ObjectDefaults",
+			args:   []string{"--defaultsParam=glob=logs/**;class=NEARLINE"},
+			errMsg: `unknown key "class"`,
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
@@ -302,3 +325,37 @@ func TestParsingError(t *testing.T) {
 		})
 	}
 }
+
+func TestObjectDefaultsFromConfigFile(t *testing.T) {
+	type TestConfig struct {
+		Defaults []ObjectDefaults `yaml:"defaults"`
+	}
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader(`
+defaults:
+  - glob: "logs/**"
+    storage-class: NEARLINE
+    cache-control: no-store
+    metadata:
+      team: infra
+`))
+	if err != nil {
+		t.Fatalf("Reading config failed: %v", err)
+	}
+	c := TestConfig{}
+
+	err = v.Unmarshal(&c, viper.DecodeHook(DecodeHook()), func(decoderConfig *mapstructure.DecoderConfig) {
+		decoderConfig.TagName = "yaml"
+		decoderConfig.ErrorUnused = true
+	})
+
+	if assert.Nil(t, err) {
+		assert.Equal(t, []ObjectDefaults{{
+			Glob:         "logs/**",
+			StorageClass: "NEARLINE",
+			CacheControl: "no-store",
+			Metadata:     map[string]string{"team": "infra"},
+		}}, c.Defaults)
+	}
+}
@@ -86,6 +86,20 @@ func resolveStreamingWriteConfig(w *WriteConfig) {
 	}
 }
 
+func resolveReadaheadConfig(r *ReadConfig) {
+	if r.ReadaheadGlobalMaxBlocks == -1 {
+		r.ReadaheadGlobalMaxBlocks = math.MaxInt64
+	}
+}
+
+// resolveEncryptionConfig turns off parallel composite uploads when contents
+// are encrypted on the client, as composing encrypted objects rewrites them.
+func resolveEncryptionConfig(e *EncryptionConfig, w *WriteConfig) {
+	if e.ExperimentalMasterKeyFile != "" || e.ExperimentalKmsKeyName != "" {
+		w.ExperimentalParallelCompositeUploads = false
+	}
+}
+
 func resolveCloudMetricsUploadIntervalSecs(m *MetricsConfig) {
 	if m.CloudMetricsExportIntervalSecs == 0 {
 		m.CloudMetricsExportIntervalSecs = int64(m.StackdriverExportInterval.Seconds())
@@ -108,6 +122,8 @@ func Rationalize(v isSet, c *Config) error {
 	}
 
 	resolveStreamingWriteConfig(&c.Write)
+	resolveReadaheadConfig(&c.Read)
+	resolveEncryptionConfig(&c.Encryption, &c.Write)
 	resolveMetadataCacheTTL(v, &c.MetadataCache)
 	resolveStatCacheMaxSizeMB(v, &c.MetadataCache)
 	resolveCloudMetricsUploadIntervalSecs(&c.Metrics)
@@ -372,6 +372,48 @@ func TestRationalize_WriteConfig(t *testing.T) {
 	}
 }
 
+func TestRationalize_EncryptionConfig(t *testing.T) {
+	testCases := []struct {
+		name                             string
+		config                           *Config
+		expectedParallelCompositeUploads bool
+	}{
+		{
+			name: "encryption_disabled",
+			config: &Config{
+				Write: WriteConfig{ExperimentalParallelCompositeUploads: true},
+			},
+			expectedParallelCompositeUploads: true,
+		},
+		{
+			name: "master_key_file",
+			config: &Config{
+				Encryption: EncryptionConfig{ExperimentalMasterKeyFile: "/tmp/key"},
+				Write:      WriteConfig{ExperimentalParallelCompositeUploads: true},
+			},
+			expectedParallelCompositeUploads: false,
+		},
+		{
+			name: "kms_key_name",
+			config: &Config{
+				Encryption: EncryptionConfig{ExperimentalKmsKeyName: "projects/p/locations/l/keyRings/r/cryptoKeys/k"},
+				Write:      WriteConfig{ExperimentalParallelCompositeUploads: true},
+			},
+			expectedParallelCompositeUploads: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actualErr := Rationalize(&mockIsSet{}, tc.config)
+
+			if assert.NoError(t, actualErr) {
+				assert.Equal(t, tc.expectedParallelCompositeUploads, tc.config.Write.ExperimentalParallelCompositeUploads)
+			}
+		})
+	}
+}
+
 func TestRationalizeMetricsConfig(t *testing.T) {
 	t.Parallel()
 	testCases := []struct {
@@ -86,3 +86,56 @@ func (p *ResolvedPath) UnmarshalText(text []byte) error {
 	*p = ResolvedPath(path)
 	return nil
 }
+
+// ObjectDefaults holds the attributes given to new objects whose names match
+// Glob, in which ** matches any number of directories.
+type ObjectDefaults struct {
+	Glob               string            `yaml:"glob"`
+	StorageClass       string            `yaml:"storage-class"`
+	CacheControl       string            `yaml:"cache-control"`
+	ContentDisposition string            `yaml:"content-disposition"`
+	ContentLanguage    string            `yaml:"content-language"`
+	ContentType        string            `yaml:"content-type"`
+	Metadata           map[string]string `yaml:"metadata"`
+}
+
+// UnmarshalText parses the flag form of ObjectDefaults, in which the fields
+// are given as <key>=<value> separated by semicolons, using the keys of the
+// config file and metadata.<key> for metadata.
+func (d *ObjectDefaults) UnmarshalText(text []byte) error {
+	var parsed ObjectDefaults
+	for _, field := range strings.Split(string(text), ";") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return fmt.Errorf("invalid object defaults field %q: expected <key>=<value>", field)
+		}
+
+		key = strings.TrimSpace(key)
+		switch key {
+		case "glob":
+			parsed.Glob = value
+		case "storage-class":
+			parsed.StorageClass = value
+		case "cache-control":
+			parsed.CacheControl = value
+		case "content-disposition":
+			parsed.ContentDisposition = value
+		case "content-language":
+			parsed.ContentLanguage = value
+		case "content-type":
+			parsed.ContentType = value
+		default:
+			name, isMetadata := strings.CutPrefix(key, "metadata.")
+			if !isMetadata || name == "" {
+				return fmt.Errorf("invalid object defaults field %q: unknown key %q", field, key)
+			}
+			if parsed.Metadata == nil {
+				parsed.Metadata = make(map[string]string)
+			}
+			parsed.Metadata[name] = value
+		}
+	}
+
+	*d = parsed
+	return nil
+}
@@ -19,6 +19,9 @@ import (
 	"fmt"
 
 	"math"
+	"path"
+	"slices"
+	"strings"
 )
 
 const (
@@ -27,6 +30,8 @@ const (
 	ParallelDownloadsPerFileInvalidValueError = "the value of parallel-downloads-per-file for file-cache can't be less than 1"
 	DownloadChunkSizeMBInvalidValueError      = "the value of download-chunk-size-mb for file-cache can't be less than 1"
 	MaxParallelDownloadsCantBeZeroError       = "the value of max-parallel-downloads for file-cache must not be 0 when enable-parallel-downloads is true"
+	SparseChunkSizeMBInvalidValueError        = "the value of sparse-chunk-size-mb for file-cache should be between 1 and max-size-mb"
+	SparseNeighborChunksInvalidValueError     = "the value of sparse-neighbor-chunks for file-cache can't be negative"
 )
 
 func isValidLogRotateConfig(config *LogRotateLoggingConfig) error {
@@ -76,6 +81,14 @@ func isValidFileCacheConfig(config *FileCacheConfig) error {
 	if config.DownloadChunkSizeMb < 1 {
 		return errors.New(DownloadChunkSizeMBInvalidValueError)
 	}
+	if config.ExperimentalEnableSparseFile {
+		if config.SparseChunkSizeMb < 1 || (config.MaxSizeMb != -1 && config.SparseChunkSizeMb > config.MaxSizeMb) {
+			return errors.New(SparseChunkSizeMBInvalidValueError)
+		}
+		if config.SparseNeighborChunks < 0 {
+			return errors.New(SparseNeighborChunksInvalidValueError)
+		}
+	}
 
 	return nil
 }
@@ -164,6 +177,128 @@ func isValidWriteStreamingConfig(wc *WriteConfig) error {
 	if !(wc.GlobalMaxBlocks == -1 || wc.GlobalMaxBlocks >= 2) {
 		return fmt.Errorf("invalid value of write-global-max-blocks: %d; should be >=2 or -1 (for infinite)", wc.GlobalMaxBlocks)
 	}
+	if wc.ReorderWindowBlocks < 0 {
+		return fmt.Errorf("invalid value of write-reorder-window-blocks: %d; can't be negative", wc.ReorderWindowBlocks)
+	}
+	return nil
+}
+
+// Write-back journals the contents of temp files, which files written with
+// streaming writes don't have.
+func isValidWriteBackConfig(wc *WriteConfig) error {
+	if wc.ExperimentalWriteBack && wc.ExperimentalEnableStreamingWrites {
+		return fmt.Errorf("experimental-write-back can't be used with experimental-enable-streaming-writes")
+	}
+	return nil
+}
+
+func isValidReadaheadConfig(rc *ReadConfig) error {
+	if !rc.ExperimentalEnableReadahead {
+		return nil
+	}
+
+	if rc.ReadaheadBlockSizeMb <= 0 {
+		return fmt.Errorf("invalid value of readahead-block-size-mb: %d; can't be less than 1", rc.ReadaheadBlockSizeMb)
+	}
+	if rc.ReadaheadMaxBlocks <= 0 {
+		return fmt.Errorf("invalid value of readahead-max-blocks: %d; can't be less than 1", rc.ReadaheadMaxBlocks)
+	}
+	if rc.ReadaheadStreams <= 0 {
+		return fmt.Errorf("invalid value of readahead-streams: %d; can't be less than 1", rc.ReadaheadStreams)
+	}
+	if !(rc.ReadaheadGlobalMaxBlocks == -1 || rc.ReadaheadGlobalMaxBlocks >= 1) {
+		return fmt.Errorf("invalid value of readahead-global-max-blocks: %d; should be >=1 or -1 (for infinite)", rc.ReadaheadGlobalMaxBlocks)
+	}
+	return nil
+}
+
+func isValidMemoryCacheConfig(rc *ReadConfig) error {
+	if rc.MemoryCacheMaxSizeMb < 0 {
+		return fmt.Errorf("invalid value of memory-cache-max-size-mb: %d; can't be negative", rc.MemoryCacheMaxSizeMb)
+	}
+	if !IsMemoryCacheEnabled(rc) {
+		return nil
+	}
+
+	if rc.MemoryCacheBlockSizeMb <= 0 || rc.MemoryCacheBlockSizeMb > rc.MemoryCacheMaxSizeMb {
+		return fmt.Errorf("invalid value of memory-cache-block-size-mb: %d; should be between 1 and memory-cache-max-size-mb", rc.MemoryCacheBlockSizeMb)
+	}
+	return nil
+}
+
+func isValidBackgroundSyncConfig(wc *WriteConfig) error {
+	if wc.ExperimentalBackgroundSyncAge < 0 {
+		return fmt.Errorf("invalid value of experimental-background-sync-age: %v; can't be negative", wc.ExperimentalBackgroundSyncAge)
+	}
+	if wc.ExperimentalBackgroundSyncDirtyBytes < 0 {
+		return fmt.Errorf("invalid value of experimental-background-sync-dirty-bytes: %d; can't be negative", wc.ExperimentalBackgroundSyncDirtyBytes)
+	}
+	return nil
+}
+
+func isValidWriteConflictPolicy(wc *WriteConfig) error {
+	switch wc.ExperimentalConflictPolicy {
+	// An unset policy fails the sync, as with "fail".
+	case "", WriteConflictPolicyFail, WriteConflictPolicyLastWriterWins, WriteConflictPolicyConflictCopy:
+		return nil
+	default:
+		return fmt.Errorf("unsupported experimental-write-conflict-policy: %q; supported values: fail, last-writer-wins, conflict-copy", wc.ExperimentalConflictPolicy)
+	}
+}
+
+func isValidObjectDefaults(wc *WriteConfig) error {
+	for _, d := range wc.ObjectDefaults {
+		if d.Glob == "" {
+			return fmt.Errorf("object-defaults entry without a glob")
+		}
+		for _, component := range strings.Split(d.Glob, "/") {
+			if _, err := path.Match(component, ""); err != nil {
+				return fmt.Errorf("invalid object-defaults glob %q: %w", d.Glob, err)
+			}
+		}
+	}
+
+	if _, err := ParseMimeTypes(wc.MimeTypes); err != nil {
+		return fmt.Errorf("invalid mime-types: %w", err)
+	}
+
+	return nil
+}
+
+// The prefixes of the sources that customer-supplied keys are read from.
+var customerKeySourcePrefixes = []string{"file:", "env:", "secretmanager:"}
+
+func isValidEncryptionConfig(c *EncryptionConfig) error {
+	if c.ExperimentalKmsKeyName != "" && c.ExperimentalMasterKeyFile != "" {
+		return fmt.Errorf("experimental-encryption-kms-key-name and experimental-encryption-master-key-file can't both be set")
+	}
+
+	customerKeys, err := ParseBucketValues(c.CustomerKeys)
+	if err != nil {
+		return fmt.Errorf("invalid encryption-customer-keys: %w", err)
+	}
+	for bucket, source := range customerKeys {
+		if !slices.ContainsFunc(customerKeySourcePrefixes, func(p string) bool { return strings.HasPrefix(source, p) }) {
+			return fmt.Errorf("invalid encryption-customer-keys source %q for bucket %q; should begin with one of %v", source, bucket, customerKeySourcePrefixes)
+		}
+	}
+
+	kmsKeyNames, err := ParseBucketValues(c.KmsKeyNames)
+	if err != nil {
+		return fmt.Errorf("invalid encryption-kms-key-names: %w", err)
+	}
+
+	// GCS refuses to encrypt an object with both kinds of key.
+	for _, buckets := range []map[string]string{customerKeys, kmsKeyNames} {
+		for bucket := range buckets {
+			_, hasCustomerKey := BucketValue(customerKeys, bucket)
+			_, hasKMSKey := BucketValue(kmsKeyNames, bucket)
+			if hasCustomerKey && hasKMSKey {
+				return fmt.Errorf("bucket %q has both a customer-supplied key and a Cloud KMS key", bucket)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -200,6 +335,41 @@ func isValidChunkTransferTimeoutForRetriesConfig(chunkTransferTimeoutSecs int64)
 	return nil
 }
 
+func isValidQuotaConfig(c *QuotaConfig) error {
+	if c.LimitBytes < 0 {
+		return fmt.Errorf("the value of limit-bytes for quota can't be less than 0")
+	}
+	if c.LimitObjects < 0 {
+		return fmt.Errorf("the value of limit-objects for quota can't be less than 0")
+	}
+	if !IsQuotaEnabled(c) {
+		return nil
+	}
+
+	if c.UsageScanInterval <= 0 {
+		return fmt.Errorf("the value of usage-scan-interval for quota must be positive")
+	}
+	switch c.ExceededError {
+	case QuotaExceededErrorENOSPC, QuotaExceededErrorEDQUOT:
+		return nil
+	default:
+		return fmt.Errorf("unsupported exceeded-error: %q; supported values: enospc, edquot", c.ExceededError)
+	}
+}
+
+func isValidListConfig(c *ListConfig) error {
+	if c.BucketsTtl < 0 {
+		return fmt.Errorf("the value of buckets-ttl for list can't be negative")
+	}
+	for _, pattern := range append(append([]string{}, c.BucketAllow...), c.BucketDeny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid bucket pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
 // ValidateConfig returns a non-nil error if the config is invalid.
 func ValidateConfig(v isSet, config *Config) error {
 	var err error
@@ -236,10 +406,42 @@ func ValidateConfig(v isSet, config *Config) error {
 		return fmt.Errorf("error parsing metadata-cache config: %w", err)
 	}
 
+	if err = isValidReadaheadConfig(&config.Read); err != nil {
+		return fmt.Errorf("error parsing read config: %w", err)
+	}
+
+	if err = isValidMemoryCacheConfig(&config.Read); err != nil {
+		return fmt.Errorf("error parsing read config: %w", err)
+	}
+
 	if err = isValidWriteStreamingConfig(&config.Write); err != nil {
 		return fmt.Errorf("error parsing write config: %w", err)
 	}
 
+	if err = isValidWriteBackConfig(&config.Write); err != nil {
+		return fmt.Errorf("error parsing write config: %w", err)
+	}
+
+	if err = isValidBackgroundSyncConfig(&config.Write); err != nil {
+		return fmt.Errorf("error parsing write config: %w", err)
+	}
+
+	if err = isValidWriteConflictPolicy(&config.Write); err != nil {
+		return fmt.Errorf("error parsing write config: %w", err)
+	}
+
+	if err = isValidObjectDefaults(&config.Write); err != nil {
+		return fmt.Errorf("error parsing write config: %w", err)
+	}
+
+	if err = isValidEncryptionConfig(&config.Encryption); err != nil {
+		return fmt.Errorf("error parsing encryption config: %w", err)
+	}
+
+	if _, err = ParseCompressionRules(config.Compression.ExperimentalRules); err != nil {
+		return fmt.Errorf("error parsing compression config: %w", err)
+	}
+
 	if err = isValidReadStallGcsRetriesConfig(&config.GcsRetries.ReadStall); err != nil {
 		return fmt.Errorf("error parsing read-stall-gcs-retries config: %w", err)
 	}
@@ -256,5 +458,13 @@ func ValidateConfig(v isSet, config *Config) error {
 		return fmt.Errorf("error parsing parallel download config: %w", err)
 	}
 
+	if err = isValidQuotaConfig(&config.Quota); err != nil {
+		return fmt.Errorf("error parsing quota config: %w", err)
+	}
+
+	if err = isValidListConfig(&config.List); err != nil {
+		return fmt.Errorf("error parsing list config: %w", err)
+	}
+
 	return nil
 }
@@ -500,6 +500,14 @@ func Test_isValidWriteStreamingConfig_ErrorScenarios(t *testing.T) {
 			GlobalMaxBlocks:                   20,
 			MaxBlocksPerFile:                  1,
 		}},
+		{"negative_reorder_window_blocks", WriteConfig{
+			BlockSizeMb:                       10,
+			CreateEmptyFile:                   false,
+			ExperimentalEnableStreamingWrites: true,
+			GlobalMaxBlocks:                   20,
+			MaxBlocksPerFile:                  10,
+			ReorderWindowBlocks:               -1,
+		}},
 	}
 
 	for _, tc := range testCases {
@@ -558,6 +566,30 @@ func Test_isValidWriteStreamingConfig_SuccessScenarios(t *testing.T) {
 	}
 }
 
+func Test_isValidWriteBackConfig(t *testing.T) {
+	var testCases = []struct {
+		testName    string
+		writeConfig WriteConfig
+		wantErr     bool
+	}{
+		{"write_back", WriteConfig{ExperimentalWriteBack: true}, false},
+		{"streaming_writes", WriteConfig{ExperimentalEnableStreamingWrites: true}, false},
+		{"write_back_with_streaming_writes", WriteConfig{ExperimentalWriteBack: true, ExperimentalEnableStreamingWrites: true}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			err := isValidWriteBackConfig(&tc.writeConfig)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
 func validConfig(t *testing.T) Config {
 	return Config{
 		Logging:   LoggingConfig{LogRotate: validLogRotateConfig()},
@@ -569,6 +601,9 @@ func validConfig(t *testing.T) Config {
 		MetadataCache: MetadataCacheConfig{
 			ExperimentalMetadataPrefetchOnMount: "disabled",
 		},
+		Write: WriteConfig{
+			ExperimentalConflictPolicy: "fail",
+		},
 	}
 }
 
@@ -655,3 +690,583 @@ func TestValidateMetrics(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateQuota(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name        string
+		quotaConfig QuotaConfig
+		wantErr     bool
+	}{
+		{
+			name:        "disabled",
+			quotaConfig: QuotaConfig{},
+			wantErr:     false,
+		},
+		{
+			name: "bytes_limit",
+			quotaConfig: QuotaConfig{
+				LimitBytes:        1 << 30,
+				ExceededError:     "enospc",
+				UsageScanInterval: 5 * time.Minute,
+			},
+			wantErr: false,
+		},
+		{
+			name: "objects_limit_edquot",
+			quotaConfig: QuotaConfig{
+				LimitObjects:      1000,
+				ExceededError:     "edquot",
+				UsageScanInterval: time.Minute,
+			},
+			wantErr: false,
+		},
+		{
+			name: "neg_limit_bytes",
+			quotaConfig: QuotaConfig{
+				LimitBytes: -1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "neg_limit_objects",
+			quotaConfig: QuotaConfig{
+				LimitObjects: -1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsupported_exceeded_error",
+			quotaConfig: QuotaConfig{
+				LimitBytes:        1 << 30,
+				ExceededError:     "eio",
+				UsageScanInterval: 5 * time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "zero_usage_scan_interval",
+			quotaConfig: QuotaConfig{
+				LimitBytes:    1 << 30,
+				ExceededError: "enospc",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.Quota = tc.quotaConfig
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateList(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name       string
+		listConfig ListConfig
+		wantErr    bool
+	}{
+		{
+			name:       "default",
+			listConfig: ListConfig{BucketsTtl: time.Minute},
+			wantErr:    false,
+		},
+		{
+			name: "valid_patterns",
+			listConfig: ListConfig{
+				BucketsProject: "my-project",
+				BucketAllow:    []string{"team-*", "shared"},
+				BucketDeny:     []string{"*-tmp"},
+				BucketsTtl:     time.Minute,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid_pattern",
+			listConfig: ListConfig{
+				BucketDeny: []string{"team-["},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative_ttl",
+			listConfig: ListConfig{
+				BucketsTtl: -time.Second,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.List = tc.listConfig
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateBackgroundSync(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name        string
+		writeConfig WriteConfig
+		wantErr     bool
+	}{
+		{
+			name:        "disabled",
+			writeConfig: WriteConfig{},
+			wantErr:     false,
+		},
+		{
+			name: "age_and_dirty_bytes",
+			writeConfig: WriteConfig{
+				ExperimentalBackgroundSyncAge:        10 * time.Minute,
+				ExperimentalBackgroundSyncDirtyBytes: 1 << 30,
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative_age",
+			writeConfig: WriteConfig{
+				ExperimentalBackgroundSyncAge: -time.Second,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative_dirty_bytes",
+			writeConfig: WriteConfig{
+				ExperimentalBackgroundSyncDirtyBytes: -1,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.Write.ExperimentalBackgroundSyncAge = tc.writeConfig.ExperimentalBackgroundSyncAge
+			c.Write.ExperimentalBackgroundSyncDirtyBytes = tc.writeConfig.ExperimentalBackgroundSyncDirtyBytes
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateReadahead(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name       string
+		readConfig ReadConfig
+		wantErr    bool
+	}{
+		{
+			name:       "disabled",
+			readConfig: ReadConfig{},
+			wantErr:    false,
+		},
+		{
+			name: "enabled",
+			readConfig: ReadConfig{
+				ExperimentalEnableReadahead: true,
+				ReadaheadBlockSizeMb:        8,
+				ReadaheadGlobalMaxBlocks:    64,
+				ReadaheadMaxBlocks:          16,
+				ReadaheadStreams:            4,
+			},
+			wantErr: false,
+		},
+		{
+			name: "unlimited_global_max_blocks",
+			readConfig: ReadConfig{
+				ExperimentalEnableReadahead: true,
+				ReadaheadBlockSizeMb:        8,
+				ReadaheadGlobalMaxBlocks:    -1,
+				ReadaheadMaxBlocks:          16,
+				ReadaheadStreams:            4,
+			},
+			wantErr: false,
+		},
+		{
+			name: "zero_global_max_blocks",
+			readConfig: ReadConfig{
+				ExperimentalEnableReadahead: true,
+				ReadaheadBlockSizeMb:        8,
+				ReadaheadMaxBlocks:          16,
+				ReadaheadStreams:            4,
+			},
+			wantErr: true,
+		},
+		{
+			name: "zero_block_size",
+			readConfig: ReadConfig{
+				ExperimentalEnableReadahead: true,
+				ReadaheadMaxBlocks:          16,
+				ReadaheadStreams:            4,
+			},
+			wantErr: true,
+		},
+		{
+			name: "zero_max_blocks",
+			readConfig: ReadConfig{
+				ExperimentalEnableReadahead: true,
+				ReadaheadBlockSizeMb:        8,
+				ReadaheadStreams:            4,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative_streams",
+			readConfig: ReadConfig{
+				ExperimentalEnableReadahead: true,
+				ReadaheadBlockSizeMb:        8,
+				ReadaheadMaxBlocks:          16,
+				ReadaheadStreams:            -1,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.Read = tc.readConfig
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateMemoryCache(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name       string
+		readConfig ReadConfig
+		wantErr    bool
+	}{
+		{
+			name:       "disabled",
+			readConfig: ReadConfig{MemoryCacheBlockSizeMb: 1},
+			wantErr:    false,
+		},
+		{
+			name:       "enabled",
+			readConfig: ReadConfig{MemoryCacheMaxSizeMb: 1024, MemoryCacheBlockSizeMb: 1},
+			wantErr:    false,
+		},
+		{
+			name:       "negative_max_size",
+			readConfig: ReadConfig{MemoryCacheMaxSizeMb: -1, MemoryCacheBlockSizeMb: 1},
+			wantErr:    true,
+		},
+		{
+			name:       "zero_block_size",
+			readConfig: ReadConfig{MemoryCacheMaxSizeMb: 1024},
+			wantErr:    true,
+		},
+		{
+			name:       "block_larger_than_cache",
+			readConfig: ReadConfig{MemoryCacheMaxSizeMb: 4, MemoryCacheBlockSizeMb: 8},
+			wantErr:    true,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.Read = tc.readConfig
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateSparseFileCache(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name        string
+		chunkSizeMb int64
+		maxSizeMb   int64
+		neighbors   int64
+		wantErr     bool
+	}{
+		{
+			name:        "valid",
+			chunkSizeMb: 1,
+			maxSizeMb:   -1,
+			neighbors:   2,
+			wantErr:     false,
+		},
+		{
+			name:        "zero_chunk_size",
+			chunkSizeMb: 0,
+			maxSizeMb:   -1,
+			wantErr:     true,
+		},
+		{
+			name:        "chunk_larger_than_cache",
+			chunkSizeMb: 8,
+			maxSizeMb:   4,
+			wantErr:     true,
+		},
+		{
+			name:        "negative_neighbors",
+			chunkSizeMb: 1,
+			maxSizeMb:   -1,
+			neighbors:   -1,
+			wantErr:     true,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.FileCache.ExperimentalEnableSparseFile = true
+			c.FileCache.SparseChunkSizeMb = tc.chunkSizeMb
+			c.FileCache.MaxSizeMb = tc.maxSizeMb
+			c.FileCache.SparseNeighborChunks = tc.neighbors
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateWriteConflictPolicy(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		policy  string
+		wantErr bool
+	}{
+		{policy: "fail", wantErr: false},
+		{policy: "last-writer-wins", wantErr: false},
+		{policy: "conflict-copy", wantErr: false},
+		{policy: "", wantErr: false},
+		{policy: "merge", wantErr: true},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.policy, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.Write.ExperimentalConflictPolicy = tc.policy
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateEncryption(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name             string
+		encryptionConfig EncryptionConfig
+		wantErr          bool
+	}{
+		{
+			name:             "disabled",
+			encryptionConfig: EncryptionConfig{},
+			wantErr:          false,
+		},
+		{
+			name:             "kms_key",
+			encryptionConfig: EncryptionConfig{ExperimentalKmsKeyName: "projects/p/locations/l/keyRings/r/cryptoKeys/k"},
+			wantErr:          false,
+		},
+		{
+			name:             "master_key_file",
+			encryptionConfig: EncryptionConfig{ExperimentalMasterKeyFile: "/tmp/master.key"},
+			wantErr:          false,
+		},
+		{
+			name: "both",
+			encryptionConfig: EncryptionConfig{
+				ExperimentalKmsKeyName:    "projects/p/locations/l/keyRings/r/cryptoKeys/k",
+				ExperimentalMasterKeyFile: "/tmp/master.key",
+			},
+			wantErr: true,
+		},
+		{
+			name: "customer_keys",
+			encryptionConfig: EncryptionConfig{
+				CustomerKeys: []string{
+					"a=file:/tmp/a.key",
+					"b=env:B_KEY",
+					"*=secretmanager:projects/p/secrets/s/versions/1",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:             "customer_key_without_bucket",
+			encryptionConfig: EncryptionConfig{CustomerKeys: []string{"file:/tmp/a.key"}},
+			wantErr:          true,
+		},
+		{
+			name:             "customer_key_with_unknown_source",
+			encryptionConfig: EncryptionConfig{CustomerKeys: []string{"a=/tmp/a.key"}},
+			wantErr:          true,
+		},
+		{
+			name:             "customer_key_listed_twice",
+			encryptionConfig: EncryptionConfig{CustomerKeys: []string{"a=env:A_KEY", "a=env:OTHER_KEY"}},
+			wantErr:          true,
+		},
+		{
+			name: "kms_key_names",
+			encryptionConfig: EncryptionConfig{
+				CustomerKeys: []string{"a=env:A_KEY"},
+				KmsKeyNames:  []string{"b=projects/p/locations/l/keyRings/r/cryptoKeys/k"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "customer_key_and_kms_key_for_bucket",
+			encryptionConfig: EncryptionConfig{
+				CustomerKeys: []string{"a=env:A_KEY"},
+				KmsKeyNames:  []string{"a=projects/p/locations/l/keyRings/r/cryptoKeys/k"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "customer_key_for_all_buckets_and_kms_key_for_bucket",
+			encryptionConfig: EncryptionConfig{
+				CustomerKeys: []string{"*=env:KEY"},
+				KmsKeyNames:  []string{"b=projects/p/locations/l/keyRings/r/cryptoKeys/k"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.Encryption = tc.encryptionConfig
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateCompression(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		rules   []string
+		wantErr bool
+	}{
+		{name: "disabled", rules: nil, wantErr: false},
+		{name: "gzip_and_zstd", rules: []string{"*.csv=gzip", "logs/*=zstd"}, wantErr: false},
+		{name: "unknown_codec", rules: []string{"*.csv=lz4"}, wantErr: true},
+		{name: "bad_glob", rules: []string{"[=gzip"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.Compression.ExperimentalRules = tc.rules
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateObjectDefaults(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name      string
+		defaults  []ObjectDefaults
+		mimeTypes []string
+		wantErr   bool
+	}{
+		{name: "disabled", wantErr: false},
+		{name: "valid", defaults: []ObjectDefaults{{Glob: "logs/**", StorageClass: "NEARLINE"}}, mimeTypes: []string{".md=text/markdown"}, wantErr: false},
+		{name: "missing_glob", defaults: []ObjectDefaults{{StorageClass: "NEARLINE"}}, wantErr: true},
+		{name: "bad_glob", defaults: []ObjectDefaults{{Glob: "logs/[", StorageClass: "NEARLINE"}}, wantErr: true},
+		{name: "bad_mime_types", mimeTypes: []string{".md"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := validConfig(t)
+			c.Write.ObjectDefaults = tc.defaults
+			c.Write.MimeTypes = tc.mimeTypes
+
+			err := ValidateConfig(&mockIsSet{}, &c)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
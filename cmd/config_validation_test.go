@@ -63,6 +63,7 @@ func defaultFileCacheConfig(t *testing.T) cfg.FileCacheConfig {
 		ParallelDownloadsPerFile: 16,
 		WriteBufferSize:          4 * 1024 * 1024,
 		EnableODirect:            false,
+		SparseChunkSizeMb:        1,
 	}
 }
 
@@ -191,9 +192,13 @@ func TestValidateConfigFile_WriteConfig(t *testing.T) {
 				Write: cfg.WriteConfig{
 					CreateEmptyFile:                   false,
 					BlockSizeMb:                       64,
+					ExperimentalConflictPolicy:        "fail",
 					ExperimentalEnableStreamingWrites: false,
 					GlobalMaxBlocks:                   math.MaxInt64,
-					MaxBlocksPerFile:                  math.MaxInt64},
+					MaxBlocksPerFile:                  math.MaxInt64,
+					MimeTypes:                         []string{},
+					ObjectDefaults:                    []cfg.ObjectDefaults{},
+					ReorderWindowBlocks:               4},
 			},
 		},
 		{
@@ -203,9 +208,13 @@ func TestValidateConfigFile_WriteConfig(t *testing.T) {
 				Write: cfg.WriteConfig{
 					CreateEmptyFile:                   false, // changed due to enabled streaming writes.
 					BlockSizeMb:                       10,
+					ExperimentalConflictPolicy:        "fail",
 					ExperimentalEnableStreamingWrites: true,
 					GlobalMaxBlocks:                   20,
 					MaxBlocksPerFile:                  2,
+					MimeTypes:                         []string{},
+					ObjectDefaults:                    []cfg.ObjectDefaults{},
+					ReorderWindowBlocks:               4,
 				},
 			},
 		},
@@ -361,6 +370,7 @@ func TestValidateConfigFile_FileCacheConfigSuccessful(t *testing.T) {
 					ParallelDownloadsPerFile: 10,
 					WriteBufferSize:          8192,
 					EnableODirect:            true,
+					SparseChunkSizeMb:        1,
 				},
 			},
 		},
@@ -584,14 +594,24 @@ func TestValidateConfigFile_ListConfigSuccessful(t *testing.T) {
 			name:       "empty_config_file",
 			configFile: "testdata/empty_file.yaml",
 			expectedConfig: &cfg.Config{
-				List: cfg.ListConfig{EnableEmptyManagedFolders: false},
+				List: cfg.ListConfig{
+					BucketAllow:               []string{},
+					BucketDeny:                []string{},
+					BucketsTtl:                time.Minute,
+					EnableEmptyManagedFolders: false,
+				},
 			},
 		},
 		{
 			name:       "valid_config_file",
 			configFile: "testdata/valid_config.yaml",
 			expectedConfig: &cfg.Config{
-				List: cfg.ListConfig{EnableEmptyManagedFolders: true},
+				List: cfg.ListConfig{
+					BucketAllow:               []string{},
+					BucketDeny:                []string{},
+					BucketsTtl:                time.Minute,
+					EnableEmptyManagedFolders: true,
+				},
 			},
 		},
 	}
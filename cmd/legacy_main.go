@@ -44,6 +44,7 @@ import (
 	"github.com/jacobsa/fuse"
 	"github.com/kardianos/osext"
 	"golang.org/x/net/context"
+	"google.golang.org/api/option"
 )
 
 const (
@@ -135,11 +136,37 @@ func createStorageHandle(newConfig *cfg.Config, userAgent string) (storageHandle
 		EnableHNS:                  newConfig.EnableHns,
 		ReadStallRetryConfig:       newConfig.GcsRetries.ReadStall,
 	}
+	storageClientConfig.CustomerKeys, storageClientConfig.KMSKeyNames, err = objectEncryptionKeys(newConfig)
+	if err != nil {
+		err = fmt.Errorf("objectEncryptionKeys: %w", err)
+		return
+	}
 	logger.Infof("UserAgent = %s\n", storageClientConfig.UserAgent)
 	storageHandle, err = storage.NewStorageHandle(context.Background(), storageClientConfig)
 	return
 }
 
+// objectEncryptionKeys reads the customer-supplied keys, and parses the names
+// of the Cloud KMS keys, that objects are encrypted with in GCS.
+func objectEncryptionKeys(newConfig *cfg.Config) (customerKeys map[string][]byte, kmsKeyNames map[string]string, err error) {
+	sources, err := cfg.ParseBucketValues(newConfig.Encryption.CustomerKeys)
+	if err != nil {
+		return
+	}
+
+	var opts []option.ClientOption
+	if newConfig.GcsAuth.KeyFile != "" {
+		opts = append(opts, option.WithCredentialsFile(string(newConfig.GcsAuth.KeyFile)))
+	}
+	customerKeys, err = storageutil.ResolveCustomerKeys(context.Background(), sources, opts...)
+	if err != nil {
+		return
+	}
+
+	kmsKeyNames, err = cfg.ParseBucketValues(newConfig.Encryption.KmsKeyNames)
+	return
+}
+
 ////////////////////////////////////////////////////////////////////////
 // main logic
 ////////////////////////////////////////////////////////////////////////
@@ -32,6 +32,7 @@ import (
 	"github.com/jacobsa/fuse"
 	"github.com/jacobsa/fuse/fsutil"
 	"github.com/jacobsa/timeutil"
+	"google.golang.org/api/option"
 )
 
 // Mount the file system based on the supplied arguments, returning a
@@ -86,6 +87,24 @@ be interacting with the file system.`)
 		gid = uint32(newConfig.FileSystem.Gid)
 	}
 
+	keyWrapper, err := newKeyWrapper(ctx, newConfig)
+	if err != nil {
+		err = fmt.Errorf("newKeyWrapper: %w", err)
+		return
+	}
+
+	compressionRules, err := cfg.ParseCompressionRules(newConfig.Compression.ExperimentalRules)
+	if err != nil {
+		err = fmt.Errorf("ParseCompressionRules: %w", err)
+		return
+	}
+
+	mimeTypes, err := cfg.ParseMimeTypes(newConfig.Write.MimeTypes)
+	if err != nil {
+		err = fmt.Errorf("ParseMimeTypes: %w", err)
+		return
+	}
+
 	bucketCfg := gcsx.BucketConfig{
 		BillingProject:                     newConfig.GcsConnection.BillingProject,
 		OnlyDir:                            newConfig.OnlyDir,
@@ -97,6 +116,14 @@ be interacting with the file system.`)
 		AppendThreshold:                    1 << 21, // 2 MiB, a total guess.
 		ChunkTransferTimeoutSecs:           newConfig.GcsRetries.ChunkTransferTimeoutSecs,
 		TmpObjectPrefix:                    ".gcsfuse_tmp/",
+		ListBucketsProject:                 newConfig.List.BucketsProject,
+		BucketAllow:                        newConfig.List.BucketAllow,
+		BucketDeny:                         newConfig.List.BucketDeny,
+		KeyWrapper:                         keyWrapper,
+		CompressionRules:                   compressionRules,
+		ObjectDefaults:                     newConfig.Write.ObjectDefaults,
+		MimeTypes:                          mimeTypes,
+		SniffContentType:                   newConfig.Write.SniffContentType,
 	}
 	bm := gcsx.NewBucketManager(bucketCfg, storageHandle)
 
@@ -147,6 +174,25 @@ be interacting with the file system.`)
 	return
 }
 
+// newKeyWrapper returns the key wrapper for client-side encryption, or nil if
+// it isn't enabled.
+func newKeyWrapper(ctx context.Context, newConfig *cfg.Config) (gcsx.KeyWrapper, error) {
+	switch {
+	case newConfig.Encryption.ExperimentalMasterKeyFile != "":
+		return gcsx.NewKeyFileWrapper(string(newConfig.Encryption.ExperimentalMasterKeyFile))
+
+	case newConfig.Encryption.ExperimentalKmsKeyName != "":
+		var opts []option.ClientOption
+		if newConfig.GcsAuth.KeyFile != "" {
+			opts = append(opts, option.WithCredentialsFile(string(newConfig.GcsAuth.KeyFile)))
+		}
+		return gcsx.NewKMSKeyWrapper(ctx, newConfig.Encryption.ExperimentalKmsKeyName, opts...)
+
+	default:
+		return nil, nil
+	}
+}
+
 func getFuseMountConfig(fsName string, newConfig *cfg.Config) *fuse.MountConfig {
 	// Handle the repeated "-o" flag.
 	parsedOptions := make(map[string]string)
@@ -319,6 +319,7 @@ func TestArgsParsing_FileCacheFlags(t *testing.T) {
 					ParallelDownloadsPerFile: 2,
 					WriteBufferSize:          4 * 1024 * 1024,
 					EnableODirect:            false,
+					SparseChunkSizeMb:        1,
 				},
 			},
 		},
@@ -336,6 +337,7 @@ func TestArgsParsing_FileCacheFlags(t *testing.T) {
 					ParallelDownloadsPerFile: 16,
 					WriteBufferSize:          4 * 1024 * 1024,
 					EnableODirect:            false,
+					SparseChunkSizeMb:        1,
 				},
 			},
 		},
@@ -771,14 +773,24 @@ func TestArgsParsing_ListFlags(t *testing.T) {
 			name: "normal",
 			args: []string{"gcsfuse", "--enable-empty-managed-folders", "abc", "pqr"},
 			expectedConfig: &cfg.Config{
-				List: cfg.ListConfig{EnableEmptyManagedFolders: true},
+				List: cfg.ListConfig{
+					BucketAllow:               []string{},
+					BucketDeny:                []string{},
+					BucketsTtl:                time.Minute,
+					EnableEmptyManagedFolders: true,
+				},
 			},
 		},
 		{
 			name: "default",
 			args: []string{"gcsfuse", "abc", "pqr"},
 			expectedConfig: &cfg.Config{
-				List: cfg.ListConfig{EnableEmptyManagedFolders: false},
+				List: cfg.ListConfig{
+					BucketAllow:               []string{},
+					BucketDeny:                []string{},
+					BucketsTtl:                time.Minute,
+					EnableEmptyManagedFolders: false,
+				},
 			},
 		},
 	}
@@ -29,6 +29,7 @@ func (*noopMetrics) GCSRequestCount(_ context.Context, _ int64, _ []MetricAttr)
 func (*noopMetrics) GCSRequestLatency(_ context.Context, value float64, _ []MetricAttr) {}
 func (*noopMetrics) GCSReadCount(_ context.Context, _ int64, _ []MetricAttr)            {}
 func (*noopMetrics) GCSDownloadBytesCount(_ context.Context, _ int64, _ []MetricAttr)   {}
+func (*noopMetrics) GCSSyncCount(_ context.Context, _ int64, _ []MetricAttr)            {}
 
 func (*noopMetrics) OpsCount(_ context.Context, _ int64, _ []MetricAttr)         {}
 func (*noopMetrics) OpsLatency(_ context.Context, value float64, _ []MetricAttr) {}
@@ -37,3 +38,6 @@ func (*noopMetrics) OpsErrorCount(_ context.Context, _ int64, _ []MetricAttr)
 func (*noopMetrics) FileCacheReadCount(_ context.Context, _ int64, _ []MetricAttr)         {}
 func (*noopMetrics) FileCacheReadBytesCount(_ context.Context, _ int64, _ []MetricAttr)    {}
 func (*noopMetrics) FileCacheReadLatency(_ context.Context, value float64, _ []MetricAttr) {}
+
+func (*noopMetrics) MemoryCacheReadCount(_ context.Context, _ int64, _ []MetricAttr)      {}
+func (*noopMetrics) MemoryCacheReadBytesCount(_ context.Context, _ int64, _ []MetricAttr) {}
@@ -43,6 +43,10 @@ const (
 
 	// CacheHit annotates the read operation from file cache with true or false.
 	CacheHit = "cache_hit"
+
+	// SyncStrategy annotates how an object was written out when syncing a file:
+	// full/append/flatten.
+	SyncStrategy = "sync_strategy"
 )
 
 type ocMetrics struct {
@@ -53,6 +57,7 @@ type ocMetrics struct {
 	gcsRequestLatency     *stats.Float64Measure
 	gcsReadCount          *stats.Int64Measure
 	gcsDownloadBytesCount *stats.Int64Measure
+	gcsSyncCount          *stats.Int64Measure
 
 	// Ops measures
 	opsCount      *stats.Int64Measure
@@ -63,6 +68,10 @@ type ocMetrics struct {
 	fileCacheReadCount      *stats.Int64Measure
 	fileCacheReadBytesCount *stats.Int64Measure
 	fileCacheReadLatency    *stats.Float64Measure
+
+	// Memory cache measures
+	memoryCacheReadCount      *stats.Int64Measure
+	memoryCacheReadBytesCount *stats.Int64Measure
 }
 
 func attrsToTags(attrs []MetricAttr) []tag.Mutator {
@@ -93,6 +102,9 @@ func (o *ocMetrics) GCSReadCount(ctx context.Context, inc int64, attrs []MetricA
 func (o *ocMetrics) GCSDownloadBytesCount(ctx context.Context, inc int64, attrs []MetricAttr) {
 	recordOCMetric(ctx, o.gcsDownloadBytesCount, inc, attrs, "GCS download bytes count")
 }
+func (o *ocMetrics) GCSSyncCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	recordOCMetric(ctx, o.gcsSyncCount, inc, attrs, "GCS sync count")
+}
 
 func (o *ocMetrics) OpsCount(ctx context.Context, inc int64, attrs []MetricAttr) {
 	recordOCMetric(ctx, o.opsCount, inc, attrs, "file system op count")
@@ -114,6 +126,13 @@ func (o *ocMetrics) FileCacheReadLatency(ctx context.Context, value float64, att
 	recordOCLatencyMetric(ctx, o.fileCacheReadLatency, value, attrs, "file cache read latency")
 }
 
+func (o *ocMetrics) MemoryCacheReadCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	recordOCMetric(ctx, o.memoryCacheReadCount, inc, attrs, "memory cache read count")
+}
+func (o *ocMetrics) MemoryCacheReadBytesCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	recordOCMetric(ctx, o.memoryCacheReadBytesCount, inc, attrs, "memory cache read bytes count")
+}
+
 func recordOCMetric(ctx context.Context, m *stats.Int64Measure, inc int64, attrs []MetricAttr, metricStr string) {
 	if err := stats.RecordWithTags(
 		ctx,
@@ -141,6 +160,7 @@ func NewOCMetrics() (MetricHandle, error) {
 	gcsRequestLatency := stats.Float64("gcs/request_latency", "The latency of a GCS request.", stats.UnitMilliseconds)
 	gcsReadCount := stats.Int64("gcs/read_count", "Specifies the number of gcs reads made along with type - Sequential/Random", stats.UnitDimensionless)
 	gcsDownloadBytesCount := stats.Int64("gcs/download_bytes_count", "The cumulative number of bytes downloaded from GCS along with type - Sequential/Random", stats.UnitBytes)
+	gcsSyncCount := stats.Int64("gcs/sync_count", "Specifies the number of objects written out by syncing files along with the strategy - full/append/flatten", stats.UnitDimensionless)
 
 	opsCount := stats.Int64("fs/ops_count", "The number of ops processed by the file system.", stats.UnitDimensionless)
 	opsLatency := stats.Float64("fs/ops_latency", "The latency of a file system operation.", "us")
@@ -149,6 +169,9 @@ func NewOCMetrics() (MetricHandle, error) {
 	fileCacheReadCount := stats.Int64("file_cache/read_count", "Specifies the number of read requests made via file cache along with type - Sequential/Random and cache hit - true/false", stats.UnitDimensionless)
 	fileCacheReadBytesCount := stats.Int64("file_cache/read_bytes_count", "The cumulative number of bytes read from file cache along with read type - Sequential/Random", stats.UnitBytes)
 	fileCacheReadLatency := stats.Float64("file_cache/read_latency", "Latency of read from file cache along with cache hit - true/false", "us")
+
+	memoryCacheReadCount := stats.Int64("memory_cache/read_count", "Specifies the number of read requests made via memory cache along with cache hit - true/false", stats.UnitDimensionless)
+	memoryCacheReadBytesCount := stats.Int64("memory_cache/read_bytes_count", "The cumulative number of bytes read via memory cache along with cache hit - true/false", stats.UnitBytes)
 	// OpenCensus views (aggregated measures)
 	if err := view.Register(
 		&view.View{
@@ -192,6 +215,13 @@ func NewOCMetrics() (MetricHandle, error) {
 			Aggregation: view.Sum(),
 			TagKeys:     []tag.Key{tag.MustNewKey(ReadType)},
 		},
+		&view.View{
+			Name:        "gcs/sync_count",
+			Measure:     gcsSyncCount,
+			Description: "The cumulative number of objects written out by syncing files along with the strategy - full/append/flatten",
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tag.MustNewKey(SyncStrategy)},
+		},
 		&view.View{
 			Name:        "fs/ops_count",
 			Measure:     opsCount,
@@ -234,6 +264,21 @@ func NewOCMetrics() (MetricHandle, error) {
 			Description: "The cumulative distribution of the file cache read latencies along with cache hit - true/false",
 			Aggregation: ochttp.DefaultLatencyDistribution,
 			TagKeys:     []tag.Key{tag.MustNewKey(CacheHit)},
+		},
+		// Memory cache related metrics
+		&view.View{
+			Name:        "memory_cache/read_count",
+			Measure:     memoryCacheReadCount,
+			Description: "Specifies the number of read requests made via memory cache along with cache hit - true/false",
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tag.MustNewKey(CacheHit)},
+		},
+		&view.View{
+			Name:        "memory_cache/read_bytes_count",
+			Measure:     memoryCacheReadBytesCount,
+			Description: "The cumulative number of bytes read via memory cache along with cache hit - true/false",
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tag.MustNewKey(CacheHit)},
 		}); err != nil {
 		return nil, fmt.Errorf("failed to register OpenCensus metrics for GCS client library: %w", err)
 	}
@@ -244,6 +289,7 @@ func NewOCMetrics() (MetricHandle, error) {
 		gcsRequestLatency:     gcsRequestLatency,
 		gcsReadCount:          gcsReadCount,
 		gcsDownloadBytesCount: gcsDownloadBytesCount,
+		gcsSyncCount:          gcsSyncCount,
 
 		opsCount:      opsCount,
 		opsErrorCount: opsErrorCount,
@@ -252,5 +298,8 @@ func NewOCMetrics() (MetricHandle, error) {
 		fileCacheReadCount:      fileCacheReadCount,
 		fileCacheReadBytesCount: fileCacheReadBytesCount,
 		fileCacheReadLatency:    fileCacheReadLatency,
+
+		memoryCacheReadCount:      memoryCacheReadCount,
+		memoryCacheReadBytesCount: memoryCacheReadBytesCount,
 	}, nil
 }
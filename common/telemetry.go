@@ -52,6 +52,7 @@ type GCSMetricHandle interface {
 	GCSRequestLatency(ctx context.Context, value float64, attrs []MetricAttr)
 	GCSReadCount(ctx context.Context, inc int64, attrs []MetricAttr)
 	GCSDownloadBytesCount(ctx context.Context, inc int64, attrs []MetricAttr)
+	GCSSyncCount(ctx context.Context, inc int64, attrs []MetricAttr)
 }
 
 type OpsMetricHandle interface {
@@ -65,10 +66,16 @@ type FileCacheMetricHandle interface {
 	FileCacheReadBytesCount(ctx context.Context, inc int64, attrs []MetricAttr)
 	FileCacheReadLatency(ctx context.Context, value float64, attrs []MetricAttr)
 }
+
+type MemoryCacheMetricHandle interface {
+	MemoryCacheReadCount(ctx context.Context, inc int64, attrs []MetricAttr)
+	MemoryCacheReadBytesCount(ctx context.Context, inc int64, attrs []MetricAttr)
+}
 type MetricHandle interface {
 	GCSMetricHandle
 	OpsMetricHandle
 	FileCacheMetricHandle
+	MemoryCacheMetricHandle
 }
 
 func CaptureGCSReadMetrics(ctx context.Context, metricHandle MetricHandle, readType string, requestedDataSize int64) {
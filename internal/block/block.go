@@ -17,6 +17,7 @@ package block
 import (
 	"bytes"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"syscall"
 )
@@ -37,9 +38,15 @@ type Block interface {
 	// while uploading to GCS.
 	Reader() io.Reader
 
+	// Checksum returns the CRC32C of the data in the block, which is kept up
+	// to date as it is written.
+	Checksum() uint32
+
 	Deallocate() error
 }
 
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
 // TODO: check if we need offset or just storing end is sufficient. We might need
 // for handling ordered writes. It will be decided after ordered writes design.
 type offset struct {
@@ -50,6 +57,7 @@ type memoryBlock struct {
 	Block
 	buffer []byte
 	offset offset
+	crc    uint32
 }
 
 func (m *memoryBlock) Reuse() {
@@ -57,6 +65,7 @@ func (m *memoryBlock) Reuse() {
 
 	m.offset.end = 0
 	m.offset.start = 0
+	m.crc = 0
 }
 
 func (m *memoryBlock) Size() int64 {
@@ -73,9 +82,14 @@ func (m *memoryBlock) Write(bytes []byte) error {
 	}
 
 	m.offset.end += int64(len(bytes))
+	m.crc = crc32.Update(m.crc, crc32cTable, bytes)
 	return nil
 }
 
+func (m *memoryBlock) Checksum() uint32 {
+	return m.crc
+}
+
 func (m *memoryBlock) Reader() io.Reader {
 	return bytes.NewReader(m.buffer[0:m.offset.end])
 }
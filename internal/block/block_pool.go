@@ -15,6 +15,7 @@
 package block
 
 import (
+	"errors"
 	"fmt"
 
 	"golang.org/x/sync/semaphore"
@@ -37,6 +38,11 @@ type BlockPool struct {
 	// Semaphore used to limit the total number of blocks created across
 	// different files.
 	globalMaxBlocksSem *semaphore.Weighted
+
+	// Whether blocks are created as files in spillDir once globalMaxBlocksSem
+	// has no slots left. Such blocks don't hold a slot.
+	spillToDisk bool
+	spillDir    string
 }
 
 // NewBlockPool creates the blockPool based on the user configuration.
@@ -56,6 +62,20 @@ func NewBlockPool(blockSize int64, maxBlocks int64, globalMaxBlocksSem *semaphor
 	return
 }
 
+// NewHybridBlockPool creates a blockPool that keeps blocks in memory as long
+// as globalMaxBlocksSem allows, and beyond that creates them as files in
+// spillDir (the system temp directory if empty).
+func NewHybridBlockPool(blockSize int64, maxBlocks int64, globalMaxBlocksSem *semaphore.Weighted, spillDir string) (bp *BlockPool, err error) {
+	bp, err = NewBlockPool(blockSize, maxBlocks, globalMaxBlocksSem)
+	if err != nil {
+		return
+	}
+
+	bp.spillToDisk = true
+	bp.spillDir = spillDir
+	return
+}
+
 // Get returns a block. It returns an existing block if it's ready for reuse or
 // creates a new one if required.
 func (bp *BlockPool) Get() (Block, error) {
@@ -72,11 +92,19 @@ func (bp *BlockPool) Get() (Block, error) {
 			if bp.totalBlocks < bp.maxBlocks {
 				freeSlotsAvailable := bp.globalMaxBlocksSem.TryAcquire(1)
 				// We are allowed to create one block per file irrespective of free slots.
-				if bp.totalBlocks > 0 && !freeSlotsAvailable {
+				if bp.totalBlocks > 0 && !freeSlotsAvailable && !bp.spillToDisk {
 					continue
 				}
 
-				b, err := createBlock(bp.blockSize)
+				// Blocks created without a slot go to disk if they can, the first
+				// one included.
+				var b Block
+				var err error
+				if freeSlotsAvailable || !bp.spillToDisk {
+					b, err = createBlock(bp.blockSize)
+				} else {
+					b, err = createFileBlock(bp.spillDir, bp.blockSize)
+				}
 				if err != nil {
 					return nil, err
 				}
@@ -89,6 +117,48 @@ func (bp *BlockPool) Get() (Block, error) {
 	}
 }
 
+// ErrNoFreeBlock is returned by TryGet when every block the pool may create is
+// in use.
+var ErrNoFreeBlock = errors.New("no free block available")
+
+// TryGet is like Get, but returns ErrNoFreeBlock instead of waiting for a
+// block to be freed.
+func (bp *BlockPool) TryGet() (Block, error) {
+	select {
+	case b := <-bp.freeBlocksCh:
+		b.Reuse()
+		return b, nil
+
+	default:
+	}
+
+	if bp.totalBlocks >= bp.maxBlocks {
+		return nil, ErrNoFreeBlock
+	}
+
+	var b Block
+	var err error
+	switch {
+	case bp.globalMaxBlocksSem.TryAcquire(1):
+		b, err = createBlock(bp.blockSize)
+		if err != nil {
+			bp.globalMaxBlocksSem.Release(1)
+		}
+
+	case bp.spillToDisk:
+		b, err = createFileBlock(bp.spillDir, bp.blockSize)
+
+	default:
+		return nil, ErrNoFreeBlock
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bp.totalBlocks++
+	return b, nil
+}
+
 // FreeBlocksChannel returns the freeBlocksCh being used by the block pool.
 func (bp *BlockPool) FreeBlocksChannel() chan Block {
 	return bp.freeBlocksCh
@@ -109,7 +179,10 @@ func (bp *BlockPool) ClearFreeBlockChannel() error {
 				return fmt.Errorf("munmap error: %v", err)
 			}
 			bp.totalBlocks--
-			bp.globalMaxBlocksSem.Release(1)
+			// Blocks on disk don't hold a slot.
+			if _, ok := b.(*fileBlock); !ok {
+				bp.globalMaxBlocksSem.Release(1)
+			}
 		default:
 			// Return if there are no more blocks on the channel.
 			return nil
@@ -195,6 +195,111 @@ func (t *BlockPoolTest) TestGetWhenTotalBlocksEqualToMaxBlocks() {
 	t.validateGetBlockIsBlocked(bp)
 }
 
+func (t *BlockPoolTest) TestTryGetWhenBlockIsAvailableForReuse() {
+	bp, err := NewBlockPool(1024, 1, semaphore.NewWeighted(1))
+	require.Nil(t.T(), err)
+	b, err := bp.Get()
+	require.Nil(t.T(), err)
+	require.Nil(t.T(), b.Write([]byte("hi")))
+	bp.freeBlocksCh <- b
+
+	block, err := bp.TryGet()
+
+	require.Nil(t.T(), err)
+	assert.Equal(t.T(), b, block)
+	assert.Equal(t.T(), int64(0), block.Size())
+}
+
+func (t *BlockPoolTest) TestTryGetWhenTotalBlocksEqualToMaxBlocks() {
+	bp, err := NewBlockPool(1024, 1, semaphore.NewWeighted(2))
+	require.Nil(t.T(), err)
+	_, err = bp.TryGet()
+	require.Nil(t.T(), err)
+
+	_, err = bp.TryGet()
+
+	assert.ErrorIs(t.T(), err, ErrNoFreeBlock)
+	assert.Equal(t.T(), int64(1), bp.totalBlocks)
+}
+
+func (t *BlockPoolTest) TestTryGetWhenGlobalMaxBlocksIsExhausted() {
+	bp, err := NewBlockPool(1024, 10, semaphore.NewWeighted(1))
+	require.Nil(t.T(), err)
+	_, err = bp.TryGet()
+	require.Nil(t.T(), err)
+
+	_, err = bp.TryGet()
+
+	assert.ErrorIs(t.T(), err, ErrNoFreeBlock)
+	assert.Equal(t.T(), int64(1), bp.totalBlocks)
+}
+
+func (t *BlockPoolTest) TestHybridBlockPoolSpillsToDiskWhenGlobalMaxBlocksIsExhausted() {
+	bp, err := NewHybridBlockPool(1024, 10, semaphore.NewWeighted(1), t.T().TempDir())
+	require.Nil(t.T(), err)
+	b1, err := bp.Get()
+	require.Nil(t.T(), err)
+
+	b2, err := bp.Get()
+	require.Nil(t.T(), err)
+	b3, err := bp.TryGet()
+
+	require.Nil(t.T(), err)
+	assert.IsType(t.T(), &memoryBlock{}, b1)
+	assert.IsType(t.T(), &fileBlock{}, b2)
+	assert.IsType(t.T(), &fileBlock{}, b3)
+	assert.Equal(t.T(), int64(3), bp.totalBlocks)
+}
+
+func (t *BlockPoolTest) TestHybridBlockPoolSpillsFirstBlockWithoutFreeSlot() {
+	bp, err := NewHybridBlockPool(1024, 10, semaphore.NewWeighted(0), t.T().TempDir())
+	require.Nil(t.T(), err)
+
+	b, err := bp.Get()
+
+	require.Nil(t.T(), err)
+	assert.IsType(t.T(), &fileBlock{}, b)
+	// Giving the block back doesn't release a slot it never held.
+	bp.freeBlocksCh <- b
+	require.Nil(t.T(), bp.ClearFreeBlockChannel())
+	assert.False(t.T(), bp.globalMaxBlocksSem.TryAcquire(1))
+}
+
+func (t *BlockPoolTest) TestHybridBlockPoolRespectsMaxBlocks() {
+	bp, err := NewHybridBlockPool(1024, 1, semaphore.NewWeighted(0), t.T().TempDir())
+	require.Nil(t.T(), err)
+	_, err = bp.Get()
+	require.Nil(t.T(), err)
+
+	_, err = bp.TryGet()
+
+	assert.ErrorIs(t.T(), err, ErrNoFreeBlock)
+	t.validateGetBlockIsBlocked(bp)
+}
+
+func (t *BlockPoolTest) TestClearFreeBlockChannelOfHybridBlockPool() {
+	bp, err := NewHybridBlockPool(1024, 10, semaphore.NewWeighted(2), t.T().TempDir())
+	require.Nil(t.T(), err)
+	b1, err := bp.Get()
+	require.Nil(t.T(), err)
+	b2, err := bp.Get()
+	require.Nil(t.T(), err)
+	b3, err := bp.Get()
+	require.Nil(t.T(), err)
+	bp.freeBlocksCh <- b1
+	bp.freeBlocksCh <- b2
+	bp.freeBlocksCh <- b3
+
+	err = bp.ClearFreeBlockChannel()
+
+	require.Nil(t.T(), err)
+	require.Equal(t.T(), int64(0), bp.totalBlocks)
+	require.Nil(t.T(), b3.(*fileBlock).file)
+	// Only the memory blocks held a slot.
+	require.True(t.T(), bp.globalMaxBlocksSem.TryAcquire(2))
+	require.False(t.T(), bp.globalMaxBlocksSem.TryAcquire(1))
+}
+
 func (t *BlockPoolTest) validateGetBlockIsBlocked(bp *BlockPool) {
 	done := make(chan bool, 1)
 	go func() {
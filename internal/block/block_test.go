@@ -15,6 +15,7 @@
 package block
 
 import (
+	"hash/crc32"
 	"io"
 	"testing"
 
@@ -101,6 +102,19 @@ func (testSuite *MemoryBlockTest) TestMemoryBlockReuse() {
 	assert.Equal(testSuite.T(), int64(0), mb.Size())
 }
 
+func (testSuite *MemoryBlockTest) TestMemoryBlockChecksum() {
+	mb, err := createBlock(12)
+	require.Nil(testSuite.T(), err)
+	require.Nil(testSuite.T(), mb.Write([]byte("hi")))
+	require.Nil(testSuite.T(), mb.Write([]byte("hello")))
+
+	assert.Equal(testSuite.T(), crc32.Checksum([]byte("hihello"), crc32.MakeTable(crc32.Castagnoli)), mb.Checksum())
+
+	mb.Reuse()
+
+	assert.Equal(testSuite.T(), uint32(0), mb.Checksum())
+}
+
 // Other cases for Size are covered as part of write tests.
 func (testSuite *MemoryBlockTest) TestMemoryBlockSizeForEmptyBlock() {
 	mb, err := createBlock(12)
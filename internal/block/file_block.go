@@ -0,0 +1,100 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package block
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/jacobsa/fuse/fsutil"
+)
+
+// fileBlock is a block whose data lives in an anonymous file on disk rather
+// than in memory. It is used when the memory budget for blocks is exhausted.
+type fileBlock struct {
+	Block
+	file     *os.File
+	capacity int64
+	size     int64
+	crc      uint32
+}
+
+func (f *fileBlock) Reuse() {
+	// Give the space back to the file system; the block may sit in the pool
+	// for a while.
+	if f.file != nil {
+		_ = f.file.Truncate(0)
+	}
+
+	f.size = 0
+	f.crc = 0
+}
+
+func (f *fileBlock) Size() int64 {
+	return f.size
+}
+
+func (f *fileBlock) Write(bytes []byte) error {
+	if f.size+int64(len(bytes)) > f.capacity {
+		return fmt.Errorf("received data more than capacity of the block")
+	}
+
+	n, err := f.file.WriteAt(bytes, f.size)
+	if err != nil {
+		return fmt.Errorf("WriteAt: %w", err)
+	}
+
+	f.size += int64(n)
+	f.crc = crc32.Update(f.crc, crc32cTable, bytes[:n])
+	return nil
+}
+
+func (f *fileBlock) Checksum() uint32 {
+	return f.crc
+}
+
+func (f *fileBlock) Reader() io.Reader {
+	return io.NewSectionReader(f.file, 0, f.size)
+}
+
+func (f *fileBlock) Deallocate() error {
+	if f.file == nil {
+		return fmt.Errorf("invalid file")
+	}
+
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		return fmt.Errorf("Close: %w", err)
+	}
+
+	return nil
+}
+
+// createFileBlock creates a new block backed by an unlinked file in dir, or in
+// the system temp directory if dir is empty.
+func createFileBlock(dir string, blockSize int64) (Block, error) {
+	f, err := fsutil.AnonymousFile(dir)
+	if err != nil {
+		return nil, fmt.Errorf("AnonymousFile: %w", err)
+	}
+
+	return &fileBlock{
+		file:     f,
+		capacity: blockSize,
+	}, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package block
+
+import (
+	"hash/crc32"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type FileBlockTest struct {
+	suite.Suite
+	dir string
+}
+
+func TestFileBlockTestSuite(t *testing.T) {
+	suite.Run(t, new(FileBlockTest))
+}
+
+func (testSuite *FileBlockTest) SetupTest() {
+	testSuite.dir = testSuite.T().TempDir()
+}
+
+func (testSuite *FileBlockTest) TestFileBlockWriteWithMultipleWrites() {
+	fb, err := createFileBlock(testSuite.dir, 12)
+	require.Nil(testSuite.T(), err)
+	err = fb.Write([]byte("hi"))
+	assert.Nil(testSuite.T(), err)
+	err = fb.Write([]byte("hello"))
+	assert.Nil(testSuite.T(), err)
+
+	output, err := io.ReadAll(fb.Reader())
+	assert.Nil(testSuite.T(), err)
+	assert.Equal(testSuite.T(), []byte("hihello"), output)
+	assert.Equal(testSuite.T(), int64(7), fb.Size())
+}
+
+func (testSuite *FileBlockTest) TestFileBlockWriteWith2ndWriteBeyondCapacity() {
+	fb, err := createFileBlock(testSuite.dir, 2)
+	require.Nil(testSuite.T(), err)
+	err = fb.Write([]byte("hi"))
+	assert.Nil(testSuite.T(), err)
+
+	err = fb.Write([]byte("hi"))
+
+	assert.EqualError(testSuite.T(), err, outOfCapacityError)
+	assert.Equal(testSuite.T(), int64(2), fb.Size())
+}
+
+func (testSuite *FileBlockTest) TestFileBlockReuse() {
+	fb, err := createFileBlock(testSuite.dir, 12)
+	require.Nil(testSuite.T(), err)
+	err = fb.Write([]byte("hello"))
+	require.Nil(testSuite.T(), err)
+
+	fb.Reuse()
+	err = fb.Write([]byte("hi"))
+
+	assert.Nil(testSuite.T(), err)
+	output, err := io.ReadAll(fb.Reader())
+	assert.Nil(testSuite.T(), err)
+	assert.Equal(testSuite.T(), []byte("hi"), output)
+	assert.Equal(testSuite.T(), int64(2), fb.Size())
+}
+
+func (testSuite *FileBlockTest) TestFileBlockChecksum() {
+	fb, err := createFileBlock(testSuite.dir, 12)
+	require.Nil(testSuite.T(), err)
+	require.Nil(testSuite.T(), fb.Write([]byte("hello")))
+
+	fb.Reuse()
+	require.Nil(testSuite.T(), fb.Write([]byte("hi")))
+
+	assert.Equal(testSuite.T(), crc32.Checksum([]byte("hi"), crc32.MakeTable(crc32.Castagnoli)), fb.Checksum())
+}
+
+func (testSuite *FileBlockTest) TestFileBlockLeavesNoFileBehind() {
+	fb, err := createFileBlock(testSuite.dir, 12)
+	require.Nil(testSuite.T(), err)
+
+	entries, err := os.ReadDir(testSuite.dir)
+
+	require.Nil(testSuite.T(), err)
+	assert.Empty(testSuite.T(), entries)
+	assert.Nil(testSuite.T(), fb.Deallocate())
+}
+
+func (testSuite *FileBlockTest) TestFileBlockDeallocate() {
+	fb, err := createFileBlock(testSuite.dir, 12)
+	require.Nil(testSuite.T(), err)
+
+	err = fb.Deallocate()
+
+	assert.Nil(testSuite.T(), err)
+	assert.Nil(testSuite.T(), fb.(*fileBlock).file)
+	assert.NotNil(testSuite.T(), fb.Deallocate())
+}
@@ -17,9 +17,13 @@ package bufferedwrites
 import (
 	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
 	"math"
 	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/block"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
@@ -38,6 +42,17 @@ type BufferedWriteHandler struct {
 	// Total size of data buffered so far. Some part of buffered data might have
 	// been uploaded to GCS as well.
 	totalSize int64
+	// The CRC32C of the totalSize bytes buffered in order. It is only used to
+	// check the object uploaded: data is streamed to new or empty objects alone,
+	// so there is never unchanged content whose upload could be skipped.
+	crc uint32
+	// Writes that arrived ahead of totalSize, held until the gap before them is
+	// filled. Keyed by the offset of the first byte of each block; a block holds
+	// contiguous data.
+	pending map[int64]block.Block
+	// How many blocks of data may be held in pending. Writes further ahead of
+	// totalSize fail with ErrOutOfOrderWrite.
+	reorderWindowBlocks int64
 	// Stores the mtime value updated by kernel as part of setInodeAttributes call.
 	mtime time.Time
 }
@@ -48,35 +63,102 @@ type WriteFileInfo struct {
 	Mtime     time.Time
 }
 
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
 var ErrOutOfOrderWrite = errors.New("outOfOrder write detected")
 var ErrUploadFailure = errors.New("error while uploading object to GCS")
+var ErrUploadStarted = errors.New("upload has already started")
+var ErrNoCheckpoint = errors.New("upload can't be checkpointed before it is finalized")
+
+// CreateBWHandlerRequest holds the parameters of NewBWHandler.
+type CreateBWHandlerRequest struct {
+	ObjectName string
+	// The generation of the object the data replaces, or zero if there is
+	// none. Unless Overwrite is set, the object is only written over that
+	// generation.
+	SrcGeneration int64
+	Bucket        gcs.Bucket
+	BlockSize     int64
+	// The maximum number of blocks the file may use.
+	MaxBlocksPerFile int64
+	// Writes up to this many blocks ahead of the data buffered so far are held
+	// until the gap before them is filled. The window is capped so that the
+	// handler always keeps a block for in-order writes.
+	ReorderWindowBlocks int64
+	// If non-empty, the data is uploaded as temporary objects with this prefix
+	// and published under ObjectName on Flush, so that it can be taken back
+	// with Stage instead.
+	TmpObjectPrefix string
+	// If set, full blocks are uploaded in parallel as temporary part objects
+	// and composed on Flush. Requires TmpObjectPrefix.
+	ParallelCompositeUploads bool
+	// If set, blocks are created as files in SpillDir once GlobalMaxBlocksSem
+	// has no slots left, instead of waiting for memory to be freed.
+	SpillToDisk        bool
+	SpillDir           string
+	GlobalMaxBlocksSem *semaphore.Weighted
+	// If set, the object is written over whatever has been created under its
+	// name in the meantime, instead of failing with *gcs.PreconditionError.
+	Overwrite bool
+	// If non-nil, the object is composed under the name it returns for the
+	// object's own name when someone else has created an object under that
+	// name in the meantime. Requires TmpObjectPrefix, as the data of a
+	// resumable upload can only be moved to another name once staged.
+	ConflictCopyName func(objectName string) string
+	// The attributes that the object would otherwise lack are taken from the
+	// first of ObjectDefaults that applies to it.
+	ObjectDefaults []cfg.ObjectDefaults
+	// The timeout of each chunk of data sent to GCS, or zero for none.
+	ChunkTransferTimeoutSecs int64
+}
 
 // NewBWHandler creates the bufferedWriteHandler struct.
-func NewBWHandler(objectName string, bucket gcs.Bucket, blockSize int64, maxBlocks int64, globalMaxBlocksSem *semaphore.Weighted) (bwh *BufferedWriteHandler, err error) {
-	bp, err := block.NewBlockPool(blockSize, maxBlocks, globalMaxBlocksSem)
+func NewBWHandler(req *CreateBWHandlerRequest) (bwh *BufferedWriteHandler, err error) {
+	var bp *block.BlockPool
+	if req.SpillToDisk {
+		bp, err = block.NewHybridBlockPool(req.BlockSize, req.MaxBlocksPerFile, req.GlobalMaxBlocksSem, req.SpillDir)
+	} else {
+		bp, err = block.NewBlockPool(req.BlockSize, req.MaxBlocksPerFile, req.GlobalMaxBlocksSem)
+	}
 	if err != nil {
 		return
 	}
 
+	if (req.ParallelCompositeUploads || req.ConflictCopyName != nil) && req.TmpObjectPrefix == "" {
+		err = fmt.Errorf("composite uploads and conflict copies require a temporary object prefix")
+		return
+	}
+
+	var tmpPrefix string
+	if req.TmpObjectPrefix != "" {
+		tmpPrefix, err = newPartPrefix(req.TmpObjectPrefix)
+		if err != nil {
+			err = fmt.Errorf("newPartPrefix: %w", err)
+			return
+		}
+	}
+
 	bwh = &BufferedWriteHandler{
-		current:       nil,
-		blockPool:     bp,
-		uploadHandler: newUploadHandler(objectName, bucket, maxBlocks, bp.FreeBlocksChannel(), blockSize),
-		totalSize:     0,
-		mtime:         time.Now(),
+		current:             nil,
+		blockPool:           bp,
+		uploadHandler:       newUploadHandler(req.ObjectName, req.Bucket, req.MaxBlocksPerFile, bp.FreeBlocksChannel(), req.BlockSize, tmpPrefix, req.ParallelCompositeUploads),
+		totalSize:           0,
+		pending:             make(map[int64]block.Block),
+		reorderWindowBlocks: max(0, min(req.ReorderWindowBlocks, req.MaxBlocksPerFile-1)),
+		mtime:               time.Now(),
 	}
+	bwh.uploadHandler.checkpointGeneration = req.SrcGeneration
+	bwh.uploadHandler.overwrite = req.Overwrite
+	bwh.uploadHandler.conflictCopyName = req.ConflictCopyName
+	bwh.uploadHandler.objectDefaults = req.ObjectDefaults
+	bwh.uploadHandler.chunkTransferTimeoutSecs = req.ChunkTransferTimeoutSecs
 	return
 }
 
 // Write writes the given data to the buffer. It writes to an existing buffer if
-// the capacity is available otherwise writes to a new buffer.
+// the capacity is available otherwise writes to a new buffer. Writes ahead of
+// the buffered data are held if they fit in the reorder window.
 func (wh *BufferedWriteHandler) Write(data []byte, offset int64) (err error) {
-	if offset != wh.totalSize {
-		logger.Errorf("BufferedWriteHandler.OutOfOrderError for object: %s, expectedOffset: %d, actualOffset: %d",
-			wh.uploadHandler.objectName, wh.totalSize, offset)
-		return ErrOutOfOrderWrite
-	}
-
 	// Fail early if the uploadHandler has failed.
 	select {
 	case <-wh.uploadHandler.SignalUploadFailure():
@@ -85,6 +167,33 @@ func (wh *BufferedWriteHandler) Write(data []byte, offset int64) (err error) {
 		break
 	}
 
+	if offset != wh.totalSize {
+		err = wh.hold(data, offset)
+		if errors.Is(err, ErrOutOfOrderWrite) {
+			logger.Errorf("BufferedWriteHandler.OutOfOrderError for object: %s, expectedOffset: %d, actualOffset: %d",
+				wh.uploadHandler.objectName, wh.totalSize, offset)
+		}
+		return
+	}
+
+	// Data held for later offsets can't be overwritten in order.
+	if wh.overlapsPending(offset, offset+int64(len(data))) {
+		logger.Errorf("BufferedWriteHandler.OutOfOrderError for object: %s, write at offset %d overlaps pending data",
+			wh.uploadHandler.objectName, offset)
+		return ErrOutOfOrderWrite
+	}
+
+	err = wh.appendData(data)
+	if err != nil {
+		return
+	}
+
+	return wh.drainPending()
+}
+
+// appendData writes data at the end of the buffered data, handing blocks over
+// for upload as they fill up.
+func (wh *BufferedWriteHandler) appendData(data []byte) (err error) {
 	dataWritten := 0
 	for dataWritten < len(data) {
 		if wh.current == nil {
@@ -101,6 +210,7 @@ func (wh *BufferedWriteHandler) Write(data []byte, offset int64) (err error) {
 		if err != nil {
 			return err
 		}
+		wh.crc = crc32.Update(wh.crc, crc32cTable, data[dataWritten:dataWritten+bytesToCopy])
 
 		dataWritten += bytesToCopy
 
@@ -117,6 +227,133 @@ func (wh *BufferedWriteHandler) Write(data []byte, offset int64) (err error) {
 	return
 }
 
+// hold keeps a write that starts beyond the buffered data in pending blocks.
+// It returns ErrOutOfOrderWrite if the write doesn't fit in the reorder window
+// or overlaps data that was already written.
+func (wh *BufferedWriteHandler) hold(data []byte, offset int64) (err error) {
+	end := offset + int64(len(data))
+	blockSize := wh.blockPool.BlockSize()
+	if offset < wh.totalSize || end > wh.totalSize+wh.reorderWindowBlocks*blockSize {
+		return ErrOutOfOrderWrite
+	}
+
+	if wh.overlapsPending(offset, end) {
+		return ErrOutOfOrderWrite
+	}
+
+	// Find the block the write continues, if any.
+	var tail block.Block
+	for start, b := range wh.pending {
+		if start+b.Size() == offset && b.Size() < blockSize {
+			tail = b
+		}
+	}
+
+	toNewBlocks := int64(len(data))
+	if tail != nil {
+		toNewBlocks -= blockSize - tail.Size()
+	}
+	newBlocks := (max(0, toNewBlocks) + blockSize - 1) / blockSize
+	if int64(len(wh.pending))+newBlocks > wh.reorderWindowBlocks {
+		return ErrOutOfOrderWrite
+	}
+
+	// Get all the blocks up front, so that a write that can't be held leaves
+	// no trace. The in-order writes that fill the gap need a block too, or the
+	// pending blocks could starve them.
+	var blocks []block.Block
+	needed := newBlocks
+	if wh.current == nil && newBlocks > 0 {
+		needed++
+	}
+	for int64(len(blocks)) < needed {
+		var b block.Block
+		b, err = wh.blockPool.TryGet()
+		if err != nil {
+			for _, b := range blocks {
+				wh.blockPool.FreeBlocksChannel() <- b
+			}
+			if errors.Is(err, block.ErrNoFreeBlock) {
+				return ErrOutOfOrderWrite
+			}
+			return fmt.Errorf("failed to get new block: %w", err)
+		}
+		blocks = append(blocks, b)
+	}
+	if int64(len(blocks)) > newBlocks {
+		wh.current, blocks = blocks[0], blocks[1:]
+	}
+
+	for len(data) > 0 {
+		if tail == nil || tail.Size() == blockSize {
+			tail, blocks = blocks[0], blocks[1:]
+			wh.pending[offset] = tail
+		}
+
+		n := min(int64(len(data)), blockSize-tail.Size())
+		if err = tail.Write(data[:n]); err != nil {
+			return
+		}
+		data = data[n:]
+		offset += n
+	}
+
+	return
+}
+
+// overlapsPending tells whether the range [offset, end) overlaps a pending
+// block.
+func (wh *BufferedWriteHandler) overlapsPending(offset int64, end int64) bool {
+	for start, b := range wh.pending {
+		if offset < start+b.Size() && start < end {
+			return true
+		}
+	}
+	return false
+}
+
+// drainPending appends the pending blocks that the buffered data has caught
+// up with, returning them to the pool.
+func (wh *BufferedWriteHandler) drainPending() error {
+	for {
+		b, ok := wh.pending[wh.totalSize]
+		if !ok {
+			return nil
+		}
+		delete(wh.pending, wh.totalSize)
+
+		data, err := io.ReadAll(b.Reader())
+		wh.blockPool.FreeBlocksChannel() <- b
+		if err != nil {
+			return fmt.Errorf("failed to read pending block: %w", err)
+		}
+
+		if err = wh.appendData(data); err != nil {
+			return err
+		}
+	}
+}
+
+// fillGaps zero-fills the holes left before the pending blocks, so that all
+// the data written so far is buffered in order.
+func (wh *BufferedWriteHandler) fillGaps() error {
+	for len(wh.pending) > 0 {
+		next := int64(math.MaxInt64)
+		for start := range wh.pending {
+			next = min(next, start)
+		}
+
+		if err := wh.appendData(make([]byte, next-wh.totalSize)); err != nil {
+			return err
+		}
+		if err := wh.drainPending(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Sync uploads all the pending full buffers to GCS.
 func (wh *BufferedWriteHandler) Sync() (err error) {
 	wh.uploadHandler.AwaitBlocksUpload()
@@ -129,8 +366,53 @@ func (wh *BufferedWriteHandler) Sync() (err error) {
 	}
 }
 
-// Flush finalizes the upload.
+// Checkpoint prepares composing the object from the full blocks uploaded so
+// far, so that the data they hold is in GCS before the upload is finalized.
+// The object is written by the Write method of the returned checkpoint, which
+// must be followed by a call to CheckpointWritten before the handler is
+// flushed. It returns nil if no more blocks have been uploaded since the last
+// checkpoint. Only parallel composite uploads can be checkpointed; the data of
+// others is only in an object once finalized, and ErrNoCheckpoint is returned
+// for them.
+func (wh *BufferedWriteHandler) Checkpoint() (*Checkpoint, error) {
+	select {
+	case <-wh.uploadHandler.SignalUploadFailure():
+		return nil, ErrUploadFailure
+	default:
+	}
+
+	return wh.uploadHandler.checkpoint()
+}
+
+// CheckpointWritten records that the checkpoint has been written as o, which
+// Flush then replaces.
+func (wh *BufferedWriteHandler) CheckpointWritten(c *Checkpoint, o *gcs.Object) {
+	wh.uploadHandler.checkpointWritten(c, o)
+}
+
+// Flush finalizes the upload. Holes left by writes that are still pending
+// read as zeros in the object.
 func (wh *BufferedWriteHandler) Flush() (*gcs.Object, error) {
+	return wh.finalize("Flush", wh.uploadHandler.Finalize)
+}
+
+// Stage finalizes the upload as a temporary object instead of the object, so
+// that the data written so far can be picked up elsewhere without anyone else
+// seeing it. Holes left by writes that are still pending read as zeros. The
+// caller is responsible for deleting the returned object. This requires a
+// TmpObjectPrefix.
+func (wh *BufferedWriteHandler) Stage() (*gcs.Object, error) {
+	return wh.finalize("Stage", wh.uploadHandler.Stage)
+}
+
+// finalize uploads all the data written so far and finalizes the upload with
+// finalizeUpload, checking the object it returns. Errors are attributed to the
+// named method.
+func (wh *BufferedWriteHandler) finalize(method string, finalizeUpload func() (*gcs.Object, error)) (*gcs.Object, error) {
+	if err := wh.fillGaps(); err != nil {
+		return nil, fmt.Errorf("BufferedWriteHandler.%s(): %w", method, err)
+	}
+
 	if wh.current != nil {
 		err := wh.uploadHandler.Upload(wh.current)
 		if err != nil {
@@ -139,9 +421,9 @@ func (wh *BufferedWriteHandler) Flush() (*gcs.Object, error) {
 		wh.current = nil
 	}
 
-	obj, err := wh.uploadHandler.Finalize()
+	obj, err := finalizeUpload()
 	if err != nil {
-		return nil, fmt.Errorf("BufferedWriteHandler.Flush(): %w", err)
+		return nil, fmt.Errorf("BufferedWriteHandler.%s(): %w", method, err)
 	}
 
 	err = wh.blockPool.ClearFreeBlockChannel()
@@ -158,19 +440,67 @@ func (wh *BufferedWriteHandler) Flush() (*gcs.Object, error) {
 		break
 	}
 
+	// The checksum of the data isn't known until it has all been streamed, so
+	// it is checked against the object afterwards. An object missing data the
+	// uploader failed on is reported as ErrUploadFailure above instead.
+	if obj != nil && obj.CRC32C != nil && *obj.CRC32C != wh.crc {
+		return nil, fmt.Errorf("BufferedWriteHandler.%s(): %w", method, &gcs.ChecksumMismatchError{
+			Err: fmt.Errorf("object %q generation %d has CRC32C 0x%08x, the data written has 0x%08x",
+				obj.Name, obj.Generation, *obj.CRC32C, wh.crc),
+		})
+	}
+
 	return obj, nil
 }
 
+// UploadStarted reports whether any data has been handed over for upload, after
+// which the name of the object can no longer change.
+func (wh *BufferedWriteHandler) UploadStarted() bool {
+	return wh.uploadHandler.UploadStarted()
+}
+
+// SetObjectName changes the name of the object the buffered data is written
+// to. This is only possible until the upload has started.
+func (wh *BufferedWriteHandler) SetObjectName(objectName string) error {
+	if wh.UploadStarted() {
+		return ErrUploadStarted
+	}
+
+	wh.uploadHandler.objectName = objectName
+	return nil
+}
+
+// SetObjectMetadata sets the custom metadata the object is created with,
+// replacing any set before. This is only possible until the upload has started.
+func (wh *BufferedWriteHandler) SetObjectMetadata(metadata map[string]string) error {
+	if wh.UploadStarted() {
+		return ErrUploadStarted
+	}
+
+	wh.uploadHandler.metadata = maps.Clone(metadata)
+	return nil
+}
+
+// Destroy abandons the upload without finalizing it.
+func (wh *BufferedWriteHandler) Destroy() {
+	wh.uploadHandler.Abandon()
+}
+
 // SetMtime stores the mtime with the bufferedWriteHandler.
 func (wh *BufferedWriteHandler) SetMtime(mtime time.Time) {
 	wh.mtime = mtime
 }
 
 // WriteFileInfo returns the file info i.e, how much data has been buffered so far
-// and the mtime.
+// and the mtime. Pending writes count towards the size.
 func (wh *BufferedWriteHandler) WriteFileInfo() WriteFileInfo {
+	size := wh.totalSize
+	for start, b := range wh.pending {
+		size = max(size, start+b.Size())
+	}
+
 	return WriteFileInfo{
-		TotalSize: wh.totalSize,
+		TotalSize: size,
 		Mtime:     wh.mtime,
 	}
 }
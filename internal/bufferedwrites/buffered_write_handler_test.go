@@ -15,12 +15,17 @@
 package bufferedwrites
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
 	"github.com/jacobsa/timeutil"
 	"github.com/stretchr/testify/assert"
@@ -30,7 +35,8 @@ import (
 )
 
 type BufferedWriteTest struct {
-	bwh *BufferedWriteHandler
+	bwh    *BufferedWriteHandler
+	bucket gcs.Bucket
 	suite.Suite
 }
 
@@ -39,12 +45,64 @@ func TestBufferedWriteTestSuite(t *testing.T) {
 }
 
 func (testSuite *BufferedWriteTest) SetupTest() {
-	bucket := fake.NewFakeBucket(timeutil.RealClock(), "FakeBucketName", gcs.NonHierarchical)
-	bwh, err := NewBWHandler("testObject", bucket, blockSize, 10, semaphore.NewWeighted(10))
+	testSuite.bucket = fake.NewFakeBucket(timeutil.RealClock(), "FakeBucketName", gcs.NonHierarchical)
+	bwh, err := NewBWHandler(&CreateBWHandlerRequest{
+		ObjectName:          "testObject",
+		Bucket:              testSuite.bucket,
+		BlockSize:           blockSize,
+		MaxBlocksPerFile:    10,
+		ReorderWindowBlocks: 0,
+		GlobalMaxBlocksSem:  semaphore.NewWeighted(10),
+	})
 	require.Nil(testSuite.T(), err)
 	testSuite.bwh = bwh
 }
 
+func (testSuite *BufferedWriteTest) useReorderWindow(blocks int64) {
+	bwh, err := NewBWHandler(&CreateBWHandlerRequest{
+		ObjectName:          "testObject",
+		Bucket:              testSuite.bucket,
+		BlockSize:           blockSize,
+		MaxBlocksPerFile:    10,
+		ReorderWindowBlocks: blocks,
+		GlobalMaxBlocksSem:  semaphore.NewWeighted(10),
+	})
+	require.Nil(testSuite.T(), err)
+	testSuite.bwh = bwh
+}
+
+func (testSuite *BufferedWriteTest) useTmpObjectPrefix() {
+	bwh, err := NewBWHandler(&CreateBWHandlerRequest{
+		ObjectName:         "testObject",
+		Bucket:             testSuite.bucket,
+		BlockSize:          blockSize,
+		MaxBlocksPerFile:   10,
+		TmpObjectPrefix:    tmpObjectPrefix,
+		GlobalMaxBlocksSem: semaphore.NewWeighted(10),
+	})
+	require.Nil(testSuite.T(), err)
+	testSuite.bwh = bwh
+}
+
+func (testSuite *BufferedWriteTest) tmpObjects() []string {
+	listing, err := testSuite.bucket.ListObjects(context.Background(), &gcs.ListObjectsRequest{Prefix: tmpObjectPrefix})
+	require.NoError(testSuite.T(), err)
+
+	var names []string
+	for _, o := range listing.MinObjects {
+		names = append(names, o.Name)
+	}
+	return names
+}
+
+func (testSuite *BufferedWriteTest) flushAndRead() string {
+	_, err := testSuite.bwh.Flush()
+	require.NoError(testSuite.T(), err)
+	contents, err := storageutil.ReadObject(context.Background(), testSuite.bucket, "testObject")
+	require.NoError(testSuite.T(), err)
+	return string(contents)
+}
+
 func (testSuite *BufferedWriteTest) TestSetMTime() {
 	testTime := time.Now()
 
@@ -124,6 +182,129 @@ func (testSuite *BufferedWriteTest) TestWriteWhenNextOffsetIsLessThanExpected()
 	assert.Equal(testSuite.T(), int64(5), fileInfo.TotalSize)
 }
 
+func (testSuite *BufferedWriteTest) TestWriteAheadWithinReorderWindowIsHeld() {
+	testSuite.useReorderWindow(2)
+	err := testSuite.bwh.Write([]byte("world"), 5)
+	require.Nil(testSuite.T(), err)
+	assert.Equal(testSuite.T(), int64(10), testSuite.bwh.WriteFileInfo().TotalSize)
+	assert.Equal(testSuite.T(), int64(0), testSuite.bwh.totalSize)
+
+	err = testSuite.bwh.Write([]byte("hello"), 0)
+
+	require.Nil(testSuite.T(), err)
+	assert.Equal(testSuite.T(), int64(10), testSuite.bwh.totalSize)
+	assert.Equal(testSuite.T(), 0, len(testSuite.bwh.pending))
+	assert.Equal(testSuite.T(), "helloworld", testSuite.flushAndRead())
+}
+
+func (testSuite *BufferedWriteTest) TestWritesAheadSpanningBlocks() {
+	testSuite.useReorderWindow(2)
+	data := strings.Repeat("A", blockSize/2) + strings.Repeat("B", blockSize)
+	require.Nil(testSuite.T(), testSuite.bwh.Write([]byte(data[:blockSize/2]), 10))
+	require.Nil(testSuite.T(), testSuite.bwh.Write([]byte(data[blockSize/2:]), 10+blockSize/2))
+	assert.Equal(testSuite.T(), 2, len(testSuite.bwh.pending))
+
+	err := testSuite.bwh.Write([]byte(strings.Repeat("C", 10)), 0)
+
+	require.Nil(testSuite.T(), err)
+	assert.Equal(testSuite.T(), int64(10+len(data)), testSuite.bwh.totalSize)
+	assert.Equal(testSuite.T(), strings.Repeat("C", 10)+data, testSuite.flushAndRead())
+}
+
+func (testSuite *BufferedWriteTest) TestWriteBeyondReorderWindow() {
+	testSuite.useReorderWindow(2)
+
+	err := testSuite.bwh.Write([]byte("hi"), 2*blockSize-1)
+
+	assert.Equal(testSuite.T(), ErrOutOfOrderWrite, err)
+	assert.Equal(testSuite.T(), 0, len(testSuite.bwh.pending))
+	assert.Equal(testSuite.T(), int64(0), testSuite.bwh.WriteFileInfo().TotalSize)
+}
+
+func (testSuite *BufferedWriteTest) TestWriteOverlappingPendingData() {
+	testSuite.useReorderWindow(2)
+	require.Nil(testSuite.T(), testSuite.bwh.Write([]byte("world"), 5))
+
+	err := testSuite.bwh.Write([]byte("abcdefgh"), 0)
+	assert.Equal(testSuite.T(), ErrOutOfOrderWrite, err)
+	err = testSuite.bwh.Write([]byte("xyz"), 8)
+	assert.Equal(testSuite.T(), ErrOutOfOrderWrite, err)
+
+	assert.Equal(testSuite.T(), int64(0), testSuite.bwh.totalSize)
+	assert.Equal(testSuite.T(), int64(10), testSuite.bwh.WriteFileInfo().TotalSize)
+}
+
+func (testSuite *BufferedWriteTest) TestReorderWindowIsCappedByMaxBlocks() {
+	bwh, err := NewBWHandler(&CreateBWHandlerRequest{
+		ObjectName:          "testObject",
+		Bucket:              testSuite.bucket,
+		BlockSize:           blockSize,
+		MaxBlocksPerFile:    2,
+		ReorderWindowBlocks: 5,
+		GlobalMaxBlocksSem:  semaphore.NewWeighted(10),
+	})
+	require.Nil(testSuite.T(), err)
+
+	assert.Equal(testSuite.T(), int64(1), bwh.reorderWindowBlocks)
+}
+
+func (testSuite *BufferedWriteTest) TestFlushZeroFillsGaps() {
+	testSuite.useReorderWindow(2)
+	require.Nil(testSuite.T(), testSuite.bwh.Write([]byte("hi"), 0))
+	require.Nil(testSuite.T(), testSuite.bwh.Write([]byte("world"), 5))
+
+	assert.Equal(testSuite.T(), "hi\x00\x00\x00world", testSuite.flushAndRead())
+}
+
+func (testSuite *BufferedWriteTest) TestWriteSpillsToDiskWhenGlobalMaxBlocksIsExhausted() {
+	bwh, err := NewBWHandler(&CreateBWHandlerRequest{
+		ObjectName:         "testObject",
+		Bucket:             testSuite.bucket,
+		BlockSize:          blockSize,
+		MaxBlocksPerFile:   10,
+		SpillToDisk:        true,
+		SpillDir:           testSuite.T().TempDir(),
+		GlobalMaxBlocksSem: semaphore.NewWeighted(0),
+	})
+	require.Nil(testSuite.T(), err)
+	testSuite.bwh = bwh
+	contents := strings.Repeat("A", 3*blockSize) + "tail"
+
+	err = testSuite.bwh.Write([]byte(contents), 0)
+
+	require.Nil(testSuite.T(), err)
+	assert.Equal(testSuite.T(), contents, testSuite.flushAndRead())
+}
+
+func (testSuite *BufferedWriteTest) TestFlushReplacesSrcGeneration() {
+	src, err := storageutil.CreateObject(context.Background(), testSuite.bucket, "testObject", []byte("old"))
+	require.NoError(testSuite.T(), err)
+	bwh, err := NewBWHandler(&CreateBWHandlerRequest{
+		ObjectName:         "testObject",
+		SrcGeneration:      src.Generation,
+		Bucket:             testSuite.bucket,
+		BlockSize:          blockSize,
+		MaxBlocksPerFile:   10,
+		GlobalMaxBlocksSem: semaphore.NewWeighted(10),
+	})
+	require.NoError(testSuite.T(), err)
+	testSuite.bwh = bwh
+	require.NoError(testSuite.T(), testSuite.bwh.Write([]byte("new"), 0))
+
+	assert.Equal(testSuite.T(), "new", testSuite.flushAndRead())
+}
+
+func (testSuite *BufferedWriteTest) TestFlushFailsIfSrcGenerationWasReplaced() {
+	_, err := storageutil.CreateObject(context.Background(), testSuite.bucket, "testObject", []byte("old"))
+	require.NoError(testSuite.T(), err)
+	require.NoError(testSuite.T(), testSuite.bwh.Write([]byte("new"), 0))
+
+	_, err = testSuite.bwh.Flush()
+
+	var preconditionErr *gcs.PreconditionError
+	assert.True(testSuite.T(), errors.As(err, &preconditionErr))
+}
+
 func (testSuite *BufferedWriteTest) TestMultipleWrites() {
 	err := testSuite.bwh.Write([]byte("hello"), 0)
 	require.Nil(testSuite.T(), err)
@@ -136,6 +317,23 @@ func (testSuite *BufferedWriteTest) TestMultipleWrites() {
 	assert.Equal(testSuite.T(), int64(13), fileInfo.TotalSize)
 }
 
+func (testSuite *BufferedWriteTest) TestFlushWithCorruptedUpload() {
+	bwh, err := NewBWHandler(&CreateBWHandlerRequest{
+		ObjectName:         "testObject",
+		Bucket:             &corruptingBucket{Bucket: testSuite.bucket},
+		BlockSize:          blockSize,
+		MaxBlocksPerFile:   10,
+		GlobalMaxBlocksSem: semaphore.NewWeighted(10),
+	})
+	require.NoError(testSuite.T(), err)
+	require.NoError(testSuite.T(), bwh.Write([]byte(strings.Repeat("A", blockSize)+"tail"), 0))
+
+	_, err = bwh.Flush()
+
+	var checksumErr *gcs.ChecksumMismatchError
+	assert.True(testSuite.T(), errors.As(err, &checksumErr))
+}
+
 func (testSuite *BufferedWriteTest) TestWriteWithSignalUploadFailureInBetween() {
 	err := testSuite.bwh.Write([]byte("hello"), 0)
 	require.Nil(testSuite.T(), err)
@@ -247,3 +445,159 @@ func (testSuite *BufferedWriteTest) TestSyncBlocksWithError() {
 	assert.Error(testSuite.T(), err)
 	assert.Equal(testSuite.T(), ErrUploadFailure, err)
 }
+
+func (testSuite *BufferedWriteTest) TestSetObjectNameBeforeUploadStarted() {
+	err := testSuite.bwh.Write([]byte("hi"), 0)
+	require.Nil(testSuite.T(), err)
+	require.False(testSuite.T(), testSuite.bwh.UploadStarted())
+
+	err = testSuite.bwh.SetObjectName("newObject")
+
+	require.NoError(testSuite.T(), err)
+	obj, err := testSuite.bwh.Flush()
+	require.NoError(testSuite.T(), err)
+	assert.Equal(testSuite.T(), "newObject", obj.Name)
+}
+
+func (testSuite *BufferedWriteTest) TestSetObjectNameAfterUploadStarted() {
+	buffer, err := operations.GenerateRandomData(blockSize)
+	assert.NoError(testSuite.T(), err)
+	err = testSuite.bwh.Write(buffer, 0)
+	require.Nil(testSuite.T(), err)
+	require.True(testSuite.T(), testSuite.bwh.UploadStarted())
+
+	err = testSuite.bwh.SetObjectName("newObject")
+
+	assert.Equal(testSuite.T(), ErrUploadStarted, err)
+	assert.Equal(testSuite.T(), "testObject", testSuite.bwh.uploadHandler.objectName)
+}
+
+func (testSuite *BufferedWriteTest) TestSetObjectMetadataBeforeUploadStarted() {
+	err := testSuite.bwh.Write([]byte("hi"), 0)
+	require.Nil(testSuite.T(), err)
+
+	err = testSuite.bwh.SetObjectMetadata(map[string]string{"gcsfuse_mode": "755"})
+
+	require.NoError(testSuite.T(), err)
+	obj, err := testSuite.bwh.Flush()
+	require.NoError(testSuite.T(), err)
+	assert.Equal(testSuite.T(), "755", obj.Metadata["gcsfuse_mode"])
+	assert.EqualValues(testSuite.T(), 1, obj.MetaGeneration)
+}
+
+func (testSuite *BufferedWriteTest) TestSetObjectMetadataAfterUploadStarted() {
+	buffer, err := operations.GenerateRandomData(blockSize)
+	assert.NoError(testSuite.T(), err)
+	err = testSuite.bwh.Write(buffer, 0)
+	require.Nil(testSuite.T(), err)
+
+	err = testSuite.bwh.SetObjectMetadata(map[string]string{"gcsfuse_mode": "755"})
+
+	assert.Equal(testSuite.T(), ErrUploadStarted, err)
+	assert.Nil(testSuite.T(), testSuite.bwh.uploadHandler.metadata)
+}
+
+// corruptingBucket flips a bit of the first byte written to each object, as if
+// it was corrupted on its way to GCS.
+type corruptingBucket struct {
+	gcs.Bucket
+}
+
+func (b *corruptingBucket) CreateObject(ctx context.Context, req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	contents, err := io.ReadAll(req.Contents)
+	if err != nil {
+		return nil, err
+	}
+	if len(contents) > 0 {
+		contents[0] ^= 1
+	}
+
+	corrupted := *req
+	corrupted.Contents = bytes.NewReader(contents)
+	return b.Bucket.CreateObject(ctx, &corrupted)
+}
+
+func (b *corruptingBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	w, err := b.Bucket.CreateObjectChunkWriter(ctx, req, chunkSize, callBack)
+	if err != nil {
+		return nil, err
+	}
+	return &corruptingWriter{Writer: w}, nil
+}
+
+func (b *corruptingBucket) FinalizeUpload(ctx context.Context, w gcs.Writer) (*gcs.Object, error) {
+	return b.Bucket.FinalizeUpload(ctx, w.(*corruptingWriter).Writer)
+}
+
+type corruptingWriter struct {
+	gcs.Writer
+	written bool
+}
+
+func (w *corruptingWriter) Write(p []byte) (int, error) {
+	if !w.written && len(p) > 0 {
+		w.written = true
+		p = bytes.Clone(p)
+		p[0] ^= 1
+	}
+	return w.Writer.Write(p)
+}
+
+func (testSuite *BufferedWriteTest) TestFlushPublishesStagedObject() {
+	testSuite.useTmpObjectPrefix()
+	contents := append(bytes.Repeat([]byte("a"), 2*blockSize), "tail"...)
+	require.NoError(testSuite.T(), testSuite.bwh.Write(contents, 0))
+	require.NoError(testSuite.T(), testSuite.bwh.Sync())
+
+	obj, err := testSuite.bwh.Flush()
+
+	require.NoError(testSuite.T(), err)
+	assert.Equal(testSuite.T(), "testObject", obj.Name)
+	got, err := storageutil.ReadObject(context.Background(), testSuite.bucket, "testObject")
+	require.NoError(testSuite.T(), err)
+	assert.Equal(testSuite.T(), contents, got)
+	assert.Empty(testSuite.T(), testSuite.tmpObjects())
+}
+
+func (testSuite *BufferedWriteTest) TestFlushOfStagedObjectWhenObjectWasCreatedMeanwhile() {
+	testSuite.useTmpObjectPrefix()
+	require.NoError(testSuite.T(), testSuite.bwh.Write(bytes.Repeat([]byte("a"), 2*blockSize), 0))
+	_, err := storageutil.CreateObject(context.Background(), testSuite.bucket, "testObject", []byte("taco"))
+	require.NoError(testSuite.T(), err)
+
+	_, err = testSuite.bwh.Flush()
+
+	var preconditionErr *gcs.PreconditionError
+	assert.True(testSuite.T(), errors.As(err, &preconditionErr))
+	got, err := storageutil.ReadObject(context.Background(), testSuite.bucket, "testObject")
+	require.NoError(testSuite.T(), err)
+	assert.Equal(testSuite.T(), "taco", string(got))
+	assert.Empty(testSuite.T(), testSuite.tmpObjects())
+}
+
+func (testSuite *BufferedWriteTest) TestStage() {
+	testSuite.useTmpObjectPrefix()
+	require.NoError(testSuite.T(), testSuite.bwh.Write(bytes.Repeat([]byte("a"), blockSize), 0))
+	require.NoError(testSuite.T(), testSuite.bwh.Sync())
+	require.NoError(testSuite.T(), testSuite.bwh.Write([]byte("tail"), blockSize))
+
+	obj, err := testSuite.bwh.Stage()
+
+	require.NoError(testSuite.T(), err)
+	assert.True(testSuite.T(), strings.HasPrefix(obj.Name, tmpObjectPrefix))
+	got, err := storageutil.ReadObject(context.Background(), testSuite.bucket, obj.Name)
+	require.NoError(testSuite.T(), err)
+	assert.Equal(testSuite.T(), string(bytes.Repeat([]byte("a"), blockSize))+"tail", string(got))
+	// Nobody else gets to see the data.
+	_, err = storageutil.ReadObject(context.Background(), testSuite.bucket, "testObject")
+	var notFoundErr *gcs.NotFoundError
+	assert.True(testSuite.T(), errors.As(err, &notFoundErr))
+}
+
+func (testSuite *BufferedWriteTest) TestStageWithoutTmpObjectPrefix() {
+	require.NoError(testSuite.T(), testSuite.bwh.Write([]byte("hi"), 0))
+
+	_, err := testSuite.bwh.Stage()
+
+	assert.Error(testSuite.T(), err)
+}
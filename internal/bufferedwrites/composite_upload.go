@@ -0,0 +1,410 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bufferedwrites
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/block"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// In a parallel composite upload, every block is written concurrently as a
+// temporary part object, instead of being streamed into a single resumable
+// upload. Finalize then assembles the object from the parts with
+// ComposeObjects and deletes them. Objects with more blocks than a composite
+// object may have components continue as resumable uploads instead.
+//
+// The parts of an upload share a prefix under the temporary object prefix, so
+// that the ones left behind by a crash are eventually garbage collected. While
+// the upload is in progress, the prefix is registered in activePartPrefixes to
+// keep the garbage collector from deleting parts of slow uploads.
+
+// The part prefixes of the composite uploads in progress.
+var activePartPrefixes sync.Map
+
+func registerParts(partPrefix string) {
+	activePartPrefixes.Store(partPrefix, struct{}{})
+}
+
+func unregisterParts(partPrefix string) {
+	activePartPrefixes.Delete(partPrefix)
+}
+
+// IsActivePart tells whether the named temporary object belongs to a
+// composite upload that is still in progress, and hence must not be garbage
+// collected however old it is.
+func IsActivePart(name string) (active bool) {
+	activePartPrefixes.Range(func(partPrefix, _ any) bool {
+		active = strings.HasPrefix(name, partPrefix.(string))
+		return !active
+	})
+	return
+}
+
+// newPartPrefix chooses a prefix under tmpObjectPrefix that is unique to one
+// upload.
+func newPartPrefix(tmpObjectPrefix string) (string, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(rand.Reader, buf[:]); err != nil {
+		return "", fmt.Errorf("ReadFull: %w", err)
+	}
+
+	return fmt.Sprintf("%spart-%x-", tmpObjectPrefix, buf), nil
+}
+
+// uploadPart uploads the block as the next part object in the background,
+// returning it to the pool once done.
+func (uh *UploadHandler) uploadPart(b block.Block) error {
+	uh.partsMu.Lock()
+	index := len(uh.parts)
+	uh.parts = append(uh.parts, gcs.ComposeSource{})
+	uh.partsMu.Unlock()
+
+	// GCS rejects the part if it doesn't receive the data the block holds.
+	crc := b.Checksum()
+	uh.wg.Add(1)
+	go func() {
+		defer uh.wg.Done()
+		// Put back the uploaded block on the freeBlocksChannel for re-use.
+		defer func() { uh.freeBlocksCh <- b }()
+
+		select {
+		case <-uh.signalUploadFailure:
+			return
+		default:
+		}
+
+		var zero int64
+		o, err := uh.bucket.CreateObject(uh.ctx, &gcs.CreateObjectRequest{
+			Name:                     fmt.Sprintf("%s%05d", uh.tmpPrefix, index),
+			GenerationPrecondition:   &zero,
+			CRC32C:                   &crc,
+			Contents:                 b.Reader(),
+			ChunkTransferTimeoutSecs: uh.chunkTransferTimeoutSecs,
+		})
+		if err != nil {
+			logger.Errorf("parallel composite upload failed for object %s: part %d: %v", uh.objectName, index, err)
+			uh.failOnce.Do(func() {
+				uh.partErr = err
+				close(uh.signalUploadFailure)
+			})
+			return
+		}
+
+		uh.partsMu.Lock()
+		uh.parts[index] = gcs.ComposeSource{Name: o.Name, Generation: o.Generation}
+		uh.partsMu.Unlock()
+	}()
+
+	return nil
+}
+
+// partCount returns the number of parts handed over for upload so far.
+func (uh *UploadHandler) partCount() int {
+	uh.partsMu.Lock()
+	defer uh.partsMu.Unlock()
+	return len(uh.parts)
+}
+
+// switchToStream continues the upload as a resumable upload of the staged
+// object, for objects with more blocks than can be composed. Once the parts
+// uploaded so far have been, they are streamed into the staged object ahead
+// of the blocks handed over afterwards, and deleted.
+func (uh *UploadHandler) switchToStream() error {
+	uh.wg.Wait()
+	select {
+	case <-uh.signalUploadFailure:
+		return ErrUploadFailure
+	default:
+	}
+
+	uh.partsMu.Lock()
+	parts := slices.Clone(uh.parts)
+	uh.partsMu.Unlock()
+
+	if err := uh.createObjectWriter(true); err != nil {
+		return fmt.Errorf("createObjectWriter: %w", err)
+	}
+	uh.composite = false
+
+	uh.wg.Add(1)
+	go func() {
+		err := uh.streamParts(parts)
+		uh.wg.Done()
+		if err != nil {
+			logger.Errorf("buffered write upload failed for object %s: streaming parts: %v", uh.objectName, err)
+			// Close the channel to signal upload failure.
+			close(uh.signalUploadFailure)
+		}
+		uh.uploader()
+	}()
+
+	return nil
+}
+
+// streamParts copies the contents of the supplied parts to the writer, and
+// deletes them.
+func (uh *UploadHandler) streamParts(parts []gcs.ComposeSource) error {
+	names := make([]string, 0, len(parts))
+	for _, part := range parts {
+		rc, err := uh.bucket.NewReader(uh.ctx, &gcs.ReadObjectRequest{
+			Name:       part.Name,
+			Generation: part.Generation,
+		})
+		if err != nil {
+			return fmt.Errorf("NewReader: %w", err)
+		}
+
+		_, err = io.Copy(uh.writer, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("copying part %s: %w", part.Name, err)
+		}
+		names = append(names, part.Name)
+	}
+
+	uh.deleteTmpObjects(names)
+	return nil
+}
+
+// finalizeParts waits for the parts to be uploaded and composes the object
+// described by req from them, which is the object itself or the staged one. The
+// parts are deleted whether or not this succeeds.
+func (uh *UploadHandler) finalizeParts(req *gcs.CreateObjectRequest) (o *gcs.Object, err error) {
+	uh.wg.Wait()
+
+	uh.partsMu.Lock()
+	sources := slices.Clone(uh.parts)
+	uh.partsMu.Unlock()
+
+	var tmpNames []string
+	for _, src := range sources {
+		if src.Name != "" {
+			tmpNames = append(tmpNames, src.Name)
+		}
+	}
+	defer func() { uh.deleteTmpObjects(tmpNames) }()
+
+	select {
+	case <-uh.signalUploadFailure:
+		err = fmt.Errorf("parts of object %s failed to upload: %w", uh.objectName, ErrUploadFailure)
+		if uh.partErr != nil {
+			err = fmt.Errorf("%w: %w", err, uh.partErr)
+		}
+		return
+	default:
+	}
+
+	ctx := uh.ctx
+	if len(sources) == 0 {
+		req.Contents = strings.NewReader("")
+		o, err = uh.bucket.CreateObject(ctx, req)
+		if name := uh.conflictCopyTarget(req.Name, err); name != "" {
+			req.Name = name
+			req.GenerationPrecondition = nil
+			req.Contents = strings.NewReader("")
+			o, err = uh.bucket.CreateObject(ctx, req)
+		}
+		if err != nil {
+			err = fmt.Errorf("CreateObject failed for object %s: %w", uh.objectName, err)
+		}
+		return
+	}
+
+	sources, intermediates, err := uh.composeTree(sources, "c")
+	tmpNames = append(tmpNames, intermediates...)
+	if err != nil {
+		return
+	}
+
+	composeReq := newComposeRequest(req, sources)
+	o, err = uh.bucket.ComposeObjects(ctx, composeReq)
+	if name := uh.conflictCopyTarget(req.Name, err); name != "" {
+		composeReq.DstName = name
+		composeReq.DstGenerationPrecondition = nil
+		composeReq.DstMetaGenerationPrecondition = nil
+		o, err = uh.bucket.ComposeObjects(ctx, composeReq)
+	}
+	if err != nil {
+		err = fmt.Errorf("ComposeObjects failed for object %s: %w", uh.objectName, err)
+		return
+	}
+
+	return
+}
+
+// composeTree composes the sources into temporary objects named after level,
+// level by level, until they fit in a single compose request, as a compose
+// request takes a limited number of sources. It returns the remaining sources
+// and the names of the temporary objects it created.
+func (uh *UploadHandler) composeTree(sources []gcs.ComposeSource, level string) (top []gcs.ComposeSource, tmpNames []string, err error) {
+	for depth := 0; len(sources) > gcs.MaxSourcesPerComposeRequest; depth++ {
+		var next []gcs.ComposeSource
+		for i := 0; i < len(sources); i += gcs.MaxSourcesPerComposeRequest {
+			var zero int64
+			var c *gcs.Object
+			c, err = uh.bucket.ComposeObjects(uh.ctx, &gcs.ComposeObjectsRequest{
+				DstName:                   fmt.Sprintf("%s%s%d-%05d", uh.tmpPrefix, level, depth, i/gcs.MaxSourcesPerComposeRequest),
+				DstGenerationPrecondition: &zero,
+				Sources:                   sources[i:min(i+gcs.MaxSourcesPerComposeRequest, len(sources))],
+			})
+			if err != nil {
+				err = fmt.Errorf("ComposeObjects failed for parts of object %s: %w", uh.objectName, err)
+				return
+			}
+
+			tmpNames = append(tmpNames, c.Name)
+			next = append(next, gcs.ComposeSource{Name: c.Name, Generation: c.Generation})
+		}
+		sources = next
+	}
+
+	top = sources
+	return
+}
+
+// newComposeRequest returns the request composing the object described by req
+// from the supplied sources.
+func newComposeRequest(req *gcs.CreateObjectRequest, sources []gcs.ComposeSource) *gcs.ComposeObjectsRequest {
+	return &gcs.ComposeObjectsRequest{
+		DstName:                       req.Name,
+		DstGenerationPrecondition:     req.GenerationPrecondition,
+		DstMetaGenerationPrecondition: req.MetaGenerationPrecondition,
+		Sources:                       sources,
+		ContentType:                   req.ContentType,
+		Metadata:                      req.Metadata,
+		ContentLanguage:               req.ContentLanguage,
+		ContentEncoding:               req.ContentEncoding,
+		CacheControl:                  req.CacheControl,
+		ContentDisposition:            req.ContentDisposition,
+		CustomTime:                    req.CustomTime,
+		EventBasedHold:                req.EventBasedHold,
+		StorageClass:                  req.StorageClass,
+		Acl:                           req.Acl,
+	}
+}
+
+// Checkpoint composes the object from the parts uploaded so far, so that the
+// data they hold is in GCS before the upload is finalized. Its Write method
+// may be called concurrently with the methods of the handler, so that writes
+// aren't held up by the compose. See BufferedWriteHandler.Checkpoint.
+type Checkpoint struct {
+	uh      *UploadHandler
+	req     *gcs.CreateObjectRequest
+	sources []gcs.ComposeSource
+
+	// The number of bytes of data the checkpoint holds, from the start of the
+	// object.
+	Size int64
+}
+
+// checkpoint returns a checkpoint of the parts from the first one up to the
+// first that hasn't been uploaded yet, or nil if there are no more of them
+// than in the last checkpoint.
+func (uh *UploadHandler) checkpoint() (*Checkpoint, error) {
+	if !uh.composite {
+		return nil, ErrNoCheckpoint
+	}
+
+	uh.partsMu.Lock()
+	n := 0
+	for n < len(uh.parts) && uh.parts[n].Name != "" {
+		n++
+	}
+	sources := slices.Clone(uh.parts[:n])
+	uh.partsMu.Unlock()
+
+	if n <= uh.checkpointParts {
+		return nil, nil
+	}
+
+	return &Checkpoint{
+		uh:      uh,
+		req:     uh.newCreateObjectRequest(),
+		sources: sources,
+		Size:    int64(n) * uh.blockSize,
+	}, nil
+}
+
+// Write composes the checkpoint into the object, replacing the previous
+// checkpoint if any. It fails with *gcs.PreconditionError if someone else has
+// created or replaced the object in the meantime.
+func (c *Checkpoint) Write() (o *gcs.Object, err error) {
+	uh := c.uh
+	sources, tmpNames, err := uh.composeTree(c.sources, fmt.Sprintf("k%d-", len(c.sources)))
+	defer func() { uh.deleteTmpObjects(tmpNames) }()
+	if err != nil {
+		return
+	}
+
+	o, err = uh.bucket.ComposeObjects(uh.ctx, newComposeRequest(c.req, sources))
+	if err != nil {
+		err = fmt.Errorf("ComposeObjects failed for checkpoint of object %s: %w", uh.objectName, err)
+		return
+	}
+
+	return
+}
+
+// checkpointWritten records that the checkpoint has been written as o, which
+// later checkpoints and Finalize replace.
+func (uh *UploadHandler) checkpointWritten(c *Checkpoint, o *gcs.Object) {
+	uh.checkpointParts = len(c.sources)
+	uh.checkpointGeneration = o.Generation
+}
+
+// conflictCopyTarget returns the name under which the object is to be created
+// instead, if err means that someone else has created it in the meantime and
+// conflict copies are enabled. It returns "" otherwise, including when err
+// came from creating dstName, which isn't the object.
+func (uh *UploadHandler) conflictCopyTarget(dstName string, err error) string {
+	var preconditionErr *gcs.PreconditionError
+	if uh.conflictCopyName == nil || dstName != uh.objectName || !errors.As(err, &preconditionErr) {
+		return ""
+	}
+
+	return uh.conflictCopyName(uh.objectName)
+}
+
+// deleteTmpObjects makes an effort to delete the supplied part objects. The
+// ones that can't be deleted are left to garbage collection.
+func (uh *UploadHandler) deleteTmpObjects(names []string) {
+	for _, name := range names {
+		err := uh.bucket.DeleteObject(uh.ctx, &gcs.DeleteObjectRequest{
+			Name:       name,
+			Generation: 0, // Delete the latest generation of temporary object.
+		})
+		if err != nil {
+			logger.Warnf("Failed to delete temporary object %s: %v", name, err)
+		}
+	}
+}
+
+// Abandon gives up on the upload, cancelling the requests in flight.
+// Temporary objects that have been uploaded are left to garbage collection.
+func (uh *UploadHandler) Abandon() {
+	uh.cancel()
+	if uh.tmpPrefix != "" {
+		unregisterParts(uh.tmpPrefix)
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bufferedwrites
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/sync/semaphore"
+)
+
+const tmpObjectPrefix = ".gcsfuse_tmp/"
+
+type CompositeUploadTest struct {
+	bwh    *BufferedWriteHandler
+	bucket gcs.Bucket
+	suite.Suite
+}
+
+func TestCompositeUploadTestSuite(t *testing.T) {
+	suite.Run(t, new(CompositeUploadTest))
+}
+
+func (t *CompositeUploadTest) SetupTest() {
+	t.bucket = fake.NewFakeBucket(timeutil.RealClock(), "FakeBucketName", gcs.NonHierarchical)
+	bwh, err := NewBWHandler(&CreateBWHandlerRequest{
+		ObjectName:               "testObject",
+		Bucket:                   t.bucket,
+		BlockSize:                blockSize,
+		MaxBlocksPerFile:         10,
+		TmpObjectPrefix:          tmpObjectPrefix,
+		ParallelCompositeUploads: true,
+		GlobalMaxBlocksSem:       semaphore.NewWeighted(10),
+	})
+	require.NoError(t.T(), err)
+	t.bwh = bwh
+}
+
+func (t *CompositeUploadTest) tmpObjects() []string {
+	listing, err := t.bucket.ListObjects(context.Background(), &gcs.ListObjectsRequest{Prefix: tmpObjectPrefix})
+	require.NoError(t.T(), err)
+
+	var names []string
+	for _, o := range listing.MinObjects {
+		names = append(names, o.Name)
+	}
+	return names
+}
+
+func (t *CompositeUploadTest) writeBlocks(count int) []byte {
+	var contents []byte
+	for i := 0; i < count; i++ {
+		contents = append(contents, bytes.Repeat([]byte{byte('a' + i%26)}, blockSize)...)
+	}
+	require.NoError(t.T(), t.bwh.Write(contents, 0))
+	return contents
+}
+
+func (t *CompositeUploadTest) TestFlushComposesParts() {
+	contents := append(t.writeBlocks(3), []byte("tail")...)
+	require.NoError(t.T(), t.bwh.Write([]byte("tail"), 3*blockSize))
+	require.NoError(t.T(), t.bwh.Sync())
+	assert.True(t.T(), t.bwh.UploadStarted())
+	assert.Len(t.T(), t.tmpObjects(), 3)
+	assert.True(t.T(), IsActivePart(t.tmpObjects()[0]))
+
+	obj, err := t.bwh.Flush()
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), uint64(len(contents)), obj.Size)
+	got, err := storageutil.ReadObject(context.Background(), t.bucket, "testObject")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), contents, got)
+	// The parts are gone, and no longer protected from garbage collection.
+	assert.Empty(t.T(), t.tmpObjects())
+	assert.False(t.T(), IsActivePart(t.bwh.uploadHandler.tmpPrefix+"00000"))
+}
+
+func (t *CompositeUploadTest) TestFlushComposesMorePartsThanOneRequestTakes() {
+	contents := t.writeBlocks(2*gcs.MaxSourcesPerComposeRequest + 1)
+
+	obj, err := t.bwh.Flush()
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), uint64(len(contents)), obj.Size)
+	assert.Equal(t.T(), int64(2*gcs.MaxSourcesPerComposeRequest+1), obj.ComponentCount)
+	got, err := storageutil.ReadObject(context.Background(), t.bucket, "testObject")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), contents, got)
+	assert.Empty(t.T(), t.tmpObjects())
+}
+
+func (t *CompositeUploadTest) TestFlushStreamsObjectsWithTooManyBlocksToCompose() {
+	contents := t.writeBlocks(gcs.MaxComponentCount + 2)
+
+	obj, err := t.bwh.Flush()
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), uint64(len(contents)), obj.Size)
+	got, err := storageutil.ReadObject(context.Background(), t.bucket, "testObject")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), contents, got)
+	assert.Empty(t.T(), t.tmpObjects())
+}
+
+func (t *CompositeUploadTest) TestFlushWithoutData() {
+	obj, err := t.bwh.Flush()
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), uint64(0), obj.Size)
+	assert.Equal(t.T(), "testObject", obj.Name)
+}
+
+func (t *CompositeUploadTest) TestFlushWhenObjectWasCreatedMeanwhile() {
+	t.writeBlocks(2)
+	_, err := storageutil.CreateObject(context.Background(), t.bucket, "testObject", []byte("taco"))
+	require.NoError(t.T(), err)
+	var preconditionErr *gcs.PreconditionError
+
+	_, err = t.bwh.Flush()
+
+	assert.True(t.T(), errors.As(err, &preconditionErr))
+	// The parts are cleaned up on failure too.
+	assert.Empty(t.T(), t.tmpObjects())
+}
+
+func (t *CompositeUploadTest) TestFlushWhenObjectWasCreatedMeanwhileWithConflictCopy() {
+	t.bwh.uploadHandler.conflictCopyName = func(objectName string) string {
+		return objectName + ".conflict"
+	}
+	contents := t.writeBlocks(2)
+	_, err := storageutil.CreateObject(context.Background(), t.bucket, "testObject", []byte("taco"))
+	require.NoError(t.T(), err)
+
+	obj, err := t.bwh.Flush()
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "testObject.conflict", obj.Name)
+	copyContents, err := storageutil.ReadObject(context.Background(), t.bucket, "testObject.conflict")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), contents, copyContents)
+	objContents, err := storageutil.ReadObject(context.Background(), t.bucket, "testObject")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", string(objContents))
+	assert.Empty(t.T(), t.tmpObjects())
+}
+
+func (t *CompositeUploadTest) TestFlushWhenObjectWasCreatedMeanwhileWithOverwrite() {
+	t.bwh.uploadHandler.overwrite = true
+	contents := t.writeBlocks(2)
+	_, err := storageutil.CreateObject(context.Background(), t.bucket, "testObject", []byte("taco"))
+	require.NoError(t.T(), err)
+
+	obj, err := t.bwh.Flush()
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "testObject", obj.Name)
+	objContents, err := storageutil.ReadObject(context.Background(), t.bucket, "testObject")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), contents, objContents)
+}
+
+func (t *CompositeUploadTest) TestFlushWithCorruptedPart() {
+	bwh, err := NewBWHandler(&CreateBWHandlerRequest{
+		ObjectName:               "testObject",
+		Bucket:                   &corruptingBucket{Bucket: t.bucket},
+		BlockSize:                blockSize,
+		MaxBlocksPerFile:         10,
+		TmpObjectPrefix:          tmpObjectPrefix,
+		ParallelCompositeUploads: true,
+		GlobalMaxBlocksSem:       semaphore.NewWeighted(10),
+	})
+	require.NoError(t.T(), err)
+	t.bwh = bwh
+	t.writeBlocks(2)
+
+	_, err = t.bwh.Flush()
+
+	// The parts were rejected, and the object never created.
+	var checksumErr *gcs.ChecksumMismatchError
+	assert.True(t.T(), errors.As(err, &checksumErr))
+	_, err = storageutil.ReadObject(context.Background(), t.bucket, "testObject")
+	var notFoundErr *gcs.NotFoundError
+	assert.True(t.T(), errors.As(err, &notFoundErr))
+	assert.Empty(t.T(), t.tmpObjects())
+}
+
+func (t *CompositeUploadTest) TestStageComposesPartsAsTmpObject() {
+	contents := t.writeBlocks(3)
+
+	obj, err := t.bwh.Stage()
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), []string{obj.Name}, t.tmpObjects())
+	got, err := storageutil.ReadObject(context.Background(), t.bucket, obj.Name)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), contents, got)
+	_, err = storageutil.ReadObject(context.Background(), t.bucket, "testObject")
+	var notFoundErr *gcs.NotFoundError
+	assert.True(t.T(), errors.As(err, &notFoundErr))
+}
+
+func (t *CompositeUploadTest) TestCheckpointComposesUploadedBlocks() {
+	contents := t.writeBlocks(2)
+	require.NoError(t.T(), t.bwh.Write([]byte("tail"), 2*blockSize))
+	require.NoError(t.T(), t.bwh.Sync())
+
+	c, err := t.bwh.Checkpoint()
+	require.NoError(t.T(), err)
+	require.NotNil(t.T(), c)
+	o, err := c.Write()
+	require.NoError(t.T(), err)
+	t.bwh.CheckpointWritten(c, o)
+
+	// The object holds the full blocks, and the parts are kept for Flush.
+	assert.Equal(t.T(), int64(2*blockSize), c.Size)
+	got, err := storageutil.ReadObject(context.Background(), t.bucket, "testObject")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), contents, got)
+	assert.Len(t.T(), t.tmpObjects(), 2)
+	// Nothing more has been uploaded since.
+	c, err = t.bwh.Checkpoint()
+	require.NoError(t.T(), err)
+	assert.Nil(t.T(), c)
+	// And Flush replaces the checkpoint.
+	obj, err := t.bwh.Flush()
+	require.NoError(t.T(), err)
+	assert.Less(t.T(), o.Generation, obj.Generation)
+	got, err = storageutil.ReadObject(context.Background(), t.bucket, "testObject")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), append(contents, []byte("tail")...), got)
+	assert.Empty(t.T(), t.tmpObjects())
+}
+
+func (t *CompositeUploadTest) TestCheckpointComposesMorePartsThanOneRequestTakes() {
+	contents := t.writeBlocks(gcs.MaxSourcesPerComposeRequest + 1)
+	require.NoError(t.T(), t.bwh.Sync())
+
+	c, err := t.bwh.Checkpoint()
+	require.NoError(t.T(), err)
+	_, err = c.Write()
+
+	require.NoError(t.T(), err)
+	got, err := storageutil.ReadObject(context.Background(), t.bucket, "testObject")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), contents, got)
+	// Only the parts are left.
+	assert.Len(t.T(), t.tmpObjects(), gcs.MaxSourcesPerComposeRequest+1)
+}
+
+func (t *CompositeUploadTest) TestCheckpointWhenObjectWasCreatedMeanwhile() {
+	t.writeBlocks(1)
+	require.NoError(t.T(), t.bwh.Sync())
+	_, err := storageutil.CreateObject(context.Background(), t.bucket, "testObject", []byte("taco"))
+	require.NoError(t.T(), err)
+	c, err := t.bwh.Checkpoint()
+	require.NoError(t.T(), err)
+
+	_, err = c.Write()
+
+	var preconditionErr *gcs.PreconditionError
+	assert.True(t.T(), errors.As(err, &preconditionErr))
+}
+
+func (t *CompositeUploadTest) TestCheckpointOfResumableUpload() {
+	t.bwh.uploadHandler.composite = false
+
+	_, err := t.bwh.Checkpoint()
+
+	assert.ErrorIs(t.T(), err, ErrNoCheckpoint)
+}
+
+func (t *CompositeUploadTest) TestDestroyLeavesPartsToGarbageCollection() {
+	t.writeBlocks(1)
+	require.NoError(t.T(), t.bwh.Sync())
+	parts := t.tmpObjects()
+	require.Len(t.T(), parts, 1)
+	require.True(t.T(), IsActivePart(parts[0]))
+
+	t.bwh.Destroy()
+
+	assert.False(t.T(), IsActivePart(parts[0]))
+	assert.ErrorIs(t.T(), t.bwh.uploadHandler.ctx.Err(), context.Canceled)
+}
+
+func TestIsActivePartIgnoresOtherTmpObjects(t *testing.T) {
+	partPrefix, err := newPartPrefix(tmpObjectPrefix)
+	require.NoError(t, err)
+	registerParts(partPrefix)
+	defer unregisterParts(partPrefix)
+
+	assert.True(t, IsActivePart(partPrefix+"00001"))
+	assert.False(t, IsActivePart(tmpObjectPrefix+"0123456789abcdef"))
+}
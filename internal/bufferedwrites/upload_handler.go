@@ -18,11 +18,14 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"path"
 	"sync"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/block"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
 )
 
 // UploadHandler is responsible for synchronized uploads of the filled blocks
@@ -45,14 +48,62 @@ type UploadHandler struct {
 	signalUploadFailure chan error
 
 	// Parameters required for creating a new GCS chunk writer.
-	bucket     gcs.Bucket
-	objectName string
-	blockSize  int64
+	bucket                   gcs.Bucket
+	objectName               string
+	blockSize                int64
+	chunkTransferTimeoutSecs int64
+
+	// The context of all the requests of the upload, which outlives the write
+	// calls that hand over the blocks. It is cancelled by Abandon.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// If non-empty, the temporary objects of the upload are created with this
+	// prefix, which is unique to the upload. With composite set, blocks are
+	// uploaded concurrently as part objects, and composed into the object on
+	// Finalize; see composite_upload.go. Otherwise the blocks are streamed into
+	// a staged object, which Finalize rewrites to the object's name.
+	tmpPrefix string
+	composite bool
+
+	// Whether the writer streams into the staged object.
+	staged bool
+
+	// The number of parts and the generation of the last checkpoint written,
+	// see Checkpoint. Until one is written, the generation is that of the
+	// object the data replaces, zero if there is none.
+	checkpointParts      int
+	checkpointGeneration int64
+
+	// See CreateBWHandlerRequest.
+	overwrite        bool
+	conflictCopyName func(objectName string) string
+	objectDefaults   []cfg.ObjectDefaults
+
+	// Custom metadata the object is created with, see
+	// BufferedWriteHandler.SetObjectMetadata.
+	metadata map[string]string
+
+	// Ensures signalUploadFailure is closed once when parts fail concurrently.
+	failOnce sync.Once
+	// The error of the part that failed first, set under failOnce.
+	partErr error
+
+	partsMu sync.Mutex
+	// The part objects uploaded so far, in the order of the blocks. Entries are
+	// zero until the upload of the part completes.
+	//
+	// GUARDED_BY(partsMu)
+	parts []gcs.ComposeSource
 }
 
-// newUploadHandler creates the UploadHandler struct.
-func newUploadHandler(objectName string, bucket gcs.Bucket, maxBlocks int64, freeBlocksCh chan block.Block, blockSize int64) *UploadHandler {
+// newUploadHandler creates the UploadHandler struct. A non-empty tmpPrefix
+// enables staging, and parallel composite uploads if composite is set.
+func newUploadHandler(objectName string, bucket gcs.Bucket, maxBlocks int64, freeBlocksCh chan block.Block, blockSize int64, tmpPrefix string, composite bool) *UploadHandler {
+	ctx, cancel := context.WithCancel(context.Background())
 	uh := &UploadHandler{
+		ctx:                 ctx,
+		cancel:              cancel,
 		uploadCh:            make(chan block.Block, maxBlocks),
 		wg:                  sync.WaitGroup{},
 		freeBlocksCh:        freeBlocksCh,
@@ -60,17 +111,33 @@ func newUploadHandler(objectName string, bucket gcs.Bucket, maxBlocks int64, fre
 		objectName:          objectName,
 		blockSize:           blockSize,
 		signalUploadFailure: make(chan error, 1),
+		tmpPrefix:           tmpPrefix,
+		composite:           composite,
+	}
+	if tmpPrefix != "" {
+		registerParts(tmpPrefix)
 	}
 	return uh
 }
 
 // Upload adds a block to the upload queue.
 func (uh *UploadHandler) Upload(block block.Block) error {
+	if uh.composite && uh.partCount() >= gcs.MaxComponentCount {
+		// The object can't be composed from any more parts.
+		if err := uh.switchToStream(); err != nil {
+			return fmt.Errorf("switchToStream failed for object %s: %w", uh.objectName, err)
+		}
+	}
+
+	if uh.composite {
+		return uh.uploadPart(block)
+	}
+
 	uh.wg.Add(1)
 
 	if uh.writer == nil {
 		// Lazily create the object writer.
-		err := uh.createObjectWriter()
+		err := uh.createObjectWriter(uh.tmpPrefix != "")
 		if err != nil {
 			// createObjectWriter can only fail here due to throttling, so we will not
 			// handle this error explicitly or fall back to temp file flow.
@@ -84,17 +151,39 @@ func (uh *UploadHandler) Upload(block block.Block) error {
 	return nil
 }
 
-// createObjectWriter creates a GCS object writer.
-func (uh *UploadHandler) createObjectWriter() (err error) {
-	var preCond int64
+// newCreateObjectRequest returns the request the object is created with,
+// whether it is streamed or composed from parts.
+func (uh *UploadHandler) newCreateObjectRequest() *gcs.CreateObjectRequest {
 	req := &gcs.CreateObjectRequest{
-		Name:                   uh.objectName,
-		GenerationPrecondition: &preCond,
-		Metadata:               make(map[string]string),
+		Name:                     uh.objectName,
+		Metadata:                 make(map[string]string),
+		ChunkTransferTimeoutSecs: uh.chunkTransferTimeoutSecs,
+	}
+	for k, v := range uh.metadata {
+		req.Metadata[k] = v
+	}
+	if !uh.overwrite {
+		// Once checkpointed, the object is ours to replace.
+		preCond := uh.checkpointGeneration
+		req.GenerationPrecondition = &preCond
+	}
+	storageutil.ApplyObjectDefaults(uh.objectDefaults, req)
+	return req
+}
+
+// createObjectWriter creates a GCS object writer, which streams into the
+// staged object if staged is set.
+func (uh *UploadHandler) createObjectWriter(staged bool) (err error) {
+	req := uh.newCreateObjectRequest()
+	if staged {
+		var zero int64
+		req.Name = uh.stagedName()
+		req.GenerationPrecondition = &zero
 	}
-	// We need a new context here, since the first writeFile() call will be complete
-	// (and context will be cancelled) by the time complete upload is done.
-	uh.writer, err = uh.bucket.CreateObjectChunkWriter(context.Background(), req, int(uh.blockSize), nil)
+	uh.staged = staged
+	// The context of the upload is used here, since the first writeFile() call
+	// will be complete (and its context cancelled) by the time the upload is done.
+	uh.writer, err = uh.bucket.CreateObjectChunkWriter(uh.ctx, req, int(uh.blockSize), nil)
 	return
 }
 
@@ -119,25 +208,107 @@ func (uh *UploadHandler) uploader() {
 
 // Finalize finalizes the upload.
 func (uh *UploadHandler) Finalize() (*gcs.Object, error) {
+	if uh.tmpPrefix != "" {
+		defer unregisterParts(uh.tmpPrefix)
+	}
+
+	if uh.composite {
+		return uh.finalizeParts(uh.newCreateObjectRequest())
+	}
+
+	// Writer may not have been created for empty file creation flow or for very
+	// small writes of size less than 1 block, in which case there is nothing to
+	// stage.
+	obj, err := uh.finalizeWriter(false)
+	if err != nil || !uh.staged {
+		return obj, err
+	}
+
+	return uh.publishStaged(obj)
+}
+
+// Stage finalizes the upload as the staged object instead of the object, and
+// returns it. The caller is responsible for deleting it.
+func (uh *UploadHandler) Stage() (*gcs.Object, error) {
+	if uh.tmpPrefix == "" {
+		return nil, fmt.Errorf("object %s is not staged", uh.objectName)
+	}
+	defer unregisterParts(uh.tmpPrefix)
+
+	if uh.composite {
+		var zero int64
+		return uh.finalizeParts(&gcs.CreateObjectRequest{
+			Name:                   uh.stagedName(),
+			GenerationPrecondition: &zero,
+		})
+	}
+
+	return uh.finalizeWriter(true)
+}
+
+// finalizeWriter waits for the blocks to be streamed and finalizes the writer,
+// which is created if need be, staged or not.
+func (uh *UploadHandler) finalizeWriter(staged bool) (*gcs.Object, error) {
 	uh.wg.Wait()
 	close(uh.uploadCh)
 
 	if uh.writer == nil {
-		// Writer may not have been created for empty file creation flow or for very
-		// small writes of size less than 1 block.
-		err := uh.createObjectWriter()
+		err := uh.createObjectWriter(staged)
 		if err != nil {
 			return nil, fmt.Errorf("createObjectWriter failed for object %s: %w", uh.objectName, err)
 		}
 	}
 
-	obj, err := uh.bucket.FinalizeUpload(context.Background(), uh.writer)
+	obj, err := uh.bucket.FinalizeUpload(uh.ctx, uh.writer)
 	if err != nil {
 		return nil, fmt.Errorf("FinalizeUpload failed for object %s: %w", uh.objectName, err)
 	}
 	return obj, nil
 }
 
+// stagedName returns the name of the temporary object the data is staged as
+// before it is published under the object's name. It keeps the extension, which
+// the content type may be guessed from.
+func (uh *UploadHandler) stagedName() string {
+	return uh.tmpPrefix + "staged" + path.Ext(uh.objectName)
+}
+
+// publishStaged rewrites the staged object to the object's name, creating it
+// with the attributes the staged object was created with. The staged object
+// is deleted whether or not this succeeds.
+func (uh *UploadHandler) publishStaged(staged *gcs.Object) (o *gcs.Object, err error) {
+	defer uh.deleteTmpObjects([]string{staged.Name})
+
+	ctx := uh.ctx
+	req := &gcs.RewriteObjectRequest{
+		SrcName:                   staged.Name,
+		SrcGeneration:             staged.Generation,
+		DstName:                   uh.objectName,
+		DstGenerationPrecondition: uh.newCreateObjectRequest().GenerationPrecondition,
+	}
+	o, err = uh.bucket.RewriteObject(ctx, req)
+	if name := uh.conflictCopyTarget(req.DstName, err); name != "" {
+		req.DstName = name
+		req.DstGenerationPrecondition = nil
+		o, err = uh.bucket.RewriteObject(ctx, req)
+	}
+	if err != nil {
+		err = fmt.Errorf("RewriteObject failed for object %s: %w", uh.objectName, err)
+	}
+	return
+}
+
+// UploadStarted reports whether any block has been handed over for upload.
+func (uh *UploadHandler) UploadStarted() bool {
+	if uh.composite {
+		uh.partsMu.Lock()
+		defer uh.partsMu.Unlock()
+		return len(uh.parts) > 0
+	}
+
+	return uh.writer != nil
+}
+
 func (uh *UploadHandler) SignalUploadFailure() chan error {
 	return uh.signalUploadFailure
 }
@@ -21,6 +21,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/block"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	storagemock "github.com/googlecloudplatform/gcsfuse/v2/internal/storage/mock"
@@ -52,7 +53,7 @@ func (t *UploadHandlerTest) SetupTest() {
 	var err error
 	t.blockPool, err = block.NewBlockPool(blockSize, maxBlocks, semaphore.NewWeighted(maxBlocks))
 	require.NoError(t.T(), err)
-	t.uh = newUploadHandler("testObject", t.mockBucket, maxBlocks, t.blockPool.FreeBlocksChannel(), blockSize)
+	t.uh = newUploadHandler("testObject", t.mockBucket, maxBlocks, t.blockPool.FreeBlocksChannel(), blockSize, "", false)
 }
 
 func (t *UploadHandlerTest) TestMultipleBlockUpload() {
@@ -130,6 +131,25 @@ func (t *UploadHandlerTest) TestFinalizeWithNoWriter() {
 	assert.Equal(t.T(), mockObj, obj)
 }
 
+func (t *UploadHandlerTest) TestCreateObjectWriterAppliesObjectDefaults() {
+	t.uh.objectDefaults = []cfg.ObjectDefaults{
+		{Glob: "other/**", StorageClass: "ARCHIVE"},
+		{Glob: "test*", StorageClass: "NEARLINE", Metadata: map[string]string{"team": "infra"}},
+	}
+	writer := &storagemock.Writer{}
+	t.mockBucket.On("CreateObjectChunkWriter", mock.Anything, mock.MatchedBy(func(req *gcs.CreateObjectRequest) bool {
+		return req.StorageClass == "NEARLINE" && req.Metadata["team"] == "infra"
+	}), mock.Anything, mock.Anything).Return(writer, nil)
+	mockObj := &gcs.Object{}
+	t.mockBucket.On("FinalizeUpload", mock.Anything, writer).Return(mockObj, nil)
+
+	obj, err := t.uh.Finalize()
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), mockObj, obj)
+	t.mockBucket.AssertExpectations(t.T())
+}
+
 func (t *UploadHandlerTest) TestFinalizeWithNoWriterWhenCreateObjectWriterFails() {
 	t.mockBucket.On("CreateObjectChunkWriter", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, fmt.Errorf("taco"))
 	assert.Nil(t.T(), t.uh.writer)
@@ -0,0 +1,135 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package data
+
+import "math/bits"
+
+// ChunkBitmap records which chunks of a fixed size of an object are present in
+// its sparse file in cache, the last one being shorter unless the chunk size
+// divides the object size.
+//
+// A ChunkBitmap is never modified once created, because copies of the
+// FileInfo holding it are shared by readers of the file info cache. With and
+// Without return modified copies instead.
+type ChunkBitmap struct {
+	chunkSize  uint64
+	objectSize uint64
+
+	// Bit i%64 of words[i/64] is set iff chunk i is present.
+	words []uint64
+
+	// The number of bits set in words.
+	count uint64
+}
+
+// NewChunkBitmap returns an empty bitmap for an object of the given size.
+//
+// REQUIRES: chunkSize > 0
+func NewChunkBitmap(chunkSize uint64, objectSize uint64) *ChunkBitmap {
+	numChunks := (objectSize + chunkSize - 1) / chunkSize
+	return &ChunkBitmap{
+		chunkSize:  chunkSize,
+		objectSize: objectSize,
+		words:      make([]uint64, (numChunks+63)/64),
+	}
+}
+
+// ChunkSize returns the size of all the chunks but the last.
+func (b *ChunkBitmap) ChunkSize() uint64 {
+	return b.chunkSize
+}
+
+// NumChunks returns the number of chunks of the object.
+func (b *ChunkBitmap) NumChunks() uint64 {
+	return (b.objectSize + b.chunkSize - 1) / b.chunkSize
+}
+
+// ChunkRange returns the range [start, end) of the object that chunk i spans.
+func (b *ChunkBitmap) ChunkRange(i uint64) (start uint64, end uint64) {
+	start = i * b.chunkSize
+	end = min(start+b.chunkSize, b.objectSize)
+	return
+}
+
+// Has tells whether chunk i is present.
+func (b *ChunkBitmap) Has(i uint64) bool {
+	return b.words[i/64]&(1<<(i%64)) != 0
+}
+
+// Contains tells whether all the chunks overlapping [start, end) are present.
+func (b *ChunkBitmap) Contains(start uint64, end uint64) bool {
+	if start >= end {
+		return true
+	}
+
+	for i := start / b.chunkSize; i <= (end-1)/b.chunkSize; i++ {
+		if !b.Has(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// With returns a copy of the bitmap with chunk i present.
+func (b *ChunkBitmap) With(i uint64) *ChunkBitmap {
+	if b.Has(i) {
+		return b
+	}
+
+	c := b.clone()
+	c.words[i/64] |= 1 << (i % 64)
+	c.count++
+	return c
+}
+
+// Without returns a copy of the bitmap with chunk i missing.
+func (b *ChunkBitmap) Without(i uint64) *ChunkBitmap {
+	if !b.Has(i) {
+		return b
+	}
+
+	c := b.clone()
+	c.words[i/64] &^= 1 << (i % 64)
+	c.count--
+	return c
+}
+
+// Chunks returns the indices of the chunks present, in increasing order.
+func (b *ChunkBitmap) Chunks() []uint64 {
+	chunks := make([]uint64, 0, b.count)
+	for w, word := range b.words {
+		for ; word != 0; word &= word - 1 {
+			chunks = append(chunks, uint64(w*64+bits.TrailingZeros64(word)))
+		}
+	}
+	return chunks
+}
+
+// Bytes returns the total size of the chunks present.
+func (b *ChunkBitmap) Bytes() uint64 {
+	size := b.count * b.chunkSize
+	if last := b.NumChunks() - 1; b.count > 0 && b.Has(last) {
+		start, end := b.ChunkRange(last)
+		size -= b.chunkSize - (end - start)
+	}
+	return size
+}
+
+func (b *ChunkBitmap) clone() *ChunkBitmap {
+	c := *b
+	c.words = make([]uint64, len(b.words))
+	copy(c.words, b.words)
+	return &c
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkBitmap_Empty(t *testing.T) {
+	b := NewChunkBitmap(10, 95)
+
+	assert.EqualValues(t, 10, b.NumChunks())
+	assert.False(t, b.Has(0))
+	assert.False(t, b.Contains(0, 1))
+	assert.True(t, b.Contains(5, 5))
+	assert.Empty(t, b.Chunks())
+	assert.Zero(t, b.Bytes())
+}
+
+func TestChunkBitmap_WithAndWithout(t *testing.T) {
+	b := NewChunkBitmap(10, 95)
+
+	c := b.With(1).With(2).With(70 / 10)
+
+	assert.False(t, b.Has(1), "the original bitmap is left unchanged")
+	assert.Equal(t, []uint64{1, 2, 7}, c.Chunks())
+	assert.EqualValues(t, 30, c.Bytes())
+	assert.True(t, c.Contains(10, 30))
+	assert.True(t, c.Contains(15, 16))
+	assert.False(t, c.Contains(15, 31))
+	assert.Same(t, c, c.With(2))
+
+	d := c.Without(2)
+
+	assert.True(t, c.Has(2))
+	assert.Equal(t, []uint64{1, 7}, d.Chunks())
+	assert.EqualValues(t, 20, d.Bytes())
+	assert.Same(t, d, d.Without(2))
+}
+
+func TestChunkBitmap_LastChunkIsShorter(t *testing.T) {
+	b := NewChunkBitmap(10, 95).With(9)
+
+	start, end := b.ChunkRange(9)
+
+	assert.EqualValues(t, 90, start)
+	assert.EqualValues(t, 95, end)
+	assert.EqualValues(t, 5, b.Bytes())
+	assert.True(t, b.Contains(90, 95))
+}
+
+func TestChunkBitmap_ManyChunks(t *testing.T) {
+	b := NewChunkBitmap(1, 200)
+	for _, i := range []uint64{0, 63, 64, 127, 199} {
+		b = b.With(i)
+	}
+
+	assert.Equal(t, []uint64{0, 63, 64, 127, 199}, b.Chunks())
+	assert.True(t, b.Contains(63, 65))
+	assert.False(t, b.Contains(62, 64))
+}
+
+func TestFileInfo_SizeOfSparseFile(t *testing.T) {
+	fi := FileInfo{FileSize: 95, Chunks: NewChunkBitmap(10, 95)}
+	assert.Zero(t, fi.Size())
+
+	fi.Chunks = fi.Chunks.With(3).With(9)
+
+	assert.EqualValues(t, 15, fi.Size())
+}
@@ -48,9 +48,22 @@ type FileInfo struct {
 	ObjectGeneration int64
 	Offset           uint64
 	FileSize         uint64
+
+	// Chunks is nil unless the object is cached as a sparse file, in which case
+	// it records the chunks downloaded and Offset is unused.
+	Chunks *ChunkBitmap
+
+	// CRC32C is the checksum of the object, recorded once it is fully
+	// downloaded so that the file can be checked when recovered from the index.
+	CRC32C *uint32
 }
 
+// Size returns the space that the file takes in cache: the size of the object,
+// or only that of its chunks downloaded for a sparse file.
 func (fi FileInfo) Size() uint64 {
+	if fi.Chunks != nil {
+		return fi.Chunks.Bytes()
+	}
 	return fi.FileSize
 }
 
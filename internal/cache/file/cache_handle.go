@@ -92,11 +92,12 @@ func (fch *CacheHandle) shouldReadFromCache(jobStatus *downloader.JobStatus, req
 }
 
 // validateEntryInFileInfoCache checks if entry is present for a given object in
-// file info cache with same generation and at least requiredOffset.
+// file info cache with same generation and at least requiredOffset, or with the
+// chunks spanning [startOffset, requiredOffset) for a sparse file.
 // It returns nil if entry is present, otherwise returns an appropriate error.
 // Whether to change the order in cache while lookup is controlled via
 // changeCacheOrder.
-func (fch *CacheHandle) validateEntryInFileInfoCache(bucket gcs.Bucket, object *gcs.MinObject, requiredOffset uint64, changeCacheOrder bool) error {
+func (fch *CacheHandle) validateEntryInFileInfoCache(bucket gcs.Bucket, object *gcs.MinObject, startOffset uint64, requiredOffset uint64, changeCacheOrder bool) error {
 	fileInfoKey := data.FileInfoKey{
 		BucketName: bucket.Name(),
 		ObjectName: object.Name,
@@ -125,7 +126,12 @@ func (fch *CacheHandle) validateEntryInFileInfoCache(bucket gcs.Bucket, object *
 		err = fmt.Errorf("%v: generation of cached object: %v is different from required generation: %v", util.InvalidFileInfoCacheErrMsg, fileInfoData.ObjectGeneration, object.Generation)
 		return err
 	}
-	if fileInfoData.Offset < requiredOffset {
+	if fileInfoData.Chunks != nil {
+		if !fileInfoData.Chunks.Contains(startOffset, requiredOffset) {
+			err = fmt.Errorf("%v chunks of cached object don't span the required range [%v, %v)", util.InvalidFileInfoCacheErrMsg, startOffset, requiredOffset)
+			return err
+		}
+	} else if fileInfoData.Offset < requiredOffset {
 		err = fmt.Errorf("%v offset of cached object: %v is less than required offset %v", util.InvalidFileInfoCacheErrMsg, fileInfoData.Offset, requiredOffset)
 		return err
 	}
@@ -167,29 +173,39 @@ func (fch *CacheHandle) Read(ctx context.Context, bucket gcs.Bucket, object *gcs
 		requiredOffset = objSize
 	}
 
+	// Whether the range read was downloaded ahead of the offset of the job.
+	downloadedAhead := false
+
 	// If fileDownloadJob is not nil, it's better to get status of cache file
 	// from the job itself than to use file info cache.
-	if fch.fileDownloadJob != nil {
+	if fch.fileDownloadJob != nil && fch.fileDownloadJob.IsSparse() {
+		// A sparse file is downloaded as it's read, whatever the type of read.
+		fch.prevOffset = offset
+		cacheHit, err = fch.fileDownloadJob.DownloadRange(ctx, offset, requiredOffset)
+		if err != nil {
+			err = fmt.Errorf("read: while downloading through job: %w", err)
+			return 0, false, err
+		}
+	} else if fch.fileDownloadJob != nil {
 		jobStatus := fch.fileDownloadJob.GetStatus()
+		// With parallel downloads, the range read may have been downloaded ahead
+		// of the offset of the job.
+		cacheHit = fch.fileDownloadJob.IsDownloaded(offset, requiredOffset)
 		// If cacheFileForRangeRead is false and readType is random, download will
 		// not be initiated.
-		if !fch.cacheFileForRangeRead && !isSequentialRead {
+		if !fch.cacheFileForRangeRead && !isSequentialRead && !cacheHit {
 			if err = fch.shouldReadFromCache(&jobStatus, requiredOffset); err != nil {
 				return 0, false, err
 			}
 		}
 
-		if jobStatus.Offset >= requiredOffset {
-			cacheHit = true
-		}
-
 		fch.prevOffset = offset
 
 		if fch.fileDownloadJob.IsParallelDownloadsEnabled() {
 			waitForDownload = false
 		}
 
-		jobStatus, err = fch.fileDownloadJob.Download(ctx, requiredOffset, waitForDownload)
+		jobStatus, err = fch.fileDownloadJob.DownloadFrom(ctx, offset, requiredOffset, waitForDownload)
 		if err != nil {
 			n = 0
 			cacheHit = false
@@ -197,14 +213,16 @@ func (fch *CacheHandle) Read(ctx context.Context, bucket gcs.Bucket, object *gcs
 			return
 		}
 
-		if err = fch.shouldReadFromCache(&jobStatus, requiredOffset); err != nil {
+		if jobStatus.Offset < requiredOffset && fch.fileDownloadJob.IsDownloaded(offset, requiredOffset) {
+			downloadedAhead = true
+		} else if err = fch.shouldReadFromCache(&jobStatus, requiredOffset); err != nil {
 			return 0, false, err
 		}
 	} else {
 		// If fileDownloadJob is nil then it means either the job is successfully
 		// completed or failed. The offset must be equal to size of object for job
 		// to be completed.
-		err = fch.validateEntryInFileInfoCache(bucket, object, object.Size, false)
+		err = fch.validateEntryInFileInfoCache(bucket, object, 0, object.Size, false)
 		if err != nil {
 			return 0, false, err
 		}
@@ -232,10 +250,22 @@ func (fch *CacheHandle) Read(ctx context.Context, bucket gcs.Bucket, object *gcs
 		return 0, false, err
 	}
 
+	// The file info cache only records the offset the job has downloaded till
+	// contiguously, so it is up to the job to tell that a range downloaded
+	// ahead of it hasn't been evicted in the meantime.
+	cachedOffset := uint64(requiredOffset)
+	if downloadedAhead {
+		if !fch.fileDownloadJob.IsDownloaded(offset, requiredOffset) {
+			err = fmt.Errorf("%s: range [%d, %d) is no longer in cache", util.InvalidFileDownloadJobErrMsg, offset, requiredOffset)
+			return 0, false, err
+		}
+		cachedOffset = 0
+	}
+
 	// Look up of file being read in file info cache is required to update the LRU
 	// order on every read request from kernel i.e. with every read request from
 	// kernel, the file being read becomes most recently used.
-	err = fch.validateEntryInFileInfoCache(bucket, object, uint64(requiredOffset), true)
+	err = fch.validateEntryInFileInfoCache(bucket, object, uint64(offset), cachedOffset, true)
 	if err != nil {
 		return 0, false, err
 	}
@@ -366,7 +366,7 @@ func (cht *cacheHandleTest) Test_validateEntryInFileInfoCache_FileInfoPresent()
 	_, err = cht.cache.Insert(fileInfoKeyName, fileInfo)
 	assert.Nil(cht.T(), err)
 
-	err = cht.cacheHandle.validateEntryInFileInfoCache(cht.bucket, cht.object, cht.object.Size, false)
+	err = cht.cacheHandle.validateEntryInFileInfoCache(cht.bucket, cht.object, 0, cht.object.Size, false)
 
 	assert.Nil(cht.T(), err)
 }
@@ -380,7 +380,7 @@ func (cht *cacheHandleTest) Test_validateEntryInFileInfoCache_FileInfoNotPresent
 	assert.Nil(cht.T(), err)
 
 	_ = cht.cache.Erase(fileInfoKeyName)
-	err = cht.cacheHandle.validateEntryInFileInfoCache(cht.bucket, cht.object, 0, false)
+	err = cht.cacheHandle.validateEntryInFileInfoCache(cht.bucket, cht.object, 0, 0, false)
 
 	expectedErr := fmt.Errorf("%v: no entry found in file info cache for key %v", util.InvalidFileInfoCacheErrMsg, fileInfoKeyName)
 	assert.True(cht.T(), strings.Contains(err.Error(), expectedErr.Error()))
@@ -402,7 +402,7 @@ func (cht *cacheHandleTest) Test_validateEntryInFileInfoCache_FileInfoGeneration
 	_, err = cht.cache.Insert(fileInfoKeyName, fileInfo)
 	assert.Nil(cht.T(), err)
 
-	err = cht.cacheHandle.validateEntryInFileInfoCache(cht.bucket, cht.object, cht.object.Size-1, true)
+	err = cht.cacheHandle.validateEntryInFileInfoCache(cht.bucket, cht.object, 0, cht.object.Size-1, true)
 
 	expectedErr := fmt.Errorf("%v: generation of cached object: %v is different from required generation: ", util.InvalidFileInfoCacheErrMsg, fileInfo.ObjectGeneration)
 	assert.True(cht.T(), strings.Contains(err.Error(), expectedErr.Error()))
@@ -424,7 +424,7 @@ func (cht *cacheHandleTest) Test_validateEntryInFileInfoCache_FileInfoOffsetLess
 	_, err = cht.cache.Insert(fileInfoKeyName, fileInfo)
 	assert.Nil(cht.T(), err)
 
-	err = cht.cacheHandle.validateEntryInFileInfoCache(cht.bucket, cht.object, 11, true)
+	err = cht.cacheHandle.validateEntryInFileInfoCache(cht.bucket, cht.object, 0, 11, true)
 
 	assert.NotNil(cht.T(), err)
 	expectedErr := fmt.Errorf("%v offset of cached object: %v is less than required offset %v", util.InvalidFileInfoCacheErrMsg, 10, 11)
@@ -454,7 +454,7 @@ func (cht *cacheHandleTest) Test_validateEntryInFileInfoCache_changeCacheOrderIs
 
 	// Because changeCacheOrder is true, the entry corresponding to cht.object.Size
 	// should come on top
-	err = cht.cacheHandle.validateEntryInFileInfoCache(cht.bucket, cht.object, 0, true)
+	err = cht.cacheHandle.validateEntryInFileInfoCache(cht.bucket, cht.object, 0, 0, true)
 
 	assert.Nil(cht.T(), err)
 	// Inserting new entry should evict the newObjectName
@@ -498,7 +498,7 @@ func (cht *cacheHandleTest) Test_validateEntryInFileInfoCache_changeCacheOrderIs
 	assert.Equal(cht.T(), 0, len(evictedEntries))
 
 	// Because changeCacheOrder is false, the new object entry should remain on top.
-	err = cht.cacheHandle.validateEntryInFileInfoCache(cht.bucket, cht.object, 0, false)
+	err = cht.cacheHandle.validateEntryInFileInfoCache(cht.bucket, cht.object, 0, 0, false)
 
 	assert.Nil(cht.T(), err)
 	// Inserting new entry should evict the entry corresponding to cht.object.
@@ -51,17 +51,31 @@ type CacheHandler struct {
 
 	// mu guards the handling of insertion into and eviction from file cache.
 	mu locker.Locker
+
+	// Whether Destroy writes the index of the file cache, see RecoverIndex.
+	//
+	// GUARDED_BY(mu)
+	persistIndex bool
+
+	// The keys of the entries recovered from the index that haven't been looked
+	// up since, whose files have no download job yet nor have been checksummed.
+	//
+	// GUARDED_BY(mu)
+	recovered map[string]struct{}
 }
 
 func NewCacheHandler(fileInfoCache *lru.Cache, jobManager *downloader.JobManager, cacheDir string, filePerm os.FileMode, dirPerm os.FileMode) *CacheHandler {
-	return &CacheHandler{
+	chr := &CacheHandler{
 		fileInfoCache: fileInfoCache,
 		jobManager:    jobManager,
 		cacheDir:      cacheDir,
 		filePerm:      filePerm,
 		dirPerm:       dirPerm,
 		mu:            locker.New("FileCacheHandler", func() {}),
+		recovered:     make(map[string]struct{}),
 	}
+	jobManager.SetEvictionCallback(chr.cleanUpEvictedSparseFiles)
+	return chr
 }
 
 func (chr *CacheHandler) createLocalFileReadHandle(objectName string, bucketName string) (*os.File, error) {
@@ -79,10 +93,11 @@ func (chr *CacheHandler) createLocalFileReadHandle(objectName string, bucketName
 // and deletes the file in cache.
 func (chr *CacheHandler) cleanUpEvictedFile(fileInfo *data.FileInfo) error {
 	key := fileInfo.Key
-	_, err := key.Key()
+	keyName, err := key.Key()
 	if err != nil {
 		return fmt.Errorf("cleanUpEvictedFile: while creating key: %w", err)
 	}
+	delete(chr.recovered, keyName)
 
 	chr.jobManager.InvalidateAndRemoveJob(key.ObjectName, key.BucketName)
 
@@ -99,6 +114,34 @@ func (chr *CacheHandler) cleanUpEvictedFile(fileInfo *data.FileInfo) error {
 	return nil
 }
 
+// cleanUpEvictedSparseFiles cleans up the entries evicted from fileInfoCache as
+// sparse files grew. Unlike the entries evicted by this handler, they are
+// evicted without Lock(chr.mu), so an entry may have been added afresh for the
+// same object in between, in which case the file and job are in use again and
+// must be kept.
+//
+// Acquires and releases Lock(chr.mu)
+func (chr *CacheHandler) cleanUpEvictedSparseFiles(evicted []lru.ValueType) {
+	chr.mu.Lock()
+	defer chr.mu.Unlock()
+
+	for _, val := range evicted {
+		fileInfo := val.(data.FileInfo)
+		fileInfoKeyName, err := fileInfo.Key.Key()
+		if err != nil {
+			logger.Errorf("cleanUpEvictedSparseFiles: while creating key: %v", err)
+			continue
+		}
+		if chr.fileInfoCache.LookUpWithoutChangingOrder(fileInfoKeyName) != nil {
+			continue
+		}
+
+		if err = chr.cleanUpEvictedFile(&fileInfo); err != nil {
+			logger.Errorf("cleanUpEvictedSparseFiles: while performing post eviction of %s object error: %v", fileInfo.Key.ObjectName, err)
+		}
+	}
+}
+
 // addFileInfoEntryAndCreateDownloadJob adds data.FileInfo entry for the given
 // object and bucket in the file info cache and creates download job if they do
 // not already exist. It also cleans up for entries that are evicted at the time
@@ -137,10 +180,27 @@ func (chr *CacheHandler) addFileInfoEntryAndCreateDownloadJob(object *gcs.MinObj
 		// https://cloud.google.com/storage/docs/metadata#generation-number)
 		// Also, invalidate the cache if download job has failed or not invalid.
 		fileInfoData := fileInfo.(data.FileInfo)
+		existingJob := chr.jobManager.GetJob(object.Name, bucket.Name())
+		// A file recovered from the index that isn't fully downloaded has no
+		// download job, but the download can be resumed if the object is the same.
+		_, recovered := chr.recovered[fileInfoKeyName]
+		delete(chr.recovered, fileInfoKeyName)
+		if recovered && existingJob == nil && fileInfoData.ObjectGeneration == object.Generation &&
+			(fileInfoData.Offset < object.Size || fileInfoData.Chunks != nil) {
+			existingJob = chr.jobManager.CreateJobIfNotExists(object, bucket)
+			existingJob.Resume(fileInfoData)
+		}
 		// If offset in file info cache is less than object size and there is no
 		// reference to download job then it means the job has failed.
-		existingJob := chr.jobManager.GetJob(object.Name, bucket.Name())
 		shouldInvalidate := (existingJob == nil) && (fileInfoData.Offset < object.Size)
+		// A fully downloaded file recovered from the index is checksummed once,
+		// when first read, and downloaded again if it changed since.
+		if recovered && !shouldInvalidate && fileInfoData.ObjectGeneration == object.Generation {
+			if err = checkRecoveredChecksum(filePath, fileInfoData); err != nil {
+				logger.Warnf("addFileInfoEntryAndCreateDownloadJob: invalidating %s: %v", filePath, err)
+				shouldInvalidate = true
+			}
+		}
 		if (!shouldInvalidate) && (existingJob != nil) {
 			existingJobStatus := existingJob.GetStatus().Name
 			shouldInvalidate = (existingJobStatus == downloader.Failed) || (existingJobStatus == downloader.Invalid)
@@ -159,12 +219,17 @@ func (chr *CacheHandler) addFileInfoEntryAndCreateDownloadJob(object *gcs.MinObj
 	}
 
 	if addEntryToCache {
-		fileInfo = data.FileInfo{
+		newFileInfo := data.FileInfo{
 			Key:              fileInfoKey,
 			ObjectGeneration: object.Generation,
 			Offset:           0,
 			FileSize:         object.Size,
 		}
+		// A sparse file takes no space in cache until chunks are downloaded.
+		if chunkSize := chr.jobManager.SparseChunkSize(); chunkSize > 0 {
+			newFileInfo.Chunks = data.NewChunkBitmap(chunkSize, object.Size)
+		}
+		fileInfo = newFileInfo
 
 		evictedValues, err := chr.fileInfoCache.Insert(fileInfoKeyName, fileInfo)
 		if err != nil {
@@ -195,7 +260,8 @@ func (chr *CacheHandler) addFileInfoEntryAndCreateDownloadJob(object *gcs.MinObj
 // tasks are completed in one uninterrupted sequence guarded by (CacheHandler.mu).
 // Note: It returns nil if cacheForRangeRead is set to False, initialOffset is
 // non-zero (i.e. random read) and entry for file doesn't already exist in
-// fileInfoCache then no need to create file in cache.
+// fileInfoCache then no need to create file in cache. That doesn't apply to
+// sparse files, which only cache what is read.
 //
 // Acquires and releases LOCK(CacheHandler.mu)
 func (chr *CacheHandler) GetCacheHandle(object *gcs.MinObject, bucket gcs.Bucket, cacheForRangeRead bool, initialOffset int64) (*CacheHandle, error) {
@@ -205,7 +271,7 @@ func (chr *CacheHandler) GetCacheHandle(object *gcs.MinObject, bucket gcs.Bucket
 	// If cacheForRangeRead is set to False, initialOffset is non-zero (i.e. random read)
 	// and entry for file doesn't already exist in fileInfoCache then no need to
 	// create file in cache.
-	if !cacheForRangeRead && initialOffset != 0 {
+	if !cacheForRangeRead && initialOffset != 0 && chr.jobManager.SparseChunkSize() == 0 {
 		fileInfoKey := data.FileInfoKey{
 			BucketName: bucket.Name(),
 			ObjectName: object.Name,
@@ -265,6 +331,8 @@ func (chr *CacheHandler) InvalidateCache(objectName string, bucketName string) e
 // Destroy destroys the job manager (i.e. invalidate all the jobs).
 // Note: This method is expected to be called at the time of unmounting and
 // because file info cache is in-memory, it is not required to destroy it.
+// Once RecoverIndex has been called, it writes the index of the file cache
+// though, with the offsets the jobs stopped at.
 //
 // Acquires and releases Lock(chr.mu)
 func (chr *CacheHandler) Destroy() (err error) {
@@ -272,5 +340,8 @@ func (chr *CacheHandler) Destroy() (err error) {
 	defer chr.mu.Unlock()
 
 	chr.jobManager.Destroy()
+	if chr.persistIndex {
+		err = chr.writeIndex()
+	}
 	return
 }
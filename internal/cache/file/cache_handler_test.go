@@ -15,6 +15,7 @@
 package file
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"os"
@@ -1041,3 +1042,202 @@ func Test_Destroy(t *testing.T) {
 		})
 	}
 }
+
+// newCacheHandlerAfterRemount returns a cache handler over the cache directory
+// of chTestArgs with an empty file info cache, as after a remount.
+func newCacheHandlerAfterRemount(t *testing.T, chTestArgs *cacheHandlerTestArgs, fileCacheConfig *cfg.FileCacheConfig) (*CacheHandler, *lru.Cache) {
+	t.Helper()
+	cache := lru.NewCache(HandlerCacheMaxSize)
+	jobManager := downloader.NewJobManager(cache, util.DefaultFilePerm, util.DefaultDirPerm, chTestArgs.cacheDir, DefaultSequentialReadSizeMb, fileCacheConfig, common.NewNoopMetrics())
+	return NewCacheHandler(cache, jobManager, chTestArgs.cacheDir, util.DefaultFilePerm, util.DefaultDirPerm), cache
+}
+
+func Test_RecoverIndex(t *testing.T) {
+	fileCacheConfig := &cfg.FileCacheConfig{EnableCrc: true}
+	chTestArgs := initializeCacheHandlerTestArgs(t, fileCacheConfig, t.TempDir())
+	require.NoError(t, chTestArgs.cacheHandler.RecoverIndex())
+	content := []byte("content of object_1")
+	minObject1 := createObject(t, chTestArgs.bucket, "object_1", content)
+	cacheHandle, err := chTestArgs.cacheHandler.GetCacheHandle(minObject1, chTestArgs.bucket, true, 0)
+	require.NoError(t, err)
+	buf := make([]byte, len(content))
+	_, _, err = cacheHandle.Read(context.Background(), chTestArgs.bucket, minObject1, 0, buf)
+	require.NoError(t, err)
+	require.NoError(t, cacheHandle.Close())
+	require.NoError(t, chTestArgs.cacheHandler.Destroy())
+	cacheHandler, cache := newCacheHandlerAfterRemount(t, chTestArgs, fileCacheConfig)
+
+	err = cacheHandler.RecoverIndex()
+
+	require.NoError(t, err)
+	_, err = os.Stat(path.Join(chTestArgs.cacheDir, util.FileCacheIndex))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	values := cache.Values()
+	require.Len(t, values, 2)
+	// The test object was never downloaded, and object_1 was used last.
+	assert.Equal(t, chTestArgs.object.Name, values[0].(data.FileInfo).Key.ObjectName)
+	assert.EqualValues(t, 0, values[0].(data.FileInfo).Offset)
+	assert.Equal(t, minObject1.Name, values[1].(data.FileInfo).Key.ObjectName)
+	assert.Equal(t, minObject1.Generation, values[1].(data.FileInfo).ObjectGeneration)
+	assert.Equal(t, minObject1.Size, values[1].(data.FileInfo).Offset)
+	cacheHandle, err = cacheHandler.GetCacheHandle(minObject1, chTestArgs.bucket, true, 0)
+	require.NoError(t, err)
+	buf = make([]byte, len(content))
+	_, cacheHit, err := cacheHandle.Read(context.Background(), chTestArgs.bucket, minObject1, 0, buf)
+	require.NoError(t, err)
+	assert.True(t, cacheHit)
+	assert.Equal(t, content, buf)
+	assert.NoError(t, cacheHandle.Close())
+}
+
+func Test_RecoverIndex_ResumesPartialDownload(t *testing.T) {
+	fileCacheConfig := &cfg.FileCacheConfig{}
+	chTestArgs := initializeCacheHandlerTestArgs(t, fileCacheConfig, t.TempDir())
+	require.NoError(t, chTestArgs.cacheHandler.RecoverIndex())
+	// Leave the first MiB of the test object in cache, but not what the object
+	// holds, so that it can be told whether it is downloaded again.
+	fileInfo := chTestArgs.cache.LookUp(chTestArgs.fileInfoKeyName).(data.FileInfo)
+	fileInfo.Offset = util.MiB
+	require.NoError(t, chTestArgs.cache.UpdateWithoutChangingOrder(chTestArgs.fileInfoKeyName, fileInfo))
+	require.NoError(t, os.WriteFile(chTestArgs.downloadPath, make([]byte, util.MiB), util.DefaultFilePerm))
+	require.NoError(t, chTestArgs.cacheHandler.Destroy())
+	cacheHandler, _ := newCacheHandlerAfterRemount(t, chTestArgs, fileCacheConfig)
+	require.NoError(t, cacheHandler.RecoverIndex())
+
+	cacheHandle, err := cacheHandler.GetCacheHandle(chTestArgs.object, chTestArgs.bucket, true, 0)
+
+	require.NoError(t, err)
+	buf := make([]byte, util.MiB)
+	_, cacheHit, err := cacheHandle.Read(context.Background(), chTestArgs.bucket, chTestArgs.object, 0, buf)
+	require.NoError(t, err)
+	assert.True(t, cacheHit)
+	assert.Equal(t, make([]byte, util.MiB), buf)
+	_, _, err = cacheHandle.Read(context.Background(), chTestArgs.bucket, chTestArgs.object, util.MiB, buf)
+	require.NoError(t, err)
+	assert.NotEqual(t, make([]byte, util.MiB), buf)
+	assert.NoError(t, cacheHandle.Close())
+}
+
+func Test_RecoverIndex_DropsEntryOfChangedObject(t *testing.T) {
+	fileCacheConfig := &cfg.FileCacheConfig{EnableCrc: true}
+	chTestArgs := initializeCacheHandlerTestArgs(t, fileCacheConfig, t.TempDir())
+	require.NoError(t, chTestArgs.cacheHandler.RecoverIndex())
+	minObject1 := createObject(t, chTestArgs.bucket, "object_1", []byte("content of object_1"))
+	cacheHandle, err := chTestArgs.cacheHandler.GetCacheHandle(minObject1, chTestArgs.bucket, true, 0)
+	require.NoError(t, err)
+	buf := make([]byte, minObject1.Size)
+	_, _, err = cacheHandle.Read(context.Background(), chTestArgs.bucket, minObject1, 0, buf)
+	require.NoError(t, err)
+	require.NoError(t, cacheHandle.Close())
+	require.NoError(t, chTestArgs.cacheHandler.Destroy())
+	cacheHandler, _ := newCacheHandlerAfterRemount(t, chTestArgs, fileCacheConfig)
+	require.NoError(t, cacheHandler.RecoverIndex())
+	content := []byte("new content of object_1")
+	minObject1 = createObject(t, chTestArgs.bucket, "object_1", content)
+
+	cacheHandle, err = cacheHandler.GetCacheHandle(minObject1, chTestArgs.bucket, true, 0)
+
+	require.NoError(t, err)
+	buf = make([]byte, len(content))
+	_, cacheHit, err := cacheHandle.Read(context.Background(), chTestArgs.bucket, minObject1, 0, buf)
+	require.NoError(t, err)
+	assert.False(t, cacheHit)
+	assert.Equal(t, content, buf)
+	assert.NoError(t, cacheHandle.Close())
+}
+
+func Test_RecoverIndex_DropsEntryOfTruncatedFile(t *testing.T) {
+	fileCacheConfig := &cfg.FileCacheConfig{}
+	chTestArgs := initializeCacheHandlerTestArgs(t, fileCacheConfig, t.TempDir())
+	require.NoError(t, chTestArgs.cacheHandler.RecoverIndex())
+	fileInfo := chTestArgs.cache.LookUp(chTestArgs.fileInfoKeyName).(data.FileInfo)
+	fileInfo.Offset = util.MiB
+	require.NoError(t, chTestArgs.cache.UpdateWithoutChangingOrder(chTestArgs.fileInfoKeyName, fileInfo))
+	require.NoError(t, os.WriteFile(chTestArgs.downloadPath, make([]byte, util.MiB/2), util.DefaultFilePerm))
+	require.NoError(t, chTestArgs.cacheHandler.Destroy())
+	cacheHandler, cache := newCacheHandlerAfterRemount(t, chTestArgs, fileCacheConfig)
+
+	err := cacheHandler.RecoverIndex()
+
+	require.NoError(t, err)
+	assert.Empty(t, cache.Values())
+	assert.False(t, doesFileExist(t, chTestArgs.downloadPath))
+}
+
+func Test_RecoverIndex_ChecksSparseChunksAreData(t *testing.T) {
+	fileCacheConfig := &cfg.FileCacheConfig{ExperimentalEnableSparseFile: true, SparseChunkSizeMb: 1}
+	tbl := []struct {
+		name     string
+		write    func(f *os.File) error
+		expected bool
+	}{
+		{
+			name: "Data",
+			write: func(f *os.File) error {
+				_, err := f.WriteAt(bytes.Repeat([]byte{1}, util.MiB), util.MiB)
+				return err
+			},
+			expected: true,
+		},
+		{
+			name: "Hole",
+			write: func(f *os.File) error {
+				return nil
+			},
+			expected: false,
+		},
+	}
+	for _, tc := range tbl {
+		t.Run(tc.name, func(t *testing.T) {
+			chTestArgs := initializeCacheHandlerTestArgs(t, fileCacheConfig, t.TempDir())
+			require.NoError(t, chTestArgs.cacheHandler.RecoverIndex())
+			fileInfo := chTestArgs.cache.LookUp(chTestArgs.fileInfoKeyName).(data.FileInfo)
+			fileInfo.Chunks = data.NewChunkBitmap(util.MiB, fileInfo.FileSize).With(1)
+			_, err := chTestArgs.cache.Update(chTestArgs.fileInfoKeyName, fileInfo)
+			require.NoError(t, err)
+			f, err := os.OpenFile(chTestArgs.downloadPath, os.O_WRONLY, 0)
+			require.NoError(t, err)
+			require.NoError(t, tc.write(f))
+			require.NoError(t, f.Truncate(2*util.MiB))
+			require.NoError(t, f.Close())
+			require.NoError(t, chTestArgs.cacheHandler.Destroy())
+			cacheHandler, cache := newCacheHandlerAfterRemount(t, chTestArgs, fileCacheConfig)
+
+			err = cacheHandler.RecoverIndex()
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, len(cache.Values()) == 1)
+			assert.Equal(t, tc.expected, doesFileExist(t, chTestArgs.downloadPath))
+		})
+	}
+}
+
+func Test_RecoverIndex_ChecksumsFileWhenFirstRead(t *testing.T) {
+	fileCacheConfig := &cfg.FileCacheConfig{}
+	chTestArgs := initializeCacheHandlerTestArgs(t, fileCacheConfig, t.TempDir())
+	require.NoError(t, chTestArgs.cacheHandler.RecoverIndex())
+	content := []byte("content of object_1")
+	minObject1 := createObject(t, chTestArgs.bucket, "object_1", content)
+	cacheHandle, err := chTestArgs.cacheHandler.GetCacheHandle(minObject1, chTestArgs.bucket, true, 0)
+	require.NoError(t, err)
+	buf := make([]byte, len(content))
+	_, _, err = cacheHandle.Read(context.Background(), chTestArgs.bucket, minObject1, 0, buf)
+	require.NoError(t, err)
+	require.NoError(t, cacheHandle.Close())
+	require.NoError(t, chTestArgs.cacheHandler.Destroy())
+	cacheHandler, _ := newCacheHandlerAfterRemount(t, chTestArgs, fileCacheConfig)
+	require.NoError(t, cacheHandler.RecoverIndex())
+	// Corrupt the file, keeping its size.
+	downloadPath := util.GetDownloadPath(chTestArgs.cacheDir, util.GetObjectPath(chTestArgs.bucket.Name(), minObject1.Name))
+	require.NoError(t, os.WriteFile(downloadPath, make([]byte, len(content)), util.DefaultFilePerm))
+
+	cacheHandle, err = cacheHandler.GetCacheHandle(minObject1, chTestArgs.bucket, true, 0)
+
+	require.NoError(t, err)
+	buf = make([]byte, len(content))
+	_, cacheHit, err := cacheHandle.Read(context.Background(), chTestArgs.bucket, minObject1, 0, buf)
+	require.NoError(t, err)
+	assert.False(t, cacheHit)
+	assert.Equal(t, content, buf)
+	assert.NoError(t, cacheHandle.Close())
+}
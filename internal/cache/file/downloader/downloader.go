@@ -62,6 +62,10 @@ type JobManager struct {
 	mu                locker.Locker
 	maxParallelismSem *semaphore.Weighted
 	metricHandle      common.MetricHandle
+
+	// evictionCallback is passed to Job created by JobManager, to clean up the
+	// entries of the file info cache that sparse files evict as they grow.
+	evictionCallback func(evicted []lru.ValueType)
 }
 
 func NewJobManager(fileInfoCache *lru.Cache, filePerm os.FileMode, dirPerm os.FileMode,
@@ -87,6 +91,22 @@ func NewJobManager(fileInfoCache *lru.Cache, filePerm os.FileMode, dirPerm os.Fi
 	return
 }
 
+// SetEvictionCallback sets the function that cleans up the entries of the file
+// info cache evicted by jobs created afterwards to make room for chunks of
+// sparse files. It is called without any lock of the job manager or the jobs.
+func (jm *JobManager) SetEvictionCallback(evictionCallback func(evicted []lru.ValueType)) {
+	jm.evictionCallback = evictionCallback
+}
+
+// SparseChunkSize returns the size of the chunks in which jobs download objects
+// into sparse files, or zero if they download whole objects.
+func (jm *JobManager) SparseChunkSize() uint64 {
+	if !jm.fileCacheConfig.ExperimentalEnableSparseFile {
+		return 0
+	}
+	return uint64(jm.fileCacheConfig.SparseChunkSizeMb) * util.MiB
+}
+
 // removeJob is a helper function to remove downloader.Job for given object and
 // bucket from jm.jobs if present. It is passed as callback function to job so
 // that job can remove itself after completion/failure/invalidation.
@@ -119,6 +139,7 @@ func (jm *JobManager) CreateJobIfNotExists(object *gcs.MinObject, bucket gcs.Buc
 		jm.removeJob(object.Name, bucket.Name())
 	}
 	job = NewJob(object, bucket, jm.fileInfoCache, jm.sequentialReadSizeMb, fileSpec, removeJobCallback, jm.fileCacheConfig, jm.maxParallelismSem, jm.metricHandle)
+	job.evictionCallback = jm.evictionCallback
 	jm.jobs[objectPath] = job
 	return job
 }
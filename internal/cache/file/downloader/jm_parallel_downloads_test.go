@@ -224,3 +224,128 @@ func TestMultipleConcurrentDownloads(t *testing.T) {
 		}
 	}
 }
+
+func TestParallelDownloads_PrioritizesRangeReadFirst(t *testing.T) {
+	t.Parallel()
+	storageHandle := configureFakeStorage(t)
+	cache, cacheDir := configureCache(t, 40*util.MiB)
+	ctx := context.Background()
+	bucket := storageHandle.BucketHandle(ctx, storage.TestBucketName, "")
+	minObj, content := createObjectInStoreAndInitCache(t, cache, bucket, "path/in/gcs/foo.txt", 20*util.MiB)
+	fileCacheConfig := &cfg.FileCacheConfig{
+		EnableParallelDownloads:  true,
+		ParallelDownloadsPerFile: 1,
+		DownloadChunkSizeMb:      1,
+		EnableCrc:                true,
+		MaxParallelDownloads:     1,
+		WriteBufferSize:          4 * 1024 * 1024,
+	}
+	jm := NewJobManager(cache, util.DefaultFilePerm, util.DefaultDirPerm, cacheDir, 2, fileCacheConfig, common.NewNoopMetrics())
+	job := jm.CreateJobIfNotExists(&minObj, bucket)
+	fileSpec := data.FileSpec{Path: util.GetDownloadPath(path.Join(cacheDir, storage.TestBucketName), "path/in/gcs/foo.txt"), FilePerm: util.DefaultFilePerm, DirPerm: util.DefaultDirPerm}
+
+	jobStatus, err := job.DownloadFrom(ctx, 15*util.MiB+10, 16*util.MiB+10, true)
+
+	require.NoError(t, err)
+	// With a single goroutine, the chunks spanning the range are downloaded
+	// before the first one.
+	assert.EqualValues(t, 0, jobStatus.Offset)
+	assert.True(t, job.IsDownloaded(15*util.MiB+10, 16*util.MiB+10))
+	file, err := os.ReadFile(fileSpec.Path)
+	require.NoError(t, err)
+	assert.Equal(t, content[15*util.MiB:17*util.MiB], file[15*util.MiB:17*util.MiB])
+
+	jobStatus, err = job.Download(ctx, 20*util.MiB, true)
+
+	require.NoError(t, err)
+	assert.EqualValues(t, 20*util.MiB, jobStatus.Offset)
+	verifyFileTillOffset(t, fileSpec, 20*util.MiB, content)
+}
+
+func TestParallelDownloads_PrioritizeSkipsChunksHandedOut(t *testing.T) {
+	cache, cacheDir := configureCache(t, 40*util.MiB)
+	bucket := configureFakeStorage(t).BucketHandle(context.Background(), storage.TestBucketName, "")
+	minObj, _ := createObjectInStoreAndInitCache(t, cache, bucket, "path/in/gcs/foo.txt", 10*util.MiB+5)
+	fileCacheConfig := &cfg.FileCacheConfig{
+		EnableParallelDownloads: true,
+		DownloadChunkSizeMb:     2,
+	}
+	jm := NewJobManager(cache, util.DefaultFilePerm, util.DefaultDirPerm, cacheDir, 2, fileCacheConfig, common.NewNoopMetrics())
+	job := jm.CreateJobIfNotExists(&minObj, bucket)
+	job.scheduledChunks = make([]bool, 6)
+	job.scheduledChunks[0] = true
+	job.scheduledChunks[4] = true
+
+	job.prioritize(7*util.MiB, 7*util.MiB+1)
+	job.prioritize(util.MiB, 3*util.MiB)
+
+	assert.Equal(t, []int64{3, 5, 1, 2}, job.prioritizedChunks)
+	var next int64
+	for _, expected := range []int64{3, 5, 1, 2, 6} {
+		i := job.nextChunk(&next)
+		assert.Equal(t, expected, i)
+		if i < 6 {
+			job.scheduledChunks[i] = true
+		}
+	}
+	assert.Empty(t, job.prioritizedChunks)
+}
+
+func TestParallelDownloads_Resumed(t *testing.T) {
+	cache, cacheDir := configureCache(t, 40*util.MiB)
+	ctx := context.Background()
+	bucket := configureFakeStorage(t).BucketHandle(ctx, storage.TestBucketName, "")
+	minObj, content := createObjectInStoreAndInitCache(t, cache, bucket, "path/in/gcs/foo.txt", 10*util.MiB)
+	fileCacheConfig := &cfg.FileCacheConfig{
+		EnableParallelDownloads:  true,
+		ParallelDownloadsPerFile: 2,
+		DownloadChunkSizeMb:      2,
+		MaxParallelDownloads:     2,
+		WriteBufferSize:          4 * 1024 * 1024,
+	}
+	jm := NewJobManager(cache, util.DefaultFilePerm, util.DefaultDirPerm, cacheDir, 2, fileCacheConfig, common.NewNoopMetrics())
+	job := jm.CreateJobIfNotExists(&minObj, bucket)
+	fileSpec := data.FileSpec{Path: util.GetDownloadPath(path.Join(cacheDir, storage.TestBucketName), "path/in/gcs/foo.txt"), FilePerm: util.DefaultFilePerm, DirPerm: util.DefaultDirPerm}
+	// The file left behind holds zeros rather than the object, so that it can be
+	// told which parts are downloaded again.
+	require.NoError(t, os.MkdirAll(path.Dir(fileSpec.Path), util.DefaultDirPerm))
+	require.NoError(t, os.WriteFile(fileSpec.Path, make([]byte, 5*util.MiB), util.DefaultFilePerm))
+	job.Resume(data.FileInfo{ObjectGeneration: minObj.Generation, FileSize: minObj.Size, Offset: 5 * util.MiB})
+
+	jobStatus, err := job.Download(ctx, 10*util.MiB, true)
+
+	require.NoError(t, err)
+	assert.EqualValues(t, 10*util.MiB, jobStatus.Offset)
+	file, err := os.ReadFile(fileSpec.Path)
+	require.NoError(t, err)
+	require.Len(t, file, 10*util.MiB)
+	// The chunk the offset was in is downloaded again.
+	assert.Equal(t, make([]byte, 4*util.MiB), file[:4*util.MiB])
+	assert.Equal(t, content[4*util.MiB:], file[4*util.MiB:])
+}
+
+func TestParallelDownloads_ResumeOtherGeneration(t *testing.T) {
+	cache, cacheDir := configureCache(t, 40*util.MiB)
+	ctx := context.Background()
+	bucket := configureFakeStorage(t).BucketHandle(ctx, storage.TestBucketName, "")
+	minObj, content := createObjectInStoreAndInitCache(t, cache, bucket, "path/in/gcs/foo.txt", 10*util.MiB)
+	fileCacheConfig := &cfg.FileCacheConfig{
+		EnableParallelDownloads:  true,
+		ParallelDownloadsPerFile: 2,
+		DownloadChunkSizeMb:      2,
+		MaxParallelDownloads:     2,
+		WriteBufferSize:          4 * 1024 * 1024,
+	}
+	jm := NewJobManager(cache, util.DefaultFilePerm, util.DefaultDirPerm, cacheDir, 2, fileCacheConfig, common.NewNoopMetrics())
+	job := jm.CreateJobIfNotExists(&minObj, bucket)
+	fileSpec := data.FileSpec{Path: util.GetDownloadPath(path.Join(cacheDir, storage.TestBucketName), "path/in/gcs/foo.txt"), FilePerm: util.DefaultFilePerm, DirPerm: util.DefaultDirPerm}
+	require.NoError(t, os.MkdirAll(path.Dir(fileSpec.Path), util.DefaultDirPerm))
+	require.NoError(t, os.WriteFile(fileSpec.Path, make([]byte, 5*util.MiB), util.DefaultFilePerm))
+	job.Resume(data.FileInfo{ObjectGeneration: minObj.Generation + 1, FileSize: minObj.Size, Offset: 5 * util.MiB})
+
+	jobStatus, err := job.Download(ctx, 10*util.MiB, true)
+
+	require.NoError(t, err)
+	assert.EqualValues(t, 10*util.MiB, jobStatus.Offset)
+	verifyFileTillOffset(t, fileSpec, 10*util.MiB, content)
+}
@@ -98,7 +98,53 @@ type Job struct {
 	// downloaded when parallel download is enabled.
 	rangeChan chan data.ObjectRange
 
+	// For parallel downloads, the ranges downloaded so far as laid out by
+	// updateRangeMap. They needn't be contiguous, as the ranges readers wait
+	// for are downloaded ahead of the others.
+	//
+	// GUARDED_BY(mu)
+	rangeMap map[int64]int64
+
+	// For parallel downloads, which of the chunks of DownloadChunkSizeMb have
+	// been handed out to the goroutines so far, and the indices of the chunks
+	// readers asked for, which are handed out ahead of the others in order.
+	//
+	// GUARDED_BY(mu)
+	scheduledChunks   []bool
+	prioritizedChunks []int64
+
+	// prioritizeC notifies parallelDownloadObjectToFile of chunks added to
+	// prioritizedChunks.
+	prioritizeC chan struct{}
+
 	metricsHandle common.MetricHandle
+
+	// For a sparse file, the chunks downloaded so far and the downloads of
+	// chunks in flight by index, which readers of the chunks wait for.
+	//
+	// GUARDED_BY(mu)
+	chunks  *data.ChunkBitmap
+	fetches map[uint64]*chunkFetch
+
+	// For a sparse file, when each chunk was last read by index, counted in
+	// reads of chunks, so that the least recently read chunks are dropped
+	// first when the file outgrows the cache.
+	//
+	// GUARDED_BY(mu)
+	chunkReads map[uint64]uint64
+	reads      uint64
+
+	// Context & its CancelFunc for cancelling the downloads of chunks of a
+	// sparse file in flight, non-nil once the job has started. Unlike with
+	// cancelFunc, cancelling them doesn't wait for them to terminate.
+	fetchCtx    context.Context
+	fetchCancel context.CancelFunc
+
+	// evictionCallback is a callback function to clean up the entries of the
+	// file info cache evicted to make room for chunks of a sparse file. It is
+	// responsibility of JobManager to pass this function, and it is called
+	// without LOCK(job.mu).
+	evictionCallback func(evicted []lru.ValueType)
 }
 
 // JobStatus represents the status of job.
@@ -109,9 +155,11 @@ type JobStatus struct {
 }
 
 // jobSubscriber represents a subscriber waiting on async download of job to
-// complete downloading at least till the subscribed offset.
+// complete downloading at least till the subscribed offset, or the range from
+// subscribedStart to it with parallel downloads.
 type jobSubscriber struct {
 	notificationC    chan<- JobStatus
+	subscribedStart  int64
 	subscribedOffset int64
 }
 
@@ -160,6 +208,13 @@ func (job *Job) init() {
 	job.status = JobStatus{NotStarted, nil, 0}
 	job.subscribers = list.List{}
 	job.doneCh = make(chan struct{})
+	job.rangeMap = make(map[int64]int64)
+	job.prioritizeC = make(chan struct{}, 1)
+	if job.IsSparse() {
+		job.chunks = data.NewChunkBitmap(uint64(job.fileCacheConfig.SparseChunkSizeMb)*cacheutil.MiB, job.object.Size)
+		job.fetches = make(map[uint64]*chunkFetch)
+		job.chunkReads = make(map[uint64]uint64)
+	}
 }
 
 // cancel is helper function to cancel the in-progress job.downloadAsync goroutine.
@@ -205,6 +260,9 @@ func (job *Job) Invalidate() {
 	}
 	defer job.mu.Unlock()
 	job.status.Name = Invalid
+	if job.fetchCancel != nil {
+		job.fetchCancel()
+	}
 	logger.Tracef("Job:%p (%s:/%s) is no longer valid.", job, job.bucket.Name(), job.object.Name)
 	if job.removeJobCallback != nil {
 		job.removeJobCallback()
@@ -219,11 +277,39 @@ func (job *Job) Invalidate() {
 //
 // Not concurrency safe and requires LOCK(job.mu)
 func (job *Job) subscribe(subscribedOffset int64) (notificationC <-chan JobStatus) {
+	return job.subscribeRange(0, subscribedOffset)
+}
+
+// subscribeRange is like subscribe, but the channel is also notified when the
+// range [subscribedStart, subscribedOffset) is downloaded ahead of the offset.
+//
+// Not concurrency safe and requires LOCK(job.mu)
+func (job *Job) subscribeRange(subscribedStart int64, subscribedOffset int64) (notificationC <-chan JobStatus) {
 	subscriberC := make(chan JobStatus, 1)
-	job.subscribers.PushBack(jobSubscriber{subscriberC, subscribedOffset})
+	job.subscribers.PushBack(jobSubscriber{subscriberC, subscribedStart, subscribedOffset})
 	return subscriberC
 }
 
+// isDownloaded tells whether the range [start, end) of the object is present
+// in the file in cache, either below the offset of the job or in a range
+// downloaded ahead of it.
+//
+// Not concurrency safe and requires LOCK(job.mu)
+func (job *Job) isDownloaded(start int64, end int64) bool {
+	if job.status.Offset >= end {
+		return true
+	}
+
+	// Each range is in rangeMap both from its start to its end and the other
+	// way round, and only the former has the key lower than the value.
+	for rangeStart, rangeEnd := range job.rangeMap {
+		if rangeStart <= start && end <= rangeEnd {
+			return true
+		}
+	}
+	return false
+}
+
 // notifySubscribers notifies all the subscribers of download job in case of
 // failure or invalidation or completion till the subscribed offset.
 //
@@ -233,7 +319,7 @@ func (job *Job) notifySubscribers() {
 	for subItr := job.subscribers.Front(); subItr != nil; subItr = nextSubItr {
 		subItrValue := subItr.Value.(jobSubscriber)
 		nextSubItr = subItr.Next()
-		if job.status.Name == Failed || job.status.Name == Invalid || job.status.Offset >= subItrValue.subscribedOffset {
+		if job.status.Name == Failed || job.status.Name == Invalid || job.isDownloaded(subItrValue.subscribedStart, subItrValue.subscribedOffset) {
 			subItrValue.notificationC <- job.status
 			close(subItrValue.notificationC)
 			job.subscribers.Remove(subItr)
@@ -278,6 +364,9 @@ func (job *Job) updateStatusOffset(downloadedOffset int64) (err error) {
 		Key: fileInfoKey, ObjectGeneration: job.object.Generation,
 		FileSize: job.object.Size, Offset: uint64(downloadedOffset),
 	}
+	if updatedFileInfo.Offset == updatedFileInfo.FileSize {
+		updatedFileInfo.CRC32C = job.object.CRC32C
+	}
 
 	err = job.fileInfoCache.UpdateWithoutChangingOrder(fileInfoKeyName, updatedFileInfo)
 	if err == nil {
@@ -301,6 +390,11 @@ func (job *Job) downloadObjectToFile(cacheFile *os.File) (err error) {
 	end = int64(job.object.Size)
 	sequentialReadSize = int64(job.sequentialReadSizeMb) * cacheutil.MiB
 
+	// Carry on from the offset the job was resumed at, if any.
+	job.mu.Lock()
+	start = job.status.Offset
+	job.mu.Unlock()
+
 	// Each iteration of this for loop, reads ReadChunkSize size of range of the
 	// backing object from reader into the file handle and updates the file info
 	// cache. In case, reader is not present for reading, it creates a
@@ -379,9 +473,17 @@ func (job *Job) cleanUpDownloadAsyncJob() {
 
 // createCacheFile is a helper function which creates file in cache using
 // appropriate open file flags.
+//
+// Acquires and releases LOCK(job.mu)
 func (job *Job) createCacheFile() (*os.File, error) {
-	// Create, open and truncate cache file for writing object into it.
+	// Create, open and truncate cache file for writing object into it, unless the
+	// job was resumed and the file holds the data till its offset.
 	openFileFlags := os.O_TRUNC | os.O_WRONLY
+	job.mu.Lock()
+	if job.status.Offset > 0 {
+		openFileFlags = os.O_WRONLY
+	}
+	job.mu.Unlock()
 	var cacheFile *os.File
 	var err error
 	// Try using O_DIRECT while opening file when parallel downloads are enabled
@@ -469,6 +571,17 @@ func (job *Job) downloadObjectAsync() {
 //
 // Acquires and releases LOCK(job.mu)
 func (job *Job) Download(ctx context.Context, offset int64, waitForDownload bool) (jobStatus JobStatus, err error) {
+	return job.DownloadFrom(ctx, 0, offset, waitForDownload)
+}
+
+// DownloadFrom is like Download for the range [start, offset) of the object.
+// With parallel downloads, the chunks spanning the range and a few following
+// them are downloaded ahead of the others, and it waits only for the range,
+// which the caller can tell is present through IsDownloaded even if
+// jobStatus.Offset is lower.
+//
+// Acquires and releases LOCK(job.mu)
+func (job *Job) DownloadFrom(ctx context.Context, start int64, offset int64, waitForDownload bool) (jobStatus JobStatus, err error) {
 	job.mu.Lock()
 	if int64(job.object.Size) < offset {
 		defer job.mu.Unlock()
@@ -484,18 +597,25 @@ func (job *Job) Download(ctx context.Context, offset int64, waitForDownload bool
 		job.status.Name = Downloading
 		job.cancelCtx, job.cancelFunc = context.WithCancel(context.Background())
 		go job.downloadObjectAsync()
-	} else if job.status.Name == Failed || job.status.Name == Invalid || job.status.Offset >= offset {
+	}
+
+	// A resumed job may already have the range before it starts.
+	if job.status.Name == Failed || job.status.Name == Invalid || job.isDownloaded(start, offset) {
 		defer job.mu.Unlock()
 		return job.status, nil
 	}
 
+	if job.IsParallelDownloadsEnabled() {
+		job.prioritize(start, offset)
+	}
+
 	if !waitForDownload {
 		defer job.mu.Unlock()
 		return job.status, nil
 	}
 
-	// Subscribe to the given offset.
-	notificationC := job.subscribe(offset)
+	// Subscribe to the given range.
+	notificationC := job.subscribeRange(start, offset)
 	// Lock is not required when the subscriber is waiting for async download job
 	// to download the requested contents.
 	job.mu.Unlock()
@@ -509,6 +629,42 @@ func (job *Job) Download(ctx context.Context, offset int64, waitForDownload bool
 	return
 }
 
+// Resume has the job carry on from the data of the object in the file in cache
+// that fileInfo records, e.g. as left behind by a previous mount, rather than
+// download the object afresh. It has no effect once the job has started, or if
+// fileInfo is for another generation of the object or kind of file.
+//
+// Acquires and releases LOCK(job.mu)
+func (job *Job) Resume(fileInfo data.FileInfo) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.status.Name != NotStarted || fileInfo.ObjectGeneration != job.object.Generation || fileInfo.FileSize != job.object.Size {
+		return
+	}
+
+	if job.IsSparse() {
+		if fileInfo.Chunks != nil && fileInfo.Chunks.ChunkSize() == job.chunks.ChunkSize() {
+			job.chunks = fileInfo.Chunks
+		}
+	} else if fileInfo.Chunks == nil {
+		job.status.Offset = int64(fileInfo.Offset)
+	}
+	logger.Tracef("Job:%p (%s:/%s) resumed.", job, job.bucket.Name(), job.object.Name)
+}
+
+// IsDownloaded tells whether the range [start, end) of the object is present
+// in the file in cache and the job is neither Failed nor Invalid.
+//
+// Acquires and releases LOCK(job.mu)
+func (job *Job) IsDownloaded(start int64, end int64) bool {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.status.Name == Failed || job.status.Name == Invalid {
+		return false
+	}
+	return job.isDownloaded(start, end)
+}
+
 // GetStatus returns the status of download job.
 //
 // Acquires and releases LOCK(job.mu)
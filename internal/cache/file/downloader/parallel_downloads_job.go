@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
@@ -31,10 +32,10 @@ import (
 )
 
 // downloadRange is a helper function to download a given range of object from
-// GCS into given destination writer.
+// GCS into given destination writer, capturing the read as of the given type.
 //
 // This function doesn't take locks and can be executed parallely.
-func (job *Job) downloadRange(ctx context.Context, dstWriter io.Writer, start, end int64) error {
+func (job *Job) downloadRange(ctx context.Context, dstWriter io.Writer, start, end int64, readType string) error {
 	newReader, err := job.bucket.NewReader(
 		ctx,
 		&gcs.ReadObjectRequest{
@@ -60,7 +61,7 @@ func (job *Job) downloadRange(ctx context.Context, dstWriter io.Writer, start, e
 		}
 	}()
 
-	common.CaptureGCSReadMetrics(ctx, job.metricsHandle, util.Parallel, end-start)
+	common.CaptureGCSReadMetrics(ctx, job.metricsHandle, readType, end-start)
 
 	// Use standard copy function if O_DIRECT is disabled and memory aligned
 	// buffer otherwise.
@@ -83,9 +84,15 @@ func (job *Job) downloadRange(ctx context.Context, dstWriter io.Writer, start, e
 	return err
 }
 
+// prioritizedChunksAfterRead is the number of chunks following those spanning
+// a range readers wait for that are downloaded ahead of the others too, so that
+// the reads following it find their data in cache.
+const prioritizedChunksAfterRead = 2
+
 // RangeMap maintains the ranges downloaded by the different goroutines. This
 // function takes a new range and merges with existing ranges if they are continuous.
-// If the start offset is 0, updates the job's status offset.
+// If the start offset is 0, updates the job's status offset, otherwise notifies
+// the subscribers waiting for ranges ahead of it.
 //
 // Eg:
 // Input: rangeMap entries 0-3, 5-6. New input 7-8.
@@ -122,14 +129,66 @@ func (job *Job) updateRangeMap(rangeMap map[int64]int64, offsetStart int64, offs
 		if updateErr := job.updateStatusOffset(finalEnd); updateErr != nil {
 			return updateErr
 		}
+	} else {
+		job.notifySubscribers()
 	}
 
 	return nil
 }
 
+// prioritize has the chunks spanning [start, end) and the
+// prioritizedChunksAfterRead chunks following them handed out to the
+// goroutines next, unless they already have been.
+//
+// Not concurrency safe and requires LOCK(job.mu)
+func (job *Job) prioritize(start, end int64) {
+	downloadChunkSize := job.fileCacheConfig.DownloadChunkSizeMb * cacheutil.MiB
+	numChunks := (int64(job.object.Size) + downloadChunkSize - 1) / downloadChunkSize
+	added := false
+	for i := start / downloadChunkSize; i <= min((end-1)/downloadChunkSize+prioritizedChunksAfterRead, numChunks-1); i++ {
+		// The chunks aren't known to be handed out before the download starts.
+		if (i < int64(len(job.scheduledChunks)) && job.scheduledChunks[i]) || slices.Contains(job.prioritizedChunks, i) {
+			continue
+		}
+		job.prioritizedChunks = append(job.prioritizedChunks, i)
+		added = true
+	}
+
+	if added {
+		select {
+		case job.prioritizeC <- struct{}{}:
+		default:
+			// parallelDownloadObjectToFile is yet to pick up an earlier notification.
+		}
+	}
+}
+
+// nextChunk returns the index of the chunk to hand out to the goroutines next,
+// the first of the prioritized chunks not handed out yet if any, or else the
+// first chunk from next on not handed out yet, which it advances next to. It
+// returns the number of chunks once all have been handed out.
+//
+// Acquires and releases LOCK(job.mu)
+func (job *Job) nextChunk(next *int64) int64 {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	for len(job.prioritizedChunks) > 0 {
+		if i := job.prioritizedChunks[0]; !job.scheduledChunks[i] {
+			return i
+		}
+		job.prioritizedChunks = job.prioritizedChunks[1:]
+	}
+
+	for *next < int64(len(job.scheduledChunks)) && job.scheduledChunks[*next] {
+		*next++
+	}
+	return *next
+}
+
 // Reads the range input from the range channel continuously and downloads that
 // range from the GCS. If the range channel is closed, it will exit.
-func (job *Job) downloadOffsets(ctx context.Context, goroutineIndex int64, cacheFile *os.File, rangeMap map[int64]int64) func() error {
+func (job *Job) downloadOffsets(ctx context.Context, goroutineIndex int64, cacheFile *os.File) func() error {
 	return func() error {
 		// Since we keep a goroutine for each job irrespective of the maxParallelism,
 		// not releasing the default goroutine to the pool.
@@ -146,12 +205,12 @@ func (job *Job) downloadOffsets(ctx context.Context, goroutineIndex int64, cache
 			}
 
 			offsetWriter := io.NewOffsetWriter(cacheFile, int64(objectRange.Start))
-			err := job.downloadRange(ctx, offsetWriter, objectRange.Start, objectRange.End)
+			err := job.downloadRange(ctx, offsetWriter, objectRange.Start, objectRange.End, util.Parallel)
 			if err != nil {
 				return err
 			}
 
-			err = job.updateRangeMap(rangeMap, objectRange.Start, objectRange.End)
+			err = job.updateRangeMap(job.rangeMap, objectRange.Start, objectRange.End)
 			if err != nil {
 				return err
 			}
@@ -161,17 +220,32 @@ func (job *Job) downloadOffsets(ctx context.Context, goroutineIndex int64, cache
 
 // parallelDownloadObjectToFile does parallel download of the backing GCS object
 // into given file handle using multiple NewReader method of gcs.Bucket running
-// in parallel. This function is canceled if job.cancelCtx is canceled.
+// in parallel. The chunks are downloaded in order, but those prioritized by
+// readers. This function is canceled if job.cancelCtx is canceled.
 func (job *Job) parallelDownloadObjectToFile(cacheFile *os.File) (err error) {
-	rangeMap := make(map[int64]int64)
-	// Trying to keep the channel size greater than ParallelDownloadsPerFile to ensure
-	// that there is no goroutine waiting for data(nextRange) to be published to channel.
-	job.rangeChan = make(chan data.ObjectRange, 2*job.fileCacheConfig.ParallelDownloadsPerFile)
+	// The channel is unbuffered so that the chunk to download next is picked
+	// only once a goroutine is free, by which time readers may have prioritized
+	// other chunks.
+	job.rangeChan = make(chan data.ObjectRange)
 	var numGoRoutines int64
 	var start int64
 	downloadChunkSize := job.fileCacheConfig.DownloadChunkSizeMb * cacheutil.MiB
+	numChunks := (int64(job.object.Size) + downloadChunkSize - 1) / downloadChunkSize
 	downloadErrGroup, downloadErrGroupCtx := errgroup.WithContext(job.cancelCtx)
 
+	job.mu.Lock()
+	job.scheduledChunks = make([]bool, numChunks)
+	// A resumed job has the chunks below its offset already. The chunk its
+	// offset is in is downloaded again, so that ranges stay aligned to chunks.
+	if resumed := job.status.Offset / downloadChunkSize; resumed > 0 {
+		for i := range resumed {
+			job.scheduledChunks[i] = true
+		}
+		job.rangeMap[0] = resumed * downloadChunkSize
+		job.rangeMap[resumed*downloadChunkSize] = 0
+	}
+	job.mu.Unlock()
+
 	// Start the goroutines as per the config and the availability.
 	for numGoRoutines = 0; (numGoRoutines < job.fileCacheConfig.ParallelDownloadsPerFile) && (start < int64(job.object.Size)); numGoRoutines++ {
 		// Respect max download parallelism only beyond first go routine.
@@ -179,27 +253,37 @@ func (job *Job) parallelDownloadObjectToFile(cacheFile *os.File) (err error) {
 			break
 		}
 
-		downloadErrGroup.Go(job.downloadOffsets(downloadErrGroupCtx, numGoRoutines, cacheFile, rangeMap))
+		downloadErrGroup.Go(job.downloadOffsets(downloadErrGroupCtx, numGoRoutines, cacheFile))
 		start = start + downloadChunkSize
 	}
 
-	for start = 0; start < int64(job.object.Size); {
+	var next int64
+	for {
+		i := job.nextChunk(&next)
+		if i == numChunks {
+			break
+		}
 		nextRange := data.ObjectRange{
-			Start: start,
-			End:   min(int64(job.object.Size), start+downloadChunkSize),
+			Start: i * downloadChunkSize,
+			End:   min(int64(job.object.Size), (i+1)*downloadChunkSize),
 		}
 
 		select {
 		case job.rangeChan <- nextRange:
-			start = nextRange.End
+			job.mu.Lock()
+			job.scheduledChunks[i] = true
+			job.mu.Unlock()
 			// In case we haven't started the goroutines as per the config, checking
 			// if any goroutines are available now.
 			// This may not be the ideal way, but since we don't have any way of
 			// listening if goroutines from other jobs have freed up, checking it here.
 			for numGoRoutines < job.fileCacheConfig.ParallelDownloadsPerFile && job.maxParallelismSem.TryAcquire(1) {
-				downloadErrGroup.Go(job.downloadOffsets(downloadErrGroupCtx, numGoRoutines, cacheFile, rangeMap))
+				downloadErrGroup.Go(job.downloadOffsets(downloadErrGroupCtx, numGoRoutines, cacheFile))
 				numGoRoutines++
 			}
+		case <-job.prioritizeC:
+			// Pick the chunk to download next again, as readers have prioritized
+			// others.
 		case <-downloadErrGroupCtx.Done():
 			return job.handleJobCompletion(downloadErrGroupCtx, downloadErrGroup)
 		}
@@ -0,0 +1,296 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// File that contains the sparse download job i.e. when
+// ExperimentalEnableSparseFile=true.
+
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	cacheutil "github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
+	"golang.org/x/sys/unix"
+)
+
+// chunkFetch is the download of a chunk of a sparse file in flight.
+type chunkFetch struct {
+	// Closed once the download has finished, after which err may be read.
+	done chan struct{}
+	err  error
+}
+
+// IsSparse tells whether the job downloads the object into a sparse file, in
+// chunks as they are read, in which case DownloadRange should be used rather
+// than Download.
+func (job *Job) IsSparse() bool {
+	return job.fileCacheConfig != nil && job.fileCacheConfig.ExperimentalEnableSparseFile
+}
+
+// DownloadRange downloads the chunks of the sparse file overlapping
+// [start, end) that are missing, waiting for them, and starts downloading the
+// configured number of chunks following them. It also tells whether all the
+// chunks overlapping the range were already present.
+//
+// Acquires and releases LOCK(job.mu)
+func (job *Job) DownloadRange(ctx context.Context, start, end int64) (cacheHit bool, err error) {
+	job.mu.Lock()
+	if int64(job.object.Size) < end {
+		defer job.mu.Unlock()
+		err = fmt.Errorf("DownloadRange: the requested range end %d is greater than the size of object %d", end, job.object.Size)
+		return
+	}
+
+	switch job.status.Name {
+	case Failed, Invalid:
+		defer job.mu.Unlock()
+		err = fmt.Errorf("%s: jobStatus: %s jobError: %w", cacheutil.InvalidFileDownloadJobErrMsg, job.status.Name, job.status.Err)
+		return
+	case NotStarted:
+		job.status.Name = Downloading
+		job.fetchCtx, job.fetchCancel = context.WithCancel(context.Background())
+	}
+
+	cacheHit = true
+	var fetches []*chunkFetch
+	last := uint64(0)
+	if start < end {
+		last = uint64(end-1) / job.chunks.ChunkSize()
+		for i := uint64(start) / job.chunks.ChunkSize(); i <= last; i++ {
+			job.recordChunkRead(i)
+			if !job.chunks.Has(i) {
+				cacheHit = false
+				fetches = append(fetches, job.fetchChunk(i))
+			}
+		}
+	}
+
+	// Only a read that missed the cache prefetches, so that reads of the
+	// chunks prefetched don't prefetch further.
+	if !cacheHit {
+		for i := last + 1; i <= min(last+uint64(job.fileCacheConfig.SparseNeighborChunks), job.chunks.NumChunks()-1); i++ {
+			if !job.chunks.Has(i) {
+				job.fetchChunk(i)
+			}
+		}
+	}
+	job.mu.Unlock()
+
+	for _, f := range fetches {
+		select {
+		case <-f.done:
+			if f.err != nil {
+				return false, fmt.Errorf("DownloadRange: %w", f.err)
+			}
+		case <-ctx.Done():
+			return false, fmt.Errorf("DownloadRange: %w", ctx.Err())
+		}
+	}
+	return
+}
+
+// recordChunkRead records that chunk i has just been read.
+//
+// Requires LOCK(job.mu)
+func (job *Job) recordChunkRead(i uint64) {
+	job.reads++
+	job.chunkReads[i] = job.reads
+}
+
+// fetchChunk returns the download of chunk i, starting it unless it is already
+// in flight. The download outlives the read that started it, so that a
+// cancelled read doesn't fail others waiting for the chunk.
+//
+// Requires LOCK(job.mu)
+func (job *Job) fetchChunk(i uint64) *chunkFetch {
+	if f, ok := job.fetches[i]; ok {
+		return f
+	}
+
+	f := &chunkFetch{done: make(chan struct{})}
+	job.fetches[i] = f
+	start, end := job.chunks.ChunkRange(i)
+	go func() {
+		defer close(f.done)
+		f.err = job.downloadChunk(i, int64(start), int64(end))
+		if f.err != nil {
+			job.handleSparseError(f.err)
+		}
+	}()
+	return f
+}
+
+// downloadChunk downloads chunk i, spanning [start, end) of the object, into
+// the sparse file and records it in the file info cache, after which it may be
+// read.
+//
+// Acquires and releases LOCK(job.mu)
+func (job *Job) downloadChunk(i uint64, start, end int64) (err error) {
+	defer func() {
+		job.mu.Lock()
+		delete(job.fetches, i)
+		job.mu.Unlock()
+	}()
+
+	if err = job.maxParallelismSem.Acquire(job.fetchCtx, 1); err != nil {
+		return fmt.Errorf("downloadChunk: %w", err)
+	}
+	defer job.maxParallelismSem.Release(1)
+
+	// The file is created when the entry for the object is added to the file
+	// info cache, and isn't truncated so as to keep the chunks already in it.
+	// It's gone if the entry has been evicted since, and mustn't be created
+	// again.
+	cacheFile, err := os.OpenFile(job.fileSpec.Path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("downloadChunk: error in opening cache file: %w", err)
+	}
+	defer func() {
+		if closeErr := cacheFile.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("downloadChunk: error while closing cache file: %w", closeErr)
+		}
+	}()
+
+	err = job.downloadRange(job.fetchCtx, io.NewOffsetWriter(cacheFile, start), start, end, util.Random)
+	if err != nil {
+		return fmt.Errorf("downloadChunk: %w", err)
+	}
+
+	return job.addChunk(cacheFile, i)
+}
+
+// addChunk records chunk i of the sparse file in the file info cache, growing
+// the entry for the object and evicting others if need be. If the cache can't
+// hold all the chunks of the file, it drops the least recently read of the
+// other chunks until it can, and frees the space they take in the file.
+//
+// Acquires and releases LOCK(job.mu)
+func (job *Job) addChunk(cacheFile *os.File, i uint64) error {
+	fileInfoKey := data.FileInfoKey{
+		BucketName: job.bucket.Name(),
+		ObjectName: job.object.Name,
+	}
+	fileInfoKeyName, err := fileInfoKey.Key()
+	if err != nil {
+		return fmt.Errorf("addChunk: error while creating fileInfoKeyName for bucket %s and object %s %w",
+			fileInfoKey.BucketName, fileInfoKey.ObjectName, err)
+	}
+
+	job.mu.Lock()
+	// An invalidated job must not record chunks, as its file may have been
+	// removed and replaced by the time the download finished.
+	if job.status.Name != Downloading {
+		job.mu.Unlock()
+		return fmt.Errorf("addChunk: job is %s", job.status.Name)
+	}
+
+	fileInfo := data.FileInfo{
+		Key:              fileInfoKey,
+		ObjectGeneration: job.object.Generation,
+		FileSize:         job.object.Size,
+		Chunks:           job.chunks.With(i),
+	}
+	evicted, err := job.fileInfoCache.Update(fileInfoKeyName, fileInfo)
+
+	var dropped []uint64
+	if isEntryTooLarge(err) {
+		// Chunks downloaded before the job was resumed have never been read, and
+		// go first.
+		candidates := job.chunks.Chunks()
+		sort.SliceStable(candidates, func(a, b int) bool {
+			return job.chunkReads[candidates[a]] < job.chunkReads[candidates[b]]
+		})
+		for _, d := range candidates {
+			if !isEntryTooLarge(err) {
+				break
+			}
+			fileInfo.Chunks = fileInfo.Chunks.Without(d)
+			dropped = append(dropped, d)
+			evicted, err = job.fileInfoCache.Update(fileInfoKeyName, fileInfo)
+		}
+	}
+	if err != nil {
+		job.mu.Unlock()
+		return fmt.Errorf("addChunk: error while updating chunk %d in fileInfoCache %s: %w", i, fileInfoKeyName, err)
+	}
+	job.chunks = fileInfo.Chunks
+	for _, d := range dropped {
+		delete(job.chunkReads, d)
+	}
+	if _, ok := job.chunkReads[i]; !ok {
+		// A chunk prefetched counts as read when it's added.
+		job.recordChunkRead(i)
+	}
+	job.mu.Unlock()
+
+	if job.evictionCallback != nil && len(evicted) > 0 {
+		job.evictionCallback(evicted)
+	}
+
+	// Readers of the chunks dropped verify that they are still in the file info
+	// cache after reading them, so the space can be freed right away.
+	for _, d := range dropped {
+		start, end := fileInfo.Chunks.ChunkRange(d)
+		err = unix.Fallocate(int(cacheFile.Fd()), unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, int64(start), int64(end-start))
+		if err != nil {
+			logger.Warnf("Job:%p (%s:/%s) error while dropping chunk %d: %v", job, job.bucket.Name(), job.object.Name, d, err)
+		}
+	}
+
+	logger.Tracef("Job:%p (%s:/%s) downloaded chunk %d.", job, job.bucket.Name(), job.object.Name, i)
+	return nil
+}
+
+func isEntryTooLarge(err error) bool {
+	return err != nil && strings.Contains(err.Error(), lru.InvalidEntrySizeErrorMsg)
+}
+
+// handleSparseError fails the sparse download job, so that readers fall back
+// to GCS until the file is cached afresh. A cancelled download, or a missing
+// entry in the file info cache or file, means the job was invalidated or
+// evicted instead.
+//
+// Acquires and releases LOCK(job.mu)
+func (job *Job) handleSparseError(err error) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.status.Name != Downloading {
+		return
+	}
+
+	job.status.Err = err
+	job.status.Name = Failed
+	if errors.Is(err, context.Canceled) || errors.Is(err, fs.ErrNotExist) || strings.Contains(err.Error(), lru.EntryNotExistErrMsg) {
+		job.status.Name = Invalid
+	} else {
+		logger.Errorf("Job:%p (%s:/%s) Failed with error: %v", job, job.bucket.Name(), job.object.Name, err)
+	}
+
+	job.fetchCancel()
+	if job.removeJobCallback != nil {
+		job.removeJobCallback()
+		job.removeJobCallback = nil
+	}
+}
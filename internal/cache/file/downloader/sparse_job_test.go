@@ -0,0 +1,304 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// File that contains tests specific to sparse download job i.e. when
+// ExperimentalEnableSparseFile=true.
+
+package downloader
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSparseObjectSize = 10*util.MiB + 5
+
+type sparseJobTest struct {
+	cache    *lru.Cache
+	cacheDir string
+	bucket   gcs.Bucket
+	jm       *JobManager
+	object   gcs.MinObject
+	content  []byte
+
+	mu      sync.Mutex
+	evicted []lru.ValueType
+}
+
+func newSparseJobTest(t *testing.T, cacheSize int64, neighborChunks int64) *sparseJobTest {
+	t.Helper()
+	st := &sparseJobTest{}
+	st.cache, st.cacheDir = configureCache(t, cacheSize)
+	st.bucket = configureFakeStorage(t).BucketHandle(context.Background(), storage.TestBucketName, "")
+	fileCacheConfig := &cfg.FileCacheConfig{
+		ExperimentalEnableSparseFile: true,
+		SparseChunkSizeMb:            1,
+		SparseNeighborChunks:         neighborChunks,
+	}
+	st.jm = NewJobManager(st.cache, util.DefaultFilePerm, util.DefaultDirPerm, st.cacheDir, 2, fileCacheConfig, common.NewNoopMetrics())
+	st.jm.SetEvictionCallback(func(evicted []lru.ValueType) {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		st.evicted = append(st.evicted, evicted...)
+	})
+	st.object, st.content = st.createObject(t, "path/in/gcs/foo.txt")
+	return st
+}
+
+// createObject creates the object along with the entry of its sparse file in
+// cache and the file, with no chunks downloaded.
+func (st *sparseJobTest) createObject(t *testing.T, objectName string) (gcs.MinObject, []byte) {
+	t.Helper()
+	content := createObjectInBucket(t, objectName, testSparseObjectSize, st.bucket)
+	minObj := getMinObject(objectName, st.bucket)
+	fileInfoKey := data.FileInfoKey{
+		BucketName: storage.TestBucketName,
+		ObjectName: objectName,
+	}
+	fileInfo := data.FileInfo{
+		Key:              fileInfoKey,
+		ObjectGeneration: minObj.Generation,
+		FileSize:         minObj.Size,
+		Chunks:           data.NewChunkBitmap(st.jm.SparseChunkSize(), minObj.Size),
+	}
+	fileInfoKeyName, err := fileInfoKey.Key()
+	require.NoError(t, err)
+	_, err = st.cache.Insert(fileInfoKeyName, fileInfo)
+	require.NoError(t, err)
+	f, err := util.CreateFile(data.FileSpec{
+		Path:     st.filePath(objectName),
+		FilePerm: util.DefaultFilePerm,
+		DirPerm:  util.DefaultDirPerm,
+	}, os.O_RDONLY)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	return minObj, content
+}
+
+func (st *sparseJobTest) filePath(objectName string) string {
+	return util.GetDownloadPath(path.Join(st.cacheDir, storage.TestBucketName), objectName)
+}
+
+func (st *sparseJobTest) fileInfo(t *testing.T, objectName string) data.FileInfo {
+	t.Helper()
+	fileInfoKeyName, err := data.FileInfoKey{BucketName: storage.TestBucketName, ObjectName: objectName}.Key()
+	require.NoError(t, err)
+	fileInfo := st.cache.LookUpWithoutChangingOrder(fileInfoKeyName)
+	require.NotNil(t, fileInfo)
+	return fileInfo.(data.FileInfo)
+}
+
+func (st *sparseJobTest) verifyFileRange(t *testing.T, objectName string, start, end int64) {
+	t.Helper()
+	fileContent, err := os.ReadFile(st.filePath(objectName))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, int64(len(fileContent)), end)
+	assert.Equal(t, st.content[start:end], fileContent[start:end])
+}
+
+// waitForFetches waits for the downloads of chunks in flight to finish.
+func waitForFetches(job *Job) {
+	job.mu.Lock()
+	var fetches []*chunkFetch
+	for _, f := range job.fetches {
+		fetches = append(fetches, f)
+	}
+	job.mu.Unlock()
+
+	for _, f := range fetches {
+		<-f.done
+	}
+}
+
+func TestSparseJob_DownloadsOnlyChunksRead(t *testing.T) {
+	st := newSparseJobTest(t, 20*util.MiB, 0)
+	job := st.jm.CreateJobIfNotExists(&st.object, st.bucket)
+	require.True(t, job.IsSparse())
+
+	cacheHit, err := job.DownloadRange(context.Background(), 3*util.MiB+7, 4*util.MiB+7)
+
+	require.NoError(t, err)
+	assert.False(t, cacheHit)
+	st.verifyFileRange(t, st.object.Name, 3*util.MiB, 5*util.MiB)
+	fileInfo := st.fileInfo(t, st.object.Name)
+	assert.Equal(t, []uint64{3, 4}, fileInfo.Chunks.Chunks())
+	assert.EqualValues(t, 2*util.MiB, fileInfo.Size())
+	assert.Equal(t, Downloading, job.GetStatus().Name)
+
+	cacheHit, err = job.DownloadRange(context.Background(), 4*util.MiB, 5*util.MiB)
+
+	require.NoError(t, err)
+	assert.True(t, cacheHit)
+}
+
+func TestSparseJob_DownloadsLastChunk(t *testing.T) {
+	st := newSparseJobTest(t, 20*util.MiB, 0)
+	job := st.jm.CreateJobIfNotExists(&st.object, st.bucket)
+
+	_, err := job.DownloadRange(context.Background(), testSparseObjectSize-2, testSparseObjectSize)
+
+	require.NoError(t, err)
+	st.verifyFileRange(t, st.object.Name, 10*util.MiB, testSparseObjectSize)
+	assert.EqualValues(t, 5, st.fileInfo(t, st.object.Name).Size())
+}
+
+func TestSparseJob_DownloadsNeighborChunks(t *testing.T) {
+	st := newSparseJobTest(t, 20*util.MiB, 2)
+	job := st.jm.CreateJobIfNotExists(&st.object, st.bucket)
+
+	_, err := job.DownloadRange(context.Background(), 9*util.MiB-1, 9*util.MiB)
+	require.NoError(t, err)
+	waitForFetches(job)
+
+	// Only one neighbor is left before the end of the object.
+	assert.Equal(t, []uint64{8, 9, 10}, st.fileInfo(t, st.object.Name).Chunks.Chunks())
+	st.verifyFileRange(t, st.object.Name, 8*util.MiB, testSparseObjectSize)
+}
+
+func TestSparseJob_EvictsOtherFiles(t *testing.T) {
+	st := newSparseJobTest(t, 3*util.MiB, 0)
+	other, _ := st.createObject(t, "path/in/gcs/bar.txt")
+	otherJob := st.jm.CreateJobIfNotExists(&other, st.bucket)
+	_, err := otherJob.DownloadRange(context.Background(), 0, 2*util.MiB)
+	require.NoError(t, err)
+	job := st.jm.CreateJobIfNotExists(&st.object, st.bucket)
+
+	_, err = job.DownloadRange(context.Background(), 0, 2*util.MiB)
+
+	require.NoError(t, err)
+	require.Len(t, st.evicted, 1)
+	assert.Equal(t, other.Name, st.evicted[0].(data.FileInfo).Key.ObjectName)
+	assert.EqualValues(t, 2*util.MiB, st.evicted[0].Size())
+	assert.EqualValues(t, 2*util.MiB, st.fileInfo(t, st.object.Name).Size())
+}
+
+func TestSparseJob_DropsOwnChunksWhenCacheIsTooSmall(t *testing.T) {
+	st := newSparseJobTest(t, 2*util.MiB, 0)
+	job := st.jm.CreateJobIfNotExists(&st.object, st.bucket)
+	_, err := job.DownloadRange(context.Background(), 0, 2*util.MiB)
+	require.NoError(t, err)
+
+	cacheHit, err := job.DownloadRange(context.Background(), 5*util.MiB, 5*util.MiB+1)
+
+	require.NoError(t, err)
+	assert.False(t, cacheHit)
+	fileInfo := st.fileInfo(t, st.object.Name)
+	assert.Equal(t, []uint64{1, 5}, fileInfo.Chunks.Chunks())
+	assert.EqualValues(t, 2*util.MiB, fileInfo.Size())
+	st.verifyFileRange(t, st.object.Name, util.MiB, 2*util.MiB)
+	st.verifyFileRange(t, st.object.Name, 5*util.MiB, 6*util.MiB)
+	assert.Empty(t, st.evicted)
+}
+
+func TestSparseJob_DropsLeastRecentlyReadChunks(t *testing.T) {
+	st := newSparseJobTest(t, 2*util.MiB, 0)
+	job := st.jm.CreateJobIfNotExists(&st.object, st.bucket)
+	_, err := job.DownloadRange(context.Background(), 0, 2*util.MiB)
+	require.NoError(t, err)
+	cacheHit, err := job.DownloadRange(context.Background(), 0, 1)
+	require.NoError(t, err)
+	require.True(t, cacheHit)
+
+	_, err = job.DownloadRange(context.Background(), 5*util.MiB, 5*util.MiB+1)
+
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{0, 5}, st.fileInfo(t, st.object.Name).Chunks.Chunks())
+	st.verifyFileRange(t, st.object.Name, 0, util.MiB)
+}
+
+func TestSparseJob_FileRemoved(t *testing.T) {
+	st := newSparseJobTest(t, 20*util.MiB, 0)
+	job := st.jm.CreateJobIfNotExists(&st.object, st.bucket)
+	require.NoError(t, os.Remove(st.filePath(st.object.Name)))
+
+	_, err := job.DownloadRange(context.Background(), 0, 1)
+
+	require.Error(t, err)
+	assert.Equal(t, Invalid, job.GetStatus().Name)
+	_, err = os.Stat(st.filePath(st.object.Name))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSparseJob_Invalidate(t *testing.T) {
+	st := newSparseJobTest(t, 20*util.MiB, 0)
+	job := st.jm.CreateJobIfNotExists(&st.object, st.bucket)
+	_, err := job.DownloadRange(context.Background(), 0, 1)
+	require.NoError(t, err)
+
+	job.Invalidate()
+
+	assert.Equal(t, Invalid, job.GetStatus().Name)
+	assert.Nil(t, st.jm.GetJob(st.object.Name, st.bucket.Name()))
+	_, err = job.DownloadRange(context.Background(), 0, 1)
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), util.InvalidFileDownloadJobErrMsg))
+}
+
+func TestSparseJob_EntryRemovedFromCache(t *testing.T) {
+	st := newSparseJobTest(t, 20*util.MiB, 0)
+	job := st.jm.CreateJobIfNotExists(&st.object, st.bucket)
+	fileInfoKeyName, err := st.fileInfo(t, st.object.Name).Key.Key()
+	require.NoError(t, err)
+	st.cache.Erase(fileInfoKeyName)
+
+	_, err = job.DownloadRange(context.Background(), 0, 1)
+
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), lru.EntryNotExistErrMsg))
+	assert.Equal(t, Invalid, job.GetStatus().Name)
+	assert.Nil(t, st.jm.GetJob(st.object.Name, st.bucket.Name()))
+}
+
+func TestSparseJob_RangeBeyondObject(t *testing.T) {
+	st := newSparseJobTest(t, 20*util.MiB, 0)
+	job := st.jm.CreateJobIfNotExists(&st.object, st.bucket)
+
+	_, err := job.DownloadRange(context.Background(), 0, testSparseObjectSize+1)
+
+	assert.Error(t, err)
+	assert.Equal(t, NotStarted, job.GetStatus().Name)
+}
+
+func TestSparseJob_Resumed(t *testing.T) {
+	st := newSparseJobTest(t, 20*util.MiB, 0)
+	job := st.jm.CreateJobIfNotExists(&st.object, st.bucket)
+	fileInfo := st.fileInfo(t, st.object.Name)
+	fileInfo.Chunks = fileInfo.Chunks.With(3)
+	job.Resume(fileInfo)
+
+	cacheHit, err := job.DownloadRange(context.Background(), 3*util.MiB, 4*util.MiB+1)
+
+	require.NoError(t, err)
+	// Chunk 3 isn't downloaded again, so the file holds none of it.
+	assert.False(t, cacheHit)
+	st.verifyFileRange(t, st.object.Name, 4*util.MiB, 5*util.MiB)
+	fileContent, err := os.ReadFile(st.filePath(st.object.Name))
+	require.NoError(t, err)
+	assert.Equal(t, make([]byte, util.MiB), fileContent[3*util.MiB:4*util.MiB])
+	assert.Equal(t, []uint64{3, 4}, st.fileInfo(t, st.object.Name).Chunks.Chunks())
+}
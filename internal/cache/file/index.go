@@ -0,0 +1,293 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"golang.org/x/sys/unix"
+)
+
+// The index of the file cache records the entries of the file info cache at
+// unmount in a JSON file inside the cache directory, so that the next mount can
+// reuse the files in cache rather than download the objects again. The entries
+// aren't checked against GCS when recovered, but as the objects are read,
+// through the generations recorded. The files are checked against the entries
+// though: their sizes and sparse extents when recovered, and the checksums of
+// fully downloaded files when first read.
+
+// fileCacheIndex is the contents of the index file.
+type fileCacheIndex struct {
+	// The entries from the least to the most recently used.
+	Entries []indexEntry
+}
+
+// indexEntry records a data.FileInfo.
+type indexEntry struct {
+	BucketName         string
+	BucketCreationTime time.Time
+	ObjectName         string
+	ObjectGeneration   int64
+	FileSize           uint64
+
+	// The offset the object is downloaded till, unless it is cached as a sparse
+	// file, in which case SparseChunkSize is non-zero and Chunks lists the
+	// chunks downloaded.
+	Offset          uint64
+	SparseChunkSize uint64   `json:",omitempty"`
+	Chunks          []uint64 `json:",omitempty"`
+
+	// The checksum of the object, if fully downloaded.
+	CRC32C *uint32 `json:",omitempty"`
+}
+
+func newIndexEntry(fileInfo data.FileInfo) indexEntry {
+	e := indexEntry{
+		BucketName:         fileInfo.Key.BucketName,
+		BucketCreationTime: fileInfo.Key.BucketCreationTime,
+		ObjectName:         fileInfo.Key.ObjectName,
+		ObjectGeneration:   fileInfo.ObjectGeneration,
+		FileSize:           fileInfo.FileSize,
+		Offset:             fileInfo.Offset,
+		CRC32C:             fileInfo.CRC32C,
+	}
+	if fileInfo.Chunks != nil {
+		e.SparseChunkSize = fileInfo.Chunks.ChunkSize()
+		e.Chunks = fileInfo.Chunks.Chunks()
+	}
+	return e
+}
+
+// fileInfo returns the data.FileInfo the entry records, or false if it doesn't
+// fit in a cache of sparse files of the given chunk size, zero meaning that
+// files aren't sparse.
+func (e indexEntry) fileInfo(sparseChunkSize uint64) (data.FileInfo, bool) {
+	fileInfo := data.FileInfo{
+		Key: data.FileInfoKey{
+			BucketName:         e.BucketName,
+			BucketCreationTime: e.BucketCreationTime,
+			ObjectName:         e.ObjectName,
+		},
+		ObjectGeneration: e.ObjectGeneration,
+		FileSize:         e.FileSize,
+		Offset:           e.Offset,
+		CRC32C:           e.CRC32C,
+	}
+	if e.SparseChunkSize != sparseChunkSize || e.Offset > e.FileSize {
+		return fileInfo, false
+	}
+
+	if sparseChunkSize > 0 {
+		fileInfo.Chunks = data.NewChunkBitmap(sparseChunkSize, e.FileSize)
+		for _, i := range e.Chunks {
+			if i >= fileInfo.Chunks.NumChunks() {
+				return fileInfo, false
+			}
+			fileInfo.Chunks = fileInfo.Chunks.With(i)
+		}
+	}
+	return fileInfo, true
+}
+
+// checkRecoveredFile returns an error if the file at the given path doesn't
+// hold what the file info says was downloaded: the bytes till the offset, or
+// the chunks of a sparse file, which must not be holes.
+func checkRecoveredFile(localFilePath string, fileInfo data.FileInfo) error {
+	f, err := os.Open(localFilePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := uint64(stat.Size())
+	if size > fileInfo.FileSize {
+		return fmt.Errorf("file is %d bytes, larger than the object of %d bytes", size, fileInfo.FileSize)
+	}
+	if fileInfo.Chunks == nil {
+		if size < fileInfo.Offset {
+			return fmt.Errorf("file is %d bytes, but %d were downloaded", size, fileInfo.Offset)
+		}
+		return nil
+	}
+
+	fd := int(f.Fd())
+	for _, i := range fileInfo.Chunks.Chunks() {
+		start, end := fileInfo.Chunks.ChunkRange(i)
+		if size < end {
+			return fmt.Errorf("file is %d bytes, but chunk %d ends at %d", size, i, end)
+		}
+		dataStart, err := unix.Seek(fd, int64(start), unix.SEEK_DATA)
+		if err != nil {
+			return fmt.Errorf("while seeking data of chunk %d: %w", i, err)
+		}
+		holeStart, err := unix.Seek(fd, int64(start), unix.SEEK_HOLE)
+		if err != nil {
+			return fmt.Errorf("while seeking hole after chunk %d: %w", i, err)
+		}
+		if uint64(dataStart) != start || uint64(holeStart) < end {
+			return fmt.Errorf("chunk %d at [%d, %d) isn't all data", i, start, end)
+		}
+	}
+	return nil
+}
+
+// checkRecoveredChecksum returns an error if the file of an entry recovered
+// from the index is fully downloaded but its checksum differs from the
+// object's. Entries without a checksum aren't checked.
+func checkRecoveredChecksum(localFilePath string, fileInfo data.FileInfo) error {
+	if fileInfo.CRC32C == nil || fileInfo.Chunks != nil || fileInfo.Offset < fileInfo.FileSize {
+		return nil
+	}
+	crc, err := util.CalculateFileCRC32(context.Background(), localFilePath)
+	if err != nil {
+		return err
+	}
+	if crc != *fileInfo.CRC32C {
+		return fmt.Errorf("checksum mismatch detected. Actual: %d, expected: %d", crc, *fileInfo.CRC32C)
+	}
+	return nil
+}
+
+func (chr *CacheHandler) indexPath() string {
+	return path.Join(chr.cacheDir, util.FileCacheIndex)
+}
+
+// RecoverIndex adds the entries of the index written by a previous mount to
+// the file info cache, in the same order of use, and has Destroy write the
+// index again. Entries whose file is missing or doesn't hold what was
+// downloaded, or which no longer fit the cache, are dropped. The files of the entries are resumed rather than downloaded
+// afresh if their objects have the same generation when next read.
+//
+// Acquires and releases LOCK(chr.mu)
+func (chr *CacheHandler) RecoverIndex() error {
+	chr.mu.Lock()
+	defer chr.mu.Unlock()
+
+	chr.persistIndex = true
+	contents, err := os.ReadFile(chr.indexPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("RecoverIndex: while reading index: %w", err)
+	}
+
+	// The files in cache change from now on, so the index must not be recovered
+	// again should this mount crash before writing it.
+	if err = os.Remove(chr.indexPath()); err != nil {
+		return fmt.Errorf("RecoverIndex: while removing index: %w", err)
+	}
+
+	var index fileCacheIndex
+	if err = json.Unmarshal(contents, &index); err != nil {
+		return fmt.Errorf("RecoverIndex: while parsing index: %w", err)
+	}
+
+	for _, e := range index.Entries {
+		fileInfo, ok := e.fileInfo(chr.jobManager.SparseChunkSize())
+		localFilePath := util.GetDownloadPath(chr.cacheDir, util.GetObjectPath(e.BucketName, e.ObjectName))
+		if !ok {
+			logger.Infof("RecoverIndex: dropping %s, which doesn't fit the file cache config", localFilePath)
+			if err = util.TruncateAndRemoveFile(localFilePath); err != nil && !os.IsNotExist(err) {
+				logger.Warnf("RecoverIndex: while removing %s: %v", localFilePath, err)
+			}
+			continue
+		}
+		if err = checkRecoveredFile(localFilePath, fileInfo); err != nil {
+			logger.Warnf("RecoverIndex: dropping entry for %s: %v", localFilePath, err)
+			if err = util.TruncateAndRemoveFile(localFilePath); err != nil && !os.IsNotExist(err) {
+				logger.Warnf("RecoverIndex: while removing %s: %v", localFilePath, err)
+			}
+			continue
+		}
+
+		fileInfoKeyName, err := fileInfo.Key.Key()
+		if err != nil {
+			logger.Warnf("RecoverIndex: while creating key for %s: %v", localFilePath, err)
+			continue
+		}
+		evictedValues, err := chr.fileInfoCache.Insert(fileInfoKeyName, fileInfo)
+		if err != nil {
+			logger.Warnf("RecoverIndex: while inserting %s into the cache: %v", localFilePath, err)
+			if err = util.TruncateAndRemoveFile(localFilePath); err != nil && !os.IsNotExist(err) {
+				logger.Warnf("RecoverIndex: while removing %s: %v", localFilePath, err)
+			}
+			continue
+		}
+		chr.recovered[fileInfoKeyName] = struct{}{}
+
+		// The cache may have shrunk since the index was written.
+		for _, val := range evictedValues {
+			evictedFileInfo := val.(data.FileInfo)
+			if err = chr.cleanUpEvictedFile(&evictedFileInfo); err != nil {
+				logger.Warnf("RecoverIndex: while performing post eviction of %s object: %v", evictedFileInfo.Key.ObjectName, err)
+			}
+		}
+	}
+
+	logger.Infof("RecoverIndex: recovered %d entries of the file cache", len(chr.recovered))
+	return nil
+}
+
+// writeIndex writes the entries of the file info cache to the index, replacing
+// it atomically so that a crash leaves either no or a whole index behind.
+//
+// Requires LOCK(chr.mu)
+func (chr *CacheHandler) writeIndex() error {
+	values := chr.fileInfoCache.Values()
+	index := fileCacheIndex{Entries: make([]indexEntry, 0, len(values))}
+	for _, val := range values {
+		index.Entries = append(index.Entries, newIndexEntry(val.(data.FileInfo)))
+	}
+
+	contents, err := json.Marshal(&index)
+	if err != nil {
+		return fmt.Errorf("writeIndex: json.Marshal failed for index: %w", err)
+	}
+
+	f, err := os.CreateTemp(chr.cacheDir, util.FileCacheIndex+".tmp")
+	if err != nil {
+		return fmt.Errorf("writeIndex: CreateTemp: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(contents)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writeIndex: while writing index: %w", err)
+	}
+
+	if err = os.Rename(f.Name(), chr.indexPath()); err != nil {
+		return fmt.Errorf("writeIndex: Rename: %w", err)
+	}
+	return nil
+}
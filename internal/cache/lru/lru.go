@@ -269,6 +269,58 @@ func (c *Cache) UpdateWithoutChangingOrder(
 	return nil
 }
 
+// Update updates the existing entry with the given key with the given value,
+// which may differ in size, and makes it the most recently used. Unlike
+// Insert, it returns an error if there is no entry with the given key. Also
+// returns a slice of ValueType evicted to make room for a larger value.
+func (c *Cache) Update(
+	key string,
+	value ValueType) ([]ValueType, error) {
+	if value == nil {
+		return nil, errors.New(InvalidEntryErrorMsg)
+	}
+
+	valueSize := value.Size()
+	if valueSize > c.maxSize {
+		return nil, errors.New(InvalidEntrySizeErrorMsg)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.index[key]
+	if !ok {
+		return nil, errors.New(EntryNotExistErrMsg)
+	}
+
+	c.currentSize -= e.Value.(entry).Value.Size()
+	c.currentSize += valueSize
+	e.Value = entry{key, value}
+	c.entries.MoveToFront(e)
+
+	// The updated entry isn't evicted, as it's in front and no larger than
+	// maxSize.
+	var evictedValues []ValueType
+	for c.currentSize > c.maxSize {
+		evictedValues = append(evictedValues, c.evictOne())
+	}
+
+	return evictedValues, nil
+}
+
+// Values returns the values in the cache from the least to the most recently
+// used, so that inserting them in order into an empty cache restores it.
+func (c *Cache) Values() []ValueType {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	values := make([]ValueType, 0, c.entries.Len())
+	for e := c.entries.Back(); e != nil; e = e.Prev() {
+		values = append(values, e.Value.(entry).Value)
+	}
+	return values
+}
+
 func (c *Cache) EraseEntriesWithGivenPrefix(prefix string) {
 	for key := range c.index {
 		if strings.HasPrefix(key, prefix) {
@@ -276,6 +276,59 @@ func (t *CacheTest) TestUpdateNotChangeOrder() {
 	t.insertAndAssert(key3, data3, []int64{7}, nil)
 }
 
+func (t *CacheTest) TestUpdateWithSizeWhenKeyNotPresent() {
+	evicted, err := t.cache.Update("burrito", testData{Value: 23, DataSize: 4})
+
+	ExpectEq(0, len(evicted))
+	ExpectNe(nil, err)
+	ExpectTrue(strings.Contains(err.Error(), lru.EntryNotExistErrMsg))
+	ExpectEq(nil, t.cache.LookUp("burrito"))
+}
+
+func (t *CacheTest) TestUpdateWithSizeEvictsOthers() {
+	t.insertAndAssert("burrito1", testData{Value: 1, DataSize: 20}, []int64{}, nil)
+	t.insertAndAssert("burrito2", testData{Value: 2, DataSize: 20}, []int64{}, nil)
+	t.insertAndAssert("burrito3", testData{Value: 3, DataSize: 10}, []int64{}, nil)
+
+	// Growing the least recently used entry makes it the most recently used,
+	// so that the entries after it are evicted instead.
+	evicted, err := t.cache.Update("burrito1", testData{Value: 4, DataSize: 45})
+
+	AssertEq(nil, err)
+	AssertEq(2, len(evicted))
+	ExpectEq(2, evicted[0].(testData).Value)
+	ExpectEq(3, evicted[1].(testData).Value)
+	ExpectEq(4, t.cache.LookUp("burrito1").(testData).Value)
+}
+
+func (t *CacheTest) TestUpdateWithSizeMoreThanCacheMaxSize() {
+	t.insertAndAssert("burrito", testData{Value: 23, DataSize: 4}, []int64{}, nil)
+
+	_, err := t.cache.Update("burrito", testData{Value: 2, DataSize: MaxSize + 1})
+
+	ExpectNe(nil, err)
+	ExpectTrue(strings.Contains(err.Error(), lru.InvalidEntrySizeErrorMsg))
+	ExpectEq(23, t.cache.LookUp("burrito").(testData).Value)
+}
+
+func (t *CacheTest) TestValuesFromLeastRecentlyUsed() {
+	t.insertAndAssert("burrito1", testData{Value: 1, DataSize: 4}, []int64{}, nil)
+	t.insertAndAssert("burrito2", testData{Value: 2, DataSize: 4}, []int64{}, nil)
+	t.insertAndAssert("burrito3", testData{Value: 3, DataSize: 4}, []int64{}, nil)
+	_ = t.cache.LookUp("burrito1")
+
+	values := t.cache.Values()
+
+	AssertEq(3, len(values))
+	ExpectEq(2, values[0].(testData).Value)
+	ExpectEq(3, values[1].(testData).Value)
+	ExpectEq(1, values[2].(testData).Value)
+}
+
+func (t *CacheTest) TestValuesWhenEmpty() {
+	ExpectEq(0, len(t.cache.Values()))
+}
+
 func (t *CacheTest) TestLookUpWithoutChangingOrder_WhenKeyPresent() {
 	key := "burrito"
 	data := testData{Value: 23, DataSize: 4}
@@ -0,0 +1,236 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
+)
+
+// BlockCache keeps the contents of objects in memory as blocks of a fixed
+// size, evicting the least recently used ones once they exceed its size. It is
+// meant to be shared by all the readers of a mount, and is safe for concurrent
+// access.
+//
+// Blocks are keyed by the bucket, name and generation of their object, so a
+// generation that has been replaced is never read again and its blocks are
+// eventually evicted.
+type BlockCache struct {
+	/////////////////////////
+	// Constant data
+	/////////////////////////
+
+	// INVARIANT: blockSize > 0
+	blockSize    int64
+	metricHandle common.MetricHandle
+
+	/////////////////////////
+	// Mutable state
+	/////////////////////////
+
+	// The cached blocks by blockKey, of type block.
+	blocks *lru.Cache
+
+	mu sync.Mutex
+
+	// The fetches of blocks in flight by blockKey, which concurrent reads of
+	// the same block wait for rather than fetching it again.
+	//
+	// GUARDED_BY(mu)
+	fetches map[string]*blockFetch
+}
+
+// block is the contents of the object in [i*blockSize, (i+1)*blockSize) for
+// some i, shorter at the end of the object.
+type block []byte
+
+func (b block) Size() uint64 {
+	return uint64(len(b))
+}
+
+type blockFetch struct {
+	// Closed once the fetch has finished, after which b and err may be read.
+	done chan struct{}
+	b    block
+	err  error
+}
+
+// NewBlockCache returns a cache of blocks of blockSize bytes holding at most
+// maxSize bytes.
+//
+// REQUIRES: 0 < blockSize <= maxSize
+func NewBlockCache(maxSize uint64, blockSize int64, metricHandle common.MetricHandle) *BlockCache {
+	return &BlockCache{
+		blockSize:    blockSize,
+		metricHandle: metricHandle,
+		blocks:       lru.NewCache(maxSize),
+		fetches:      make(map[string]*blockFetch),
+	}
+}
+
+// blockKey identifies the block with the given index of the generation of the
+// object. Bucket names contain no "/" and the last two components are
+// numbers, so keys of different blocks never collide.
+func blockKey(bucketName string, o *gcs.MinObject, index int64) string {
+	return fmt.Sprintf("%s/%s/%d/%d", bucketName, o.Name, o.Generation, index)
+}
+
+// Read matches the semantics of io.ReaderAt for the contents of the object,
+// reading the blocks the cache lacks with bucket and inserting them. It also
+// tells whether all the blocks read were cached.
+func (c *BlockCache) Read(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	o *gcs.MinObject,
+	offset int64,
+	p []byte) (n int, cacheHit bool, err error) {
+	size := int64(o.Size)
+	if offset >= size {
+		err = io.EOF
+		return
+	}
+
+	end := min(offset+int64(len(p)), size)
+	first := offset / c.blockSize
+	blocks := make([]block, (end-1)/c.blockSize-first+1)
+	cacheHit = true
+	for i := range blocks {
+		if v := c.blocks.LookUp(blockKey(bucket.Name(), o, first+int64(i))); v != nil {
+			blocks[i] = v.(block)
+		} else {
+			cacheHit = false
+		}
+	}
+
+	// Fetch the missing blocks concurrently.
+	errs := make([]error, len(blocks))
+	var wg sync.WaitGroup
+	for i := range blocks {
+		if blocks[i] != nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			blocks[i], errs[i] = c.fetch(ctx, bucket, o, first+int64(i))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, b := range blocks {
+		if errs[i] != nil {
+			err = errs[i]
+			break
+		}
+
+		pos := offset + int64(n)
+		n += copy(p[n:], b[pos-(first+int64(i))*c.blockSize:])
+	}
+
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+
+	hit := []common.MetricAttr{{Key: common.CacheHit, Value: strconv.FormatBool(cacheHit)}}
+	c.metricHandle.MemoryCacheReadCount(ctx, 1, hit)
+	c.metricHandle.MemoryCacheReadBytesCount(ctx, int64(n), hit)
+	return
+}
+
+// fetch returns the block with the given index of the object once it has been
+// read and inserted into the cache, joining the fetch of the block in flight if
+// any.
+func (c *BlockCache) fetch(ctx context.Context, bucket gcs.Bucket, o *gcs.MinObject, index int64) (block, error) {
+	key := blockKey(bucket.Name(), o, index)
+
+	c.mu.Lock()
+	f, ok := c.fetches[key]
+	if !ok {
+		// A fetch inserts its block before it's removed from fetches, so the
+		// block may have been cached since the caller looked it up.
+		if v := c.blocks.LookUp(key); v != nil {
+			c.mu.Unlock()
+			return v.(block), nil
+		}
+
+		f = &blockFetch{done: make(chan struct{})}
+		c.fetches[key] = f
+
+		// The fetch outlives the read that started it, so that a cancelled read
+		// doesn't fail the others waiting for the block.
+		go c.runFetch(bucket, o, index, key, f)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.b, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *BlockCache) runFetch(bucket gcs.Bucket, o *gcs.MinObject, index int64, key string, f *blockFetch) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.fetches, key)
+		c.mu.Unlock()
+		close(f.done)
+	}()
+
+	ctx := context.Background()
+	start := index * c.blockSize
+	limit := min(start+c.blockSize, int64(o.Size))
+	rc, err := bucket.NewReader(
+		ctx,
+		&gcs.ReadObjectRequest{
+			Name:       o.Name,
+			Generation: o.Generation,
+			Range: &gcs.ByteRange{
+				Start: uint64(start),
+				Limit: uint64(limit),
+			},
+			ReadCompressed: o.HasContentEncodingGzip(),
+		})
+	if err != nil {
+		f.err = fmt.Errorf("NewReader: %w", err)
+		return
+	}
+	defer rc.Close()
+
+	// Only random reads are served by the cache.
+	common.CaptureGCSReadMetrics(ctx, c.metricHandle, util.Random, limit-start)
+
+	b := make(block, limit-start)
+	if _, err = io.ReadFull(rc, b); err != nil {
+		f.err = fmt.Errorf("reading block %d: %w", index, err)
+		return
+	}
+
+	if _, err = c.blocks.Insert(key, b); err != nil {
+		f.err = fmt.Errorf("inserting block %d: %w", index, err)
+		return
+	}
+	f.b = b
+}
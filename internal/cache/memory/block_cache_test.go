@@ -0,0 +1,277 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+const testBlockSize = 10
+
+// countingBucket counts the readers opened on its objects, each of which
+// waits for unblocked to be closed.
+type countingBucket struct {
+	gcs.Bucket
+
+	mu        sync.Mutex
+	readers   int
+	unblocked chan struct{}
+}
+
+func (b *countingBucket) NewReader(ctx context.Context, req *gcs.ReadObjectRequest) (io.ReadCloser, error) {
+	b.mu.Lock()
+	b.readers++
+	b.mu.Unlock()
+
+	<-b.unblocked
+	return b.Bucket.NewReader(ctx, req)
+}
+
+func (b *countingBucket) readerCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.readers
+}
+
+type cacheReadMetrics struct {
+	common.MetricHandle
+
+	mu       sync.Mutex
+	reads    map[string]int64
+	bytes    map[string]int64
+	gcsReads map[string]int64
+	gcsBytes map[string]int64
+}
+
+func (m *cacheReadMetrics) MemoryCacheReadCount(_ context.Context, inc int64, attrs []common.MetricAttr) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reads[attrs[0].Value] += inc
+}
+
+func (m *cacheReadMetrics) MemoryCacheReadBytesCount(_ context.Context, inc int64, attrs []common.MetricAttr) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bytes[attrs[0].Value] += inc
+}
+
+func (m *cacheReadMetrics) GCSReadCount(_ context.Context, inc int64, attrs []common.MetricAttr) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gcsReads[attrs[0].Value] += inc
+}
+
+func (m *cacheReadMetrics) GCSDownloadBytesCount(_ context.Context, inc int64, attrs []common.MetricAttr) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gcsBytes[attrs[0].Value] += inc
+}
+
+type BlockCacheTest struct {
+	suite.Suite
+	ctx      context.Context
+	bucket   *countingBucket
+	object   *gcs.MinObject
+	contents []byte
+	metrics  *cacheReadMetrics
+	cache    *BlockCache
+}
+
+func TestBlockCacheSuite(t *testing.T) {
+	suite.Run(t, new(BlockCacheTest))
+}
+
+func (t *BlockCacheTest) SetupTest() {
+	t.ctx = context.Background()
+	t.bucket = &countingBucket{
+		Bucket:    fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical),
+		unblocked: make(chan struct{}),
+	}
+	close(t.bucket.unblocked)
+	t.object = t.createObject("foo", 4*testBlockSize+5)
+	t.metrics = &cacheReadMetrics{
+		MetricHandle: common.NewNoopMetrics(),
+		reads:        make(map[string]int64),
+		bytes:        make(map[string]int64),
+		gcsReads:     make(map[string]int64),
+		gcsBytes:     make(map[string]int64),
+	}
+	t.cache = NewBlockCache(3*testBlockSize, testBlockSize, t.metrics)
+}
+
+func (t *BlockCacheTest) createObject(name string, size int) *gcs.MinObject {
+	t.contents = make([]byte, size)
+	for i := range t.contents {
+		t.contents[i] = byte(i)
+	}
+	o, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:     name,
+		Contents: bytes.NewReader(t.contents),
+	})
+	require.NoError(t.T(), err)
+	return &gcs.MinObject{Name: o.Name, Size: o.Size, Generation: o.Generation}
+}
+
+func (t *BlockCacheTest) read(offset int64, size int) ([]byte, bool, error) {
+	p := make([]byte, size)
+	n, cacheHit, err := t.cache.Read(t.ctx, t.bucket, t.object, offset, p)
+	return p[:n], cacheHit, err
+}
+
+func (t *BlockCacheTest) TestMissThenHit() {
+	read, cacheHit, err := t.read(3, 5)
+
+	require.NoError(t.T(), err)
+	assert.False(t.T(), cacheHit)
+	assert.Equal(t.T(), t.contents[3:8], read)
+
+	read, cacheHit, err = t.read(0, testBlockSize)
+
+	require.NoError(t.T(), err)
+	assert.True(t.T(), cacheHit)
+	assert.Equal(t.T(), t.contents[:testBlockSize], read)
+	assert.Equal(t.T(), 1, t.bucket.readerCount())
+	assert.Equal(t.T(), map[string]int64{"false": 1, "true": 1}, t.metrics.reads)
+	assert.Equal(t.T(), map[string]int64{"false": 5, "true": testBlockSize}, t.metrics.bytes)
+}
+
+func (t *BlockCacheTest) TestFetchesRecordGCSReads() {
+	_, _, err := t.read(3, 5)
+	require.NoError(t.T(), err)
+	_, _, err = t.read(0, testBlockSize)
+	require.NoError(t.T(), err)
+
+	assert.Equal(t.T(), map[string]int64{"Random": 1}, t.metrics.gcsReads)
+	assert.Equal(t.T(), map[string]int64{"Random": testBlockSize}, t.metrics.gcsBytes)
+}
+
+func (t *BlockCacheTest) TestReadSpanningBlocks() {
+	_, _, err := t.read(testBlockSize, 1)
+	require.NoError(t.T(), err)
+
+	read, cacheHit, err := t.read(5, 2*testBlockSize)
+
+	require.NoError(t.T(), err)
+	assert.False(t.T(), cacheHit)
+	assert.Equal(t.T(), t.contents[5:5+2*testBlockSize], read)
+	// Only the first and third blocks were missing.
+	assert.Equal(t.T(), 3, t.bucket.readerCount())
+}
+
+func (t *BlockCacheTest) TestReadAtEndOfObject() {
+	read, _, err := t.read(4*testBlockSize+2, testBlockSize)
+
+	assert.Equal(t.T(), io.EOF, err)
+	assert.Equal(t.T(), t.contents[4*testBlockSize+2:], read)
+
+	read, _, err = t.read(int64(t.object.Size), 1)
+
+	assert.Equal(t.T(), io.EOF, err)
+	assert.Empty(t.T(), read)
+}
+
+func (t *BlockCacheTest) TestEvictsLeastRecentlyUsedBlocks() {
+	for i := int64(0); i < 3; i++ {
+		_, _, err := t.read(i*testBlockSize, 1)
+		require.NoError(t.T(), err)
+	}
+	// Use the first block again, so that the second is evicted instead.
+	_, _, err := t.read(0, 1)
+	require.NoError(t.T(), err)
+
+	_, _, err = t.read(3*testBlockSize, 1)
+	require.NoError(t.T(), err)
+
+	_, cacheHit, err := t.read(0, 1)
+	require.NoError(t.T(), err)
+	assert.True(t.T(), cacheHit)
+	_, cacheHit, err = t.read(testBlockSize, 1)
+	require.NoError(t.T(), err)
+	assert.False(t.T(), cacheHit)
+}
+
+func (t *BlockCacheTest) TestGenerationsAreCachedSeparately() {
+	_, _, err := t.read(0, 1)
+	require.NoError(t.T(), err)
+	t.object = t.createObject("foo", testBlockSize)
+
+	read, cacheHit, err := t.read(0, testBlockSize)
+
+	require.NoError(t.T(), err)
+	assert.False(t.T(), cacheHit)
+	assert.Equal(t.T(), t.contents, read)
+}
+
+func (t *BlockCacheTest) TestConcurrentMissesFetchOnce() {
+	t.bucket.unblocked = make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			read, _, err := t.read(2, 3)
+			assert.NoError(t.T(), err)
+			assert.Equal(t.T(), t.contents[2:5], read)
+		}()
+	}
+	// Wait for the first fetch to start before letting it finish.
+	for t.bucket.readerCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(t.bucket.unblocked)
+
+	wg.Wait()
+
+	assert.Equal(t.T(), 1, t.bucket.readerCount())
+}
+
+func (t *BlockCacheTest) TestCancelledReadDoesNotFailOthers() {
+	t.bucket.unblocked = make(chan struct{})
+	ctx, cancel := context.WithCancel(t.ctx)
+	cancel()
+
+	_, _, err := t.cache.Read(ctx, t.bucket, t.object, 0, make([]byte, 1))
+
+	assert.ErrorIs(t.T(), err, context.Canceled)
+	close(t.bucket.unblocked)
+	read, _, err := t.read(0, 3)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), t.contents[:3], read)
+	assert.Equal(t.T(), 1, t.bucket.readerCount())
+}
+
+func (t *BlockCacheTest) TestMissingObject() {
+	err := t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "foo"})
+	require.NoError(t.T(), err)
+
+	_, _, err = t.read(0, 1)
+
+	var notFoundErr *gcs.NotFoundError
+	assert.True(t.T(), errors.As(err, &notFoundErr))
+}
@@ -49,6 +49,11 @@ const (
 	DefaultDirPerm   = os.FileMode(0700)
 	FileCache        = "gcsfuse-file-cache"
 	BufferSizeForCRC = 65536
+
+	// FileCacheIndex is the name of the index of the file cache inside its
+	// directory. Bucket names can't contain upper case letters, so it never
+	// clashes with the directory of a bucket.
+	FileCacheIndex = "FileCacheIndex.json"
 )
 
 // CreateFile creates file with given file spec i.e. permissions and returns
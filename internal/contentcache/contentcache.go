@@ -47,6 +47,15 @@ type ContentCache struct {
 	tempDir    string
 	fileMap    map[CacheObjectKey]*CacheObject
 	mtimeClock timeutil.Clock
+
+	// Journal entries found on disk by RecoverCache.
+	journal []*JournalEntry
+}
+
+// TempDir returns the directory in which temporary files are created. Empty
+// means the system default.
+func (c *ContentCache) TempDir() string {
+	return c.tempDir
 }
 
 // Metadata store struct
@@ -144,7 +153,8 @@ func (c *ContentCache) recoverFileFromCache(metadataFile fs.FileInfo) {
 	c.fileMap[*cacheObjectKey] = cacheObject
 }
 
-// RecoverCache recovers the cache with existing persisted files when gcsfuse starts
+// RecoverCache recovers the cache with existing persisted files when gcsfuse starts,
+// as well as the journal entries that are yet to be written back
 // RecoverCache should not be called concurrently
 func (c *ContentCache) RecoverCache() error {
 	if c.tempDir == "" {
@@ -167,6 +177,10 @@ func (c *ContentCache) RecoverCache() error {
 		}
 	}
 	for _, metadataFile := range files {
+		if !metadataFile.IsDir() && matchJournalPattern(metadataFile.Name()) {
+			c.recoverJournalEntry(metadataFile)
+			continue
+		}
 		c.recoverFileFromCache(metadataFile)
 	}
 	return nil
@@ -17,11 +17,14 @@ package contentcache_test
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/jacobsa/fuse/fsutil"
 	. "github.com/jacobsa/ogletest"
 	"github.com/jacobsa/timeutil"
@@ -159,3 +162,80 @@ func TestContentCacheRemove(t *testing.T) {
 	wg.Wait()
 	ExpectEq(contentCache.Size(), 0)
 }
+
+func newDirtyTempFile(contentCache *contentcache.ContentCache, contents string) gcsx.TempFile {
+	tf, err := contentCache.NewTempFile(io.NopCloser(strings.NewReader("taco")))
+	AssertEq(nil, err)
+	_, err = tf.WriteAt([]byte(contents), 0)
+	AssertEq(nil, err)
+	return tf
+}
+
+func TestJournalIsRecovered(t *testing.T) {
+	tempDir := t.TempDir()
+	contentCache := contentcache.New(tempDir, timeutil.RealClock())
+	tf := newDirtyTempFile(contentCache, "b")
+	defer tf.Destroy()
+	key := &contentcache.CacheObjectKey{BucketName: "foo", ObjectName: "baz"}
+	_, err := contentCache.AddToJournal(key, testGeneration, testMetaGeneration, nil, tf)
+	AssertEq(nil, err)
+
+	recovered := contentcache.New(tempDir, timeutil.RealClock())
+	err = recovered.RecoverCache()
+
+	AssertEq(nil, err)
+	AssertEq(0, recovered.Size())
+	entries := recovered.RecoveredJournal()
+	AssertEq(1, len(entries))
+	ExpectEq(key.BucketName, entries[0].Key().BucketName)
+	ExpectEq(key.ObjectName, entries[0].Key().ObjectName)
+	ExpectEq(testGeneration, entries[0].Metadata.SrcGeneration)
+	ExpectEq(testMetaGeneration, entries[0].Metadata.SrcMetaGeneration)
+	content, err := recovered.OpenJournalEntry(entries[0])
+	AssertEq(nil, err)
+	defer content.Destroy()
+	sr, err := content.Stat()
+	AssertEq(nil, err)
+	ExpectEq(4, sr.Size)
+	ExpectEq(0, sr.DirtyThreshold)
+	ExpectNe(nil, sr.Mtime)
+	ExpectEq("[{0 1}]", fmt.Sprint(content.DirtyRanges()))
+	buf := make([]byte, sr.Size)
+	_, err = content.ReadAt(buf, 0)
+	AssertEq(nil, err)
+	ExpectEq("baco", string(buf))
+}
+
+func TestJournalEntryDestroy(t *testing.T) {
+	tempDir := t.TempDir()
+	contentCache := contentcache.New(tempDir, timeutil.RealClock())
+	tf := newDirtyTempFile(contentCache, "b")
+	defer tf.Destroy()
+	entry, err := contentCache.AddToJournal(&contentcache.CacheObjectKey{BucketName: "foo", ObjectName: "baz"}, 0, 0, nil, tf)
+	AssertEq(nil, err)
+
+	entry.Destroy()
+
+	dirEntries, err := os.ReadDir(tempDir)
+	AssertEq(nil, err)
+	ExpectEq(0, len(dirEntries))
+}
+
+func TestConflictingJournalEntryIsNotRecovered(t *testing.T) {
+	tempDir := t.TempDir()
+	contentCache := contentcache.New(tempDir, timeutil.RealClock())
+	tf := newDirtyTempFile(contentCache, "b")
+	defer tf.Destroy()
+	entry, err := contentCache.AddToJournal(&contentcache.CacheObjectKey{BucketName: "foo", ObjectName: "baz"}, testGeneration, testMetaGeneration, nil, tf)
+	AssertEq(nil, err)
+	AssertEq(nil, entry.MarkConflict())
+
+	recovered := contentcache.New(tempDir, timeutil.RealClock())
+	err = recovered.RecoverCache()
+
+	AssertEq(nil, err)
+	ExpectEq(0, len(recovered.RecoveredJournal()))
+	// The contents are left for the user to recover.
+	_, err = os.Stat(entry.Metadata.FileNameOnDisk)
+	ExpectEq(nil, err)
+}
@@ -0,0 +1,280 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contentcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+)
+
+// The journal holds the contents of closed files that are yet to be written
+// back to GCS. Each entry is a copy of the contents in the temp directory plus
+// a JSON metadata file next to it, so that entries survive a crash and can be
+// replayed on the next mount.
+
+const JournalFilePrefix = "gcsfusejournal"
+
+// JournalEntryMetadata describes contents waiting to be written back.
+type JournalEntryMetadata struct {
+	FileNameOnDisk string
+	BucketName     string
+	ObjectName     string
+
+	// The generation of the object the contents were derived from, or zero if
+	// the object didn't exist.
+	SrcGeneration     int64
+	SrcMetaGeneration int64
+
+	// Custom metadata the object gets if it didn't exist.
+	NewObjectMetadata map[string]string
+
+	// The dirty threshold, dirty ranges and mtime of the contents, see
+	// gcsx.TempFile.
+	DirtyThreshold int64
+	DirtyRanges    []gcsx.DirtyRange
+	Mtime          *time.Time
+
+	// Set when the object was changed by someone else before the contents could
+	// be written back. Such entries are left for the user to recover, and not
+	// replayed.
+	Conflict bool
+}
+
+// JournalEntry is an entry of the journal on disk.
+type JournalEntry struct {
+	MetadataFileName string
+	Metadata         *JournalEntryMetadata
+}
+
+// Key returns the object the entry is to be written back to.
+func (e *JournalEntry) Key() CacheObjectKey {
+	return CacheObjectKey{
+		BucketName: e.Metadata.BucketName,
+		ObjectName: e.Metadata.ObjectName,
+	}
+}
+
+// MarkConflict records in the metadata file that the entry can't be written
+// back.
+func (e *JournalEntry) MarkConflict() error {
+	e.Metadata.Conflict = true
+	return writeJournalMetadata(e.MetadataFileName, e.Metadata)
+}
+
+// Destroy removes the entry from disk.
+func (e *JournalEntry) Destroy() {
+	os.Remove(e.Metadata.FileNameOnDisk)
+	os.Remove(e.MetadataFileName)
+}
+
+// journaledFile is a recovered cache file that reports the dirtiness its
+// contents had when they were journaled, so that syncing it writes them out.
+type journaledFile struct {
+	gcsx.TempFile
+	dirtyThreshold int64
+	dirtyRanges    []gcsx.DirtyRange
+	mtime          *time.Time
+}
+
+func (jf *journaledFile) DirtyRanges() []gcsx.DirtyRange {
+	return slices.Clone(jf.dirtyRanges)
+}
+
+func (jf *journaledFile) MarkClean() (err error) {
+	if err = jf.TempFile.MarkClean(); err != nil {
+		return
+	}
+
+	sr, err := jf.TempFile.Stat()
+	if err != nil {
+		return
+	}
+
+	jf.dirtyThreshold = sr.Size
+	jf.dirtyRanges = nil
+	jf.mtime = nil
+	return
+}
+
+func (jf *journaledFile) Stat() (sr gcsx.StatResult, err error) {
+	sr, err = jf.TempFile.Stat()
+	if err != nil {
+		return
+	}
+
+	sr.DirtyThreshold = min(jf.dirtyThreshold, sr.Size)
+	sr.Mtime = jf.mtime
+	return
+}
+
+// writeJournalMetadata replaces the metadata file atomically, so that a crash
+// leaves either the old or the new version behind.
+func writeJournalMetadata(metadataFileName string, metadata *JournalEntryMetadata) error {
+	contents, err := json.MarshalIndent(metadata, "", " ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent failed for journal metadata: %w", err)
+	}
+
+	f, err := os.CreateTemp(path.Dir(metadataFileName), path.Base(metadataFileName)+".tmp")
+	if err != nil {
+		return fmt.Errorf("CreateTemp: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(contents)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write journal metadata: %w", err)
+	}
+
+	if err = os.Rename(f.Name(), metadataFileName); err != nil {
+		return fmt.Errorf("Rename: %w", err)
+	}
+
+	return nil
+}
+
+// AddToJournal copies the content to the journal, along with the generation
+// of the object it was derived from and the custom metadata of the object if
+// it is to be created.
+func (c *ContentCache) AddToJournal(cacheObjectKey *CacheObjectKey, srcGeneration int64, srcMetaGeneration int64, newObjectMetadata map[string]string, content gcsx.TempFile) (*JournalEntry, error) {
+	sr, err := content.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("Stat: %w", err)
+	}
+
+	f, err := os.CreateTemp(c.tempDir, JournalFilePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("TempFile: %w", err)
+	}
+
+	_, err = io.Copy(f, io.NewSectionReader(content, 0, sr.Size))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("copy contents to journal: %w", err)
+	}
+
+	entry := &JournalEntry{
+		MetadataFileName: fmt.Sprintf("%s.json", f.Name()),
+		Metadata: &JournalEntryMetadata{
+			FileNameOnDisk:    f.Name(),
+			BucketName:        cacheObjectKey.BucketName,
+			ObjectName:        cacheObjectKey.ObjectName,
+			SrcGeneration:     srcGeneration,
+			SrcMetaGeneration: srcMetaGeneration,
+			NewObjectMetadata: maps.Clone(newObjectMetadata),
+			DirtyThreshold:    sr.DirtyThreshold,
+			DirtyRanges:       content.DirtyRanges(),
+			Mtime:             sr.Mtime,
+		},
+	}
+	if err = writeJournalMetadata(entry.MetadataFileName, entry.Metadata); err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// OpenJournalEntry returns the contents of the entry. The caller must call
+// Destroy on the TempFile before releasing it.
+func (c *ContentCache) OpenJournalEntry(e *JournalEntry) (gcsx.TempFile, error) {
+	f, err := os.Open(e.Metadata.FileNameOnDisk)
+	if err != nil {
+		return nil, fmt.Errorf("Open: %w", err)
+	}
+
+	tf, err := c.recoverCacheFile(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &journaledFile{
+		TempFile:       tf,
+		dirtyThreshold: e.Metadata.DirtyThreshold,
+		dirtyRanges:    e.Metadata.DirtyRanges,
+		mtime:          e.Metadata.Mtime,
+	}, nil
+}
+
+// recoverJournalEntry adds the entry described by the metadata file to the
+// entries to be replayed.
+func (c *ContentCache) recoverJournalEntry(metadataFile fs.FileInfo) {
+	var metadata JournalEntryMetadata
+	metadataAbsolutePath := path.Join(c.tempDir, metadataFile.Name())
+	contents, err := os.ReadFile(metadataAbsolutePath)
+	if err != nil {
+		logger.Errorf("content cache: Skip journal entry %v due to read error: %s", metadataFile.Name(), err)
+		return
+	}
+	err = json.Unmarshal(contents, &metadata)
+	if err != nil {
+		logger.Errorf("content cache: Skip journal entry %v due to file corruption: %s", metadataFile.Name(), err)
+		return
+	}
+	if metadata.Conflict {
+		logger.Warnf("content cache: Contents of %s/%s in %s conflict with the object and are not written back", metadata.BucketName, metadata.ObjectName, metadata.FileNameOnDisk)
+		return
+	}
+	if _, err = os.Stat(metadata.FileNameOnDisk); err != nil {
+		logger.Errorf("content cache: Skip journal entry %v due to error: %v", metadataFile.Name(), err)
+		return
+	}
+
+	c.journal = append(c.journal, &JournalEntry{
+		MetadataFileName: metadataAbsolutePath,
+		Metadata:         &metadata,
+	})
+}
+
+// RecoveredJournal returns the entries found by RecoverCache, which are yet
+// to be written back.
+func (c *ContentCache) RecoveredJournal() []*JournalEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.journal
+}
+
+// matchJournalPattern matches the metadata file name of a journal entry.
+func matchJournalPattern(fileName string) bool {
+	match, err := regexp.MatchString(fmt.Sprintf("^%v[0-9]+[.]json$", JournalFilePrefix), fileName)
+	if err != nil {
+		return false
+	}
+	return match
+}
@@ -15,12 +15,15 @@
 package fs_test
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
 	. "github.com/jacobsa/oglematchers"
 	. "github.com/jacobsa/ogletest"
 	"github.com/jacobsa/timeutil"
@@ -40,11 +43,7 @@ func init() {
 
 func (t *AllBucketsTest) SetUpTestSuite() {
 	mtimeClock = timeutil.RealClock()
-	buckets = map[string]gcs.Bucket{
-		"bucket-0": fake.NewFakeBucket(mtimeClock, "bucket-0", gcs.NonHierarchical),
-		"bucket-1": fake.NewFakeBucket(mtimeClock, "bucket-1", gcs.NonHierarchical),
-		"bucket-2": fake.NewFakeBucket(mtimeClock, "bucket-2", gcs.NonHierarchical),
-	}
+	buckets = fake.NewFakeBuckets(mtimeClock, gcs.NonHierarchical, "bucket-0", "bucket-1", "bucket-2")
 	// buckets: {"some_bucket", "bucket-1", "bucket-2"}
 	t.fsTest.SetUpTestSuite()
 	AssertEq("", t.serverCfg.BucketName)
@@ -55,8 +54,14 @@ func (t *AllBucketsTest) SetUpTestSuite() {
 ////////////////////////////////////////////////////////////////////////
 
 func (t *AllBucketsTest) BaseDir_Ls() {
-	_, err := os.ReadDir(mntDir)
-	ExpectThat(err, Error(HasSubstr("operation not supported")))
+	entries, err := os.ReadDir(mntDir)
+
+	AssertEq(nil, err)
+	AssertEq(3, len(entries))
+	for i, e := range entries {
+		ExpectEq(fmt.Sprintf("bucket-%d", i), e.Name())
+		ExpectTrue(e.IsDir())
+	}
 }
 
 func (t *AllBucketsTest) BaseDir_Write() {
@@ -75,12 +80,58 @@ func (t *AllBucketsTest) BaseDir_Rename() {
 		filename, []byte("content"), os.FileMode(0644))
 	AssertEq(nil, err)
 
-	err = os.Rename(mntDir+"/bucket-0/foo", mntDir+"/bucket-1/foo")
-	ExpectThat(err, Error(HasSubstr("operation not supported")))
-
 	err = os.Rename(mntDir+"/bucket-0/foo", mntDir+"/bucket-99")
 	ExpectThat(err, Error(HasSubstr("input/output error")))
+}
+
+func (t *AllBucketsTest) CrossBucket_RenameFile() {
+	filename := path.Join(mntDir, "bucket-0/moved_file")
+	AssertEq(nil, os.WriteFile(filename, []byte("taco"), os.FileMode(0644)))
+
+	err := os.Rename(filename, path.Join(mntDir, "bucket-1/moved_file"))
+
+	AssertEq(nil, err)
+	contents, err := storageutil.ReadObject(ctx, buckets["bucket-1"], "moved_file")
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+	_, err = storageutil.ReadObject(ctx, buckets["bucket-0"], "moved_file")
+	var notFoundErr *gcs.NotFoundError
+	ExpectTrue(errors.As(err, &notFoundErr))
+	_, err = os.Stat(filename)
+	ExpectTrue(os.IsNotExist(err))
+}
 
+func (t *AllBucketsTest) CrossBucket_RenameDir() {
+	dirname := path.Join(mntDir, "bucket-0/moved_dir")
+	AssertEq(nil, os.MkdirAll(path.Join(dirname, "sub"), 0755))
+	AssertEq(nil, os.WriteFile(path.Join(dirname, "sub/file"), []byte("burrito"), os.FileMode(0644)))
+
+	err := os.Rename(dirname, path.Join(mntDir, "bucket-2/moved_dir"))
+
+	AssertEq(nil, err)
+	contents, err := os.ReadFile(path.Join(mntDir, "bucket-2/moved_dir/sub/file"))
+	AssertEq(nil, err)
+	ExpectEq("burrito", string(contents))
+	_, err = os.Stat(dirname)
+	ExpectTrue(os.IsNotExist(err))
+	_, err = storageutil.ReadObject(ctx, buckets["bucket-0"], "moved_dir/sub/file")
+	var notFoundErr *gcs.NotFoundError
+	ExpectTrue(errors.As(err, &notFoundErr))
+}
+
+func (t *AllBucketsTest) CrossBucket_RenameOpenLocalFile() {
+	filename := path.Join(mntDir, "bucket-0/local_file")
+	var err error
+	t.f1, err = os.Create(filename)
+	AssertEq(nil, err)
+
+	err = os.Rename(filename, path.Join(mntDir, "bucket-1/local_file"))
+
+	ExpectThat(err, Error(HasSubstr("operation not supported")))
+	AssertEq(nil, t.f1.Close())
+	t.f1 = nil
+	_, err = storageutil.ReadObject(ctx, buckets["bucket-0"], "local_file")
+	ExpectEq(nil, err)
 }
 
 func (t *AllBucketsTest) SingleBucket_ReadAfterWrite() {
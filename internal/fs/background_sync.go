@@ -0,0 +1,158 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/gcsfuse_errors"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+)
+
+// How often file inodes are checked for background sync, unless the age
+// threshold is shorter.
+const backgroundSyncInterval = time.Second
+
+// backgroundSyncPolicy decides which dirty files are synced in the background.
+// A zero threshold is disabled.
+type backgroundSyncPolicy struct {
+	age        time.Duration
+	dirtyBytes int64
+}
+
+func newBackgroundSyncPolicy(c *cfg.WriteConfig) backgroundSyncPolicy {
+	return backgroundSyncPolicy{
+		age:        c.ExperimentalBackgroundSyncAge,
+		dirtyBytes: c.ExperimentalBackgroundSyncDirtyBytes,
+	}
+}
+
+func (p backgroundSyncPolicy) enabled() bool {
+	return p.age > 0 || p.dirtyBytes > 0
+}
+
+func (p backgroundSyncPolicy) due(now time.Time, s inode.SyncStatus) bool {
+	if s.DirtySince.IsZero() {
+		return false
+	}
+
+	// Retrying is pointless once the object has been changed by someone else.
+	// That is for the user to find out on fsync or close.
+	var clobberedErr *gcsfuse_errors.FileClobberedError
+	if errors.As(s.LastErr, &clobberedErr) {
+		return false
+	}
+
+	return (p.age > 0 && now.Sub(s.DirtySince) >= p.age) ||
+		(p.dirtyBytes > 0 && s.DirtyBytes >= p.dirtyBytes)
+}
+
+// Start syncing files that are kept open and dirty past the thresholds of the
+// policy in the background, so that less of what has been written is lost if
+// the machine goes away before they are closed.
+func (fs *fileSystem) startBackgroundSync(policy backgroundSyncPolicy) {
+	interval := backgroundSyncInterval
+	if policy.age > 0 {
+		interval = min(interval, policy.age)
+	}
+
+	var ctx context.Context
+	ctx, fs.stopBackgroundSync = context.WithCancel(context.Background())
+	fs.backgroundSyncDone = make(chan struct{})
+	go func() {
+		defer close(fs.backgroundSyncDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fs.backgroundSyncFiles(ctx, policy)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Sync each file inode that is due according to the policy.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) backgroundSyncFiles(ctx context.Context, policy backgroundSyncPolicy) {
+	// File inodes are locked one at a time below, after fs.mu is released, as
+	// the lock order requires.
+	var files []*inode.FileInode
+	fs.mu.Lock()
+	for _, in := range fs.inodes {
+		if f, ok := in.(*inode.FileInode); ok {
+			files = append(files, f)
+		}
+	}
+	fs.mu.Unlock()
+
+	for _, f := range files {
+		if ctx.Err() != nil {
+			return
+		}
+		fs.backgroundSyncFile(ctx, f, policy)
+	}
+}
+
+// The upload is done without holding the inode lock, so that the file can be
+// used in the meantime.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(f)
+func (fs *fileSystem) backgroundSyncFile(
+	ctx context.Context,
+	f *inode.FileInode,
+	policy backgroundSyncPolicy) {
+	f.Lock()
+	if !policy.due(fs.mtimeClock.Now(), f.SyncStatus()) {
+		f.Unlock()
+		return
+	}
+
+	u, err := f.BackgroundSync(ctx)
+	f.Unlock()
+	if err != nil {
+		logger.Warnf("Background sync of %q: %v", f.Name().GcsObjectName(), err)
+		return
+	}
+	if u == nil {
+		return
+	}
+
+	select {
+	case <-u.Done():
+	case <-ctx.Done():
+		return
+	}
+
+	// A failure is recorded in the sync status of the inode, and the next
+	// attempt is made on a later tick or by the user.
+	f.Lock()
+	defer f.Unlock()
+	if err = fs.settleWriteBack(ctx, f); err != nil {
+		return
+	}
+	if err = u.Err(); err != nil {
+		logger.Warnf("Background sync of %q: %v", f.Name().GcsObjectName(), err)
+	}
+}
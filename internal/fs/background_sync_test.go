@@ -0,0 +1,161 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs_test
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+const backgroundSyncTimeout = 5 * time.Second
+
+// //////////////////////////////////////////////////////////////////////
+// Boilerplate
+// //////////////////////////////////////////////////////////////////////
+
+type backgroundSyncTest struct {
+	fsTest
+	suite.Suite
+}
+
+func (t *backgroundSyncTest) TearDownSuite() {
+	t.fsTest.TearDownTestSuite()
+}
+
+func (t *backgroundSyncTest) TearDownTest() {
+	t.fsTest.TearDown()
+	t.f1 = nil
+}
+
+func (t *backgroundSyncTest) objectContents(name string) string {
+	contents, err := storageutil.ReadObject(ctx, bucket, name)
+	if err != nil {
+		return ""
+	}
+	return string(contents)
+}
+
+// Files are synced once they have been dirty for a while.
+type BackgroundSyncAgeTest struct {
+	backgroundSyncTest
+}
+
+func TestBackgroundSyncAge(t *testing.T) {
+	suite.Run(t, new(BackgroundSyncAgeTest))
+}
+
+func (t *BackgroundSyncAgeTest) SetupSuite() {
+	t.serverCfg.NewConfig = &cfg.Config{
+		Write: cfg.WriteConfig{
+			ExperimentalBackgroundSyncAge: 50 * time.Millisecond,
+		},
+	}
+	t.fsTest.SetUpTestSuite()
+}
+
+// Files are synced once enough of them has been written.
+type BackgroundSyncDirtyBytesTest struct {
+	backgroundSyncTest
+}
+
+func TestBackgroundSyncDirtyBytes(t *testing.T) {
+	suite.Run(t, new(BackgroundSyncDirtyBytesTest))
+}
+
+func (t *BackgroundSyncDirtyBytesTest) SetupSuite() {
+	t.serverCfg.NewConfig = &cfg.Config{
+		Write: cfg.WriteConfig{
+			ExperimentalBackgroundSyncDirtyBytes: 8,
+		},
+	}
+	t.fsTest.SetUpTestSuite()
+}
+
+// //////////////////////////////////////////////////////////////////////
+// Tests
+// //////////////////////////////////////////////////////////////////////
+
+func (t *BackgroundSyncAgeTest) TestOpenFileIsSynced() {
+	f, err := os.Create(path.Join(mntDir, "foo"))
+	require.NoError(t.T(), err)
+	t.f1 = f
+	_, err = f.Write([]byte("taco"))
+	require.NoError(t.T(), err)
+
+	assert.Eventually(t.T(), func() bool {
+		return t.objectContents("foo") == "taco"
+	}, backgroundSyncTimeout, 10*time.Millisecond)
+
+	// The handle carries on working, and later writes are synced too.
+	_, err = f.Write([]byte("burrito"))
+	require.NoError(t.T(), err)
+	buf := make([]byte, len("tacoburrito"))
+	_, err = f.ReadAt(buf, 0)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "tacoburrito", string(buf))
+	assert.Eventually(t.T(), func() bool {
+		return t.objectContents("foo") == "tacoburrito"
+	}, backgroundSyncTimeout, 10*time.Millisecond)
+
+	// Closing the file finds nothing left to do.
+	t.f1 = nil
+	require.NoError(t.T(), f.Close())
+	assert.Equal(t.T(), "tacoburrito", t.objectContents("foo"))
+}
+
+func (t *BackgroundSyncAgeTest) TestExistingFileIsSynced() {
+	require.NoError(t.T(), t.createWithContents("foo", "taco"))
+	f, err := os.OpenFile(path.Join(mntDir, "foo"), os.O_RDWR, 0)
+	require.NoError(t.T(), err)
+	t.f1 = f
+
+	_, err = f.WriteAt([]byte("p"), 0)
+	require.NoError(t.T(), err)
+
+	assert.Eventually(t.T(), func() bool {
+		return t.objectContents("foo") == "paco"
+	}, backgroundSyncTimeout, 10*time.Millisecond)
+	fi, err := f.Stat()
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), int64(len("paco")), fi.Size())
+}
+
+func (t *BackgroundSyncDirtyBytesTest) TestFileIsSyncedPastDirtyBytes() {
+	f, err := os.Create(path.Join(mntDir, "foo"))
+	require.NoError(t.T(), err)
+	t.f1 = f
+	_, err = f.Write([]byte("taco"))
+	require.NoError(t.T(), err)
+
+	// Too little has been written so far.
+	assert.Never(t.T(), func() bool {
+		return t.objectContents("foo") != ""
+	}, 2*time.Second, 100*time.Millisecond)
+
+	_, err = f.Write([]byte("burrito"))
+	require.NoError(t.T(), err)
+
+	assert.Eventually(t.T(), func() bool {
+		return t.objectContents("foo") == "tacoburrito"
+	}, backgroundSyncTimeout, 10*time.Millisecond)
+}
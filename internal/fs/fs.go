@@ -24,6 +24,7 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
@@ -35,6 +36,7 @@ import (
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/memory"
 	cacheutil "github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/handle"
@@ -44,6 +46,7 @@ import (
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/writeback"
 	"github.com/jacobsa/fuse"
 	"github.com/jacobsa/fuse/fuseops"
 	"github.com/jacobsa/fuse/fuseutil"
@@ -147,7 +150,8 @@ func NewFileSystem(ctx context.Context, serverCfg *ServerConfig) (fuseutil.FileS
 
 	contentCache := contentcache.New(serverCfg.TempDir, mtimeClock)
 
-	if serverCfg.LocalFileCache {
+	// The journal of write-back lives in the same directory as the cache.
+	if serverCfg.LocalFileCache || serverCfg.NewConfig.Write.ExperimentalWriteBack {
 		err := contentCache.RecoverCache()
 		if err != nil {
 			fmt.Printf("Encountered error retrieving files from cache directory, disabling local file cache: %v", err)
@@ -166,6 +170,14 @@ func NewFileSystem(ctx context.Context, serverCfg *ServerConfig) (fuseutil.FileS
 		}
 	}
 
+	var memoryCache *memory.BlockCache
+	if cfg.IsMemoryCacheEnabled(&serverCfg.NewConfig.Read) {
+		memoryCache = memory.NewBlockCache(
+			uint64(serverCfg.NewConfig.Read.MemoryCacheMaxSizeMb)*cacheutil.MiB,
+			serverCfg.NewConfig.Read.MemoryCacheBlockSizeMb*cacheutil.MiB,
+			serverCfg.MetricHandle)
+	}
+
 	// Set up the basic struct.
 	fs := &fileSystem{
 		mtimeClock:                 mtimeClock,
@@ -190,19 +202,35 @@ func NewFileSystem(ctx context.Context, serverCfg *ServerConfig) (fuseutil.FileS
 		implicitDirInodes:          make(map[inode.Name]inode.DirInode),
 		folderInodes:               make(map[inode.Name]inode.DirInode),
 		localFileInodes:            make(map[inode.Name]inode.Inode),
+		pendingRewrites:            make(map[pendingRewrite]rewriteProgress),
 		handles:                    make(map[fuseops.HandleID]interface{}),
 		newConfig:                  serverCfg.NewConfig,
 		fileCacheHandler:           fileCacheHandler,
 		cacheFileForRangeRead:      serverCfg.NewConfig.FileCache.CacheFileForRangeRead,
+		memoryCache:                memoryCache,
 		globalMaxBlocksSem:         semaphore.NewWeighted(serverCfg.NewConfig.Write.GlobalMaxBlocks),
+		readaheadBlocksSem:         semaphore.NewWeighted(serverCfg.NewConfig.Read.ReadaheadGlobalMaxBlocks),
 		metricHandle:               serverCfg.MetricHandle,
 	}
 
+	if serverCfg.NewConfig.Write.ExperimentalWriteBack {
+		fs.writeBackUploader = writeback.NewUploader(
+			contentCache,
+			writeBackMaxParallel,
+			writeBackMaxAttempts,
+			writeBackInitialBackoff,
+			writeBackMaxBackoff)
+	}
+
 	// Set up root bucket
 	var root inode.DirInode
 	if serverCfg.BucketName == "" || serverCfg.BucketName == "_" {
 		logger.Info("Set up root directory for all accessible buckets")
 		root = makeRootForAllBuckets(fs)
+
+		if cfg.IsQuotaEnabled(&serverCfg.NewConfig.Quota) {
+			logger.Warnf("Quotas are not supported for dynamic mounts and will be ignored.")
+		}
 	} else {
 		logger.Info("Set up root directory for bucket " + serverCfg.BucketName)
 		syncerBucket, err := fs.bucketManager.SetUpBucket(ctx, serverCfg.BucketName, false, fs.metricHandle)
@@ -210,6 +238,10 @@ func NewFileSystem(ctx context.Context, serverCfg *ServerConfig) (fuseutil.FileS
 			return nil, fmt.Errorf("SetUpBucket: %w", err)
 		}
 		root = makeRootForBucket(ctx, fs, syncerBucket)
+
+		if cfg.IsQuotaEnabled(&serverCfg.NewConfig.Quota) {
+			fs.startUsageTracking(syncerBucket, &serverCfg.NewConfig.Quota)
+		}
 	}
 	root.Lock()
 	root.IncrementLookupCount()
@@ -218,8 +250,16 @@ func NewFileSystem(ctx context.Context, serverCfg *ServerConfig) (fuseutil.FileS
 	fs.folderInodes[root.Name()] = root
 	root.Unlock()
 
+	if fs.writeBackUploader != nil {
+		fs.replayWriteBack(ctx, root)
+	}
+
 	// Set up invariant checking.
 	fs.mu = locker.New("FS", fs.checkInvariants)
+
+	if policy := newBackgroundSyncPolicy(&serverCfg.NewConfig.Write); policy.enabled() {
+		fs.startBackgroundSync(policy)
+	}
 	return fs, nil
 }
 
@@ -250,9 +290,77 @@ func createFileCacheHandler(serverCfg *ServerConfig) (fileCacheHandler *file.Cac
 
 	jobManager := downloader.NewJobManager(fileInfoCache, filePerm, dirPerm, cacheDir, serverCfg.SequentialReadSizeMb, &serverCfg.NewConfig.FileCache, serverCfg.MetricHandle)
 	fileCacheHandler = file.NewCacheHandler(fileInfoCache, jobManager, cacheDir, filePerm, dirPerm)
+	if serverCfg.NewConfig.FileCache.ExperimentalEnableWarmRestart {
+		// The cache is usable even if the index isn't, it's only cold then.
+		if err = fileCacheHandler.RecoverIndex(); err != nil {
+			logger.Warnf("createFileCacheHandler: starting with an empty file cache: %v", err)
+			err = nil
+		}
+	}
 	return
 }
 
+// Start tracking the usage of the supplied bucket in the background, so that
+// StatFS can report it and operations exceeding the quota can be refused.
+func (fs *fileSystem) startUsageTracking(bucket gcs.Bucket, c *cfg.QuotaConfig) {
+	var exceededErr error = syscall.ENOSPC
+	if c.ExceededError == cfg.QuotaExceededErrorEDQUOT {
+		exceededErr = syscall.EDQUOT
+	}
+
+	limits := gcsx.UsageLimits{
+		Bytes:   uint64(c.LimitBytes),
+		Objects: uint64(c.LimitObjects),
+	}
+
+	fs.usageTracker = gcsx.NewUsageTracker(bucket, limits, exceededErr)
+
+	var ctx context.Context
+	ctx, fs.stopUsageTracking = context.WithCancel(context.Background())
+	go fs.usageTracker.Run(ctx, c.UsageScanInterval)
+}
+
+// Resume the write-backs that were left unfinished by a previous mount. In a
+// dynamic mount every bucket that is allowed is set up for that, otherwise
+// only entries of the mounted bucket are replayed.
+func (fs *fileSystem) replayWriteBack(ctx context.Context, root inode.DirInode) {
+	var mountedBucket *gcsx.SyncerBucket
+	if bucketOwned, ok := root.(inode.BucketOwnedInode); ok {
+		mountedBucket = bucketOwned.Bucket()
+	}
+
+	// The buckets set up so far, nil for those that can't be.
+	buckets := make(map[string]*gcsx.SyncerBucket)
+	for _, entry := range fs.contentCache.RecoveredJournal() {
+		name := entry.Metadata.BucketName
+		b, ok := buckets[name]
+		switch {
+		case ok:
+		case mountedBucket != nil:
+			if name == mountedBucket.Name() {
+				b = mountedBucket
+			}
+			buckets[name] = b
+		default:
+			syncerBucket, err := fs.bucketManager.SetUpBucket(ctx, name, true, fs.metricHandle)
+			if err != nil {
+				logger.Warnf("Cannot resume write-backs to bucket %s: SetUpBucket: %v", name, err)
+			} else {
+				b = &syncerBucket
+			}
+			buckets[name] = b
+		}
+
+		if b == nil {
+			logger.Infof("Not resuming write-back of %s/%s", name, entry.Metadata.ObjectName)
+			continue
+		}
+
+		logger.Infof("Resuming write-back of %s/%s", name, entry.Metadata.ObjectName)
+		fs.writeBackUploader.Start(b, entry, nil)
+	}
+}
+
 func makeRootForBucket(
 	ctx context.Context,
 	fs *fileSystem,
@@ -297,6 +405,8 @@ func makeRootForAllBuckets(fs *fileSystem) inode.DirInode {
 			Mtime: fs.mtimeClock.Now(),
 		},
 		fs.bucketManager,
+		fs.newConfig.List.BucketsTtl,
+		fs.cacheClock,
 		fs.metricHandle,
 	)
 }
@@ -460,6 +570,14 @@ type fileSystem struct {
 	// GUARDED_BY(mu)
 	localFileInodes map[inode.Name]inode.Inode
 
+	// Rewrite tokens of cross-bucket copies that failed part way, so that
+	// retrying the rename resumes the copy instead of starting over. There is at
+	// most one entry per source and destination, and at most maxPendingRewrites
+	// entries.
+	//
+	// GUARDED_BY(mu)
+	pendingRewrites map[pendingRewrite]rewriteProgress
+
 	// The collection of live handles, keyed by handle ID.
 	//
 	// INVARIANT: All values are of type *dirHandle or *handle.FileHandle
@@ -485,9 +603,59 @@ type fileSystem struct {
 	// random file access.
 	cacheFileForRangeRead bool
 
+	// memoryCache keeps object contents read by all file handles in memory. It
+	// is non-nil only when enabled at the time of mounting.
+	memoryCache *memory.BlockCache
+
 	globalMaxBlocksSem *semaphore.Weighted
 
+	// readaheadBlocksSem bounds the blocks read ahead by all file handles.
+	readaheadBlocksSem *semaphore.Weighted
+
 	metricHandle common.MetricHandle
+
+	// usageTracker approximates the usage of the mounted bucket when a quota is
+	// configured. It is nil otherwise, and for dynamic mounts.
+	usageTracker      *gcsx.UsageTracker
+	stopUsageTracking context.CancelFunc
+
+	// writeBackUploader uploads the contents of closed files in the background
+	// when write-back is enabled. It is nil otherwise.
+	writeBackUploader *writeback.Uploader
+
+	// Stops the background sync of dirty files, if enabled, which closes
+	// backgroundSyncDone once it has stopped. See startBackgroundSync.
+	stopBackgroundSync context.CancelFunc
+	backgroundSyncDone chan struct{}
+}
+
+// Limits for the background uploads of write-back. Uploads that still fail are
+// resumed on the next mount.
+const (
+	writeBackMaxParallel    = 16
+	writeBackMaxAttempts    = 5
+	writeBackInitialBackoff = time.Second
+	writeBackMaxBackoff     = 30 * time.Second
+)
+
+// Copies across buckets that fail once this many others are pending aren't
+// recorded, and start over when retried.
+const maxPendingRewrites = 64
+
+// pendingRewrite identifies a copy of an object from one bucket to another in
+// a dynamic mount.
+type pendingRewrite struct {
+	srcBucketName string
+	srcName       string
+	dstBucketName string
+	dstName       string
+}
+
+// rewriteProgress records how far a copy of a particular generation of the
+// source object got.
+type rewriteProgress struct {
+	srcGeneration int64
+	token         string
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -714,20 +882,26 @@ func (fs *fileSystem) checkInvariants() {
 }
 
 func (fs *fileSystem) createExplicitDirInode(inodeID fuseops.InodeID, ic inode.Core) inode.Inode {
+	attrs := fuseops.InodeAttributes{
+		Uid:  fs.uid,
+		Gid:  fs.gid,
+		Mode: fs.dirMode,
+
+		// We guarantee only that directory times be "reasonable".
+		Atime: fs.mtimeClock.Now(),
+		Ctime: fs.mtimeClock.Now(),
+		Mtime: fs.mtimeClock.Now(),
+	}
+
+	if fs.newConfig.FileSystem.ExperimentalPersistPosixAttributes && ic.MinObject != nil {
+		attrs = inode.ApplyPosixAttributes(attrs, ic.MinObject.Metadata)
+	}
+
 	in := inode.NewExplicitDirInode(
 		inodeID,
 		ic.FullName,
 		ic.MinObject,
-		fuseops.InodeAttributes{
-			Uid:  fs.uid,
-			Gid:  fs.gid,
-			Mode: fs.dirMode,
-
-			// We guarantee only that directory times be "reasonable".
-			Atime: fs.mtimeClock.Now(),
-			Ctime: fs.mtimeClock.Now(),
-			Mtime: fs.mtimeClock.Now(),
-		},
+		attrs,
 		fs.implicitDirs,
 		fs.newConfig.List.EnableEmptyManagedFolders,
 		fs.enableNonexistentTypeCache,
@@ -809,7 +983,8 @@ func (fs *fileSystem) mintInode(ic inode.Core) (in inode.Inode) {
 			fs.mtimeClock,
 			ic.Local,
 			&fs.newConfig.Write,
-			fs.globalMaxBlocksSem)
+			fs.globalMaxBlocksSem,
+			fs.newConfig.FileSystem.ExperimentalPersistPosixAttributes)
 	}
 
 	// Place it in our map of IDs to inodes.
@@ -1142,15 +1317,7 @@ func (fs *fileSystem) syncFile(
 		return
 	}
 
-	// Once the inode is synced to GCS, it is no longer an localFileInode.
-	// Delete the entry from localFileInodes map and add it to generationBackedInodes.
-	fs.mu.Lock()
-	delete(fs.localFileInodes, f.Name())
-	_, ok := fs.generationBackedInodes[f.Name()]
-	if !ok {
-		fs.generationBackedInodes[f.Name()] = f
-	}
-	fs.mu.Unlock()
+	fs.indexSyncedFile(f)
 
 	// We need not update fileIndex:
 	//
@@ -1165,6 +1332,130 @@ func (fs *fileSystem) syncFile(
 	return
 }
 
+// Once the inode is synced to GCS, it is no longer an localFileInode.
+// Delete the entry from localFileInodes map and add it to generationBackedInodes.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_REQUIRED(f)
+func (fs *fileSystem) indexSyncedFile(f *inode.FileInode) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	delete(fs.localFileInodes, f.Name())
+	_, ok := fs.generationBackedInodes[f.Name()]
+	if !ok {
+		fs.generationBackedInodes[f.Name()] = f
+	}
+}
+
+// Journal the contents of the file and write them back to GCS in the
+// background.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_REQUIRED(f)
+func (fs *fileSystem) writeBackFile(
+	ctx context.Context,
+	f *inode.FileInode) (err error) {
+	// Unlinked local files are never uploaded, see syncFile.
+	if f.IsLocal() && f.IsUnlinked() {
+		err = fs.syncFile(ctx, f)
+		return
+	}
+
+	err = f.WriteBack(ctx, fs.writeBackUploader, func() {
+		f.Lock()
+		defer f.Unlock()
+		fs.settleWriteBack(context.Background(), f)
+	})
+	if err != nil {
+		err = fmt.Errorf("FileInode.WriteBack: %w", err)
+		return
+	}
+
+	fs.indexWrittenBackFile(f)
+	return
+}
+
+// Wait for the write-back and the background sync of the file, if any, and
+// index the file according to their outcome.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_REQUIRED(f)
+func (fs *fileSystem) settleWriteBack(
+	ctx context.Context,
+	f *inode.FileInode) (err error) {
+	err = f.SettleWriteBack(ctx)
+	fs.indexWrittenBackFile(f)
+	return
+}
+
+// Wait for the write-back to the object of the given child of parent, if any,
+// so that an operation on the name sees the object it creates. This includes
+// write-backs replayed on mount, and those of files that have been forgotten.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(parent)
+func (fs *fileSystem) settleWriteBackOf(
+	ctx context.Context,
+	parent inode.DirInode,
+	name inode.Name) (err error) {
+	if fs.writeBackUploader == nil {
+		return
+	}
+
+	bucketOwned, ok := parent.(inode.BucketOwnedInode)
+	if !ok {
+		return
+	}
+
+	key := contentcache.CacheObjectKey{BucketName: bucketOwned.Bucket().Name(), ObjectName: name.GcsObjectName()}
+	if err = fs.writeBackUploader.Await(ctx, key); err != nil {
+		return
+	}
+
+	// Bring the inode, if there is one, up to date with the outcome.
+	fs.mu.Lock()
+	in, ok := fs.localFileInodes[name]
+	if !ok {
+		in = fs.generationBackedInodes[name]
+	}
+	fs.mu.Unlock()
+
+	f, ok := in.(*inode.FileInode)
+	if !ok {
+		return
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	err = fs.settleWriteBack(ctx, f)
+	return
+}
+
+// A local file stops being local once written back, possibly by a method of
+// the inode that settled the write-back. Unlike indexSyncedFile, this leaves
+// the index alone if the inode has been replaced in the meantime.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_REQUIRED(f)
+func (fs *fileSystem) indexWrittenBackFile(f *inode.FileInode) {
+	if f.IsLocal() {
+		return
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.localFileInodes[f.Name()] != f {
+		return
+	}
+
+	delete(fs.localFileInodes, f.Name())
+	if _, ok := fs.generationBackedInodes[f.Name()]; !ok {
+		fs.generationBackedInodes[f.Name()] = f
+	}
+}
+
 // Decrement the supplied inode's lookup count, destroying it if the inode says
 // that it has hit zero.
 //
@@ -1273,6 +1564,25 @@ func (fs *fileSystem) getAttributes(
 	return
 }
 
+// Return the error configured for exceeding the quota if the usage of the
+// mount grew by the supplied amounts.
+func (fs *fileSystem) checkQuota(bytes int64, objects int64) error {
+	if fs.usageTracker == nil {
+		return nil
+	}
+
+	return fs.usageTracker.Check(bytes, objects)
+}
+
+// Account for a local change in the usage of the mount.
+func (fs *fileSystem) recordUsage(bytes int64, objects int64) {
+	if fs.usageTracker == nil {
+		return
+	}
+
+	fs.usageTracker.Add(bytes, objects)
+}
+
 // inodeOrDie returns the inode with the given ID, panicking with a helpful
 // error message if it doesn't exist.
 //
@@ -1358,9 +1668,23 @@ func (fs *fileSystem) invalidateChildFileCacheIfExist(parentInode inode.DirInode
 ////////////////////////////////////////////////////////////////////////
 
 func (fs *fileSystem) Destroy() {
+	if fs.stopBackgroundSync != nil {
+		fs.stopBackgroundSync()
+		<-fs.backgroundSyncDone
+	}
+	// Stop the write-backs in progress while the buckets are still up. Those
+	// unfinished are replayed from the journal on the next mount.
+	if fs.writeBackUploader != nil {
+		fs.writeBackUploader.Stop()
+	}
 	fs.bucketManager.ShutDown()
+	if fs.stopUsageTracking != nil {
+		fs.stopUsageTracking()
+	}
 	if fs.fileCacheHandler != nil {
-		_ = fs.fileCacheHandler.Destroy()
+		if err := fs.fileCacheHandler.Destroy(); err != nil {
+			logger.Errorf("Destroy: while destroying the file cache: %v", err)
+		}
 	}
 }
 
@@ -1383,9 +1707,32 @@ func (fs *fileSystem) StatFS(
 	// faithfully pass on, according to fuseops/ops.go.
 	op.IoSize = 1 << 20
 
+	// If a quota is configured, report it along with the approximate usage of
+	// the mount.
+	if fs.usageTracker != nil {
+		limits := fs.usageTracker.Limits()
+		usage := fs.usageTracker.Usage()
+
+		if limits.Bytes > 0 {
+			op.Blocks = divideRoundingUp(limits.Bytes, uint64(op.BlockSize))
+		}
+		used := divideRoundingUp(usage.Bytes, uint64(op.BlockSize))
+		op.BlocksFree = op.Blocks - min(used, op.Blocks)
+		op.BlocksAvailable = op.BlocksFree
+
+		if limits.Objects > 0 {
+			op.Inodes = limits.Objects
+		}
+		op.InodesFree = op.Inodes - min(usage.Objects, op.Inodes)
+	}
+
 	return
 }
 
+func divideRoundingUp(n uint64, d uint64) uint64 {
+	return (n + d - 1) / d
+}
+
 // LOCKS_EXCLUDED(fs.mu)
 func (fs *fileSystem) LookUpInode(
 	ctx context.Context,
@@ -1481,14 +1828,42 @@ func (fs *fileSystem) SetInodeAttributes(
 
 	// Truncate files.
 	if isFile && op.Size != nil {
+		var growth int64
+		if fs.usageTracker != nil {
+			size, err := file.Size()
+			if err != nil {
+				return fmt.Errorf("Size: %w", err)
+			}
+
+			growth = int64(*op.Size) - int64(size)
+			if err = fs.checkQuota(growth, 0); err != nil {
+				return err
+			}
+		}
+
 		err = file.Truncate(ctx, int64(*op.Size))
 		if err != nil {
 			err = fmt.Errorf("truncate: %w", err)
 			return err
 		}
+		fs.recordUsage(growth, 0)
 	}
 
-	// We silently ignore updates to mode and atime.
+	// Persist mode, ownership and atime if so configured. Otherwise we silently
+	// ignore them.
+	if pin, ok := in.(inode.PosixAttributesInode); ok && fs.newConfig.FileSystem.ExperimentalPersistPosixAttributes {
+		pa := inode.PosixAttributes{
+			Mode:  op.Mode,
+			Uid:   op.Uid,
+			Gid:   op.Gid,
+			Atime: op.Atime,
+		}
+		err = pin.SetPosixAttributes(ctx, pa)
+		if err != nil {
+			err = fmt.Errorf("SetPosixAttributes: %w", err)
+			return err
+		}
+	}
 
 	// Fill in the response.
 	op.Attributes, op.AttributesExpiration, err = fs.getAttributes(ctx, in)
@@ -1527,6 +1902,10 @@ func (fs *fileSystem) MkDir(
 		ctx, cancel = util.IsolateContextFromParentContext(ctx)
 		defer cancel()
 	}
+	if err = fs.checkQuota(0, 1); err != nil {
+		return err
+	}
+
 	// Find the parent.
 	fs.mu.Lock()
 	parent := fs.dirInodeOrDie(op.Parent)
@@ -1535,7 +1914,7 @@ func (fs *fileSystem) MkDir(
 	// Create an empty backing object for the child, failing if it already
 	// exists.
 	parent.Lock()
-	result, err := parent.CreateChildDir(ctx, op.Name)
+	result, err := parent.CreateChildDir(ctx, op.Name, fs.creationPosixAttributes(op.Mode, op.OpContext))
 	parent.Unlock()
 
 	// Special case: *gcs.PreconditionError means the name already exists.
@@ -1550,6 +1929,7 @@ func (fs *fileSystem) MkDir(
 		err = fmt.Errorf("CreateChildDir: %w", err)
 		return err
 	}
+	fs.recordUsage(0, 1)
 
 	// Attempt to create a child inode using the object we created. If we fail to
 	// do so, it means someone beat us to the punch with a newer generation
@@ -1591,7 +1971,7 @@ func (fs *fileSystem) MkNode(
 	}
 
 	// Create the child.
-	child, err := fs.createFile(ctx, op.Parent, op.Name, op.Mode)
+	child, err := fs.createFile(ctx, op.Parent, op.Name, fs.creationPosixAttributes(op.Mode, op.OpContext))
 	if err != nil {
 		return err
 	}
@@ -1611,8 +1991,26 @@ func (fs *fileSystem) MkNode(
 	return
 }
 
+// creationPosixAttributes returns the attributes to persist for a file or
+// directory created with the supplied mode by the caller of an op, if so
+// configured. The kernel doesn't tell the group of the caller, so the group is
+// left as the mount-wide default.
+func (fs *fileSystem) creationPosixAttributes(
+	mode os.FileMode,
+	opCtx fuseops.OpContext) (pa inode.PosixAttributes) {
+	if !fs.newConfig.FileSystem.ExperimentalPersistPosixAttributes {
+		return
+	}
+
+	uid := opCtx.Uid
+	pa.Mode = &mode
+	pa.Uid = &uid
+	return
+}
+
 // Create a child of the parent with the given ID, returning the child locked
-// and with its lookup count incremented.
+// and with its lookup count incremented. The supplied attributes are persisted
+// in the metadata of the backing object.
 //
 // LOCKS_EXCLUDED(fs.mu)
 // LOCK_FUNCTION(child)
@@ -1620,7 +2018,11 @@ func (fs *fileSystem) createFile(
 	ctx context.Context,
 	parentID fuseops.InodeID,
 	name string,
-	mode os.FileMode) (child inode.Inode, err error) {
+	pa inode.PosixAttributes) (child inode.Inode, err error) {
+	if err = fs.checkQuota(0, 1); err != nil {
+		return
+	}
+
 	// Find the parent.
 	fs.mu.Lock()
 	parent := fs.dirInodeOrDie(parentID)
@@ -1629,7 +2031,7 @@ func (fs *fileSystem) createFile(
 	// Create an empty backing object for the child, failing if it already
 	// exists.
 	parent.Lock()
-	result, err := parent.CreateChildFile(ctx, name)
+	result, err := parent.CreateChildFile(ctx, name, pa)
 	parent.Unlock()
 
 	// Special case: *gcs.PreconditionError means the name already exists.
@@ -1644,6 +2046,7 @@ func (fs *fileSystem) createFile(
 		err = fmt.Errorf("CreateChildFile: %w", err)
 		return
 	}
+	fs.recordUsage(0, 1)
 
 	// Attempt to create a child inode using the object we created. If we fail to
 	// do so, it means someone beat us to the punch with a newer generation
@@ -1657,13 +2060,17 @@ func (fs *fileSystem) createFile(
 	return
 }
 
-// Creates localFileInode with the given name under the parent inode.
+// Creates localFileInode with the given name under the parent inode. The
+// supplied attributes are persisted once the file is synced, unless the file
+// already exists.
 // LOCKS_EXCLUDED(fs.mu)
 // UNLOCK_FUNCTION(fs.mu)
 // LOCK_FUNCTION(child)
 func (fs *fileSystem) createLocalFile(
+	ctx context.Context,
 	parentID fuseops.InodeID,
-	name string) (child inode.Inode, err error) {
+	name string,
+	pa inode.PosixAttributes) (child inode.Inode, err error) {
 	// Find the parent.
 	fs.mu.Lock()
 	parent := fs.dirInodeOrDie(parentID)
@@ -1702,6 +2109,12 @@ func (fs *fileSystem) createLocalFile(
 	if err := fileInode.CreateBufferedOrTempWriter(); err != nil {
 		return nil, err
 	}
+	// Nothing else knows of the inode yet. A local file only records the
+	// attributes, which doesn't fail.
+	_ = fileInode.SetPosixAttributes(ctx, pa)
+	// The file will only be uploaded when synced, but counting it now keeps
+	// unlinking it symmetric.
+	fs.recordUsage(0, 1)
 	fs.mu.Unlock()
 
 	parent.Lock()
@@ -1727,9 +2140,9 @@ func (fs *fileSystem) CreateFile(
 	// Create the child.
 	var child inode.Inode
 	if fs.newConfig.Write.CreateEmptyFile {
-		child, err = fs.createFile(ctx, op.Parent, op.Name, op.Mode)
-	} else {
-		child, err = fs.createLocalFile(op.Parent, op.Name)
+		child, err = fs.createFile(ctx, op.Parent, op.Name, fs.creationPosixAttributes(op.Mode, op.OpContext))
+	} else if err = fs.checkQuota(0, 1); err == nil {
+		child, err = fs.createLocalFile(ctx, op.Parent, op.Name, fs.creationPosixAttributes(op.Mode, op.OpContext))
 	}
 
 	if err != nil {
@@ -1744,7 +2157,7 @@ func (fs *fileSystem) CreateFile(
 	handleID := fs.nextHandleID
 	fs.nextHandleID++
 
-	fs.handles[handleID] = handle.NewFileHandle(child.(*inode.FileInode), fs.fileCacheHandler, fs.cacheFileForRangeRead, fs.metricHandle)
+	fs.handles[handleID] = handle.NewFileHandle(child.(*inode.FileInode), fs.fileCacheHandler, fs.cacheFileForRangeRead, fs.memoryCache, &fs.newConfig.Read, fs.readaheadBlocksSem, fs.metricHandle)
 	op.Handle = handleID
 
 	fs.mu.Unlock()
@@ -1773,6 +2186,10 @@ func (fs *fileSystem) CreateSymlink(
 		ctx, cancel = util.IsolateContextFromParentContext(ctx)
 		defer cancel()
 	}
+	if err = fs.checkQuota(0, 1); err != nil {
+		return err
+	}
+
 	// Find the parent.
 	fs.mu.Lock()
 	parent := fs.dirInodeOrDie(op.Parent)
@@ -1795,6 +2212,7 @@ func (fs *fileSystem) CreateSymlink(
 		err = fmt.Errorf("CreateChildSymlink: %w", err)
 		return err
 	}
+	fs.recordUsage(0, 1)
 
 	// Attempt to create a child inode using the object we created. If we fail to
 	// do so, it means someone beat us to the punch with a newer generation
@@ -1937,6 +2355,10 @@ func (fs *fileSystem) RmDir(
 		return err
 	}
 
+	if !isImplicitDir {
+		fs.recordUsage(0, -1)
+	}
+
 	return
 }
 
@@ -1957,24 +2379,38 @@ func (fs *fileSystem) Rename(
 	newParent := fs.dirInodeOrDie(op.NewParent)
 	fs.mu.Unlock()
 
+	var crossBucket bool
 	if oldInode, ok := oldParent.(inode.BucketOwnedInode); !ok {
 		// The old parent is not owned by any bucket, which means it's the base
 		// directory that holds all the buckets' root directories. So, this op
 		// is to rename a bucket, which is not supported.
 		return fmt.Errorf("rename a bucket: %w", syscall.ENOTSUP)
 	} else {
-		// The target path must exist in the same bucket.
+		// The target path must exist in a bucket. In a dynamic mount that may be
+		// another one, in which case objects are copied over server-side.
 		oldBucket := oldInode.Bucket().Name()
-		if newInode, ok := newParent.(inode.BucketOwnedInode); !ok || oldBucket != newInode.Bucket().Name() {
+		newInode, ok := newParent.(inode.BucketOwnedInode)
+		if !ok {
 			return fmt.Errorf("move out of bucket %q: %w", oldBucket, syscall.ENOTSUP)
 		}
+		crossBucket = oldBucket != newInode.Bucket().Name()
 	}
 
-	// If object to be renamed is a local file inode (un-synced), rename operation is not supported.
+	// Rename what a write-back in progress is writing, rather than what it
+	// replaces.
+	if err = fs.settleWriteBackOf(ctx, oldParent, inode.NewFileName(oldParent.Name(), op.OldName)); err != nil {
+		return err
+	}
+
+	// If object to be renamed is a local file inode (un-synced), rename it in
+	// memory. Its object will be created under the new name when synced.
 	localChild := fs.lookUpLocalFileInode(oldParent, op.OldName)
 	if localChild != nil {
-		fs.unlockAndDecrementLookupCount(localChild, 1)
-		return fmt.Errorf("cannot rename open file %q: %w", op.OldName, syscall.ENOTSUP)
+		if crossBucket {
+			fs.unlockAndDecrementLookupCount(localChild, 1)
+			return fmt.Errorf("cannot move open file %q to another bucket: %w", op.OldName, syscall.ENOTSUP)
+		}
+		return fs.renameLocalFile(ctx, localChild.(*inode.FileInode), oldParent, op.OldName, newParent, op.NewName)
 	}
 
 	// Else find the object in the old location (on GCS).
@@ -1995,7 +2431,9 @@ func (fs *fileSystem) Rename(
 	if child.FullName.IsDir() {
 		// If 'enable-hns' flag is false, the bucket type is set to 'NonHierarchical' even for HNS buckets because the control client is nil.
 		// Therefore, an additional 'enable hns' check is not required here.
-		if child.Bucket.BucketType() == gcs.Hierarchical {
+		// Folders can only be renamed within a bucket, so moves to another bucket
+		// copy the objects one by one.
+		if child.Bucket.BucketType() == gcs.Hierarchical && !crossBucket {
 			return fs.renameHierarchicalDir(ctx, oldParent, op.OldName, newParent, op.NewName)
 		}
 		return fs.renameNonHierarchicalDir(ctx, oldParent, op.OldName, newParent, op.NewName)
@@ -2015,11 +2453,11 @@ func (fs *fileSystem) renameFile(
 	newFileName string) error {
 	// Clone into the new location.
 	newParent.Lock()
-	_, err := newParent.CloneToChildFile(ctx, newFileName, oldObject)
+	err := fs.copyToChildFile(ctx, oldParent, oldObject, newParent, newFileName)
 	newParent.Unlock()
 
 	if err != nil {
-		err = fmt.Errorf("CloneToChildFile: %w", err)
+		err = fmt.Errorf("copyToChildFile: %w", err)
 		return err
 	}
 
@@ -2046,6 +2484,228 @@ func (fs *fileSystem) renameFile(
 	return nil
 }
 
+// Copy an object into a child file of newParent. Within a bucket this clones
+// the object. Across buckets of a dynamic mount the object is rewritten, and
+// if that fails the rewrite token is kept so that retrying resumes the copy.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_REQUIRED(newParent)
+func (fs *fileSystem) copyToChildFile(
+	ctx context.Context,
+	oldParent inode.DirInode,
+	src *gcs.MinObject,
+	newParent inode.DirInode,
+	newName string) (err error) {
+	srcBucketName := oldParent.(inode.BucketOwnedInode).Bucket().Name()
+	dstBucketName := newParent.(inode.BucketOwnedInode).Bucket().Name()
+	if srcBucketName == dstBucketName {
+		_, err = newParent.CloneToChildFile(ctx, newName, src, nil)
+		return
+	}
+
+	key := pendingRewrite{
+		srcBucketName: srcBucketName,
+		srcName:       src.Name,
+		dstBucketName: dstBucketName,
+		dstName:       inode.NewFileName(newParent.Name(), newName).GcsObjectName(),
+	}
+
+	// The token of a copy of another generation of the source can't be resumed,
+	// and is replaced below.
+	var rewriteToken string
+	fs.mu.Lock()
+	if p, ok := fs.pendingRewrites[key]; ok && p.srcGeneration == src.Generation {
+		rewriteToken = p.token
+	}
+	fs.mu.Unlock()
+
+	progressFunc := func(bytesRewritten uint64, totalBytes uint64, token string) {
+		logger.Tracef("Rewrite %s/%s to %s/%s: %d of %d bytes", srcBucketName, src.Name, dstBucketName, key.dstName, bytesRewritten, totalBytes)
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		if _, ok := fs.pendingRewrites[key]; ok || len(fs.pendingRewrites) < maxPendingRewrites {
+			fs.pendingRewrites[key] = rewriteProgress{srcGeneration: src.Generation, token: token}
+		}
+	}
+
+	_, err = newParent.RewriteToChildFile(ctx, newName, srcBucketName, src, rewriteToken, progressFunc)
+	if err != nil && rewriteToken != "" {
+		// The token may have expired. Start over.
+		logger.Infof("Resuming rewrite of %s/%s failed, starting over: %v", srcBucketName, src.Name, err)
+		_, err = newParent.RewriteToChildFile(ctx, newName, srcBucketName, src, "", progressFunc)
+	}
+
+	// Nor can a copy of a source that is gone or has changed be resumed.
+	var notFoundErr *gcs.NotFoundError
+	var preconditionErr *gcs.PreconditionError
+	if err == nil || errors.As(err, &notFoundErr) || errors.As(err, &preconditionErr) {
+		fs.mu.Lock()
+		delete(fs.pendingRewrites, key)
+		fs.mu.Unlock()
+	}
+
+	if err != nil {
+		err = fmt.Errorf("RewriteToChildFile: %w", err)
+		return
+	}
+
+	return
+}
+
+// Rename a local file in memory. Whatever the new name refers to is replaced:
+// a local file of that name is unlinked, whereas an object of that name is only
+// replaced once the renamed file is in GCS, see renameLocalFileOverObject.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(oldParent)
+// LOCKS_EXCLUDED(newParent)
+// LOCKS_REQUIRED(child)
+// UNLOCK_FUNCTION(child)
+func (fs *fileSystem) renameLocalFile(
+	ctx context.Context,
+	child *inode.FileInode,
+	oldParent inode.DirInode,
+	oldName string,
+	newParent inode.DirInode,
+	newName string) (err error) {
+	// Hold on to the lookup count taken by lookUpLocalFileInode until the end,
+	// but release the lock so that the parents can be locked below.
+	defer fs.unlockAndDecrementLookupCount(child, 1)
+
+	if !child.IsRenamable() {
+		return fmt.Errorf("cannot rename open file %q after its upload started: %w", oldName, syscall.ENOTSUP)
+	}
+
+	newFileName := inode.NewFileName(newParent.Name(), newName)
+	if newFileName == child.Name() {
+		return
+	}
+	child.Unlock()
+
+	// Replace a local file with the new name.
+	if target := fs.lookUpLocalFileInode(newParent, newName); target != nil {
+		targetFile := target.(*inode.FileInode)
+		if size, err := targetFile.Size(); err == nil {
+			fs.recordUsage(-int64(size), -1)
+		}
+		targetFile.Unlink()
+		fs.unlockAndDecrementLookupCount(target, 1)
+	} else {
+		var o *gcs.MinObject
+		o, err = fs.lookUpRenameTarget(ctx, newParent, newName)
+		if err == nil && o != nil {
+			child.Lock()
+			return fs.renameLocalFileOverObject(ctx, child, oldParent, oldName, newParent, newName, o)
+		}
+	}
+
+	child.Lock()
+	if err != nil {
+		return err
+	}
+
+	// Re-key the inode, unless it has been unlinked or synced in the meantime.
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.localFileInodes[child.Name()] != child {
+		return fmt.Errorf("local file %q changed during rename: %w", oldName, syscall.ESTALE)
+	}
+
+	if err = child.Rename(newFileName); err != nil {
+		return fmt.Errorf("Rename: %w", err)
+	}
+
+	delete(fs.localFileInodes, inode.NewFileName(oldParent.Name(), oldName))
+	fs.localFileInodes[newFileName] = child
+
+	oldParent.EraseFromTypeCache(oldName)
+	newParent.InsertFileIntoTypeCache(newName)
+	return
+}
+
+// Return the object that a file is about to be renamed over, if any.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(parent)
+func (fs *fileSystem) lookUpRenameTarget(
+	ctx context.Context,
+	parent inode.DirInode,
+	name string) (o *gcs.MinObject, err error) {
+	parent.Lock()
+	defer parent.Unlock()
+
+	target, err := parent.LookUpChild(ctx, name)
+	if err != nil {
+		err = fmt.Errorf("LookUpChild: %w", err)
+		return
+	}
+
+	if target == nil {
+		return
+	}
+
+	if target.FullName.IsDir() {
+		err = syscall.EISDIR
+		return
+	}
+
+	o = target.MinObject
+	return
+}
+
+// Rename a local file over an object. Deleting the object up front would lose
+// it should the file never make it to GCS, so the file is synced under its old
+// name first, then cloned over the object, provided that the object hasn't
+// changed since, and deleted behind. A file that can't be synced yet fails the
+// rename and leaves the object alone.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(oldParent)
+// LOCKS_EXCLUDED(newParent)
+// LOCKS_REQUIRED(child)
+func (fs *fileSystem) renameLocalFileOverObject(
+	ctx context.Context,
+	child *inode.FileInode,
+	oldParent inode.DirInode,
+	oldName string,
+	newParent inode.DirInode,
+	newName string,
+	target *gcs.MinObject) (err error) {
+	if err = child.Sync(ctx); err != nil {
+		return fmt.Errorf("FileInode.Sync: %w", err)
+	}
+	if child.IsLocal() {
+		return fmt.Errorf("cannot rename %q over %q before it is uploaded: %w", oldName, newName, syscall.ENOTSUP)
+	}
+	fs.indexSyncedFile(child)
+	src := child.Source()
+
+	// The parents are locked below.
+	child.Unlock()
+	defer child.Lock()
+
+	newParent.Lock()
+	_, err = newParent.CloneToChildFile(ctx, newName, src, &target.Generation)
+	newParent.Unlock()
+	if err != nil {
+		return fmt.Errorf("CloneToChildFile: %w", err)
+	}
+	fs.recordUsage(-int64(target.Size), -1)
+
+	if err = fs.invalidateChildFileCacheIfExist(newParent, target.Name); err != nil {
+		return fmt.Errorf("renameLocalFileOverObject: while invalidating cache for replaced file: %w", err)
+	}
+
+	oldParent.Lock()
+	err = oldParent.DeleteChildFile(ctx, oldName, src.Generation, &src.MetaGeneration)
+	oldParent.Unlock()
+	if err != nil {
+		return fmt.Errorf("DeleteChildFile: %w", err)
+	}
+	return
+}
+
 func (fs *fileSystem) releaseInodes(inodes *[]inode.DirInode) {
 	for _, in := range *inodes {
 		fs.unlockAndDecrementLookupCount(in, 1)
@@ -2061,15 +2721,55 @@ func (fs *fileSystem) getBucketDirInode(ctx context.Context, parent inode.DirIno
 	return dir, nil
 }
 
-func (fs *fileSystem) ensureNoLocalFilesInDirectory(dir inode.BucketOwnedDirInode, name string) error {
+// Return the local files anywhere below the supplied directory, failing if
+// any of them can no longer be renamed.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) localFilesBelow(dir inode.Name) (files []*inode.FileInode, err error) {
 	fs.mu.Lock()
-	entries := dir.LocalFileEntries(fs.localFileInodes)
+	for name, in := range fs.localFileInodes {
+		if name.IsDescendantOf(dir) {
+			files = append(files, in.(*inode.FileInode))
+		}
+	}
 	fs.mu.Unlock()
 
-	if len(entries) != 0 {
-		return fmt.Errorf("can't rename directory %s with open files: %w", name, syscall.ENOTSUP)
+	for _, f := range files {
+		f.Lock()
+		renamable := f.IsRenamable() || f.IsUnlinked()
+		f.Unlock()
+
+		if !renamable {
+			return nil, fmt.Errorf("can't rename directory %s with open file %s whose upload started: %w", dir, f.Name(), syscall.ENOTSUP)
+		}
+	}
+
+	return
+}
+
+// Move the supplied local files from below oldDir to the same relative
+// location below newDir, after the directory itself has been renamed.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) moveLocalFiles(files []*inode.FileInode, oldDir inode.Name, newDir inode.Name) {
+	for _, f := range files {
+		f.Lock()
+		fs.mu.Lock()
+
+		oldName := f.Name()
+		newName := inode.NewDescendantName(newDir, newDir.GcsObjectName()+strings.TrimPrefix(oldName.GcsObjectName(), oldDir.GcsObjectName()))
+		if fs.localFileInodes[oldName] == f && f.IsRenamable() {
+			if err := f.Rename(newName); err != nil {
+				logger.Warnf("Local file %s was not moved to %s: %v", oldName, newName, err)
+			} else {
+				delete(fs.localFileInodes, oldName)
+				fs.localFileInodes[newName] = f
+			}
+		}
+
+		fs.mu.Unlock()
+		f.Unlock()
 	}
-	return nil
 }
 
 func (fs *fileSystem) checkDirNotEmpty(dir inode.BucketOwnedDirInode, name string) error {
@@ -2104,13 +2804,14 @@ func (fs *fileSystem) renameHierarchicalDir(ctx context.Context, oldParent inode
 	}
 	pendingInodes = append(pendingInodes, oldDirInode)
 
-	if err = fs.ensureNoLocalFilesInDirectory(oldDirInode, oldName); err != nil {
-		return err
-	}
-
 	oldDirName := inode.NewDirName(oldParent.Name(), oldName)
 	newDirName := inode.NewDirName(newParent.Name(), newName)
 
+	localFiles, err := fs.localFilesBelow(oldDirName)
+	if err != nil {
+		return err
+	}
+
 	// If the call for getBucketDirInode fails it means directory does not exist.
 	newDirInode, err := fs.getBucketDirInode(ctx, newParent, newName)
 	if err == nil {
@@ -2143,6 +2844,7 @@ func (fs *fileSystem) renameHierarchicalDir(ctx context.Context, oldParent inode
 		return fmt.Errorf("failed to rename folder: %w", err)
 	}
 
+	fs.moveLocalFiles(localFiles, oldDirName, newDirName)
 	return
 }
 
@@ -2171,7 +2873,8 @@ func (fs *fileSystem) renameNonHierarchicalDir(
 	}
 	pendingInodes = append(pendingInodes, oldDir)
 
-	if err = fs.ensureNoLocalFilesInDirectory(oldDir, oldName); err != nil {
+	localFiles, err := fs.localFilesBelow(oldDir.Name())
+	if err != nil {
 		return err
 	}
 
@@ -2186,7 +2889,7 @@ func (fs *fileSystem) renameNonHierarchicalDir(
 
 	// Create the backing object of the new directory.
 	newParent.Lock()
-	_, err = newParent.CreateChildDir(ctx, newName)
+	_, err = newParent.CreateChildDir(ctx, newName, inode.PosixAttributes{})
 	newParent.Unlock()
 	if err != nil {
 		var preconditionErr *gcs.PreconditionError
@@ -2216,7 +2919,7 @@ func (fs *fileSystem) renameNonHierarchicalDir(
 		}
 
 		o := descendant.MinObject
-		if _, err := newDir.CloneToChildFile(ctx, nameDiff, o); err != nil {
+		if err := fs.copyToChildFile(ctx, oldDir, o, newDir, nameDiff); err != nil {
 			return fmt.Errorf("copy file %q: %w", o.Name, err)
 		}
 		if err := oldDir.DeleteChildFile(ctx, nameDiff, o.Generation, &o.MetaGeneration); err != nil {
@@ -2241,6 +2944,7 @@ func (fs *fileSystem) renameNonHierarchicalDir(
 		return fmt.Errorf("DeleteChildDir: %w", err)
 	}
 
+	fs.moveLocalFiles(localFiles, oldDir.Name(), newDir.Name())
 	return nil
 }
 
@@ -2260,8 +2964,14 @@ func (fs *fileSystem) Unlink(
 	parent := fs.dirInodeOrDie(op.Parent)
 	fs.mu.Unlock()
 
-	// if inode is a local file, mark it unlinked.
+	// A write-back in progress may be creating the object, which is then
+	// deleted below.
 	fileName := inode.NewFileName(parent.Name(), op.Name)
+	if err = fs.settleWriteBackOf(ctx, parent, fileName); err != nil {
+		return err
+	}
+
+	// if inode is a local file, mark it unlinked.
 	fs.mu.Lock()
 	fileInode, ok := fs.localFileInodes[fileName]
 	if ok {
@@ -2269,6 +2979,9 @@ func (fs *fileSystem) Unlink(
 		fs.mu.Unlock()
 		file.Lock()
 		defer file.Unlock()
+		if size, err := file.Size(); err == nil {
+			fs.recordUsage(-int64(size), -1)
+		}
 		file.Unlink()
 		return
 	}
@@ -2278,6 +2991,16 @@ func (fs *fileSystem) Unlink(
 	parent.Lock()
 	defer parent.Unlock()
 
+	// Find out how much space the deletion frees up. The object has almost
+	// certainly been looked up just before, so this is served by the stat cache.
+	var size uint64
+	if bucketOwnedDirInode, ok := parent.(inode.BucketOwnedDirInode); ok && fs.usageTracker != nil {
+		m, _, statErr := bucketOwnedDirInode.Bucket().StatObject(ctx, &gcs.StatObjectRequest{Name: fileName.GcsObjectName()})
+		if statErr == nil {
+			size = m.Size
+		}
+	}
+
 	// Delete the backing object.
 	err = parent.DeleteChildFile(
 		ctx,
@@ -2289,6 +3012,7 @@ func (fs *fileSystem) Unlink(
 		err = fmt.Errorf("DeleteChildFile: %w", err)
 		return err
 	}
+	fs.recordUsage(-int64(size), -1)
 
 	if err := fs.invalidateChildFileCacheIfExist(parent, fileName.GcsObjectName()); err != nil {
 		return fmt.Errorf("unlink: while invalidating cache for delete file: %w", err)
@@ -2388,7 +3112,7 @@ func (fs *fileSystem) OpenFile(
 	handleID := fs.nextHandleID
 	fs.nextHandleID++
 
-	fs.handles[handleID] = handle.NewFileHandle(in, fs.fileCacheHandler, fs.cacheFileForRangeRead, fs.metricHandle)
+	fs.handles[handleID] = handle.NewFileHandle(in, fs.fileCacheHandler, fs.cacheFileForRangeRead, fs.memoryCache, &fs.newConfig.Read, fs.readaheadBlocksSem, fs.metricHandle)
 	op.Handle = handleID
 
 	// When we observe object generations that we didn't create, we assign them
@@ -2470,10 +3194,32 @@ func (fs *fileSystem) WriteFile(
 	in.Lock()
 	defer in.Unlock()
 
+	// Refuse writes growing the file beyond the quota.
+	var growth int64
+	if fs.usageTracker != nil {
+		size, err := in.Size()
+		if err != nil {
+			return fmt.Errorf("Size: %w", err)
+		}
+
+		growth = max(0, op.Offset+int64(len(op.Data))-int64(size))
+		if err := fs.checkQuota(growth, 0); err != nil {
+			return err
+		}
+	}
+
 	// Serve the request.
+	wasLocal := in.IsLocal()
 	if err := in.Write(ctx, op.Data, op.Offset); err != nil {
 		return err
 	}
+	fs.recordUsage(growth, 0)
+
+	// A streamed local file that falls back to a temp file is uploaded as far
+	// as it has been written.
+	if wasLocal && !in.IsLocal() {
+		fs.indexSyncedFile(in)
+	}
 
 	return
 }
@@ -2530,6 +3276,11 @@ func (fs *fileSystem) FlushFile(
 	in.Lock()
 	defer in.Unlock()
 
+	// With write-back, the upload finishes after the file has been closed.
+	if fs.writeBackUploader != nil {
+		return fs.writeBackFile(ctx, in)
+	}
+
 	// Sync it.
 	if err := fs.syncFile(ctx, in); err != nil {
 		return err
@@ -2554,14 +3305,163 @@ func (fs *fileSystem) ReleaseFileHandle(
 	return
 }
 
+// Return the extended attributes of the inode with the given ID. Inodes that
+// are not backed by GCS metadata, e.g. symlinks or the root of a dynamic mount,
+// have none.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) xattrs(
+	ctx context.Context,
+	id fuseops.InodeID) (xattrs map[string][]byte, err error) {
+	fs.mu.Lock()
+	in := fs.inodeOrDie(id)
+	fs.mu.Unlock()
+
+	xin, ok := in.(inode.XattrInode)
+	if !ok {
+		return
+	}
+
+	xin.Lock()
+	defer xin.Unlock()
+
+	xattrs, err = xin.Xattrs(ctx)
+	return
+}
+
+// LOCKS_EXCLUDED(fs.mu)
 func (fs *fileSystem) GetXattr(
 	ctx context.Context,
 	op *fuseops.GetXattrOp) (err error) {
-	return syscall.ENOSYS
+	if fs.newConfig.FileSystem.IgnoreInterrupts {
+		// When ignore interrupts config is set, we are creating a new context not
+		// cancellable by parent context.
+		var cancel context.CancelFunc
+		ctx, cancel = util.IsolateContextFromParentContext(ctx)
+		defer cancel()
+	}
+
+	xattrs, err := fs.xattrs(ctx, op.Inode)
+	if err != nil {
+		return err
+	}
+
+	value, ok := xattrs[op.Name]
+	if !ok {
+		return fuse.ENOATTR
+	}
+
+	// An empty destination buffer is a request for the size of the value.
+	op.BytesRead = len(value)
+	if len(op.Dst) == 0 {
+		return
+	}
+
+	if len(op.Dst) < len(value) {
+		return syscall.ERANGE
+	}
+
+	copy(op.Dst, value)
+	return
 }
 
+// LOCKS_EXCLUDED(fs.mu)
 func (fs *fileSystem) ListXattr(
 	ctx context.Context,
 	op *fuseops.ListXattrOp) error {
-	return syscall.ENOSYS
+	if fs.newConfig.FileSystem.IgnoreInterrupts {
+		// When ignore interrupts config is set, we are creating a new context not
+		// cancellable by parent context.
+		var cancel context.CancelFunc
+		ctx, cancel = util.IsolateContextFromParentContext(ctx)
+		defer cancel()
+	}
+
+	xattrs, err := fs.xattrs(ctx, op.Inode)
+	if err != nil {
+		return err
+	}
+
+	// Emit the names in a stable order, each terminated by a NUL byte.
+	names := make([]string, 0, len(xattrs))
+	for name := range xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf []byte
+	for _, name := range names {
+		buf = append(buf, name...)
+		buf = append(buf, 0)
+	}
+
+	op.BytesRead = len(buf)
+	if len(op.Dst) == 0 {
+		return nil
+	}
+
+	if len(op.Dst) < len(buf) {
+		return syscall.ERANGE
+	}
+
+	copy(op.Dst, buf)
+	return nil
+}
+
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) SetXattr(
+	ctx context.Context,
+	op *fuseops.SetXattrOp) (err error) {
+	if fs.newConfig.FileSystem.IgnoreInterrupts {
+		// When ignore interrupts config is set, we are creating a new context not
+		// cancellable by parent context.
+		var cancel context.CancelFunc
+		ctx, cancel = util.IsolateContextFromParentContext(ctx)
+		defer cancel()
+	}
+
+	// Find the inode.
+	fs.mu.Lock()
+	in := fs.inodeOrDie(op.Inode)
+	fs.mu.Unlock()
+
+	xin, ok := in.(inode.XattrInode)
+	if !ok {
+		return syscall.ENOTSUP
+	}
+
+	xin.Lock()
+	defer xin.Unlock()
+
+	err = xin.SetXattr(ctx, op.Name, op.Value, op.Flags)
+	return
+}
+
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) RemoveXattr(
+	ctx context.Context,
+	op *fuseops.RemoveXattrOp) (err error) {
+	if fs.newConfig.FileSystem.IgnoreInterrupts {
+		// When ignore interrupts config is set, we are creating a new context not
+		// cancellable by parent context.
+		var cancel context.CancelFunc
+		ctx, cancel = util.IsolateContextFromParentContext(ctx)
+		defer cancel()
+	}
+
+	// Find the inode.
+	fs.mu.Lock()
+	in := fs.inodeOrDie(op.Inode)
+	fs.mu.Unlock()
+
+	xin, ok := in.(inode.XattrInode)
+	if !ok {
+		return fuse.ENOATTR
+	}
+
+	xin.Lock()
+	defer xin.Unlock()
+
+	err = xin.RemoveXattr(ctx, op.Name)
+	return
 }
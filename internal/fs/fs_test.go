@@ -24,6 +24,7 @@ import (
 	"os/user"
 	"path"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
@@ -381,10 +382,20 @@ func (bm *fakeBucketManager) SetUpBucket(
 			bm.appendThreshold,
 			bm.chunkTransferTimeoutSecs,
 			bm.tmpObjectPrefix,
-			gcsx.NewContentTypeBucket(bucket),
+			nil,
+			gcsx.NewContentTypeBucket(bucket, nil, false),
+			common.NewNoopMetrics(),
 		)
 		return
 	}
 	err = fmt.Errorf("Bucket %q does not exist", name)
 	return
 }
+
+func (bm *fakeBucketManager) ListBuckets(ctx context.Context) (names []string, err error) {
+	for name := range bm.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
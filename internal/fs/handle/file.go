@@ -18,12 +18,15 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
 	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/memory"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/jacobsa/syncutil"
 	"golang.org/x/net/context"
+	"golang.org/x/sync/semaphore"
 )
 
 type FileHandle struct {
@@ -46,14 +49,24 @@ type FileHandle struct {
 	// cacheFileForRangeRead is also valid for cache workflow, if true, object content
 	// will be downloaded for random reads as well too.
 	cacheFileForRangeRead bool
-	metricHandle          common.MetricHandle
+
+	// memoryCache and readaheadBlocks are shared by all handles, and
+	// memoryCache is nil if disabled. They and readConfig configure the reader,
+	// see gcsx.NewRandomReader.
+	memoryCache     *memory.BlockCache
+	readConfig      *cfg.ReadConfig
+	readaheadBlocks *semaphore.Weighted
+	metricHandle    common.MetricHandle
 }
 
-func NewFileHandle(inode *inode.FileInode, fileCacheHandler *file.CacheHandler, cacheFileForRangeRead bool, metricHandle common.MetricHandle) (fh *FileHandle) {
+func NewFileHandle(inode *inode.FileInode, fileCacheHandler *file.CacheHandler, cacheFileForRangeRead bool, memoryCache *memory.BlockCache, readConfig *cfg.ReadConfig, readaheadBlocks *semaphore.Weighted, metricHandle common.MetricHandle) (fh *FileHandle) {
 	fh = &FileHandle{
 		inode:                 inode,
 		fileCacheHandler:      fileCacheHandler,
 		cacheFileForRangeRead: cacheFileForRangeRead,
+		memoryCache:           memoryCache,
+		readConfig:            readConfig,
+		readaheadBlocks:       readaheadBlocks,
 		metricHandle:          metricHandle,
 	}
 
@@ -173,7 +186,7 @@ func (fh *FileHandle) tryEnsureReader(ctx context.Context, sequentialReadSizeMb
 	}
 
 	// Attempt to create an appropriate reader.
-	rr := gcsx.NewRandomReader(fh.inode.Source(), fh.inode.Bucket(), sequentialReadSizeMb, fh.fileCacheHandler, fh.cacheFileForRangeRead, fh.metricHandle)
+	rr := gcsx.NewRandomReader(fh.inode.Source(), fh.inode.Bucket(), sequentialReadSizeMb, fh.fileCacheHandler, fh.cacheFileForRangeRead, fh.memoryCache, fh.readConfig, fh.readaheadBlocks, fh.metricHandle)
 
 	fh.reader = rr
 	return
@@ -0,0 +1,385 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/bufferedwrites"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/gcsfuse_errors"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"golang.org/x/net/context"
+)
+
+// SyncStatus describes how far the content of a file inode is ahead of the
+// object in GCS.
+type SyncStatus struct {
+	// When the content was first modified since it was last written out, or
+	// zero if it is clean.
+	DirtySince time.Time
+
+	// An upper bound on the number of bytes modified since then.
+	DirtyBytes int64
+
+	// When the content was last written out, or zero if it never was.
+	LastSynced time.Time
+
+	// The error of the last attempt at writing the content out, or nil if it
+	// succeeded.
+	LastErr error
+}
+
+// SyncStatus returns the sync status of the inode.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) SyncStatus() (s SyncStatus) {
+	s = SyncStatus{
+		DirtySince: f.dirtySince,
+		LastSynced: f.lastSynced,
+		LastErr:    f.lastSyncErr,
+	}
+	if f.dirtySince.IsZero() {
+		return
+	}
+
+	switch {
+	case f.bwh != nil:
+		s.DirtyBytes = f.bwh.WriteFileInfo().TotalSize - f.bwhSyncedSize
+	case f.content != nil:
+		for _, r := range f.content.DirtyRanges() {
+			s.DirtyBytes += r.Limit - r.Start
+		}
+	}
+
+	return
+}
+
+// BackgroundUpload is a background sync in progress, see BackgroundSync.
+type BackgroundUpload struct {
+	done chan struct{}
+
+	// The state of the inode when the upload was started.
+	startTime      time.Time
+	contentVersion uint64
+	wasLocal       bool
+	bwh            *bufferedwrites.BufferedWriteHandler
+	checkpoint     *bufferedwrites.Checkpoint
+
+	// Set before done is closed.
+	o   *gcs.Object
+	err error
+}
+
+// Done returns a channel that is closed once the upload has finished.
+func (u *BackgroundUpload) Done() <-chan struct{} {
+	return u.done
+}
+
+// Err returns the error of the upload, if it failed.
+//
+// REQUIRES: Done() is closed.
+func (u *BackgroundUpload) Err() error {
+	return u.err
+}
+
+// BackgroundSync writes the content out to GCS like Sync does, for files that
+// are kept open for a long time. Only a snapshot of the content is taken while
+// the inode is locked, which is uploaded in the background without holding
+// the lock; nil is returned if there is nothing to upload. The inode is
+// brought up to date with the outcome once the upload is done by the next
+// method that settles write-backs, see SettleWriteBack. Unlike Sync, the
+// content is kept as the clean content of the inode (if it hasn't been
+// modified in the meantime), so that open handles carry on using it without
+// the object being read again. Streaming writes are checkpointed instead, by
+// composing the object from the full blocks uploaded so far; that is only
+// possible with parallel composite uploads, as the data of a resumable upload
+// isn't in an object until the upload is finalized.
+//
+// Files whose outcome is up to the user's next fsync or close are left alone:
+// those with a write-back in progress or failed, unlinked files, and files
+// backed by the local file cache. A file whose object has been changed by
+// someone else fails with *gcsfuse_errors.FileClobberedError, leaving the
+// conflict to be resolved by the next sync.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) BackgroundSync(ctx context.Context) (u *BackgroundUpload, err error) {
+	if f.destroyed || f.dirtySince.IsZero() || f.localFileCache || f.IsUnlinked() {
+		return
+	}
+
+	if f.backgroundUpload != nil || f.writeBack != nil || f.writeBackErr != nil {
+		return
+	}
+
+	u = &BackgroundUpload{
+		done:           make(chan struct{}),
+		startTime:      f.mtimeClock.Now(),
+		contentVersion: f.contentVersion,
+		wasLocal:       f.IsLocal(),
+	}
+
+	var upload func() (*gcs.Object, error)
+	if f.bwh != nil {
+		upload, err = f.prepareCheckpoint(u)
+	} else {
+		upload, err = f.prepareSnapshotUpload(ctx)
+	}
+	if err != nil || upload == nil {
+		u = nil
+		f.recordSyncErr(&err)
+		return
+	}
+
+	f.backgroundUpload = u
+	go func() {
+		defer close(u.done)
+		u.o, u.err = upload()
+
+		// The object changed since the content was derived from it.
+		var preconditionErr *gcs.PreconditionError
+		if errors.As(u.err, &preconditionErr) {
+			u.err = &gcsfuse_errors.FileClobberedError{Err: u.err}
+		}
+	}()
+
+	return
+}
+
+// prepareCheckpoint returns a function writing a checkpoint of the streaming
+// writes, or nil if there is nothing to checkpoint.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) prepareCheckpoint(u *BackgroundUpload) (upload func() (*gcs.Object, error), err error) {
+	c, err := f.bwh.Checkpoint()
+	if errors.Is(err, bufferedwrites.ErrNoCheckpoint) {
+		err = nil
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("BufferedWriteHandler.Checkpoint: %w", err)
+		return
+	}
+	if c == nil {
+		return
+	}
+
+	u.bwh = f.bwh
+	u.checkpoint = c
+	upload = c.Write
+	return
+}
+
+// prepareSnapshotUpload returns a function syncing a snapshot of the content
+// to the object it was derived from, or nil if the content is clean. The
+// snapshot is a local copy of the content.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) prepareSnapshotUpload(ctx context.Context) (upload func() (*gcs.Object, error), err error) {
+	// The content may have been kept by a previous background sync and not been
+	// modified since.
+	clean, err := f.contentIsClean()
+	if err != nil || clean {
+		return
+	}
+
+	snapshot, err := gcsx.SnapshotTempFile(f.content, f.contentCache.TempDir(), f.mtimeClock)
+	if err != nil {
+		err = fmt.Errorf("SnapshotTempFile: %w", err)
+		return
+	}
+
+	bucket := f.bucket
+	name := f.Name().GcsObjectName()
+	srcGen := f.SourceGeneration()
+	if f.IsLocal() {
+		srcGen = Generation{}
+	}
+	metadata := maps.Clone(f.pendingPosixAttrs)
+	upload = func() (o *gcs.Object, err error) {
+		defer snapshot.Destroy()
+		o, err = syncSnapshot(ctx, bucket, name, srcGen, metadata, snapshot)
+		return
+	}
+	return
+}
+
+// syncSnapshot writes the content out to the named object, as long as it still
+// has the generation the content was derived from, a zero one meaning that
+// the object is to be created. A new object is created with the supplied
+// metadata.
+func syncSnapshot(
+	ctx context.Context,
+	bucket *gcsx.SyncerBucket,
+	name string,
+	srcGen Generation,
+	metadata map[string]string,
+	content gcsx.TempFile) (o *gcs.Object, err error) {
+	// Fetch all the properties of the object, which are carried over to the new
+	// generation.
+	m, e, err := bucket.StatObject(ctx, &gcs.StatObjectRequest{
+		Name:                           name,
+		ForceFetchFromGcs:              true,
+		ReturnExtendedObjectAttributes: true,
+	})
+
+	var notFoundErr *gcs.NotFoundError
+	switch {
+	case errors.As(err, &notFoundErr):
+		if srcGen.Object != 0 {
+			err = &gcsfuse_errors.FileClobberedError{Err: fmt.Errorf("%q was deleted", name)}
+			return
+		}
+		o, err = bucket.SyncNewObject(ctx, name, metadata, content)
+
+	case err != nil:
+		err = fmt.Errorf("StatObject: %w", err)
+		return
+
+	case srcGen.Compare(Generation{m.Generation, m.MetaGeneration}) != 0:
+		err = &gcsfuse_errors.FileClobberedError{Err: fmt.Errorf("%q was changed by someone else", name)}
+		return
+
+	default:
+		o, err = bucket.SyncObject(ctx, name, storageutil.ConvertMinObjectAndExtendedObjectAttributesToObject(m, e), content)
+	}
+
+	if err != nil {
+		err = fmt.Errorf("SyncObject: %w", err)
+	}
+	return
+}
+
+// settleBackgroundUpload waits for the background sync in progress, if any,
+// and brings the inode up to date with its outcome. It only fails if ctx is
+// done first.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) settleBackgroundUpload(ctx context.Context) (err error) {
+	u := f.backgroundUpload
+	if u == nil {
+		return
+	}
+
+	select {
+	case <-u.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		return
+	}
+
+	f.backgroundUpload = nil
+	if u.err != nil {
+		f.lastSyncErr = u.err
+		return
+	}
+
+	// An unlinked local file must not show up in the bucket.
+	if u.wasLocal && f.IsUnlinked() && u.o != nil {
+		f.deleteUnlinkedObject(u.o)
+		return
+	}
+
+	if f.destroyed {
+		return
+	}
+
+	if u.checkpoint != nil && u.bwh == f.bwh {
+		f.bwh.CheckpointWritten(u.checkpoint, u.o)
+		f.bwhSyncedSize = u.checkpoint.Size
+	}
+
+	if syncErr := f.syncedTo(ctx, u.o, false); syncErr != nil {
+		f.lastSyncErr = syncErr
+		return
+	}
+
+	// Whatever was written in the meantime is yet to be written out.
+	switch {
+	case f.bwh != nil:
+		if f.bwh.WriteFileInfo().TotalSize > f.bwhSyncedSize {
+			f.dirtySince = u.startTime
+			return
+		}
+
+	case f.contentVersion != u.contentVersion:
+		f.dirtySince = u.startTime
+		return
+
+	case f.content != nil:
+		// The content now matches the new object, so later syncs start from
+		// there.
+		if markErr := f.content.MarkClean(); markErr != nil {
+			f.lastSyncErr = fmt.Errorf("MarkClean: %w", markErr)
+			return
+		}
+	}
+
+	f.dirtySince = time.Time{}
+	return
+}
+
+// deleteUnlinkedObject makes an effort to delete the object a background sync
+// created for a local file that was unlinked in the meantime.
+func (f *FileInode) deleteUnlinkedObject(o *gcs.Object) {
+	err := f.bucket.DeleteObject(context.Background(), &gcs.DeleteObjectRequest{
+		Name:       o.Name,
+		Generation: o.Generation,
+	})
+	if err != nil {
+		logger.Warnf("Failed to delete %s of unlinked file: %v", o.Name, err)
+	}
+}
+
+// contentIsClean tells whether the content is known to match the source
+// object, as after a background sync.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) contentIsClean() (clean bool, err error) {
+	if f.localFileCache || f.IsLocal() {
+		return
+	}
+
+	sr, err := f.content.Stat()
+	if err != nil {
+		err = fmt.Errorf("stat: %w", err)
+		return
+	}
+
+	clean = sr.Mtime == nil && sr.DirtyThreshold == sr.Size && sr.Size == int64(f.src.Size)
+	return
+}
+
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) markDirty() {
+	if f.dirtySince.IsZero() {
+		f.dirtySince = f.mtimeClock.Now()
+	}
+}
+
+// recordSyncErr records the error of an attempt at writing the content out,
+// if it failed.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) recordSyncErr(err *error) {
+	if *err != nil {
+		f.lastSyncErr = *err
+	}
+}
@@ -15,7 +15,8 @@
 package inode
 
 import (
-	"syscall"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/common"
@@ -27,6 +28,7 @@ import (
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/jacobsa/fuse/fuseops"
 	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/timeutil"
 	"golang.org/x/net/context"
 )
 
@@ -46,6 +48,10 @@ type baseDirInode struct {
 
 	attrs fuseops.InodeAttributes
 
+	// How long a listing of the buckets is served before it is fetched again.
+	bucketListTTL time.Duration
+	cacheClock    timeutil.Clock
+
 	/////////////////////////
 	// Mutable state
 	/////////////////////////
@@ -62,6 +68,13 @@ type baseDirInode struct {
 	// GUARDED_BY(mu)
 	buckets map[string]gcsx.SyncerBucket
 
+	// The names returned by the last listing of the buckets, valid until
+	// bucketNamesExpiration. The buckets are only set up once looked up.
+	//
+	// GUARDED_BY(mu)
+	bucketNames           []string
+	bucketNamesExpiration time.Time
+
 	metricHandle common.MetricHandle
 }
 
@@ -72,11 +85,15 @@ func NewBaseDirInode(
 	name Name,
 	attrs fuseops.InodeAttributes,
 	bm gcsx.BucketManager,
+	bucketListTTL time.Duration,
+	cacheClock timeutil.Clock,
 	metricHandle common.MetricHandle) (d DirInode) {
 	typed := &baseDirInode{
 		id:            id,
 		name:          NewRootName(""),
 		attrs:         attrs,
+		bucketListTTL: bucketListTTL,
+		cacheClock:    cacheClock,
 		bucketManager: bm,
 		buckets:       make(map[string]gcsx.SyncerBucket),
 		metricHandle:  metricHandle,
@@ -161,6 +178,10 @@ func (d *baseDirInode) LookUpChild(ctx context.Context, name string) (*Core, err
 	bucket, ok := d.buckets[name]
 	if !ok {
 		bucket, err = d.bucketManager.SetUpBucket(ctx, name, true, d.metricHandle)
+		if errors.Is(err, gcsx.ErrBucketNotAllowed) {
+			// Excluded buckets don't exist as far as the user is concerned.
+			return nil, nil
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -184,11 +205,33 @@ func (d *baseDirInode) ReadEntries(
 	ctx context.Context,
 	tok string) (entries []fuseutil.Dirent, newTok string, err error) {
 
-	// The subdirectories of the base directory should be all the accessible
-	// buckets. Although the user is allowed to visit each individual
-	// subdirectory, listing all the subdirectories (i.e. the buckets) can be
-	// very expensive and currently not supported.
-	return nil, "", syscall.ENOTSUP
+	// The subdirectories of the base directory are all the accessible buckets.
+	// Listing them is a single call for the whole project, so everything is
+	// returned in one batch.
+	if d.bucketNames == nil || !d.cacheClock.Now().Before(d.bucketNamesExpiration) {
+		var names []string
+		names, err = d.bucketManager.ListBuckets(ctx)
+		if err != nil {
+			err = fmt.Errorf("ListBuckets: %w", err)
+			return
+		}
+
+		d.bucketNames = names
+		if d.bucketNames == nil {
+			d.bucketNames = []string{}
+		}
+		d.bucketNamesExpiration = d.cacheClock.Now().Add(d.bucketListTTL)
+	}
+
+	for i, name := range d.bucketNames {
+		entries = append(entries, fuseutil.Dirent{
+			Offset: fuseops.DirOffset(i + 1),
+			Name:   name,
+			Type:   fuseutil.DT_Directory,
+		})
+	}
+
+	return
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -200,7 +243,7 @@ func (d *baseDirInode) ReadEntries(
 // tries to mutate the base directory, they will receive a ENOSYS error
 // indicating such operation is not supported.
 
-func (d *baseDirInode) CreateChildFile(ctx context.Context, name string) (*Core, error) {
+func (d *baseDirInode) CreateChildFile(ctx context.Context, name string, pa PosixAttributes) (*Core, error) {
 	return nil, fuse.ENOSYS
 }
 
@@ -212,7 +255,11 @@ func (d *baseDirInode) CreateLocalChildFileCore(_ string) (Core, error) {
 	return Core{}, fuse.ENOSYS
 }
 
-func (d *baseDirInode) CloneToChildFile(ctx context.Context, name string, src *gcs.MinObject) (*Core, error) {
+func (d *baseDirInode) CloneToChildFile(ctx context.Context, name string, src *gcs.MinObject, dstGeneration *int64) (*Core, error) {
+	return nil, fuse.ENOSYS
+}
+
+func (d *baseDirInode) RewriteToChildFile(ctx context.Context, name string, srcBucketName string, src *gcs.MinObject, rewriteToken string, progressFunc func(uint64, uint64, string)) (*Core, error) {
 	return nil, fuse.ENOSYS
 }
 
@@ -220,7 +267,7 @@ func (d *baseDirInode) CreateChildSymlink(ctx context.Context, name string, targ
 	return nil, fuse.ENOSYS
 }
 
-func (d *baseDirInode) CreateChildDir(ctx context.Context, name string) (*Core, error) {
+func (d *baseDirInode) CreateChildDir(ctx context.Context, name string, pa PosixAttributes) (*Core, error) {
 	return nil, fuse.ENOSYS
 }
 
@@ -248,12 +295,12 @@ func (d *baseDirInode) LocalFileEntries(localFileInodes map[Name]Inode) (localEn
 }
 
 func (d *baseDirInode) ShouldInvalidateKernelListCache(ttl time.Duration) bool {
-	// Keeping the default behavior although list operation is not supported
-	// for baseDirInode.
+	// The listing of buckets has its own TTL, so let the kernel ask again and
+	// serve it from there.
 	return true
 }
 
-// List operation is not supported for baseDirInode.
+// The listing of buckets is not affected by operations on the file system.
 func (d *baseDirInode) InvalidateKernelListCache() {}
 
 func (d *baseDirInode) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (op *gcs.Folder, err error) {
@@ -15,8 +15,11 @@
 package inode
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"syscall"
 	"testing"
 	"time"
 
@@ -28,6 +31,7 @@ import (
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
 	. "github.com/jacobsa/ogletest"
 	"github.com/jacobsa/timeutil"
 )
@@ -64,13 +68,17 @@ func (t *BaseDirTest) SetUp(ti *TestInfo) {
 		1, // Append threshold
 		ChunkTransferTimeoutSecs,
 		".gcsfuse_tmp/",
+		nil,
 		fake.NewFakeBucket(&t.clock, "bucketA", gcs.NonHierarchical),
+		common.NewNoopMetrics(),
 	)
 	t.bm.buckets["bucketB"] = gcsx.NewSyncerBucket(
 		1, // Append threshold
 		ChunkTransferTimeoutSecs,
 		".gcsfuse_tmp/",
+		nil,
 		fake.NewFakeBucket(&t.clock, "bucketB", gcs.NonHierarchical),
+		common.NewNoopMetrics(),
 	)
 
 	// Create the inode. No implicit dirs by default.
@@ -88,12 +96,19 @@ func (t *BaseDirTest) TearDown() {
 type fakeBucketManager struct {
 	buckets    map[string]gcsx.SyncerBucket
 	setupTimes int
+	listTimes  int
+	listErr    error
+	setUpErr   error
 }
 
 func (bm *fakeBucketManager) SetUpBucket(
 	ctx context.Context,
 	name string, isMultibucketMount bool, _ common.MetricHandle) (sb gcsx.SyncerBucket, err error) {
 	bm.setupTimes++
+	if bm.setUpErr != nil {
+		err = bm.setUpErr
+		return
+	}
 
 	var ok bool
 	sb, ok = bm.buckets[name]
@@ -104,6 +119,20 @@ func (bm *fakeBucketManager) SetUpBucket(
 	return
 }
 
+func (bm *fakeBucketManager) ListBuckets(ctx context.Context) (names []string, err error) {
+	bm.listTimes++
+	if bm.listErr != nil {
+		err = bm.listErr
+		return
+	}
+
+	for name := range bm.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
 func (bm *fakeBucketManager) ShutDown() {}
 
 func (bm *fakeBucketManager) SetUpTimes() int {
@@ -124,6 +153,8 @@ func (t *BaseDirTest) resetInode() {
 			Mode: dirMode,
 		},
 		t.bm,
+		time.Minute,
+		&t.clock,
 		common.NewNoopMetrics())
 
 	t.in.Lock()
@@ -207,6 +238,57 @@ func (t *BaseDirTest) LookUpChild_BucketCached() {
 	ExpectEq(3, t.bm.SetUpTimes())
 }
 
+func (t *BaseDirTest) LookUpChild_BucketNotAllowed() {
+	t.bm.setUpErr = fmt.Errorf("%q: %w", "denied", gcsx.ErrBucketNotAllowed)
+
+	result, err := t.in.LookUpChild(t.ctx, "denied")
+
+	ExpectEq(nil, err)
+	ExpectEq(nil, result)
+}
+
+func (t *BaseDirTest) ReadEntries_ListsBuckets() {
+	entries, tok, err := t.in.ReadEntries(t.ctx, "")
+
+	AssertEq(nil, err)
+	ExpectEq("", tok)
+	AssertEq(2, len(entries))
+	ExpectEq("bucketA", entries[0].Name)
+	ExpectEq(fuseutil.DT_Directory, entries[0].Type)
+	ExpectEq("bucketB", entries[1].Name)
+	ExpectEq(fuseutil.DT_Directory, entries[1].Type)
+	// Listing doesn't set up the buckets.
+	ExpectEq(0, t.bm.SetUpTimes())
+}
+
+func (t *BaseDirTest) ReadEntries_CachedWithinTTL() {
+	_, _, err := t.in.ReadEntries(t.ctx, "")
+	AssertEq(nil, err)
+	t.bm.buckets["bucketC"] = gcsx.SyncerBucket{}
+
+	t.clock.AdvanceTime(time.Minute - time.Millisecond)
+	entries, _, err := t.in.ReadEntries(t.ctx, "")
+
+	AssertEq(nil, err)
+	ExpectEq(2, len(entries))
+	ExpectEq(1, t.bm.listTimes)
+
+	t.clock.AdvanceTime(time.Millisecond)
+	entries, _, err = t.in.ReadEntries(t.ctx, "")
+
+	AssertEq(nil, err)
+	ExpectEq(3, len(entries))
+	ExpectEq(2, t.bm.listTimes)
+}
+
+func (t *BaseDirTest) ReadEntries_ListingFails() {
+	t.bm.listErr = syscall.ENOTSUP
+
+	_, _, err := t.in.ReadEntries(t.ctx, "")
+
+	ExpectTrue(errors.Is(err, syscall.ENOTSUP))
+}
+
 func (t *BaseDirTest) Test_ShouldInvalidateKernelListCache() {
 	ttl := time.Second
 	AssertEq(true, t.in.ShouldInvalidateKernelListCache(ttl))
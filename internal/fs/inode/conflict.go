@@ -0,0 +1,192 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/gcsfuse_errors"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"golang.org/x/net/context"
+)
+
+// When the object of a file inode has been changed by someone else since the
+// content was derived from it, the write conflict policy decides what becomes
+// of the content on sync (see cfg.WriteConflictPolicyFail and friends).
+
+// The name of this host, as recorded in the names of conflict copies.
+var conflictHostname = sync.OnceValue(func() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		logger.Warnf("Hostname for conflict copies: %v", err)
+		return "unknown"
+	}
+	return hostname
+})
+
+// conflictCopyName returns the name of the object that the content derived
+// from the given generation of the object is uploaded as, when it conflicts
+// with a later generation. Local files have generation zero.
+func conflictCopyName(objectName string, generation int64) string {
+	return fmt.Sprintf("%s.conflict-%s-%d", objectName, conflictHostname(), generation)
+}
+
+// rewrittenContent presents all of the content as dirty, so that syncing it
+// against an object it wasn't derived from rewrites the object in full.
+type rewrittenContent struct {
+	gcsx.TempFile
+	mtime time.Time
+}
+
+func (rc *rewrittenContent) Stat() (sr gcsx.StatResult, err error) {
+	sr, err = rc.TempFile.Stat()
+	if err != nil {
+		return
+	}
+
+	sr.DirtyThreshold = 0
+	if sr.Mtime == nil {
+		sr.Mtime = &rc.mtime
+	}
+	return
+}
+
+func (rc *rewrittenContent) DirtyRanges() []gcsx.DirtyRange {
+	sr, err := rc.TempFile.Stat()
+	if err != nil || sr.Size == 0 {
+		return nil
+	}
+	return []gcsx.DirtyRange{{Start: 0, Limit: sr.Size}}
+}
+
+// statForConflict fetches the named object with all of its attributes, or
+// returns nil if it doesn't exist.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) statForConflict(ctx context.Context, name string) (o *gcs.Object, err error) {
+	m, e, err := f.bucket.StatObject(ctx, &gcs.StatObjectRequest{
+		Name:                           name,
+		ForceFetchFromGcs:              true,
+		ReturnExtendedObjectAttributes: true,
+	})
+
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		err = nil
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("StatObject: %w", err)
+		return
+	}
+
+	o = storageutil.ConvertMinObjectAndExtendedObjectAttributesToObject(m, e)
+	return
+}
+
+// resolveConflict writes the content out according to the write conflict
+// policy, given the latest generation of the object, which is nil if the
+// object no longer exists. If the content was written out as a conflict copy,
+// copied is set and newObj is the latest generation rather than the copy.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) resolveConflict(
+	ctx context.Context,
+	latest *gcs.Object,
+	cause error) (newObj *gcs.Object, copied bool, err error) {
+	name := f.Name().GcsObjectName()
+	content := &rewrittenContent{TempFile: f.content, mtime: f.mtimeClock.Now()}
+
+	switch f.writeConfig.ExperimentalConflictPolicy {
+	case cfg.WriteConflictPolicyLastWriterWins:
+		logger.Warnf("Overwriting %q, which was changed by someone else since it was read", name)
+		newObj, err = f.bucket.SyncObject(ctx, name, latest, content)
+		if err != nil {
+			break
+		}
+
+		// Nothing was written if the latest generation matches the content.
+		if newObj == nil {
+			newObj = latest
+		}
+		return
+
+	case cfg.WriteConflictPolicyConflictCopy:
+		copyName := conflictCopyName(name, f.src.Generation)
+		var copyObj *gcs.Object
+		if copyObj, err = f.statForConflict(ctx, copyName); err != nil {
+			return
+		}
+
+		if _, err = f.bucket.SyncObject(ctx, copyName, copyObj, content); err != nil {
+			break
+		}
+
+		logger.Warnf("%q was changed by someone else since it was read, local changes were saved as %q", name, copyName)
+		newObj, copied = latest, true
+		return
+
+	default:
+		err = &gcsfuse_errors.FileClobberedError{Err: cause}
+		return
+	}
+
+	// Another writer got in first again.
+	var preconditionErr *gcs.PreconditionError
+	if errors.As(err, &preconditionErr) {
+		err = &gcsfuse_errors.FileClobberedError{
+			Err: fmt.Errorf("SyncObject: %w", err),
+		}
+		return
+	}
+
+	err = fmt.Errorf("SyncObject: %w", err)
+	return
+}
+
+// rebaseAfterConflictCopy makes the latest generation of the object the
+// source of the inode, after the content, or the data streamed, has been saved
+// as a conflict copy.
+// If the object no longer exists the inode is left clobbered.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) rebaseAfterConflictCopy(latest *gcs.Object) {
+	f.discardFailedWriteBack()
+	f.lastSynced = f.mtimeClock.Now()
+	f.lastSyncErr = nil
+
+	if latest != nil {
+		if minObj := storageutil.ConvertObjToMinObject(latest); minObj != nil {
+			f.src = *minObj
+		}
+		f.local = false
+	}
+
+	if f.content != nil {
+		f.content.Destroy()
+		f.content = nil
+	}
+	f.dirtySince = time.Time{}
+	f.pendingPosixAttrs = nil
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"path"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
@@ -27,6 +28,7 @@ import (
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse"
 	"github.com/jacobsa/fuse/fuseops"
 	"github.com/jacobsa/fuse/fuseutil"
 	"github.com/jacobsa/timeutil"
@@ -89,9 +91,10 @@ type DirInode interface {
 		tok string) (entries []fuseutil.Dirent, newTok string, err error)
 
 	// Create an empty child file with the supplied (relative) name, failing with
-	// *gcs.PreconditionError if a backing object already exists in GCS.
+	// *gcs.PreconditionError if a backing object already exists in GCS. The
+	// supplied attributes are persisted in the metadata of the object.
 	// Return the full name of the child and the GCS object it backs up.
-	CreateChildFile(ctx context.Context, name string) (*Core, error)
+	CreateChildFile(ctx context.Context, name string, pa PosixAttributes) (*Core, error)
 
 	// CreateLocalChildFileCore returns an empty local child file core.
 	CreateLocalChildFileCore(name string) (Core, error)
@@ -104,8 +107,22 @@ type DirInode interface {
 
 	// Like CreateChildFile, except clone the supplied source object instead of
 	// creating an empty object.
-	// Return the full name of the child and the GCS object it backs up.
-	CloneToChildFile(ctx context.Context, name string, src *gcs.MinObject) (*Core, error)
+	// Return the full name of the child and the GCS object it backs up. If
+	// dstGeneration is non-nil, the child is only replaced if its object has
+	// that generation, zero meaning that there is none.
+	CloneToChildFile(ctx context.Context, name string, src *gcs.MinObject, dstGeneration *int64) (*Core, error)
+
+	// Like CloneToChildFile, except the source object lives in the bucket with
+	// the supplied name, and is copied with a rewrite. A non-empty
+	// rewriteToken resumes an earlier, interrupted rewrite of the same source;
+	// progressFunc, if non-nil, receives the token to resume this one.
+	RewriteToChildFile(
+		ctx context.Context,
+		name string,
+		srcBucketName string,
+		src *gcs.MinObject,
+		rewriteToken string,
+		progressFunc func(bytesRewritten uint64, totalBytes uint64, rewriteToken string)) (*Core, error)
 
 	// Create a symlink object with the supplied (relative) name and the supplied
 	// target, failing with *gcs.PreconditionError if a backing object already
@@ -115,9 +132,10 @@ type DirInode interface {
 
 	// Create a backing object for a child directory with the supplied (relative)
 	// name, failing with *gcs.PreconditionError if a backing object already
-	// exists in GCS.
+	// exists in GCS. The supplied attributes are persisted in the metadata of
+	// the object, unless the bucket is hierarchical and the directory a folder.
 	// Return the full name of the child and the GCS object it backs up.
-	CreateChildDir(ctx context.Context, name string) (*Core, error)
+	CreateChildDir(ctx context.Context, name string, pa PosixAttributes) (*Core, error)
 
 	// Delete the backing object for the child file or symlink with the given
 	// (relative) name and generation number, where zero means the latest
@@ -228,6 +246,7 @@ type dirInode struct {
 }
 
 var _ DirInode = &dirInode{}
+var _ XattrInode = &dirInode{}
 
 // Create a directory inode for the name, representing the directory containing
 // the objects for which it is an immediate prefix. For the root directory,
@@ -799,10 +818,11 @@ func (d *dirInode) ReadEntries(
 }
 
 // LOCKS_REQUIRED(d)
-func (d *dirInode) CreateChildFile(ctx context.Context, name string) (*Core, error) {
+func (d *dirInode) CreateChildFile(ctx context.Context, name string, pa PosixAttributes) (*Core, error) {
 	childMetadata := map[string]string{
 		FileMtimeMetadataKey: d.mtimeClock.Now().UTC().Format(time.RFC3339Nano),
 	}
+	childMetadata = pa.addTo(childMetadata)
 	fullName := NewFileName(d.Name(), name)
 
 	o, err := d.createNewObject(ctx, fullName, childMetadata)
@@ -839,7 +859,7 @@ func (d *dirInode) EraseFromTypeCache(name string) {
 }
 
 // LOCKS_REQUIRED(d)
-func (d *dirInode) CloneToChildFile(ctx context.Context, name string, src *gcs.MinObject) (*Core, error) {
+func (d *dirInode) CloneToChildFile(ctx context.Context, name string, src *gcs.MinObject, dstGeneration *int64) (*Core, error) {
 	// Erase any existing type information for this name.
 	d.cache.Erase(name)
 	fullName := NewFileName(d.Name(), name)
@@ -852,6 +872,45 @@ func (d *dirInode) CloneToChildFile(ctx context.Context, name string, src *gcs.M
 			SrcGeneration:                 src.Generation,
 			SrcMetaGenerationPrecondition: &src.MetaGeneration,
 			DstName:                       fullName.GcsObjectName(),
+			DstGenerationPrecondition:     dstGeneration,
+		})
+	if err != nil {
+		return nil, err
+	}
+	m := storageutil.ConvertObjToMinObject(o)
+
+	c := &Core{
+		Bucket:    d.Bucket(),
+		FullName:  fullName,
+		MinObject: m,
+	}
+	d.cache.Insert(d.cacheClock.Now(), name, c.Type())
+	return c, nil
+}
+
+// LOCKS_REQUIRED(d)
+func (d *dirInode) RewriteToChildFile(
+	ctx context.Context,
+	name string,
+	srcBucketName string,
+	src *gcs.MinObject,
+	rewriteToken string,
+	progressFunc func(bytesRewritten uint64, totalBytes uint64, rewriteToken string)) (*Core, error) {
+	// Erase any existing type information for this name.
+	d.cache.Erase(name)
+	fullName := NewFileName(d.Name(), name)
+
+	// Rewrite over anything that might already exist for the name.
+	o, err := d.bucket.RewriteObject(
+		ctx,
+		&gcs.RewriteObjectRequest{
+			SrcBucketName:                 srcBucketName,
+			SrcName:                       src.Name,
+			SrcGeneration:                 src.Generation,
+			SrcMetaGenerationPrecondition: &src.MetaGeneration,
+			DstName:                       fullName.GcsObjectName(),
+			RewriteToken:                  rewriteToken,
+			ProgressFunc:                  progressFunc,
 		})
 	if err != nil {
 		return nil, err
@@ -890,7 +949,7 @@ func (d *dirInode) CreateChildSymlink(ctx context.Context, name string, target s
 }
 
 // LOCKS_REQUIRED(d)
-func (d *dirInode) CreateChildDir(ctx context.Context, name string) (*Core, error) {
+func (d *dirInode) CreateChildDir(ctx context.Context, name string, pa PosixAttributes) (*Core, error) {
 	// Generate the full name for the new directory.
 	fullName := NewDirName(d.Name(), name)
 	var m *gcs.MinObject
@@ -907,7 +966,7 @@ func (d *dirInode) CreateChildDir(ctx context.Context, name string) (*Core, erro
 	} else {
 		var o *gcs.Object
 		// For non-hierarchical buckets, create a new object.
-		o, err = d.createNewObject(ctx, fullName, nil)
+		o, err = d.createNewObject(ctx, fullName, pa.addTo(nil))
 		if err != nil {
 			return nil, err
 		}
@@ -1062,3 +1121,111 @@ func (d *dirInode) isBucketHierarchical() bool {
 	}
 	return false
 }
+
+// Stat the object backing this directory, bypassing the stat cache. Return
+// nil if there is no such object, e.g. for implicit directories and for
+// folders in a hierarchical bucket.
+//
+// LOCKS_REQUIRED(d)
+func (d *dirInode) statBackingObject(ctx context.Context) (*gcs.Object, error) {
+	if d.name.IsBucketRoot() {
+		return nil, nil
+	}
+
+	req := &gcs.StatObjectRequest{
+		Name:                           d.name.GcsObjectName(),
+		ForceFetchFromGcs:              true,
+		ReturnExtendedObjectAttributes: true,
+	}
+	m, e, err := d.bucket.StatObject(ctx, req)
+
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("StatObject: %w", err)
+	}
+
+	return storageutil.ConvertMinObjectAndExtendedObjectAttributesToObject(m, e), nil
+}
+
+// LOCKS_REQUIRED(d)
+func (d *dirInode) Xattrs(ctx context.Context) (map[string][]byte, error) {
+	o, err := d.statBackingObject(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if o != nil || !d.isBucketHierarchical() || d.name.IsBucketRoot() {
+		return objectXattrs(o), nil
+	}
+
+	folder, err := d.bucket.GetFolder(ctx, d.name.GcsObjectName())
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return folderXattrs(nil), nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("GetFolder: %w", err)
+	}
+
+	return folderXattrs(folder), nil
+}
+
+// LOCKS_REQUIRED(d)
+func (d *dirInode) SetXattr(
+	ctx context.Context,
+	name string,
+	value []byte,
+	flags uint32) error {
+	key, err := userXattrKey(name)
+	if err != nil {
+		return err
+	}
+
+	o, err := d.statBackingObject(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Implicit directories and folders have no custom metadata of their own.
+	if o == nil {
+		return syscall.ENOTSUP
+	}
+
+	_, exists := o.Metadata[key]
+	if err = checkXattrFlags(exists, flags); err != nil {
+		return err
+	}
+
+	formatted := string(value)
+	_, err = updateObjectMetadata(ctx, d.bucket, storageutil.ConvertObjToMinObject(o), key, &formatted)
+	return err
+}
+
+// LOCKS_REQUIRED(d)
+func (d *dirInode) RemoveXattr(ctx context.Context, name string) error {
+	key, err := userXattrKey(name)
+	if err != nil {
+		return err
+	}
+
+	o, err := d.statBackingObject(ctx)
+	if err != nil {
+		return err
+	}
+
+	if o == nil {
+		return fuse.ENOATTR
+	}
+
+	if _, ok := o.Metadata[key]; !ok {
+		return fuse.ENOATTR
+	}
+
+	_, err = updateObjectMetadata(ctx, d.bucket, storageutil.ConvertObjToMinObject(o), key, nil)
+	return err
+}
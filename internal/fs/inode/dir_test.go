@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
 	"golang.org/x/sync/semaphore"
 
@@ -75,7 +76,9 @@ func (t *DirTest) SetUp(ti *TestInfo) {
 		1, // Append threshold
 		ChunkTransferTimeoutSecs,
 		".gcsfuse_tmp/",
-		bucket)
+		nil,
+		bucket,
+		common.NewNoopMetrics())
 	// Create the inode. No implicit dirs by default.
 	t.resetInode(false, false, true)
 }
@@ -209,7 +212,8 @@ func (t *DirTest) createLocalFileInode(parent Name, name string, id fuseops.Inod
 		&t.clock,
 		true, //localFile
 		&cfg.WriteConfig{},
-		semaphore.NewWeighted(math.MaxInt64))
+		semaphore.NewWeighted(math.MaxInt64),
+		false)
 	return
 }
 
@@ -966,7 +970,7 @@ func (t *DirTest) CreateChildFile_DoesntExist() {
 	objName := path.Join(dirInodeName, name)
 
 	// Call the inode.
-	result, err := t.in.CreateChildFile(t.ctx, name)
+	result, err := t.in.CreateChildFile(t.ctx, name, PosixAttributes{})
 	AssertEq(nil, err)
 	AssertNe(nil, result)
 	AssertNe(nil, result.MinObject)
@@ -994,7 +998,7 @@ func (t *DirTest) CreateChildFile_Exists() {
 	AssertEq(nil, err)
 
 	// Call the inode.
-	_, err = t.in.CreateChildFile(t.ctx, name)
+	_, err = t.in.CreateChildFile(t.ctx, name, PosixAttributes{})
 	ExpectThat(err, Error(HasSubstr("Precondition")))
 	ExpectThat(err, Error(HasSubstr("exists")))
 	ExpectEq(metadata.UnknownType, t.getTypeFromCache(name))
@@ -1009,7 +1013,7 @@ func (t *DirTest) CreateChildFile_TypeCaching() {
 	var err error
 
 	// Create the name.
-	_, err = t.in.CreateChildFile(t.ctx, name)
+	_, err = t.in.CreateChildFile(t.ctx, name, PosixAttributes{})
 	AssertEq(nil, err)
 
 	// Create a backing object for a directory.
@@ -1056,7 +1060,7 @@ func (t *DirTest) CloneToChildFile_SourceDoesntExist() {
 
 	// Call the inode.
 	srcMinObject := storageutil.ConvertObjToMinObject(src)
-	_, err = t.in.CloneToChildFile(t.ctx, path.Base(dstName), srcMinObject)
+	_, err = t.in.CloneToChildFile(t.ctx, path.Base(dstName), srcMinObject, nil)
 	var notFoundErr *gcs.NotFoundError
 	ExpectTrue(errors.As(err, &notFoundErr))
 	ExpectEq(metadata.UnknownType, t.getTypeFromCache(dstName))
@@ -1072,7 +1076,7 @@ func (t *DirTest) CloneToChildFile_DestinationDoesntExist() {
 
 	// Call the inode.
 	srcMinObject := storageutil.ConvertObjToMinObject(src)
-	result, err := t.in.CloneToChildFile(t.ctx, path.Base(dstName), srcMinObject)
+	result, err := t.in.CloneToChildFile(t.ctx, path.Base(dstName), srcMinObject, nil)
 	AssertEq(nil, err)
 	AssertNe(nil, result)
 	AssertNe(nil, result.MinObject)
@@ -1090,6 +1094,43 @@ func (t *DirTest) CloneToChildFile_DestinationDoesntExist() {
 	ExpectEq(metadata.RegularFileType, t.getTypeFromCache("qux"))
 }
 
+func (t *DirTest) RewriteToChildFile_DestinationDoesntExist() {
+	const srcName = "blah/baz"
+	dstName := path.Join(dirInodeName, "qux")
+	var progressed uint64
+
+	// Create the source.
+	src, err := storageutil.CreateObject(t.ctx, t.bucket, srcName, []byte("taco"))
+	AssertEq(nil, err)
+
+	// Call the inode.
+	srcMinObject := storageutil.ConvertObjToMinObject(src)
+	result, err := t.in.RewriteToChildFile(t.ctx, path.Base(dstName), t.bucket.Name(), srcMinObject, "", func(bytesRewritten, _ uint64, _ string) {
+		progressed = bytesRewritten
+	})
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+	ExpectEq(metadata.RegularFileType, t.getTypeFromCache("qux"))
+	ExpectEq(dstName, result.MinObject.Name)
+	ExpectEq(len("taco"), progressed)
+
+	// Check resulting contents.
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, dstName)
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+}
+
+func (t *DirTest) RewriteToChildFile_SourceBucketDoesntExist() {
+	dstName := path.Join(dirInodeName, "qux")
+	src := &gcs.MinObject{Name: "blah/baz", Generation: 1}
+
+	_, err := t.in.RewriteToChildFile(t.ctx, path.Base(dstName), "other_bucket", src, "", nil)
+
+	var notFoundErr *gcs.NotFoundError
+	ExpectTrue(errors.As(err, &notFoundErr))
+	ExpectEq(metadata.UnknownType, t.getTypeFromCache(dstName))
+}
+
 func (t *DirTest) CloneToChildFile_DestinationExists() {
 	const srcName = "blah/baz"
 	dstName := path.Join(dirInodeName, "qux")
@@ -1104,7 +1145,7 @@ func (t *DirTest) CloneToChildFile_DestinationExists() {
 
 	// Call the inode.
 	srcMinObject := storageutil.ConvertObjToMinObject(src)
-	result, err := t.in.CloneToChildFile(t.ctx, path.Base(dstName), srcMinObject)
+	result, err := t.in.CloneToChildFile(t.ctx, path.Base(dstName), srcMinObject, nil)
 	AssertEq(nil, err)
 	AssertNe(nil, result)
 	AssertNe(nil, result.MinObject)
@@ -1135,7 +1176,7 @@ func (t *DirTest) CloneToChildFile_TypeCaching() {
 
 	// Clone to the destination.
 	srcMinObject := storageutil.ConvertObjToMinObject(src)
-	_, err = t.in.CloneToChildFile(t.ctx, path.Base(dstName), srcMinObject)
+	_, err = t.in.CloneToChildFile(t.ctx, path.Base(dstName), srcMinObject, nil)
 	AssertEq(nil, err)
 
 	// Create a backing object for a directory.
@@ -1244,7 +1285,7 @@ func (t *DirTest) CreateChildDir_DoesntExist() {
 	objName := path.Join(dirInodeName, name) + "/"
 
 	// Call the inode.
-	result, err := t.in.CreateChildDir(t.ctx, name)
+	result, err := t.in.CreateChildDir(t.ctx, name, PosixAttributes{})
 	AssertEq(nil, err)
 	AssertNe(nil, result)
 	AssertNe(nil, result.MinObject)
@@ -1267,7 +1308,7 @@ func (t *DirTest) CreateChildDir_Exists() {
 	AssertEq(nil, err)
 
 	// Call the inode.
-	_, err = t.in.CreateChildDir(t.ctx, name)
+	_, err = t.in.CreateChildDir(t.ctx, name, PosixAttributes{})
 	ExpectThat(err, Error(HasSubstr("Precondition")))
 	ExpectThat(err, Error(HasSubstr("exists")))
 	ExpectEq(metadata.UnknownType, t.getTypeFromCache(name))
@@ -1373,7 +1414,7 @@ func (t *DirTest) DeleteChildFile_TypeCaching() {
 	var err error
 
 	// Create the name, priming the type cache.
-	_, err = t.in.CreateChildFile(t.ctx, name)
+	_, err = t.in.CreateChildFile(t.ctx, name, PosixAttributes{})
 	AssertEq(nil, err)
 
 	// Create a backing object for a directory. It should be shadowed by the
@@ -15,12 +15,14 @@
 package inode
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/jacobsa/fuse/fuseops"
 	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
 )
 
 // An inode representing a directory backed by an object in GCS with a specific
@@ -75,6 +77,8 @@ func NewExplicitDirInode(
 	return
 }
 
+var _ PosixAttributesInode = &explicitDirInode{}
+
 type explicitDirInode struct {
 	*dirInode
 	generation Generation
@@ -84,3 +88,33 @@ func (d *explicitDirInode) SourceGeneration() (gen Generation) {
 	gen = d.generation
 	return
 }
+
+// SetPosixAttributes persists mode, ownership and atime changes in the
+// metadata of the backing object. Folders in hierarchical buckets have no
+// backing object, so changes to them are ignored as before.
+//
+// LOCKS_REQUIRED(d)
+func (d *explicitDirInode) SetPosixAttributes(
+	ctx context.Context,
+	pa PosixAttributes) (err error) {
+	if pa.IsEmpty() || d.generation.Object == 0 {
+		return
+	}
+
+	req := &gcs.UpdateObjectRequest{
+		Name:                       d.Name().GcsObjectName(),
+		Generation:                 d.generation.Object,
+		MetaGenerationPrecondition: &d.generation.Metadata,
+		Metadata:                   pa.metadata(),
+	}
+
+	o, err := d.bucket.UpdateObject(ctx, req)
+	if err != nil {
+		err = fmt.Errorf("UpdateObject: %w", err)
+		return
+	}
+
+	d.generation.Metadata = o.MetaGeneration
+	d.attrs = ApplyPosixAttributes(d.attrs, o.Metadata)
+	return
+}
@@ -20,6 +20,8 @@ import (
 	"io"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
@@ -27,8 +29,11 @@ import (
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/gcsfuse_errors"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/writeback"
+	"github.com/jacobsa/fuse"
 	"github.com/jacobsa/fuse/fuseops"
 	"github.com/jacobsa/syncutil"
 	"github.com/jacobsa/timeutil"
@@ -53,7 +58,6 @@ type FileInode struct {
 	/////////////////////////
 
 	id           fuseops.InodeID
-	name         Name
 	attrs        fuseops.InodeAttributes
 	contentCache *contentcache.ContentCache
 	// TODO (#640) remove bool flag and refactor contentCache to support two implementations:
@@ -64,6 +68,10 @@ type FileInode struct {
 	// Mutable state
 	/////////////////////////
 
+	// The name of the inode. It only changes when a local file is renamed (see
+	// Rename), and may be read without holding any lock.
+	name atomic.Pointer[Name]
+
 	// A mutex that must be held when calling certain methods. See documentation
 	// for each method.
 	mu syncutil.InvariantMutex
@@ -96,9 +104,65 @@ type FileInode struct {
 	bwh                *bufferedwrites.BufferedWriteHandler
 	writeConfig        *cfg.WriteConfig
 	globalMaxBlocksSem *semaphore.Weighted
+
+	// Whether mode, ownership and atime are persisted in object metadata. See
+	// posix_attrs.go.
+	persistPosixAttrs bool
+
+	// Attribute changes made while the file is local, persisted once it has
+	// been synced to GCS.
+	//
+	// GUARDED_BY(mu)
+	pendingPosixAttrs map[string]string
+
+	// The write-back of the content in progress, if any. See WriteBack.
+	//
+	// GUARDED_BY(mu)
+	writeBack *writeback.Upload
+
+	// The background sync in progress, if any. See BackgroundSync.
+	//
+	// GUARDED_BY(mu)
+	backgroundUpload *BackgroundUpload
+
+	// Incremented whenever the content is modified, so that after a write-back
+	// the content is dropped only if it is still what was written back.
+	//
+	// GUARDED_BY(mu)
+	contentVersion   uint64
+	writeBackVersion uint64
+
+	// The outcome of the last write-back, if it failed, to be returned by the
+	// next WriteBack or Sync. The journal entry of a failed upload is kept for
+	// the next mount until the content is journaled or synced again.
+	//
+	// GUARDED_BY(mu)
+	writeBackErr    error
+	failedWriteBack *contentcache.JournalEntry
+
+	// When the content was first modified since it was last written out, or
+	// zero if it hasn't been. See SyncStatus.
+	//
+	// GUARDED_BY(mu)
+	dirtySince time.Time
+
+	// The amount of data the buffered write handler had been given when it was
+	// last synced.
+	//
+	// GUARDED_BY(mu)
+	bwhSyncedSize int64
+
+	// When the content was last written out, and the error of the last attempt
+	// if it failed.
+	//
+	// GUARDED_BY(mu)
+	lastSynced  time.Time
+	lastSyncErr error
 }
 
 var _ Inode = &FileInode{}
+var _ XattrInode = &FileInode{}
+var _ PosixAttributesInode = &FileInode{}
 
 // Create a file inode for the given min object in GCS. The initial lookup count is
 // zero.
@@ -119,7 +183,8 @@ func NewFileInode(
 	mtimeClock timeutil.Clock,
 	localFile bool,
 	writeConfig *cfg.WriteConfig,
-	globalMaxBlocksSem *semaphore.Weighted) (f *FileInode) {
+	globalMaxBlocksSem *semaphore.Weighted,
+	persistPosixAttrs bool) (f *FileInode) {
 	// Set up the basic struct.
 	var minObj gcs.MinObject
 	if m != nil {
@@ -129,7 +194,6 @@ func NewFileInode(
 		bucket:             bucket,
 		mtimeClock:         mtimeClock,
 		id:                 id,
-		name:               name,
 		attrs:              attrs,
 		localFileCache:     localFileCache,
 		contentCache:       contentCache,
@@ -138,8 +202,10 @@ func NewFileInode(
 		unlinked:           false,
 		writeConfig:        writeConfig,
 		globalMaxBlocksSem: globalMaxBlocksSem,
+		persistPosixAttrs:  persistPosixAttrs,
 	}
 
+	f.name.Store(&name)
 	f.lc.Init(id)
 
 	// Set up invariant checking.
@@ -184,7 +250,7 @@ func (f *FileInode) clobbered(ctx context.Context, forceFetchFromGcs bool, inclu
 	// Stat the object in GCS. ForceFetchFromGcs ensures object is fetched from
 	// gcs and not cache.
 	req := &gcs.StatObjectRequest{
-		Name:                           f.name.GcsObjectName(),
+		Name:                           f.Name().GcsObjectName(),
 		ForceFetchFromGcs:              forceFetchFromGcs,
 		ReturnExtendedObjectAttributes: includeExtendedObjectAttributes,
 	}
@@ -251,7 +317,7 @@ func (f *FileInode) ensureContent(ctx context.Context) (err error) {
 	if f.localFileCache {
 		// Fetch content from the cache after validating generation numbers again
 		// Generation validation first occurs at inode creation/destruction
-		cacheObjectKey := &contentcache.CacheObjectKey{BucketName: f.bucket.Name(), ObjectName: f.name.objectName}
+		cacheObjectKey := &contentcache.CacheObjectKey{BucketName: f.bucket.Name(), ObjectName: f.Name().objectName}
 		if cacheObject, exists := f.contentCache.Get(cacheObjectKey); exists {
 			if cacheObject.ValidateGeneration(f.src.Generation, f.src.MetaGeneration) {
 				f.content = cacheObject.CacheFile
@@ -315,7 +381,7 @@ func (f *FileInode) ID() fuseops.InodeID {
 }
 
 func (f *FileInode) Name() Name {
-	return f.name
+	return *f.name.Load()
 }
 
 func (f *FileInode) IsLocal() bool {
@@ -330,6 +396,37 @@ func (f *FileInode) Unlink() {
 	f.unlinked = true
 }
 
+// IsRenamable reports whether the file can be renamed in memory, i.e. whether
+// it is a local file whose contents haven't started streaming to GCS under its
+// current name.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) IsRenamable() bool {
+	return f.IsLocal() && !f.IsUnlinked() && f.writeBack == nil && f.backgroundUpload == nil && (f.bwh == nil || !f.bwh.UploadStarted())
+}
+
+// Rename gives a local file a new name, under which its object will be created
+// when it is synced. The caller is responsible for updating any index keyed by
+// name at the same time.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) Rename(newName Name) (err error) {
+	if !f.IsRenamable() {
+		err = fmt.Errorf("cannot rename %q: %w", f.Name(), syscall.ENOTSUP)
+		return
+	}
+
+	if f.bwh != nil {
+		if err = f.bwh.SetObjectName(newName.GcsObjectName()); err != nil {
+			err = fmt.Errorf("SetObjectName: %w", err)
+			return
+		}
+	}
+
+	f.name.Store(&newName)
+	return
+}
+
 // Source returns a record for the GCS object from which this inode is branched. The
 // record is guaranteed not to be modified, and users must not modify it.
 //
@@ -376,11 +473,14 @@ func (f *FileInode) DecrementLookupCount(n uint64) (destroy bool) {
 func (f *FileInode) Destroy() (err error) {
 	f.destroyed = true
 	if f.localFileCache {
-		cacheObjectKey := &contentcache.CacheObjectKey{BucketName: f.bucket.Name(), ObjectName: f.name.objectName}
+		cacheObjectKey := &contentcache.CacheObjectKey{BucketName: f.bucket.Name(), ObjectName: f.Name().objectName}
 		f.contentCache.Remove(cacheObjectKey)
 	} else if f.content != nil {
 		f.content.Destroy()
 	}
+	if f.bwh != nil {
+		f.bwh.Destroy()
+	}
 	return
 }
 
@@ -436,6 +536,12 @@ func (f *FileInode) Attributes(
 	attrs.Atime = attrs.Mtime
 	attrs.Ctime = attrs.Mtime
 
+	// Persisted attributes take precedence over the mount-wide defaults.
+	if f.persistPosixAttrs {
+		attrs = ApplyPosixAttributes(attrs, f.src.Metadata)
+		attrs = ApplyPosixAttributes(attrs, f.pendingPosixAttrs)
+	}
+
 	// If the object has been clobbered, we reflect that as the inode being
 	// unlinked.
 	_, clobbered, err := f.clobbered(ctx, false, false)
@@ -454,6 +560,30 @@ func (f *FileInode) Attributes(
 	return
 }
 
+// Size returns the current size of the file, including local modifications
+// that haven't been synced yet. Unlike Attributes, it never contacts GCS.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) Size() (size uint64, err error) {
+	size = f.src.Size
+
+	if f.content != nil {
+		var sr gcsx.StatResult
+		sr, err = f.content.Stat()
+		if err != nil {
+			err = fmt.Errorf("stat: %w", err)
+			return
+		}
+		size = uint64(sr.Size)
+	}
+
+	if f.bwh != nil {
+		size = uint64(f.bwh.WriteFileInfo().TotalSize)
+	}
+
+	return
+}
+
 func (f *FileInode) Bucket() *gcsx.SyncerBucket {
 	return f.bucket
 }
@@ -505,7 +635,7 @@ func (f *FileInode) Write(
 	data []byte,
 	offset int64) (err error) {
 	// For empty GCS files also we will trigger bufferedWrites flow.
-	if f.src.Size == 0 && f.writeConfig.ExperimentalEnableStreamingWrites {
+	if f.src.Size == 0 && f.writeConfig.ExperimentalEnableStreamingWrites && f.content == nil {
 		err = f.ensureBufferedWriteHandler()
 		if err != nil {
 			return
@@ -513,7 +643,22 @@ func (f *FileInode) Write(
 	}
 
 	if f.bwh != nil {
-		return f.bwh.Write(data, offset)
+		err = f.bwh.Write(data, offset)
+		if err == nil {
+			f.markDirty()
+		}
+		// Unlinked files must not be uploaded, so they don't fall back.
+		if !errors.Is(err, bufferedwrites.ErrOutOfOrderWrite) || f.IsUnlinked() {
+			return
+		}
+
+		// The write is too far out of order to be streamed. Continue with a temp
+		// file, starting from what has been uploaded so far.
+		err = f.fallBackToTempFile(ctx)
+		if err != nil {
+			err = fmt.Errorf("fallBackToTempFile: %w", err)
+			return
+		}
 	}
 
 	// Make sure f.content != nil.
@@ -526,6 +671,8 @@ func (f *FileInode) Write(
 	// Write to the mutable content. Note that io.WriterAt guarantees it returns
 	// an error for short writes.
 	_, err = f.content.WriteAt(data, offset)
+	f.contentVersion++
+	f.markDirty()
 
 	return
 }
@@ -545,6 +692,10 @@ func (f *FileInode) SetMtime(
 		return
 	}
 
+	if err = f.settleWriteBack(ctx); err != nil {
+		return
+	}
+
 	// If we have a local temp file, stat it.
 	var sr gcsx.StatResult
 	if f.content != nil {
@@ -566,6 +717,7 @@ func (f *FileInode) SetMtime(
 	// the mtime locally, it will be synced when the object is created on GCS.
 	if sr.Mtime != nil || f.IsLocal() {
 		f.content.SetMtime(mtime)
+		f.contentVersion++
 		return
 	}
 
@@ -613,6 +765,115 @@ func (f *FileInode) SetMtime(
 	return
 }
 
+// Xattrs returns the extended attributes of the backing object. Local files
+// have no backing object yet, and hence no extended attributes.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) Xattrs(ctx context.Context) (xattrs map[string][]byte, err error) {
+	if err = f.settleWriteBack(ctx); err != nil {
+		return
+	}
+
+	if f.IsLocal() {
+		xattrs = make(map[string][]byte)
+		return
+	}
+
+	o, _, err := f.clobbered(ctx, true, true)
+	if err != nil {
+		return
+	}
+
+	// Metadata-only changes made elsewhere are fine to report, but the content
+	// generation must still be the one we are backed by.
+	if o == nil || o.Generation != f.src.Generation {
+		err = &gcsfuse_errors.FileClobberedError{
+			Err: fmt.Errorf("object %q generation %d no longer exists", f.src.Name, f.src.Generation),
+		}
+		return
+	}
+
+	xattrs = objectXattrs(o)
+	return
+}
+
+// SetXattr stores the value of a user extended attribute in the custom
+// metadata of the backing object. Like SetMtime, this only patches the
+// object's metadata, so the source generation of the inode is preserved and
+// any dirty local content is unaffected.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) SetXattr(
+	ctx context.Context,
+	name string,
+	value []byte,
+	flags uint32) (err error) {
+	key, err := userXattrKey(name)
+	if err != nil {
+		return
+	}
+
+	if err = f.settleWriteBack(ctx); err != nil {
+		return
+	}
+
+	// There is no object to attach metadata to until the file has been synced.
+	if f.IsLocal() {
+		err = syscall.ENOTSUP
+		return
+	}
+
+	_, exists := f.src.Metadata[key]
+	if err = checkXattrFlags(exists, flags); err != nil {
+		return
+	}
+
+	formatted := string(value)
+	err = f.updateMetadata(ctx, key, &formatted)
+	return
+}
+
+// RemoveXattr deletes a user extended attribute from the custom metadata of
+// the backing object.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) RemoveXattr(ctx context.Context, name string) (err error) {
+	key, err := userXattrKey(name)
+	if err != nil {
+		return
+	}
+
+	if err = f.settleWriteBack(ctx); err != nil {
+		return
+	}
+
+	if _, ok := f.src.Metadata[key]; !ok || f.IsLocal() {
+		err = fuse.ENOATTR
+		return
+	}
+
+	err = f.updateMetadata(ctx, key, nil)
+	return
+}
+
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) updateMetadata(ctx context.Context, key string, value *string) (err error) {
+	o, err := updateObjectMetadata(ctx, f.bucket, &f.src, key, value)
+	if err != nil {
+		return
+	}
+
+	// Adopt the new meta-generation, so that a subsequent sync does not mistake
+	// our own update for a concurrent modification.
+	var minObj gcs.MinObject
+	minObjPtr := storageutil.ConvertObjToMinObject(o)
+	if minObjPtr != nil {
+		minObj = *minObjPtr
+	}
+	f.src = minObj
+	return
+}
+
 // Sync writes out contents to GCS. If this fails due to the generation having been
 // clobbered, failure is propagated back to the calling function as an error.
 //
@@ -622,11 +883,37 @@ func (f *FileInode) SetMtime(
 //
 // LOCKS_REQUIRED(f.mu)
 func (f *FileInode) Sync(ctx context.Context) (err error) {
+	defer f.recordSyncErr(&err)
+
+	if err = f.settleWriteBack(ctx); err != nil {
+		return
+	}
+
+	if err = f.takeWriteBackErr(); err != nil {
+		return
+	}
+
+	if f.bwh != nil {
+		err = f.flushBufferedWrites(ctx)
+		return
+	}
+
 	// If we have not been dirtied, there is nothing to do.
 	if f.content == nil {
 		return
 	}
 
+	// Nor if the content was kept by a background sync and hasn't been modified
+	// since, even if the object has changed in the meantime.
+	clean, err := f.contentIsClean()
+	if err != nil || clean {
+		if clean {
+			f.content.Destroy()
+			f.content = nil
+		}
+		return
+	}
+
 	// When listObjects call is made, we fetch data with projection set as noAcl
 	// which means acls and owner properties are not returned. So the f.src object
 	// here will not have acl information even though there are acls present on
@@ -636,10 +923,34 @@ func (f *FileInode) Sync(ctx context.Context) (err error) {
 	// default sets the projection to full, which fetches all the object
 	// properties.
 	latestGcsObj, isClobbered, err := f.clobbered(ctx, true, true)
+	if err != nil {
+		return
+	}
 
+	var newObj *gcs.Object
+	var copied bool
 	if isClobbered {
-		err = &gcsfuse_errors.FileClobberedError{
-			Err: err,
+		newObj, copied, err = f.resolveConflict(ctx, latestGcsObj, fmt.Errorf("%q was changed by someone else", f.Name().GcsObjectName()))
+	} else {
+		// Write out the contents if they are dirty.
+		// Object properties are also synced as part of content sync. Hence, passing
+		// the latest object fetched from gcs which has all the properties populated.
+		// A local file gets the attributes set so far with its first generation.
+		if latestGcsObj == nil {
+			newObj, err = f.bucket.SyncNewObject(ctx, f.Name().GcsObjectName(), f.pendingPosixAttrs, f.content)
+		} else {
+			newObj, err = f.bucket.SyncObject(ctx, f.Name().GcsObjectName(), latestGcsObj, f.content)
+		}
+
+		// The object changed between the stat and the upload.
+		var preconditionErr *gcs.PreconditionError
+		if errors.As(err, &preconditionErr) {
+			cause := fmt.Errorf("SyncObject: %w", err)
+			if latestGcsObj, err = f.statForConflict(ctx, f.Name().GcsObjectName()); err == nil {
+				newObj, copied, err = f.resolveConflict(ctx, latestGcsObj, cause)
+			}
+		} else if err != nil {
+			err = fmt.Errorf("SyncObject: %w", err)
 		}
 	}
 
@@ -647,25 +958,74 @@ func (f *FileInode) Sync(ctx context.Context) (err error) {
 		return
 	}
 
-	// Write out the contents if they are dirty.
-	// Object properties are also synced as part of content sync. Hence, passing
-	// the latest object fetched from gcs which has all the properties populated.
-	newObj, err := f.bucket.SyncObject(ctx, f.Name().GcsObjectName(), latestGcsObj, f.content)
+	if copied {
+		f.rebaseAfterConflictCopy(newObj)
+		return
+	}
+
+	err = f.syncedTo(ctx, newObj, true)
+	return
+}
+
+// flushBufferedWrites finalizes the upload of the data streamed by the
+// buffered write handler. The write conflict policy applies as for temp files:
+// the handler writes over an object created by someone else in the meantime,
+// or uploads the data as a conflict copy, or the sync fails.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) flushBufferedWrites(ctx context.Context) (err error) {
+	// A checkpoint in progress composes the parts that Flush replaces.
+	if err = f.settleBackgroundUpload(ctx); err != nil {
+		return
+	}
+
+	// The handler can't be flushed again, whatever the outcome.
+	newObj, err := f.bwh.Flush()
+	f.bwh.Destroy()
+	f.bwh = nil
 
 	var preconditionErr *gcs.PreconditionError
 	if errors.As(err, &preconditionErr) {
 		err = &gcsfuse_errors.FileClobberedError{
-			Err: fmt.Errorf("SyncObject: %w", err),
+			Err: fmt.Errorf("BufferedWriteHandler.Flush: %w", err),
 		}
 		return
 	}
-
-	// Propagate other errors.
 	if err != nil {
-		err = fmt.Errorf("SyncObject: %w", err)
+		err = fmt.Errorf("BufferedWriteHandler.Flush: %w", err)
+		return
+	}
+	f.dirtySince = time.Time{}
+
+	name := f.Name().GcsObjectName()
+	if newObj.Name != name {
+		logger.Warnf("%q was changed by someone else since it was read, local changes were saved as %q", name, newObj.Name)
+		var latest *gcs.Object
+		if latest, err = f.statForConflict(ctx, name); err != nil {
+			return
+		}
+		f.rebaseAfterConflictCopy(latest)
 		return
 	}
 
+	err = f.syncedTo(ctx, newObj, true)
+	return
+}
+
+// syncedTo updates the state of the inode after its content has been written
+// out as newObj, which is nil if there was nothing to write. The content is
+// kept unless dropContent is set.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) syncedTo(
+	ctx context.Context,
+	newObj *gcs.Object,
+	dropContent bool) (err error) {
+	// Anything journaled before is superseded.
+	f.discardFailedWriteBack()
+	f.lastSynced = f.mtimeClock.Now()
+	f.lastSyncErr = nil
+
 	// If we wrote out a new object, we need to update our state.
 	if newObj != nil && !f.localFileCache {
 		var minObj gcs.MinObject
@@ -678,10 +1038,234 @@ func (f *FileInode) Sync(ctx context.Context) (err error) {
 		if f.IsLocal() {
 			f.local = false
 		}
-		f.content.Destroy()
-		f.content = nil
+		if dropContent && f.content != nil {
+			f.content.Destroy()
+			f.content = nil
+			f.dirtySince = time.Time{}
+		}
+	}
+
+	// Now that there is a backing object, persist any attribute changes made
+	// while the file was local. They are normally created with it, but not when
+	// made after its upload had started.
+	for k, v := range f.pendingPosixAttrs {
+		if f.src.Metadata[k] == v {
+			delete(f.pendingPosixAttrs, k)
+		}
+	}
+	if len(f.pendingPosixAttrs) > 0 && !f.IsLocal() {
+		patch := make(map[string]*string)
+		for k, v := range f.pendingPosixAttrs {
+			patch[k] = &v
+		}
+
+		if err = f.updatePosixAttributes(ctx, patch); err != nil {
+			return
+		}
+		f.pendingPosixAttrs = nil
+	}
+
+	return
+}
+
+// WriteBack is like Sync, except that it returns once the content has been
+// copied to the journal of the content cache, and has the uploader write it
+// out in the background, calling onDone once finished. The outcome is taken
+// into account by the next method that depends on it, and a failure is
+// returned by the next call to WriteBack or Sync.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) WriteBack(
+	ctx context.Context,
+	uploader *writeback.Uploader,
+	onDone func()) (err error) {
+	// Each write-back is derived from the generation written by the previous
+	// one, so they are done one at a time.
+	if err = f.settleWriteBack(ctx); err != nil {
+		return
+	}
+
+	if err = f.takeWriteBackErr(); err != nil {
+		return
+	}
+
+	if f.content == nil {
+		return
+	}
+
+	if f.localFileCache {
+		err = f.Sync(ctx)
+		return
+	}
+
+	// Skip content that has only been read, like the syncer would.
+	sr, err := f.content.Stat()
+	if err != nil {
+		err = fmt.Errorf("stat: %w", err)
+		return
+	}
+
+	srcSize := int64(f.src.Size)
+	if !f.IsLocal() && sr.Size == srcSize && sr.DirtyThreshold == srcSize {
+		return
+	}
+
+	cacheObjectKey := &contentcache.CacheObjectKey{BucketName: f.bucket.Name(), ObjectName: f.Name().GcsObjectName()}
+	entry, err := f.contentCache.AddToJournal(cacheObjectKey, f.src.Generation, f.src.MetaGeneration, f.pendingPosixAttrs, f.content)
+	if err != nil {
+		err = fmt.Errorf("AddToJournal: %w", err)
+		return
+	}
+
+	f.discardFailedWriteBack()
+	f.writeBack = uploader.Start(f.bucket, entry, onDone)
+	f.writeBackVersion = f.contentVersion
+	return
+}
+
+// SettleWriteBack waits for the write-back and the background sync in
+// progress, if any, and brings the inode up to date with their outcome. It
+// only fails if ctx is done first.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) SettleWriteBack(ctx context.Context) (err error) {
+	err = f.settleWriteBack(ctx)
+	return
+}
+
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) settleWriteBack(ctx context.Context) (err error) {
+	// A background sync writes to the same object.
+	if err = f.settleBackgroundUpload(ctx); err != nil {
+		return
+	}
+
+	if f.writeBack == nil {
+		return
+	}
+
+	select {
+	case <-f.writeBack.Done():
+	case <-ctx.Done():
+		err = ctx.Err()
+		return
+	}
+
+	u := f.writeBack
+	f.writeBack = nil
+	if f.destroyed {
+		return
+	}
+
+	newObj, uploadErr := u.Result()
+	if uploadErr != nil {
+		// A conflicting entry is kept for the user to sort out, anything else is
+		// retried on the next mount unless superseded.
+		if !errors.Is(uploadErr, writeback.ErrConflict) {
+			f.failedWriteBack = u.Entry()
+		}
+		f.writeBackErr = uploadErr
+		f.lastSyncErr = uploadErr
+		return
+	}
+
+	if syncErr := f.syncedTo(ctx, newObj, f.contentVersion == f.writeBackVersion); syncErr != nil {
+		f.writeBackErr = syncErr
+	}
+
+	return
+}
+
+// takeWriteBackErr returns and clears the error of the last write-back.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) takeWriteBackErr() (err error) {
+	if f.writeBackErr == nil {
+		return
+	}
+
+	err = fmt.Errorf("write-back: %w", f.writeBackErr)
+	if errors.Is(f.writeBackErr, writeback.ErrConflict) {
+		err = &gcsfuse_errors.FileClobberedError{Err: err}
+	}
+	f.writeBackErr = nil
+	return
+}
+
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) discardFailedWriteBack() {
+	if f.failedWriteBack != nil {
+		f.failedWriteBack.Destroy()
+		f.failedWriteBack = nil
+	}
+}
+
+// SetPosixAttributes persists mode, ownership and atime changes in the
+// metadata of the backing object, in the same way SetMtime persists mtimes.
+// Changes to local files are kept in memory until the file is synced.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) SetPosixAttributes(
+	ctx context.Context,
+	pa PosixAttributes) (err error) {
+	if pa.IsEmpty() {
+		return
+	}
+
+	if err = f.settleWriteBack(ctx); err != nil {
+		return
+	}
+
+	patch := pa.metadata()
+	if f.IsLocal() {
+		f.pendingPosixAttrs = pa.addTo(f.pendingPosixAttrs)
+		// The object being streamed gets them as it is created, unless it
+		// already is being uploaded.
+		if f.bwh != nil && !f.bwh.UploadStarted() {
+			err = f.bwh.SetObjectMetadata(f.pendingPosixAttrs)
+		}
+		return
 	}
 
+	err = f.updatePosixAttributes(ctx, patch)
+	return
+}
+
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) updatePosixAttributes(
+	ctx context.Context,
+	patch map[string]*string) (err error) {
+	srcGen := f.SourceGeneration()
+	req := &gcs.UpdateObjectRequest{
+		Name:                       f.src.Name,
+		Generation:                 srcGen.Object,
+		MetaGenerationPrecondition: &srcGen.Metadata,
+		Metadata:                   patch,
+	}
+
+	o, err := f.bucket.UpdateObject(ctx, req)
+	if err == nil {
+		var minObj gcs.MinObject
+		minObjPtr := storageutil.ConvertObjToMinObject(o)
+		if minObjPtr != nil {
+			minObj = *minObjPtr
+		}
+		f.src = minObj
+		return
+	}
+
+	// Unlike mtimes, explicit chmod and chown requests are not dropped silently
+	// when the object has changed underneath us.
+	var notFoundErr *gcs.NotFoundError
+	var preconditionErr *gcs.PreconditionError
+	if errors.As(err, &notFoundErr) || errors.As(err, &preconditionErr) {
+		err = &gcsfuse_errors.FileClobberedError{
+			Err: fmt.Errorf("UpdateObject: %w", err),
+		}
+		return
+	}
+
+	err = fmt.Errorf("UpdateObject: %w", err)
 	return
 }
 
@@ -700,6 +1284,8 @@ func (f *FileInode) Truncate(
 
 	// Call through.
 	err = f.content.Truncate(size)
+	f.contentVersion++
+	f.markDirty()
 
 	return
 }
@@ -731,14 +1317,102 @@ func (f *FileInode) CreateBufferedOrTempWriter() (err error) {
 	return
 }
 
+// fallBackToTempFile stages the data streamed by the buffered write handler as
+// a temporary object and loads it into a temp file, so that the data uploaded
+// so far is kept and later writes can land anywhere. Nothing is published
+// under the name of the file until the next sync, which also deals with the
+// object having been created by someone else in the meantime.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) fallBackToTempFile(ctx context.Context) (err error) {
+	// A checkpoint in progress composes the parts that Stage deletes.
+	if err = f.settleBackgroundUpload(ctx); err != nil {
+		return
+	}
+
+	mtime := f.bwh.WriteFileInfo().Mtime
+	staged, err := f.bwh.Stage()
+	if err != nil {
+		return
+	}
+	f.bwh = nil
+	defer f.deleteStagedObject(staged.Name)
+
+	rc, err := f.bucket.NewReader(ctx, &gcs.ReadObjectRequest{
+		Name:       staged.Name,
+		Generation: staged.Generation,
+	})
+	if err != nil {
+		err = fmt.Errorf("NewReader: %w", err)
+		return
+	}
+	defer rc.Close()
+
+	// The content starts out as the source object, which is empty, so that all
+	// of the staged data counts as dirty.
+	content, err := f.contentCache.NewTempFile(io.NopCloser(strings.NewReader("")))
+	if err != nil {
+		err = fmt.Errorf("NewTempFile: %w", err)
+		return
+	}
+
+	if _, err = io.Copy(io.NewOffsetWriter(content, 0), rc); err != nil {
+		content.Destroy()
+		err = fmt.Errorf("copying staged data: %w", err)
+		return
+	}
+
+	content.SetMtime(mtime)
+	f.content = content
+	return
+}
+
+// deleteStagedObject makes an effort to delete the named temporary object. If
+// it can't be deleted it is left to garbage collection.
+func (f *FileInode) deleteStagedObject(name string) {
+	err := f.bucket.DeleteObject(context.Background(), &gcs.DeleteObjectRequest{Name: name})
+	if err != nil {
+		logger.Warnf("Failed to delete staged object %s: %v", name, err)
+	}
+}
+
 func (f *FileInode) ensureBufferedWriteHandler() error {
 	var err error
 	if f.bwh == nil {
-		f.bwh, err = bufferedwrites.NewBWHandler(f.name.GcsObjectName(), f.bucket, f.writeConfig.BlockSizeMb, f.writeConfig.MaxBlocksPerFile, f.globalMaxBlocksSem)
+		// The data is staged as temporary objects, so that it can be taken back
+		// if the writes have to fall back to a temp file.
+		req := &bufferedwrites.CreateBWHandlerRequest{
+			ObjectName:               f.Name().GcsObjectName(),
+			SrcGeneration:            f.src.Generation,
+			Bucket:                   f.bucket,
+			BlockSize:                f.writeConfig.BlockSizeMb,
+			MaxBlocksPerFile:         f.writeConfig.MaxBlocksPerFile,
+			ReorderWindowBlocks:      f.writeConfig.ReorderWindowBlocks,
+			TmpObjectPrefix:          f.bucket.TmpObjectPrefix(),
+			ParallelCompositeUploads: f.writeConfig.ExperimentalParallelCompositeUploads,
+			SpillToDisk:              f.writeConfig.ExperimentalSpillToDisk,
+			SpillDir:                 f.contentCache.TempDir(),
+			GlobalMaxBlocksSem:       f.globalMaxBlocksSem,
+			ObjectDefaults:           f.writeConfig.ObjectDefaults,
+			ChunkTransferTimeoutSecs: f.bucket.ChunkTransferTimeoutSecs(),
+		}
+		switch f.writeConfig.ExperimentalConflictPolicy {
+		case cfg.WriteConflictPolicyLastWriterWins:
+			req.Overwrite = true
+		case cfg.WriteConflictPolicyConflictCopy:
+			generation := f.src.Generation
+			req.ConflictCopyName = func(objectName string) string {
+				return conflictCopyName(objectName, generation)
+			}
+		}
+		f.bwh, err = bufferedwrites.NewBWHandler(req)
 		if err != nil {
 			return fmt.Errorf("failed to create bufferedWriteHandler: %w", err)
 		}
 		f.bwh.SetMtime(f.mtimeClock.Now())
+		if err = f.bwh.SetObjectMetadata(f.pendingPosixAttrs); err != nil {
+			return fmt.Errorf("SetObjectMetadata: %w", err)
+		}
 	}
 
 	return nil
@@ -22,10 +22,12 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/gcsfuse_errors"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
@@ -126,7 +128,9 @@ func (t *FileTest) createInodeWithLocalParam(fileName string, local bool) {
 		1, // Append threshold
 		ChunkTransferTimeoutSecs,
 		".gcsfuse_tmp/",
-		t.bucket)
+		nil,
+		t.bucket,
+		common.NewNoopMetrics())
 
 	if local {
 		t.backingObj = nil
@@ -146,7 +150,8 @@ func (t *FileTest) createInodeWithLocalParam(fileName string, local bool) {
 		&t.clock,
 		local,
 		&cfg.WriteConfig{},
-		semaphore.NewWeighted(math.MaxInt64))
+		semaphore.NewWeighted(math.MaxInt64),
+		false)
 
 	t.in.Lock()
 }
@@ -679,6 +684,28 @@ func (t *FileTest) TestTestTruncateDownwardForLocalFileShouldUpdateLocalFileAttr
 	assert.Equal(t.T(), "gcs.NotFoundError: object test not found", err.Error())
 }
 
+func (t *FileTest) TestSync_UnchangedContent() {
+	// Rewrite the file with the same bytes, as editors saving it do.
+	err := t.in.Truncate(t.ctx, 0)
+	assert.Nil(t.T(), err)
+	t.clock.AdvanceTime(time.Second)
+	writeTime := t.clock.Now()
+	err = t.in.Write(t.ctx, []byte(t.initialContents), 0)
+	assert.Nil(t.T(), err)
+
+	err = t.in.Sync(t.ctx)
+
+	assert.Nil(t.T(), err)
+	// Only the metadata of the object is updated.
+	assert.Equal(t.T(), t.backingObj.Generation, t.in.SourceGeneration().Object)
+	assert.Greater(t.T(), t.in.SourceGeneration().Metadata, t.backingObj.MetaGeneration)
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: t.in.Name().GcsObjectName()})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), t.backingObj.Generation, m.Generation)
+	assert.Equal(t.T(), writeTime.UTC().Format(time.RFC3339Nano), m.Metadata[FileMtimeMetadataKey])
+	assert.Nil(t.T(), t.in.content)
+}
+
 func (t *FileTest) TestSync_Clobbered() {
 	var err error
 
@@ -714,6 +741,78 @@ func (t *FileTest) TestSync_Clobbered() {
 	assert.Equal(t.T(), newObj.Size, m.Size)
 }
 
+func (t *FileTest) TestSync_ClobberedWithLastWriterWins() {
+	t.in.writeConfig.ExperimentalConflictPolicy = cfg.WriteConflictPolicyLastWriterWins
+	err := t.in.Write(t.ctx, []byte("p"), 0)
+	assert.Nil(t.T(), err)
+	newObj, err := storageutil.CreateObject(t.ctx, t.bucket, t.in.Name().GcsObjectName(), []byte("burrito"))
+	assert.Nil(t.T(), err)
+
+	err = t.in.Sync(t.ctx)
+
+	assert.Nil(t.T(), err)
+	// The object is overwritten with the local content.
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, t.in.Name().GcsObjectName())
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "paco", string(contents))
+	assert.Greater(t.T(), t.in.SourceGeneration().Object, newObj.Generation)
+	assert.Nil(t.T(), t.in.content)
+}
+
+func (t *FileTest) TestSync_ClobberedWithConflictCopy() {
+	t.in.writeConfig.ExperimentalConflictPolicy = cfg.WriteConflictPolicyConflictCopy
+	err := t.in.Write(t.ctx, []byte("p"), 0)
+	assert.Nil(t.T(), err)
+	newObj, err := storageutil.CreateObject(t.ctx, t.bucket, t.in.Name().GcsObjectName(), []byte("burrito"))
+	assert.Nil(t.T(), err)
+
+	err = t.in.Sync(t.ctx)
+
+	assert.Nil(t.T(), err)
+	// The local content is saved next to the object, which is left alone.
+	copyName := conflictCopyName(t.in.Name().GcsObjectName(), t.backingObj.Generation)
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, copyName)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "paco", string(contents))
+	contents, err = storageutil.ReadObject(t.ctx, t.bucket, t.in.Name().GcsObjectName())
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "burrito", string(contents))
+	// The inode carries on from the object.
+	assert.Equal(t.T(), newObj.Generation, t.in.SourceGeneration().Object)
+	assert.Nil(t.T(), t.in.content)
+	attrs, err := t.in.Attributes(t.ctx)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), uint64(len("burrito")), attrs.Size)
+	assert.Equal(t.T(), uint32(1), attrs.Nlink)
+}
+
+func (t *FileTest) TestSync_LocalFileCreatedMeanwhileWithConflictCopy() {
+	t.createInodeWithLocalParam("test", true)
+	t.in.writeConfig.ExperimentalConflictPolicy = cfg.WriteConflictPolicyConflictCopy
+	err := t.in.CreateBufferedOrTempWriter()
+	assert.Nil(t.T(), err)
+	err = t.in.Write(t.ctx, []byte("tacos"), 0)
+	assert.Nil(t.T(), err)
+	newObj, err := storageutil.CreateObject(t.ctx, t.bucket, "test", []byte("burrito"))
+	assert.Nil(t.T(), err)
+
+	err = t.in.Sync(t.ctx)
+
+	assert.Nil(t.T(), err)
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, conflictCopyName("test", 0))
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "tacos", string(contents))
+	assert.False(t.T(), t.in.IsLocal())
+	assert.Equal(t.T(), newObj.Generation, t.in.SourceGeneration().Object)
+}
+
+func (t *FileTest) TestConflictCopyName() {
+	name := conflictCopyName("foo/bar", 17)
+
+	assert.True(t.T(), strings.HasPrefix(name, "foo/bar.conflict-"))
+	assert.True(t.T(), strings.HasSuffix(name, "-17"))
+}
+
 func (t *FileTest) TestOpenReader_ThrowsFileClobberedError() {
 	// Modify the file locally.
 	err := t.in.Truncate(t.ctx, 2)
@@ -1031,6 +1130,49 @@ func (t *FileTest) TestUnlinkLocalFile() {
 	assert.Equal(t.T(), "gcs.NotFoundError: object test not found", err.Error())
 }
 
+func (t *FileTest) TestRenameLocalFileThenSync() {
+	var err error
+	// Create a local file inode and write some content to it.
+	t.createInodeWithLocalParam("test", true)
+	err = t.in.CreateBufferedOrTempWriter()
+	assert.Nil(t.T(), err)
+	err = t.in.Write(t.ctx, []byte("tacos"), 0)
+	assert.Nil(t.T(), err)
+	newName := NewFileName(NewDirName(NewRootName(""), "dir"), "renamed")
+
+	err = t.in.Rename(newName)
+
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), newName, t.in.Name())
+	// Sync creates the object under the new name only.
+	err = t.in.Sync(t.ctx)
+	assert.Nil(t.T(), err)
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, "dir/renamed")
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "tacos", string(contents))
+	_, _, err = t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "test"})
+	assert.Equal(t.T(), "gcs.NotFoundError: object test not found", err.Error())
+}
+
+func (t *FileTest) TestRenameSyncedFileFails() {
+	oldName := t.in.Name()
+
+	err := t.in.Rename(NewFileName(NewRootName(""), "renamed"))
+
+	assert.ErrorIs(t.T(), err, syscall.ENOTSUP)
+	assert.False(t.T(), t.in.IsRenamable())
+	assert.Equal(t.T(), oldName, t.in.Name())
+}
+
+func (t *FileTest) TestRenameUnlinkedLocalFileFails() {
+	t.createInodeWithLocalParam("test", true)
+	t.in.Unlink()
+
+	err := t.in.Rename(NewFileName(NewRootName(""), "renamed"))
+
+	assert.ErrorIs(t.T(), err, syscall.ENOTSUP)
+}
+
 func (t *FileTest) TestReadFileWhenStreamingWritesAreEnabled() {
 	tbl := []struct {
 		name         string
@@ -1145,6 +1287,34 @@ func (t *FileTest) TestMultipleWritesToLocalFileWhenStreamingWritesAreEnabled()
 	assert.WithinDuration(t.T(), attrs.Mtime, createTime, Delta)
 }
 
+func (t *FileTest) TestOutOfOrderWriteToLocalFileFallsBackToTempFile() {
+	t.createInodeWithLocalParam("test", true)
+	t.in.writeConfig = getWriteConfig()
+	t.in.writeConfig.ReorderWindowBlocks = 1
+	assert.Nil(t.T(), t.in.Write(t.ctx, []byte("hi"), 0))
+	// Held within the reorder window.
+	assert.Nil(t.T(), t.in.Write(t.ctx, []byte("taco"), 4))
+	assert.NotNil(t.T(), t.in.bwh)
+
+	err := t.in.Write(t.ctx, []byte("burrito"), 100)
+
+	assert.Nil(t.T(), err)
+	assert.Nil(t.T(), t.in.bwh)
+	// Nothing has been published, and the staged data is gone.
+	assert.True(t.T(), t.in.IsLocal())
+	_, err = storageutil.ReadObject(t.ctx, t.bucket, "test")
+	var notFoundErr *gcs.NotFoundError
+	assert.True(t.T(), errors.As(err, &notFoundErr))
+	listing, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{Prefix: t.in.bucket.TmpObjectPrefix()})
+	assert.Nil(t.T(), err)
+	assert.Empty(t.T(), listing.MinObjects)
+	// All of it goes out on the next sync.
+	assert.Nil(t.T(), t.in.Sync(t.ctx))
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, "test")
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "hi\x00\x00taco"+string(make([]byte, 92))+"burrito", string(contents))
+}
+
 func (t *FileTest) WriteToEmptyGCSFileWhenStreamingWritesAreEnabled() {
 	t.createInodeWithEmptyObject()
 	t.in.writeConfig = getWriteConfig()
@@ -1200,6 +1370,306 @@ func (t *FileTest) SetMtimeOnEmptyGCSFileAfterWritesWhenStreamingWritesAreEnable
 	assert.Equal(t.T(), attrs.Atime, mtime)
 }
 
+// backgroundSync runs a background sync to completion, returning the error of
+// the upload if it fails.
+func (t *FileTest) backgroundSync() (err error) {
+	u, err := t.in.BackgroundSync(t.ctx)
+	if err != nil || u == nil {
+		return
+	}
+
+	<-u.Done()
+	if err = t.in.SettleWriteBack(t.ctx); err != nil {
+		return
+	}
+
+	err = u.Err()
+	return
+}
+
+func (t *FileTest) TestSyncStatus_Clean() {
+	status := t.in.SyncStatus()
+
+	assert.True(t.T(), status.DirtySince.IsZero())
+	assert.Equal(t.T(), int64(0), status.DirtyBytes)
+	assert.True(t.T(), status.LastSynced.IsZero())
+	assert.Nil(t.T(), status.LastErr)
+}
+
+func (t *FileTest) TestSyncStatus_Dirty() {
+	t.clock.AdvanceTime(time.Second)
+	writeTime := t.clock.Now()
+	err := t.in.Write(t.ctx, []byte("p"), 0)
+	assert.Nil(t.T(), err)
+	t.clock.AdvanceTime(time.Second)
+	err = t.in.Write(t.ctx, []byte("s"), 4)
+	assert.Nil(t.T(), err)
+
+	status := t.in.SyncStatus()
+
+	assert.Equal(t.T(), writeTime, status.DirtySince)
+	assert.Equal(t.T(), int64(2), status.DirtyBytes)
+}
+
+func (t *FileTest) TestBackgroundSync_KeepsContent() {
+	err := t.in.Write(t.ctx, []byte("p"), 0)
+	assert.Nil(t.T(), err)
+	t.clock.AdvanceTime(time.Second)
+	syncTime := t.clock.Now()
+
+	err = t.backgroundSync()
+
+	assert.Nil(t.T(), err)
+	assert.Less(t.T(), t.backingObj.Generation, t.in.SourceGeneration().Object)
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, t.in.Name().GcsObjectName())
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "paco", string(contents))
+	// The content is still there, and clean.
+	assert.NotNil(t.T(), t.in.content)
+	status := t.in.SyncStatus()
+	assert.True(t.T(), status.DirtySince.IsZero())
+	assert.Equal(t.T(), syncTime, status.LastSynced)
+	assert.Nil(t.T(), status.LastErr)
+
+	// Later writes build on the new generation.
+	err = t.in.Write(t.ctx, []byte("ca"), 2)
+	assert.Nil(t.T(), err)
+	err = t.in.Sync(t.ctx)
+	assert.Nil(t.T(), err)
+	contents, err = storageutil.ReadObject(t.ctx, t.bucket, t.in.Name().GcsObjectName())
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "paca", string(contents))
+}
+
+func (t *FileTest) TestSyncAfterBackgroundSync() {
+	err := t.in.Write(t.ctx, []byte("p"), 0)
+	assert.Nil(t.T(), err)
+	err = t.backgroundSync()
+	assert.Nil(t.T(), err)
+	syncedGeneration := t.in.SourceGeneration().Object
+	// Someone else changes the object after that.
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, t.in.Name().GcsObjectName(), []byte("burrito"))
+	assert.Nil(t.T(), err)
+
+	err = t.in.Sync(t.ctx)
+
+	// There is nothing left to write, so that is not a conflict.
+	assert.Nil(t.T(), err)
+	assert.Nil(t.T(), t.in.content)
+	assert.Equal(t.T(), syncedGeneration, t.in.SourceGeneration().Object)
+}
+
+func (t *FileTest) TestBackgroundSync_Clean() {
+	err := t.backgroundSync()
+
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), t.backingObj.Generation, t.in.SourceGeneration().Object)
+	assert.True(t.T(), t.in.SyncStatus().LastSynced.IsZero())
+}
+
+func (t *FileTest) TestBackgroundSync_LocalFile() {
+	t.createInodeWithLocalParam("test", true)
+	err := t.in.CreateBufferedOrTempWriter()
+	assert.Nil(t.T(), err)
+	err = t.in.Write(t.ctx, []byte("taco"), 0)
+	assert.Nil(t.T(), err)
+
+	err = t.backgroundSync()
+
+	assert.Nil(t.T(), err)
+	assert.False(t.T(), t.in.IsLocal())
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, "test")
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "taco", string(contents))
+}
+
+func (t *FileTest) TestBackgroundSync_Clobbered() {
+	err := t.in.Write(t.ctx, []byte("p"), 0)
+	assert.Nil(t.T(), err)
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, t.in.Name().GcsObjectName(), []byte("burrito"))
+	assert.Nil(t.T(), err)
+
+	err = t.backgroundSync()
+
+	var fcErr *gcsfuse_errors.FileClobberedError
+	assert.True(t.T(), errors.As(err, &fcErr), "expected FileClobberedError but got %v", err)
+	status := t.in.SyncStatus()
+	assert.False(t.T(), status.DirtySince.IsZero())
+	assert.Equal(t.T(), err, status.LastErr)
+}
+
+func (t *FileTest) TestBackgroundSync_DoesNotHoldLock() {
+	err := t.in.Write(t.ctx, []byte("p"), 0)
+	assert.Nil(t.T(), err)
+
+	u, err := t.in.BackgroundSync(t.ctx)
+	assert.Nil(t.T(), err)
+	assert.NotNil(t.T(), u)
+	// The content can be modified while the snapshot is uploaded.
+	err = t.in.Write(t.ctx, []byte("s"), 4)
+	assert.Nil(t.T(), err)
+	<-u.Done()
+	err = t.in.SettleWriteBack(t.ctx)
+	assert.Nil(t.T(), err)
+
+	assert.Nil(t.T(), u.Err())
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, t.in.Name().GcsObjectName())
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "paco", string(contents))
+	// The later write is yet to be synced.
+	status := t.in.SyncStatus()
+	assert.False(t.T(), status.DirtySince.IsZero())
+	err = t.in.Sync(t.ctx)
+	assert.Nil(t.T(), err)
+	contents, err = storageutil.ReadObject(t.ctx, t.bucket, t.in.Name().GcsObjectName())
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "pacos", string(contents))
+}
+
+func (t *FileTest) TestBackgroundSync_LocalFileUnlinkedDuringUpload() {
+	t.createInodeWithLocalParam("test", true)
+	err := t.in.CreateBufferedOrTempWriter()
+	assert.Nil(t.T(), err)
+	err = t.in.Write(t.ctx, []byte("taco"), 0)
+	assert.Nil(t.T(), err)
+	u, err := t.in.BackgroundSync(t.ctx)
+	assert.Nil(t.T(), err)
+
+	t.in.Unlink()
+	<-u.Done()
+	err = t.in.SettleWriteBack(t.ctx)
+
+	assert.Nil(t.T(), err)
+	_, err = storageutil.ReadObject(t.ctx, t.bucket, "test")
+	var notFoundErr *gcs.NotFoundError
+	assert.True(t.T(), errors.As(err, &notFoundErr))
+}
+
+func (t *FileTest) TestBackgroundSync_StreamingWrites() {
+	t.createInodeWithLocalParam("test", true)
+	t.in.writeConfig = getWriteConfig()
+	err := t.in.Write(t.ctx, []byte("hi"), 0)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), int64(2), t.in.SyncStatus().DirtyBytes)
+
+	err = t.backgroundSync()
+
+	// The data of a resumable upload isn't in an object until it is finalized.
+	assert.Nil(t.T(), err)
+	assert.NotNil(t.T(), t.in.bwh)
+	status := t.in.SyncStatus()
+	assert.False(t.T(), status.DirtySince.IsZero())
+	assert.True(t.T(), status.LastSynced.IsZero())
+	assert.Equal(t.T(), int64(2), status.DirtyBytes)
+}
+
+func (t *FileTest) TestBackgroundSync_StreamingWritesCheckpoint() {
+	t.createInodeWithLocalParam("test", true)
+	t.in.writeConfig = getWriteConfig()
+	t.in.writeConfig.ExperimentalParallelCompositeUploads = true
+	err := t.in.Write(t.ctx, []byte("tacoburrito!"), 0)
+	assert.Nil(t.T(), err)
+	err = t.in.bwh.Sync()
+	assert.Nil(t.T(), err)
+
+	err = t.backgroundSync()
+
+	// The full block is in the object, the rest is yet to be synced.
+	assert.Nil(t.T(), err)
+	assert.NotNil(t.T(), t.in.bwh)
+	assert.False(t.T(), t.in.IsLocal())
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, "test")
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "tacoburrit", string(contents))
+	status := t.in.SyncStatus()
+	assert.False(t.T(), status.DirtySince.IsZero())
+	assert.False(t.T(), status.LastSynced.IsZero())
+	assert.Equal(t.T(), int64(2), status.DirtyBytes)
+}
+
+func (t *FileTest) TestSync_StreamingWrites() {
+	t.createInodeWithLocalParam("test", true)
+	t.in.writeConfig = getWriteConfig()
+	err := t.in.Write(t.ctx, []byte("tacos"), 0)
+	assert.Nil(t.T(), err)
+
+	err = t.in.Sync(t.ctx)
+
+	assert.Nil(t.T(), err)
+	assert.Nil(t.T(), t.in.bwh)
+	assert.False(t.T(), t.in.IsLocal())
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, "test")
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "tacos", string(contents))
+	attrs, err := t.in.Attributes(t.ctx)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), uint64(len("tacos")), attrs.Size)
+	assert.True(t.T(), t.in.SyncStatus().DirtySince.IsZero())
+}
+
+func (t *FileTest) TestSync_StreamingWritesClobbered() {
+	t.createInodeWithLocalParam("test", true)
+	t.in.writeConfig = getWriteConfig()
+	err := t.in.Write(t.ctx, []byte("tacos"), 0)
+	assert.Nil(t.T(), err)
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, "test", []byte("burrito"))
+	assert.Nil(t.T(), err)
+
+	err = t.in.Sync(t.ctx)
+
+	var clobberedErr *gcsfuse_errors.FileClobberedError
+	assert.True(t.T(), errors.As(err, &clobberedErr))
+	assert.Nil(t.T(), t.in.bwh)
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, "test")
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "burrito", string(contents))
+}
+
+func (t *FileTest) TestSync_StreamingWritesClobberedWithLastWriterWins() {
+	t.createInodeWithLocalParam("test", true)
+	t.in.writeConfig = getWriteConfig()
+	t.in.writeConfig.ExperimentalConflictPolicy = cfg.WriteConflictPolicyLastWriterWins
+	err := t.in.Write(t.ctx, []byte("tacos"), 0)
+	assert.Nil(t.T(), err)
+	newObj, err := storageutil.CreateObject(t.ctx, t.bucket, "test", []byte("burrito"))
+	assert.Nil(t.T(), err)
+
+	err = t.in.Sync(t.ctx)
+
+	assert.Nil(t.T(), err)
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, "test")
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "tacos", string(contents))
+	assert.Greater(t.T(), t.in.SourceGeneration().Object, newObj.Generation)
+}
+
+func (t *FileTest) TestSync_StreamingWritesClobberedWithConflictCopy() {
+	t.createInodeWithLocalParam("test", true)
+	t.in.writeConfig = getWriteConfig()
+	t.in.writeConfig.ExperimentalConflictPolicy = cfg.WriteConflictPolicyConflictCopy
+	err := t.in.Write(t.ctx, []byte("tacos"), 0)
+	assert.Nil(t.T(), err)
+	newObj, err := storageutil.CreateObject(t.ctx, t.bucket, "test", []byte("burrito"))
+	assert.Nil(t.T(), err)
+
+	err = t.in.Sync(t.ctx)
+
+	assert.Nil(t.T(), err)
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, conflictCopyName("test", 0))
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "tacos", string(contents))
+	contents, err = storageutil.ReadObject(t.ctx, t.bucket, "test")
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "burrito", string(contents))
+	// The inode carries on from the object.
+	assert.Nil(t.T(), t.in.bwh)
+	assert.False(t.T(), t.in.IsLocal())
+	assert.Equal(t.T(), newObj.Generation, t.in.SourceGeneration().Object)
+	attrs, err := t.in.Attributes(t.ctx)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), uint64(len("burrito")), attrs.Size)
+}
+
 func getWriteConfig() *cfg.WriteConfig {
 	return &cfg.WriteConfig{
 		MaxBlocksPerFile:                  10,
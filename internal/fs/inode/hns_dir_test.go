@@ -22,6 +22,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	storagemock "github.com/googlecloudplatform/gcsfuse/v2/internal/storage/mock"
@@ -56,7 +57,9 @@ func (t *HNSDirTest) SetupTest() {
 		1,
 		ChunkTransferTimeoutSecs,
 		".gcsfuse_tmp/",
-		t.mockBucket)
+		nil,
+		t.mockBucket,
+		common.NewNoopMetrics())
 	t.resetDirInode(false, false, true)
 }
 
@@ -438,7 +441,7 @@ func (t *HNSDirTest) TestCreateChildDirWhenBucketTypeIsHNSWithFailure() {
 	t.mockBucket.On("BucketType").Return(gcs.Hierarchical)
 	t.mockBucket.On("CreateFolder", t.ctx, dirName).Return(nil, fmt.Errorf("mock error"))
 
-	result, err := t.in.CreateChildDir(t.ctx, name)
+	result, err := t.in.CreateChildDir(t.ctx, name, PosixAttributes{})
 
 	t.mockBucket.AssertExpectations(t.T())
 	assert.NotNil(t.T(), err)
@@ -453,7 +456,7 @@ func (t *HNSDirTest) TestCreateChildDirWhenBucketTypeIsHNSWithSuccess() {
 	t.mockBucket.On("BucketType").Return(gcs.Hierarchical)
 	t.mockBucket.On("CreateFolder", t.ctx, dirName).Return(&folder, nil)
 
-	result, err := t.in.CreateChildDir(t.ctx, name)
+	result, err := t.in.CreateChildDir(t.ctx, name, PosixAttributes{})
 
 	t.mockBucket.AssertExpectations(t.T())
 	assert.NoError(t.T(), err)
@@ -471,7 +474,7 @@ func (t *HNSDirTest) TestCreateChildDirWhenBucketTypeIsNonHNSWithFailure() {
 	t.mockBucket.On("BucketType").Return(gcs.NonHierarchical)
 	t.mockBucket.On("CreateObject", t.ctx, &createObjectReq).Return(nil, fmt.Errorf("mock error"))
 
-	result, err := t.in.CreateChildDir(t.ctx, name)
+	result, err := t.in.CreateChildDir(t.ctx, name, PosixAttributes{})
 
 	t.mockBucket.AssertExpectations(t.T())
 	assert.NotNil(t.T(), err)
@@ -488,7 +491,7 @@ func (t *HNSDirTest) TestCreateChildDirWhenBucketTypeIsNonHNSWithSuccess() {
 	t.mockBucket.On("BucketType").Return(gcs.NonHierarchical)
 	t.mockBucket.On("CreateObject", t.ctx, &createObjectReq).Return(&object, nil)
 
-	result, err := t.in.CreateChildDir(t.ctx, name)
+	result, err := t.in.CreateChildDir(t.ctx, name, PosixAttributes{})
 
 	t.mockBucket.AssertExpectations(t.T())
 	assert.NoError(t.T(), err)
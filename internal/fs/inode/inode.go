@@ -73,6 +73,42 @@ type GenerationBackedInode interface {
 	SourceGeneration() Generation
 }
 
+// An inode that exposes the metadata of its backing object or folder as
+// extended attributes. See xattr.go for the supported namespaces.
+type XattrInode interface {
+	Inode
+
+	// Return the current extended attributes, keyed by name. The backing object
+	// is always stat'ed in GCS, bypassing the stat cache.
+	//
+	// Requires the inode lock.
+	Xattrs(ctx context.Context) (map[string][]byte, error)
+
+	// Set the value of an extended attribute in the user namespace. Flags have
+	// the semantics of setxattr(2).
+	//
+	// Requires the inode lock.
+	SetXattr(ctx context.Context, name string, value []byte, flags uint32) error
+
+	// Remove an extended attribute in the user namespace.
+	//
+	// Requires the inode lock.
+	RemoveXattr(ctx context.Context, name string) error
+}
+
+// An inode whose mode, ownership and atime can be persisted in the metadata of
+// its backing object.
+type PosixAttributesInode interface {
+	Inode
+
+	// Persist the requested attribute changes using a metadata-only update of
+	// the backing object. Inodes without a backing object keep the changes in
+	// memory, or ignore them if they never will have one.
+	//
+	// Requires the inode lock.
+	SetPosixAttributes(ctx context.Context, pa PosixAttributes) error
+}
+
 // A particular generation of a GCS object, consisting of both a GCS object
 // generation number and meta-generation number. Lexicographically ordered on
 // the two.
@@ -104,6 +104,15 @@ func (name Name) String() string {
 	return name.LocalName()
 }
 
+// IsDescendantOf returns true if the name is anywhere below another directory.
+func (name Name) IsDescendantOf(ancestor Name) bool {
+	if !ancestor.IsDir() || name.bucketName != ancestor.bucketName {
+		return false
+	}
+	return len(name.objectName) > len(ancestor.objectName) &&
+		strings.HasPrefix(name.objectName, ancestor.objectName)
+}
+
 // IsDirectChildOf returns true if the name is a direct child file or directory
 // of another directory.
 func (name Name) IsDirectChildOf(parent Name) bool {
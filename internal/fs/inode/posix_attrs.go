@@ -0,0 +1,165 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// GCS object metadata keys under which POSIX attributes are persisted when
+// file-system.experimental-persist-posix-attributes is set. They live next to
+// FileMtimeMetadataKey and use the same conventions: the mode is stored as
+// octal permission bits, ids in decimal and atime in time.RFC3339Nano (UTC).
+const (
+	ModeMetadataKey  = "gcsfuse_mode"
+	UidMetadataKey   = "gcsfuse_uid"
+	GidMetadataKey   = "gcsfuse_gid"
+	AtimeMetadataKey = "gcsfuse_atime"
+)
+
+// The mode bits that are persisted. File type bits always come from the inode
+// itself.
+const persistedModeMask = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// PosixAttributes is a set of attribute changes requested by setattr(2) or at
+// file creation. Nil fields are left unchanged.
+type PosixAttributes struct {
+	Mode  *os.FileMode
+	Uid   *uint32
+	Gid   *uint32
+	Atime *time.Time
+}
+
+// IsEmpty reports whether no attribute is to be changed.
+func (pa PosixAttributes) IsEmpty() bool {
+	return pa.Mode == nil && pa.Uid == nil && pa.Gid == nil && pa.Atime == nil
+}
+
+// Return the metadata patch that persists the requested changes.
+func (pa PosixAttributes) metadata() map[string]*string {
+	m := make(map[string]*string)
+	set := func(key string, value string) {
+		m[key] = &value
+	}
+
+	if pa.Mode != nil {
+		set(ModeMetadataKey, formatMode(*pa.Mode))
+	}
+
+	if pa.Uid != nil {
+		set(UidMetadataKey, strconv.FormatUint(uint64(*pa.Uid), 10))
+	}
+
+	if pa.Gid != nil {
+		set(GidMetadataKey, strconv.FormatUint(uint64(*pa.Gid), 10))
+	}
+
+	if pa.Atime != nil {
+		set(AtimeMetadataKey, pa.Atime.UTC().Format(time.RFC3339Nano))
+	}
+
+	return m
+}
+
+// Add the requested attributes to the custom metadata of an object about to be
+// created, allocating it if need be.
+func (pa PosixAttributes) addTo(metadata map[string]string) map[string]string {
+	if pa.IsEmpty() {
+		return metadata
+	}
+
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	for k, v := range pa.metadata() {
+		metadata[k] = *v
+	}
+
+	return metadata
+}
+
+// Format the persisted bits of the mode using the octal notation of chmod(1),
+// e.g. "4755" for a setuid executable.
+func formatMode(mode os.FileMode) string {
+	bits := uint64(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+
+	return strconv.FormatUint(bits, 8)
+}
+
+func parseMode(s string) (mode os.FileMode, err error) {
+	bits, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return
+	}
+
+	mode = os.FileMode(bits).Perm()
+	if bits&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if bits&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if bits&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+
+	return
+}
+
+// ApplyPosixAttributes overrides the given attributes with the values persisted
+// in the supplied object metadata. Malformed values are ignored, so that a
+// stray metadata entry can never make an inode unreadable.
+func ApplyPosixAttributes(
+	attrs fuseops.InodeAttributes,
+	metadata map[string]string) fuseops.InodeAttributes {
+	if s, ok := metadata[ModeMetadataKey]; ok {
+		if mode, err := parseMode(s); err == nil {
+			attrs.Mode = attrs.Mode&^persistedModeMask | mode
+		}
+	}
+
+	if s, ok := metadata[UidMetadataKey]; ok {
+		if uid, err := strconv.ParseUint(s, 10, 32); err == nil {
+			attrs.Uid = uint32(uid)
+		}
+	}
+
+	if s, ok := metadata[GidMetadataKey]; ok {
+		if gid, err := strconv.ParseUint(s, 10, 32); err == nil {
+			attrs.Gid = uint32(gid)
+		}
+	}
+
+	if s, ok := metadata[AtimeMetadataKey]; ok {
+		if atime, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			attrs.Atime = atime
+		}
+	}
+
+	return attrs
+}
@@ -0,0 +1,246 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/gcsfuse_errors"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestApplyPosixAttributes(t *testing.T) {
+	atime := time.Date(2024, 11, 5, 10, 0, 0, 0, time.UTC)
+	attrs := fuseops.InodeAttributes{Uid: uid, Gid: gid, Mode: fileMode}
+
+	attrs = ApplyPosixAttributes(attrs, map[string]string{
+		ModeMetadataKey:  "4750",
+		UidMetadataKey:   "1001",
+		GidMetadataKey:   "1002",
+		AtimeMetadataKey: atime.Format(time.RFC3339Nano),
+	})
+
+	assert.Equal(t, os.FileMode(0750)|os.ModeSetuid, attrs.Mode)
+	assert.Equal(t, uint32(1001), attrs.Uid)
+	assert.Equal(t, uint32(1002), attrs.Gid)
+	assert.Equal(t, atime, attrs.Atime)
+}
+
+func TestApplyPosixAttributesKeepsFileType(t *testing.T) {
+	attrs := fuseops.InodeAttributes{Mode: os.ModeDir | 0755}
+
+	attrs = ApplyPosixAttributes(attrs, map[string]string{ModeMetadataKey: "700"})
+
+	assert.Equal(t, os.ModeDir|0700, attrs.Mode)
+}
+
+func TestApplyPosixAttributesIgnoresMalformedValues(t *testing.T) {
+	attrs := fuseops.InodeAttributes{Uid: uid, Gid: gid, Mode: fileMode}
+
+	got := ApplyPosixAttributes(attrs, map[string]string{
+		ModeMetadataKey:  "rwxr-xr-x",
+		UidMetadataKey:   "-1",
+		GidMetadataKey:   "root",
+		AtimeMetadataKey: "yesterday",
+	})
+
+	assert.Equal(t, attrs, got)
+}
+
+func TestFormatModeRoundTrip(t *testing.T) {
+	for _, mode := range []os.FileMode{0, 0644, 0755 | os.ModeSticky, 0777 | os.ModeSetuid | os.ModeSetgid} {
+		s := formatMode(mode)
+		got, err := parseMode(s)
+
+		require.NoError(t, err)
+		assert.Equal(t, mode, got, s)
+	}
+}
+
+type PosixAttributesTest struct {
+	suite.Suite
+	ctx    context.Context
+	bucket gcsx.SyncerBucket
+	clock  timeutil.SimulatedClock
+}
+
+func TestPosixAttributesSuite(t *testing.T) {
+	suite.Run(t, new(PosixAttributesTest))
+}
+
+func (t *PosixAttributesTest) SetupTest() {
+	t.ctx = context.Background()
+	t.clock.SetTime(time.Date(2024, 11, 5, 10, 0, 0, 0, time.UTC))
+	t.bucket = gcsx.NewSyncerBucket(
+		1, // Append threshold
+		ChunkTransferTimeoutSecs,
+		".gcsfuse_tmp/",
+		nil,
+		fake.NewFakeBucket(&t.clock, "some_bucket", gcs.NonHierarchical),
+		common.NewNoopMetrics())
+}
+
+func (t *PosixAttributesTest) createObject(name string) *gcs.MinObject {
+	o, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:     name,
+		Contents: strings.NewReader("taco"),
+	})
+	require.NoError(t.T(), err)
+	return storageutil.ConvertObjToMinObject(o)
+}
+
+func (t *PosixAttributesTest) newFileInode(m *gcs.MinObject, local bool) *FileInode {
+	in := NewFileInode(
+		fileInodeID,
+		NewFileName(NewRootName(""), fileName),
+		m,
+		fuseops.InodeAttributes{Uid: uid, Gid: gid, Mode: fileMode},
+		&t.bucket,
+		false, // localFileCache
+		contentcache.New("", &t.clock),
+		&t.clock,
+		local,
+		&cfg.WriteConfig{},
+		semaphore.NewWeighted(math.MaxInt64),
+		true)
+	in.Lock()
+	return in
+}
+
+func (t *PosixAttributesTest) metadata(name string) map[string]string {
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	require.NoError(t.T(), err)
+	return m.Metadata
+}
+
+func (t *PosixAttributesTest) TestFileSetPosixAttributes() {
+	in := t.newFileInode(t.createObject(fileName), false)
+	defer in.Unlock()
+	mode := os.FileMode(0600)
+	owner := uint32(1001)
+
+	err := in.SetPosixAttributes(t.ctx, PosixAttributes{Mode: &mode, Uid: &owner})
+
+	require.NoError(t.T(), err)
+	metadata := t.metadata(fileName)
+	assert.Equal(t.T(), "600", metadata[ModeMetadataKey])
+	assert.Equal(t.T(), "1001", metadata[UidMetadataKey])
+	assert.NotContains(t.T(), metadata, GidMetadataKey)
+	assert.Equal(t.T(), int64(2), in.SourceGeneration().Metadata)
+	attrs, err := in.Attributes(t.ctx)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), mode, attrs.Mode)
+	assert.Equal(t.T(), owner, attrs.Uid)
+	assert.Equal(t.T(), uint32(gid), attrs.Gid)
+}
+
+func (t *PosixAttributesTest) TestFileSetPosixAttributesClobbered() {
+	m := t.createObject(fileName)
+	in := t.newFileInode(m, false)
+	defer in.Unlock()
+	t.createObject(fileName)
+	mode := os.FileMode(0600)
+
+	err := in.SetPosixAttributes(t.ctx, PosixAttributes{Mode: &mode})
+
+	var clobberedErr *gcsfuse_errors.FileClobberedError
+	assert.ErrorAs(t.T(), err, &clobberedErr)
+}
+
+func (t *PosixAttributesTest) TestLocalFileSetPosixAttributesPersistedOnSync() {
+	in := t.newFileInode(nil, true)
+	defer in.Unlock()
+	require.NoError(t.T(), in.CreateBufferedOrTempWriter())
+	mode := os.FileMode(0640)
+	group := uint32(1002)
+
+	err := in.SetPosixAttributes(t.ctx, PosixAttributes{Mode: &mode, Gid: &group})
+
+	require.NoError(t.T(), err)
+	attrs, err := in.Attributes(t.ctx)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), mode, attrs.Mode)
+	assert.Equal(t.T(), group, attrs.Gid)
+	// Nothing is written until the file is synced.
+	require.NoError(t.T(), in.Sync(t.ctx))
+	metadata := t.metadata(fileName)
+	assert.Equal(t.T(), "640", metadata[ModeMetadataKey])
+	assert.Equal(t.T(), "1002", metadata[GidMetadataKey])
+	assert.Nil(t.T(), in.pendingPosixAttrs)
+}
+
+func (t *PosixAttributesTest) TestFileAttributesIgnorePersistedValuesWhenDisabled() {
+	o, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:     fileName,
+		Contents: strings.NewReader("taco"),
+		Metadata: map[string]string{ModeMetadataKey: "600"},
+	})
+	require.NoError(t.T(), err)
+	in := t.newFileInode(storageutil.ConvertObjToMinObject(o), false)
+	defer in.Unlock()
+	in.persistPosixAttrs = false
+
+	attrs, err := in.Attributes(t.ctx)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), fileMode, attrs.Mode)
+}
+
+func (t *PosixAttributesTest) TestExplicitDirSetPosixAttributes() {
+	m := t.createObject(dirInodeName)
+	in := NewExplicitDirInode(
+		dirInodeID,
+		NewDirName(NewRootName(""), dirInodeName),
+		m,
+		fuseops.InodeAttributes{Uid: uid, Gid: gid, Mode: dirMode},
+		false, // implicitDirs
+		false, // includeFoldersAsPrefixes
+		false, // enableNonexistentTypeCache
+		typeCacheTTL,
+		&t.bucket,
+		&t.clock,
+		&t.clock,
+		4,
+		false)
+	in.Lock()
+	defer in.Unlock()
+	mode := os.FileMode(0700)
+
+	err := in.(PosixAttributesInode).SetPosixAttributes(t.ctx, PosixAttributes{Mode: &mode})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "700", t.metadata(dirInodeName)[ModeMetadataKey])
+	attrs, err := in.Attributes(t.ctx)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), os.ModeDir|mode, attrs.Mode)
+	assert.Equal(t.T(), int64(2), in.SourceGeneration().Metadata)
+}
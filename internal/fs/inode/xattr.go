@@ -0,0 +1,206 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/fuse"
+	"golang.org/x/net/context"
+)
+
+// Extended attribute namespaces. Attributes under GCSXattrPrefix are derived
+// from the backing object or folder and are read-only. Attributes under
+// UserXattrPrefix map one-to-one onto custom metadata keys of the backing
+// object and may be set and removed.
+const (
+	GCSXattrPrefix  = "gcs."
+	UserXattrPrefix = "user."
+)
+
+// Names of the read-only extended attributes.
+const (
+	XattrGeneration     = GCSXattrPrefix + "generation"
+	XattrMetaGeneration = GCSXattrPrefix + "metageneration"
+	XattrCRC32C         = GCSXattrPrefix + "crc32c"
+	XattrMD5            = GCSXattrPrefix + "md5"
+	XattrContentType    = GCSXattrPrefix + "content_type"
+	XattrStorageClass   = GCSXattrPrefix + "storage_class"
+	XattrUpdated        = GCSXattrPrefix + "updated"
+
+	// Every custom metadata entry of the backing object, including the ones
+	// reserved by gcsfuse, is exposed read-only under this prefix.
+	XattrMetadataPrefix = GCSXattrPrefix + "metadata."
+)
+
+// Flags accepted by setxattr(2).
+const (
+	xattrCreate  = 0x1
+	xattrReplace = 0x2
+)
+
+// Metadata keys that gcsfuse manages itself and that therefore must not be
+// modified through the user namespace.
+var reservedMetadataKeys = map[string]struct{}{
+	FileMtimeMetadataKey:       {},
+	ModeMetadataKey:            {},
+	UidMetadataKey:             {},
+	GidMetadataKey:             {},
+	AtimeMetadataKey:           {},
+	SymlinkMetadataKey:         {},
+	"goog-reserved-file-mtime": {},
+}
+
+func isReservedMetadataKey(key string) bool {
+	_, ok := reservedMetadataKeys[key]
+	return ok
+}
+
+// Map an extended attribute name in the user namespace to the custom metadata
+// key that backs it.
+func userXattrKey(name string) (key string, err error) {
+	if strings.HasPrefix(name, GCSXattrPrefix) {
+		err = syscall.EPERM
+		return
+	}
+
+	if !strings.HasPrefix(name, UserXattrPrefix) {
+		err = syscall.ENOTSUP
+		return
+	}
+
+	key = strings.TrimPrefix(name, UserXattrPrefix)
+	if key == "" {
+		err = syscall.EINVAL
+		return
+	}
+
+	if isReservedMetadataKey(key) {
+		err = syscall.EPERM
+		return
+	}
+
+	return
+}
+
+// Apply the semantics of the XATTR_CREATE and XATTR_REPLACE flags.
+func checkXattrFlags(exists bool, flags uint32) error {
+	if flags&xattrCreate != 0 && exists {
+		return syscall.EEXIST
+	}
+
+	if flags&xattrReplace != 0 && !exists {
+		return fuse.ENOATTR
+	}
+
+	return nil
+}
+
+// Compute the extended attributes for the supplied object. Checksums are
+// base64 encoded in the same way the GCS JSON API reports them.
+func objectXattrs(o *gcs.Object) (xattrs map[string][]byte) {
+	xattrs = make(map[string][]byte)
+	if o == nil {
+		return
+	}
+
+	xattrs[XattrGeneration] = []byte(strconv.FormatInt(o.Generation, 10))
+	xattrs[XattrMetaGeneration] = []byte(strconv.FormatInt(o.MetaGeneration, 10))
+	xattrs[XattrUpdated] = []byte(o.Updated.UTC().Format(time.RFC3339Nano))
+
+	if o.CRC32C != nil {
+		var buf [4]byte
+		binary.BigEndian.PutUint32(buf[:], *o.CRC32C)
+		xattrs[XattrCRC32C] = []byte(base64.StdEncoding.EncodeToString(buf[:]))
+	}
+
+	if o.MD5 != nil {
+		xattrs[XattrMD5] = []byte(base64.StdEncoding.EncodeToString(o.MD5[:]))
+	}
+
+	if o.ContentType != "" {
+		xattrs[XattrContentType] = []byte(o.ContentType)
+	}
+
+	if o.StorageClass != "" {
+		xattrs[XattrStorageClass] = []byte(o.StorageClass)
+	}
+
+	for k, v := range o.Metadata {
+		xattrs[XattrMetadataPrefix+k] = []byte(v)
+		if !isReservedMetadataKey(k) {
+			xattrs[UserXattrPrefix+k] = []byte(v)
+		}
+	}
+
+	return
+}
+
+// Compute the extended attributes for the supplied folder of a hierarchical
+// bucket. Folders carry no checksums or custom metadata.
+func folderXattrs(f *gcs.Folder) (xattrs map[string][]byte) {
+	xattrs = make(map[string][]byte)
+	if f == nil {
+		return
+	}
+
+	xattrs[XattrUpdated] = []byte(f.UpdateTime.UTC().Format(time.RFC3339Nano))
+	return
+}
+
+// Patch a single custom metadata key on the supplied generation of an object,
+// guarded by its meta-generation. A nil value removes the key.
+//
+// A failed precondition is reported as ESTALE so that the caller can re-read
+// the current attributes and retry.
+func updateObjectMetadata(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	m *gcs.MinObject,
+	key string,
+	value *string) (o *gcs.Object, err error) {
+	metaGeneration := m.MetaGeneration
+	req := &gcs.UpdateObjectRequest{
+		Name:                       m.Name,
+		Generation:                 m.Generation,
+		MetaGenerationPrecondition: &metaGeneration,
+		Metadata: map[string]*string{
+			key: value,
+		},
+	}
+
+	o, err = bucket.UpdateObject(ctx, req)
+
+	var preconditionErr *gcs.PreconditionError
+	if errors.As(err, &preconditionErr) {
+		err = fmt.Errorf("UpdateObject(%q): %v: %w", m.Name, err, syscall.ESTALE)
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("UpdateObject(%q): %w", m.Name, err)
+		return
+	}
+
+	return
+}
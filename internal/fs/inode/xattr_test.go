@@ -0,0 +1,325 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+	"golang.org/x/sync/semaphore"
+)
+
+type XattrTest struct {
+	suite.Suite
+	ctx    context.Context
+	bucket gcsx.SyncerBucket
+	clock  timeutil.SimulatedClock
+}
+
+func TestXattrSuite(t *testing.T) {
+	suite.Run(t, new(XattrTest))
+}
+
+func (t *XattrTest) SetupTest() {
+	t.ctx = context.Background()
+	t.clock.SetTime(time.Date(2024, 11, 5, 10, 0, 0, 0, time.UTC))
+	t.bucket = gcsx.NewSyncerBucket(
+		1, // Append threshold
+		ChunkTransferTimeoutSecs,
+		".gcsfuse_tmp/",
+		nil,
+		fake.NewFakeBucket(&t.clock, "some_bucket", gcs.NonHierarchical),
+		common.NewNoopMetrics())
+}
+
+func (t *XattrTest) createObject(name string, metadata map[string]string) *gcs.MinObject {
+	o, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:        name,
+		ContentType: "text/plain",
+		Metadata:    metadata,
+		Contents:    strings.NewReader("taco"),
+	})
+	require.NoError(t.T(), err)
+	return storageutil.ConvertObjToMinObject(o)
+}
+
+func (t *XattrTest) newFileInode(m *gcs.MinObject, local bool) *FileInode {
+	in := NewFileInode(
+		fileInodeID,
+		NewFileName(NewRootName(""), fileName),
+		m,
+		fuseops.InodeAttributes{Uid: uid, Gid: gid, Mode: fileMode},
+		&t.bucket,
+		false, // localFileCache
+		contentcache.New("", &t.clock),
+		&t.clock,
+		local,
+		&cfg.WriteConfig{},
+		semaphore.NewWeighted(math.MaxInt64),
+		false)
+	in.Lock()
+	return in
+}
+
+func (t *XattrTest) newExplicitDirInode(m *gcs.MinObject) DirInode {
+	in := NewExplicitDirInode(
+		dirInodeID,
+		NewDirName(NewRootName(""), dirInodeName),
+		m,
+		fuseops.InodeAttributes{Uid: uid, Gid: gid, Mode: dirMode},
+		false, // implicitDirs
+		false, // includeFoldersAsPrefixes
+		false, // enableNonexistentTypeCache
+		typeCacheTTL,
+		&t.bucket,
+		&t.clock,
+		&t.clock,
+		4,
+		false)
+	in.Lock()
+	return in
+}
+
+func (t *XattrTest) metadata(name string) map[string]string {
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	require.NoError(t.T(), err)
+	return m.Metadata
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *XattrTest) TestFileXattrs() {
+	m := t.createObject(fileName, map[string]string{"color": "red", FileMtimeMetadataKey: "2024-11-05T10:00:00Z"})
+	in := t.newFileInode(m, false)
+	defer in.Unlock()
+
+	xattrs, err := in.Xattrs(t.ctx)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), strconv.FormatInt(m.Generation, 10), string(xattrs[XattrGeneration]))
+	assert.Equal(t.T(), "1", string(xattrs[XattrMetaGeneration]))
+	assert.Equal(t.T(), "text/plain", string(xattrs[XattrContentType]))
+	assert.Equal(t.T(), "STANDARD", string(xattrs[XattrStorageClass]))
+	// base64 of the big-endian CRC32C and of the MD5 of "taco".
+	assert.Equal(t.T(), "rmxLDw==", string(xattrs[XattrCRC32C]))
+	assert.Equal(t.T(), "+GnOHIQUomS7EeFKLIhQ7Q==", string(xattrs[XattrMD5]))
+	assert.Equal(t.T(), "red", string(xattrs[XattrMetadataPrefix+"color"]))
+	assert.Equal(t.T(), "red", string(xattrs[UserXattrPrefix+"color"]))
+	// Reserved keys are visible read-only, but not in the user namespace.
+	assert.Contains(t.T(), xattrs, XattrMetadataPrefix+FileMtimeMetadataKey)
+	assert.NotContains(t.T(), xattrs, UserXattrPrefix+FileMtimeMetadataKey)
+}
+
+func (t *XattrTest) TestFileXattrs_Clobbered() {
+	m := t.createObject(fileName, nil)
+	in := t.newFileInode(m, false)
+	defer in.Unlock()
+	t.createObject(fileName, nil)
+
+	_, err := in.Xattrs(t.ctx)
+
+	assert.Error(t.T(), err)
+}
+
+func (t *XattrTest) TestFileXattrs_LocalFile() {
+	in := t.newFileInode(nil, true)
+	defer in.Unlock()
+
+	xattrs, err := in.Xattrs(t.ctx)
+
+	require.NoError(t.T(), err)
+	assert.Empty(t.T(), xattrs)
+	assert.ErrorIs(t.T(), in.SetXattr(t.ctx, "user.color", []byte("red"), 0), syscall.ENOTSUP)
+}
+
+func (t *XattrTest) TestFileSetXattr() {
+	m := t.createObject(fileName, nil)
+	in := t.newFileInode(m, false)
+	defer in.Unlock()
+
+	err := in.SetXattr(t.ctx, "user.color", []byte("blue"), 0)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "blue", t.metadata(fileName)["color"])
+	// The inode adopts the new meta-generation but keeps its generation.
+	assert.Equal(t.T(), m.Generation, in.SourceGeneration().Object)
+	assert.Equal(t.T(), m.MetaGeneration+1, in.SourceGeneration().Metadata)
+	xattrs, err := in.Xattrs(t.ctx)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "blue", string(xattrs["user.color"]))
+}
+
+func (t *XattrTest) TestFileSetXattr_PreservedAcrossSync() {
+	m := t.createObject(fileName, nil)
+	in := t.newFileInode(m, false)
+	defer in.Unlock()
+	require.NoError(t.T(), in.Write(t.ctx, []byte("burrito"), 0))
+
+	require.NoError(t.T(), in.SetXattr(t.ctx, "user.color", []byte("green"), 0))
+	err := in.Sync(t.ctx)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "green", t.metadata(fileName)["color"])
+}
+
+func (t *XattrTest) TestFileSetXattr_Flags() {
+	m := t.createObject(fileName, map[string]string{"color": "red"})
+	in := t.newFileInode(m, false)
+	defer in.Unlock()
+
+	assert.ErrorIs(t.T(), in.SetXattr(t.ctx, "user.color", []byte("blue"), xattrCreate), syscall.EEXIST)
+	assert.ErrorIs(t.T(), in.SetXattr(t.ctx, "user.shape", []byte("round"), xattrReplace), fuse.ENOATTR)
+	assert.NoError(t.T(), in.SetXattr(t.ctx, "user.color", []byte("blue"), xattrReplace))
+	assert.NoError(t.T(), in.SetXattr(t.ctx, "user.shape", []byte("round"), xattrCreate))
+}
+
+func (t *XattrTest) TestFileSetXattr_InvalidNames() {
+	m := t.createObject(fileName, nil)
+	in := t.newFileInode(m, false)
+	defer in.Unlock()
+
+	assert.ErrorIs(t.T(), in.SetXattr(t.ctx, XattrGeneration, []byte("1"), 0), syscall.EPERM)
+	assert.ErrorIs(t.T(), in.SetXattr(t.ctx, "user."+FileMtimeMetadataKey, []byte("1"), 0), syscall.EPERM)
+	assert.ErrorIs(t.T(), in.SetXattr(t.ctx, "security.selinux", []byte("1"), 0), syscall.ENOTSUP)
+	assert.ErrorIs(t.T(), in.SetXattr(t.ctx, "user.", []byte("1"), 0), syscall.EINVAL)
+}
+
+func (t *XattrTest) TestFileSetXattr_MetaGenerationMismatch() {
+	m := t.createObject(fileName, nil)
+	in := t.newFileInode(m, false)
+	defer in.Unlock()
+	// Modify the metadata behind the inode's back.
+	value := "red"
+	_, err := t.bucket.UpdateObject(t.ctx, &gcs.UpdateObjectRequest{
+		Name:     fileName,
+		Metadata: map[string]*string{"color": &value},
+	})
+	require.NoError(t.T(), err)
+
+	err = in.SetXattr(t.ctx, "user.color", []byte("blue"), 0)
+
+	assert.ErrorIs(t.T(), err, syscall.ESTALE)
+	assert.Equal(t.T(), "red", t.metadata(fileName)["color"])
+}
+
+func (t *XattrTest) TestFileRemoveXattr() {
+	m := t.createObject(fileName, map[string]string{"color": "red", "shape": "round"})
+	in := t.newFileInode(m, false)
+	defer in.Unlock()
+
+	err := in.RemoveXattr(t.ctx, "user.color")
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), map[string]string{"shape": "round"}, t.metadata(fileName))
+	assert.ErrorIs(t.T(), in.RemoveXattr(t.ctx, "user.color"), fuse.ENOATTR)
+}
+
+func (t *XattrTest) TestExplicitDirXattrs() {
+	m := t.createObject(dirInodeName, map[string]string{"owner": "build"})
+	in := t.newExplicitDirInode(m)
+	defer in.Unlock()
+	xin, ok := in.(XattrInode)
+	require.True(t.T(), ok)
+
+	xattrs, err := xin.Xattrs(t.ctx)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), strconv.FormatInt(m.Generation, 10), string(xattrs[XattrGeneration]))
+	assert.Equal(t.T(), "build", string(xattrs["user.owner"]))
+}
+
+func (t *XattrTest) TestExplicitDirSetAndRemoveXattr() {
+	m := t.createObject(dirInodeName, nil)
+	in := t.newExplicitDirInode(m)
+	defer in.Unlock()
+	xin := in.(XattrInode)
+
+	require.NoError(t.T(), xin.SetXattr(t.ctx, "user.owner", []byte("build"), 0))
+	assert.Equal(t.T(), "build", t.metadata(dirInodeName)["owner"])
+
+	require.NoError(t.T(), xin.RemoveXattr(t.ctx, "user.owner"))
+	assert.NotContains(t.T(), t.metadata(dirInodeName), "owner")
+}
+
+func (t *XattrTest) TestImplicitDirXattrs() {
+	t.createObject(dirInodeName+"file", nil)
+	in := t.newExplicitDirInode(nil)
+	defer in.Unlock()
+	xin := in.(XattrInode)
+
+	xattrs, err := xin.Xattrs(t.ctx)
+
+	require.NoError(t.T(), err)
+	assert.Empty(t.T(), xattrs)
+	assert.ErrorIs(t.T(), xin.SetXattr(t.ctx, "user.owner", []byte("build"), 0), syscall.ENOTSUP)
+	assert.ErrorIs(t.T(), xin.RemoveXattr(t.ctx, "user.owner"), fuse.ENOATTR)
+}
+
+func (t *XattrTest) TestFolderXattrs() {
+	t.bucket = gcsx.NewSyncerBucket(
+		1, // Append threshold
+		ChunkTransferTimeoutSecs,
+		".gcsfuse_tmp/",
+		nil,
+		fake.NewFakeBucket(&t.clock, "some_bucket", gcs.Hierarchical),
+		common.NewNoopMetrics())
+	_, err := t.bucket.CreateFolder(t.ctx, dirInodeName)
+	require.NoError(t.T(), err)
+	// Real folders have no backing object; drop the one the fake creates.
+	require.NoError(t.T(), t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: dirInodeName}))
+	in := NewDirInode(
+		dirInodeID,
+		NewDirName(NewRootName(""), dirInodeName),
+		fuseops.InodeAttributes{Uid: uid, Gid: gid, Mode: dirMode},
+		false,
+		false,
+		false,
+		typeCacheTTL,
+		&t.bucket,
+		&t.clock,
+		&t.clock,
+		4,
+		true)
+	in.Lock()
+	defer in.Unlock()
+	xin := in.(XattrInode)
+
+	xattrs, err := xin.Xattrs(t.ctx)
+
+	require.NoError(t.T(), err)
+	assert.Contains(t.T(), xattrs, XattrUpdated)
+	assert.NotContains(t.T(), xattrs, XattrGeneration)
+	assert.ErrorIs(t.T(), xin.SetXattr(t.ctx, "user.owner", []byte("build"), 0), syscall.ENOTSUP)
+}
@@ -474,26 +474,69 @@ func (t *LocalFileTest) TestRecursiveListingWithLocalFiles() {
 	t.closeFileAndValidateObjectContents(&t.f3, ""+FileName, "")
 }
 
-func (t *LocalFileTest) TestRenameOfLocalFileFails() {
+func (t *LocalFileTest) TestRenameOfLocalFile() {
 	// Create local file with some content.
 	_, t.f1 = t.createLocalFile(FileName)
 	_, err := t.f1.WriteString(FileContents)
 	AssertEq(nil, err)
 
-	// Attempt to rename local file.
+	// Rename local file.
 	err = os.Rename(path.Join(mntDir, FileName), path.Join(mntDir, "newName"))
 
-	// Verify rename operation fails.
-	AssertNe(nil, err)
-	AssertTrue(strings.Contains(err.Error(), "operation not supported"))
+	// Verify the rename happened in memory only.
+	AssertEq(nil, err)
+	_, err = os.Stat(path.Join(mntDir, FileName))
+	AssertTrue(os.IsNotExist(err))
+	t.verifyLocalFileEntry(t.readDirectory(mntDir)[0], "newName", len(FileContents))
+	t.validateObjectNotFoundErr(FileName)
+	t.validateObjectNotFoundErr("newName")
 	// write more content to local file.
 	_, err = t.f1.WriteString(FileContents)
 	AssertEq(nil, err)
-	// Close the local file.
-	t.closeFileAndValidateObjectContents(&t.f1, FileName, FileContents+FileContents)
+	// Close the local file and verify it is created under the new name.
+	t.closeFileAndValidateObjectContents(&t.f1, "newName", FileContents+FileContents)
+	t.validateObjectNotFoundErr(FileName)
+}
+
+func (t *LocalFileTest) TestRenameOfLocalFileOverExistingObject() {
+	AssertEq(nil, t.createObjects(map[string]string{"newName": "taco"}))
+	// Create local file with some content.
+	_, t.f1 = t.createLocalFile(FileName)
+	_, err := t.f1.WriteString(FileContents)
+	AssertEq(nil, err)
+
+	// Rename local file over the existing object.
+	err = os.Rename(path.Join(mntDir, FileName), path.Join(mntDir, "newName"))
+
+	// Verify the file was uploaded to replace the object.
+	AssertEq(nil, err)
+	t.validateObjectContents("newName", FileContents)
+	t.validateObjectNotFoundErr(FileName)
+	AssertEq(nil, t.closeLocalFile(&t.f1))
+	t.validateObjectContents("newName", FileContents)
+}
+
+func (t *LocalFileTest) TestRenameOfLocalFileOverLocalFile() {
+	// Create two local files with different content.
+	_, t.f1 = t.createLocalFile(FileName)
+	_, err := t.f1.WriteString(FileContents)
+	AssertEq(nil, err)
+	_, t.f2 = t.createLocalFile("newName")
+	_, err = t.f2.WriteString("taco")
+	AssertEq(nil, err)
+
+	// Rename the first file over the second.
+	err = os.Rename(path.Join(mntDir, FileName), path.Join(mntDir, "newName"))
+
+	// Verify only the renamed file is created.
+	AssertEq(nil, err)
+	AssertEq(nil, t.closeLocalFile(&t.f2))
+	t.validateObjectNotFoundErr("newName")
+	t.closeFileAndValidateObjectContents(&t.f1, "newName", FileContents)
+	t.validateObjectNotFoundErr(FileName)
 }
 
-func (t *LocalFileTest) TestRenameOfDirectoryWithLocalFileFails() {
+func (t *LocalFileTest) TestRenameOfDirectoryWithLocalFile() {
 	// Create directory foo.
 	AssertEq(
 		nil,
@@ -502,45 +545,69 @@ func (t *LocalFileTest) TestRenameOfDirectoryWithLocalFileFails() {
 				"foo/":        "",
 				"foo/gcsFile": "",
 			}))
-	// Create local file with some content.
+	// Create local files with some content, one of them in a sub-directory.
 	_, t.f1 = t.createLocalFile("foo/" + FileName)
 	_, err := t.f1.WriteString(FileContents)
 	AssertEq(nil, err)
+	AssertEq(nil, os.Mkdir(path.Join(mntDir, "foo/baz"), dirPerms))
+	_, t.f2 = t.createLocalFile("foo/baz/" + FileName)
 
-	// Attempt to rename directory containing local file.
+	// Rename directory containing local files.
 	err = os.Rename(path.Join(mntDir, "foo/"), path.Join(mntDir, "bar/"))
 
-	// Verify rename operation fails.
-	AssertNe(nil, err)
-	AssertTrue(strings.Contains(err.Error(), "operation not supported"))
+	// Verify the local files moved along with the directory.
+	AssertEq(nil, err)
+	t.validateObjectContents("bar/gcsFile", "")
+	t.validateObjectNotFoundErr("foo/gcsFile")
+	t.validateObjectNotFoundErr("bar/" + FileName)
+	_, err = os.Stat(path.Join(mntDir, "bar/baz", FileName))
+	AssertEq(nil, err)
 	// write more content to local file.
 	_, err = t.f1.WriteString(FileContents)
 	AssertEq(nil, err)
-	// Close the local file.
-	t.closeFileAndValidateObjectContents(&t.f1, "foo/"+FileName, FileContents+FileContents)
+	// Close the local files.
+	t.closeFileAndValidateObjectContents(&t.f1, "bar/"+FileName, FileContents+FileContents)
+	t.closeFileAndValidateObjectContents(&t.f2, "bar/baz/"+FileName, "")
+	t.validateObjectNotFoundErr("foo/" + FileName)
+	t.validateObjectNotFoundErr("foo/baz/" + FileName)
 }
 
 func (t *LocalFileTest) TestRenameOfLocalFileSucceedsAfterSync() {
-	t.TestRenameOfLocalFileFails()
+	// Create and sync a local file.
+	_, t.f1 = t.createLocalFile(FileName)
+	_, err := t.f1.WriteString(FileContents)
+	AssertEq(nil, err)
+	t.closeFileAndValidateObjectContents(&t.f1, FileName, FileContents)
 
 	// Attempt to Rename synced file.
-	err := os.Rename(path.Join(mntDir, FileName), path.Join(mntDir, "newName"))
+	err = os.Rename(path.Join(mntDir, FileName), path.Join(mntDir, "newName"))
 
 	// Validate.
 	AssertEq(nil, err)
-	t.validateObjectContents("newName", FileContents+FileContents)
+	t.validateObjectContents("newName", FileContents)
 	t.validateObjectNotFoundErr(FileName)
 }
 
 func (t *LocalFileTest) TestRenameOfDirectoryWithLocalFileSucceedsAfterSync() {
-	t.TestRenameOfDirectoryWithLocalFileFails()
+	// Create directory foo with a synced local file.
+	AssertEq(
+		nil,
+		t.createObjects(
+			map[string]string{
+				"foo/":        "",
+				"foo/gcsFile": "",
+			}))
+	_, t.f1 = t.createLocalFile("foo/" + FileName)
+	_, err := t.f1.WriteString(FileContents)
+	AssertEq(nil, err)
+	t.closeFileAndValidateObjectContents(&t.f1, "foo/"+FileName, FileContents)
 
-	// Attempt to rename directory again after sync.
-	err := os.Rename(path.Join(mntDir, "foo/"), path.Join(mntDir, "bar/"))
+	// Attempt to rename directory after sync.
+	err = os.Rename(path.Join(mntDir, "foo/"), path.Join(mntDir, "bar/"))
 
 	// Validate.
 	AssertEq(nil, err)
-	t.validateObjectContents("bar/"+FileName, FileContents+FileContents)
+	t.validateObjectContents("bar/"+FileName, FileContents)
 	t.validateObjectNotFoundErr("foo/" + FileName)
 	t.validateObjectContents("bar/gcsFile", "")
 	t.validateObjectNotFoundErr("foo/gcsFile")
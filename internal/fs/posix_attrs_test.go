@@ -0,0 +1,156 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs_test
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// //////////////////////////////////////////////////////////////////////
+// Boilerplate
+// //////////////////////////////////////////////////////////////////////
+
+type PersistPosixAttributesTest struct {
+	fsTest
+	suite.Suite
+}
+
+func TestPersistPosixAttributes(t *testing.T) {
+	suite.Run(t, new(PersistPosixAttributesTest))
+}
+
+func (t *PersistPosixAttributesTest) SetupSuite() {
+	t.serverCfg.NewConfig = &cfg.Config{
+		FileSystem: cfg.FileSystemConfig{
+			ExperimentalPersistPosixAttributes: true,
+		},
+		MetadataCache: cfg.MetadataCacheConfig{
+			TtlSecs: 0,
+		},
+	}
+	t.fsTest.SetUpTestSuite()
+}
+
+func (t *PersistPosixAttributesTest) TearDownSuite() {
+	t.fsTest.TearDownTestSuite()
+}
+
+func (t *PersistPosixAttributesTest) TearDownTest() {
+	t.fsTest.TearDown()
+}
+
+func (t *PersistPosixAttributesTest) metadata(name string) map[string]string {
+	m, _, err := bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: name})
+	require.NoError(t.T(), err)
+	return m.Metadata
+}
+
+// //////////////////////////////////////////////////////////////////////
+// Tests
+// //////////////////////////////////////////////////////////////////////
+
+func (t *PersistPosixAttributesTest) TestChmodFile() {
+	_, err := storageutil.CreateObject(ctx, bucket, "foo", []byte("taco"))
+	require.NoError(t.T(), err)
+
+	err = os.Chmod(path.Join(mntDir, "foo"), 0600)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "600", t.metadata("foo")[inode.ModeMetadataKey])
+	fi, err := os.Stat(path.Join(mntDir, "foo"))
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), os.FileMode(0600), fi.Mode())
+}
+
+func (t *PersistPosixAttributesTest) TestModeReadFromMetadata() {
+	_, err := bucket.CreateObject(ctx, &gcs.CreateObjectRequest{
+		Name:     "dir/",
+		Contents: strings.NewReader(""),
+		Metadata: map[string]string{inode.ModeMetadataKey: "750"},
+	})
+	require.NoError(t.T(), err)
+
+	fi, err := os.Stat(path.Join(mntDir, "dir"))
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), os.ModeDir|0750, fi.Mode())
+}
+
+func (t *PersistPosixAttributesTest) TestChmodLocalFile() {
+	f, err := os.Create(path.Join(mntDir, "bar"))
+	require.NoError(t.T(), err)
+
+	err = f.Chmod(0640)
+	require.NoError(t.T(), err)
+	err = f.Close()
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "640", t.metadata("bar")[inode.ModeMetadataKey])
+}
+
+func (t *PersistPosixAttributesTest) TestModeAndOwnerOfCreatedFile() {
+	f, err := os.OpenFile(path.Join(mntDir, "baz"), os.O_CREATE|os.O_WRONLY, 0755)
+	require.NoError(t.T(), err)
+
+	err = f.Close()
+
+	require.NoError(t.T(), err)
+	m, _, err := bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: "baz"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "755", m.Metadata[inode.ModeMetadataKey])
+	assert.Equal(t.T(), strconv.Itoa(os.Getuid()), m.Metadata[inode.UidMetadataKey])
+	// The attributes are created with the object rather than added after.
+	assert.EqualValues(t.T(), 1, m.MetaGeneration)
+	fi, err := os.Stat(path.Join(mntDir, "baz"))
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), os.FileMode(0755), fi.Mode())
+}
+
+func (t *PersistPosixAttributesTest) TestChmodLocalFileIsCreatedWithMode() {
+	f, err := os.Create(path.Join(mntDir, "qux"))
+	require.NoError(t.T(), err)
+	err = f.Chmod(0700)
+	require.NoError(t.T(), err)
+
+	err = f.Close()
+
+	require.NoError(t.T(), err)
+	m, _, err := bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: "qux"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "700", m.Metadata[inode.ModeMetadataKey])
+	assert.EqualValues(t.T(), 1, m.MetaGeneration)
+}
+
+func (t *PersistPosixAttributesTest) TestModeOfCreatedDir() {
+	err := os.Mkdir(path.Join(mntDir, "newdir"), 0750)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "750", t.metadata("newdir/")[inode.ModeMetadataKey])
+	fi, err := os.Stat(path.Join(mntDir, "newdir"))
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), os.ModeDir|0750, fi.Mode())
+}
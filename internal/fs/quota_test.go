@@ -0,0 +1,113 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs_test
+
+import (
+	"os"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	quotaLimitBytes   = 1 << 20
+	quotaLimitObjects = 4
+)
+
+// //////////////////////////////////////////////////////////////////////
+// Boilerplate
+// //////////////////////////////////////////////////////////////////////
+
+type QuotaTest struct {
+	fsTest
+	suite.Suite
+}
+
+func TestQuota(t *testing.T) {
+	suite.Run(t, new(QuotaTest))
+}
+
+func (t *QuotaTest) SetupSuite() {
+	t.serverCfg.NewConfig = &cfg.Config{
+		Quota: cfg.QuotaConfig{
+			ExceededError:     cfg.QuotaExceededErrorEDQUOT,
+			LimitBytes:        quotaLimitBytes,
+			LimitObjects:      quotaLimitObjects,
+			UsageScanInterval: time.Hour,
+		},
+	}
+	t.fsTest.SetUpTestSuite()
+}
+
+func (t *QuotaTest) TearDownSuite() {
+	t.fsTest.TearDownTestSuite()
+}
+
+func (t *QuotaTest) TearDownTest() {
+	t.fsTest.TearDown()
+}
+
+// //////////////////////////////////////////////////////////////////////
+// Tests
+// //////////////////////////////////////////////////////////////////////
+
+func (t *QuotaTest) TestStatFSReportsLimits() {
+	var stat syscall.Statfs_t
+
+	err := syscall.Statfs(mntDir, &stat)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), uint64(quotaLimitBytes), stat.Blocks*uint64(stat.Frsize))
+	assert.Equal(t.T(), uint64(quotaLimitObjects), stat.Files)
+}
+
+func (t *QuotaTest) TestStatFSReportsLocalUsage() {
+	err := os.WriteFile(path.Join(mntDir, "foo"), make([]byte, quotaLimitBytes/4), filePerms)
+	require.NoError(t.T(), err)
+	var stat syscall.Statfs_t
+
+	err = syscall.Statfs(mntDir, &stat)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), stat.Blocks*3/4, stat.Bfree)
+	assert.Equal(t.T(), uint64(quotaLimitObjects-1), stat.Ffree)
+	require.NoError(t.T(), os.Remove(path.Join(mntDir, "foo")))
+	err = syscall.Statfs(mntDir, &stat)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), stat.Blocks, stat.Bfree)
+	assert.Equal(t.T(), uint64(quotaLimitObjects), stat.Ffree)
+}
+
+func (t *QuotaTest) TestWriteBeyondQuota() {
+	err := os.WriteFile(path.Join(mntDir, "foo"), make([]byte, 2*quotaLimitBytes), filePerms)
+
+	assert.ErrorIs(t.T(), err, syscall.EDQUOT)
+}
+
+func (t *QuotaTest) TestCreateBeyondQuota() {
+	for i := 0; i < quotaLimitObjects; i++ {
+		require.NoError(t.T(), os.Mkdir(path.Join(mntDir, "dir"+string(rune('a'+i))), dirPerms))
+	}
+
+	err := os.Mkdir(path.Join(mntDir, "one_too_many"), dirPerms)
+
+	assert.ErrorIs(t.T(), err, syscall.EDQUOT)
+}
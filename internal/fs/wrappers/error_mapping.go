@@ -25,6 +25,7 @@ import (
 	"github.com/googleapis/gax-go/v2/apierror"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/gcsfuse_errors"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/jacobsa/fuse/fuseops"
 	"github.com/jacobsa/fuse/fuseutil"
 	"google.golang.org/api/googleapi"
@@ -64,6 +65,12 @@ func errno(err error, preconditionErrCfg bool) error {
 		return syscall.ENOENT
 	}
 
+	// The object can't be read or written without its customer-supplied key.
+	var keyErr *gcs.EncryptionKeyError
+	if errors.As(err, &keyErr) {
+		return syscall.EACCES
+	}
+
 	// The HTTP request is canceled
 	if strings.Contains(err.Error(), "net/http: request canceled") {
 		return syscall.ECANCELED
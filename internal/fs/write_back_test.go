@@ -0,0 +1,162 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs_test
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+const writeBackTimeout = 5 * time.Second
+
+// //////////////////////////////////////////////////////////////////////
+// Boilerplate
+// //////////////////////////////////////////////////////////////////////
+
+type WriteBackTest struct {
+	fsTest
+	suite.Suite
+}
+
+func TestWriteBack(t *testing.T) {
+	suite.Run(t, new(WriteBackTest))
+}
+
+func (t *WriteBackTest) SetupSuite() {
+	tempDir := t.T().TempDir()
+	bucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical)
+
+	// Leave an entry behind, as if the previous mount had crashed.
+	contentCache := contentcache.New(tempDir, timeutil.RealClock())
+	tf, err := contentCache.NewTempFile(io.NopCloser(strings.NewReader("")))
+	require.NoError(t.T(), err)
+	_, err = tf.WriteAt([]byte("replayed"), 0)
+	require.NoError(t.T(), err)
+	_, err = contentCache.AddToJournal(&contentcache.CacheObjectKey{BucketName: bucket.Name(), ObjectName: "crashed"}, 0, 0, nil, tf)
+	require.NoError(t.T(), err)
+	tf.Destroy()
+
+	t.serverCfg.TempDir = tempDir
+	t.serverCfg.NewConfig = &cfg.Config{
+		Write: cfg.WriteConfig{
+			ExperimentalWriteBack: true,
+		},
+	}
+	t.fsTest.SetUpTestSuite()
+}
+
+func (t *WriteBackTest) TearDownSuite() {
+	t.fsTest.TearDownTestSuite()
+}
+
+func (t *WriteBackTest) TearDownTest() {
+	t.fsTest.TearDown()
+}
+
+func (t *WriteBackTest) eventuallyObjectContents(name string, expected string) {
+	assert.Eventually(t.T(), func() bool {
+		contents, err := storageutil.ReadObject(ctx, bucket, name)
+		return err == nil && string(contents) == expected
+	}, writeBackTimeout, 10*time.Millisecond)
+}
+
+// //////////////////////////////////////////////////////////////////////
+// Tests
+// //////////////////////////////////////////////////////////////////////
+
+func (t *WriteBackTest) TestJournalIsReplayedOnMount() {
+	t.eventuallyObjectContents("crashed", "replayed")
+}
+
+func (t *WriteBackTest) TestCloseWritesBackNewFile() {
+	err := os.WriteFile(path.Join(mntDir, "foo"), []byte("taco"), filePerms)
+	require.NoError(t.T(), err)
+
+	t.eventuallyObjectContents("foo", "taco")
+	contents, err := os.ReadFile(path.Join(mntDir, "foo"))
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", string(contents))
+}
+
+func (t *WriteBackTest) TestCloseWritesBackExistingFile() {
+	_, err := storageutil.CreateObject(ctx, bucket, "foo", []byte("taco"))
+	require.NoError(t.T(), err)
+
+	err = os.WriteFile(path.Join(mntDir, "foo"), []byte("burrito"), filePerms)
+	require.NoError(t.T(), err)
+
+	t.eventuallyObjectContents("foo", "burrito")
+	fi, err := os.Stat(path.Join(mntDir, "foo"))
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), int64(len("burrito")), fi.Size())
+}
+
+func (t *WriteBackTest) TestRenameRightAfterClose() {
+	err := os.WriteFile(path.Join(mntDir, "foo"), []byte("taco"), filePerms)
+	require.NoError(t.T(), err)
+
+	err = os.Rename(path.Join(mntDir, "foo"), path.Join(mntDir, "bar"))
+
+	require.NoError(t.T(), err)
+	t.eventuallyObjectContents("bar", "taco")
+	_, err = storageutil.ReadObject(ctx, bucket, "foo")
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
+
+func (t *WriteBackTest) TestUnlinkRightAfterClose() {
+	err := os.WriteFile(path.Join(mntDir, "foo"), []byte("taco"), filePerms)
+	require.NoError(t.T(), err)
+
+	err = os.Remove(path.Join(mntDir, "foo"))
+
+	require.NoError(t.T(), err)
+	_, err = storageutil.ReadObject(ctx, bucket, "foo")
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
+
+func (t *WriteBackTest) TestFsyncWaitsForWriteBack() {
+	f, err := os.Create(path.Join(mntDir, "foo"))
+	require.NoError(t.T(), err)
+	t.f1 = f
+	_, err = f.Write([]byte("taco"))
+	require.NoError(t.T(), err)
+	// Closing a duplicate of the descriptor flushes the file.
+	dup, err := os.Open(path.Join(mntDir, "foo"))
+	require.NoError(t.T(), err)
+	require.NoError(t.T(), dup.Close())
+
+	err = f.Sync()
+
+	require.NoError(t.T(), err)
+	contents, err := storageutil.ReadObject(ctx, bucket, "foo")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", string(contents))
+}
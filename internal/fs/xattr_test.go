@@ -0,0 +1,168 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs_test
+
+import (
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	. "github.com/jacobsa/oglematchers"
+	. "github.com/jacobsa/ogletest"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+type XattrTest struct {
+	fsTest
+}
+
+func init() {
+	RegisterTestSuite(&XattrTest{})
+}
+
+////////////////////////////////////////////////////////////////////////
+// Helpers
+////////////////////////////////////////////////////////////////////////
+
+func getxattr(p string, name string) (string, error) {
+	buf := make([]byte, 1024)
+	n, err := syscall.Getxattr(p, name, buf)
+	if err != nil {
+		return "", err
+	}
+
+	return string(buf[:n]), nil
+}
+
+func listxattr(p string) ([]string, error) {
+	buf := make([]byte, 4096)
+	n, err := syscall.Listxattr(p, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Split(strings.TrimSuffix(string(buf[:n]), "\x00"), "\x00"), nil
+}
+
+func (t *XattrTest) createWithMetadata(name string, metadata map[string]string) *gcs.Object {
+	o, err := bucket.CreateObject(ctx, &gcs.CreateObjectRequest{
+		Name:        name,
+		ContentType: "text/plain",
+		Metadata:    metadata,
+		Contents:    strings.NewReader("taco"),
+	})
+	AssertEq(nil, err)
+
+	return o
+}
+
+////////////////////////////////////////////////////////////////////////
+// Tests
+////////////////////////////////////////////////////////////////////////
+
+func (t *XattrTest) GetXattr_File() {
+	o := t.createWithMetadata("foo", map[string]string{"color": "red"})
+
+	generation, err := getxattr(path.Join(mntDir, "foo"), "gcs.generation")
+	AssertEq(nil, err)
+	ExpectEq(strconv.FormatInt(o.Generation, 10), generation)
+
+	contentType, err := getxattr(path.Join(mntDir, "foo"), "gcs.content_type")
+	AssertEq(nil, err)
+	ExpectEq("text/plain", contentType)
+
+	color, err := getxattr(path.Join(mntDir, "foo"), "user.color")
+	AssertEq(nil, err)
+	ExpectEq("red", color)
+}
+
+func (t *XattrTest) GetXattr_Missing() {
+	t.createWithMetadata("foo", nil)
+
+	_, err := getxattr(path.Join(mntDir, "foo"), "user.color")
+
+	ExpectEq(syscall.ENODATA, err)
+}
+
+func (t *XattrTest) GetXattr_SizeQuery() {
+	t.createWithMetadata("foo", map[string]string{"color": "red"})
+
+	n, err := syscall.Getxattr(path.Join(mntDir, "foo"), "user.color", nil)
+
+	AssertEq(nil, err)
+	ExpectEq(len("red"), n)
+}
+
+func (t *XattrTest) ListXattr_File() {
+	t.createWithMetadata("foo", map[string]string{"color": "red"})
+
+	names, err := listxattr(path.Join(mntDir, "foo"))
+
+	AssertEq(nil, err)
+	ExpectThat(names, Contains("gcs.generation"))
+	ExpectThat(names, Contains("gcs.metageneration"))
+	ExpectThat(names, Contains("gcs.crc32c"))
+	ExpectThat(names, Contains("gcs.md5"))
+	ExpectThat(names, Contains("gcs.metadata.color"))
+	ExpectThat(names, Contains("user.color"))
+}
+
+func (t *XattrTest) SetXattr_File() {
+	t.createWithMetadata("foo", nil)
+
+	err := syscall.Setxattr(path.Join(mntDir, "foo"), "user.color", []byte("blue"), 0)
+	AssertEq(nil, err)
+
+	m, _, err := bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: "foo"})
+	AssertEq(nil, err)
+	ExpectEq("blue", m.Metadata["color"])
+	ExpectEq(2, m.MetaGeneration)
+}
+
+func (t *XattrTest) SetXattr_ReadOnlyNamespace() {
+	t.createWithMetadata("foo", nil)
+
+	err := syscall.Setxattr(path.Join(mntDir, "foo"), "gcs.generation", []byte("1"), 0)
+
+	ExpectEq(syscall.EPERM, err)
+}
+
+func (t *XattrTest) RemoveXattr_File() {
+	t.createWithMetadata("foo", map[string]string{"color": "red"})
+
+	err := syscall.Removexattr(path.Join(mntDir, "foo"), "user.color")
+	AssertEq(nil, err)
+
+	m, _, err := bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: "foo"})
+	AssertEq(nil, err)
+	_, ok := m.Metadata["color"]
+	ExpectFalse(ok)
+}
+
+func (t *XattrTest) SetXattr_ExplicitDir() {
+	t.createWithMetadata("dir/", nil)
+
+	err := syscall.Setxattr(path.Join(mntDir, "dir"), "user.owner", []byte("build"), 0)
+	AssertEq(nil, err)
+
+	owner, err := getxattr(path.Join(mntDir, "dir"), "user.owner")
+	AssertEq(nil, err)
+	ExpectEq("build", owner)
+}
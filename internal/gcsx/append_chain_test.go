@@ -0,0 +1,71 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+// Appending to an object many more times than it may have components, as a log
+// file fsynced after every line would. The fake bucket refuses composes over
+// the limit, so every sync succeeding shows that the chain is flattened in
+// time.
+func TestAppendChainStaysUnderComponentLimit(t *testing.T) {
+	ctx := context.Background()
+	bucket := fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical)
+	metricHandle := &fakeSyncMetricHandle{MetricHandle: common.NewNoopMetrics()}
+	syncer := NewSyncer(1, chunkTransferTimeoutSecs, "tmp/", nil, bucket, metricHandle)
+	expected := []byte("a")
+	o, err := storageutil.CreateObject(ctx, bucket, "foo", expected)
+	require.NoError(t, err)
+
+	const appends = gcs.MaxComponentCount + 100
+	for i := 0; i < appends; i++ {
+		content, err := NewTempFile(io.NopCloser(bytes.NewReader(expected)), "", timeutil.RealClock())
+		require.NoError(t, err)
+		_, err = content.WriteAt([]byte("b"), int64(len(expected)))
+		require.NoError(t, err)
+
+		o, err = syncer.SyncObject(ctx, "foo", o, content)
+		content.Destroy()
+
+		require.NoError(t, err, "sync %d", i)
+		require.LessOrEqual(t, o.ComponentCount, int64(gcs.MaxComponentCount))
+		expected = append(expected, 'b')
+	}
+
+	contents, err := storageutil.ReadObject(ctx, bucket, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, expected, contents)
+	strategyCounts := make(map[string]int)
+	for _, strategy := range metricHandle.strategies {
+		strategyCounts[strategy]++
+	}
+	assert.Equal(t, map[string]int{
+		syncStrategyAppend:  appends - 1,
+		syncStrategyFlatten: 1,
+	}, strategyCounts)
+}
@@ -21,13 +21,16 @@ import (
 	"io"
 	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
 	"golang.org/x/net/context"
 )
 
 // Create an objectCreator that accepts a source object and the contents that
 // should be "appended" to it, storing temporary objects using the supplied
-// prefix.
+// prefix. The attributes that the composed object would otherwise lack are
+// taken from objectDefaults.
 //
 // Note that the Create method will attempt to remove any temporary junk left
 // behind, but it may fail to do so. Users should arrange for garbage collection.
@@ -36,10 +39,12 @@ import (
 // has been clobbered.
 func newAppendObjectCreator(
 	prefix string,
+	objectDefaults []cfg.ObjectDefaults,
 	bucket gcs.Bucket) (oc objectCreator) {
 	oc = &appendObjectCreator{
-		prefix: prefix,
-		bucket: bucket,
+		prefix:         prefix,
+		objectDefaults: objectDefaults,
+		bucket:         bucket,
 	}
 
 	return
@@ -50,8 +55,9 @@ func newAppendObjectCreator(
 ////////////////////////////////////////////////////////////////////////
 
 type appendObjectCreator struct {
-	prefix string
-	bucket gcs.Bucket
+	prefix         string
+	objectDefaults []cfg.ObjectDefaults
+	bucket         gcs.Bucket
 }
 
 func (oc *appendObjectCreator) chooseName() (name string, err error) {
@@ -85,7 +91,9 @@ func (oc *appendObjectCreator) Create(
 	ctx context.Context,
 	objectName string,
 	srcObject *gcs.Object,
+	metadata map[string]string,
 	mtime *time.Time,
+	crc32c *uint32,
 	chunkTransferTimeoutSecs int64,
 	r io.Reader) (o *gcs.Object, err error) {
 	// Choose a name for a temporary object.
@@ -130,38 +138,42 @@ func (oc *appendObjectCreator) Create(
 	for key, value := range srcObject.Metadata {
 		MetadataMap[key] = value
 	}
+	for key, value := range metadata {
+		MetadataMap[key] = value
+	}
 
 	if mtime != nil {
 		MetadataMap[MtimeMetadataKey] = mtime.UTC().Format(time.RFC3339Nano)
 	}
 
 	// Compose the old contents plus the new over the old.
-	o, err = oc.bucket.ComposeObjects(
-		ctx,
-		&gcs.ComposeObjectsRequest{
-			DstName:                       srcObject.Name,
-			DstGenerationPrecondition:     &srcObject.Generation,
-			DstMetaGenerationPrecondition: &srcObject.MetaGeneration,
-			Sources: []gcs.ComposeSource{
-				gcs.ComposeSource{
-					Name:       srcObject.Name,
-					Generation: srcObject.Generation,
-				},
-
-				gcs.ComposeSource{
-					Name:       tmp.Name,
-					Generation: tmp.Generation,
-				},
+	req := &gcs.ComposeObjectsRequest{
+		DstName:                       srcObject.Name,
+		DstGenerationPrecondition:     &srcObject.Generation,
+		DstMetaGenerationPrecondition: &srcObject.MetaGeneration,
+		Sources: []gcs.ComposeSource{
+			gcs.ComposeSource{
+				Name:       srcObject.Name,
+				Generation: srcObject.Generation,
 			},
-			Metadata:           MetadataMap,
-			CacheControl:       srcObject.CacheControl,
-			ContentDisposition: srcObject.ContentDisposition,
-			ContentEncoding:    srcObject.ContentEncoding,
-			ContentType:        srcObject.ContentType,
-			CustomTime:         srcObject.CustomTime,
-			EventBasedHold:     srcObject.EventBasedHold,
-			StorageClass:       srcObject.StorageClass,
-		})
+
+			gcs.ComposeSource{
+				Name:       tmp.Name,
+				Generation: tmp.Generation,
+			},
+		},
+		Metadata:           MetadataMap,
+		CacheControl:       srcObject.CacheControl,
+		ContentDisposition: srcObject.ContentDisposition,
+		ContentEncoding:    srcObject.ContentEncoding,
+		ContentType:        srcObject.ContentType,
+		CustomTime:         srcObject.CustomTime,
+		EventBasedHold:     srcObject.EventBasedHold,
+		StorageClass:       srcObject.StorageClass,
+	}
+	storageutil.ApplyComposeObjectDefaults(oc.objectDefaults, req)
+
+	o, err = oc.bucket.ComposeObjects(ctx, req)
 	if err != nil {
 		// A not found error means that either the source object was clobbered or the
 		// temporary object was. The latter is unlikely, so we signal a precondition
@@ -177,5 +189,6 @@ func (oc *appendObjectCreator) Create(
 		return
 	}
 
+	err = checkCRC32C(o, crc32c)
 	return
 }
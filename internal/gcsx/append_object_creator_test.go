@@ -71,6 +71,7 @@ type AppendObjectCreatorTest struct {
 	srcObject   gcs.Object
 	srcContents string
 	mtime       time.Time
+	crc32c      *uint32
 }
 
 var _ SetUpInterface = &AppendObjectCreatorTest{}
@@ -84,7 +85,7 @@ func (t *AppendObjectCreatorTest) SetUp(ti *TestInfo) {
 	t.bucket = storage.NewMockBucket(ti.MockController, "bucket")
 
 	// Create the creator.
-	t.creator = newAppendObjectCreator(prefix, t.bucket)
+	t.creator = newAppendObjectCreator(prefix, nil, t.bucket)
 }
 
 func (t *AppendObjectCreatorTest) call() (o *gcs.Object, err error) {
@@ -92,7 +93,9 @@ func (t *AppendObjectCreatorTest) call() (o *gcs.Object, err error) {
 		t.ctx,
 		t.srcObject.Name,
 		&t.srcObject,
+		nil,
 		&t.mtime,
+		t.crc32c,
 		chunkTransferTimeoutSecs,
 		strings.NewReader(t.srcContents))
 
@@ -350,6 +353,37 @@ func (t *AppendObjectCreatorTest) ComposeObjectsReturnsNotFoundError() {
 	ExpectThat(err, Error(HasSubstr("taco")))
 }
 
+func (t *AppendObjectCreatorTest) ComposedObjectHasWrongCRC32C() {
+	crc := uint32(17)
+	t.crc32c = &crc
+
+	// CreateObject
+	tmpObject := &gcs.Object{
+		Name: "bar",
+	}
+
+	ExpectCall(t.bucket, "CreateObject")(Any(), Any()).
+		WillOnce(Return(tmpObject, nil))
+
+	// ComposeObjects
+	composedCRC := uint32(19)
+	composed := &gcs.Object{Name: "foo", CRC32C: &composedCRC}
+	ExpectCall(t.bucket, "ComposeObjects")(Any(), Any()).
+		WillOnce(Return(composed, nil))
+
+	// DeleteObject
+	ExpectCall(t.bucket, "DeleteObject")(Any(), deleteReqName(tmpObject.Name)).
+		WillOnce(Return(nil))
+
+	// Call
+	_, err := t.call()
+
+	var checksumErr *gcs.ChecksumMismatchError
+	ExpectTrue(errors.As(err, &checksumErr))
+	ExpectThat(err, Error(HasSubstr("0x00000013")))
+	ExpectThat(err, Error(HasSubstr("0x00000011")))
+}
+
 func (t *AppendObjectCreatorTest) CallsDeleteObject() {
 	// CreateObject
 	tmpObject := &gcs.Object{
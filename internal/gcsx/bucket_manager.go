@@ -18,9 +18,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"path"
+	"syscall"
 	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
 	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
@@ -62,14 +65,50 @@ type BucketConfig struct {
 	AppendThreshold          int64
 	ChunkTransferTimeoutSecs int64
 	TmpObjectPrefix          string
+
+	// The project whose buckets are listed in a mount of all buckets. Listing
+	// is not supported if empty.
+	ListBucketsProject string
+
+	// Glob patterns restricting the buckets a mount of all buckets lists and
+	// sets up. A bucket must match one of BucketAllow, if any are given, and
+	// none of BucketDeny.
+	BucketAllow []string
+	BucketDeny  []string
+
+	// If non-nil, the contents of objects are encrypted on the client with data
+	// keys wrapped by KeyWrapper. See NewEncryptingBucket.
+	KeyWrapper KeyWrapper
+
+	// The rules choosing the objects whose contents are compressed, and with
+	// which codec. See NewCompressingBucket.
+	CompressionRules []cfg.CompressionRule
+
+	// The attributes of new objects by their names, see NewSyncer.
+	ObjectDefaults []cfg.ObjectDefaults
+
+	// Content types by extension taking precedence over those known to the
+	// system, and whether to guess the types of others from their contents.
+	// See NewContentTypeBucket.
+	MimeTypes        map[string]string
+	SniffContentType bool
 }
 
+// ErrBucketNotAllowed is returned when setting up a bucket that the allow and
+// deny lists of a mount of all buckets exclude.
+var ErrBucketNotAllowed = errors.New("bucket is excluded by the allow and deny lists")
+
 // BucketManager manages the lifecycle of buckets.
 type BucketManager interface {
 	SetUpBucket(
 		ctx context.Context,
 		name string, isMultibucketMount bool, metricHandle common.MetricHandle) (b SyncerBucket, err error)
 
+	// ListBuckets returns the names of the buckets of the configured project
+	// that pass the allow and deny lists, failing with syscall.ENOTSUP if no
+	// project is configured.
+	ListBuckets(ctx context.Context) (names []string, err error)
+
 	// Shuts down the bucket manager and its buckets
 	ShutDown()
 }
@@ -159,6 +198,11 @@ func (bm *bucketManager) SetUpBucket(
 	isMultibucketMount bool,
 	metricHandle common.MetricHandle,
 ) (sb SyncerBucket, err error) {
+	if isMultibucketMount && !bm.isBucketAllowed(name) {
+		err = fmt.Errorf("%q: %w", name, ErrBucketNotAllowed)
+		return
+	}
+
 	var b gcs.Bucket
 	// Set up the appropriate backing bucket.
 	if name == canned.FakeBucketName {
@@ -211,8 +255,21 @@ func (bm *bucketManager) SetUpBucket(
 			b)
 	}
 
+	// Enable client-side encryption, if requested. Composing encrypted objects
+	// rewrites them, so appending to them that way gains nothing.
+	appendThreshold := bm.config.AppendThreshold
+	if bm.config.KeyWrapper != nil {
+		b = NewEncryptingBucket(bm.config.KeyWrapper, b)
+		appendThreshold = math.MaxInt64
+	}
+
+	// Compress contents before they are encrypted, if requested.
+	if len(bm.config.CompressionRules) > 0 {
+		b = NewCompressingBucket(bm.config.CompressionRules, b)
+	}
+
 	// Enable content type awareness
-	b = NewContentTypeBucket(b)
+	b = NewContentTypeBucket(b, bm.config.MimeTypes, bm.config.SniffContentType)
 
 	// Enable Syncer
 	if bm.config.TmpObjectPrefix == "" {
@@ -220,10 +277,12 @@ func (bm *bucketManager) SetUpBucket(
 		return
 	}
 	sb = NewSyncerBucket(
-		bm.config.AppendThreshold,
+		appendThreshold,
 		bm.config.ChunkTransferTimeoutSecs,
 		bm.config.TmpObjectPrefix,
-		b)
+		bm.config.ObjectDefaults,
+		b,
+		metricHandle)
 
 	// Fetch bucket type from storage layout api and set bucket type.
 	b.BucketType()
@@ -243,6 +302,49 @@ func (bm *bucketManager) SetUpBucket(
 	return
 }
 
+func (bm *bucketManager) ListBuckets(ctx context.Context) (names []string, err error) {
+	if bm.config.ListBucketsProject == "" {
+		err = fmt.Errorf("listing buckets requires a project: %w", syscall.ENOTSUP)
+		return
+	}
+
+	all, err := bm.storageHandle.ListBuckets(ctx, bm.config.ListBucketsProject)
+	if err != nil {
+		err = fmt.Errorf("ListBuckets: %w", err)
+		return
+	}
+
+	for _, name := range all {
+		if bm.isBucketAllowed(name) {
+			names = append(names, name)
+		}
+	}
+
+	return
+}
+
+// isBucketAllowed tells whether the allow and deny lists let a mount of all
+// buckets show the named bucket.
+func (bm *bucketManager) isBucketAllowed(name string) bool {
+	for _, pattern := range bm.config.BucketDeny {
+		if matched, _ := path.Match(pattern, name); matched {
+			return false
+		}
+	}
+
+	if len(bm.config.BucketAllow) == 0 {
+		return true
+	}
+
+	for _, pattern := range bm.config.BucketAllow {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (bm *bucketManager) ShutDown() {
 	bm.stopGarbageCollecting()
 }
@@ -16,12 +16,16 @@ package gcsx
 
 import (
 	"context"
+	"errors"
+	"sort"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	. "github.com/jacobsa/oglematchers"
 	. "github.com/jacobsa/ogletest"
 )
 
@@ -171,3 +175,54 @@ func (t *BucketManagerTest) TestSetUpBucketMethodWhenBucketDoesNotExist_IsMultiB
 	ExpectEq("error in iterating through objects: storage: bucket doesn't exist", err.Error())
 	ExpectNe(nil, bucket.Syncer)
 }
+
+func (t *BucketManagerTest) TestSetUpBucketMethod_BucketDenied() {
+	var bm bucketManager
+	ctx := context.Background()
+	bm.storageHandle = t.storageHandle
+	bm.config = BucketConfig{
+		TmpObjectPrefix: "TmpObjectPrefix",
+		BucketDeny:      []string{"gcsfuse-default-*"},
+	}
+	bm.gcCtx = ctx
+
+	_, err := bm.SetUpBucket(ctx, TestBucketName, true, common.NewNoopMetrics())
+
+	ExpectTrue(errors.Is(err, ErrBucketNotAllowed))
+}
+
+func (t *BucketManagerTest) TestListBucketsMethod() {
+	var bm bucketManager
+	bm.storageHandle = t.storageHandle
+	bm.config = BucketConfig{ListBucketsProject: "project"}
+
+	names, err := bm.ListBuckets(context.Background())
+
+	AssertEq(nil, err)
+	sort.Strings(names)
+	ExpectThat(names, ElementsAre(TestBucketName, storage.TestEmptyBucketName))
+}
+
+func (t *BucketManagerTest) TestListBucketsMethod_AllowAndDeny() {
+	var bm bucketManager
+	bm.storageHandle = t.storageHandle
+	bm.config = BucketConfig{
+		ListBucketsProject: "project",
+		BucketAllow:        []string{"gcsfuse-*"},
+		BucketDeny:         []string{"*-empty-*"},
+	}
+
+	names, err := bm.ListBuckets(context.Background())
+
+	AssertEq(nil, err)
+	ExpectThat(names, ElementsAre(TestBucketName))
+}
+
+func (t *BucketManagerTest) TestListBucketsMethod_NoProject() {
+	var bm bucketManager
+	bm.storageHandle = t.storageHandle
+
+	_, err := bm.ListBuckets(context.Background())
+
+	ExpectTrue(errors.Is(err, syscall.ENOTSUP))
+}
@@ -0,0 +1,1121 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"strconv"
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"golang.org/x/net/context"
+)
+
+// Objects written through a compressing bucket hold their contents split into
+// frames of compressionFrameSize bytes, each compressed on its own so that
+// ranges can be read without decompressing what comes before them. The frames
+// are followed by an index holding the compressed length of each as a
+// big-endian uint32, and a footer holding the size of the contents as a
+// big-endian uint64, the number of frames as a big-endian uint32 and
+// compressionMagic. The codec and, when known up front, the size of the
+// contents are recorded in the metadata too.
+const (
+	compressionMetadataKey     = "gcsfuse_compression"
+	compressionSizeMetadataKey = "gcsfuse_compression_size"
+
+	compressionFrameSize  = 256 << 10
+	compressionFooterSize = 16
+	compressionMagic      = "GCZ1"
+)
+
+// The number of layouts of compressed objects kept, so that statting them
+// again doesn't need them read again.
+const maxCachedCompressedLayouts = 4096
+
+// NewCompressingBucket creates a wrapper bucket that compresses the contents
+// of the objects it creates whose names match one of the rules, with the codec
+// of the first one, and decompresses those of compressed objects it reads.
+// Objects stored with Content-Encoding gzip are decompressed too.
+//
+// Sizes, checksums and metadata of compressed objects are reported as those
+// of their contents, except that their CRC32C and MD5 are only known for the
+// objects just created. The size of an object stored with Content-Encoding
+// gzip is taken from the end of its data, which records it modulo 4 GiB for
+// the last stream only, unless that is less than the data can hold, in which
+// case the data is decompressed to count it. Listings don't read the data, so
+// they report the size of the data of such objects, and of compressed objects
+// created without their size recorded, unless it has been read before.
+// Composing compressed objects rewrites them.
+func NewCompressingBucket(rules []cfg.CompressionRule, wrapped gcs.Bucket) gcs.Bucket {
+	return &compressingBucket{
+		Bucket:  wrapped,
+		rules:   rules,
+		layouts: make(map[layoutKey]*compressedLayout),
+	}
+}
+
+type compressingBucket struct {
+	gcs.Bucket
+	rules []cfg.CompressionRule
+
+	mu sync.Mutex
+	// The layouts of compressed objects that had to be read to be known.
+	//
+	// GUARDED_BY(mu)
+	layouts map[layoutKey]*compressedLayout
+}
+
+type layoutKey struct {
+	name       string
+	generation int64
+}
+
+// compressedLayout describes the data of a compressed object.
+type compressedLayout struct {
+	// The size of the contents.
+	size uint64
+
+	// The offsets of the frames in the data, followed by that of the index.
+	// Missing for objects stored with Content-Encoding gzip, and for objects
+	// whose size was known without reading them.
+	frameOffsets []uint64
+}
+
+////////////////////////////////////////////////////////////////////////
+// Format
+////////////////////////////////////////////////////////////////////////
+
+type compressionKind int
+
+const (
+	notCompressed compressionKind = iota
+	framesCompressed
+	gzipEncoded
+)
+
+func compressionKindOf(m *gcs.MinObject) compressionKind {
+	switch {
+	case m.Metadata[compressionMetadataKey] != "":
+		return framesCompressed
+	case m.HasContentEncodingGzip():
+		return gzipEncoded
+	default:
+		return notCompressed
+	}
+}
+
+func withoutCompressionMetadata(metadata map[string]string) map[string]string {
+	m := maps.Clone(metadata)
+	delete(m, compressionMetadataKey)
+	delete(m, compressionSizeMetadataKey)
+	return m
+}
+
+func compressedFrameCount(size uint64) uint64 {
+	return (size + compressionFrameSize - 1) / compressionFrameSize
+}
+
+func (b *compressingBucket) codecFor(name string) (codecName string, codec compressionCodec) {
+	for _, r := range b.rules {
+		if r.Matches(name) {
+			return r.Codec, compressionCodecs[r.Codec]
+		}
+	}
+	return
+}
+
+func objectCodec(m *gcs.MinObject) (codec compressionCodec, err error) {
+	codec, ok := compressionCodecs[m.Metadata[compressionMetadataKey]]
+	if !ok {
+		err = fmt.Errorf("object %q is compressed with unsupported codec %q", m.Name, m.Metadata[compressionMetadataKey])
+		return
+	}
+	return
+}
+
+// readCompressed reads the given range of the data of an object.
+func (b *compressingBucket) readCompressed(
+	ctx context.Context,
+	m *gcs.MinObject,
+	start uint64,
+	limit uint64) (data []byte, err error) {
+	rc, err := b.Bucket.NewReader(ctx, &gcs.ReadObjectRequest{
+		Name:           m.Name,
+		Generation:     m.Generation,
+		Range:          &gcs.ByteRange{Start: start, Limit: limit},
+		ReadCompressed: true,
+	})
+	if err != nil {
+		err = fmt.Errorf("NewReader: %w", err)
+		return
+	}
+	defer rc.Close()
+
+	data = make([]byte, limit-start)
+	if _, err = io.ReadFull(rc, data); err != nil {
+		err = fmt.Errorf("reading %q: %w", m.Name, err)
+		return
+	}
+
+	return
+}
+
+// readFrameOffsets reads the index of a compressed object.
+func (b *compressingBucket) readFrameOffsets(
+	ctx context.Context,
+	m *gcs.MinObject) (l *compressedLayout, err error) {
+	if m.Size < compressionFooterSize {
+		err = fmt.Errorf("compressed object %q is truncated", m.Name)
+		return
+	}
+
+	// Read the index along with the footer if its length follows from the
+	// size recorded in the metadata.
+	tailSize := uint64(compressionFooterSize)
+	if size, err := strconv.ParseUint(m.Metadata[compressionSizeMetadataKey], 10, 64); err == nil {
+		tailSize = min(m.Size, compressionFooterSize+4*compressedFrameCount(size))
+	}
+
+	tail, err := b.readCompressed(ctx, m, m.Size-tailSize, m.Size)
+	if err != nil {
+		return
+	}
+
+	footer := tail[len(tail)-compressionFooterSize:]
+	size := binary.BigEndian.Uint64(footer[0:8])
+	frames := uint64(binary.BigEndian.Uint32(footer[8:12]))
+	if string(footer[12:]) != compressionMagic || frames != compressedFrameCount(size) {
+		err = fmt.Errorf("compressed object %q has a malformed footer", m.Name)
+		return
+	}
+
+	indexSize := 4 * frames
+	if compressionFooterSize+indexSize > m.Size {
+		err = fmt.Errorf("compressed object %q is truncated", m.Name)
+		return
+	}
+	if uint64(len(tail)) < compressionFooterSize+indexSize {
+		tail, err = b.readCompressed(ctx, m, m.Size-compressionFooterSize-indexSize, m.Size)
+		if err != nil {
+			return
+		}
+	}
+
+	index := tail[uint64(len(tail))-compressionFooterSize-indexSize : uint64(len(tail))-compressionFooterSize]
+	l = &compressedLayout{size: size, frameOffsets: make([]uint64, frames+1)}
+	for i := uint64(0); i < frames; i++ {
+		l.frameOffsets[i+1] = l.frameOffsets[i] + uint64(binary.BigEndian.Uint32(index[4*i:]))
+	}
+
+	if l.frameOffsets[frames] != m.Size-compressionFooterSize-indexSize {
+		err = fmt.Errorf("compressed object %q has a malformed index", m.Name)
+		return
+	}
+
+	return
+}
+
+// minGzipContentsSize returns the least size of the contents of gzip data of
+// the given size, which is no larger than the contents stored in blocks of up
+// to 65535 bytes with 5 bytes of framing each, after a 10 byte header and
+// before an 8 byte trailer.
+func minGzipContentsSize(size uint64) uint64 {
+	const overhead = 18
+	if size <= overhead {
+		return 0
+	}
+
+	blocks := (size - overhead + 65539) / 65540
+	return size - overhead - 5*blocks
+}
+
+// countGzipSize decompresses the data of an object stored with
+// Content-Encoding gzip to count the size of its contents.
+func (b *compressingBucket) countGzipSize(
+	ctx context.Context,
+	m *gcs.MinObject) (size uint64, err error) {
+	rc, err := b.Bucket.NewReader(ctx, &gcs.ReadObjectRequest{
+		Name:           m.Name,
+		Generation:     m.Generation,
+		ReadCompressed: true,
+	})
+	if err != nil {
+		err = fmt.Errorf("NewReader: %w", err)
+		return
+	}
+	defer rc.Close()
+
+	zr, err := gzip.NewReader(rc)
+	if err != nil {
+		err = fmt.Errorf("gzip-encoded object %q: %w", m.Name, err)
+		return
+	}
+
+	n, err := io.Copy(io.Discard, zr)
+	if err != nil {
+		err = fmt.Errorf("gzip-encoded object %q: %w", m.Name, err)
+		return
+	}
+
+	size = uint64(n)
+	return
+}
+
+// readGzipSize reads the size of the contents of an object stored with
+// Content-Encoding gzip from the end of its data, where it's recorded modulo
+// 2^32 for the last stream. The data is decompressed to count the size if the
+// recorded one can't be right.
+func (b *compressingBucket) readGzipSize(
+	ctx context.Context,
+	m *gcs.MinObject) (l *compressedLayout, err error) {
+	l = &compressedLayout{}
+	if m.Size == 0 {
+		return
+	}
+
+	if m.Size < 4 {
+		err = fmt.Errorf("gzip-encoded object %q is truncated", m.Name)
+		return
+	}
+
+	trailer, err := b.readCompressed(ctx, m, m.Size-4, m.Size)
+	if err != nil {
+		return
+	}
+
+	l.size = uint64(binary.LittleEndian.Uint32(trailer))
+	if l.size < minGzipContentsSize(m.Size) {
+		l.size, err = b.countGzipSize(ctx, m)
+	}
+
+	return
+}
+
+// knownLayout returns the layout of a compressed object, with its frame
+// offsets if they are needed, if it is known without reading the data. It
+// returns nil otherwise.
+func (b *compressingBucket) knownLayout(m *gcs.MinObject, needFrames bool) *compressedLayout {
+	if compressionKindOf(m) == framesCompressed && !needFrames {
+		if size, err := strconv.ParseUint(m.Metadata[compressionSizeMetadataKey], 10, 64); err == nil {
+			return &compressedLayout{size: size}
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.layouts[layoutKey{m.Name, m.Generation}]
+}
+
+// layout returns the layout of a compressed object, with its frame offsets if
+// they are needed.
+func (b *compressingBucket) layout(
+	ctx context.Context,
+	m *gcs.MinObject,
+	needFrames bool) (l *compressedLayout, err error) {
+	if l = b.knownLayout(m, needFrames); l != nil {
+		return
+	}
+
+	key := layoutKey{m.Name, m.Generation}
+	if compressionKindOf(m) == gzipEncoded {
+		l, err = b.readGzipSize(ctx, m)
+	} else {
+		l, err = b.readFrameOffsets(ctx, m)
+	}
+	if err != nil {
+		return
+	}
+
+	b.rememberLayout(key, l)
+	return
+}
+
+func (b *compressingBucket) rememberLayout(key layoutKey, l *compressedLayout) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.layouts) >= maxCachedCompressedLayouts {
+		clear(b.layouts)
+	}
+	b.layouts[key] = l
+}
+
+// plaintextMinObject returns the object as it is seen through the bucket.
+func (b *compressingBucket) plaintextMinObject(
+	ctx context.Context,
+	m *gcs.MinObject) (pm *gcs.MinObject, err error) {
+	if m == nil || compressionKindOf(m) == notCompressed {
+		pm = m
+		return
+	}
+
+	l, err := b.layout(ctx, m, false)
+	if err != nil {
+		return
+	}
+
+	pm = plaintextMinObjectOfSize(m, l.size)
+	return
+}
+
+// listedMinObject returns the object as it is listed through the bucket. Its
+// size is that of the contents if that is known without reading the data, and
+// the size of the data otherwise.
+func (b *compressingBucket) listedMinObject(m *gcs.MinObject) *gcs.MinObject {
+	if m == nil || compressionKindOf(m) == notCompressed {
+		return m
+	}
+
+	if l := b.knownLayout(m, false); l != nil {
+		return plaintextMinObjectOfSize(m, l.size)
+	}
+
+	if recorded := m.Metadata[compressionSizeMetadataKey]; recorded != "" {
+		logger.Warnf("Compressed object %q records a malformed size %q, listing the size of its data", m.Name, recorded)
+	}
+	return plaintextMinObjectOfSize(m, m.Size)
+}
+
+// plaintextMinObjectOfSize returns a copy of the compressed object m without
+// its compression metadata and checksum, and of the given size.
+func plaintextMinObjectOfSize(m *gcs.MinObject, size uint64) *gcs.MinObject {
+	c := *m
+	c.Size = size
+	c.Metadata = withoutCompressionMetadata(m.Metadata)
+	c.ContentEncoding = ""
+	c.CRC32C = nil
+	return &c
+}
+
+// plaintextObject returns the object as it is seen through the bucket, given
+// the checksums of its contents if known.
+func (b *compressingBucket) plaintextObject(
+	ctx context.Context,
+	o *gcs.Object,
+	sums *plaintextChecksums) (po *gcs.Object, err error) {
+	if o == nil {
+		return
+	}
+
+	m := storageutil.ConvertObjToMinObject(o)
+	if compressionKindOf(m) == notCompressed {
+		po = o
+		return
+	}
+
+	c := *o
+	c.Metadata = withoutCompressionMetadata(o.Metadata)
+	c.ContentEncoding = ""
+	c.CRC32C = nil
+	c.MD5 = nil
+	if sums != nil {
+		crc := sums.crc
+		c.Size = sums.size
+		c.CRC32C = &crc
+		po = &c
+		return
+	}
+
+	l, err := b.layout(ctx, m, false)
+	if err != nil {
+		return
+	}
+
+	c.Size = l.size
+	po = &c
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Writing
+////////////////////////////////////////////////////////////////////////
+
+// frameCompressor compresses plaintext frame by frame, keeping track of the
+// compressed lengths for the index, and of the checksums of the plaintext.
+type frameCompressor struct {
+	codec   compressionCodec
+	lengths []uint32
+	sums    plaintextChecksums
+}
+
+func (c *frameCompressor) compress(dst []byte, frame []byte) ([]byte, error) {
+	c.sums.update(frame)
+
+	out, err := c.codec.encode(dst, frame)
+	if err != nil {
+		return dst, err
+	}
+
+	c.lengths = append(c.lengths, uint32(len(out)-len(dst)))
+	return out, nil
+}
+
+// layout returns the layout of the data compressed so far, once it's all
+// been compressed.
+func (c *frameCompressor) layout() *compressedLayout {
+	l := &compressedLayout{size: c.sums.size, frameOffsets: make([]uint64, len(c.lengths)+1)}
+	for i, n := range c.lengths {
+		l.frameOffsets[i+1] = l.frameOffsets[i] + uint64(n)
+	}
+	return l
+}
+
+// appendIndex appends the index and the footer to dst.
+func (c *frameCompressor) appendIndex(dst []byte) []byte {
+	for _, l := range c.lengths {
+		dst = binary.BigEndian.AppendUint32(dst, l)
+	}
+
+	dst = binary.BigEndian.AppendUint64(dst, c.sums.size)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(c.lengths)))
+	return append(dst, compressionMagic...)
+}
+
+// newCompressor returns a compressor for the contents of a new object, along
+// with a copy of the request that records the codec and, if known, the size
+// of the contents, and has their checksums removed.
+func newCompressor(
+	req *gcs.CreateObjectRequest,
+	codecName string,
+	codec compressionCodec,
+	size *uint64) (c *frameCompressor, mReq *gcs.CreateObjectRequest) {
+	mReq = new(gcs.CreateObjectRequest)
+	*mReq = *req
+	mReq.Metadata = withoutCompressionMetadata(req.Metadata)
+	if mReq.Metadata == nil {
+		mReq.Metadata = make(map[string]string)
+	}
+	mReq.Metadata[compressionMetadataKey] = codecName
+	if size != nil {
+		mReq.Metadata[compressionSizeMetadataKey] = strconv.FormatUint(*size, 10)
+	}
+	mReq.CRC32C = nil
+	mReq.MD5 = nil
+
+	c = &frameCompressor{codec: codec, sums: newPlaintextChecksums()}
+	return
+}
+
+// compressingReader compresses the plaintext read from r.
+type compressingReader struct {
+	r          io.Reader
+	compressor *frameCompressor
+	req        *gcs.CreateObjectRequest
+
+	plaintext  []byte
+	compressed []byte
+	done       bool
+	err        error
+}
+
+func (cr *compressingReader) Read(p []byte) (n int, err error) {
+	for len(cr.compressed) == 0 {
+		if cr.err != nil {
+			return 0, cr.err
+		}
+
+		if cr.done {
+			return 0, io.EOF
+		}
+
+		cr.fill()
+	}
+
+	n = copy(p, cr.compressed)
+	cr.compressed = cr.compressed[n:]
+	return
+}
+
+// fill compresses the next frame, followed by the index once r has no more.
+func (cr *compressingReader) fill() {
+	n, err := io.ReadFull(cr.r, cr.plaintext)
+	last := err == io.EOF || err == io.ErrUnexpectedEOF
+	if err != nil && !last {
+		cr.err = err
+		return
+	}
+
+	cr.compressed = cr.compressed[:0]
+	if n > 0 {
+		cr.compressed, cr.err = cr.compressor.compress(cr.compressed, cr.plaintext[:n])
+		if cr.err != nil {
+			return
+		}
+	}
+
+	if last {
+		cr.compressed = cr.compressor.appendIndex(cr.compressed)
+		cr.done = true
+		cr.err = cr.compressor.sums.check(cr.req)
+	}
+}
+
+// remainingSize returns the number of bytes r has left if it can tell.
+func remainingSize(r io.Reader) *uint64 {
+	s, ok := r.(io.Seeker)
+	if !ok {
+		return nil
+	}
+
+	cur, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil
+	}
+
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil
+	}
+
+	if _, err = s.Seek(cur, io.SeekStart); err != nil || end < cur {
+		return nil
+	}
+
+	size := uint64(end - cur)
+	return &size
+}
+
+func (b *compressingBucket) createCompressed(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest,
+	codecName string,
+	codec compressionCodec,
+	size *uint64) (o *gcs.Object, err error) {
+	c, mReq := newCompressor(req, codecName, codec, size)
+	mReq.Contents = &compressingReader{
+		r:          req.Contents,
+		compressor: c,
+		req:        req,
+		plaintext:  make([]byte, compressionFrameSize),
+	}
+
+	o, err = b.Bucket.CreateObject(ctx, mReq)
+	if err != nil {
+		return
+	}
+
+	b.created(o, c)
+	o, err = b.plaintextObject(ctx, o, &c.sums)
+	return
+}
+
+// created remembers the layout of a compressed object just created, whose
+// metadata lacks the size of its contents if that wasn't known up front, so
+// that it needn't be read from its data.
+func (b *compressingBucket) created(o *gcs.Object, c *frameCompressor) {
+	b.rememberLayout(layoutKey{o.Name, o.Generation}, c.layout())
+}
+
+func (b *compressingBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (o *gcs.Object, err error) {
+	codecName, codec := b.codecFor(req.Name)
+	if codec == nil {
+		return b.Bucket.CreateObject(ctx, req)
+	}
+
+	return b.createCompressed(ctx, req, codecName, codec, remainingSize(req.Contents))
+}
+
+// compressingWriter compresses the plaintext written to it into w, a frame
+// at a time.
+type compressingWriter struct {
+	gcs.Writer
+	compressor *frameCompressor
+	req        *gcs.CreateObjectRequest
+
+	plaintext  []byte
+	compressed []byte
+	closed     bool
+}
+
+func (cw *compressingWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		copied := min(len(p), compressionFrameSize-len(cw.plaintext))
+		cw.plaintext = append(cw.plaintext, p[:copied]...)
+		p = p[copied:]
+		n += copied
+
+		if len(cw.plaintext) == compressionFrameSize {
+			if err = cw.flushFrame(); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func (cw *compressingWriter) flushFrame() (err error) {
+	cw.compressed, err = cw.compressor.compress(cw.compressed[:0], cw.plaintext)
+	if err != nil {
+		return
+	}
+
+	if _, err = cw.Writer.Write(cw.compressed); err != nil {
+		return
+	}
+
+	cw.plaintext = cw.plaintext[:0]
+	return
+}
+
+// finish writes out the last frame and the index, once.
+func (cw *compressingWriter) finish() (err error) {
+	if cw.closed {
+		return
+	}
+	cw.closed = true
+
+	if len(cw.plaintext) > 0 {
+		if err = cw.flushFrame(); err != nil {
+			return
+		}
+	}
+
+	if _, err = cw.Writer.Write(cw.compressor.appendIndex(cw.compressed[:0])); err != nil {
+		return
+	}
+
+	err = cw.compressor.sums.check(cw.req)
+	return
+}
+
+func (cw *compressingWriter) Close() error {
+	if err := cw.finish(); err != nil {
+		return err
+	}
+
+	return cw.Writer.Close()
+}
+
+func (b *compressingBucket) CreateObjectChunkWriter(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest,
+	chunkSize int,
+	callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	codecName, codec := b.codecFor(req.Name)
+	if codec == nil {
+		return b.Bucket.CreateObjectChunkWriter(ctx, req, chunkSize, callBack)
+	}
+
+	c, mReq := newCompressor(req, codecName, codec, nil)
+	w, err := b.Bucket.CreateObjectChunkWriter(ctx, mReq, chunkSize, callBack)
+	if err != nil {
+		return nil, err
+	}
+
+	return &compressingWriter{
+		Writer:     w,
+		compressor: c,
+		req:        req,
+		plaintext:  make([]byte, 0, compressionFrameSize),
+	}, nil
+}
+
+func (b *compressingBucket) FinalizeUpload(ctx context.Context, w gcs.Writer) (o *gcs.Object, err error) {
+	cw, ok := w.(*compressingWriter)
+	if !ok {
+		return b.Bucket.FinalizeUpload(ctx, w)
+	}
+
+	if err = cw.finish(); err != nil {
+		return
+	}
+
+	o, err = b.Bucket.FinalizeUpload(ctx, cw.Writer)
+	if err != nil {
+		return
+	}
+
+	b.created(o, cw.compressor)
+	o, err = b.plaintextObject(ctx, o, &cw.compressor.sums)
+	return
+}
+
+// Composing compressed objects, or composing objects into one that is to be
+// compressed, rewrites them from the decompressed sources.
+func (b *compressingBucket) ComposeObjects(
+	ctx context.Context,
+	req *gcs.ComposeObjectsRequest) (o *gcs.Object, err error) {
+	codecName, codec := b.codecFor(req.DstName)
+	rewrite := codec != nil
+	var size uint64
+	for _, src := range req.Sources {
+		var m *gcs.MinObject
+		m, err = statGeneration(ctx, b.Bucket, src.Name, src.Generation)
+		if err != nil {
+			err = fmt.Errorf("StatObject: %w", err)
+			return
+		}
+
+		if compressionKindOf(m) != notCompressed {
+			rewrite = true
+		}
+
+		if m, err = b.plaintextMinObject(ctx, m); err != nil {
+			return
+		}
+		size += m.Size
+	}
+
+	if !rewrite {
+		o, err = b.Bucket.ComposeObjects(ctx, req)
+		return
+	}
+
+	var readers []io.Reader
+	defer func() {
+		for _, r := range readers {
+			r.(io.Closer).Close()
+		}
+	}()
+
+	for _, src := range req.Sources {
+		var rc io.ReadCloser
+		rc, err = b.NewReader(ctx, &gcs.ReadObjectRequest{
+			Name:       src.Name,
+			Generation: src.Generation,
+		})
+		if err != nil {
+			err = fmt.Errorf("NewReader: %w", err)
+			return
+		}
+		readers = append(readers, rc)
+	}
+
+	createReq := &gcs.CreateObjectRequest{
+		Name:                       req.DstName,
+		ContentType:                req.ContentType,
+		ContentLanguage:            req.ContentLanguage,
+		ContentEncoding:            req.ContentEncoding,
+		CacheControl:               req.CacheControl,
+		Metadata:                   req.Metadata,
+		ContentDisposition:         req.ContentDisposition,
+		CustomTime:                 req.CustomTime,
+		EventBasedHold:             req.EventBasedHold,
+		StorageClass:               req.StorageClass,
+		Acl:                        req.Acl,
+		Contents:                   io.MultiReader(readers...),
+		GenerationPrecondition:     req.DstGenerationPrecondition,
+		MetaGenerationPrecondition: req.DstMetaGenerationPrecondition,
+	}
+	if codec == nil {
+		o, err = b.Bucket.CreateObject(ctx, createReq)
+		return
+	}
+
+	o, err = b.createCompressed(ctx, createReq, codecName, codec, &size)
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Reading
+////////////////////////////////////////////////////////////////////////
+
+// decompressingReader decompresses the frames read from rc, whose compressed
+// lengths are given, and returns the plaintext from skip bytes into the first
+// until remaining bytes have been returned.
+type decompressingReader struct {
+	rc        io.ReadCloser
+	codec     compressionCodec
+	lengths   []uint64
+	skip      int
+	remaining uint64
+
+	compressed []byte
+	decoded    []byte
+	plaintext  []byte
+	err        error
+}
+
+func (dr *decompressingReader) Read(p []byte) (n int, err error) {
+	for len(dr.plaintext) == 0 {
+		if dr.remaining == 0 {
+			return 0, io.EOF
+		}
+
+		if dr.err != nil {
+			return 0, dr.err
+		}
+
+		dr.err = dr.next()
+	}
+
+	n = copy(p, dr.plaintext)
+	dr.plaintext = dr.plaintext[n:]
+	return
+}
+
+// next reads and decompresses the next frame.
+func (dr *decompressingReader) next() (err error) {
+	if len(dr.lengths) == 0 {
+		err = errors.New("compressed object ended early")
+		return
+	}
+
+	length := dr.lengths[0]
+	dr.lengths = dr.lengths[1:]
+	if length > uint64(cap(dr.compressed)) {
+		dr.compressed = make([]byte, length)
+	}
+	dr.compressed = dr.compressed[:length]
+
+	if _, err = io.ReadFull(dr.rc, dr.compressed); err != nil {
+		err = fmt.Errorf("reading frame: %w", err)
+		return
+	}
+
+	dr.decoded, err = dr.codec.decode(dr.decoded[:0], dr.compressed)
+	if err != nil {
+		return
+	}
+	if len(dr.decoded) > compressionFrameSize {
+		err = fmt.Errorf("frame decompressed to %d bytes", len(dr.decoded))
+		return
+	}
+
+	plaintext := dr.decoded[min(dr.skip, len(dr.decoded)):]
+	dr.skip = 0
+	if uint64(len(plaintext)) > dr.remaining {
+		plaintext = plaintext[:dr.remaining]
+	}
+	dr.remaining -= uint64(len(plaintext))
+	dr.plaintext = plaintext
+	return
+}
+
+func (dr *decompressingReader) Close() error {
+	return dr.rc.Close()
+}
+
+// gunzippingReader decompresses the data of an object stored with
+// Content-Encoding gzip.
+type gunzippingReader struct {
+	io.Reader
+	zr *gzip.Reader
+	rc io.ReadCloser
+}
+
+func (gr *gunzippingReader) Close() error {
+	gr.zr.Close()
+	return gr.rc.Close()
+}
+
+// newGunzippingReader returns the range of the contents of an object stored
+// with Content-Encoding gzip, which can only be found by decompressing all
+// that comes before it.
+func (b *compressingBucket) newGunzippingReader(
+	ctx context.Context,
+	m *gcs.MinObject,
+	r *gcs.ByteRange) (rc io.ReadCloser, err error) {
+	wrc, err := b.Bucket.NewReader(ctx, &gcs.ReadObjectRequest{
+		Name:           m.Name,
+		Generation:     m.Generation,
+		ReadCompressed: true,
+	})
+	if err != nil {
+		return
+	}
+
+	zr, err := gzip.NewReader(wrc)
+	if err == io.EOF {
+		wrc.Close()
+		rc = io.NopCloser(bytes.NewReader(nil))
+		err = nil
+		return
+	}
+	if err != nil {
+		wrc.Close()
+		err = fmt.Errorf("gzip.NewReader: %w", err)
+		return
+	}
+
+	var contents io.Reader = zr
+	if r != nil {
+		if _, err = io.CopyN(io.Discard, zr, int64(r.Start)); err != nil && err != io.EOF {
+			zr.Close()
+			wrc.Close()
+			err = fmt.Errorf("skipping to %d: %w", r.Start, err)
+			return
+		}
+		err = nil
+		contents = io.LimitReader(zr, int64(r.Limit-min(r.Start, r.Limit)))
+	}
+
+	rc = &gunzippingReader{Reader: contents, zr: zr, rc: wrc}
+	return
+}
+
+func (b *compressingBucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (rc io.ReadCloser, err error) {
+	m, err := statGeneration(ctx, b.Bucket, req.Name, req.Generation)
+	if err != nil {
+		return
+	}
+
+	switch compressionKindOf(m) {
+	case notCompressed:
+		rc, err = b.Bucket.NewReader(ctx, req)
+		return
+
+	case gzipEncoded:
+		rc, err = b.newGunzippingReader(ctx, m, req.Range)
+		return
+	}
+
+	codec, err := objectCodec(m)
+	if err != nil {
+		return
+	}
+
+	l, err := b.layout(ctx, m, true)
+	if err != nil {
+		return
+	}
+
+	// Clamp the range to the contents, and find the frames it spans.
+	start, limit := uint64(0), l.size
+	if req.Range != nil {
+		start, limit = req.Range.Start, min(req.Range.Limit, l.size)
+	}
+	if start >= limit {
+		rc = io.NopCloser(bytes.NewReader(nil))
+		return
+	}
+
+	first, last := start/compressionFrameSize, (limit-1)/compressionFrameSize
+	lengths := make([]uint64, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		lengths = append(lengths, l.frameOffsets[i+1]-l.frameOffsets[i])
+	}
+
+	wrc, err := b.Bucket.NewReader(ctx, &gcs.ReadObjectRequest{
+		Name:       req.Name,
+		Generation: m.Generation,
+		Range: &gcs.ByteRange{
+			Start: l.frameOffsets[first],
+			Limit: l.frameOffsets[last+1],
+		},
+		// The frames are wanted as they are stored.
+		ReadCompressed: true,
+	})
+	if err != nil {
+		return
+	}
+
+	rc = &decompressingReader{
+		rc:        wrc,
+		codec:     codec,
+		lengths:   lengths,
+		skip:      int(start - first*compressionFrameSize),
+		remaining: limit - start,
+	}
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Metadata
+////////////////////////////////////////////////////////////////////////
+
+func (b *compressingBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (m *gcs.MinObject, e *gcs.ExtendedObjectAttributes, err error) {
+	m, e, err = b.Bucket.StatObject(ctx, req)
+	if err != nil || m == nil || compressionKindOf(m) == notCompressed {
+		return
+	}
+
+	if e != nil {
+		pe := *e
+		pe.MD5 = nil
+		e = &pe
+	}
+
+	m, err = b.plaintextMinObject(ctx, m)
+	return
+}
+
+func (b *compressingBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (l *gcs.Listing, err error) {
+	l, err = b.Bucket.ListObjects(ctx, req)
+	if err != nil {
+		return
+	}
+
+	// Reading the data of each object to find its size would make listings
+	// slow, so it is left to StatObject and NewReader.
+	for i, m := range l.MinObjects {
+		l.MinObjects[i] = b.listedMinObject(m)
+	}
+
+	return
+}
+
+func (b *compressingBucket) CopyObject(
+	ctx context.Context,
+	req *gcs.CopyObjectRequest) (o *gcs.Object, err error) {
+	o, err = b.Bucket.CopyObject(ctx, req)
+	if err != nil {
+		return
+	}
+
+	o, err = b.plaintextObject(ctx, o, nil)
+	return
+}
+
+func (b *compressingBucket) RewriteObject(
+	ctx context.Context,
+	req *gcs.RewriteObjectRequest) (o *gcs.Object, err error) {
+	o, err = b.Bucket.RewriteObject(ctx, req)
+	if err != nil {
+		return
+	}
+
+	o, err = b.plaintextObject(ctx, o, nil)
+	return
+}
+
+func (b *compressingBucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (o *gcs.Object, err error) {
+	// The codec and size mustn't be changed or removed.
+	mReq := new(gcs.UpdateObjectRequest)
+	*mReq = *req
+	if req.Metadata != nil {
+		mReq.Metadata = maps.Clone(req.Metadata)
+		delete(mReq.Metadata, compressionMetadataKey)
+		delete(mReq.Metadata, compressionSizeMetadataKey)
+	}
+
+	o, err = b.Bucket.UpdateObject(ctx, mReq)
+	if err != nil {
+		return
+	}
+
+	o, err = b.plaintextObject(ctx, o, nil)
+	return
+}
@@ -0,0 +1,353 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type CompressingBucketTest struct {
+	suite.Suite
+	ctx     context.Context
+	wrapped gcs.Bucket
+	bucket  gcs.Bucket
+}
+
+func TestCompressingBucketSuite(t *testing.T) {
+	suite.Run(t, new(CompressingBucketTest))
+}
+
+func (t *CompressingBucketTest) SetupTest() {
+	t.ctx = context.Background()
+	t.wrapped = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical)
+	t.bucket = NewCompressingBucket([]cfg.CompressionRule{
+		{Pattern: "*.log", Codec: cfg.CompressionCodecGzip},
+		{Pattern: "*.csv", Codec: cfg.CompressionCodecZstd},
+	}, t.wrapped)
+}
+
+// compressibleContents returns contents of the given size that compress well.
+func compressibleContents(size int) []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < size; i++ {
+		fmt.Fprintf(&buf, "line %d of the log\n", i)
+	}
+	return buf.Bytes()[:size]
+}
+
+func (t *CompressingBucketTest) create(name string, contents []byte) *gcs.Object {
+	o, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:     name,
+		Contents: bytes.NewReader(contents),
+		Metadata: map[string]string{"foo": "bar"},
+	})
+	require.NoError(t.T(), err)
+	return o
+}
+
+func (t *CompressingBucketTest) read(b gcs.Bucket, req *gcs.ReadObjectRequest) ([]byte, error) {
+	rc, err := b.NewReader(t.ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func (t *CompressingBucketTest) TestCreateObjectCompressesContents() {
+	contents := compressibleContents(2*compressionFrameSize + 100)
+	for _, name := range []string{"foo.log", "foo.csv"} {
+		t.Run(name, func() {
+			o := t.create(name, contents)
+
+			assert.EqualValues(t.T(), len(contents), o.Size)
+			assert.Equal(t.T(), crc32.Checksum(contents, crc32cTable), *o.CRC32C)
+			assert.Equal(t.T(), map[string]string{"foo": "bar"}, o.Metadata)
+			raw, err := t.read(t.wrapped, &gcs.ReadObjectRequest{Name: name})
+			require.NoError(t.T(), err)
+			assert.Less(t.T(), len(raw), len(contents)/2)
+			read, err := t.read(t.bucket, &gcs.ReadObjectRequest{Name: name, Generation: o.Generation})
+			require.NoError(t.T(), err)
+			assert.Equal(t.T(), contents, read)
+		})
+	}
+}
+
+func (t *CompressingBucketTest) TestUnmatchedObjectsAreNotCompressed() {
+	o := t.create("foo.txt", []byte("taco"))
+
+	assert.Equal(t.T(), map[string]string{"foo": "bar"}, o.Metadata)
+	raw, err := t.read(t.wrapped, &gcs.ReadObjectRequest{Name: "foo.txt"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", string(raw))
+}
+
+func (t *CompressingBucketTest) TestRangeReads() {
+	contents := compressibleContents(3*compressionFrameSize + 10)
+	t.create("foo.log", contents)
+	size := uint64(len(contents))
+	testCases := []struct {
+		name  string
+		start uint64
+		limit uint64
+	}{
+		{name: "within_frame", start: 10, limit: 20},
+		{name: "whole_frame", start: compressionFrameSize, limit: 2 * compressionFrameSize},
+		{name: "across_frames", start: compressionFrameSize - 5, limit: 2*compressionFrameSize + 5},
+		{name: "final_frame", start: 3*compressionFrameSize + 2, limit: size},
+		{name: "past_end", start: size - 5, limit: size + 100},
+		{name: "empty", start: 20, limit: 20},
+		{name: "beyond_end", start: size + 1, limit: size + 10},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func() {
+			read, err := t.read(t.bucket, &gcs.ReadObjectRequest{
+				Name:  "foo.log",
+				Range: &gcs.ByteRange{Start: tc.start, Limit: tc.limit},
+			})
+
+			require.NoError(t.T(), err)
+			expected := contents[min(tc.start, size):min(max(tc.start, tc.limit), size)]
+			assert.Equal(t.T(), expected, read)
+		})
+	}
+}
+
+func (t *CompressingBucketTest) TestStatAndListReportContents() {
+	sizes := map[string]int{
+		"empty.log":      0,
+		"one.log":        1,
+		"frame.csv":      compressionFrameSize,
+		"frame_plus.csv": compressionFrameSize + 1,
+	}
+	for name, size := range sizes {
+		t.create(name, compressibleContents(size))
+	}
+
+	listing, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{})
+
+	require.NoError(t.T(), err)
+	require.Len(t.T(), listing.MinObjects, len(sizes))
+	for _, m := range listing.MinObjects {
+		assert.EqualValues(t.T(), sizes[m.Name], m.Size, m.Name)
+		assert.Equal(t.T(), map[string]string{"foo": "bar"}, m.Metadata)
+		assert.Nil(t.T(), m.CRC32C)
+
+		sm, e, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: m.Name, ForceFetchFromGcs: true, ReturnExtendedObjectAttributes: true})
+		require.NoError(t.T(), err)
+		assert.Equal(t.T(), m.Size, sm.Size)
+		assert.Nil(t.T(), e.MD5)
+	}
+}
+
+func (t *CompressingBucketTest) TestChunkWriter() {
+	contents := compressibleContents(compressionFrameSize + 1000)
+	w, err := t.bucket.CreateObjectChunkWriter(t.ctx, &gcs.CreateObjectRequest{Name: "foo.csv"}, 1<<20, nil)
+	require.NoError(t.T(), err)
+	for i := 0; i < len(contents); i += 999 {
+		_, err = w.Write(contents[i:min(i+999, len(contents))])
+		require.NoError(t.T(), err)
+	}
+
+	o, err := t.bucket.FinalizeUpload(t.ctx, w)
+
+	require.NoError(t.T(), err)
+	assert.EqualValues(t.T(), len(contents), o.Size)
+	assert.Equal(t.T(), crc32.Checksum(contents, crc32cTable), *o.CRC32C)
+	assert.EqualValues(t.T(), 1, o.MetaGeneration)
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo.csv"})
+	require.NoError(t.T(), err)
+	assert.EqualValues(t.T(), len(contents), m.Size)
+	read, err := t.read(t.bucket, &gcs.ReadObjectRequest{Name: "foo.csv"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), contents, read)
+}
+
+func (t *CompressingBucketTest) TestSizeIsReadFromFooterWithoutMetadata() {
+	contents := compressibleContents(compressionFrameSize + 7)
+	t.create("foo.log", contents)
+	m, _, err := t.wrapped.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo.log"})
+	require.NoError(t.T(), err)
+	_, err = t.wrapped.UpdateObject(t.ctx, &gcs.UpdateObjectRequest{
+		Name:     "foo.log",
+		Metadata: map[string]*string{compressionSizeMetadataKey: nil},
+	})
+	require.NoError(t.T(), err)
+	// A bucket that didn't create the object doesn't know its layout.
+	t.bucket = NewCompressingBucket([]cfg.CompressionRule{{Pattern: "*.log", Codec: cfg.CompressionCodecGzip}}, t.wrapped)
+
+	sm, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo.log"})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), m.Generation, sm.Generation)
+	assert.EqualValues(t.T(), len(contents), sm.Size)
+	read, err := t.read(t.bucket, &gcs.ReadObjectRequest{Name: "foo.log", Range: &gcs.ByteRange{Start: compressionFrameSize, Limit: compressionFrameSize + 7}})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), contents[compressionFrameSize:], read)
+}
+
+func (t *CompressingBucketTest) TestTruncatedObjectFailsRead() {
+	t.create("foo.log", compressibleContents(2*compressionFrameSize))
+	m, _, err := t.wrapped.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo.log"})
+	require.NoError(t.T(), err)
+	raw, err := t.read(t.wrapped, &gcs.ReadObjectRequest{Name: "foo.log"})
+	require.NoError(t.T(), err)
+	_, err = t.wrapped.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:     "foo.log",
+		Contents: bytes.NewReader(raw[:len(raw)-1]),
+		Metadata: m.Metadata,
+	})
+	require.NoError(t.T(), err)
+
+	_, err = t.read(t.bucket, &gcs.ReadObjectRequest{Name: "foo.log"})
+
+	assert.Error(t.T(), err)
+}
+
+func (t *CompressingBucketTest) TestGzipEncodedObjects() {
+	contents := compressibleContents(100000)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(contents)
+	require.NoError(t.T(), err)
+	require.NoError(t.T(), zw.Close())
+	_, err = t.wrapped.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:            "foo.txt",
+		ContentEncoding: "gzip",
+		Contents:        &buf,
+	})
+	require.NoError(t.T(), err)
+
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo.txt"})
+
+	require.NoError(t.T(), err)
+	assert.EqualValues(t.T(), len(contents), m.Size)
+	assert.False(t.T(), m.HasContentEncodingGzip())
+	read, err := t.read(t.bucket, &gcs.ReadObjectRequest{Name: "foo.txt", Range: &gcs.ByteRange{Start: 5000, Limit: 6000}})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), contents[5000:6000], read)
+}
+
+func (t *CompressingBucketTest) TestListingGzipEncodedObjectsDoesNotReadThem() {
+	contents := compressibleContents(100000)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(contents)
+	require.NoError(t.T(), err)
+	require.NoError(t.T(), zw.Close())
+	stored, err := t.wrapped.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:            "foo.txt",
+		ContentEncoding: "gzip",
+		Contents:        &buf,
+	})
+	require.NoError(t.T(), err)
+
+	listing, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{})
+
+	// The size of the data is listed until the object has been statted.
+	require.NoError(t.T(), err)
+	require.Len(t.T(), listing.MinObjects, 1)
+	assert.Equal(t.T(), stored.Size, listing.MinObjects[0].Size)
+	assert.False(t.T(), listing.MinObjects[0].HasContentEncodingGzip())
+	_, _, err = t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo.txt"})
+	require.NoError(t.T(), err)
+	listing, err = t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{})
+	require.NoError(t.T(), err)
+	require.Len(t.T(), listing.MinObjects, 1)
+	assert.EqualValues(t.T(), len(contents), listing.MinObjects[0].Size)
+}
+
+func (t *CompressingBucketTest) TestGzipEncodedObjectsOfSeveralStreams() {
+	first := make([]byte, 100000)
+	_, err := rand.Read(first)
+	require.NoError(t.T(), err)
+	second := []byte("taco")
+	var buf bytes.Buffer
+	for _, contents := range [][]byte{first, second} {
+		zw := gzip.NewWriter(&buf)
+		_, err = zw.Write(contents)
+		require.NoError(t.T(), err)
+		require.NoError(t.T(), zw.Close())
+	}
+	_, err = t.wrapped.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:            "foo.txt",
+		ContentEncoding: "gzip",
+		Contents:        &buf,
+	})
+	require.NoError(t.T(), err)
+
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo.txt"})
+
+	require.NoError(t.T(), err)
+	assert.EqualValues(t.T(), len(first)+len(second), m.Size)
+}
+
+func (t *CompressingBucketTest) TestComposeObjectsRecompresses() {
+	first := compressibleContents(compressionFrameSize + 1)
+	second := []byte("taco")
+	src := t.create("foo.log", first)
+	t.create("bar.txt", second)
+
+	o, err := t.bucket.ComposeObjects(t.ctx, &gcs.ComposeObjectsRequest{
+		DstName:                   "foo.log",
+		DstGenerationPrecondition: &src.Generation,
+		Sources: []gcs.ComposeSource{
+			{Name: "foo.log", Generation: src.Generation},
+			{Name: "bar.txt"},
+		},
+	})
+
+	require.NoError(t.T(), err)
+	assert.EqualValues(t.T(), len(first)+len(second), o.Size)
+	read, err := t.read(t.bucket, &gcs.ReadObjectRequest{Name: "foo.log"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), append(first, second...), read)
+}
+
+func (t *CompressingBucketTest) TestUpdateObjectKeepsCodec() {
+	t.create("foo.log", []byte("taco"))
+	burrito := "burrito"
+
+	o, err := t.bucket.UpdateObject(t.ctx, &gcs.UpdateObjectRequest{
+		Name: "foo.log",
+		Metadata: map[string]*string{
+			"foo":                  &burrito,
+			compressionMetadataKey: nil,
+		},
+	})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), map[string]string{"foo": "burrito"}, o.Metadata)
+	assert.EqualValues(t.T(), 4, o.Size)
+	read, err := t.read(t.bucket, &gcs.ReadObjectRequest{Name: "foo.log"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", string(read))
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/klauspost/compress/zstd"
+)
+
+// A compressionCodec compresses the frames of compressed objects, each on its
+// own. It's safe for concurrent use.
+type compressionCodec interface {
+	// encode appends the compressed frame to dst.
+	encode(dst []byte, frame []byte) ([]byte, error)
+
+	// decode appends the frame decompressed from src to dst.
+	decode(dst []byte, src []byte) ([]byte, error)
+}
+
+var compressionCodecs = map[string]compressionCodec{
+	cfg.CompressionCodecGzip: &gzipCodec{},
+	cfg.CompressionCodecZstd: &zstdCodec{},
+}
+
+type gzipCodec struct {
+	writers sync.Pool
+	readers sync.Pool
+}
+
+func (c *gzipCodec) encode(dst []byte, frame []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	zw, ok := c.writers.Get().(*gzip.Writer)
+	if ok {
+		zw.Reset(buf)
+	} else {
+		zw = gzip.NewWriter(buf)
+	}
+	defer c.writers.Put(zw)
+
+	if _, err := zw.Write(frame); err != nil {
+		return dst, fmt.Errorf("gzip: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return dst, fmt.Errorf("gzip: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (c *gzipCodec) decode(dst []byte, src []byte) ([]byte, error) {
+	var err error
+	zr, ok := c.readers.Get().(*gzip.Reader)
+	if ok {
+		err = zr.Reset(bytes.NewReader(src))
+	} else {
+		zr, err = gzip.NewReader(bytes.NewReader(src))
+	}
+	if err != nil {
+		return dst, fmt.Errorf("gunzip: %w", err)
+	}
+	defer c.readers.Put(zr)
+
+	buf := bytes.NewBuffer(dst)
+	if _, err = io.Copy(buf, zr); err != nil {
+		return dst, fmt.Errorf("gunzip: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// zstdCodec shares an encoder and a decoder, whose EncodeAll and DecodeAll
+// may be called concurrently.
+type zstdCodec struct {
+	once    sync.Once
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+	err     error
+}
+
+func (c *zstdCodec) init() error {
+	c.once.Do(func() {
+		c.encoder, c.err = zstd.NewWriter(nil)
+		if c.err != nil {
+			return
+		}
+		c.decoder, c.err = zstd.NewReader(nil)
+	})
+	return c.err
+}
+
+func (c *zstdCodec) encode(dst []byte, frame []byte) ([]byte, error) {
+	if err := c.init(); err != nil {
+		return dst, fmt.Errorf("zstd: %w", err)
+	}
+	return c.encoder.EncodeAll(frame, dst), nil
+}
+
+func (c *zstdCodec) decode(dst []byte, src []byte) ([]byte, error) {
+	if err := c.init(); err != nil {
+		return dst, fmt.Errorf("zstd: %w", err)
+	}
+
+	out, err := c.decoder.DecodeAll(src, dst)
+	if err != nil {
+		return dst, fmt.Errorf("zstd: %w", err)
+	}
+	return out, nil
+}
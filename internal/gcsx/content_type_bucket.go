@@ -15,21 +15,75 @@
 package gcsx
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"mime"
+	"net/http"
 	"path"
+	"strings"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"golang.org/x/net/context"
 )
 
+// The number of bytes that http.DetectContentType looks at.
+const contentSniffLen = 512
+
 // NewContentTypeBucket creates a wrapper bucket that guesses MIME types for
 // newly created or composed objects when an explicit type is not already set.
-func NewContentTypeBucket(b gcs.Bucket) gcs.Bucket {
-	return contentTypeBucket{b}
+//
+// Types are looked up by extension in mimeTypes, keyed by lower case extension
+// with its leading dot, and then in the types known to the system. If sniff is
+// set, the types of objects created with contents whose extension doesn't tell
+// are guessed from the first bytes of the contents.
+func NewContentTypeBucket(b gcs.Bucket, mimeTypes map[string]string, sniff bool) gcs.Bucket {
+	return contentTypeBucket{Bucket: b, mimeTypes: mimeTypes, sniff: sniff}
 }
 
 type contentTypeBucket struct {
 	gcs.Bucket
+	mimeTypes map[string]string
+	sniff     bool
+}
+
+func (b contentTypeBucket) typeByName(name string) string {
+	ext := path.Ext(name)
+	if t, ok := b.mimeTypes[strings.ToLower(ext)]; ok {
+		return t
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// sniffContentType guesses the type of the contents read from r, returning a
+// reader for all of them.
+func sniffContentType(r io.Reader) (contentType string, contents io.Reader, err error) {
+	head := make([]byte, contentSniffLen)
+	n, err := io.ReadFull(r, head)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	head = head[:n]
+
+	// Empty contents tell nothing.
+	if n > 0 {
+		contentType = http.DetectContentType(head)
+	}
+
+	// Rewind if possible, so that the contents can still be sought.
+	if s, ok := r.(io.Seeker); ok {
+		if _, err = s.Seek(-int64(n), io.SeekCurrent); err != nil {
+			return
+		}
+		contents = r
+		return
+	}
+
+	contents = io.MultiReader(bytes.NewReader(head), r)
+	return
 }
 
 func (b contentTypeBucket) CreateObject(
@@ -37,7 +91,14 @@ func (b contentTypeBucket) CreateObject(
 	req *gcs.CreateObjectRequest) (o *gcs.Object, err error) {
 	// Guess a content type if necessary.
 	if req.ContentType == "" {
-		req.ContentType = mime.TypeByExtension(path.Ext(req.Name))
+		req.ContentType = b.typeByName(req.Name)
+	}
+	if req.ContentType == "" && b.sniff {
+		req.ContentType, req.Contents, err = sniffContentType(req.Contents)
+		if err != nil {
+			err = fmt.Errorf("sniffing the content type of %q: %w", req.Name, err)
+			return
+		}
 	}
 
 	// Pass on the request.
@@ -50,7 +111,7 @@ func (b contentTypeBucket) ComposeObjects(
 	req *gcs.ComposeObjectsRequest) (o *gcs.Object, err error) {
 	// Guess a content type if necessary.
 	if req.ContentType == "" {
-		req.ContentType = mime.TypeByExtension(path.Ext(req.DstName))
+		req.ContentType = b.typeByName(req.DstName)
 	}
 
 	// Pass on the request.
@@ -59,9 +120,10 @@ func (b contentTypeBucket) ComposeObjects(
 }
 
 func (b contentTypeBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
-	// Guess a content type if necessary.
+	// Guess a content type if necessary. The contents aren't known yet, so they
+	// can't be sniffed.
 	if req.ContentType == "" {
-		req.ContentType = mime.TypeByExtension(path.Ext(req.Name))
+		req.ContentType = b.typeByName(req.Name)
 	}
 
 	// Pass on the request.
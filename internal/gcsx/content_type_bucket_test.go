@@ -15,6 +15,7 @@
 package gcsx_test
 
 import (
+	"io"
 	"strings"
 	"testing"
 
@@ -83,7 +84,7 @@ func TestContentTypeBucket_CreateObject(t *testing.T) {
 	for i, tc := range contentTypeBucketTestCases {
 		// Set up a bucket.
 		bucket := gcsx.NewContentTypeBucket(
-			fake.NewFakeBucket(timeutil.RealClock(), "", gcs.NonHierarchical))
+			fake.NewFakeBucket(timeutil.RealClock(), "", gcs.NonHierarchical), nil, false)
 
 		// Create the object.
 		req := &gcs.CreateObjectRequest{
@@ -108,7 +109,7 @@ func TestContentTypeBucket_CreateObjectChunkWriter(t *testing.T) {
 	for i, tc := range contentTypeBucketTestCases {
 		// Set up a bucket.
 		bucket := gcsx.NewContentTypeBucket(
-			fake.NewFakeBucket(timeutil.RealClock(), "", gcs.NonHierarchical))
+			fake.NewFakeBucket(timeutil.RealClock(), "", gcs.NonHierarchical), nil, false)
 
 		// Create the object.
 		req := &gcs.CreateObjectRequest{
@@ -136,7 +137,7 @@ func TestContentTypeBucket_ComposeObjects(t *testing.T) {
 	for i, tc := range contentTypeBucketTestCases {
 		// Set up a bucket.
 		bucket := gcsx.NewContentTypeBucket(
-			fake.NewFakeBucket(timeutil.RealClock(), "", gcs.NonHierarchical))
+			fake.NewFakeBucket(timeutil.RealClock(), "", gcs.NonHierarchical), nil, false)
 
 		// Create a source object.
 		const srcName = "some_src"
@@ -167,3 +168,61 @@ func TestContentTypeBucket_ComposeObjects(t *testing.T) {
 		}
 	}
 }
+
+func TestContentTypeBucket_MimeTypes(t *testing.T) {
+	bucket := gcsx.NewContentTypeBucket(
+		fake.NewFakeBucket(timeutil.RealClock(), "", gcs.NonHierarchical),
+		map[string]string{".parquet": "application/vnd.apache.parquet", ".jpg": "image/x-custom"},
+		false)
+
+	for name, want := range map[string]string{
+		"foo/bar.parquet": "application/vnd.apache.parquet",
+		"foo/bar.JPG":     "image/x-custom",
+		"foo/bar.png":     "image/png",
+	} {
+		o, err := bucket.CreateObject(context.Background(), &gcs.CreateObjectRequest{
+			Name:     name,
+			Contents: strings.NewReader(""),
+		})
+		if err != nil {
+			t.Fatalf("%s: CreateObject: %v", name, err)
+		}
+
+		if got := o.ContentType; got != want {
+			t.Errorf("%s: o.ContentType is %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestContentTypeBucket_Sniff(t *testing.T) {
+	bucket := gcsx.NewContentTypeBucket(
+		fake.NewFakeBucket(timeutil.RealClock(), "", gcs.NonHierarchical), nil, true)
+	contents := "<html><body>" + strings.Repeat("taco", 1000) + "</body></html>"
+
+	testCases := []struct {
+		name     string
+		contents io.Reader
+		expected string
+	}{
+		{"seekable", strings.NewReader(contents), "text/html; charset=utf-8"},
+		{"unseekable", io.MultiReader(strings.NewReader(contents)), "text/html; charset=utf-8"},
+		{"empty", strings.NewReader(""), ""},
+	}
+
+	for _, tc := range testCases {
+		o, err := bucket.CreateObject(context.Background(), &gcs.CreateObjectRequest{
+			Name:     "foo/" + tc.name,
+			Contents: tc.contents,
+		})
+		if err != nil {
+			t.Fatalf("%s: CreateObject: %v", tc.name, err)
+		}
+
+		if got, want := o.ContentType, tc.expected; got != want {
+			t.Errorf("%s: o.ContentType is %q, want %q", tc.name, got, want)
+		}
+		if tc.name != "empty" && o.Size != uint64(len(contents)) {
+			t.Errorf("%s: o.Size is %d, want %d", tc.name, o.Size, len(contents))
+		}
+	}
+}
@@ -0,0 +1,720 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+// Objects written through an encrypting bucket hold their contents encrypted
+// with a data key of their own, which is stored in their metadata wrapped by
+// the master key. The contents are split into chunks of encryptionChunkSize
+// bytes, each sealed with AES-GCM using its index as the nonce, and the last
+// one marked as such in its additional data so that truncation is detected.
+// Every object has at least one chunk, so the size of the contents follows
+// from the size of the object.
+const (
+	encryptionMetadataKey    = "gcsfuse_encryption"
+	encryptionKeyMetadataKey = "gcsfuse_encryption_key"
+	encryptionVersion        = "1"
+
+	encryptionChunkSize = 64 << 10
+	encryptionTagSize   = 16
+	encryptedChunkSize  = encryptionChunkSize + encryptionTagSize
+)
+
+// The number of unwrapped data keys kept, so that reading an object again
+// doesn't need the master key again.
+const maxCachedDataKeys = 1024
+
+// The number of object generations whose layout is kept, so that reading one
+// again doesn't need to stat it again. Neither the size nor the data key of a
+// generation can change.
+const maxCachedGenerations = 1024
+
+// NewEncryptingBucket creates a wrapper bucket that encrypts the contents of
+// the objects it creates, and decrypts those of the objects it reads, with
+// data keys wrapped by kw. Objects that weren't encrypted by it are read as
+// they are.
+//
+// Sizes, checksums and metadata of encrypted objects are reported as those of
+// their plaintext, except that their CRC32C and MD5 are only known for the
+// objects just created. Composing objects rewrites them.
+func NewEncryptingBucket(kw KeyWrapper, wrapped gcs.Bucket) gcs.Bucket {
+	return &encryptingBucket{
+		Bucket:      wrapped,
+		keyWrapper:  kw,
+		dataKeys:    make(map[string][]byte),
+		generations: make(map[objectGeneration]*gcs.MinObject),
+	}
+}
+
+type encryptingBucket struct {
+	gcs.Bucket
+	keyWrapper KeyWrapper
+
+	mu sync.Mutex
+	// Data keys by the wrapped keys they were unwrapped from.
+	//
+	// GUARDED_BY(mu)
+	dataKeys map[string][]byte
+
+	// The objects read, as they are in the wrapped bucket, by generation.
+	//
+	// GUARDED_BY(mu)
+	generations map[objectGeneration]*gcs.MinObject
+}
+
+type objectGeneration struct {
+	name       string
+	generation int64
+}
+
+////////////////////////////////////////////////////////////////////////
+// Format
+////////////////////////////////////////////////////////////////////////
+
+func isEncrypted(metadata map[string]string) bool {
+	return metadata[encryptionMetadataKey] != ""
+}
+
+// plaintextSize returns the size of the contents of an encrypted object of
+// the given size.
+func plaintextSize(size uint64) uint64 {
+	if size < encryptionTagSize {
+		return 0
+	}
+
+	chunks := (size + encryptedChunkSize - 1) / encryptedChunkSize
+	return size - chunks*encryptionTagSize
+}
+
+func withoutEncryptionMetadata(metadata map[string]string) map[string]string {
+	m := maps.Clone(metadata)
+	delete(m, encryptionMetadataKey)
+	delete(m, encryptionKeyMetadataKey)
+	return m
+}
+
+func chunkNonce(index uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], index)
+	return nonce
+}
+
+func chunkAdditionalData(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+func newChunkAEAD(key []byte) (aead cipher.AEAD, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		err = fmt.Errorf("NewCipher: %w", err)
+		return
+	}
+
+	aead, err = cipher.NewGCM(block)
+	if err != nil {
+		err = fmt.Errorf("NewGCM: %w", err)
+		return
+	}
+
+	return
+}
+
+// chunkSealer encrypts plaintext chunk by chunk, keeping track of the
+// checksums of the plaintext it was given.
+type chunkSealer struct {
+	aead  cipher.AEAD
+	index uint64
+	sums  plaintextChecksums
+}
+
+func (s *chunkSealer) seal(dst []byte, plaintext []byte, final bool) []byte {
+	s.sums.update(plaintext)
+
+	dst = s.aead.Seal(dst, chunkNonce(s.index), plaintext, chunkAdditionalData(final))
+	s.index++
+	return dst
+}
+
+// newSealer generates a data key for a new object, recording it wrapped in a
+// copy of the request, which has the checksums of the plaintext removed.
+func (b *encryptingBucket) newSealer(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (s *chunkSealer, mReq *gcs.CreateObjectRequest, err error) {
+	key := make([]byte, 32)
+	if _, err = rand.Read(key); err != nil {
+		err = fmt.Errorf("rand.Read: %w", err)
+		return
+	}
+
+	wrapped, err := b.keyWrapper.WrapKey(ctx, key)
+	if err != nil {
+		err = fmt.Errorf("WrapKey: %w", err)
+		return
+	}
+
+	aead, err := newChunkAEAD(key)
+	if err != nil {
+		return
+	}
+
+	mReq = new(gcs.CreateObjectRequest)
+	*mReq = *req
+	mReq.Metadata = withoutEncryptionMetadata(req.Metadata)
+	if mReq.Metadata == nil {
+		mReq.Metadata = make(map[string]string)
+	}
+	mReq.Metadata[encryptionMetadataKey] = encryptionVersion
+	mReq.Metadata[encryptionKeyMetadataKey] = base64.StdEncoding.EncodeToString(wrapped)
+	mReq.CRC32C = nil
+	mReq.MD5 = nil
+
+	s = &chunkSealer{aead: aead, sums: newPlaintextChecksums()}
+	return
+}
+
+// dataKeyAEAD returns the AEAD for the chunks of the encrypted object with the
+// given metadata.
+func (b *encryptingBucket) dataKeyAEAD(
+	ctx context.Context,
+	name string,
+	metadata map[string]string) (aead cipher.AEAD, err error) {
+	if v := metadata[encryptionMetadataKey]; v != encryptionVersion {
+		err = fmt.Errorf("object %q is encrypted with unsupported version %q", name, v)
+		return
+	}
+
+	encoded := metadata[encryptionKeyMetadataKey]
+	b.mu.Lock()
+	key, ok := b.dataKeys[encoded]
+	b.mu.Unlock()
+
+	if !ok {
+		var wrapped []byte
+		wrapped, err = base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			err = fmt.Errorf("object %q has a malformed data key: %w", name, err)
+			return
+		}
+
+		key, err = b.keyWrapper.UnwrapKey(ctx, wrapped)
+		if err != nil {
+			err = fmt.Errorf("UnwrapKey for %q: %w", name, err)
+			return
+		}
+
+		b.mu.Lock()
+		if len(b.dataKeys) >= maxCachedDataKeys {
+			clear(b.dataKeys)
+		}
+		b.dataKeys[encoded] = key
+		b.mu.Unlock()
+	}
+
+	aead, err = newChunkAEAD(key)
+	return
+}
+
+// plaintextObject returns the object as it is seen through the bucket, given
+// the sealer its contents went through if known.
+func plaintextObject(o *gcs.Object, s *chunkSealer) *gcs.Object {
+	if o == nil || !isEncrypted(o.Metadata) {
+		return o
+	}
+
+	po := *o
+	po.Size = plaintextSize(o.Size)
+	po.Metadata = withoutEncryptionMetadata(o.Metadata)
+	po.CRC32C = nil
+	po.MD5 = nil
+	if s != nil {
+		crc := s.sums.crc
+		po.CRC32C = &crc
+	}
+
+	return &po
+}
+
+func plaintextMinObject(m *gcs.MinObject) *gcs.MinObject {
+	if m == nil || !isEncrypted(m.Metadata) {
+		return m
+	}
+
+	pm := *m
+	pm.Size = plaintextSize(m.Size)
+	pm.Metadata = withoutEncryptionMetadata(m.Metadata)
+	pm.CRC32C = nil
+	return &pm
+}
+
+////////////////////////////////////////////////////////////////////////
+// Writing
+////////////////////////////////////////////////////////////////////////
+
+// encryptingReader encrypts the plaintext read from r.
+type encryptingReader struct {
+	r      *bufio.Reader
+	sealer *chunkSealer
+	req    *gcs.CreateObjectRequest
+
+	plaintext []byte
+	sealed    []byte
+	done      bool
+	err       error
+}
+
+func (er *encryptingReader) Read(p []byte) (n int, err error) {
+	for len(er.sealed) == 0 {
+		if er.err != nil {
+			return 0, er.err
+		}
+
+		if er.done {
+			return 0, io.EOF
+		}
+
+		er.fill()
+	}
+
+	n = copy(p, er.sealed)
+	er.sealed = er.sealed[n:]
+	return
+}
+
+// fill seals the next chunk, which is the final one if r has no more after
+// it.
+func (er *encryptingReader) fill() {
+	n, err := io.ReadFull(er.r, er.plaintext)
+	final := err == io.EOF || err == io.ErrUnexpectedEOF
+	if err != nil && !final {
+		er.err = err
+		return
+	}
+
+	if !final {
+		if _, err = er.r.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			er.err = err
+			return
+		}
+	}
+
+	er.sealed = er.sealer.seal(er.sealed[:0], er.plaintext[:n], final)
+	if final {
+		er.done = true
+		er.err = er.sealer.sums.check(er.req)
+	}
+}
+
+func (b *encryptingBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (o *gcs.Object, err error) {
+	s, mReq, err := b.newSealer(ctx, req)
+	if err != nil {
+		return
+	}
+
+	mReq.Contents = &encryptingReader{
+		r:         bufio.NewReader(req.Contents),
+		sealer:    s,
+		req:       req,
+		plaintext: make([]byte, encryptionChunkSize),
+		sealed:    make([]byte, 0, encryptedChunkSize),
+	}
+
+	o, err = b.Bucket.CreateObject(ctx, mReq)
+	o = plaintextObject(o, s)
+	return
+}
+
+// encryptingWriter encrypts the plaintext written to it into w, holding on
+// to a full chunk until more is written or it turns out to be the final one.
+type encryptingWriter struct {
+	gcs.Writer
+	sealer *chunkSealer
+	req    *gcs.CreateObjectRequest
+
+	plaintext []byte
+	sealed    []byte
+	closed    bool
+}
+
+func (ew *encryptingWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		if len(ew.plaintext) == encryptionChunkSize {
+			ew.sealed = ew.sealer.seal(ew.sealed[:0], ew.plaintext, false)
+			if _, err = ew.Writer.Write(ew.sealed); err != nil {
+				return
+			}
+			ew.plaintext = ew.plaintext[:0]
+		}
+
+		copied := min(len(p), encryptionChunkSize-len(ew.plaintext))
+		ew.plaintext = append(ew.plaintext, p[:copied]...)
+		p = p[copied:]
+		n += copied
+	}
+
+	return
+}
+
+// sealFinal writes out the final chunk, once.
+func (ew *encryptingWriter) sealFinal() (err error) {
+	if ew.closed {
+		return
+	}
+	ew.closed = true
+
+	ew.sealed = ew.sealer.seal(ew.sealed[:0], ew.plaintext, true)
+	if _, err = ew.Writer.Write(ew.sealed); err != nil {
+		return
+	}
+
+	err = ew.sealer.sums.check(ew.req)
+	return
+}
+
+func (ew *encryptingWriter) Close() error {
+	if err := ew.sealFinal(); err != nil {
+		return err
+	}
+
+	return ew.Writer.Close()
+}
+
+func (b *encryptingBucket) CreateObjectChunkWriter(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest,
+	chunkSize int,
+	callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	s, mReq, err := b.newSealer(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := b.Bucket.CreateObjectChunkWriter(ctx, mReq, chunkSize, callBack)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptingWriter{
+		Writer:    w,
+		sealer:    s,
+		req:       req,
+		plaintext: make([]byte, 0, encryptionChunkSize),
+		sealed:    make([]byte, 0, encryptedChunkSize),
+	}, nil
+}
+
+func (b *encryptingBucket) FinalizeUpload(ctx context.Context, w gcs.Writer) (o *gcs.Object, err error) {
+	ew, ok := w.(*encryptingWriter)
+	if !ok {
+		err = fmt.Errorf("writer for %q wasn't created by this bucket", w.ObjectName())
+		return
+	}
+
+	if err = ew.sealFinal(); err != nil {
+		return
+	}
+
+	o, err = b.Bucket.FinalizeUpload(ctx, ew.Writer)
+	o = plaintextObject(o, ew.sealer)
+	return
+}
+
+// Composing encrypted objects would leave chunks encrypted with different
+// keys in one object, so the sources are decrypted and encrypted again.
+func (b *encryptingBucket) ComposeObjects(
+	ctx context.Context,
+	req *gcs.ComposeObjectsRequest) (o *gcs.Object, err error) {
+	var readers []io.Reader
+	defer func() {
+		for _, r := range readers {
+			r.(io.Closer).Close()
+		}
+	}()
+
+	for _, src := range req.Sources {
+		var rc io.ReadCloser
+		rc, err = b.NewReader(ctx, &gcs.ReadObjectRequest{
+			Name:       src.Name,
+			Generation: src.Generation,
+		})
+		if err != nil {
+			err = fmt.Errorf("NewReader: %w", err)
+			return
+		}
+		readers = append(readers, rc)
+	}
+
+	o, err = b.CreateObject(ctx, &gcs.CreateObjectRequest{
+		Name:                       req.DstName,
+		ContentType:                req.ContentType,
+		ContentLanguage:            req.ContentLanguage,
+		ContentEncoding:            req.ContentEncoding,
+		CacheControl:               req.CacheControl,
+		Metadata:                   req.Metadata,
+		ContentDisposition:         req.ContentDisposition,
+		CustomTime:                 req.CustomTime,
+		EventBasedHold:             req.EventBasedHold,
+		StorageClass:               req.StorageClass,
+		Acl:                        req.Acl,
+		Contents:                   io.MultiReader(readers...),
+		GenerationPrecondition:     req.DstGenerationPrecondition,
+		MetaGenerationPrecondition: req.DstMetaGenerationPrecondition,
+	})
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Reading
+////////////////////////////////////////////////////////////////////////
+
+// decryptingReader decrypts the chunks read from rc, starting with the one at
+// index, and returns the plaintext from skip bytes into it until remaining
+// bytes have been returned.
+type decryptingReader struct {
+	rc         io.ReadCloser
+	aead       cipher.AEAD
+	index      uint64
+	finalIndex uint64
+	skip       int
+	remaining  uint64
+
+	sealed    []byte
+	plaintext []byte
+	err       error
+}
+
+func (dr *decryptingReader) Read(p []byte) (n int, err error) {
+	for len(dr.plaintext) == 0 {
+		if dr.remaining == 0 {
+			return 0, io.EOF
+		}
+
+		if dr.err != nil {
+			return 0, dr.err
+		}
+
+		dr.err = dr.open()
+	}
+
+	n = copy(p, dr.plaintext)
+	dr.plaintext = dr.plaintext[n:]
+	return
+}
+
+// open reads and decrypts the next chunk.
+func (dr *decryptingReader) open() (err error) {
+	final := dr.index == dr.finalIndex
+	n, err := io.ReadFull(dr.rc, dr.sealed[:encryptedChunkSize])
+	if err == io.ErrUnexpectedEOF && final {
+		err = nil
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = fmt.Errorf("chunk %d is truncated", dr.index)
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	plaintext, err := dr.aead.Open(dr.sealed[encryptedChunkSize:encryptedChunkSize], chunkNonce(dr.index), dr.sealed[:n], chunkAdditionalData(final))
+	if err != nil {
+		err = fmt.Errorf("chunk %d: %w", dr.index, err)
+		return
+	}
+	dr.index++
+
+	plaintext = plaintext[min(dr.skip, len(plaintext)):]
+	dr.skip = 0
+	if uint64(len(plaintext)) > dr.remaining {
+		plaintext = plaintext[:dr.remaining]
+	}
+	dr.remaining -= uint64(len(plaintext))
+	dr.plaintext = plaintext
+	return
+}
+
+func (dr *decryptingReader) Close() error {
+	return dr.rc.Close()
+}
+
+// statForRead returns the given generation of the object as it is in the
+// wrapped bucket, only statting it if it hasn't been read before. The latest
+// generation is always statted.
+func (b *encryptingBucket) statForRead(
+	ctx context.Context,
+	name string,
+	generation int64) (m *gcs.MinObject, err error) {
+	b.mu.Lock()
+	m, ok := b.generations[objectGeneration{name, generation}]
+	b.mu.Unlock()
+	if ok {
+		return
+	}
+
+	m, err = statGeneration(ctx, b.Bucket, name, generation)
+	if err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	if len(b.generations) >= maxCachedGenerations {
+		clear(b.generations)
+	}
+	b.generations[objectGeneration{name, m.Generation}] = m
+	b.mu.Unlock()
+	return
+}
+
+func (b *encryptingBucket) NewReader(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (rc io.ReadCloser, err error) {
+	m, err := b.statForRead(ctx, req.Name, req.Generation)
+	if err != nil {
+		return
+	}
+
+	if !isEncrypted(m.Metadata) {
+		rc, err = b.Bucket.NewReader(ctx, req)
+		return
+	}
+
+	aead, err := b.dataKeyAEAD(ctx, req.Name, m.Metadata)
+	if err != nil {
+		return
+	}
+
+	// Clamp the range to the plaintext, and find the chunks it spans.
+	size := plaintextSize(m.Size)
+	start, limit := uint64(0), size
+	if req.Range != nil {
+		start, limit = req.Range.Start, min(req.Range.Limit, size)
+	}
+	if start >= limit {
+		rc = io.NopCloser(bytes.NewReader(nil))
+		return
+	}
+
+	first, last := start/encryptionChunkSize, (limit-1)/encryptionChunkSize
+	wrc, err := b.Bucket.NewReader(ctx, &gcs.ReadObjectRequest{
+		Name:       req.Name,
+		Generation: m.Generation,
+		Range: &gcs.ByteRange{
+			Start: first * encryptedChunkSize,
+			Limit: min((last+1)*encryptedChunkSize, m.Size),
+		},
+		// The ciphertext is wanted as it is stored.
+		ReadCompressed: true,
+	})
+	if err != nil {
+		return
+	}
+
+	rc = &decryptingReader{
+		rc:         wrc,
+		aead:       aead,
+		index:      first,
+		finalIndex: (m.Size+encryptedChunkSize-1)/encryptedChunkSize - 1,
+		skip:       int(start - first*encryptionChunkSize),
+		remaining:  limit - start,
+		sealed:     make([]byte, encryptedChunkSize+encryptionChunkSize),
+	}
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Metadata
+////////////////////////////////////////////////////////////////////////
+
+func (b *encryptingBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (m *gcs.MinObject, e *gcs.ExtendedObjectAttributes, err error) {
+	m, e, err = b.Bucket.StatObject(ctx, req)
+	if m != nil && isEncrypted(m.Metadata) && e != nil {
+		pe := *e
+		pe.MD5 = nil
+		e = &pe
+	}
+
+	m = plaintextMinObject(m)
+	return
+}
+
+func (b *encryptingBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (l *gcs.Listing, err error) {
+	l, err = b.Bucket.ListObjects(ctx, req)
+	if l != nil {
+		for i, m := range l.MinObjects {
+			l.MinObjects[i] = plaintextMinObject(m)
+		}
+	}
+
+	return
+}
+
+func (b *encryptingBucket) CopyObject(
+	ctx context.Context,
+	req *gcs.CopyObjectRequest) (o *gcs.Object, err error) {
+	o, err = b.Bucket.CopyObject(ctx, req)
+	o = plaintextObject(o, nil)
+	return
+}
+
+func (b *encryptingBucket) RewriteObject(
+	ctx context.Context,
+	req *gcs.RewriteObjectRequest) (o *gcs.Object, err error) {
+	o, err = b.Bucket.RewriteObject(ctx, req)
+	o = plaintextObject(o, nil)
+	return
+}
+
+func (b *encryptingBucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (o *gcs.Object, err error) {
+	// The data key mustn't be changed or removed.
+	mReq := new(gcs.UpdateObjectRequest)
+	*mReq = *req
+	if req.Metadata != nil {
+		mReq.Metadata = maps.Clone(req.Metadata)
+		delete(mReq.Metadata, encryptionMetadataKey)
+		delete(mReq.Metadata, encryptionKeyMetadataKey)
+	}
+
+	o, err = b.Bucket.UpdateObject(ctx, mReq)
+	o = plaintextObject(o, nil)
+	return
+}
@@ -0,0 +1,375 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type EncryptingBucketTest struct {
+	suite.Suite
+	ctx     context.Context
+	wrapped gcs.Bucket
+	bucket  gcs.Bucket
+}
+
+func TestEncryptingBucketSuite(t *testing.T) {
+	suite.Run(t, new(EncryptingBucketTest))
+}
+
+func (t *EncryptingBucketTest) SetupTest() {
+	t.ctx = context.Background()
+	t.wrapped = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical)
+	t.bucket = NewEncryptingBucket(t.newKeyWrapper(), t.wrapped)
+}
+
+func (t *EncryptingBucketTest) newKeyWrapper() KeyWrapper {
+	masterKey := make([]byte, 32)
+	_, err := rand.Read(masterKey)
+	require.NoError(t.T(), err)
+	kw, err := newLocalKeyWrapper(masterKey)
+	require.NoError(t.T(), err)
+	return kw
+}
+
+func (t *EncryptingBucketTest) randomContents(size int) []byte {
+	contents := make([]byte, size)
+	_, err := rand.Read(contents)
+	require.NoError(t.T(), err)
+	return contents
+}
+
+func (t *EncryptingBucketTest) create(name string, contents []byte) *gcs.Object {
+	o, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:     name,
+		Contents: bytes.NewReader(contents),
+		Metadata: map[string]string{"foo": "bar"},
+	})
+	require.NoError(t.T(), err)
+	return o
+}
+
+func (t *EncryptingBucketTest) read(b gcs.Bucket, req *gcs.ReadObjectRequest) ([]byte, error) {
+	rc, err := b.NewReader(t.ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// rewriteRaw replaces the contents of the object in the wrapped bucket, keeping
+// its data key.
+func (t *EncryptingBucketTest) rewriteRaw(name string, rewrite func([]byte) []byte) {
+	m, _, err := t.wrapped.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	require.NoError(t.T(), err)
+	raw, err := t.read(t.wrapped, &gcs.ReadObjectRequest{Name: name})
+	require.NoError(t.T(), err)
+
+	_, err = t.wrapped.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:     name,
+		Contents: bytes.NewReader(rewrite(raw)),
+		Metadata: m.Metadata,
+	})
+	require.NoError(t.T(), err)
+}
+
+func (t *EncryptingBucketTest) TestCreateObjectEncryptsContents() {
+	contents := t.randomContents(2*encryptionChunkSize + 100)
+
+	o := t.create("foo", contents)
+
+	assert.EqualValues(t.T(), len(contents), o.Size)
+	assert.Equal(t.T(), crc32.Checksum(contents, crc32cTable), *o.CRC32C)
+	assert.Equal(t.T(), map[string]string{"foo": "bar"}, o.Metadata)
+	raw, err := t.read(t.wrapped, &gcs.ReadObjectRequest{Name: "foo"})
+	require.NoError(t.T(), err)
+	assert.Len(t.T(), raw, len(contents)+3*encryptionTagSize)
+	assert.False(t.T(), bytes.Contains(raw, contents[:100]))
+	read, err := t.read(t.bucket, &gcs.ReadObjectRequest{Name: "foo", Generation: o.Generation})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), contents, read)
+}
+
+func (t *EncryptingBucketTest) TestRangeReads() {
+	contents := t.randomContents(3*encryptionChunkSize + 10)
+	t.create("foo", contents)
+	size := uint64(len(contents))
+	testCases := []struct {
+		name  string
+		start uint64
+		limit uint64
+	}{
+		{name: "within_chunk", start: 10, limit: 20},
+		{name: "whole_chunk", start: encryptionChunkSize, limit: 2 * encryptionChunkSize},
+		{name: "across_chunks", start: encryptionChunkSize - 5, limit: 2*encryptionChunkSize + 5},
+		{name: "final_chunk", start: 3*encryptionChunkSize + 2, limit: size},
+		{name: "past_end", start: size - 5, limit: size + 100},
+		{name: "empty", start: 20, limit: 20},
+		{name: "beyond_end", start: size + 1, limit: size + 10},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func() {
+			read, err := t.read(t.bucket, &gcs.ReadObjectRequest{
+				Name:  "foo",
+				Range: &gcs.ByteRange{Start: tc.start, Limit: tc.limit},
+			})
+
+			require.NoError(t.T(), err)
+			expected := contents[min(tc.start, size):min(max(tc.start, tc.limit), size)]
+			assert.Equal(t.T(), expected, read)
+		})
+	}
+}
+
+// statCountingBucket counts the calls to StatObject.
+type statCountingBucket struct {
+	gcs.Bucket
+	stats int
+}
+
+func (b *statCountingBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (*gcs.MinObject, *gcs.ExtendedObjectAttributes, error) {
+	b.stats++
+	return b.Bucket.StatObject(ctx, req)
+}
+
+func (t *EncryptingBucketTest) TestRangeReadsOfAGenerationStatItOnce() {
+	counting := &statCountingBucket{Bucket: t.wrapped}
+	t.bucket = NewEncryptingBucket(t.newKeyWrapper(), counting)
+	contents := t.randomContents(2*encryptionChunkSize + 100)
+	o := t.create("foo", contents)
+
+	for _, start := range []uint64{0, encryptionChunkSize, 2 * encryptionChunkSize} {
+		read, err := t.read(t.bucket, &gcs.ReadObjectRequest{
+			Name:       "foo",
+			Generation: o.Generation,
+			Range:      &gcs.ByteRange{Start: start, Limit: start + 100},
+		})
+		require.NoError(t.T(), err)
+		assert.Equal(t.T(), contents[start:start+100], read)
+	}
+
+	assert.Equal(t.T(), 1, counting.stats)
+}
+
+func (t *EncryptingBucketTest) TestStatAndListReportPlaintext() {
+	sizes := map[string]int{
+		"empty":      0,
+		"one":        1,
+		"chunk":      encryptionChunkSize,
+		"chunk_plus": encryptionChunkSize + 1,
+	}
+	for name, size := range sizes {
+		t.create(name, t.randomContents(size))
+	}
+
+	listing, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{})
+
+	require.NoError(t.T(), err)
+	require.Len(t.T(), listing.MinObjects, len(sizes))
+	for _, m := range listing.MinObjects {
+		assert.EqualValues(t.T(), sizes[m.Name], m.Size, m.Name)
+		assert.Equal(t.T(), map[string]string{"foo": "bar"}, m.Metadata)
+		assert.Nil(t.T(), m.CRC32C)
+
+		sm, e, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: m.Name, ForceFetchFromGcs: true, ReturnExtendedObjectAttributes: true})
+		require.NoError(t.T(), err)
+		assert.Equal(t.T(), m.Size, sm.Size)
+		assert.Equal(t.T(), map[string]string{"foo": "bar"}, sm.Metadata)
+		assert.Nil(t.T(), e.MD5)
+	}
+}
+
+func (t *EncryptingBucketTest) TestChunkWriter() {
+	contents := t.randomContents(encryptionChunkSize + 1000)
+	w, err := t.bucket.CreateObjectChunkWriter(t.ctx, &gcs.CreateObjectRequest{Name: "foo"}, 1<<20, nil)
+	require.NoError(t.T(), err)
+	for i := 0; i < len(contents); i += 999 {
+		_, err = w.Write(contents[i:min(i+999, len(contents))])
+		require.NoError(t.T(), err)
+	}
+
+	o, err := t.bucket.FinalizeUpload(t.ctx, w)
+
+	require.NoError(t.T(), err)
+	assert.EqualValues(t.T(), len(contents), o.Size)
+	assert.Equal(t.T(), crc32.Checksum(contents, crc32cTable), *o.CRC32C)
+	read, err := t.read(t.bucket, &gcs.ReadObjectRequest{Name: "foo"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), contents, read)
+}
+
+func (t *EncryptingBucketTest) TestCreateObjectWithWrongChecksum() {
+	crc := uint32(17)
+
+	_, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:     "foo",
+		Contents: bytes.NewReader([]byte("taco")),
+		CRC32C:   &crc,
+	})
+
+	var checksumErr *gcs.ChecksumMismatchError
+	assert.True(t.T(), errors.As(err, &checksumErr))
+	_, _, err = t.wrapped.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo"})
+	var notFoundErr *gcs.NotFoundError
+	assert.True(t.T(), errors.As(err, &notFoundErr))
+}
+
+func (t *EncryptingBucketTest) TestTamperedChunkFailsRead() {
+	contents := t.randomContents(2 * encryptionChunkSize)
+	t.create("foo", contents)
+	t.rewriteRaw("foo", func(raw []byte) []byte {
+		raw[encryptedChunkSize+1] ^= 1
+		return raw
+	})
+
+	// The first chunk is still fine.
+	read, err := t.read(t.bucket, &gcs.ReadObjectRequest{Name: "foo", Range: &gcs.ByteRange{Start: 0, Limit: 10}})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), contents[:10], read)
+	_, err = t.read(t.bucket, &gcs.ReadObjectRequest{Name: "foo"})
+	assert.Error(t.T(), err)
+}
+
+func (t *EncryptingBucketTest) TestTruncatedObjectFailsRead() {
+	t.create("foo", t.randomContents(2*encryptionChunkSize))
+	t.rewriteRaw("foo", func(raw []byte) []byte {
+		return raw[:encryptedChunkSize]
+	})
+
+	_, err := t.read(t.bucket, &gcs.ReadObjectRequest{Name: "foo"})
+
+	assert.Error(t.T(), err)
+}
+
+func (t *EncryptingBucketTest) TestDifferentMasterKeyFailsRead() {
+	t.create("foo", []byte("taco"))
+	other := NewEncryptingBucket(t.newKeyWrapper(), t.wrapped)
+
+	_, err := t.read(other, &gcs.ReadObjectRequest{Name: "foo"})
+
+	assert.Error(t.T(), err)
+}
+
+func (t *EncryptingBucketTest) TestUnencryptedObjectsAreReadAsIs() {
+	_, err := t.wrapped.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:     "foo",
+		Contents: bytes.NewReader([]byte("taco")),
+	})
+	require.NoError(t.T(), err)
+
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo"})
+	require.NoError(t.T(), err)
+	assert.EqualValues(t.T(), 4, m.Size)
+	read, err := t.read(t.bucket, &gcs.ReadObjectRequest{Name: "foo"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", string(read))
+}
+
+func (t *EncryptingBucketTest) TestComposeObjectsReencrypts() {
+	first := t.randomContents(encryptionChunkSize + 1)
+	second := t.randomContents(10)
+	src := t.create("foo", first)
+	t.create("bar", second)
+
+	o, err := t.bucket.ComposeObjects(t.ctx, &gcs.ComposeObjectsRequest{
+		DstName:                   "foo",
+		DstGenerationPrecondition: &src.Generation,
+		Sources: []gcs.ComposeSource{
+			{Name: "foo", Generation: src.Generation},
+			{Name: "bar"},
+		},
+	})
+
+	require.NoError(t.T(), err)
+	assert.EqualValues(t.T(), len(first)+len(second), o.Size)
+	read, err := t.read(t.bucket, &gcs.ReadObjectRequest{Name: "foo"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), append(first, second...), read)
+}
+
+func (t *EncryptingBucketTest) TestUpdateObjectKeepsDataKey() {
+	t.create("foo", []byte("taco"))
+	burrito := "burrito"
+
+	o, err := t.bucket.UpdateObject(t.ctx, &gcs.UpdateObjectRequest{
+		Name: "foo",
+		Metadata: map[string]*string{
+			"foo":                    &burrito,
+			encryptionKeyMetadataKey: nil,
+		},
+	})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), map[string]string{"foo": "burrito"}, o.Metadata)
+	read, err := t.read(t.bucket, &gcs.ReadObjectRequest{Name: "foo"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", string(read))
+}
+
+func TestNewKeyFileWrapper(t *testing.T) {
+	masterKey := bytes.Repeat([]byte{7}, 32)
+	dir := t.TempDir()
+	testCases := []struct {
+		name     string
+		contents []byte
+		wantErr  bool
+	}{
+		{name: "raw", contents: masterKey},
+		{name: "base64", contents: []byte(base64.StdEncoding.EncodeToString(masterKey) + "\n")},
+		{name: "too_short", contents: masterKey[:16], wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			keyFile := path.Join(dir, tc.name)
+			require.NoError(t, os.WriteFile(keyFile, tc.contents, 0600))
+
+			kw, err := NewKeyFileWrapper(keyFile)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			wrapped, err := kw.WrapKey(context.Background(), []byte("data key"))
+			require.NoError(t, err)
+			local, err := newLocalKeyWrapper(masterKey)
+			require.NoError(t, err)
+			key, err := local.UnwrapKey(context.Background(), wrapped)
+			require.NoError(t, err)
+			assert.Equal(t, "data key", string(key))
+		})
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
@@ -93,7 +94,9 @@ func (t *IntegrationTest) SetUp(ti *TestInfo) {
 		appendThreshold,
 		chunkTransferTimeoutSecs,
 		tmpObjectPrefix,
-		t.bucket)
+		nil,
+		t.bucket,
+		common.NewNoopMetrics())
 }
 
 func (t *IntegrationTest) TearDown() {
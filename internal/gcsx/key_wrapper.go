@@ -0,0 +1,172 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+)
+
+// A KeyWrapper protects the data keys of objects encrypted by an encrypting
+// bucket with a master key that never leaves it.
+type KeyWrapper interface {
+	WrapKey(ctx context.Context, key []byte) (wrapped []byte, err error)
+	UnwrapKey(ctx context.Context, wrapped []byte) (key []byte, err error)
+}
+
+// NewKeyFileWrapper returns a KeyWrapper that wraps data keys locally with the
+// AES-256 master key held by the file at the supplied path, either as 32 raw
+// bytes or base64 encoded.
+func NewKeyFileWrapper(path string) (kw KeyWrapper, err error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("ReadFile: %w", err)
+		return
+	}
+
+	key := contents
+	if len(key) != 32 {
+		key, err = base64.StdEncoding.DecodeString(string(bytes.TrimSpace(contents)))
+		if err != nil || len(key) != 32 {
+			err = fmt.Errorf("%s doesn't hold a 32 byte key, raw or base64 encoded", path)
+			return
+		}
+	}
+
+	kw, err = newLocalKeyWrapper(key)
+	return
+}
+
+func newLocalKeyWrapper(masterKey []byte) (kw KeyWrapper, err error) {
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		err = fmt.Errorf("NewCipher: %w", err)
+		return
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		err = fmt.Errorf("NewGCM: %w", err)
+		return
+	}
+
+	kw = &localKeyWrapper{aead: aead}
+	return
+}
+
+// localKeyWrapper seals data keys with AES-GCM under a random nonce, which
+// the wrapped key begins with.
+type localKeyWrapper struct {
+	aead cipher.AEAD
+}
+
+func (kw *localKeyWrapper) WrapKey(ctx context.Context, key []byte) (wrapped []byte, err error) {
+	nonce := make([]byte, kw.aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		err = fmt.Errorf("rand.Read: %w", err)
+		return
+	}
+
+	wrapped = kw.aead.Seal(nonce, nonce, key, nil)
+	return
+}
+
+func (kw *localKeyWrapper) UnwrapKey(ctx context.Context, wrapped []byte) (key []byte, err error) {
+	if len(wrapped) < kw.aead.NonceSize() {
+		err = errors.New("wrapped key is too short")
+		return
+	}
+
+	nonce, sealed := wrapped[:kw.aead.NonceSize()], wrapped[kw.aead.NonceSize():]
+	key, err = kw.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		err = fmt.Errorf("data key wasn't wrapped with this master key: %w", err)
+		return
+	}
+
+	return
+}
+
+// NewKMSKeyWrapper returns a KeyWrapper that has Cloud KMS wrap data keys with
+// the named key, of the form
+// projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>.
+func NewKMSKeyWrapper(
+	ctx context.Context,
+	keyName string,
+	opts ...option.ClientOption) (kw KeyWrapper, err error) {
+	opts = append([]option.ClientOption{option.WithScopes(cloudkms.CloudkmsScope)}, opts...)
+	service, err := cloudkms.NewService(ctx, opts...)
+	if err != nil {
+		err = fmt.Errorf("cloudkms.NewService: %w", err)
+		return
+	}
+
+	kw = &kmsKeyWrapper{
+		keys:    service.Projects.Locations.KeyRings.CryptoKeys,
+		keyName: keyName,
+	}
+	return
+}
+
+type kmsKeyWrapper struct {
+	keys    *cloudkms.ProjectsLocationsKeyRingsCryptoKeysService
+	keyName string
+}
+
+func (kw *kmsKeyWrapper) WrapKey(ctx context.Context, key []byte) (wrapped []byte, err error) {
+	resp, err := kw.keys.Encrypt(kw.keyName, &cloudkms.EncryptRequest{
+		Plaintext: base64.StdEncoding.EncodeToString(key),
+	}).Context(ctx).Do()
+	if err != nil {
+		err = fmt.Errorf("Encrypt: %w", err)
+		return
+	}
+
+	wrapped, err = base64.StdEncoding.DecodeString(resp.Ciphertext)
+	if err != nil {
+		err = fmt.Errorf("decoding ciphertext: %w", err)
+		return
+	}
+
+	return
+}
+
+func (kw *kmsKeyWrapper) UnwrapKey(ctx context.Context, wrapped []byte) (key []byte, err error) {
+	resp, err := kw.keys.Decrypt(kw.keyName, &cloudkms.DecryptRequest{
+		Ciphertext: base64.StdEncoding.EncodeToString(wrapped),
+	}).Context(ctx).Do()
+	if err != nil {
+		err = fmt.Errorf("Decrypt: %w", err)
+		return
+	}
+
+	key, err = base64.StdEncoding.DecodeString(resp.Plaintext)
+	if err != nil {
+		err = fmt.Errorf("decoding plaintext: %w", err)
+		return
+	}
+
+	return
+}
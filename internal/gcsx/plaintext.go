@@ -0,0 +1,94 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"hash"
+	"hash/crc32"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+// Helpers for the buckets that store the contents of objects transformed,
+// such as encrypting and compressing buckets, and present them as they were
+// given.
+
+// plaintextChecksums keeps track of the checksums of the contents given to
+// such a bucket, which the object created from them can't be checked against.
+type plaintextChecksums struct {
+	size uint64
+	crc  uint32
+	md5  hash.Hash
+}
+
+func newPlaintextChecksums() plaintextChecksums {
+	return plaintextChecksums{md5: md5.New()}
+}
+
+func (c *plaintextChecksums) update(p []byte) {
+	c.size += uint64(len(p))
+	c.crc = crc32.Update(c.crc, crc32cTable, p)
+	c.md5.Write(p)
+}
+
+// check fails with *gcs.ChecksumMismatchError if the contents don't have the
+// checksums the object is to be created with.
+func (c *plaintextChecksums) check(req *gcs.CreateObjectRequest) error {
+	if req.CRC32C != nil && *req.CRC32C != c.crc {
+		return &gcs.ChecksumMismatchError{
+			Err: fmt.Errorf("CRC32C mismatch for %q: 0x%08x vs. 0x%08x", req.Name, c.crc, *req.CRC32C),
+		}
+	}
+
+	if req.MD5 != nil && !bytes.Equal(req.MD5[:], c.md5.Sum(nil)) {
+		return &gcs.ChecksumMismatchError{
+			Err: fmt.Errorf("MD5 mismatch for %q: %x vs. %x", req.Name, c.md5.Sum(nil), *req.MD5),
+		}
+	}
+
+	return nil
+}
+
+// statGeneration stats the object, making sure the result is for the
+// requested generation, if any.
+func statGeneration(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	name string,
+	generation int64) (m *gcs.MinObject, err error) {
+	req := &gcs.StatObjectRequest{Name: name}
+	for {
+		m, _, err = bucket.StatObject(ctx, req)
+		if err != nil {
+			return
+		}
+
+		if generation == 0 || m.Generation == generation {
+			return
+		}
+
+		if req.ForceFetchFromGcs {
+			err = &gcs.NotFoundError{
+				Err: fmt.Errorf("object %s generation %v not found", name, generation),
+			}
+			return
+		}
+		req.ForceFetchFromGcs = true
+	}
+}
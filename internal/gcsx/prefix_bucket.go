@@ -139,6 +139,27 @@ func (b *prefixBucket) CopyObject(
 	return
 }
 
+// The source bucket, if another one, is assumed to be mounted with the same
+// prefix.
+func (b *prefixBucket) RewriteObject(
+	ctx context.Context,
+	req *gcs.RewriteObjectRequest) (o *gcs.Object, err error) {
+	// Modify the request and call through.
+	mReq := new(gcs.RewriteObjectRequest)
+	*mReq = *req
+	mReq.SrcName = b.wrappedName(req.SrcName)
+	mReq.DstName = b.wrappedName(req.DstName)
+
+	o, err = b.wrapped.RewriteObject(ctx, mReq)
+
+	// Modify the returned object.
+	if o != nil {
+		o.Name = b.localName(o.Name)
+	}
+
+	return
+}
+
 func (b *prefixBucket) ComposeObjects(
 	ctx context.Context,
 	req *gcs.ComposeObjectsRequest) (o *gcs.Object, err error) {
@@ -23,9 +23,11 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
 	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/memory"
 	cacheutil "github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/gcsfuse_errors"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
@@ -33,6 +35,7 @@ import (
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
 	"github.com/jacobsa/fuse/fuseops"
 	"golang.org/x/net/context"
+	"golang.org/x/sync/semaphore"
 )
 
 // MB is 1 Megabyte. (Silly comment to make the lint warning go away)
@@ -53,6 +56,11 @@ const maxReadSize = 8 * MB
 // Minimum number of seeks before evaluating if the read pattern is random.
 const minSeeksForRandom = 2
 
+// Number of consecutive reads each starting where the previous one ended
+// before the reads of an object are taken to be sequential, and served by
+// readahead if it is enabled rather than by the memory cache.
+const minSequentialReadsForReadahead = 2
+
 // "readOp" is the value used in read context to store pointer to the read operation.
 const ReadOp = "readOp"
 
@@ -69,7 +77,8 @@ type RandomReader interface {
 
 	// ReadAt Matches the semantics of io.ReaderAt, with the addition of context
 	// support and cache support. It returns a boolean which represent either
-	// content is read from fileCache (cacheHit = true) or gcs (cacheHit = false)
+	// content is read from fileCache or memory cache (cacheHit = true) or gcs
+	// (cacheHit = false)
 	ReadAt(ctx context.Context, p []byte, offset int64) (n int, cacheHit bool, err error)
 
 	// Return the record for the object to which the reader is bound.
@@ -81,8 +90,11 @@ type RandomReader interface {
 }
 
 // NewRandomReader create a random reader for the supplied object record that
-// reads using the given bucket.
-func NewRandomReader(o *gcs.MinObject, bucket gcs.Bucket, sequentialReadSizeMb int32, fileCacheHandler *file.CacheHandler, cacheFileForRangeRead bool, metricHandle common.MetricHandle) RandomReader {
+// reads using the given bucket. Random reads that the file cache doesn't serve
+// are served by memoryCache if non-nil, and sequential ones are read ahead
+// concurrently if readConfig enables it, into buffers of which all readers
+// hold at most as many as readaheadBlocks allows.
+func NewRandomReader(o *gcs.MinObject, bucket gcs.Bucket, sequentialReadSizeMb int32, fileCacheHandler *file.CacheHandler, cacheFileForRangeRead bool, memoryCache *memory.BlockCache, readConfig *cfg.ReadConfig, readaheadBlocks *semaphore.Weighted, metricHandle common.MetricHandle) RandomReader {
 	return &randomReader{
 		object:                o,
 		bucket:                bucket,
@@ -93,6 +105,8 @@ func NewRandomReader(o *gcs.MinObject, bucket gcs.Bucket, sequentialReadSizeMb i
 		sequentialReadSizeMb:  sequentialReadSizeMb,
 		fileCacheHandler:      fileCacheHandler,
 		cacheFileForRangeRead: cacheFileForRangeRead,
+		memoryCache:           memoryCache,
+		readahead:             newReadahead(o, bucket, readConfig, readaheadBlocks, metricHandle),
 		metricHandle:          metricHandle,
 	}
 }
@@ -133,7 +147,21 @@ type randomReader struct {
 	// fileCacheHandle is used to read from the cached location. It is created on the fly
 	// using fileCacheHandler for the given object and bucket.
 	fileCacheHandle *file.CacheHandle
-	metricHandle    common.MetricHandle
+
+	// memoryCache is shared by all readers and serves the random reads that the
+	// file cache doesn't, if non-nil.
+	memoryCache *memory.BlockCache
+
+	// Serves sequential reads from GCS once there have been
+	// minSequentialReadsForReadahead of them in a row, or nil if disabled.
+	readahead *readahead
+
+	// The offset at which the previous read ended, and the number of
+	// consecutive reads so far that started at the end of the previous one.
+	nextOffset      int64
+	sequentialReads int
+
+	metricHandle common.MetricHandle
 }
 
 func (rr *randomReader) CheckInvariants() {
@@ -151,6 +179,10 @@ func (rr *randomReader) CheckInvariants() {
 	if rr.limit < 0 && rr.reader != nil {
 		panic(fmt.Sprintf("Unexpected non-nil reader with limit == %d", rr.limit))
 	}
+
+	if rr.readahead != nil {
+		rr.readahead.CheckInvariants()
+	}
 }
 
 // tryReadingFromFileCache creates the cache handle first if it doesn't exist already
@@ -286,6 +318,27 @@ func (rr *randomReader) ReadAt(
 		return
 	}
 
+	// Sequential reads are served by readahead or GCS rather than the memory
+	// cache, so that scanning an object doesn't evict the blocks that random
+	// reads come back to.
+	sequential := rr.recordRead(offset, len(p))
+	if rr.memoryCache != nil && !sequential {
+		n, cacheHit, err = rr.readFromMemoryCache(ctx, p, offset)
+		return
+	}
+
+	if rr.readahead != nil {
+		var done bool
+		n, done, err = rr.tryReadingAhead(ctx, p, offset, sequential)
+		if done {
+			return
+		}
+
+		// The rest is read from GCS.
+		p = p[n:]
+		offset += int64(n)
+	}
+
 	for len(p) > 0 {
 		// Have we blown past the end of the object?
 		if offset >= int64(rr.object.Size) {
@@ -379,6 +432,88 @@ func (rr *randomReader) ReadAt(
 	return
 }
 
+// readFromMemoryCache reads from the memory cache, which fetches what it
+// lacks from GCS.
+//
+// REQUIRES: rr.memoryCache != nil
+func (rr *randomReader) readFromMemoryCache(
+	ctx context.Context,
+	p []byte,
+	offset int64) (n int, cacheHit bool, err error) {
+	n, cacheHit, err = rr.memoryCache.Read(ctx, rr.bucket, rr.object, offset, p)
+
+	// As with startRead, a missing object means the file was clobbered.
+	var notFoundError *gcs.NotFoundError
+	switch {
+	case errors.As(err, &notFoundError):
+		err = &gcsfuse_errors.FileClobberedError{
+			Err: fmt.Errorf("memoryCache.Read: %w", err),
+		}
+
+	case err != nil && err != io.EOF:
+		err = fmt.Errorf("memoryCache.Read: %w", err)
+	}
+
+	return
+}
+
+// recordRead records a read of size bytes at offset, telling whether it's
+// one of at least minSequentialReadsForReadahead sequential reads in a row.
+func (rr *randomReader) recordRead(offset int64, size int) bool {
+	switch {
+	case offset == rr.nextOffset:
+		rr.sequentialReads++
+
+	// Reads issued concurrently by the kernel may arrive slightly out of
+	// order, but still within the blocks read ahead.
+	case rr.readahead != nil && rr.readahead.Contains(offset):
+
+	default:
+		rr.sequentialReads = 1
+	}
+
+	rr.nextOffset = offset + int64(size)
+	return rr.sequentialReads >= minSequentialReadsForReadahead
+}
+
+// tryReadingAhead serves the read with readahead if it's sequential, telling
+// whether it did. Otherwise, it discards the blocks read ahead and the read
+// must be served from GCS by the caller, from offset + n on if readahead ran
+// out of buffers after reading n bytes.
+//
+// REQUIRES: rr.readahead != nil
+func (rr *randomReader) tryReadingAhead(
+	ctx context.Context,
+	p []byte,
+	offset int64,
+	sequential bool) (n int, done bool, err error) {
+	if !sequential {
+		rr.readahead.Reset()
+		return
+	}
+
+	n, err = rr.readahead.ReadAt(ctx, p, offset)
+	rr.totalReadBytes += uint64(n)
+	if errors.Is(err, errNoReadaheadBlocks) {
+		err = nil
+		return
+	}
+
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("readahead: %w", err)
+	}
+
+	// The reader of the synchronous path won't be used for a while.
+	if rr.reader != nil {
+		rr.reader.Close()
+		rr.reader = nil
+		rr.cancel = nil
+	}
+
+	done = true
+	return
+}
+
 func (rr *randomReader) Object() (o *gcs.MinObject) {
 	o = rr.object
 	return
@@ -395,6 +530,10 @@ func (rr *randomReader) Destroy() {
 		}
 	}
 
+	if rr.readahead != nil {
+		rr.readahead.Reset()
+	}
+
 	if rr.fileCacheHandle != nil {
 		logger.Tracef("Closing cacheHandle:%p for object: %s:/%s", rr.fileCacheHandle, rr.bucket.Name(), rr.object.Name)
 		err := rr.fileCacheHandle.Close()
@@ -32,6 +32,7 @@ import (
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/memory"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/gcsfuse_errors"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
@@ -183,7 +184,7 @@ func (t *RandomReaderTest) SetUp(ti *TestInfo) {
 	t.cacheHandler = file.NewCacheHandler(lruCache, t.jobManager, t.cacheDir, util.DefaultFilePerm, util.DefaultDirPerm)
 
 	// Set up the reader.
-	rr := NewRandomReader(t.object, t.bucket, sequentialReadSizeInMb, nil, false, common.NewNoopMetrics())
+	rr := NewRandomReader(t.object, t.bucket, sequentialReadSizeInMb, nil, false, nil, nil, nil, common.NewNoopMetrics())
 	t.rr.wrapped = rr.(*randomReader)
 }
 
@@ -592,7 +593,7 @@ func (t *RandomReaderTest) UpgradesSequentialReads_NoExistingReader() {
 	t.object.Size = 1 << 40
 	const readSize = 1 * MB
 	// Set up the custom randomReader.
-	rr := NewRandomReader(t.object, t.bucket, readSize/MB, nil, false, common.NewNoopMetrics())
+	rr := NewRandomReader(t.object, t.bucket, readSize/MB, nil, false, nil, nil, nil, common.NewNoopMetrics())
 	t.rr.wrapped = rr.(*randomReader)
 
 	// Simulate a previous exhausted reader that ended at the offset from which
@@ -625,7 +626,7 @@ func (t *RandomReaderTest) SequentialReads_NoExistingReader_requestedSizeGreater
 	const chunkSize = 1 * MB
 	const readSize = 3 * MB
 	// Set up the custom randomReader.
-	rr := NewRandomReader(t.object, t.bucket, chunkSize/MB, nil, false, common.NewNoopMetrics())
+	rr := NewRandomReader(t.object, t.bucket, chunkSize/MB, nil, false, nil, nil, nil, common.NewNoopMetrics())
 	t.rr.wrapped = rr.(*randomReader)
 	// Create readers for each chunk.
 	chunk1Reader := strings.NewReader(strings.Repeat("x", chunkSize))
@@ -672,7 +673,7 @@ func (t *RandomReaderTest) SequentialReads_existingReader_requestedSizeGreaterTh
 	const chunkSize = 1 * MB
 	const readSize = 3 * MB
 	// Set up the custom randomReader.
-	rr := NewRandomReader(t.object, t.bucket, chunkSize/MB, nil, false, common.NewNoopMetrics())
+	rr := NewRandomReader(t.object, t.bucket, chunkSize/MB, nil, false, nil, nil, nil, common.NewNoopMetrics())
 	t.rr.wrapped = rr.(*randomReader)
 	// Simulate an existing reader at the correct offset, which will be exhausted
 	// by the read below.
@@ -1219,6 +1220,66 @@ func (t *RandomReaderTest) TestNewReader_FileClobbered() {
 	AssertTrue(errors.As(err, &clobberedErr))
 }
 
+func (t *RandomReaderTest) Test_ReadAt_MemoryCache() {
+	t.rr.wrapped.memoryCache = memory.NewBlockCache(MB, MB, common.NewNoopMetrics())
+	testContent := testutil.GenerateRandomBytes(int(t.object.Size))
+	ExpectCall(t.bucket, "Name")().WillRepeatedly(Return("test"))
+	// The object fits in a single block, which is fetched once.
+	ExpectCall(t.bucket, "NewReader")(Any(), AllOf(rangeStartIs(0), rangeLimitIs(t.object.Size))).
+		WillOnce(Return(getReadCloser(testContent), nil))
+	buf := make([]byte, 5)
+
+	n, cacheHit, err := t.rr.ReadAt(buf, 2)
+
+	ExpectEq(nil, err)
+	ExpectFalse(cacheHit)
+	ExpectEq(5, n)
+	ExpectTrue(reflect.DeepEqual(testContent[2:7], buf))
+
+	n, cacheHit, err = t.rr.ReadAt(buf, 14)
+
+	ExpectEq(io.EOF, err)
+	ExpectTrue(cacheHit)
+	ExpectEq(3, n)
+	ExpectTrue(reflect.DeepEqual(testContent[14:], buf[:n]))
+}
+
+func (t *RandomReaderTest) Test_ReadAt_MemoryCacheSkippedBySequentialReads() {
+	t.rr.wrapped.memoryCache = memory.NewBlockCache(MB, MB, common.NewNoopMetrics())
+	testContent := testutil.GenerateRandomBytes(int(t.object.Size))
+	ExpectCall(t.bucket, "Name")().WillRepeatedly(Return("test"))
+	ExpectCall(t.bucket, "NewReader")(Any(), AllOf(rangeStartIs(0), rangeLimitIs(t.object.Size))).
+		WillOnce(Return(getReadCloser(testContent), nil))
+	// The second read follows the first, so it's served by GCS even though the
+	// memory cache has its block.
+	ExpectCall(t.bucket, "NewReader")(Any(), rangeStartIs(5)).
+		WillOnce(Return(getReadCloser(testContent[5:]), nil))
+	buf := make([]byte, 5)
+	_, _, err := t.rr.ReadAt(buf, 0)
+	AssertEq(nil, err)
+
+	n, cacheHit, err := t.rr.ReadAt(buf, 5)
+
+	ExpectEq(nil, err)
+	ExpectFalse(cacheHit)
+	ExpectEq(5, n)
+	ExpectTrue(reflect.DeepEqual(testContent[5:10], buf))
+}
+
+func (t *RandomReaderTest) Test_ReadAt_MemoryCacheFileClobbered() {
+	t.rr.wrapped.memoryCache = memory.NewBlockCache(MB, MB, common.NewNoopMetrics())
+	var notFoundError *gcs.NotFoundError
+	ExpectCall(t.bucket, "Name")().WillRepeatedly(Return("test"))
+	ExpectCall(t.bucket, "NewReader")(Any(), Any()).
+		WillOnce(Return(nil, notFoundError))
+	buf := make([]byte, 5)
+
+	_, _, err := t.rr.ReadAt(buf, 0)
+
+	var clobberedErr *gcsfuse_errors.FileClobberedError
+	AssertTrue(errors.As(err, &clobberedErr))
+}
+
 // TODO (raj-prince) - to add unit tests for failed scenario while reading via cache.
 // This requires mocking CacheHandle object, whose read method will return some unexpected
 // error.
@@ -0,0 +1,316 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/gcsfuse_errors"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
+	"golang.org/x/net/context"
+	"golang.org/x/sync/semaphore"
+)
+
+// readahead serves the reads of a sequential reader of an object from blocks
+// fetched ahead of its cursor by concurrent ranged reads.
+//
+// The blocks form a window starting with the one containing the cursor. The
+// window starts at a single block and doubles each time a block is read to
+// its end, up to maxBlocks, so that short sequential reads don't fetch much
+// more than they need. Reading outside of the window discards it.
+//
+// Each buffer holds a unit of a semaphore shared by the readaheads of all file
+// handles. The window stops short of its size while they are all held, and
+// reads are left to the caller if it is empty.
+//
+// Not safe for concurrent access.
+type readahead struct {
+	object       *gcs.MinObject
+	bucket       gcs.Bucket
+	metricHandle common.MetricHandle
+
+	blockSize int64
+	maxBlocks int
+
+	// A semaphore bounding the number of blocks fetched at once.
+	streams chan struct{}
+
+	// A semaphore bounding the number of buffers of all readaheads, of which
+	// one unit is held for each buffer of this one.
+	globalBlocks *semaphore.Weighted
+
+	// The blocks of the window, contiguous and in order of offset.
+	//
+	// INVARIANT: For each i > 0, blocks[i].start == blocks[i-1].limit
+	// INVARIANT: len(blocks) <= window
+	blocks []*readaheadBlock
+
+	// The number of blocks that the window currently spans.
+	//
+	// INVARIANT: 1 <= window <= maxBlocks
+	window int
+
+	// Buffers of blocks that have been read, for reuse by later ones.
+	free [][]byte
+}
+
+// readaheadBlock is the range [start, limit) of the object, fetched in the
+// background.
+type readaheadBlock struct {
+	start  int64
+	limit  int64
+	cancel func()
+
+	// Closed once the fetch has finished, after which buf and err may be read.
+	done chan struct{}
+	buf  []byte
+	err  error
+}
+
+// errNoReadaheadBlocks is returned by readahead.ReadAt when the buffers of all
+// readaheads are in use, so none can be fetched.
+var errNoReadaheadBlocks = errors.New("no readahead blocks available")
+
+// newReadahead returns the readahead for the object, with buffers bounded by
+// globalBlocks, or nil if it is disabled by the config.
+func newReadahead(o *gcs.MinObject, bucket gcs.Bucket, config *cfg.ReadConfig, globalBlocks *semaphore.Weighted, metricHandle common.MetricHandle) *readahead {
+	if config == nil || !config.ExperimentalEnableReadahead {
+		return nil
+	}
+
+	return &readahead{
+		object:       o,
+		bucket:       bucket,
+		metricHandle: metricHandle,
+		blockSize:    config.ReadaheadBlockSizeMb * MB,
+		maxBlocks:    int(config.ReadaheadMaxBlocks),
+		streams:      make(chan struct{}, config.ReadaheadStreams),
+		globalBlocks: globalBlocks,
+		window:       1,
+	}
+}
+
+func (ra *readahead) CheckInvariants() {
+	for i := 1; i < len(ra.blocks); i++ {
+		if ra.blocks[i].start != ra.blocks[i-1].limit {
+			panic(fmt.Sprintf("Gap between blocks: %d vs. %d", ra.blocks[i-1].limit, ra.blocks[i].start))
+		}
+	}
+
+	if !(1 <= ra.window && ra.window <= ra.maxBlocks) {
+		panic(fmt.Sprintf("Unexpected window: %d", ra.window))
+	}
+
+	if len(ra.blocks) > ra.window {
+		panic(fmt.Sprintf("%d blocks in a window of %d", len(ra.blocks), ra.window))
+	}
+}
+
+// Contains tells whether offset lies within the window, so that reading it
+// doesn't discard the blocks fetched so far.
+func (ra *readahead) Contains(offset int64) bool {
+	return len(ra.blocks) > 0 &&
+		ra.blocks[0].start <= offset &&
+		offset < ra.blocks[len(ra.blocks)-1].limit
+}
+
+// ReadAt matches the semantics of io.ReaderAt, fetching blocks from offset on
+// unless it lies within the window. It fails with errNoReadaheadBlocks after
+// reading n bytes if the block at offset + n can't be fetched for want of
+// buffers.
+func (ra *readahead) ReadAt(ctx context.Context, p []byte, offset int64) (n int, err error) {
+	if !ra.Contains(offset) {
+		ra.Reset()
+		ra.fill(offset)
+	}
+
+	for len(p) > 0 {
+		if offset >= int64(ra.object.Size) {
+			err = io.EOF
+			return
+		}
+
+		// Skip the blocks before offset, which has been read past.
+		for len(ra.blocks) > 0 && ra.blocks[0].limit <= offset {
+			ra.release(ra.blocks[0])
+			ra.blocks = ra.blocks[1:]
+			ra.fill(offset)
+		}
+
+		if len(ra.blocks) == 0 {
+			err = errNoReadaheadBlocks
+			return
+		}
+
+		b := ra.blocks[0]
+		select {
+		case <-b.done:
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
+
+		if b.err != nil {
+			err = b.err
+			ra.Reset()
+			return
+		}
+
+		tmp := copy(p, b.buf[offset-b.start:])
+		n += tmp
+		p = p[tmp:]
+		offset += int64(tmp)
+
+		// Having read the block to its end, the reader is sequential enough to
+		// fetch further ahead.
+		if offset == b.limit {
+			ra.window = min(2*ra.window, ra.maxBlocks)
+			ra.release(b)
+			ra.blocks = ra.blocks[1:]
+			ra.fill(offset)
+		}
+	}
+
+	return
+}
+
+// Reset discards the window, cancelling the fetches in flight, and gives up
+// the free buffers.
+func (ra *readahead) Reset() {
+	for _, b := range ra.blocks {
+		ra.release(b)
+	}
+	ra.blocks = nil
+	ra.window = 1
+
+	ra.globalBlocks.Release(int64(len(ra.free)))
+	ra.free = nil
+}
+
+// fill starts fetching blocks until the window is full, reaches the end of the
+// object or no buffer is available, with the first at offset if the window is
+// empty.
+func (ra *readahead) fill(offset int64) {
+	start := offset
+	if len(ra.blocks) > 0 {
+		start = ra.blocks[len(ra.blocks)-1].limit
+	}
+
+	for len(ra.blocks) < ra.window && start < int64(ra.object.Size) {
+		limit := min(start+ra.blockSize, int64(ra.object.Size))
+		buf := ra.allocate(limit - start)
+		if buf == nil {
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		b := &readaheadBlock{
+			start:  start,
+			limit:  limit,
+			cancel: cancel,
+			done:   make(chan struct{}),
+			buf:    buf,
+		}
+		go ra.fetch(ctx, b)
+
+		ra.blocks = append(ra.blocks, b)
+		start = limit
+	}
+}
+
+// fetch reads the range of the block into its buffer, waiting for one of the
+// streams to be free.
+func (ra *readahead) fetch(ctx context.Context, b *readaheadBlock) {
+	defer close(b.done)
+
+	select {
+	case ra.streams <- struct{}{}:
+		defer func() { <-ra.streams }()
+	case <-ctx.Done():
+		b.err = ctx.Err()
+		return
+	}
+
+	rc, err := ra.bucket.NewReader(
+		ctx,
+		&gcs.ReadObjectRequest{
+			Name:       ra.object.Name,
+			Generation: ra.object.Generation,
+			Range: &gcs.ByteRange{
+				Start: uint64(b.start),
+				Limit: uint64(b.limit),
+			},
+			ReadCompressed: ra.object.HasContentEncodingGzip(),
+		})
+
+	// As with startRead, a missing object means the file was clobbered.
+	var notFoundError *gcs.NotFoundError
+	if errors.As(err, &notFoundError) {
+		b.err = &gcsfuse_errors.FileClobberedError{
+			Err: fmt.Errorf("NewReader: %w", err),
+		}
+		return
+	}
+
+	if err != nil {
+		b.err = fmt.Errorf("NewReader: %w", err)
+		return
+	}
+	defer rc.Close()
+
+	common.CaptureGCSReadMetrics(ctx, ra.metricHandle, util.Sequential, b.limit-b.start)
+
+	if _, err = io.ReadFull(rc, b.buf); err != nil {
+		b.err = fmt.Errorf("reading [%d, %d): %w", b.start, b.limit, err)
+	}
+}
+
+// allocate returns a buffer of the given size, reusing a free one if any. It
+// returns nil if there is none and the buffers of all readaheads are in use.
+func (ra *readahead) allocate(size int64) []byte {
+	if n := len(ra.free); n > 0 {
+		buf := ra.free[n-1]
+		ra.free = ra.free[:n-1]
+		return buf[:size]
+	}
+
+	if !ra.globalBlocks.TryAcquire(1) {
+		return nil
+	}
+
+	return make([]byte, size, ra.blockSize)
+}
+
+// release cancels the fetch of the block, and frees its buffer unless the
+// fetch may still be writing to it, in which case the buffer is given up once
+// the fetch has finished.
+func (ra *readahead) release(b *readaheadBlock) {
+	b.cancel()
+
+	select {
+	case <-b.done:
+		ra.free = append(ra.free, b.buf)
+	default:
+		go func() {
+			<-b.done
+			ra.globalBlocks.Release(1)
+		}()
+	}
+}
@@ -0,0 +1,371 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/gcsfuse_errors"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+	"golang.org/x/sync/semaphore"
+)
+
+const testReadaheadBlockSize = 10
+
+// streamCountingBucket records the largest number of readers of its objects
+// open at once, each of which stays open until unblocked.
+type streamCountingBucket struct {
+	gcs.Bucket
+
+	mu        sync.Mutex
+	open      int
+	maxOpen   int
+	unblocked chan struct{}
+}
+
+func (b *streamCountingBucket) maxOpenReaders() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.maxOpen
+}
+
+type countedReader struct {
+	io.ReadCloser
+	b *streamCountingBucket
+}
+
+func (r *countedReader) Close() error {
+	r.b.mu.Lock()
+	r.b.open--
+	r.b.mu.Unlock()
+	return r.ReadCloser.Close()
+}
+
+func (b *streamCountingBucket) NewReader(ctx context.Context, req *gcs.ReadObjectRequest) (io.ReadCloser, error) {
+	b.mu.Lock()
+	b.open++
+	b.maxOpen = max(b.maxOpen, b.open)
+	b.mu.Unlock()
+
+	<-b.unblocked
+	rc, err := b.Bucket.NewReader(ctx, req)
+	if err != nil {
+		b.mu.Lock()
+		b.open--
+		b.mu.Unlock()
+		return nil, err
+	}
+	return &countedReader{ReadCloser: rc, b: b}, nil
+}
+
+type ReadaheadTest struct {
+	suite.Suite
+	ctx      context.Context
+	bucket   *streamCountingBucket
+	object   *gcs.MinObject
+	contents []byte
+	// Shared by the readaheads created by the test.
+	globalBlocks *semaphore.Weighted
+	ra           *readahead
+}
+
+func TestReadaheadSuite(t *testing.T) {
+	suite.Run(t, new(ReadaheadTest))
+}
+
+func (t *ReadaheadTest) SetupTest() {
+	t.ctx = context.Background()
+	t.bucket = &streamCountingBucket{
+		Bucket:    fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical),
+		unblocked: make(chan struct{}),
+	}
+	close(t.bucket.unblocked)
+	t.contents = make([]byte, 10*testReadaheadBlockSize+5)
+	for i := range t.contents {
+		t.contents[i] = byte(i)
+	}
+	o, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:     "foo",
+		Contents: bytes.NewReader(t.contents),
+	})
+	require.NoError(t.T(), err)
+	t.object = &gcs.MinObject{Name: o.Name, Size: o.Size, Generation: o.Generation}
+	t.globalBlocks = semaphore.NewWeighted(100)
+	t.ra = t.newReadahead(4, 2)
+}
+
+func (t *ReadaheadTest) newReadahead(maxBlocks, streams int64) *readahead {
+	ra := newReadahead(t.object, t.bucket, &cfg.ReadConfig{
+		ExperimentalEnableReadahead: true,
+		ReadaheadBlockSizeMb:        1,
+		ReadaheadMaxBlocks:          maxBlocks,
+		ReadaheadStreams:            streams,
+	}, t.globalBlocks, common.NewNoopMetrics())
+	ra.blockSize = testReadaheadBlockSize
+	return ra
+}
+
+func (t *ReadaheadTest) TearDownTest() {
+	t.ra.Reset()
+}
+
+func (t *ReadaheadTest) TestDisabled() {
+	assert.Nil(t.T(), newReadahead(t.object, t.bucket, nil, t.globalBlocks, common.NewNoopMetrics()))
+	assert.Nil(t.T(), newReadahead(t.object, t.bucket, &cfg.ReadConfig{}, t.globalBlocks, common.NewNoopMetrics()))
+}
+
+func (t *ReadaheadTest) TestSequentialReads() {
+	var read []byte
+	for offset := int64(0); ; {
+		p := make([]byte, 7)
+		n, err := t.ra.ReadAt(t.ctx, p, offset)
+		t.ra.CheckInvariants()
+		read = append(read, p[:n]...)
+		offset += int64(n)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t.T(), err)
+		require.Equal(t.T(), 7, n)
+	}
+
+	assert.Equal(t.T(), t.contents, read)
+}
+
+func (t *ReadaheadTest) TestReadSpanningBlocks() {
+	p := make([]byte, 3*testReadaheadBlockSize)
+
+	n, err := t.ra.ReadAt(t.ctx, p, 5)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), len(p), n)
+	assert.Equal(t.T(), t.contents[5:5+len(p)], p)
+}
+
+func (t *ReadaheadTest) TestWindowGrows() {
+	p := make([]byte, testReadaheadBlockSize)
+	var windows []int
+	for offset := int64(0); offset < 4*testReadaheadBlockSize; offset += testReadaheadBlockSize {
+		_, err := t.ra.ReadAt(t.ctx, p, offset)
+		require.NoError(t.T(), err)
+		windows = append(windows, len(t.ra.blocks))
+	}
+
+	assert.Equal(t.T(), []int{2, 4, 4, 4}, windows)
+	assert.EqualValues(t.T(), 4*testReadaheadBlockSize, t.ra.blocks[0].start)
+}
+
+func (t *ReadaheadTest) TestWindowStopsAtEndOfObject() {
+	p := make([]byte, testReadaheadBlockSize)
+	for offset := int64(0); offset < 9*testReadaheadBlockSize; offset += testReadaheadBlockSize {
+		_, err := t.ra.ReadAt(t.ctx, p, offset)
+		require.NoError(t.T(), err)
+	}
+
+	require.Len(t.T(), t.ra.blocks, 2)
+	assert.EqualValues(t.T(), t.object.Size, t.ra.blocks[1].limit)
+}
+
+func (t *ReadaheadTest) TestReadOutsideWindowResets() {
+	p := make([]byte, testReadaheadBlockSize)
+	for offset := int64(0); offset < 2*testReadaheadBlockSize; offset += testReadaheadBlockSize {
+		_, err := t.ra.ReadAt(t.ctx, p, offset)
+		require.NoError(t.T(), err)
+	}
+	require.False(t.T(), t.ra.Contains(8*testReadaheadBlockSize))
+
+	n, err := t.ra.ReadAt(t.ctx, p[:3], 8*testReadaheadBlockSize+2)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), t.contents[8*testReadaheadBlockSize+2:8*testReadaheadBlockSize+5], p[:n])
+	require.Len(t.T(), t.ra.blocks, 1)
+	assert.EqualValues(t.T(), 8*testReadaheadBlockSize+2, t.ra.blocks[0].start)
+	assert.Equal(t.T(), 1, t.ra.window)
+}
+
+func (t *ReadaheadTest) TestReadWithinWindowKeepsIt() {
+	p := make([]byte, testReadaheadBlockSize)
+	_, err := t.ra.ReadAt(t.ctx, p, 0)
+	require.NoError(t.T(), err)
+	require.True(t.T(), t.ra.Contains(testReadaheadBlockSize+3))
+
+	n, err := t.ra.ReadAt(t.ctx, p, testReadaheadBlockSize+3)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), t.contents[testReadaheadBlockSize+3:2*testReadaheadBlockSize+3], p[:n])
+	assert.Equal(t.T(), 4, t.ra.window)
+}
+
+func (t *ReadaheadTest) TestReadAtEndOfObject() {
+	p := make([]byte, testReadaheadBlockSize)
+
+	n, err := t.ra.ReadAt(t.ctx, p, int64(t.object.Size)-3)
+
+	assert.Equal(t.T(), io.EOF, err)
+	assert.Equal(t.T(), t.contents[len(t.contents)-3:], p[:n])
+
+	n, err = t.ra.ReadAt(t.ctx, p, int64(t.object.Size))
+
+	assert.Equal(t.T(), io.EOF, err)
+	assert.Zero(t.T(), n)
+}
+
+func (t *ReadaheadTest) TestConcurrentStreamsAreBounded() {
+	t.bucket.unblocked = make(chan struct{})
+	t.ra = t.newReadahead(8, 2)
+	p := make([]byte, testReadaheadBlockSize)
+	// Let the first reads through one at a time, keeping the others waiting.
+	go func() {
+		for i := 0; i < 3; i++ {
+			t.bucket.unblocked <- struct{}{}
+		}
+		close(t.bucket.unblocked)
+	}()
+
+	for offset := int64(0); offset < 8*testReadaheadBlockSize; offset += testReadaheadBlockSize {
+		_, err := t.ra.ReadAt(t.ctx, p, offset)
+		require.NoError(t.T(), err)
+	}
+
+	assert.LessOrEqual(t.T(), t.bucket.maxOpenReaders(), 2)
+}
+
+func (t *ReadaheadTest) TestBlocksAreBoundedAcrossReadaheads() {
+	t.globalBlocks = semaphore.NewWeighted(2)
+	t.ra = t.newReadahead(4, 2)
+	other := t.newReadahead(4, 2)
+	defer other.Reset()
+	p := make([]byte, testReadaheadBlockSize)
+
+	// The window doesn't grow past the blocks available.
+	var read []byte
+	for offset := int64(0); offset < 6*testReadaheadBlockSize; offset += testReadaheadBlockSize {
+		n, err := t.ra.ReadAt(t.ctx, p, offset)
+		require.NoError(t.T(), err)
+		read = append(read, p[:n]...)
+		assert.LessOrEqual(t.T(), len(t.ra.blocks), 2)
+	}
+	assert.Equal(t.T(), t.contents[:6*testReadaheadBlockSize], read)
+
+	// Another readahead gets none while they are held.
+	n, err := other.ReadAt(t.ctx, p, 0)
+	assert.ErrorIs(t.T(), err, errNoReadaheadBlocks)
+	assert.Zero(t.T(), n)
+
+	// They are given up once the fetches have finished.
+	for _, b := range t.ra.blocks {
+		<-b.done
+	}
+	t.ra.Reset()
+	n, err = other.ReadAt(t.ctx, p, 0)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), t.contents[:n], p[:n])
+}
+
+func (t *ReadaheadTest) TestClobberedObject() {
+	err := t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "foo"})
+	require.NoError(t.T(), err)
+	p := make([]byte, testReadaheadBlockSize)
+
+	_, err = t.ra.ReadAt(t.ctx, p, 0)
+
+	var clobberedErr *gcsfuse_errors.FileClobberedError
+	assert.True(t.T(), errors.As(err, &clobberedErr))
+	assert.Empty(t.T(), t.ra.blocks)
+}
+
+func (t *ReadaheadTest) TestCancelledRead() {
+	t.bucket.unblocked = make(chan struct{})
+	ctx, cancel := context.WithCancel(t.ctx)
+	cancel()
+	p := make([]byte, testReadaheadBlockSize)
+
+	_, err := t.ra.ReadAt(ctx, p, 0)
+
+	assert.ErrorIs(t.T(), err, context.Canceled)
+	// The fetch is still in flight, and serves the retried read.
+	require.Len(t.T(), t.ra.blocks, 1)
+	close(t.bucket.unblocked)
+	n, err := t.ra.ReadAt(t.ctx, p, 0)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), t.contents[:n], p[:n])
+}
+
+func (t *ReadaheadTest) TestRandomReaderReadsAheadSequentialReads() {
+	rr := NewRandomReader(t.object, t.bucket, 200, nil, false, nil, &cfg.ReadConfig{
+		ExperimentalEnableReadahead: true,
+		ReadaheadBlockSizeMb:        1,
+		ReadaheadMaxBlocks:          4,
+		ReadaheadStreams:            2,
+	}, t.globalBlocks, common.NewNoopMetrics()).(*randomReader)
+	defer rr.Destroy()
+	rr.readahead.blockSize = testReadaheadBlockSize
+	p := make([]byte, 7)
+
+	// The first read is served synchronously.
+	n, _, err := rr.ReadAt(t.ctx, p, 0)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), t.contents[:7], p[:n])
+	assert.NotNil(t.T(), rr.reader)
+	assert.Empty(t.T(), rr.readahead.blocks)
+
+	// The second, sequential one by readahead.
+	n, _, err = rr.ReadAt(t.ctx, p, 7)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), t.contents[7:14], p[:n])
+	assert.Nil(t.T(), rr.reader)
+	assert.NotEmpty(t.T(), rr.readahead.blocks)
+	rr.CheckInvariants()
+
+	// A seek goes back to the synchronous path.
+	n, _, err = rr.ReadAt(t.ctx, p, 90)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), t.contents[90:97], p[:n])
+	assert.NotNil(t.T(), rr.reader)
+	assert.Empty(t.T(), rr.readahead.blocks)
+}
+
+func (t *ReadaheadTest) TestRandomReaderFallsBackWithoutReadaheadBlocks() {
+	rr := NewRandomReader(t.object, t.bucket, 200, nil, false, nil, &cfg.ReadConfig{
+		ExperimentalEnableReadahead: true,
+		ReadaheadBlockSizeMb:        1,
+		ReadaheadMaxBlocks:          4,
+		ReadaheadStreams:            2,
+	}, semaphore.NewWeighted(0), common.NewNoopMetrics()).(*randomReader)
+	defer rr.Destroy()
+	rr.readahead.blockSize = testReadaheadBlockSize
+	p := make([]byte, 7)
+
+	// Sequential reads are served synchronously.
+	for offset := int64(0); offset < 21; offset += 7 {
+		n, _, err := rr.ReadAt(t.ctx, p, offset)
+		require.NoError(t.T(), err)
+		assert.Equal(t.T(), t.contents[offset:offset+7], p[:n])
+		assert.NotNil(t.T(), rr.reader)
+		assert.Empty(t.T(), rr.readahead.blocks)
+	}
+}
@@ -15,11 +15,16 @@
 package gcsx
 
 import (
+	"bytes"
+	"crypto/md5"
 	"fmt"
 	"io"
 	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
 	"golang.org/x/net/context"
 )
 
@@ -28,6 +33,21 @@ import (
 // by time.RFC3339Nano.
 const MtimeMetadataKey = "gcsfuse_mtime"
 
+// Once the source object has this many components, we stop composing onto it
+// and rewrite it in full instead, which flattens it into a single component.
+// The margin below gcs.MaxComponentCount leaves room for the components of the
+// compose itself and for other writers composing onto the object.
+const flattenComponentCount = gcs.MaxComponentCount - 24
+
+// The strategies by which SyncObject writes out content, as recorded in the
+// sync count metric.
+const (
+	syncStrategyFull    = "full"
+	syncStrategyAppend  = "append"
+	syncStrategyFlatten = "flatten"
+	syncStrategyMtime   = "mtime"
+)
+
 // Syncer is safe for concurrent access.
 type Syncer interface {
 	// Given an object record and content that was originally derived from that
@@ -35,40 +55,62 @@ type Syncer interface {
 	//
 	// *   If the temp file has not been modified, return a nil new object.
 	//
+	// *   If it has been rewritten with the same bytes, update the mtime in the
+	//     metadata of the source object.
+	//
 	// *   Otherwise, write out a new generation in the bucket (failing with
-	//     *gcs.PreconditionError if the source generation is no longer current).
+	//     *gcs.PreconditionError if the source generation is no longer current,
+	//     or *gcs.ChecksumMismatchError if it doesn't have the CRC32C of the
+	//     content).
 	SyncObject(
 		ctx context.Context,
 		fileName string,
 		srcObject *gcs.Object,
 		content TempFile) (o *gcs.Object, err error)
+
+	// SyncNewObject writes out content as a new object, as SyncObject does
+	// given a nil source object, with the supplied custom metadata in addition.
+	SyncNewObject(
+		ctx context.Context,
+		fileName string,
+		metadata map[string]string,
+		content TempFile) (o *gcs.Object, err error)
 }
 
 // NewSyncer creates a syncer that syncs into the supplied bucket.
 //
 // When the source object has been changed only by appending, and the source
 // object's size is at least appendThreshold, we will "append" to it by writing
-// out a temporary blob and composing it with the source object.
+// out a temporary blob and composing it with the source object. Source objects
+// close to the limit on the number of components are rewritten in full
+// instead, so that appending to a file forever doesn't run into that limit.
 //
 // Temporary blobs have names beginning with tmpObjectPrefix. We make an effort
 // to delete them, but if we are interrupted for some reason we may not be able
 // to do so. Therefore the user should arrange for garbage collection.
+//
+// The attributes that the objects written out would otherwise lack are taken
+// from the first of objectDefaults that applies to them.
 func NewSyncer(
 	appendThreshold int64,
 	chunkTransferTimeoutSecs int64,
 	tmpObjectPrefix string,
-	bucket gcs.Bucket) (os Syncer) {
+	objectDefaults []cfg.ObjectDefaults,
+	bucket gcs.Bucket,
+	metricHandle common.MetricHandle) (os Syncer) {
 	// Create the object creators.
 	fullCreator := &fullObjectCreator{
-		bucket: bucket,
+		bucket:         bucket,
+		objectDefaults: objectDefaults,
 	}
 
 	appendCreator := newAppendObjectCreator(
 		tmpObjectPrefix,
+		objectDefaults,
 		bucket)
 
 	// And the syncer.
-	os = newSyncer(appendThreshold, chunkTransferTimeoutSecs, fullCreator, appendCreator)
+	os = newSyncer(appendThreshold, chunkTransferTimeoutSecs, bucket, fullCreator, appendCreator, metricHandle)
 
 	return
 }
@@ -78,14 +120,17 @@ func NewSyncer(
 ////////////////////////////////////////////////////////////////////////
 
 type fullObjectCreator struct {
-	bucket gcs.Bucket
+	bucket         gcs.Bucket
+	objectDefaults []cfg.ObjectDefaults
 }
 
 func (oc *fullObjectCreator) Create(
 	ctx context.Context,
 	objectName string,
 	srcObject *gcs.Object,
+	metadata map[string]string,
 	mtime *time.Time,
+	crc32c *uint32,
 	chunkTransferTimeoutSecs int64,
 	r io.Reader) (o *gcs.Object, err error) {
 	metadataMap := make(map[string]string)
@@ -97,6 +142,7 @@ func (oc *fullObjectCreator) Create(
 			Name:                     objectName,
 			Contents:                 r,
 			GenerationPrecondition:   &precond,
+			CRC32C:                   crc32c,
 			Metadata:                 metadataMap,
 			ChunkTransferTimeoutSecs: chunkTransferTimeoutSecs,
 		}
@@ -109,6 +155,7 @@ func (oc *fullObjectCreator) Create(
 			Name:                       srcObject.Name,
 			GenerationPrecondition:     &srcObject.Generation,
 			MetaGenerationPrecondition: &srcObject.MetaGeneration,
+			CRC32C:                     crc32c,
 			Contents:                   r,
 			Metadata:                   metadataMap,
 			CacheControl:               srcObject.CacheControl,
@@ -122,11 +169,17 @@ func (oc *fullObjectCreator) Create(
 		}
 	}
 
+	for key, value := range metadata {
+		metadataMap[key] = value
+	}
+
 	// Any existing mtime value will be overwritten with new value.
 	if mtime != nil {
 		metadataMap[MtimeMetadataKey] = mtime.UTC().Format(time.RFC3339Nano)
 	}
 
+	storageutil.ApplyObjectDefaults(oc.objectDefaults, req)
+
 	o, err = oc.bucket.CreateObject(ctx, req)
 	if err != nil {
 		err = fmt.Errorf("CreateObject: %w", err)
@@ -146,7 +199,9 @@ type objectCreator interface {
 		ctx context.Context,
 		objectName string,
 		srcObject *gcs.Object,
+		metadata map[string]string,
 		mtime *time.Time,
+		crc32c *uint32,
 		chunkTransferTimeoutSecs int64,
 		r io.Reader) (o *gcs.Object, err error)
 }
@@ -160,6 +215,13 @@ type objectCreator interface {
 //   - appendCreator accepts the source object and the contents that should be
 //     "appended" to it.
 //
+// Content rewritten with the bytes of the source object is not written out
+// again; only the mtime in the metadata of the source object is updated, in
+// bucket.
+//
+// Each creator is given the CRC32C of the full content, which the new
+// generation must have.
+//
 // appendThreshold controls the source object length at which we consider it
 // worthwhile to make the append optimization. It should be set to a value on
 // the order of the bandwidth to GCS times three times the round trip latency
@@ -167,13 +229,17 @@ type objectCreator interface {
 func newSyncer(
 	appendThreshold int64,
 	chunkTransferTimeoutSecs int64,
+	bucket gcs.Bucket,
 	fullCreator objectCreator,
-	appendCreator objectCreator) (os Syncer) {
+	appendCreator objectCreator,
+	metricHandle common.MetricHandle) (os Syncer) {
 	os = &syncer{
 		appendThreshold:          appendThreshold,
 		chunkTransferTimeoutSecs: chunkTransferTimeoutSecs,
+		bucket:                   bucket,
 		fullCreator:              fullCreator,
 		appendCreator:            appendCreator,
+		metricHandle:             metricHandle,
 	}
 
 	return
@@ -182,8 +248,10 @@ func newSyncer(
 type syncer struct {
 	appendThreshold          int64
 	chunkTransferTimeoutSecs int64
+	bucket                   gcs.Bucket
 	fullCreator              objectCreator
 	appendCreator            objectCreator
+	metricHandle             common.MetricHandle
 }
 
 func (os *syncer) SyncObject(
@@ -201,14 +269,8 @@ func (os *syncer) SyncObject(
 	// Local files are not present on GCS, hence only fullCreator is
 	// invoked and append flow is never triggered.
 	if srcObject == nil {
-		// Content.Stat() seeks the current position to end of file. Seek it back
-		// to beginning of the file.
-		_, err = content.Seek(0, 0)
-		if err != nil {
-			err = fmt.Errorf("error in seeking: %w", err)
-			return
-		}
-		return os.fullCreator.Create(ctx, objectName, srcObject, sr.Mtime, os.chunkTransferTimeoutSecs, content)
+		o, err = os.createObject(ctx, objectName, nil, sr, content)
+		return
 	}
 
 	// Make sure the dirty threshold makes sense.
@@ -236,27 +298,58 @@ func (os *syncer) SyncObject(
 		return
 	}
 
+	// The checksum of the content is checked against the new generation, so
+	// that data corrupted on its way to GCS is caught.
+	crc, err := content.Checksum()
+	if err != nil {
+		err = fmt.Errorf("checksum: %w", err)
+		return
+	}
+
+	// Tools that save files without changing them rewrite the same bytes, in
+	// which case only the mtime needs updating.
+	var unchanged bool
+	unchanged, err = sameContent(sr, crc, srcObject, content)
+	if err != nil {
+		return
+	}
+
+	if unchanged {
+		o, err = os.updateMtime(ctx, srcObject, *sr.Mtime)
+		if err == nil {
+			os.recordSync(ctx, syncStrategyMtime)
+		}
+		return
+	}
+
 	// Otherwise, we need to create a new generation. If the source object is
 	// long enough, hasn't been dirtied, and has a low enough component count,
 	// then we can make the optimization of not rewriting its contents.
+	var strategy string
 	if srcSize >= os.appendThreshold &&
 		sr.DirtyThreshold == srcSize &&
-		srcObject.ComponentCount < gcs.MaxComponentCount {
+		srcObject.ComponentCount < flattenComponentCount {
+		strategy = syncStrategyAppend
 		_, err = content.Seek(srcSize, 0)
 		if err != nil {
 			err = fmt.Errorf("seek: %w", err)
 			return
 		}
 
-		o, err = os.appendCreator.Create(ctx, objectName, srcObject, sr.Mtime, os.chunkTransferTimeoutSecs, content)
+		o, err = os.appendCreator.Create(ctx, objectName, srcObject, nil, sr.Mtime, &crc, os.chunkTransferTimeoutSecs, content)
 	} else {
+		strategy = syncStrategyFull
+		if srcObject.ComponentCount >= flattenComponentCount {
+			strategy = syncStrategyFlatten
+		}
+
 		_, err = content.Seek(0, 0)
 		if err != nil {
 			err = fmt.Errorf("seek: %w", err)
 			return
 		}
 
-		o, err = os.fullCreator.Create(ctx, objectName, srcObject, sr.Mtime, os.chunkTransferTimeoutSecs, content)
+		o, err = os.fullCreator.Create(ctx, objectName, srcObject, nil, sr.Mtime, &crc, os.chunkTransferTimeoutSecs, content)
 	}
 
 	// Deal with errors.
@@ -265,5 +358,128 @@ func (os *syncer) SyncObject(
 		return
 	}
 
+	os.recordSync(ctx, strategy)
+	return
+}
+
+func (os *syncer) SyncNewObject(
+	ctx context.Context,
+	objectName string,
+	metadata map[string]string,
+	content TempFile) (o *gcs.Object, err error) {
+	sr, err := content.Stat()
+	if err != nil {
+		err = fmt.Errorf("stat: %w", err)
+		return
+	}
+
+	o, err = os.createObject(ctx, objectName, metadata, sr, content)
+	return
+}
+
+// createObject writes out content, of which sr is the stat result, as a new
+// object.
+func (os *syncer) createObject(
+	ctx context.Context,
+	objectName string,
+	metadata map[string]string,
+	sr StatResult,
+	content TempFile) (o *gcs.Object, err error) {
+	crc, err := content.Checksum()
+	if err != nil {
+		err = fmt.Errorf("checksum: %w", err)
+		return
+	}
+
+	// Content.Stat() seeks the current position to end of file. Seek it back
+	// to beginning of the file.
+	_, err = content.Seek(0, 0)
+	if err != nil {
+		err = fmt.Errorf("error in seeking: %w", err)
+		return
+	}
+
+	o, err = os.fullCreator.Create(ctx, objectName, nil, metadata, sr.Mtime, &crc, os.chunkTransferTimeoutSecs, content)
+	if err == nil {
+		os.recordSync(ctx, syncStrategyFull)
+	}
 	return
 }
+
+// sameContent reports whether content, of which sr is the stat result and crc
+// the CRC32C, is the same as that of srcObject. A 32-bit checksum is too weak
+// to go by alone, so the MD5 hashes must agree as well. Composite objects have
+// no MD5 hash, and are never taken to be the same.
+func sameContent(
+	sr StatResult,
+	crc uint32,
+	srcObject *gcs.Object,
+	content TempFile) (same bool, err error) {
+	if sr.Size != int64(srcObject.Size) ||
+		srcObject.CRC32C == nil ||
+		crc != *srcObject.CRC32C ||
+		srcObject.MD5 == nil {
+		return
+	}
+
+	_, err = content.Seek(0, 0)
+	if err != nil {
+		err = fmt.Errorf("seek: %w", err)
+		return
+	}
+
+	h := md5.New()
+	_, err = io.Copy(h, content)
+	if err != nil {
+		err = fmt.Errorf("md5: %w", err)
+		return
+	}
+
+	same = bytes.Equal(h.Sum(nil), srcObject.MD5[:])
+	return
+}
+
+// updateMtime records mtime in the metadata of the source object, failing
+// with *gcs.PreconditionError if it has changed in the meantime.
+func (os *syncer) updateMtime(
+	ctx context.Context,
+	srcObject *gcs.Object,
+	mtime time.Time) (o *gcs.Object, err error) {
+	formatted := mtime.UTC().Format(time.RFC3339Nano)
+	o, err = os.bucket.UpdateObject(ctx, &gcs.UpdateObjectRequest{
+		Name:                       srcObject.Name,
+		Generation:                 srcObject.Generation,
+		MetaGenerationPrecondition: &srcObject.MetaGeneration,
+		Metadata: map[string]*string{
+			MtimeMetadataKey: &formatted,
+		},
+	})
+	if err != nil {
+		err = fmt.Errorf("UpdateObject: %w", err)
+		return
+	}
+
+	return
+}
+
+// checkCRC32C fails with *gcs.ChecksumMismatchError if the object created
+// from the content doesn't have the content's checksum. Nothing is checked if
+// either checksum is unknown.
+func checkCRC32C(o *gcs.Object, crc32c *uint32) error {
+	if o == nil || o.CRC32C == nil || crc32c == nil || *o.CRC32C == *crc32c {
+		return nil
+	}
+
+	return &gcs.ChecksumMismatchError{
+		Err: fmt.Errorf(
+			"object %q generation %d has CRC32C 0x%08x, the content has 0x%08x",
+			o.Name,
+			o.Generation,
+			*o.CRC32C,
+			*crc32c),
+	}
+}
+
+func (os *syncer) recordSync(ctx context.Context, strategy string) {
+	os.metricHandle.GCSSyncCount(ctx, 1, []common.MetricAttr{{Key: common.SyncStrategy, Value: strategy}})
+}
@@ -15,22 +15,46 @@
 package gcsx
 
 import (
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 )
 
 type SyncerBucket struct {
 	gcs.Bucket
 	Syncer
+
+	tmpObjectPrefix          string
+	chunkTransferTimeoutSecs int64
 }
 
 // NewSyncerBucket creates a SyncerBucket, which can be used either as
-// a gcs.Bucket, or as a Syncer.
+// a gcs.Bucket, or as a Syncer. See NewSyncer for the parameters.
 func NewSyncerBucket(
 	appendThreshold int64,
 	chunkTransferTimeoutSecs int64,
 	tmpObjectPrefix string,
+	objectDefaults []cfg.ObjectDefaults,
 	bucket gcs.Bucket,
+	metricHandle common.MetricHandle,
 ) SyncerBucket {
-	syncer := NewSyncer(appendThreshold, chunkTransferTimeoutSecs, tmpObjectPrefix, bucket)
-	return SyncerBucket{bucket, syncer}
+	syncer := NewSyncer(appendThreshold, chunkTransferTimeoutSecs, tmpObjectPrefix, objectDefaults, bucket, metricHandle)
+	return SyncerBucket{
+		Bucket:                   bucket,
+		Syncer:                   syncer,
+		tmpObjectPrefix:          tmpObjectPrefix,
+		chunkTransferTimeoutSecs: chunkTransferTimeoutSecs,
+	}
+}
+
+// TmpObjectPrefix returns the prefix of the names of temporary objects, which
+// are garbage collected if left behind.
+func (sb SyncerBucket) TmpObjectPrefix() string {
+	return sb.tmpObjectPrefix
+}
+
+// ChunkTransferTimeoutSecs returns the timeout of each chunk of data that
+// uploads send to GCS, or zero for none.
+func (sb SyncerBucket) ChunkTransferTimeoutSecs() int64 {
+	return sb.chunkTransferTimeoutSecs
 }
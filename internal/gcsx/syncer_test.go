@@ -16,11 +16,14 @@ package gcsx
 
 import (
 	"errors"
+	"hash/crc32"
 	"io"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
@@ -45,6 +48,7 @@ type FullObjectCreatorTest struct {
 	srcObject   gcs.Object
 	srcContents string
 	mtime       time.Time
+	crc32c      *uint32
 }
 
 func init() { RegisterTestSuite(&FullObjectCreatorTest{}) }
@@ -66,7 +70,9 @@ func (t *FullObjectCreatorTest) call() (o *gcs.Object, err error) {
 		t.ctx,
 		t.srcObject.Name,
 		&t.srcObject,
+		nil,
 		&t.mtime,
+		t.crc32c,
 		chunkTransferTimeoutSecs,
 		strings.NewReader(t.srcContents))
 
@@ -96,6 +102,23 @@ func (t *FullObjectCreatorTest) CallsCreateObject() {
 	ExpectEq(t.srcContents, string(b))
 }
 
+func (t *FullObjectCreatorTest) CallsCreateObjectWithCRC32C() {
+	t.srcContents = "taco"
+	crc := crc32.Checksum([]byte(t.srcContents), crc32cTable)
+	t.crc32c = &crc
+
+	// CreateObject
+	var req *gcs.CreateObjectRequest
+	ExpectCall(t.bucket, "CreateObject")(Any(), Any()).
+		WillOnce(DoAll(SaveArg(1, &req), Return(nil, errors.New(""))))
+
+	// Call
+	t.call()
+
+	AssertNe(nil, req)
+	ExpectThat(req.CRC32C, Pointee(Equals(crc)))
+}
+
 func (t *FullObjectCreatorTest) CreateObjectFails() {
 	var err error
 
@@ -175,7 +198,9 @@ func (t *FullObjectCreatorTest) CallsCreateObjectWhenSrcObjectIsNil() {
 		t.ctx,
 		t.srcObject.Name,
 		nil,
+		nil,
 		&t.mtime,
+		nil,
 		chunkTransferTimeoutSecs,
 		strings.NewReader(t.srcContents))
 
@@ -196,6 +221,8 @@ func (t *FullObjectCreatorTest) CallsCreateObjectWhenSrcObjectAndMtimeAreNil() {
 		t.srcObject.Name,
 		nil,
 		nil,
+		nil,
+		nil,
 		chunkTransferTimeoutSecs,
 		strings.NewReader(t.srcContents))
 
@@ -204,6 +231,56 @@ func (t *FullObjectCreatorTest) CallsCreateObjectWhenSrcObjectAndMtimeAreNil() {
 	AssertFalse(ok)
 }
 
+func (t *FullObjectCreatorTest) AppliesObjectDefaults() {
+	t.creator = &fullObjectCreator{
+		bucket: t.bucket,
+		objectDefaults: []cfg.ObjectDefaults{
+			{Glob: "logs/**", StorageClass: "NEARLINE", CacheControl: "no-store", Metadata: map[string]string{"team": "infra", "gcsfuse_mtime": "never"}},
+		},
+	}
+	var req *gcs.CreateObjectRequest
+	ExpectCall(t.bucket, "CreateObject")(Any(), Any()).
+		WillOnce(DoAll(SaveArg(1, &req), Return(nil, errors.New(""))))
+
+	// Call
+	_, _ = t.creator.Create(
+		t.ctx,
+		"logs/2024/app.log",
+		nil,
+		nil,
+		&t.mtime,
+		nil,
+		chunkTransferTimeoutSecs,
+		strings.NewReader(""))
+
+	AssertNe(nil, req)
+	ExpectEq("NEARLINE", req.StorageClass)
+	ExpectEq("no-store", req.CacheControl)
+	ExpectEq("infra", req.Metadata["team"])
+	ExpectEq(t.mtime.Format(time.RFC3339Nano), req.Metadata["gcsfuse_mtime"])
+}
+
+func (t *FullObjectCreatorTest) AddsMetadataOfNewObject() {
+	var req *gcs.CreateObjectRequest
+	ExpectCall(t.bucket, "CreateObject")(Any(), Any()).
+		WillOnce(DoAll(SaveArg(1, &req), Return(nil, errors.New(""))))
+
+	// Call
+	_, _ = t.creator.Create(
+		t.ctx,
+		t.srcObject.Name,
+		nil,
+		map[string]string{"gcsfuse_mode": "755"},
+		&t.mtime,
+		nil,
+		chunkTransferTimeoutSecs,
+		strings.NewReader(""))
+
+	AssertNe(nil, req)
+	ExpectEq("755", req.Metadata["gcsfuse_mode"])
+	ExpectEq(t.mtime.Format(time.RFC3339Nano), req.Metadata["gcsfuse_mtime"])
+}
+
 func (t *FullObjectCreatorTest) validateEmptyProperties(req *gcs.CreateObjectRequest) {
 	AssertNe(nil, req)
 	ExpectThat(req.GenerationPrecondition, Pointee(Equals(0)))
@@ -233,7 +310,9 @@ type fakeObjectCreator struct {
 
 	// Supplied arguments
 	srcObject *gcs.Object
+	metadata  map[string]string
 	mtime     time.Time
+	crc32c    *uint32
 	contents  []byte
 
 	// Canned results
@@ -245,7 +324,9 @@ func (oc *fakeObjectCreator) Create(
 	ctx context.Context,
 	fileName string,
 	srcObject *gcs.Object,
+	metadata map[string]string,
 	mtime *time.Time,
+	crc32c *uint32,
 	chunkTransferTimeoutSecs int64,
 	r io.Reader) (o *gcs.Object, err error) {
 	// Have we been called more than once?
@@ -254,9 +335,11 @@ func (oc *fakeObjectCreator) Create(
 
 	// Record args.
 	oc.srcObject = srcObject
+	oc.metadata = metadata
 	if mtime != nil {
 		oc.mtime = *mtime
 	}
+	oc.crc32c = crc32c
 	oc.contents, err = io.ReadAll(r)
 	AssertEq(nil, err)
 
@@ -265,6 +348,24 @@ func (oc *fakeObjectCreator) Create(
 	return
 }
 
+////////////////////////////////////////////////////////////////////////
+// fakeSyncMetricHandle
+////////////////////////////////////////////////////////////////////////
+
+// A MetricHandle that records the strategies of the syncs counted.
+type fakeSyncMetricHandle struct {
+	common.MetricHandle
+	strategies []string
+}
+
+func (m *fakeSyncMetricHandle) GCSSyncCount(ctx context.Context, inc int64, attrs []common.MetricAttr) {
+	for _, attr := range attrs {
+		if attr.Key == common.SyncStrategy {
+			m.strategies = append(m.strategies, attr.Value)
+		}
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Boilerplate
 ////////////////////////////////////////////////////////////////////////
@@ -300,8 +401,10 @@ func (t *SyncerTest) SetUp(ti *TestInfo) {
 	t.syncer = newSyncer(
 		appendThreshold,
 		chunkTransferTimeoutSecs,
+		t.bucket,
 		&t.fullCreator,
-		&t.appendCreator)
+		&t.appendCreator,
+		common.NewNoopMetrics())
 
 	t.clock.SetTime(time.Date(2015, 4, 5, 2, 15, 0, 0, time.Local))
 
@@ -353,6 +456,17 @@ func (t *SyncerTest) SyncObjectShouldInvokeFullObjectCreatorWhenSrcObjectIsNil()
 	ExpectTrue(t.fullCreator.called)
 	ExpectFalse(t.appendCreator.called)
 }
+
+func (t *SyncerTest) SyncNewObjectPassesMetadata() {
+	_, _ = t.syncer.SyncNewObject(t.ctx, t.srcObject.Name, map[string]string{"gcsfuse_mode": "755"}, t.content)
+
+	AssertTrue(t.fullCreator.called)
+	ExpectEq(nil, t.fullCreator.srcObject)
+	ExpectEq("755", t.fullCreator.metadata["gcsfuse_mode"])
+	ExpectEq(srcObjectContents, string(t.fullCreator.contents))
+	ExpectFalse(t.appendCreator.called)
+}
+
 func (t *SyncerTest) NotDirty() {
 	// Call
 	o, err := t.call()
@@ -392,6 +506,73 @@ func (t *SyncerTest) SameSizeAsSource() {
 	ExpectFalse(t.appendCreator.called)
 }
 
+func (t *SyncerTest) PassesChecksumOfContent() {
+	// Append to the content.
+	_, err := t.content.WriteAt([]byte("burrito"), int64(len(srcObjectContents)))
+	AssertEq(nil, err)
+
+	// The append creator should be given the checksum of all of it.
+	t.call()
+
+	AssertTrue(t.appendCreator.called)
+	ExpectThat(
+		t.appendCreator.crc32c,
+		Pointee(Equals(crc32.Checksum([]byte("tacoburrito"), crc32cTable))))
+}
+
+func (t *SyncerTest) SameContentAsSource() {
+	// Rewrite the content with the same bytes.
+	err := t.content.Truncate(0)
+	AssertEq(nil, err)
+	_, err = t.content.WriteAt([]byte(srcObjectContents), 0)
+	AssertEq(nil, err)
+	mtime := t.clock.Now().Add(time.Hour)
+	t.content.SetMtime(mtime)
+
+	// Only the mtime should be updated.
+	o, err := t.call()
+
+	AssertEq(nil, err)
+	ExpectFalse(t.fullCreator.called)
+	ExpectFalse(t.appendCreator.called)
+	ExpectEq(t.srcObject.Generation, o.Generation)
+	ExpectEq(t.srcObject.MetaGeneration+1, o.MetaGeneration)
+	ExpectEq(mtime.UTC().Format(time.RFC3339Nano), o.Metadata[MtimeMetadataKey])
+}
+
+func (t *SyncerTest) SameChecksumButDifferentMD5AsSource() {
+	// Different bytes of the same length, which the CRC32C of the source object
+	// is made to match, as if they collided.
+	err := t.content.Truncate(0)
+	AssertEq(nil, err)
+	_, err = t.content.WriteAt([]byte("tacp"), 0)
+	AssertEq(nil, err)
+	crc := crc32.Checksum([]byte("tacp"), crc32cTable)
+	t.srcObject.CRC32C = &crc
+
+	// The full creator should be called.
+	t.call()
+
+	ExpectTrue(t.fullCreator.called)
+	ExpectFalse(t.appendCreator.called)
+}
+
+func (t *SyncerTest) SameContentAsSourceWithoutMD5() {
+	// Rewrite the content with the same bytes, over a source object that has no
+	// MD5 hash, as composite objects don't.
+	err := t.content.Truncate(0)
+	AssertEq(nil, err)
+	_, err = t.content.WriteAt([]byte(srcObjectContents), 0)
+	AssertEq(nil, err)
+	t.srcObject.MD5 = nil
+
+	// The full creator should be called.
+	t.call()
+
+	ExpectTrue(t.fullCreator.called)
+	ExpectFalse(t.appendCreator.called)
+}
+
 func (t *SyncerTest) LargerThanSource_ThresholdInSource() {
 	var err error
 
@@ -420,8 +601,10 @@ func (t *SyncerTest) SourceTooShortForAppend() {
 	t.syncer = newSyncer(
 		int64(len(srcObjectContents)+1),
 		chunkTransferTimeoutSecs,
+		t.bucket,
 		&t.fullCreator,
-		&t.appendCreator)
+		&t.appendCreator,
+		common.NewNoopMetrics())
 
 	// Extend the length of the content.
 	err = t.content.Truncate(int64(len(srcObjectContents) + 1))
@@ -451,6 +634,35 @@ func (t *SyncerTest) SourceComponentCountTooHigh() {
 	ExpectFalse(t.appendCreator.called)
 }
 
+func (t *SyncerTest) SourceComponentCountNearLimit() {
+	var err error
+	metricHandle := &fakeSyncMetricHandle{MetricHandle: common.NewNoopMetrics()}
+	t.syncer = newSyncer(
+		appendThreshold,
+		chunkTransferTimeoutSecs,
+		t.bucket,
+		&t.fullCreator,
+		&t.appendCreator,
+		metricHandle)
+	t.fullCreator.o = &gcs.Object{}
+	t.fullCreator.err = nil
+
+	// Simulate a component count close to the limit.
+	t.srcObject.ComponentCount = flattenComponentCount
+
+	// Extend the length of the content.
+	err = t.content.Truncate(int64(len(srcObjectContents) + 1))
+	AssertEq(nil, err)
+
+	// The full creator should be called, flattening the object.
+	_, err = t.call()
+
+	AssertEq(nil, err)
+	ExpectTrue(t.fullCreator.called)
+	ExpectFalse(t.appendCreator.called)
+	ExpectThat(metricHandle.strategies, ElementsAre(syncStrategyFlatten))
+}
+
 func (t *SyncerTest) LargerThanSource_ThresholdAtEndOfSource() {
 	var err error
 
@@ -596,3 +808,24 @@ func (t *SyncerTest) AppendCreatorSucceeds() {
 	AssertEq(nil, err)
 	ExpectEq(t.appendCreator.o, o)
 }
+
+func (t *SyncerTest) SourceModifiedInTheMiddle() {
+	// Recreate the syncer with a lower threshold.
+	t.syncer = newSyncer(
+		1,
+		chunkTransferTimeoutSecs,
+		t.bucket,
+		&t.fullCreator,
+		&t.appendCreator,
+		common.NewNoopMetrics())
+
+	// Dirty a byte in the middle.
+	_, err := t.content.WriteAt([]byte("i"), 1)
+	AssertEq(nil, err)
+
+	// The full creator should be called.
+	t.call()
+
+	ExpectTrue(t.fullCreator.called)
+	ExpectFalse(t.appendCreator.called)
+}
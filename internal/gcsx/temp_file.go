@@ -16,9 +16,12 @@ package gcsx
 
 import (
 	"fmt"
+	"hash/crc32"
 	"io"
 	"math"
 	"os"
+	"slices"
+	"sort"
 	"time"
 
 	"github.com/jacobsa/fuse/fsutil"
@@ -26,7 +29,7 @@ import (
 )
 
 // TempFile is a temporary file that keeps track of the lowest offset at which
-// it has been modified.
+// it has been modified, and of the ranges of bytes modified.
 //
 // Not safe for concurrent access.
 type TempFile interface {
@@ -46,10 +49,26 @@ type TempFile interface {
 	// the seek position.
 	Stat() (sr StatResult, err error)
 
+	// Return the ranges of bytes that may differ from the initial content,
+	// sorted and disjoint. Bytes of the current content outside of them are
+	// unmodified, and every byte past the initial content's length is within
+	// one of them.
+	DirtyRanges() []DirtyRange
+
 	// Explicitly set the mtime that will return in stat results. This will stick
 	// until another method that modifies the file is called.
 	SetMtime(mtime time.Time)
 
+	// Treat the current content as the initial one, as once it has been written
+	// out to the object it was derived from. Afterwards the content is not
+	// dirty, and has no mtime until it is modified again.
+	MarkClean() (err error)
+
+	// Return the CRC32C (Castagnoli) checksum of the current content. It is
+	// kept up to date while the content is loaded and appended to, and read
+	// back from the file after other modifications.
+	Checksum() (crc uint32, err error)
+
 	// Throw away the resources used by the temporary file. The object must not
 	// be used again.
 	Destroy()
@@ -74,6 +93,12 @@ type StatResult struct {
 	Mtime *time.Time
 }
 
+// DirtyRange is a [Start, Limit) range of bytes modified in a TempFile.
+type DirtyRange struct {
+	Start int64
+	Limit int64
+}
+
 // NewTempFile creates a temp file whose initial contents are given by the
 // supplied reader. dir is a directory on whose file system the inode will live,
 // or the system default temporary location if empty.
@@ -137,11 +162,54 @@ func RecoverCacheFile(
 		clock:          clock,
 		f:              source,
 		dirtyThreshold: stat.Size(),
+		crcLen:         -1,
 	}
 
 	return
 }
 
+// SnapshotTempFile copies the current contents of tf to a new temp file in
+// dir, which reports the same dirtiness and mtime. Syncing the snapshot writes
+// out what syncing tf would at this point, while tf goes on being modified.
+func SnapshotTempFile(
+	tf TempFile,
+	dir string,
+	clock timeutil.Clock) (snapshot TempFile, err error) {
+	sr, err := tf.Stat()
+	if err != nil {
+		err = fmt.Errorf("stat: %w", err)
+		return
+	}
+
+	f, err := fsutil.AnonymousFile(dir)
+	if err != nil {
+		err = fmt.Errorf("AnonymousFile: %w", err)
+		return
+	}
+
+	s := &tempFile{
+		state:          fileComplete,
+		clock:          clock,
+		f:              f,
+		dirtyThreshold: sr.DirtyThreshold,
+		dirtyRanges:    tf.DirtyRanges(),
+		mtime:          sr.Mtime,
+	}
+	if sr.Mtime != nil {
+		s.state = fileDirty
+	}
+
+	_, err = io.Copy(io.MultiWriter(f, crcWriter{s}), io.NewSectionReader(tf, 0, sr.Size))
+	if err != nil {
+		f.Close()
+		err = fmt.Errorf("copy: %w", err)
+		return
+	}
+
+	snapshot = s
+	return
+}
+
 type fileState string
 
 const (
@@ -173,11 +241,23 @@ type tempFile struct {
 	// INVARIANT: Stat().DirtyThreshold <= Stat().Size
 	dirtyThreshold int64
 
+	// The ranges of bytes that have been modified from the initial contents.
+	//
+	// INVARIANT: Sorted, non-empty, and neither overlapping nor adjacent
+	// INVARIANT: For each r, dirtyThreshold <= r.Start and r.Limit <= Stat().Size
+	dirtyRanges []DirtyRange
+
 	// The time at which a method that modifies our contents was last called, or
 	// nil if never.
 	//
 	// INVARIANT: mtime == nil => Stat().DirtyThreshold == Stat().Size
 	mtime *time.Time
+
+	// The CRC32C of the first crcLen bytes of our contents. It is only valid
+	// when crcLen is the current size; crcLen is -1 once the contents have been
+	// modified other than by appending.
+	crc    uint32
+	crcLen int64
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -216,6 +296,19 @@ func (tf *tempFile) CheckInvariants() {
 	if tf.mtime == nil && sr.DirtyThreshold != sr.Size {
 		panic(fmt.Errorf("mismatch: %d vs. %d", sr.DirtyThreshold, sr.Size))
 	}
+
+	// INVARIANT: Sorted, non-empty, and neither overlapping nor adjacent
+	// INVARIANT: For each r, dirtyThreshold <= r.Start and r.Limit <= Stat().Size
+	prevLimit := int64(-1)
+	for _, r := range tf.dirtyRanges {
+		if !(prevLimit < r.Start && r.Start < r.Limit) {
+			panic(fmt.Errorf("bad dirty ranges: %v", tf.dirtyRanges))
+		}
+		if !(tf.dirtyThreshold <= r.Start && r.Limit <= sr.Size) {
+			panic(fmt.Errorf("dirty range %v out of [%d, %d)", r, tf.dirtyThreshold, sr.Size))
+		}
+		prevLimit = r.Limit
+	}
 }
 
 func (tf *tempFile) Destroy() {
@@ -269,14 +362,25 @@ func (tf *tempFile) Stat() (sr StatResult, err error) {
 	return
 }
 
+func (tf *tempFile) DirtyRanges() []DirtyRange {
+	return slices.Clone(tf.dirtyRanges)
+}
+
 func (tf *tempFile) WriteAt(p []byte, offset int64) (int, error) {
 	err := tf.ensureComplete()
 	if err != nil {
 		return 0, fmt.Errorf("cannot WriteAt incomplete file: %w", err)
 	}
 
+	// Writing past the end fills the gap with zeroes, which are modified too.
+	size, err := tf.size()
+	if err != nil {
+		return 0, err
+	}
+
 	// Update our state regarding being dirty.
 	tf.dirtyThreshold = minInt64(tf.dirtyThreshold, offset)
+	tf.addDirtyRange(minInt64(offset, size), offset+int64(len(p)))
 
 	tf.state = fileDirty
 
@@ -284,7 +388,14 @@ func (tf *tempFile) WriteAt(p []byte, offset int64) (int, error) {
 	tf.mtime = &newMtime
 
 	// Call through.
-	return tf.f.WriteAt(p, offset)
+	n, err := tf.f.WriteAt(p, offset)
+	if offset == size && tf.crcLen == size {
+		tf.updateCRC(p[:n])
+	} else {
+		tf.crcLen = -1
+	}
+
+	return n, err
 }
 
 func (tf *tempFile) Truncate(n int64) error {
@@ -293,14 +404,28 @@ func (tf *tempFile) Truncate(n int64) error {
 		return fmt.Errorf("cannot Truncate incomplete file: %w", err)
 	}
 
+	size, err := tf.size()
+	if err != nil {
+		return err
+	}
+
 	// Update our state regarding being dirty.
 	tf.dirtyThreshold = minInt64(tf.dirtyThreshold, n)
+	tf.clipDirtyRanges(n)
+	tf.addDirtyRange(size, n)
 
 	tf.state = fileDirty
 
 	newMtime := tf.clock.Now()
 	tf.mtime = &newMtime
 
+	switch {
+	case n == 0:
+		tf.crc, tf.crcLen = 0, 0
+	case n != size:
+		tf.crcLen = -1
+	}
+
 	// Call through.
 	return tf.f.Truncate(n)
 }
@@ -309,6 +434,49 @@ func (tf *tempFile) SetMtime(mtime time.Time) {
 	tf.mtime = &mtime
 }
 
+func (tf *tempFile) MarkClean() error {
+	// Content that hasn't been read in full hasn't been modified either.
+	if tf.state == fileIncomplete {
+		return nil
+	}
+
+	size, err := tf.size()
+	if err != nil {
+		return err
+	}
+
+	tf.dirtyThreshold = size
+	tf.dirtyRanges = nil
+	tf.mtime = nil
+	tf.state = fileComplete
+	return nil
+}
+
+func (tf *tempFile) Checksum() (crc uint32, err error) {
+	err = tf.ensureComplete()
+	if err != nil {
+		err = fmt.Errorf("cannot Checksum incomplete file: %w", err)
+		return
+	}
+
+	size, err := tf.size()
+	if err != nil {
+		return
+	}
+
+	if tf.crcLen != size {
+		h := crc32.New(crc32cTable)
+		if _, err = io.Copy(h, io.NewSectionReader(tf.f, 0, size)); err != nil {
+			err = fmt.Errorf("read: %w", err)
+			return
+		}
+		tf.crc, tf.crcLen = h.Sum32(), size
+	}
+
+	crc = tf.crc
+	return
+}
+
 func (tf *tempFile) Name() string {
 	return tf.f.Name()
 }
@@ -325,10 +493,71 @@ func minInt64(a int64, b int64) int64 {
 	return b
 }
 
+// size returns the current size of the file, without moving the seek
+// position.
+func (tf *tempFile) size() (int64, error) {
+	fi, err := tf.f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("stat: %w", err)
+	}
+	return fi.Size(), nil
+}
+
+// addDirtyRange marks the bytes in [start, limit) as modified, merging the
+// range with those it overlaps or touches. It is a no-op for empty ranges.
+func (tf *tempFile) addDirtyRange(start int64, limit int64) {
+	if start >= limit {
+		return
+	}
+
+	// Find the first range ending at or after start, then extend the new one
+	// over all ranges starting at or before limit.
+	i := sort.Search(len(tf.dirtyRanges), func(i int) bool {
+		return tf.dirtyRanges[i].Limit >= start
+	})
+	j := i
+	for ; j < len(tf.dirtyRanges) && tf.dirtyRanges[j].Start <= limit; j++ {
+		start = minInt64(start, tf.dirtyRanges[j].Start)
+		limit = max(limit, tf.dirtyRanges[j].Limit)
+	}
+
+	tf.dirtyRanges = slices.Replace(tf.dirtyRanges, i, j, DirtyRange{Start: start, Limit: limit})
+}
+
+// clipDirtyRanges drops the parts of the dirty ranges at or past n.
+func (tf *tempFile) clipDirtyRanges(n int64) {
+	i := sort.Search(len(tf.dirtyRanges), func(i int) bool {
+		return tf.dirtyRanges[i].Limit > n
+	})
+	if i < len(tf.dirtyRanges) && tf.dirtyRanges[i].Start < n {
+		tf.dirtyRanges[i].Limit = n
+		i++
+	}
+	tf.dirtyRanges = tf.dirtyRanges[:i]
+}
+
 const (
 	minCopyLength = 64 * 1024 * 1024 // 64 MB
 )
 
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// updateCRC extends the checksum over data appended to the contents.
+func (tf *tempFile) updateCRC(data []byte) {
+	tf.crc = crc32.Update(tf.crc, crc32cTable, data)
+	tf.crcLen += int64(len(data))
+}
+
+// crcWriter feeds the data loaded from the source into the checksum.
+type crcWriter struct {
+	tf *tempFile
+}
+
+func (w crcWriter) Write(p []byte) (int, error) {
+	w.tf.updateCRC(p)
+	return len(p), nil
+}
+
 func (tf *tempFile) ensure(limit int64) error {
 	switch tf.state {
 	case fileIncomplete:
@@ -340,7 +569,11 @@ func (tf *tempFile) ensure(limit int64) error {
 		if n < minCopyLength {
 			n = minCopyLength
 		}
-		n, err = io.CopyN(tf.f, tf.source, n)
+		var w io.Writer = tf.f
+		if tf.crcLen == size {
+			w = io.MultiWriter(tf.f, crcWriter{tf})
+		}
+		n, err = io.CopyN(w, tf.source, n)
 		if err == io.EOF {
 			tf.source.Close()
 			tf.dirtyThreshold = size + n
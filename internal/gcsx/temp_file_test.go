@@ -16,6 +16,7 @@ package gcsx_test
 
 import (
 	"fmt"
+	"hash/crc32"
 	"io"
 	"strings"
 	"testing"
@@ -74,6 +75,12 @@ func (tf *checkingTempFile) Stat() (gcsx.StatResult, error) {
 	return tf.wrapped.Stat()
 }
 
+func (tf *checkingTempFile) DirtyRanges() []gcsx.DirtyRange {
+	tf.wrapped.CheckInvariants()
+	defer tf.wrapped.CheckInvariants()
+	return tf.wrapped.DirtyRanges()
+}
+
 func (tf *checkingTempFile) Read(b []byte) (int, error) {
 	tf.wrapped.CheckInvariants()
 	defer tf.wrapped.CheckInvariants()
@@ -110,6 +117,18 @@ func (tf *checkingTempFile) SetMtime(mtime time.Time) {
 	tf.wrapped.SetMtime(mtime)
 }
 
+func (tf *checkingTempFile) MarkClean() error {
+	tf.wrapped.CheckInvariants()
+	defer tf.wrapped.CheckInvariants()
+	return tf.wrapped.MarkClean()
+}
+
+func (tf *checkingTempFile) Checksum() (uint32, error) {
+	tf.wrapped.CheckInvariants()
+	defer tf.wrapped.CheckInvariants()
+	return tf.wrapped.Checksum()
+}
+
 func (tf *checkingTempFile) Destroy() {
 	tf.wrapped.CheckInvariants()
 	tf.wrapped.Destroy()
@@ -249,3 +268,153 @@ func (t *TempFileTest) SetMtime() {
 	AssertEq(nil, err)
 	ExpectThat(sr.Mtime, Pointee(timeutil.TimeEq(mtime)))
 }
+
+func (t *TempFileTest) DirtyRanges_InitialState() {
+	ExpectEq(0, len(t.tf.DirtyRanges()))
+}
+
+func (t *TempFileTest) DirtyRanges_WriteAt() {
+	var err error
+
+	// Two disjoint writes, then one bridging them.
+	_, err = t.tf.WriteAt([]byte("fo"), 1)
+	AssertEq(nil, err)
+	_, err = t.tf.WriteAt([]byte("ba"), 6)
+	AssertEq(nil, err)
+	ExpectEq("[{1 3} {6 8}]", fmt.Sprint(t.tf.DirtyRanges()))
+
+	_, err = t.tf.WriteAt([]byte("xyz"), 3)
+	AssertEq(nil, err)
+	ExpectEq("[{1 8}]", fmt.Sprint(t.tf.DirtyRanges()))
+}
+
+func (t *TempFileTest) DirtyRanges_WriteAtPastEnd() {
+	// The gap between the old end and the write is zero-filled.
+	_, err := t.tf.WriteAt([]byte("fo"), int64(initialContentSize)+3)
+	AssertEq(nil, err)
+
+	ExpectEq(
+		fmt.Sprint([]gcsx.DirtyRange{{Start: int64(initialContentSize), Limit: int64(initialContentSize) + 5}}),
+		fmt.Sprint(t.tf.DirtyRanges()))
+
+	sr, err := t.tf.Stat()
+	AssertEq(nil, err)
+	ExpectEq(initialContentSize, sr.DirtyThreshold)
+}
+
+func (t *TempFileTest) DirtyRanges_Truncate() {
+	var err error
+
+	_, err = t.tf.WriteAt([]byte("fo"), 1)
+	AssertEq(nil, err)
+	_, err = t.tf.WriteAt([]byte("ba"), 6)
+	AssertEq(nil, err)
+
+	// Shrinking drops what is past the new end.
+	err = t.tf.Truncate(7)
+	AssertEq(nil, err)
+	ExpectEq("[{1 3} {6 7}]", fmt.Sprint(t.tf.DirtyRanges()))
+
+	// Growing again doesn't bring back the initial contents.
+	err = t.tf.Truncate(9)
+	AssertEq(nil, err)
+	ExpectEq("[{1 3} {6 9}]", fmt.Sprint(t.tf.DirtyRanges()))
+}
+
+func (t *TempFileTest) MarkClean() {
+	var err error
+
+	_, err = t.tf.WriteAt([]byte("fo"), 1)
+	AssertEq(nil, err)
+	err = t.tf.Truncate(int64(initialContentSize) + 2)
+	AssertEq(nil, err)
+
+	// Call
+	err = t.tf.MarkClean()
+	AssertEq(nil, err)
+
+	// Check Stat.
+	sr, err := t.tf.Stat()
+
+	AssertEq(nil, err)
+	ExpectEq(initialContentSize+2, sr.Size)
+	ExpectEq(initialContentSize+2, sr.DirtyThreshold)
+	ExpectEq(nil, sr.Mtime)
+	ExpectEq(0, len(t.tf.DirtyRanges()))
+
+	// Later modifications are tracked from the new initial content.
+	_, err = t.tf.WriteAt([]byte("ba"), 3)
+	AssertEq(nil, err)
+	ExpectEq("[{3 5}]", fmt.Sprint(t.tf.DirtyRanges()))
+
+	// The content is unaffected.
+	actual, err := readAll(&t.tf)
+	AssertEq(nil, err)
+	ExpectEq("tfobaurrito\x00\x00", string(actual))
+}
+
+func (t *TempFileTest) Checksum() {
+	castagnoli := crc32.MakeTable(crc32.Castagnoli)
+
+	crc, err := t.tf.Checksum()
+	AssertEq(nil, err)
+	ExpectEq(crc32.Checksum([]byte(initialContent), castagnoli), crc)
+
+	// Appending.
+	_, err = t.tf.WriteAt([]byte("enchilada"), int64(initialContentSize))
+	AssertEq(nil, err)
+	crc, err = t.tf.Checksum()
+	AssertEq(nil, err)
+	ExpectEq(crc32.Checksum([]byte(initialContent+"enchilada"), castagnoli), crc)
+
+	// Overwriting.
+	_, err = t.tf.WriteAt([]byte("p"), 0)
+	AssertEq(nil, err)
+	crc, err = t.tf.Checksum()
+	AssertEq(nil, err)
+	ExpectEq(crc32.Checksum([]byte("pacoburritoenchilada"), castagnoli), crc)
+
+	// Rewriting from scratch.
+	err = t.tf.Truncate(0)
+	AssertEq(nil, err)
+	_, err = t.tf.WriteAt([]byte("taco"), 0)
+	AssertEq(nil, err)
+	_, err = t.tf.WriteAt([]byte("burrito"), 4)
+	AssertEq(nil, err)
+	crc, err = t.tf.Checksum()
+	AssertEq(nil, err)
+	ExpectEq(crc32.Checksum([]byte(initialContent), castagnoli), crc)
+}
+
+func (t *TempFileTest) Snapshot() {
+	_, err := t.tf.WriteAt([]byte("p"), 0)
+	AssertEq(nil, err)
+	_, err = t.tf.WriteAt([]byte("s"), int64(initialContentSize))
+	AssertEq(nil, err)
+	sr, err := t.tf.Stat()
+	AssertEq(nil, err)
+
+	// Call
+	snapshot, err := gcsx.SnapshotTempFile(t.tf.wrapped, "", &t.clock)
+	AssertEq(nil, err)
+	defer snapshot.Destroy()
+
+	// The snapshot reports the same state.
+	snapshot.CheckInvariants()
+	snapshotSr, err := snapshot.Stat()
+	AssertEq(nil, err)
+	ExpectEq(sr.Size, snapshotSr.Size)
+	ExpectEq(sr.DirtyThreshold, snapshotSr.DirtyThreshold)
+	ExpectThat(snapshotSr.Mtime, Pointee(timeutil.TimeEq(*sr.Mtime)))
+	ExpectEq(fmt.Sprint(t.tf.DirtyRanges()), fmt.Sprint(snapshot.DirtyRanges()))
+	crc, err := snapshot.Checksum()
+	AssertEq(nil, err)
+	ExpectEq(crc32.Checksum([]byte("pacoburritos"), crc32.MakeTable(crc32.Castagnoli)), crc)
+
+	// And is unaffected by later modifications.
+	_, err = t.tf.WriteAt([]byte("b"), 0)
+	AssertEq(nil, err)
+	actual, err := io.ReadAll(io.NewSectionReader(snapshot, 0, snapshotSr.Size))
+	AssertEq(nil, err)
+	ExpectEq("pacoburritos", string(actual))
+}
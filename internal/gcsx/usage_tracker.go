@@ -0,0 +1,198 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+// Usage is the space consumed by the objects of a bucket, or of the part of
+// it that is mounted.
+type Usage struct {
+	Bytes   uint64
+	Objects uint64
+}
+
+// UsageLimits are the quotas configured for a mount. Zero means unlimited.
+type UsageLimits struct {
+	Bytes   uint64
+	Objects uint64
+}
+
+// UsageTracker maintains an approximation of the usage of a bucket. The
+// baseline is computed by periodically walking all ListObjects pages, and
+// local creates, writes and deletes are folded in between walks so that the
+// numbers don't lag behind the file system's own activity.
+//
+// The bucket is expected to be the one the file system sees, i.e. already
+// restricted to the only-dir prefix if one is configured.
+type UsageTracker struct {
+	bucket gcs.Bucket
+	limits UsageLimits
+
+	// The error returned when an operation would exceed a limit. Either
+	// syscall.ENOSPC or syscall.EDQUOT.
+	exceededErr error
+
+	mu sync.Mutex
+
+	// The result of the last completed walk.
+	//
+	// GUARDED_BY(mu)
+	scanned Usage
+
+	// Changes made locally since the last completed walk started. Changes made
+	// while a walk is in progress may or may not be reflected in its result, so
+	// they are kept until the next one.
+	//
+	// GUARDED_BY(mu)
+	deltaBytes   int64
+	deltaObjects int64
+}
+
+// NewUsageTracker creates a tracker for the supplied bucket. Call Scan or
+// Run to compute the initial usage; until then, only local changes are
+// accounted for.
+func NewUsageTracker(
+	bucket gcs.Bucket,
+	limits UsageLimits,
+	exceededErr error) *UsageTracker {
+	return &UsageTracker{
+		bucket:      bucket,
+		limits:      limits,
+		exceededErr: exceededErr,
+	}
+}
+
+// Limits returns the configured quotas.
+func (t *UsageTracker) Limits() UsageLimits {
+	return t.limits
+}
+
+// Usage returns the current approximation of the bucket usage.
+func (t *UsageTracker) Usage() Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return Usage{
+		Bytes:   addClamped(t.scanned.Bytes, t.deltaBytes),
+		Objects: addClamped(t.scanned.Objects, t.deltaObjects),
+	}
+}
+
+// Add records a local change in the usage, e.g. +1 object for a created file
+// or the growth of a file on write. Negative values record deletions.
+func (t *UsageTracker) Add(bytes int64, objects int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.deltaBytes += bytes
+	t.deltaObjects += objects
+}
+
+// Check returns the configured error if adding the supplied amounts would
+// exceed a limit. Shrinking is always allowed, even when over quota.
+func (t *UsageTracker) Check(bytes int64, objects int64) error {
+	u := t.Usage()
+
+	if bytes > 0 && t.limits.Bytes > 0 && u.Bytes+uint64(bytes) > t.limits.Bytes {
+		return t.exceededErr
+	}
+
+	if objects > 0 && t.limits.Objects > 0 && u.Objects+uint64(objects) > t.limits.Objects {
+		return t.exceededErr
+	}
+
+	return nil
+}
+
+// Scan walks all objects in the bucket and replaces the baseline usage.
+func (t *UsageTracker) Scan(ctx context.Context) (err error) {
+	t.mu.Lock()
+	deltaBytesAtStart, deltaObjectsAtStart := t.deltaBytes, t.deltaObjects
+	t.mu.Unlock()
+
+	var u Usage
+	req := &gcs.ListObjectsRequest{}
+	for {
+		var listing *gcs.Listing
+		listing, err = t.bucket.ListObjects(ctx, req)
+		if err != nil {
+			err = fmt.Errorf("ListObjects: %w", err)
+			return
+		}
+
+		for _, o := range listing.MinObjects {
+			u.Bytes += o.Size
+			u.Objects++
+		}
+
+		if listing.ContinuationToken == "" {
+			break
+		}
+
+		req.ContinuationToken = listing.ContinuationToken
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.scanned = u
+	t.deltaBytes -= deltaBytesAtStart
+	t.deltaObjects -= deltaObjectsAtStart
+	return
+}
+
+// Run scans the bucket immediately and then with the supplied period, until
+// the context is cancelled.
+func (t *UsageTracker) Run(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		startTime := time.Now()
+		if err := t.Scan(ctx); err != nil {
+			logger.Warnf("Usage scan of bucket %q failed after %v: %v", t.bucket.Name(), time.Since(startTime), err)
+		} else {
+			u := t.Usage()
+			logger.Debugf("Usage scan of bucket %q found %d objects, %d bytes in %v.", t.bucket.Name(), u.Objects, u.Bytes, time.Since(startTime))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+		}
+	}
+}
+
+func addClamped(base uint64, delta int64) uint64 {
+	if delta >= 0 {
+		return base + uint64(delta)
+	}
+
+	if d := uint64(-delta); d < base {
+		return base - d
+	}
+
+	return 0
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func newUsageTrackerForTest(t *testing.T, limits UsageLimits, objects map[string]string) (gcs.Bucket, *UsageTracker) {
+	t.Helper()
+	bucket := fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical)
+	for name, contents := range objects {
+		_, err := storageutil.CreateObject(context.Background(), bucket, name, []byte(contents))
+		require.NoError(t, err)
+	}
+
+	return bucket, NewUsageTracker(bucket, limits, syscall.EDQUOT)
+}
+
+func TestUsageTrackerScan(t *testing.T) {
+	_, tracker := newUsageTrackerForTest(t, UsageLimits{}, map[string]string{
+		"foo":     "taco",
+		"dir/":    "",
+		"dir/bar": "burrito",
+	})
+
+	err := tracker.Scan(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, Usage{Bytes: 11, Objects: 3}, tracker.Usage())
+}
+
+func TestUsageTrackerAddBetweenScans(t *testing.T) {
+	bucket, tracker := newUsageTrackerForTest(t, UsageLimits{}, map[string]string{"foo": "taco"})
+	require.NoError(t, tracker.Scan(context.Background()))
+
+	tracker.Add(7, 1)
+	assert.Equal(t, Usage{Bytes: 11, Objects: 2}, tracker.Usage())
+	// Once the object has actually been created, the next scan replaces the
+	// local estimate.
+	_, err := storageutil.CreateObject(context.Background(), bucket, "bar", []byte("burrito"))
+	require.NoError(t, err)
+	require.NoError(t, tracker.Scan(context.Background()))
+	assert.Equal(t, Usage{Bytes: 11, Objects: 2}, tracker.Usage())
+}
+
+func TestUsageTrackerUsageNeverNegative(t *testing.T) {
+	_, tracker := newUsageTrackerForTest(t, UsageLimits{}, nil)
+
+	tracker.Add(-10, -1)
+
+	assert.Equal(t, Usage{}, tracker.Usage())
+}
+
+func TestUsageTrackerCheck(t *testing.T) {
+	_, tracker := newUsageTrackerForTest(t, UsageLimits{Bytes: 10, Objects: 2}, map[string]string{"foo": "taco"})
+	require.NoError(t, tracker.Scan(context.Background()))
+
+	assert.NoError(t, tracker.Check(6, 0))
+	assert.ErrorIs(t, tracker.Check(7, 0), syscall.EDQUOT)
+	assert.NoError(t, tracker.Check(0, 1))
+	assert.ErrorIs(t, tracker.Check(0, 2), syscall.EDQUOT)
+	// Shrinking is allowed even when over quota.
+	tracker.Add(100, 0)
+	assert.NoError(t, tracker.Check(-4, -1))
+}
+
+func TestUsageTrackerUnlimited(t *testing.T) {
+	_, tracker := newUsageTrackerForTest(t, UsageLimits{}, map[string]string{"foo": "taco"})
+	require.NoError(t, tracker.Scan(context.Background()))
+
+	assert.NoError(t, tracker.Check(1<<50, 1<<50))
+}
@@ -100,6 +100,15 @@ func (mb *monitoringBucket) CopyObject(
 	return o, err
 }
 
+func (mb *monitoringBucket) RewriteObject(
+	ctx context.Context,
+	req *gcs.RewriteObjectRequest) (*gcs.Object, error) {
+	startTime := time.Now()
+	o, err := mb.wrapped.RewriteObject(ctx, req)
+	recordRequest(ctx, mb.metricHandle, "RewriteObject", startTime)
+	return o, err
+}
+
 func (mb *monitoringBucket) ComposeObjects(
 	ctx context.Context,
 	req *gcs.ComposeObjectsRequest) (*gcs.Object, error) {
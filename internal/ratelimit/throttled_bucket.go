@@ -130,6 +130,21 @@ func (b *throttledBucket) CopyObject(
 	return
 }
 
+func (b *throttledBucket) RewriteObject(
+	ctx context.Context,
+	req *gcs.RewriteObjectRequest) (o *gcs.Object, err error) {
+	// Wait for permission to call through.
+	err = b.opThrottle.Wait(ctx, 1)
+	if err != nil {
+		return
+	}
+
+	// Call through.
+	o, err = b.wrapped.RewriteObject(ctx, req)
+
+	return
+}
+
 func (b *throttledBucket) ComposeObjects(
 	ctx context.Context,
 	req *gcs.ComposeObjectsRequest) (o *gcs.Object, err error) {
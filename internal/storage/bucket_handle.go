@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/storage"
@@ -32,6 +33,7 @@ import (
 	"cloud.google.com/go/storage/control/apiv2/controlpb"
 	"github.com/googleapis/gax-go/v2"
 	"github.com/googleapis/gax-go/v2/apierror"
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
@@ -48,6 +50,70 @@ type bucketHandle struct {
 	bucketName    string
 	bucketType    gcs.BucketType
 	controlClient StorageControlClient
+
+	// Used to reach the source bucket of cross-bucket rewrites.
+	client         *storage.Client
+	billingProject string
+
+	// The customer-supplied keys of objects, by bucket name or cfg.AllBuckets,
+	// shared with the other buckets of the client so that the sources of
+	// cross-bucket rewrites can be read.
+	customerKeys map[string][]byte
+
+	// The name of the Cloud KMS key that objects are created with, if any.
+	kmsKeyName string
+}
+
+// customerKey returns the customer-supplied key of the objects of the named
+// bucket, or nil if they are read and written without one.
+func (bh *bucketHandle) customerKey(bucketName string) []byte {
+	key, _ := cfg.BucketValue(bh.customerKeys, bucketName)
+	return key
+}
+
+// object returns a handle of the named object that carries the customer-
+// supplied key of the bucket, if any.
+func (bh *bucketHandle) object(name string) *storage.ObjectHandle {
+	obj := bh.bucket.Object(name)
+	if key := bh.customerKey(bh.bucketName); key != nil {
+		obj = obj.Key(key)
+	}
+	return obj
+}
+
+// isEncryptionKeyMismatch tells whether GCS refused a request because the
+// object is encrypted with a customer-supplied key other than the one sent,
+// or isn't encrypted with the one sent.
+func isEncryptionKeyMismatch(err error) bool {
+	var gErr *googleapi.Error
+	if errors.As(err, &gErr) {
+		for _, item := range gErr.Errors {
+			if strings.Contains(item.Reason, "EncryptionKey") {
+				return true
+			}
+		}
+		return strings.Contains(gErr.Message, "encryption key")
+	}
+
+	var apiErr *apierror.APIError
+	if errors.As(err, &apiErr) {
+		return strings.Contains(apiErr.GRPCStatus().Message(), "encryption key")
+	}
+
+	return false
+}
+
+// encryptionKeyError converts a key mismatch to *gcs.EncryptionKeyError. As
+// the file system reports nothing more than EACCES for it, the reason is
+// logged.
+func (bh *bucketHandle) encryptionKeyError(bucketName string, objectName string, err error) error {
+	if bh.customerKey(bucketName) == nil {
+		logger.Errorf("Object %q of bucket %q is encrypted with a customer-supplied key, but none is configured for the bucket: %v", objectName, bucketName, err)
+	} else {
+		logger.Errorf("Object %q of bucket %q isn't encrypted with the customer-supplied key configured for the bucket: %v", objectName, bucketName, err)
+	}
+
+	return &gcs.EncryptionKeyError{Err: err}
 }
 
 func (bh *bucketHandle) Name() string {
@@ -103,7 +169,7 @@ func (bh *bucketHandle) NewReader(
 		length = end - start
 	}
 
-	obj := bh.bucket.Object(req.Name)
+	obj := bh.object(req.Name)
 
 	// Switching to the requested generation of object.
 	if req.Generation != 0 {
@@ -119,6 +185,8 @@ func (bh *bucketHandle) NewReader(
 
 	if err == storage.ErrObjectNotExist {
 		err = &gcs.NotFoundError{Err: storage.ErrObjectNotExist}
+	} else if isEncryptionKeyMismatch(err) {
+		err = bh.encryptionKeyError(bh.bucketName, req.Name, err)
 	}
 
 	return r, err
@@ -162,13 +230,17 @@ func (bh *bucketHandle) StatObject(ctx context.Context,
 	req *gcs.StatObjectRequest) (m *gcs.MinObject, e *gcs.ExtendedObjectAttributes, err error) {
 	var attrs *storage.ObjectAttrs
 	// Retrieving object attrs through Go Storage Client.
-	attrs, err = bh.bucket.Object(req.Name).Attrs(ctx)
+	attrs, err = bh.object(req.Name).Attrs(ctx)
 
 	// If error is of type storage.ErrObjectNotExist
 	if err == storage.ErrObjectNotExist {
 		err = &gcs.NotFoundError{Err: err} // Special case error that object not found in the bucket.
 		return
 	}
+	if isEncryptionKeyMismatch(err) {
+		err = bh.encryptionKeyError(bh.bucketName, req.Name, err)
+		return
+	}
 	if err != nil {
 		err = fmt.Errorf("error in fetching object attributes: %w", err)
 		return
@@ -185,7 +257,7 @@ func (bh *bucketHandle) StatObject(ctx context.Context,
 }
 
 func (bh *bucketHandle) getObjectHandleWithPreconditionsSet(req *gcs.CreateObjectRequest) *storage.ObjectHandle {
-	obj := bh.bucket.Object(req.Name)
+	obj := bh.object(req.Name)
 
 	// GenerationPrecondition - If non-nil, the object will be created/overwritten
 	// only if the current generation for the object name is equal to the given value.
@@ -223,6 +295,7 @@ func (bh *bucketHandle) CreateObject(ctx context.Context, req *gcs.CreateObjectR
 	wc := obj.NewWriter(ctx)
 	wc.ChunkTransferTimeout = time.Duration(req.ChunkTransferTimeoutSecs) * time.Second
 	wc = storageutil.SetAttrsInWriter(wc, req)
+	wc.KMSKeyName = bh.kmsKeyName
 	wc.ProgressFunc = func(bytesUploadedSoFar int64) {
 		logger.Tracef("gcs: Req %#16x: -- CreateObject(%q): %20v bytes uploaded so far", ctx.Value(gcs.ReqIdField), req.Name, bytesUploadedSoFar)
 	}
@@ -242,6 +315,14 @@ func (bh *bucketHandle) CreateObject(ctx context.Context, req *gcs.CreateObjectR
 				err = &gcs.PreconditionError{Err: err}
 				return
 			}
+			if isChecksumMismatch(gErr) {
+				err = &gcs.ChecksumMismatchError{Err: err}
+				return
+			}
+		}
+		if isEncryptionKeyMismatch(err) {
+			err = bh.encryptionKeyError(bh.bucketName, req.Name, err)
+			return
 		}
 		err = fmt.Errorf("error in closing writer : %w", err)
 		return
@@ -252,12 +333,22 @@ func (bh *bucketHandle) CreateObject(ctx context.Context, req *gcs.CreateObjectR
 	o = storageutil.ObjectAttrsToBucketObject(attrs)
 	return
 }
+
+// isChecksumMismatch tells whether GCS rejected an upload because the data it
+// received doesn't have the CRC32C or MD5 it was sent with.
+func isChecksumMismatch(gErr *googleapi.Error) bool {
+	return gErr.Code == http.StatusBadRequest &&
+		strings.Contains(gErr.Message, "doesn't match calculated")
+}
+
 func (bh *bucketHandle) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
 	obj := bh.getObjectHandleWithPreconditionsSet(req)
 
 	wc := &ObjectWriter{obj.NewWriter(ctx)}
 	wc.ChunkSize = chunkSize
+	wc.ChunkTransferTimeout = time.Duration(req.ChunkTransferTimeoutSecs) * time.Second
 	wc.Writer = storageutil.SetAttrsInWriter(wc.Writer, req)
+	wc.KMSKeyName = bh.kmsKeyName
 	if callBack == nil {
 		callBack = func(bytesUploadedSoFar int64) {
 			logger.Tracef("gcs: Req %#16x: -- UploadBlock(%q): %20v bytes uploaded so far", ctx.Value(gcs.ReqIdField), req.Name, bytesUploadedSoFar)
@@ -276,6 +367,14 @@ func (bh *bucketHandle) FinalizeUpload(ctx context.Context, w gcs.Writer) (o *gc
 				err = &gcs.PreconditionError{Err: err}
 				return
 			}
+			if isChecksumMismatch(gErr) {
+				err = &gcs.ChecksumMismatchError{Err: err}
+				return
+			}
+		}
+		if isEncryptionKeyMismatch(err) {
+			err = bh.encryptionKeyError(bh.bucketName, w.ObjectName(), err)
+			return
 		}
 		err = fmt.Errorf("error in closing writer : %w", err)
 		return
@@ -288,8 +387,8 @@ func (bh *bucketHandle) FinalizeUpload(ctx context.Context, w gcs.Writer) (o *gc
 }
 
 func (bh *bucketHandle) CopyObject(ctx context.Context, req *gcs.CopyObjectRequest) (o *gcs.Object, err error) {
-	srcObj := bh.bucket.Object(req.SrcName)
-	dstObj := bh.bucket.Object(req.DstName)
+	srcObj := bh.object(req.SrcName)
+	dstObj := bh.object(req.DstName)
 
 	// Switching to the requested generation of source object.
 	if req.SrcGeneration != 0 {
@@ -301,7 +400,14 @@ func (bh *bucketHandle) CopyObject(ctx context.Context, req *gcs.CopyObjectReque
 		srcObj = srcObj.If(storage.Conditions{MetagenerationMatch: *req.SrcMetaGenerationPrecondition})
 	}
 
-	objAttrs, err := dstObj.CopierFrom(srcObj).Run(ctx)
+	copier := dstObj.CopierFrom(srcObj)
+	copier.DestinationKMSKeyName = bh.kmsKeyName
+	objAttrs, err := copier.Run(ctx)
+
+	if isEncryptionKeyMismatch(err) {
+		err = bh.encryptionKeyError(bh.bucketName, req.SrcName, err)
+		return
+	}
 
 	if err != nil {
 		switch ee := err.(type) {
@@ -322,6 +428,76 @@ func (bh *bucketHandle) CopyObject(ctx context.Context, req *gcs.CopyObjectReque
 	return
 }
 
+func (bh *bucketHandle) RewriteObject(ctx context.Context, req *gcs.RewriteObjectRequest) (o *gcs.Object, err error) {
+	srcBucketName := bh.bucketName
+	srcBucket := bh.bucket
+	if req.SrcBucketName != "" && req.SrcBucketName != bh.bucketName {
+		srcBucketName = req.SrcBucketName
+		srcBucket = bh.client.Bucket(req.SrcBucketName)
+		if bh.billingProject != "" {
+			srcBucket = srcBucket.UserProject(bh.billingProject)
+		}
+	}
+
+	srcObj := srcBucket.Object(req.SrcName)
+	if key := bh.customerKey(srcBucketName); key != nil {
+		srcObj = srcObj.Key(key)
+	}
+	dstObj := bh.object(req.DstName)
+
+	if req.SrcGeneration != 0 {
+		srcObj = srcObj.Generation(req.SrcGeneration)
+	}
+
+	if req.SrcMetaGenerationPrecondition != nil {
+		srcObj = srcObj.If(storage.Conditions{MetagenerationMatch: *req.SrcMetaGenerationPrecondition})
+	}
+
+	if req.DstGenerationPrecondition != nil {
+		if *req.DstGenerationPrecondition == 0 {
+			dstObj = dstObj.If(storage.Conditions{DoesNotExist: true})
+		} else {
+			dstObj = dstObj.If(storage.Conditions{GenerationMatch: *req.DstGenerationPrecondition})
+		}
+	}
+
+	// The copier issues rewrite calls until GCS reports completion, and keeps
+	// the token of the last one so that a failed rewrite can be resumed.
+	copier := dstObj.CopierFrom(srcObj)
+	copier.DestinationKMSKeyName = bh.kmsKeyName
+	copier.RewriteToken = req.RewriteToken
+	if req.ProgressFunc != nil {
+		copier.ProgressFunc = func(copiedBytes, totalBytes uint64) {
+			req.ProgressFunc(copiedBytes, totalBytes, copier.RewriteToken)
+		}
+	}
+
+	objAttrs, err := copier.Run(ctx)
+
+	if isEncryptionKeyMismatch(err) {
+		err = bh.encryptionKeyError(srcBucketName, req.SrcName, err)
+		return
+	}
+
+	if err != nil {
+		switch ee := err.(type) {
+		case *googleapi.Error:
+			if ee.Code == http.StatusPreconditionFailed {
+				err = &gcs.PreconditionError{Err: ee}
+			}
+			if ee.Code == http.StatusNotFound {
+				err = &gcs.NotFoundError{Err: storage.ErrObjectNotExist}
+			}
+		default:
+			err = fmt.Errorf("error in rewriting object: %w", err)
+		}
+		return
+	}
+
+	o = storageutil.ObjectAttrsToBucketObject(objAttrs)
+	return
+}
+
 func getProjectionValue(req gcs.Projection) storage.Projection {
 	// Explicitly converting Projection Value because the ProjectionVal interface of jacobsa/gcloud and Go Client API are not coupled correctly.
 	var convertedProjection storage.Projection // Stores the Projection Value according to the Go Client API Interface.
@@ -404,7 +580,7 @@ func (bh *bucketHandle) ListObjects(ctx context.Context, req *gcs.ListObjectsReq
 }
 
 func (bh *bucketHandle) UpdateObject(ctx context.Context, req *gcs.UpdateObjectRequest) (o *gcs.Object, err error) {
-	obj := bh.bucket.Object(req.Name)
+	obj := bh.object(req.Name)
 
 	if req.Generation != 0 {
 		obj = obj.Generation(req.Generation)
@@ -437,7 +613,11 @@ func (bh *bucketHandle) UpdateObject(ctx context.Context, req *gcs.UpdateObjectR
 		for key, element := range req.Metadata {
 			if element != nil {
 				updateQuery.Metadata[key] = *element
+				continue
 			}
+			// The client library sends keys mapped to an empty string as null,
+			// which deletes them from the object's metadata.
+			updateQuery.Metadata[key] = ""
 		}
 	}
 
@@ -449,6 +629,11 @@ func (bh *bucketHandle) UpdateObject(ctx context.Context, req *gcs.UpdateObjectR
 		return
 	}
 
+	if isEncryptionKeyMismatch(err) {
+		err = bh.encryptionKeyError(bh.bucketName, req.Name, err)
+		return
+	}
+
 	// If storage object does not exist, httpclient is returning ErrObjectNotExist error instead of googleapi error
 	// https://github.com/GoogleCloudPlatform/gcsfuse/blob/master/vendor/cloud.google.com/go/storage/http_client.go#L516
 	switch ee := err.(type) {
@@ -468,7 +653,7 @@ func (bh *bucketHandle) UpdateObject(ctx context.Context, req *gcs.UpdateObjectR
 }
 
 func (bh *bucketHandle) ComposeObjects(ctx context.Context, req *gcs.ComposeObjectsRequest) (o *gcs.Object, err error) {
-	dstObj := bh.bucket.Object(req.DstName)
+	dstObj := bh.object(req.DstName)
 
 	dstObjConds := storage.Conditions{}
 	if req.DstMetaGenerationPrecondition != nil {
@@ -494,7 +679,7 @@ func (bh *bucketHandle) ComposeObjects(ctx context.Context, req *gcs.ComposeObje
 	// Converting the req.Sources list to a list of storage.ObjectHandle as expected by the Go Storage Client.
 	var srcObjList []*storage.ObjectHandle
 	for _, src := range req.Sources {
-		currSrcObj := bh.bucket.Object(src.Name)
+		currSrcObj := bh.object(src.Name)
 		// Switching to requested Generation of the object.
 		// Zero src generation is the latest generation, we are skipping it because by default it will take the latest one
 		if src.Generation != 0 {
@@ -504,7 +689,13 @@ func (bh *bucketHandle) ComposeObjects(ctx context.Context, req *gcs.ComposeObje
 	}
 
 	// Composing Source Objects to Destination Object using Composer created through Go Storage Client.
-	attrs, err := dstObj.ComposerFrom(srcObjList...).Run(ctx)
+	composer := dstObj.ComposerFrom(srcObjList...)
+	composer.KMSKeyName = bh.kmsKeyName
+	attrs, err := composer.Run(ctx)
+	if isEncryptionKeyMismatch(err) {
+		err = bh.encryptionKeyError(bh.bucketName, req.DstName, err)
+		return
+	}
 	if err != nil {
 		switch ee := err.(type) {
 		case *googleapi.Error:
@@ -26,11 +26,13 @@ import (
 	"cloud.google.com/go/storage"
 	control "cloud.google.com/go/storage/control/apiv2"
 	"cloud.google.com/go/storage/control/apiv2/controlpb"
+	"github.com/googleapis/gax-go/v2/apierror"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -374,6 +376,38 @@ func (testSuite *BucketHandleTest) TestCopyObjectMethodWithInvalidGeneration() {
 	assert.True(testSuite.T(), errors.As(err, &notfound))
 }
 
+func (testSuite *BucketHandleTest) TestRewriteObjectMethodWithValidObject() {
+	var progressed uint64
+
+	obj, err := testSuite.bucketHandle.RewriteObject(context.Background(),
+		&gcs.RewriteObjectRequest{
+			SrcBucketName: TestBucketName,
+			SrcName:       TestObjectName,
+			DstName:       dstObjectName,
+			SrcGeneration: TestObjectGeneration,
+			ProgressFunc: func(bytesRewritten, _ uint64, _ string) {
+				progressed = bytesRewritten
+			},
+		})
+
+	require.NoError(testSuite.T(), err)
+	assert.Equal(testSuite.T(), dstObjectName, obj.Name)
+	assert.Equal(testSuite.T(), uint64(len(ContentInTestObject)), obj.Size)
+	assert.Equal(testSuite.T(), obj.Size, progressed)
+}
+
+func (testSuite *BucketHandleTest) TestRewriteObjectMethodWithMissingObject() {
+	var notfound *gcs.NotFoundError
+
+	_, err := testSuite.bucketHandle.RewriteObject(context.Background(),
+		&gcs.RewriteObjectRequest{
+			SrcName: missingObjectName,
+			DstName: dstObjectName,
+		})
+
+	assert.True(testSuite.T(), errors.As(err, &notfound))
+}
+
 func (testSuite *BucketHandleTest) TestCreateObjectMethodWithValidObject() {
 	content := "Creating a new object"
 	obj, err := testSuite.bucketHandle.CreateObject(context.Background(),
@@ -1520,3 +1554,53 @@ func (testSuite *BucketHandleTest) TestCreateFolderWithGivenName() {
 	assert.NoError(testSuite.T(), err)
 	assert.Equal(testSuite.T(), gcs.GCSFolder(TestBucketName, &mockFolder), folder)
 }
+
+func (testSuite *BucketHandleTest) TestCustomerKeyForBucket() {
+	key := []byte(strings.Repeat("k", 32))
+	otherKey := []byte(strings.Repeat("o", 32))
+	testSuite.bucketHandle.customerKeys = map[string][]byte{"*": key, "other": otherKey}
+
+	assert.Equal(testSuite.T(), key, testSuite.bucketHandle.customerKey(TestBucketName))
+	assert.Equal(testSuite.T(), otherKey, testSuite.bucketHandle.customerKey("other"))
+}
+
+func (testSuite *BucketHandleTest) TestCustomerKeyWhenNoneConfigured() {
+	assert.Nil(testSuite.T(), testSuite.bucketHandle.customerKey(TestBucketName))
+}
+
+func (testSuite *BucketHandleTest) TestIsEncryptionKeyMismatch() {
+	missingKeyErr := &googleapi.Error{
+		Code:    400,
+		Message: "The target object is encrypted by a customer-supplied encryption key.",
+		Errors:  []googleapi.ErrorItem{{Reason: "resourceIsEncryptedWithCustomerEncryptionKey"}},
+	}
+	grpcErr, _ := apierror.FromError(status.New(codes.InvalidArgument, "Provided encryption key is incorrect").Err())
+	testCases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"missing_key", fmt.Errorf("wrapped: %w", missingKeyErr), true},
+		{"wrong_key_message", &googleapi.Error{Code: 403, Message: "The provided encryption key is incorrect"}, true},
+		{"grpc_wrong_key", grpcErr, true},
+		{"other_bad_request", &googleapi.Error{Code: 400, Message: "Invalid argument."}, false},
+		{"not_found", storage.ErrObjectNotExist, false},
+	}
+
+	for _, tc := range testCases {
+		testSuite.Run(tc.name, func() {
+			assert.Equal(testSuite.T(), tc.want, isEncryptionKeyMismatch(tc.err))
+		})
+	}
+}
+
+func (testSuite *BucketHandleTest) TestEncryptionKeyError() {
+	cause := &googleapi.Error{Code: 400, Message: "The target object is encrypted by a customer-supplied encryption key."}
+
+	err := testSuite.bucketHandle.encryptionKeyError(TestBucketName, TestObjectName, cause)
+
+	var keyErr *gcs.EncryptionKeyError
+	require.True(testSuite.T(), errors.As(err, &keyErr))
+	assert.Equal(testSuite.T(), cause, keyErr.Err)
+}
@@ -265,6 +265,24 @@ func (b *fastStatBucket) CopyObject(
 	return
 }
 
+func (b *fastStatBucket) RewriteObject(
+	ctx context.Context,
+	req *gcs.RewriteObjectRequest) (o *gcs.Object, err error) {
+	// Throw away any existing record for the destination name.
+	b.invalidate(req.DstName)
+
+	// Rewrite the object.
+	o, err = b.wrapped.RewriteObject(ctx, req)
+	if err != nil {
+		return
+	}
+
+	// Record the new version.
+	b.insert(o)
+
+	return
+}
+
 // LOCKS_EXCLUDED(b.mu)
 func (b *fastStatBucket) ComposeObjects(
 	ctx context.Context,
@@ -193,6 +193,21 @@ func (b *debugBucket) CopyObject(
 	return
 }
 
+func (b *debugBucket) RewriteObject(
+	ctx context.Context,
+	req *gcs.RewriteObjectRequest) (o *gcs.Object, err error) {
+	id, desc, start := b.startRequest(
+		"RewriteObject(%q, %q, %q)",
+		req.SrcBucketName,
+		req.SrcName,
+		req.DstName)
+
+	defer b.finishRequest(id, desc, start, &err)
+
+	o, err = b.wrapped.RewriteObject(ctx, req)
+	return
+}
+
 func (b *debugBucket) ComposeObjects(
 	ctx context.Context,
 	req *gcs.ComposeObjectsRequest) (o *gcs.Object, err error) {
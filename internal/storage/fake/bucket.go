@@ -37,6 +37,10 @@ import (
 
 var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
 
+// The number of bytes a single simulated rewrite call copies, after which a
+// rewrite token is handed out.
+const rewriteChunkSize = 1 << 20
+
 // Equivalent to NewConn(clock).GetBucket(name).
 func NewFakeBucket(clock timeutil.Clock, name string, bucketType gcs.BucketType) gcs.Bucket {
 	b := &bucket{clock: clock, name: name, bucketType: bucketType}
@@ -44,6 +48,21 @@ func NewFakeBucket(clock timeutil.Clock, name string, bucketType gcs.BucketType)
 	return b
 }
 
+// NewFakeBuckets creates a fake bucket for each of the supplied names. Like
+// buckets in the same project, they can rewrite objects from one another.
+func NewFakeBuckets(clock timeutil.Clock, bucketType gcs.BucketType, names ...string) map[string]gcs.Bucket {
+	peers := make(map[string]*bucket)
+	buckets := make(map[string]gcs.Bucket)
+	for _, name := range names {
+		b := NewFakeBucket(clock, name, bucketType).(*bucket)
+		b.peers = peers
+		peers[name] = b
+		buckets[name] = b
+	}
+
+	return buckets
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Helper types
 ////////////////////////////////////////////////////////////////////////
@@ -178,6 +197,10 @@ type bucket struct {
 	//
 	// INVARIANT: This is an upper bound for generation numbers in objects.
 	prevGeneration int64 // GUARDED_BY(mu)
+
+	// Other buckets objects can be rewritten from, by name. Constant after
+	// creation.
+	peers map[string]*bucket
 }
 
 func checkName(name string) (err error) {
@@ -314,10 +337,12 @@ func preconditionChecks(b *bucket, req *gcs.CreateObjectRequest, contents []byte
 	if req.CRC32C != nil {
 		actual := crc32.Checksum(contents, crc32cTable)
 		if actual != *req.CRC32C {
-			err = fmt.Errorf(
-				"CRC32C mismatch: got 0x%08x, expected 0x%08x",
-				actual,
-				*req.CRC32C)
+			err = &gcs.ChecksumMismatchError{
+				Err: fmt.Errorf(
+					"CRC32C mismatch: got 0x%08x, expected 0x%08x",
+					actual,
+					*req.CRC32C),
+			}
 
 			return
 		}
@@ -327,10 +352,12 @@ func preconditionChecks(b *bucket, req *gcs.CreateObjectRequest, contents []byte
 	if req.MD5 != nil {
 		actual := md5.Sum(contents)
 		if actual != *req.MD5 {
-			err = fmt.Errorf(
-				"MD5 mismatch: got %s, expected %s",
-				hex.EncodeToString(actual[:]),
-				hex.EncodeToString(req.MD5[:]))
+			err = &gcs.ChecksumMismatchError{
+				Err: fmt.Errorf(
+					"MD5 mismatch: got %s, expected %s",
+					hex.EncodeToString(actual[:]),
+					hex.EncodeToString(req.MD5[:])),
+			}
 
 			return
 		}
@@ -422,7 +449,7 @@ func (b *bucket) createObjectLocked(
 
 	contents, err := io.ReadAll(req.Contents)
 	if err != nil {
-		err = fmt.Errorf("ReadAll: %v", err)
+		err = fmt.Errorf("ReadAll: %w", err)
 		return
 	}
 	err = preconditionChecks(b, req, contents)
@@ -776,6 +803,119 @@ func (b *bucket) CopyObject(
 	return
 }
 
+// Return a snapshot of the source object of a rewrite.
+//
+// LOCKS_EXCLUDED(b.mu)
+func (b *bucket) rewriteSource(req *gcs.RewriteObjectRequest) (o fakeObject, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	srcIndex := b.objects.find(req.SrcName)
+	if srcIndex == len(b.objects) ||
+		(req.SrcGeneration != 0 && b.objects[srcIndex].metadata.Generation != req.SrcGeneration) {
+		err = &gcs.NotFoundError{
+			Err: fmt.Errorf("object %q generation %d not found in %q", req.SrcName, req.SrcGeneration, b.name),
+		}
+
+		return
+	}
+
+	if req.SrcMetaGenerationPrecondition != nil &&
+		b.objects[srcIndex].metadata.MetaGeneration != *req.SrcMetaGenerationPrecondition {
+		err = &gcs.PreconditionError{
+			Err: fmt.Errorf(
+				"object %q has meta-generation %d",
+				req.SrcName,
+				b.objects[srcIndex].metadata.MetaGeneration),
+		}
+
+		return
+	}
+
+	o = b.objects[srcIndex]
+	o.metadata.Metadata = copyMetadata(o.metadata.Metadata)
+	return
+}
+
+// LOCKS_EXCLUDED(b.mu)
+func (b *bucket) RewriteObject(
+	ctx context.Context,
+	req *gcs.RewriteObjectRequest) (o *gcs.Object, err error) {
+	// Check that the destination name is legal.
+	err = checkName(req.DstName)
+	if err != nil {
+		return
+	}
+
+	src := b
+	if req.SrcBucketName != "" && req.SrcBucketName != b.name {
+		if src = b.peers[req.SrcBucketName]; src == nil {
+			err = &gcs.NotFoundError{
+				Err: fmt.Errorf("bucket %q not found", req.SrcBucketName),
+			}
+
+			return
+		}
+	}
+
+	srcObj, err := src.rewriteSource(req)
+	if err != nil {
+		return
+	}
+
+	// Simulate the series of calls GCS needs for large objects. The token
+	// records the source generation and the progress made so far.
+	tokenPrefix := fmt.Sprintf("%s/%s#%d->%s@", src.name, req.SrcName, srcObj.metadata.Generation, req.DstName)
+	var offset uint64
+	if req.RewriteToken != "" {
+		_, err = fmt.Sscanf(strings.TrimPrefix(req.RewriteToken, tokenPrefix), "%d", &offset)
+		if !strings.HasPrefix(req.RewriteToken, tokenPrefix) || err != nil || offset > srcObj.metadata.Size {
+			err = fmt.Errorf("invalid rewrite token %q", req.RewriteToken)
+			return
+		}
+	}
+
+	for {
+		offset = min(offset+rewriteChunkSize, srcObj.metadata.Size)
+		if offset == srcObj.metadata.Size {
+			break
+		}
+
+		if req.ProgressFunc != nil {
+			req.ProgressFunc(offset, srcObj.metadata.Size, fmt.Sprintf("%s%d", tokenPrefix, offset))
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	createReq := &gcs.CreateObjectRequest{
+		Name:                   req.DstName,
+		GenerationPrecondition: req.DstGenerationPrecondition,
+		ContentType:            srcObj.metadata.ContentType,
+		ContentLanguage:        srcObj.metadata.ContentLanguage,
+		ContentEncoding:        srcObj.metadata.ContentEncoding,
+		CacheControl:           srcObj.metadata.CacheControl,
+		Metadata:               srcObj.metadata.Metadata,
+	}
+
+	err = preconditionChecks(b, createReq, srcObj.data)
+	if err != nil {
+		return
+	}
+
+	o, err = createOrUpdateFakeObject(b, createReq, srcObj.data)
+	if err != nil {
+		return
+	}
+
+	if req.ProgressFunc != nil {
+		req.ProgressFunc(o.Size, o.Size, "")
+	}
+
+	return
+}
+
 // LOCKS_EXCLUDED(b.mu)
 func (b *bucket) ComposeObjects(
 	ctx context.Context,
@@ -0,0 +1,116 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteObjectAcrossBuckets(t *testing.T) {
+	buckets := NewFakeBuckets(timeutil.RealClock(), gcs.NonHierarchical, "src", "dst")
+	src, err := storageutil.CreateObject(context.Background(), buckets["src"], "foo", []byte("taco"))
+	require.NoError(t, err)
+
+	o, err := buckets["dst"].RewriteObject(context.Background(), &gcs.RewriteObjectRequest{
+		SrcBucketName:                 "src",
+		SrcName:                       "foo",
+		SrcGeneration:                 src.Generation,
+		SrcMetaGenerationPrecondition: &src.MetaGeneration,
+		DstName:                       "bar",
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "bar", o.Name)
+	contents, err := storageutil.ReadObject(context.Background(), buckets["dst"], "bar")
+	require.NoError(t, err)
+	assert.Equal(t, "taco", string(contents))
+	// The source is left alone.
+	_, err = storageutil.ReadObject(context.Background(), buckets["src"], "foo")
+	assert.NoError(t, err)
+}
+
+func TestRewriteObjectFromUnknownBucket(t *testing.T) {
+	b := NewFakeBucket(timeutil.RealClock(), "dst", gcs.NonHierarchical)
+	var notFoundErr *gcs.NotFoundError
+
+	_, err := b.RewriteObject(context.Background(), &gcs.RewriteObjectRequest{
+		SrcBucketName: "src",
+		SrcName:       "foo",
+		DstName:       "bar",
+	})
+
+	assert.True(t, errors.As(err, &notFoundErr))
+}
+
+func TestRewriteObjectDstGenerationPrecondition(t *testing.T) {
+	buckets := NewFakeBuckets(timeutil.RealClock(), gcs.NonHierarchical, "src", "dst")
+	_, err := storageutil.CreateObject(context.Background(), buckets["src"], "foo", []byte("taco"))
+	require.NoError(t, err)
+	_, err = storageutil.CreateObject(context.Background(), buckets["dst"], "bar", []byte("burrito"))
+	require.NoError(t, err)
+	var preconditionErr *gcs.PreconditionError
+	var zero int64
+
+	_, err = buckets["dst"].RewriteObject(context.Background(), &gcs.RewriteObjectRequest{
+		SrcBucketName:             "src",
+		SrcName:                   "foo",
+		DstName:                   "bar",
+		DstGenerationPrecondition: &zero,
+	})
+
+	assert.True(t, errors.As(err, &preconditionErr))
+}
+
+func TestRewriteObjectResumesFromToken(t *testing.T) {
+	buckets := NewFakeBuckets(timeutil.RealClock(), gcs.NonHierarchical, "src", "dst")
+	contents := bytes.Repeat([]byte("x"), 3*rewriteChunkSize)
+	_, err := storageutil.CreateObject(context.Background(), buckets["src"], "foo", contents)
+	require.NoError(t, err)
+	req := &gcs.RewriteObjectRequest{
+		SrcBucketName: "src",
+		SrcName:       "foo",
+		DstName:       "bar",
+	}
+	var tokens []string
+	req.ProgressFunc = func(_, _ uint64, rewriteToken string) {
+		tokens = append(tokens, rewriteToken)
+	}
+	_, err = buckets["dst"].RewriteObject(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(tokens))
+	assert.Equal(t, "", tokens[2])
+
+	// Resume from the second call.
+	req.RewriteToken = tokens[1]
+	tokens = nil
+	o, err := buckets["dst"].RewriteObject(context.Background(), req)
+
+	require.NoError(t, err)
+	assert.Equal(t, uint64(len(contents)), o.Size)
+	assert.Equal(t, 1, len(tokens))
+	// A token for another object is rejected.
+	req.DstName = "baz"
+	_, err = buckets["dst"].RewriteObject(context.Background(), req)
+	assert.Error(t, err)
+}
@@ -808,6 +808,7 @@ func (t *createTest) IncorrectCRC32C() {
 	_, err = t.bucket.CreateObject(t.ctx, req)
 	AssertThat(err, Error(HasSubstr("CRC32C")))
 	AssertThat(err, Error(HasSubstr("match")))
+	ExpectThat(err, HasSameTypeAs(&gcs.ChecksumMismatchError{}))
 
 	// It should not have been created.
 	statReq := &gcs.StatObjectRequest{
@@ -853,6 +854,7 @@ func (t *createTest) IncorrectMD5() {
 	_, err = t.bucket.CreateObject(t.ctx, req)
 	AssertThat(err, Error(HasSubstr("MD5")))
 	AssertThat(err, Error(HasSubstr("match")))
+	ExpectThat(err, HasSameTypeAs(&gcs.ChecksumMismatchError{}))
 
 	// It should not have been created.
 	statReq := &gcs.StatObjectRequest{
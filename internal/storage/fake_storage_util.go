@@ -20,6 +20,7 @@ import (
 )
 
 const TestBucketName string = "gcsfuse-default-bucket"
+const TestEmptyBucketName string = "gcsfuse-empty-bucket"
 const TestObjectRootFolderName string = "gcsfuse/"
 const TestObjectName string = "gcsfuse/default.txt"
 const TestFolderName string = "gcsfuse/folder"
@@ -69,6 +70,7 @@ func NewFakeStorage() FakeStorage {
 	if err != nil {
 		panic(err)
 	}
+	f.CreateBucketWithOpts(fakestorage.CreateBucketOpts{Name: TestEmptyBucketName})
 	fakeStorage := &fakeStorage{
 		fakeStorageServer: f,
 	}
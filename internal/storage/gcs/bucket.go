@@ -112,6 +112,19 @@ type Bucket interface {
 		ctx context.Context,
 		req *CopyObjectRequest) (*Object, error)
 
+	// Copy an object to a new name in this bucket, reading it from this or
+	// another bucket. Large objects are copied in several steps, which can be
+	// resumed with the token reported through req.ProgressFunc if a call fails.
+	// Any existing generation of the destination name will be overwritten.
+	//
+	// Returns a record for the new object.
+	//
+	// Official documentation:
+	//     https://cloud.google.com/storage/docs/json_api/v1/objects/rewrite
+	RewriteObject(
+		ctx context.Context,
+		req *RewriteObjectRequest) (*Object, error)
+
 	// Compose one or more source objects into a single destination object by
 	// concatenating. Any existing generation of the destination name will be
 	// overwritten.
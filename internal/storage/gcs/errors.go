@@ -35,3 +35,24 @@ type PreconditionError struct {
 func (pe *PreconditionError) Error() string {
 	return fmt.Sprintf("gcs.PreconditionError: %v", pe.Err)
 }
+
+// A *ChecksumMismatchError value is an error that indicates that the data
+// received by GCS doesn't have the checksum it was sent with.
+type ChecksumMismatchError struct {
+	Err error
+}
+
+func (cme *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("gcs.ChecksumMismatchError: %v", cme.Err)
+}
+
+// An *EncryptionKeyError value is an error that indicates that an object is
+// encrypted with a customer-supplied key other than the one the request was
+// made with, if any.
+type EncryptionKeyError struct {
+	Err error
+}
+
+func (eke *EncryptionKeyError) Error() string {
+	return fmt.Sprintf("gcs.EncryptionKeyError: %v", eke.Err)
+}
@@ -106,6 +106,40 @@ type CopyObjectRequest struct {
 	DstGenerationPrecondition *int64
 }
 
+// A request to copy an object to a new name, possibly in another bucket,
+// preserving all metadata. Unlike CopyObjectRequest, this may take several
+// calls to GCS for large objects, and an interrupted rewrite can be resumed.
+type RewriteObjectRequest struct {
+	// The bucket holding the source object. Empty means the bucket the request
+	// is sent to.
+	SrcBucketName string
+
+	SrcName string
+	DstName string
+
+	// The generation of the source object to copy, or zero for the latest
+	// generation.
+	SrcGeneration int64
+
+	// If non-nil, the destination object will be created/overwritten only if the
+	// current meta-generation for the source object is equal to the given value.
+	SrcMetaGenerationPrecondition *int64
+
+	// Destination object will be overwritten only if the current
+	// generation is equal to the given value. Zero means the object does not
+	// exist.
+	DstGenerationPrecondition *int64
+
+	// A token passed to ProgressFunc by an earlier, interrupted rewrite of the
+	// same source and destination. If set, the rewrite continues from there
+	// instead of starting over.
+	RewriteToken string
+
+	// If non-nil, called after each call to GCS with the number of bytes
+	// rewritten so far, the size of the object and the token to resume from.
+	ProgressFunc func(bytesRewritten uint64, totalBytes uint64, rewriteToken string)
+}
+
 // MaxSourcesPerComposeRequest is the maximum number of sources that a
 // ComposeObjectsRequest may contain.
 //
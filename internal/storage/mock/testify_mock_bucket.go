@@ -68,6 +68,11 @@ func (m *TestifyMockBucket) CopyObject(ctx context.Context, req *gcs.CopyObjectR
 	return args.Get(0).(*gcs.Object), args.Error(1)
 }
 
+func (m *TestifyMockBucket) RewriteObject(ctx context.Context, req *gcs.RewriteObjectRequest) (*gcs.Object, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(*gcs.Object), args.Error(1)
+}
+
 func (m *TestifyMockBucket) ComposeObjects(ctx context.Context, req *gcs.ComposeObjectsRequest) (*gcs.Object, error) {
 	args := m.Called(ctx, req)
 	return args.Get(0).(*gcs.Object), args.Error(1)
@@ -28,6 +28,7 @@ import (
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
 	"golang.org/x/net/context"
+	"google.golang.org/api/iterator"
 	option "google.golang.org/api/option"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -51,12 +52,20 @@ type StorageHandle interface {
 	//
 	// A user-project is required for all operations on Requester Pays buckets.
 	BucketHandle(ctx context.Context, bucketName string, billingProject string) (bh *bucketHandle)
+
+	// ListBuckets returns the names of all buckets of the given project that
+	// the caller can see.
+	ListBuckets(ctx context.Context, projectID string) (names []string, err error)
 }
 
 type storageClient struct {
 	client               *storage.Client
 	storageControlClient *control.StorageControlClient
 	directPathDetector   *gRPCDirectPathDetector
+
+	// See storageutil.StorageClientConfig.
+	customerKeys map[string][]byte
+	kmsKeyNames  map[string]string
 }
 
 type gRPCDirectPathDetector struct {
@@ -252,7 +261,13 @@ func NewStorageHandle(ctx context.Context, clientConfig storageutil.StorageClien
 		sc.SetRetry(storage.WithMaxAttempts(clientConfig.MaxRetryAttempts))
 	}
 
-	sh = &storageClient{client: sc, storageControlClient: controlClient, directPathDetector: directPathDetector}
+	sh = &storageClient{
+		client:               sc,
+		storageControlClient: controlClient,
+		directPathDetector:   directPathDetector,
+		customerKeys:         clientConfig.CustomerKeys,
+		kmsKeyNames:          clientConfig.KMSKeyNames,
+	}
 	return
 }
 
@@ -264,10 +279,14 @@ func (sh *storageClient) BucketHandle(ctx context.Context, bucketName string, bi
 	}
 
 	bh = &bucketHandle{
-		bucket:        storageBucketHandle,
-		bucketName:    bucketName,
-		controlClient: sh.storageControlClient,
+		bucket:         storageBucketHandle,
+		bucketName:     bucketName,
+		controlClient:  sh.storageControlClient,
+		client:         sh.client,
+		billingProject: billingProject,
+		customerKeys:   sh.customerKeys,
 	}
+	bh.kmsKeyName, _ = cfg.BucketValue(sh.kmsKeyNames, bucketName)
 	if sh.directPathDetector != nil {
 		if err := sh.directPathDetector.isDirectPathPossible(ctx, bucketName); err != nil {
 			logger.Warnf("Direct path connectivity unavailable for %s, reason: %v", bucketName, err)
@@ -275,3 +294,19 @@ func (sh *storageClient) BucketHandle(ctx context.Context, bucketName string, bi
 	}
 	return
 }
+
+func (sh *storageClient) ListBuckets(ctx context.Context, projectID string) (names []string, err error) {
+	it := sh.client.Buckets(ctx, projectID)
+	for {
+		var attrs *storage.BucketAttrs
+		attrs, err = it.Next()
+		if err == iterator.Done {
+			return names, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error in iterating through buckets of project %q: %w", projectID, err)
+		}
+
+		names = append(names, attrs.Name)
+	}
+}
@@ -67,6 +67,15 @@ func (testSuite *StorageHandleTest) TestBucketHandleWhenBucketDoesNotExistWithEm
 	assert.Nil(testSuite.T(), bucketHandle.Bucket)
 }
 
+func (testSuite *StorageHandleTest) TestListBuckets() {
+	storageHandle := testSuite.fakeStorage.CreateStorageHandle()
+
+	names, err := storageHandle.ListBuckets(testSuite.ctx, projectID)
+
+	require.NoError(testSuite.T(), err)
+	assert.ElementsMatch(testSuite.T(), []string{TestBucketName, TestEmptyBucketName}, names)
+}
+
 func (testSuite *StorageHandleTest) TestBucketHandleWhenBucketExistsWithNonEmptyBillingProject() {
 	storageHandle := testSuite.fakeStorage.CreateStorageHandle()
 	bucketHandle := storageHandle.BucketHandle(testSuite.ctx, TestBucketName, projectID)
@@ -57,6 +57,11 @@ type StorageClientConfig struct {
 	EnableHNS bool
 
 	ReadStallRetryConfig cfg.ReadStallGcsRetriesConfig
+
+	// The customer-supplied keys and the names of the Cloud KMS keys that
+	// objects are encrypted with, by bucket name or cfg.AllBuckets.
+	CustomerKeys map[string][]byte
+	KMSKeyNames  map[string]string
 }
 
 func CreateHttpClient(storageClientConfig *StorageClientConfig) (httpClient *http.Client, err error) {
@@ -0,0 +1,143 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/option"
+	"google.golang.org/api/secretmanager/v1"
+)
+
+// CustomerKeySize is the size of the AES-256 keys that GCS accepts as
+// customer-supplied encryption keys.
+const CustomerKeySize = 32
+
+// ResolveCustomerKeys reads the customer-supplied keys from the sources given
+// by bucket, see ResolveCustomerKey.
+func ResolveCustomerKeys(
+	ctx context.Context,
+	sources map[string]string,
+	opts ...option.ClientOption) (keys map[string][]byte, err error) {
+	keys = make(map[string][]byte, len(sources))
+	for bucket, source := range sources {
+		var key []byte
+		key, err = ResolveCustomerKey(ctx, source, opts...)
+		if err != nil {
+			err = fmt.Errorf("customer-supplied key for bucket %q: %w", bucket, err)
+			return
+		}
+		keys[bucket] = key
+	}
+
+	return
+}
+
+// ResolveCustomerKey reads a customer-supplied key from a source of the form
+// file:<path>, env:<variable> or secretmanager:<secret version name>, which
+// holds it as 32 raw or base64 encoded bytes. Secret Manager is reached with
+// the supplied client options.
+func ResolveCustomerKey(
+	ctx context.Context,
+	source string,
+	opts ...option.ClientOption) (key []byte, err error) {
+	var contents []byte
+	switch kind, location, _ := strings.Cut(source, ":"); kind {
+	case "file":
+		contents, err = os.ReadFile(location)
+		if err != nil {
+			err = fmt.Errorf("ReadFile: %w", err)
+			return
+		}
+
+	case "env":
+		value, ok := os.LookupEnv(location)
+		if !ok {
+			err = fmt.Errorf("environment variable %s isn't set", location)
+			return
+		}
+		contents = []byte(value)
+
+	case "secretmanager":
+		contents, err = accessSecretVersion(ctx, location, opts...)
+		if err != nil {
+			return
+		}
+
+	default:
+		err = fmt.Errorf("unsupported key source %q", source)
+		return
+	}
+
+	key, err = decodeCustomerKey(contents)
+	if err != nil {
+		err = fmt.Errorf("%s: %w", source, err)
+		return
+	}
+
+	return
+}
+
+func decodeCustomerKey(contents []byte) (key []byte, err error) {
+	if len(contents) == CustomerKeySize {
+		key = contents
+		return
+	}
+
+	key, err = base64.StdEncoding.DecodeString(string(bytes.TrimSpace(contents)))
+	if err != nil || len(key) != CustomerKeySize {
+		key = nil
+		err = fmt.Errorf("doesn't hold a %d byte key, raw or base64 encoded", CustomerKeySize)
+		return
+	}
+
+	return
+}
+
+func accessSecretVersion(
+	ctx context.Context,
+	name string,
+	opts ...option.ClientOption) (payload []byte, err error) {
+	opts = append([]option.ClientOption{option.WithScopes(secretmanager.CloudPlatformScope)}, opts...)
+	service, err := secretmanager.NewService(ctx, opts...)
+	if err != nil {
+		err = fmt.Errorf("secretmanager.NewService: %w", err)
+		return
+	}
+
+	resp, err := service.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+	if err != nil {
+		err = fmt.Errorf("accessing secret version %s: %w", name, err)
+		return
+	}
+
+	if resp.Payload == nil {
+		err = fmt.Errorf("secret version %s has no payload", name)
+		return
+	}
+
+	payload, err = base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		err = fmt.Errorf("decoding secret version %s: %w", name, err)
+		return
+	}
+
+	return
+}
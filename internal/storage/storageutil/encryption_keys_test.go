@@ -0,0 +1,109 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+var testCustomerKey = bytes.Repeat([]byte{0x5a}, CustomerKeySize)
+
+func TestResolveCustomerKey_File(t *testing.T) {
+	dir := t.TempDir()
+	raw := path.Join(dir, "raw.key")
+	require.NoError(t, os.WriteFile(raw, testCustomerKey, 0600))
+	encoded := path.Join(dir, "encoded.key")
+	require.NoError(t, os.WriteFile(encoded, []byte(base64.StdEncoding.EncodeToString(testCustomerKey)+"\n"), 0600))
+
+	for _, p := range []string{raw, encoded} {
+		key, err := ResolveCustomerKey(context.Background(), "file:"+p)
+
+		require.NoError(t, err)
+		assert.Equal(t, testCustomerKey, key)
+	}
+}
+
+func TestResolveCustomerKey_Env(t *testing.T) {
+	t.Setenv("GCSFUSE_TEST_CUSTOMER_KEY", base64.StdEncoding.EncodeToString(testCustomerKey))
+
+	key, err := ResolveCustomerKey(context.Background(), "env:GCSFUSE_TEST_CUSTOMER_KEY")
+
+	require.NoError(t, err)
+	assert.Equal(t, testCustomerKey, key)
+}
+
+func TestResolveCustomerKey_SecretManager(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/projects/p/secrets/s/versions/1:access") {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"name": "projects/p/secrets/s/versions/1", "payload": {"data": %q}}`,
+			base64.StdEncoding.EncodeToString(testCustomerKey))
+	}))
+	defer server.Close()
+
+	key, err := ResolveCustomerKey(
+		context.Background(),
+		"secretmanager:projects/p/secrets/s/versions/1",
+		option.WithEndpoint(server.URL),
+		option.WithoutAuthentication())
+
+	require.NoError(t, err)
+	assert.Equal(t, testCustomerKey, key)
+}
+
+func TestResolveCustomerKey_Invalid(t *testing.T) {
+	t.Setenv("GCSFUSE_TEST_SHORT_KEY", "c2hvcnQ=")
+	testCases := []struct {
+		name   string
+		source string
+	}{
+		{"unset_env", "env:GCSFUSE_TEST_UNSET_KEY"},
+		{"short_key", "env:GCSFUSE_TEST_SHORT_KEY"},
+		{"missing_file", "file:" + path.Join(t.TempDir(), "missing.key")},
+		{"unknown_source", "vault:key"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ResolveCustomerKey(context.Background(), tc.source)
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestResolveCustomerKeys(t *testing.T) {
+	t.Setenv("GCSFUSE_TEST_CUSTOMER_KEY", base64.StdEncoding.EncodeToString(testCustomerKey))
+
+	keys, err := ResolveCustomerKeys(context.Background(), map[string]string{"*": "env:GCSFUSE_TEST_CUSTOMER_KEY"})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"*": testCustomerKey}, keys)
+}
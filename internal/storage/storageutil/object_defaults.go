@@ -0,0 +1,92 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// ApplyObjectDefaults sets the attributes of the object to be created that
+// req leaves unset to those of the first of the defaults that apply to it.
+func ApplyObjectDefaults(defaults []cfg.ObjectDefaults, req *gcs.CreateObjectRequest) {
+	applyObjectDefaults(defaults, req.Name, objectAttrs{
+		storageClass:       &req.StorageClass,
+		cacheControl:       &req.CacheControl,
+		contentDisposition: &req.ContentDisposition,
+		contentLanguage:    &req.ContentLanguage,
+		contentType:        &req.ContentType,
+		metadata:           &req.Metadata,
+	})
+}
+
+// ApplyComposeObjectDefaults is ApplyObjectDefaults for objects created by
+// composing others.
+func ApplyComposeObjectDefaults(defaults []cfg.ObjectDefaults, req *gcs.ComposeObjectsRequest) {
+	applyObjectDefaults(defaults, req.DstName, objectAttrs{
+		storageClass:       &req.StorageClass,
+		cacheControl:       &req.CacheControl,
+		contentDisposition: &req.ContentDisposition,
+		contentLanguage:    &req.ContentLanguage,
+		contentType:        &req.ContentType,
+		metadata:           &req.Metadata,
+	})
+}
+
+// objectAttrs points at the attributes of a request creating an object that
+// defaults are applied to.
+type objectAttrs struct {
+	storageClass       *string
+	cacheControl       *string
+	contentDisposition *string
+	contentLanguage    *string
+	contentType        *string
+	metadata           *map[string]string
+}
+
+func applyObjectDefaults(defaults []cfg.ObjectDefaults, name string, attrs objectAttrs) {
+	d := cfg.ObjectDefaultsFor(defaults, name)
+	if d == nil {
+		return
+	}
+
+	setUnset(attrs.storageClass, d.StorageClass)
+	setUnset(attrs.cacheControl, d.CacheControl)
+	setUnset(attrs.contentDisposition, d.ContentDisposition)
+	setUnset(attrs.contentLanguage, d.ContentLanguage)
+	setUnset(attrs.contentType, d.ContentType)
+	*attrs.metadata = withDefaultMetadata(*attrs.metadata, d.Metadata)
+}
+
+func setUnset(attr *string, value string) {
+	if *attr == "" {
+		*attr = value
+	}
+}
+
+// withDefaultMetadata adds the entries of defaults whose keys metadata lacks
+// to it, creating it if needed.
+func withDefaultMetadata(metadata map[string]string, defaults map[string]string) map[string]string {
+	for k, v := range defaults {
+		if _, ok := metadata[k]; ok {
+			continue
+		}
+		if metadata == nil {
+			metadata = make(map[string]string, len(defaults))
+		}
+		metadata[k] = v
+	}
+	return metadata
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageutil
+
+import (
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/stretchr/testify/assert"
+)
+
+var testObjectDefaults = []cfg.ObjectDefaults{
+	{
+		Glob:         "logs/**",
+		StorageClass: "NEARLINE",
+		CacheControl: "no-store",
+		ContentType:  "text/plain",
+		Metadata:     map[string]string{"team": "infra", "owner": "ops"},
+	},
+}
+
+func TestApplyObjectDefaults(t *testing.T) {
+	req := &gcs.CreateObjectRequest{
+		Name:        "logs/2024/app.log",
+		ContentType: "application/json",
+		Metadata:    map[string]string{"owner": "me"},
+	}
+
+	ApplyObjectDefaults(testObjectDefaults, req)
+
+	assert.Equal(t, "NEARLINE", req.StorageClass)
+	assert.Equal(t, "no-store", req.CacheControl)
+	assert.Equal(t, "application/json", req.ContentType)
+	assert.Equal(t, map[string]string{"team": "infra", "owner": "me"}, req.Metadata)
+}
+
+func TestApplyObjectDefaults_NoMatch(t *testing.T) {
+	req := &gcs.CreateObjectRequest{Name: "data/a.csv"}
+
+	ApplyObjectDefaults(testObjectDefaults, req)
+
+	assert.Equal(t, &gcs.CreateObjectRequest{Name: "data/a.csv"}, req)
+}
+
+func TestApplyComposeObjectDefaults(t *testing.T) {
+	req := &gcs.ComposeObjectsRequest{DstName: "logs/app.log", StorageClass: "STANDARD"}
+
+	ApplyComposeObjectDefaults(testObjectDefaults, req)
+
+	assert.Equal(t, "STANDARD", req.StorageClass)
+	assert.Equal(t, "no-store", req.CacheControl)
+	assert.Equal(t, "text/plain", req.ContentType)
+	assert.Equal(t, map[string]string{"team": "infra", "owner": "ops"}, req.Metadata)
+}
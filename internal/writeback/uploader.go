@@ -0,0 +1,288 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package writeback uploads the contents of closed files to GCS in the
+// background, from the journal kept by the content cache.
+package writeback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+)
+
+// ErrConflict is returned for uploads whose object has been changed or
+// deleted since the contents were derived from it. Such contents are never
+// written over the object.
+var ErrConflict = errors.New("object changed since it was read")
+
+// Upload is the write-back of one journal entry.
+type Upload struct {
+	entry *contentcache.JournalEntry
+	done  chan struct{}
+
+	// Set before done is closed.
+	o   *gcs.Object
+	err error
+}
+
+// Entry returns the journal entry being written back.
+func (u *Upload) Entry() *contentcache.JournalEntry {
+	return u.entry
+}
+
+// Done returns a channel that is closed once the upload has finished.
+func (u *Upload) Done() <-chan struct{} {
+	return u.done
+}
+
+// Result returns the object written, or nil if the contents didn't differ
+// from the object.
+//
+// REQUIRES: Done() is closed.
+func (u *Upload) Result() (*gcs.Object, error) {
+	return u.o, u.err
+}
+
+// Uploader writes journal entries back to GCS, retrying failed attempts with
+// exponential backoff. Entries are removed from the journal once written, and
+// left there for the next mount if all attempts fail or the uploader is
+// stopped first.
+//
+// Safe for concurrent access.
+type Uploader struct {
+	contentCache   *contentcache.ContentCache
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	// Limits the number of uploads running in parallel.
+	sem chan struct{}
+
+	// Cancelled by Stop, which the uploads give up on.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	wg sync.WaitGroup
+
+	mu sync.Mutex
+
+	// The latest upload started for each object, until it finishes.
+	//
+	// GUARDED_BY(mu)
+	inProgress map[contentcache.CacheObjectKey]*Upload
+}
+
+// NewUploader creates an Uploader running up to maxParallel uploads at a
+// time.
+func NewUploader(
+	contentCache *contentcache.ContentCache,
+	maxParallel int,
+	maxAttempts int,
+	initialBackoff time.Duration,
+	maxBackoff time.Duration) *Uploader {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Uploader{
+		contentCache:   contentCache,
+		maxAttempts:    maxAttempts,
+		initialBackoff: initialBackoff,
+		maxBackoff:     maxBackoff,
+		sem:            make(chan struct{}, maxParallel),
+		ctx:            ctx,
+		cancel:         cancel,
+		inProgress:     make(map[contentcache.CacheObjectKey]*Upload),
+	}
+}
+
+// Start writes the entry back to the bucket in the background, calling onDone
+// (if not nil) once finished.
+func (up *Uploader) Start(
+	bucket *gcsx.SyncerBucket,
+	entry *contentcache.JournalEntry,
+	onDone func()) *Upload {
+	u := &Upload{
+		entry: entry,
+		done:  make(chan struct{}),
+	}
+
+	key := entry.Key()
+	up.mu.Lock()
+	up.inProgress[key] = u
+	up.mu.Unlock()
+
+	up.wg.Add(1)
+	go func() {
+		defer up.wg.Done()
+		up.run(bucket, u)
+
+		up.mu.Lock()
+		if up.inProgress[key] == u {
+			delete(up.inProgress, key)
+		}
+		up.mu.Unlock()
+
+		close(u.done)
+		if onDone != nil {
+			onDone()
+		}
+	}()
+
+	return u
+}
+
+// Await waits for the upload in progress to the given object, if any, to
+// finish. It fails only if ctx is done first.
+func (up *Uploader) Await(ctx context.Context, key contentcache.CacheObjectKey) error {
+	up.mu.Lock()
+	u := up.inProgress[key]
+	up.mu.Unlock()
+
+	if u == nil {
+		return nil
+	}
+
+	select {
+	case <-u.Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wait waits for all uploads started so far to finish.
+func (up *Uploader) Wait() {
+	up.wg.Wait()
+}
+
+// Stop cancels the uploads in progress, and those started later, then waits
+// for them to finish. The entries not written yet are left in the journal for
+// the next mount.
+func (up *Uploader) Stop() {
+	up.cancel()
+	up.wg.Wait()
+}
+
+func (up *Uploader) run(bucket *gcsx.SyncerBucket, u *Upload) {
+	m := u.entry.Metadata
+	select {
+	case up.sem <- struct{}{}:
+		defer func() { <-up.sem }()
+	case <-up.ctx.Done():
+		u.err = up.ctx.Err()
+		logger.Infof("Write-back of %s/%s stopped, leaving it for the next mount", m.BucketName, m.ObjectName)
+		return
+	}
+
+	backoff := up.initialBackoff
+	for attempt := 1; ; attempt++ {
+		u.o, u.err = up.writeBack(up.ctx, bucket, u.entry)
+		switch {
+		case u.err == nil:
+			u.entry.Destroy()
+			return
+
+		case errors.Is(u.err, ErrConflict):
+			logger.Errorf("Write-back of %s/%s: %v. Its contents are kept in %s", m.BucketName, m.ObjectName, u.err, m.FileNameOnDisk)
+			if err := u.entry.MarkConflict(); err != nil {
+				logger.Errorf("Write-back of %s/%s: MarkConflict: %v", m.BucketName, m.ObjectName, err)
+			}
+			return
+
+		case up.ctx.Err() != nil:
+			logger.Infof("Write-back of %s/%s stopped, leaving it for the next mount: %v", m.BucketName, m.ObjectName, u.err)
+			return
+
+		case attempt >= up.maxAttempts:
+			logger.Errorf("Write-back of %s/%s failed %d times, leaving it for the next mount: %v", m.BucketName, m.ObjectName, attempt, u.err)
+			return
+		}
+
+		logger.Warnf("Write-back of %s/%s failed, retrying in %v: %v", m.BucketName, m.ObjectName, backoff, u.err)
+		select {
+		case <-time.After(backoff):
+		case <-up.ctx.Done():
+			logger.Infof("Write-back of %s/%s stopped, leaving it for the next mount", m.BucketName, m.ObjectName)
+			return
+		}
+		backoff = min(2*backoff, up.maxBackoff)
+	}
+}
+
+// writeBack makes one attempt at writing the entry back, as long as the object
+// still has the generation the contents were derived from.
+func (up *Uploader) writeBack(
+	ctx context.Context,
+	bucket *gcsx.SyncerBucket,
+	entry *contentcache.JournalEntry) (o *gcs.Object, err error) {
+	m := entry.Metadata
+
+	// Fetch all the properties of the object, which are carried over to the new
+	// generation.
+	minObj, extAttrs, err := bucket.StatObject(ctx, &gcs.StatObjectRequest{
+		Name:                           m.ObjectName,
+		ForceFetchFromGcs:              true,
+		ReturnExtendedObjectAttributes: true,
+	})
+
+	var latest *gcs.Object
+	var notFoundErr *gcs.NotFoundError
+	switch {
+	case errors.As(err, &notFoundErr):
+		if m.SrcGeneration != 0 {
+			err = fmt.Errorf("%w: generation %d was deleted", ErrConflict, m.SrcGeneration)
+			return
+		}
+		err = nil
+
+	case err != nil:
+		err = fmt.Errorf("StatObject: %w", err)
+		return
+
+	case minObj.Generation != m.SrcGeneration:
+		err = fmt.Errorf("%w: generation %d was replaced by %d", ErrConflict, m.SrcGeneration, minObj.Generation)
+		return
+
+	default:
+		latest = storageutil.ConvertMinObjectAndExtendedObjectAttributesToObject(minObj, extAttrs)
+	}
+
+	content, err := up.contentCache.OpenJournalEntry(entry)
+	if err != nil {
+		err = fmt.Errorf("OpenJournalEntry: %w", err)
+		return
+	}
+	defer content.Destroy()
+
+	// A precondition error means that the object changed after the stat above,
+	// which the next attempt finds out.
+	if latest == nil {
+		o, err = bucket.SyncNewObject(ctx, m.ObjectName, m.NewObjectMetadata, content)
+	} else {
+		o, err = bucket.SyncObject(ctx, m.ObjectName, latest, content)
+	}
+	if err != nil {
+		err = fmt.Errorf("SyncObject: %w", err)
+		return
+	}
+
+	return
+}
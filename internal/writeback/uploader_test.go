@@ -0,0 +1,222 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writeback
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// A bucket whose CreateObject fails a number of times before calling through.
+type failingBucket struct {
+	gcs.Bucket
+	failures int
+}
+
+func (b *failingBucket) CreateObject(ctx context.Context, req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	if b.failures > 0 {
+		b.failures--
+		return nil, errors.New("transient error")
+	}
+	return b.Bucket.CreateObject(ctx, req)
+}
+
+type UploaderTest struct {
+	suite.Suite
+	ctx          context.Context
+	bucket       *failingBucket
+	syncerBucket gcsx.SyncerBucket
+	contentCache *contentcache.ContentCache
+	uploader     *Uploader
+}
+
+func TestUploaderTestSuite(t *testing.T) {
+	suite.Run(t, new(UploaderTest))
+}
+
+func (t *UploaderTest) SetupTest() {
+	t.ctx = context.Background()
+	t.bucket = &failingBucket{Bucket: fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.NonHierarchical)}
+	t.syncerBucket = gcsx.NewSyncerBucket(1, 10, ".gcsfuse_tmp/", nil, t.bucket, common.NewNoopMetrics())
+	t.contentCache = contentcache.New(t.T().TempDir(), timeutil.RealClock())
+	t.uploader = NewUploader(t.contentCache, 4, 3, time.Millisecond, time.Millisecond)
+}
+
+// addToJournal journals contents derived from the given object, which may be
+// nil.
+func (t *UploaderTest) addToJournal(src *gcs.Object, contents string) *contentcache.JournalEntry {
+	tf, err := t.contentCache.NewTempFile(io.NopCloser(strings.NewReader("")))
+	require.NoError(t.T(), err)
+	defer tf.Destroy()
+	_, err = tf.WriteAt([]byte(contents), 0)
+	require.NoError(t.T(), err)
+
+	var srcGeneration, srcMetaGeneration int64
+	if src != nil {
+		srcGeneration, srcMetaGeneration = src.Generation, src.MetaGeneration
+	}
+	entry, err := t.contentCache.AddToJournal(&contentcache.CacheObjectKey{BucketName: "some_bucket", ObjectName: "foo"}, srcGeneration, srcMetaGeneration, nil, tf)
+	require.NoError(t.T(), err)
+	return entry
+}
+
+func (t *UploaderTest) upload(entry *contentcache.JournalEntry) (*gcs.Object, error) {
+	done := make(chan struct{})
+	u := t.uploader.Start(&t.syncerBucket, entry, func() { close(done) })
+	<-done
+	return u.Result()
+}
+
+func (t *UploaderTest) readObject() string {
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, "foo")
+	require.NoError(t.T(), err)
+	return string(contents)
+}
+
+func (t *UploaderTest) TestNewObject() {
+	entry := t.addToJournal(nil, "taco")
+
+	o, err := t.upload(entry)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "foo", o.Name)
+	assert.Equal(t.T(), "taco", t.readObject())
+	// The entry is removed from the journal.
+	_, err = os.Stat(entry.Metadata.FileNameOnDisk)
+	assert.True(t.T(), os.IsNotExist(err))
+	_, err = os.Stat(entry.MetadataFileName)
+	assert.True(t.T(), os.IsNotExist(err))
+}
+
+func (t *UploaderTest) TestExistingObject() {
+	src, err := storageutil.CreateObject(t.ctx, t.bucket, "foo", []byte("burrito"))
+	require.NoError(t.T(), err)
+	entry := t.addToJournal(src, "taco")
+
+	o, err := t.upload(entry)
+
+	require.NoError(t.T(), err)
+	assert.Greater(t.T(), o.Generation, src.Generation)
+	assert.Equal(t.T(), "taco", t.readObject())
+}
+
+func (t *UploaderTest) TestObjectReplacedMeanwhile() {
+	src, err := storageutil.CreateObject(t.ctx, t.bucket, "foo", []byte("burrito"))
+	require.NoError(t.T(), err)
+	entry := t.addToJournal(src, "taco")
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, "foo", []byte("enchilada"))
+	require.NoError(t.T(), err)
+
+	_, err = t.upload(entry)
+
+	assert.ErrorIs(t.T(), err, ErrConflict)
+	assert.Equal(t.T(), "enchilada", t.readObject())
+	// The contents are kept, but not replayed.
+	assert.True(t.T(), entry.Metadata.Conflict)
+	_, err = os.Stat(entry.Metadata.FileNameOnDisk)
+	assert.NoError(t.T(), err)
+}
+
+func (t *UploaderTest) TestObjectCreatedMeanwhile() {
+	entry := t.addToJournal(nil, "taco")
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "foo", []byte("enchilada"))
+	require.NoError(t.T(), err)
+
+	_, err = t.upload(entry)
+
+	assert.ErrorIs(t.T(), err, ErrConflict)
+	assert.Equal(t.T(), "enchilada", t.readObject())
+}
+
+func (t *UploaderTest) TestObjectDeletedMeanwhile() {
+	src, err := storageutil.CreateObject(t.ctx, t.bucket, "foo", []byte("burrito"))
+	require.NoError(t.T(), err)
+	entry := t.addToJournal(src, "taco")
+	err = t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "foo"})
+	require.NoError(t.T(), err)
+
+	_, err = t.upload(entry)
+
+	assert.ErrorIs(t.T(), err, ErrConflict)
+}
+
+func (t *UploaderTest) TestRetriesFailures() {
+	entry := t.addToJournal(nil, "taco")
+	t.bucket.failures = 2
+
+	_, err := t.upload(entry)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", t.readObject())
+}
+
+func (t *UploaderTest) TestGivesUpAfterMaxAttempts() {
+	entry := t.addToJournal(nil, "taco")
+	t.bucket.failures = 3
+
+	_, err := t.upload(entry)
+
+	require.Error(t.T(), err)
+	assert.NotErrorIs(t.T(), err, ErrConflict)
+	// The entry is left for the next mount.
+	assert.False(t.T(), entry.Metadata.Conflict)
+	_, err = os.Stat(entry.MetadataFileName)
+	assert.NoError(t.T(), err)
+}
+
+func (t *UploaderTest) TestStopCancelsRetries() {
+	t.uploader = NewUploader(t.contentCache, 4, 3, time.Hour, time.Hour)
+	entry := t.addToJournal(nil, "taco")
+	t.bucket.failures = 1
+	u := t.uploader.Start(&t.syncerBucket, entry, nil)
+
+	t.uploader.Stop()
+
+	<-u.Done()
+	_, err := u.Result()
+	require.Error(t.T(), err)
+	// The entry is left for the next mount.
+	assert.False(t.T(), entry.Metadata.Conflict)
+	_, err = os.Stat(entry.MetadataFileName)
+	assert.NoError(t.T(), err)
+}
+
+func (t *UploaderTest) TestAwait() {
+	entry := t.addToJournal(nil, "taco")
+	t.uploader.Start(&t.syncerBucket, entry, nil)
+
+	err := t.uploader.Await(t.ctx, entry.Key())
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", t.readObject())
+	// Nothing is in progress anymore.
+	assert.NoError(t.T(), t.uploader.Await(t.ctx, entry.Key()))
+}
@@ -84,7 +84,7 @@ func computeFlagTemplateDataForParam(p Param) (flagTemplateData, error) {
 	case "[]int":
 		defaultValue = fmt.Sprintf("[]int{%s}", p.DefaultValue)
 		fn = "IntSliceP"
-	case "[]string":
+	case "[]string", "[]objectDefaults":
 		defaultValue = fmt.Sprintf("[]string{%s}", p.DefaultValue)
 		fn = "StringSliceP"
 	default:
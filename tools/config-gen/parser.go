@@ -76,7 +76,7 @@ func validateParam(param Param) error {
 	// Validate the data type.
 	idx := slices.IndexFunc(
 		[]string{"int", "float64", "bool", "string", "duration", "octal", "[]int",
-			"[]string", "logSeverity", "protocol", "resolvedPath"},
+			"[]string", "logSeverity", "protocol", "resolvedPath", "[]objectDefaults"},
 		func(dt string) bool {
 			return dt == param.Type
 		},